@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/pdservice/discover"
+)
+
+// AdminClient is the client to call admin api of running pdservice
+type AdminClient struct {
+	Server string
+	Host   string
+	Token  string
+	Prefix string
+	Client *http.Client
+}
+
+// NewAdminClient will create admin client by pdservice config
+func NewAdminClient(cfg *Config) (client *AdminClient) {
+	server := cfg.StrDef("", "admin_server")
+	if adminListen := cfg.StrDef("", "admin_listen"); len(server) < 1 && len(adminListen) > 0 {
+		host, port, _ := net.SplitHostPort(adminListen)
+		if len(host) < 1 || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		scheme := "http"
+		if len(cfg.StrDef("", "admin_tls_cert")) > 0 {
+			scheme = "https"
+		}
+		server = scheme + "://" + net.JoinHostPort(host, port)
+	}
+	if len(server) < 1 {
+		listenAddr := ":9231"
+		for _, listen := range cfg.ArrayStrDef([]string{listenAddr}, "listen") {
+			if address, role, err := discover.ParseListen(listen); err == nil && role != discover.RoleProxy {
+				listenAddr = address
+				break
+			}
+		}
+		host, port, _ := net.SplitHostPort(listenAddr)
+		if len(host) < 1 || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		server = "http://" + net.JoinHostPort(host, port)
+	}
+	client = &AdminClient{
+		Server: server,
+		Host:   cfg.StrDef("https", "host_self"),
+		Token:  cfg.StrDef("", "admin_token"),
+		Prefix: cfg.StrDef("/_api/", "admin_prefix"),
+		Client: &http.Client{Timeout: 5 * time.Minute},
+	}
+	return
+}
+
+// Do will send request to admin api by method/path
+func (a *AdminClient) Do(client *http.Client, method, path string, form url.Values) (res *http.Response, err error) {
+	uri := strings.TrimSuffix(a.Server, "/") + "/" + strings.Trim(a.Prefix, "/") + "/" + strings.TrimPrefix(path, "/")
+	body := strings.NewReader("")
+	if method == http.MethodGet {
+		if len(form) > 0 {
+			uri += "?" + form.Encode()
+		}
+	} else {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return
+	}
+	req.Host = a.Host
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	res, err = client.Do(req)
+	if err == nil && res.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		err = fmt.Errorf("status code %v, %v", res.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return
+}
+
+// Call will call admin api by method/path and return the response body
+func (a *AdminClient) Call(method, path string, form url.Values) (data []byte, err error) {
+	res, err := a.Do(a.Client, method, path, form)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	data, err = ioutil.ReadAll(res.Body)
+	return
+}
+
+// Stream will call admin api by method/path without timeout and copy the response body to writer
+func (a *AdminClient) Stream(method, path string, form url.Values, writer io.Writer) (err error) {
+	res, err := a.Do(&http.Client{Transport: a.Client.Transport}, method, path, form)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(writer, res.Body)
+	return
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codingeasygo/pdservice/discover"
+)
+
+var commands = map[string]func(args []string){
+	"serve":           runServe,
+	"agent":           runAgent,
+	"list":            runList,
+	"logs":            runLogs,
+	"restart":         runRestart,
+	"refresh":         runRefresh,
+	"upgrade":         runUpgrade,
+	"lint":            runLint,
+	"bench":           runBench,
+	"install":         runInstall,
+	"uninstall":       runUninstall,
+	"windows-service": runWindowsService,
+	"check-config":    runCheckConfig,
+	"config":          runConfig,
+	"hash-token":      runHashToken,
+	"-check":          runCheckConfig,
+	"help":            runHelp,
+	"-h":              runHelp,
+	"--help":          runHelp,
+}
+
+func runHelp(args []string) {
+	fmt.Printf("Usage: pdservice [COMMAND] [OPTIONS]\n")
+	fmt.Printf("       pdservice [serve] [config]               to start pdservice\n")
+	fmt.Printf("       pdservice agent [config]                 to report local containers to central pdservice\n")
+	fmt.Printf("       pdservice list [OPTIONS]                 to list services of running pdservice\n")
+	fmt.Printf("       pdservice logs [OPTIONS] service         to show service log\n")
+	fmt.Printf("       pdservice restart [OPTIONS] service      to restart service\n")
+	fmt.Printf("       pdservice refresh [OPTIONS]              to refresh service immediately\n")
+	fmt.Printf("       pdservice upgrade [OPTIONS]              to upgrade running pdservice by signed release\n")
+	fmt.Printf("       pdservice lint [OPTIONS] [container]     to check PD_* labels of container or all containers\n")
+	fmt.Printf("       pdservice bench [OPTIONS] target         to drive synthetic http/tcp/udp load through forward\n")
+	fmt.Printf("       pdservice install [OPTIONS]              to install pdservice as systemd unit or windows service\n")
+	fmt.Printf("       pdservice uninstall [OPTIONS]            to uninstall pdservice service\n")
+	fmt.Printf("       pdservice -check [config]                to check config and docker connectivity\n")
+	fmt.Printf("       pdservice config dump [OPTIONS] [config] to dump all config keys with default and source\n")
+	fmt.Printf("       pdservice hash-token [-bcrypt] token     to hash token for PD_SERVICE_TOKEN and admin token\n")
+	fmt.Printf("       pdservice -v                             to show version\n")
+	fmt.Printf("Run 'pdservice COMMAND -h' for more information on a command\n")
+}
+
+func runHashToken(args []string) {
+	flagSet := flag.NewFlagSet("pdservice hash-token", flag.ExitOnError)
+	useBcrypt := flagSet.Bool("bcrypt", false, "hash the token by bcrypt instead of sha256")
+	cost := flagSet.Int("cost", 0, "the bcrypt cost, 0 is default cost")
+	flagSet.Parse(args)
+	if flagSet.NArg() < 1 {
+		exitFail("token is required")
+	}
+	if !*useBcrypt {
+		fmt.Printf("%v\n", discover.HashToken(flagSet.Arg(0)))
+		return
+	}
+	hashed, err := discover.HashTokenBcrypt(flagSet.Arg(0), *cost)
+	if err != nil {
+		exitFail("hash token fail with %v", err)
+	}
+	fmt.Printf("%v\n", hashed)
+}
+
+func loadConfig(confPath string) (cfg *Config) {
+	cfg, err := LoadConfig(confPath)
+	if err != nil {
+		fmt.Printf("load config fail with %v\n", err)
+		os.Exit(1)
+	}
+	return
+}
+
+func newCommandFlag(name string) (flagSet *flag.FlagSet, confPath *string) {
+	flagSet = flag.NewFlagSet("pdservice "+name, flag.ExitOnError)
+	confPath = flagSet.String("c", "conf/pdservice.properties", "the config file of running pdservice")
+	return
+}
+
+func exitFail(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+	os.Exit(1)
+}
+
+func runList(args []string) {
+	flagSet, confPath := newCommandFlag("list")
+	flagSet.Parse(args)
+	data, err := NewAdminClient(loadConfig(*confPath)).Call(http.MethodGet, "services", nil)
+	if err != nil {
+		exitFail("list fail with %v", err)
+	}
+	services := []struct {
+		ID       string   `json:"id"`
+		Name     string   `json:"name"`
+		Version  string   `json:"version"`
+		Status   string   `json:"status"`
+		Forwards []string `json:"forwards"`
+	}{}
+	err = json.Unmarshal(data, &services)
+	if err != nil {
+		exitFail("list fail with %v", err)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "NAME\tVERSION\tSTATUS\tID\tFORWARDS\n")
+	for _, service := range services {
+		id := service.ID
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\n", service.Name, service.Version, service.Status, id, strings.Join(service.Forwards, ","))
+	}
+	writer.Flush()
+}
+
+func runLogs(args []string) {
+	flagSet, confPath := newCommandFlag("logs")
+	id := flagSet.String("id", "", "the container id of service")
+	version := flagSet.String("version", "", "the version of service")
+	since := flagSet.String("since", "", "Show logs since timestamp (e.g. 2013-01-02T13:23:37Z) or relative (e.g. 42m for 42 minutes)")
+	tail := flagSet.String("n", "", `Number of lines to show from the end of the logs (default "all")`)
+	follow := flagSet.Bool("f", false, "Follow log output")
+	timestamps := flagSet.Bool("t", false, "Show timestamps")
+	flagSet.Parse(args)
+	if flagSet.NArg() < 1 {
+		exitFail("Usage: pdservice logs [OPTIONS] service")
+	}
+	form := url.Values{}
+	form.Set("service", flagSet.Arg(0))
+	form.Set("id", *id)
+	form.Set("version", *version)
+	form.Set("since", *since)
+	form.Set("tail", *tail)
+	if *follow {
+		form.Set("follow", "1")
+	}
+	if *timestamps {
+		form.Set("timestamps", "1")
+	}
+	err := NewAdminClient(loadConfig(*confPath)).Stream(http.MethodGet, "logs", form, os.Stdout)
+	if err != nil {
+		exitFail("logs fail with %v", err)
+	}
+}
+
+func runRestart(args []string) {
+	flagSet, confPath := newCommandFlag("restart")
+	id := flagSet.String("id", "", "the container id of service")
+	version := flagSet.String("version", "", "the version of service")
+	flagSet.Parse(args)
+	if flagSet.NArg() < 1 {
+		exitFail("Usage: pdservice restart [OPTIONS] service")
+	}
+	form := url.Values{}
+	form.Set("service", flagSet.Arg(0))
+	form.Set("id", *id)
+	form.Set("version", *version)
+	data, err := NewAdminClient(loadConfig(*confPath)).Call(http.MethodPost, "restart", form)
+	if err != nil {
+		exitFail("restart fail with %v", err)
+	}
+	fmt.Printf("%v", string(data))
+}
+
+func runLint(args []string) {
+	flagSet, confPath := newCommandFlag("lint")
+	flagSet.Parse(args)
+	form := url.Values{}
+	lints := []*discover.LabelLint{}
+	if flagSet.NArg() > 0 {
+		form.Set("container", flagSet.Arg(0))
+	}
+	data, err := NewAdminClient(loadConfig(*confPath)).Call(http.MethodGet, "lint", form)
+	if err == nil && flagSet.NArg() > 0 {
+		lint := &discover.LabelLint{}
+		err = json.Unmarshal(data, lint)
+		lints = append(lints, lint)
+	} else if err == nil {
+		err = json.Unmarshal(data, &lints)
+	}
+	if err != nil {
+		exitFail("lint fail with %v", err)
+	}
+	problems := 0
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "CONTAINER\tLABEL\tVALUE\tPROBLEM\n")
+	for _, lint := range lints {
+		for _, problem := range lint.Problems {
+			fmt.Fprintf(writer, "%v-%v(%.12v)\t%v\t%v\t%v\n", lint.Name, lint.Version, lint.ID, problem.Label, problem.Value, problem.Message)
+			problems++
+		}
+	}
+	writer.Flush()
+	if problems > 0 {
+		exitFail("lint found %v problems", problems)
+	}
+}
+
+func runBench(args []string) {
+	flagSet := flag.NewFlagSet("pdservice bench", flag.ExitOnError)
+	bench := &discover.Bench{}
+	flagSet.StringVar(&bench.Type, "type", "http", "the forward type, http, tcp or udp")
+	flagSet.StringVar(&bench.Host, "host", "", "the host header of http request (e.g. v100.ds.test.loc)")
+	flagSet.IntVar(&bench.Concurrency, "c", 10, "the number of concurrent workers")
+	flagSet.IntVar(&bench.Requests, "n", 1000, "the number of requests, 0 is unlimited until duration")
+	flagSet.DurationVar(&bench.Duration, "d", 0, "the duration of load (e.g. 30s)")
+	flagSet.IntVar(&bench.Size, "size", 0, "the payload size, the http request is POST when it is not zero")
+	flagSet.DurationVar(&bench.Timeout, "timeout", 5*time.Second, "the timeout of each request")
+	flagSet.Parse(args)
+	if flagSet.NArg() < 1 {
+		exitFail("Usage: pdservice bench [OPTIONS] http://<listen>/path|<tcp addr>|<udp addr>")
+	}
+	bench.Target = flagSet.Arg(0)
+	report, err := bench.Run()
+	if err != nil {
+		exitFail("bench fail with %v", err)
+	}
+	fmt.Printf("%v\n", report)
+	if len(report.LastError) > 0 {
+		fmt.Printf("last error: %v\n", report.LastError)
+	}
+}
+
+func runRefresh(args []string) {
+	flagSet, confPath := newCommandFlag("refresh")
+	flagSet.Parse(args)
+	data, err := NewAdminClient(loadConfig(*confPath)).Call(http.MethodPost, "refresh", nil)
+	if err != nil {
+		exitFail("refresh fail with %v", err)
+	}
+	fmt.Printf("%v", string(data))
+}
+
+func runAgent(args []string) {
+	confPath := "conf/pdservice.properties"
+	if len(args) > 0 {
+		confPath = args[0]
+	}
+	cfg := loadConfig(confPath)
+	cfg.Print()
+	server, err := newServer(cfg)
+	if err != nil {
+		exitFail("agent fail with %v", err)
+	}
+	if len(server.AgentServer) < 1 || len(server.AgentToken) < 1 {
+		exitFail("agent_server and agent_token is required by agent")
+	}
+	discover.SetLogLevel(cfg.IntDef(30, "log"))
+	server.RunAgent(time.Duration(cfg.Int64Def(5000, "agent_interval")) * time.Millisecond)
+}
+
+func runUpgrade(args []string) {
+	flagSet, confPath := newCommandFlag("upgrade")
+	uri := flagSet.String("url", "", "the release binary url, the signature is downloaded from url.sig (default upgrade_url)")
+	flagSet.Parse(args)
+	form := url.Values{}
+	form.Set("url", *uri)
+	data, err := NewAdminClient(loadConfig(*confPath)).Call(http.MethodPost, "upgrade", form)
+	if err != nil {
+		exitFail("upgrade fail with %v", err)
+	}
+	fmt.Printf("%v", string(data))
+}
+
+func checkConfig(cfg *Config) (errs []error) {
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	for _, listen := range cfg.ArrayStrDef([]string{":9231"}, "listen") {
+		if _, _, err := discover.ParseListen(listen); err != nil {
+			fail("listen %v is invalid by %v", listen, err)
+		}
+	}
+	if adminListen := cfg.StrDef("", "admin_listen"); len(adminListen) > 0 {
+		if _, _, err := net.SplitHostPort(adminListen); err != nil {
+			fail("admin_listen is invalid by %v", err)
+		}
+	}
+	if cfg.Int64Def(10000, "refresh_time") <= 0 {
+		fail("refresh_time must be greater than zero")
+	}
+	if http3Addr := cfg.StrDef("", "http3_listen"); len(http3Addr) > 0 {
+		if _, _, err := net.SplitHostPort(http3Addr); err != nil {
+			fail("http3_listen is invalid by %v", err)
+		}
+		if !http3Supported {
+			fail("http3_listen is set, but http3 is not supported, rebuild with -tags http3")
+		}
+		for _, key := range []string{"http3_cert", "http3_key"} {
+			if _, err := os.Stat(cfg.StrDef("", key)); err != nil {
+				fail("%v is invalid by %v", key, err)
+			}
+		}
+	}
+	server, err := newServer(cfg)
+	if err != nil {
+		fail("%v", err)
+		return
+	}
+	errs = append(errs, server.Validate()...)
+	if err := server.CheckDocker(); err != nil {
+		fail("docker connect fail with %v", err)
+	}
+	return
+}
+
+func runCheckConfig(args []string) {
+	confPath := "conf/pdservice.properties"
+	if len(args) > 0 {
+		confPath = args[0]
+	}
+	cfg := loadConfig(confPath)
+	cfg.Print()
+	errs := checkConfig(cfg)
+	for _, err := range errs {
+		fmt.Printf("  - %v\n", err)
+	}
+	if len(errs) > 0 {
+		exitFail("check config %v fail with %v problems", confPath, len(errs))
+	}
+	fmt.Printf("check config %v success\n", confPath)
+}
+
+func runConfig(args []string) {
+	if len(args) < 1 || args[0] != "dump" {
+		exitFail("Usage: pdservice config dump [-format properties|yaml] [-show-secret] [config]")
+	}
+	flagSet := flag.NewFlagSet("pdservice config dump", flag.ExitOnError)
+	format := flagSet.String("format", "properties", "the output format, properties or yaml")
+	showSecret := flagSet.Bool("show-secret", false, "show the secret value without redacting")
+	flagSet.Parse(args[1:])
+	confPath := "conf/pdservice.properties"
+	if flagSet.NArg() > 0 {
+		confPath = flagSet.Arg(0)
+	}
+	out, err := DumpConfig(loadConfig(confPath).Items(!*showSecret), *format)
+	if err != nil {
+		exitFail("dump config fail with %v", err)
+	}
+	fmt.Printf("%v", out)
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codingeasygo/pdservice/discover"
+	"github.com/codingeasygo/util/xprop"
+)
+
+// EnvPrefix is the prefix of environment to override config, PDSERVICE_LISTEN=:9231 is same as listen=:9231
+const EnvPrefix = "PDSERVICE_"
+
+// Config is the loaded pdservice config with the source of key, the source is file or env
+type Config struct {
+	*xprop.Config
+	Sources map[string]string
+}
+
+// LoadConfig will load config from properties/yaml/toml file by extension and override it by PDSERVICE_* environment
+func LoadConfig(confPath string) (cfg *Config, err error) {
+	cfg = &Config{Config: xprop.NewConfig(), Sources: map[string]string{}}
+	switch strings.ToLower(filepath.Ext(confPath)) {
+	case ".yml", ".yaml", ".toml":
+		var data []byte
+		data, err = ioutil.ReadFile(confPath)
+		if err != nil {
+			return
+		}
+		var prop string
+		if strings.ToLower(filepath.Ext(confPath)) == ".toml" {
+			prop, err = convertTOML(string(data))
+		} else {
+			prop, err = convertYAML(string(data))
+		}
+		if err != nil {
+			err = fmt.Errorf("parse %v fail with %v", confPath, err)
+			return
+		}
+		err = cfg.LoadPropString(prop)
+		cfg.addSource(prop, "file")
+	default:
+		err = cfg.Load(confPath)
+		if data, xerr := ioutil.ReadFile(confPath); xerr == nil {
+			cfg.addSource(string(data), "file")
+		}
+	}
+	if err != nil {
+		return
+	}
+	if env := envProp(os.Environ()); len(env) > 0 {
+		err = cfg.LoadPropString(env)
+		cfg.addSource(env, "env")
+	}
+	return
+}
+
+func (c *Config) addSource(prop, source string) {
+	section := ""
+	for _, line := range strings.Split(prop, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 1 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section == "loc" {
+				section = ""
+			}
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		if len(section) > 0 {
+			key = section + "/" + key
+		}
+		c.Sources[key] = source
+	}
+}
+
+func secretKey(key string) bool {
+	for _, word := range []string{"token", "secret", "password"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) item(key *ConfigKey, redact bool) (item *discover.ConfigItem) {
+	item = &discover.ConfigItem{Key: key.Key, Type: key.Type, Default: key.Default, Source: "default"}
+	switch key.Type {
+	case "int":
+		def, _ := strconv.Atoi(key.Default)
+		item.Value = strconv.Itoa(c.IntDef(def, key.Key))
+	case "int64":
+		def, _ := strconv.ParseInt(key.Default, 10, 64)
+		item.Value = strconv.FormatInt(c.Int64Def(def, key.Key), 10)
+	case "array":
+		var def []string
+		if len(key.Default) > 0 {
+			def = strings.Split(key.Default, ",")
+		}
+		item.Value = strings.Join(c.ArrayStrDef(def, key.Key), ",")
+	default:
+		item.Value = c.StrDef(key.Default, key.Key)
+	}
+	if source, ok := c.Sources[key.Key]; ok {
+		item.Source = source
+	}
+	if redact && secretKey(key.Key) && len(item.Value) > 0 {
+		item.Value = "******"
+	}
+	return
+}
+
+// Items will return the effective value of all keys in ConfigSchema, the secret value is redacted if redact is true
+func (c *Config) Items(redact bool) (items []*discover.ConfigItem) {
+	for _, key := range ConfigSchema {
+		var names []string
+		switch {
+		case strings.Contains(key.Key, "<tenant>"):
+			names = c.ArrayStrDef(nil, "tenants")
+		case strings.Contains(key.Key, "<registry>"):
+			names = c.ArrayStrDef(nil, "registries")
+		default:
+			items = append(items, c.item(key, redact))
+			continue
+		}
+		for _, name := range names {
+			replacer := strings.NewReplacer("<tenant>", name, "<registry>", name)
+			items = append(items, c.item(&ConfigKey{Key: replacer.Replace(key.Key), Type: key.Type, Default: replacer.Replace(key.Default)}, redact))
+		}
+	}
+	return
+}
+
+// DumpConfig will render the config items to properties or yaml, the type/default/source is written as comment
+func DumpConfig(items []*discover.ConfigItem, format string) (out string, err error) {
+	buf := &strings.Builder{}
+	switch format {
+	case "properties":
+		buf.WriteString("[loc]\n")
+		for _, item := range items {
+			fmt.Fprintf(buf, "# %v, default %q, from %v\n%v=%v\n", item.Type, item.Default, item.Source, item.Key, item.Value)
+		}
+	case "yaml":
+		for _, item := range items {
+			value := item.Value
+			switch item.Type {
+			case "array":
+				values := []string{}
+				for _, v := range strings.Split(item.Value, ",") {
+					if len(v) > 0 {
+						values = append(values, strconv.Quote(v))
+					}
+				}
+				value = "[" + strings.Join(values, ", ") + "]"
+			case "string":
+				value = strconv.Quote(item.Value)
+			}
+			fmt.Fprintf(buf, "%v: %v # %v, default %q, from %v\n", item.Key, value, item.Type, item.Default, item.Source)
+		}
+	default:
+		err = fmt.Errorf("unsupported format %v", format)
+		return
+	}
+	out = buf.String()
+	return
+}
+
+func envProp(environ []string) (prop string) {
+	lines := []string{}
+	for _, env := range environ {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) < 2 || !strings.HasPrefix(parts[0], EnvPrefix) || len(parts[0]) == len(EnvPrefix) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%v=%v", strings.ToLower(strings.TrimPrefix(parts[0], EnvPrefix)), parts[1]))
+	}
+	if len(lines) > 0 {
+		sort.Strings(lines)
+		prop = "[loc]\n" + strings.Join(lines, "\n") + "\n"
+	}
+	return
+}
+
+func trimComment(line string) string {
+	quote := byte(0)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseValue(val string) (str string, err error) {
+	val = strings.TrimSpace(val)
+	switch {
+	case strings.HasPrefix(val, `"`):
+		str, err = strconv.Unquote(val)
+	case strings.HasPrefix(val, "'"):
+		if len(val) < 2 || !strings.HasSuffix(val, "'") {
+			err = fmt.Errorf("invalid value %v", val)
+			return
+		}
+		str = val[1 : len(val)-1]
+	case strings.HasPrefix(val, "["):
+		if !strings.HasSuffix(val, "]") {
+			err = fmt.Errorf("invalid array %v", val)
+			return
+		}
+		items := []string{}
+		for _, item := range strings.Split(val[1:len(val)-1], ",") {
+			if item = strings.TrimSpace(item); len(item) < 1 {
+				continue
+			}
+			if item, err = parseValue(item); err != nil {
+				return
+			}
+			items = append(items, item)
+		}
+		str = strings.Join(items, ",")
+	case val == "true":
+		str = "1"
+	case val == "false":
+		str = "0"
+	default:
+		str = val
+	}
+	return
+}
+
+type propWriter struct {
+	sections []string
+	values   map[string][]string
+}
+
+func (p *propWriter) Add(section, key, val string) {
+	if p.values == nil {
+		p.values = map[string][]string{}
+	}
+	if len(section) < 1 {
+		section = "loc"
+	}
+	if _, ok := p.values[section]; !ok {
+		p.sections = append(p.sections, section)
+	}
+	p.values[section] = append(p.values[section], key+"="+val)
+}
+
+func (p *propWriter) String() string {
+	buf := &strings.Builder{}
+	for _, section := range p.sections {
+		fmt.Fprintf(buf, "[%v]\n%v\n", section, strings.Join(p.values[section], "\n"))
+	}
+	return buf.String()
+}
+
+// convertYAML will convert the simple yaml to properties, only key/value, one level section and list is supported
+func convertYAML(data string) (prop string, err error) {
+	writer := &propWriter{}
+	section, listKey, listSection := "", "", ""
+	listItems := []string{}
+	flushList := func() {
+		if len(listKey) > 0 && len(listItems) > 0 {
+			writer.Add(listSection, listKey, strings.Join(listItems, ","))
+		}
+		listKey, listItems = "", []string{}
+	}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		raw := strings.TrimRight(trimComment(scanner.Text()), " \t\r")
+		line := strings.TrimSpace(raw)
+		if len(line) < 1 || line == "---" {
+			continue
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " \t"))
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			if len(listKey) < 1 {
+				err = fmt.Errorf("line %v: list item without key", n)
+				return
+			}
+			var item string
+			if item, err = parseValue(strings.TrimPrefix(line, "-")); err != nil {
+				err = fmt.Errorf("line %v: %v", n, err)
+				return
+			}
+			listItems = append(listItems, item)
+			continue
+		}
+		flushList()
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) < 2 {
+			err = fmt.Errorf("line %v: invalid line %v", n, line)
+			return
+		}
+		key, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if indent == 0 {
+			section = ""
+		}
+		if len(val) < 1 {
+			listKey, listSection = key, section
+			if indent == 0 {
+				section = key
+			}
+			continue
+		}
+		if val, err = parseValue(val); err != nil {
+			err = fmt.Errorf("line %v: %v", n, err)
+			return
+		}
+		writer.Add(section, key, val)
+	}
+	flushList()
+	prop = writer.String()
+	return
+}
+
+// convertTOML will convert the simple toml to properties, only key/value, table and inline array is supported
+func convertTOML(data string) (prop string, err error) {
+	writer := &propWriter{}
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(trimComment(scanner.Text()))
+		if len(line) < 1 {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) < 2 {
+			err = fmt.Errorf("line %v: invalid line %v", n, line)
+			return
+		}
+		key, val := strings.Trim(strings.TrimSpace(parts[0]), `"`), ""
+		if val, err = parseValue(parts[1]); err != nil {
+			err = fmt.Errorf("line %v: %v", n, err)
+			return
+		}
+		writer.Add(section, key, val)
+	}
+	prop = writer.String()
+	return
+}
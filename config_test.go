@@ -0,0 +1,204 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestConvertYAML(t *testing.T) {
+	prop, err := convertYAML(`
+# pdservice config
+listen: ":9231" # listen address
+refresh_time: 10000
+robots: false
+docker_clear_exc:
+  - "^/a.*"
+  - b
+hidden: [admin-*, 'internal-*']
+server:
+  name: test
+`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expect := "[loc]\nlisten=:9231\nrefresh_time=10000\nrobots=0\ndocker_clear_exc=^/a.*,b\nhidden=admin-*,internal-*\n[server]\nname=test\n"
+	if prop != expect {
+		t.Errorf("%q", prop)
+		return
+	}
+	for _, data := range []string{"xx", "- a", `listen: "a`} {
+		if _, err = convertYAML(data); err == nil {
+			t.Error(data)
+			return
+		}
+	}
+}
+
+func TestConvertTOML(t *testing.T) {
+	prop, err := convertTOML(`
+# pdservice config
+listen = ":9231"
+read_only = true
+hidden = ["admin-*", "internal-*"]
+[server]
+name = 'test' # name
+`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expect := "[loc]\nlisten=:9231\nread_only=1\nhidden=admin-*,internal-*\n[server]\nname=test\n"
+	if prop != expect {
+		t.Errorf("%q", prop)
+		return
+	}
+	for _, data := range []string{"xx", `listen = "a`, "hidden = [a"} {
+		if _, err = convertTOML(data); err == nil {
+			t.Error(data)
+			return
+		}
+	}
+}
+
+func TestEnvProp(t *testing.T) {
+	prop := envProp([]string{"PDSERVICE_LISTEN=:80", "PDSERVICE_=x", "PATH=/bin", "PDSERVICE_ADMIN_TOKEN=a=b"})
+	if prop != "[loc]\nadmin_token=a=b\nlisten=:80\n" {
+		t.Errorf("%q", prop)
+		return
+	}
+	if envProp(nil) != "" {
+		t.Error("error")
+		return
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	types := map[string]string{"StrDef": "string", "IntDef": "int", "Int64Def": "int64", "ArrayStrDef": "array"}
+	schema := map[string]*ConfigKey{}
+	for _, key := range ConfigSchema {
+		if _, ok := schema[key.Key]; ok {
+			t.Errorf("duplicate key %v", key.Key)
+		}
+		schema[key.Key] = key
+	}
+	fset := token.NewFileSet()
+	for _, filename := range []string{"service.go", "admin.go", "command.go"} {
+		file, err := parser.ParseFile(fset, filename, nil, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		ast.Inspect(file, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok || len(call.Args) != 2 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || len(types[sel.Sel.Name]) < 1 {
+				return true
+			}
+			if ident, ok := sel.X.(*ast.Ident); !ok || ident.Name != "cfg" {
+				return true
+			}
+			lit, ok := call.Args[1].(*ast.BasicLit)
+			if !ok {
+				return true
+			}
+			name, _ := strconv.Unquote(lit.Value)
+			key := schema[name]
+			if key == nil || key.Type != types[sel.Sel.Name] {
+				t.Errorf("%v key %v is not in schema or type is not %v", fset.Position(call.Pos()), name, types[sel.Sel.Name])
+				return true
+			}
+			if def, ok := call.Args[0].(*ast.BasicLit); ok {
+				if value, err := strconv.Unquote(def.Value); err == nil {
+					def.Value = value
+				}
+				if def.Value != key.Default {
+					t.Errorf("%v key %v default %v is not matched to %v", fset.Position(call.Pos()), name, def.Value, key.Default)
+				}
+			}
+			return true
+		})
+	}
+}
+
+func TestConfigDump(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "pdservice")
+	defer os.RemoveAll(dir)
+	confPath := filepath.Join(dir, "pdservice.properties")
+	ioutil.WriteFile(confPath, []byte("[loc]\nlisten=:9232\nadmin_token=abc\ntenants=t1\n"), 0644)
+	os.Setenv("PDSERVICE_REFRESH_TIME", "3000")
+	defer os.Unsetenv("PDSERVICE_REFRESH_TIME")
+	cfg, err := LoadConfig(confPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	items := map[string]string{}
+	for _, item := range cfg.Items(true) {
+		items[item.Key] = item.Value + "/" + item.Source
+	}
+	if items["listen"] != ":9232/file" || items["refresh_time"] != "3000/env" || items["log"] != "30/default" {
+		t.Error(items)
+		return
+	}
+	if items["admin_token"] != "******/file" || items["tenant_t1_host_suffix"] != "/default" {
+		t.Error(items)
+		return
+	}
+	if _, ok := items["tenant_<tenant>_host_suffix"]; ok {
+		t.Error(items)
+		return
+	}
+	out, err := DumpConfig(cfg.Items(false), "properties")
+	if err != nil || !strings.Contains(out, "admin_token=abc\n") || !strings.Contains(out, "# array, default \":9231\", from file\nlisten=:9232\n") {
+		t.Errorf("%v,%v", err, out)
+		return
+	}
+	out, err = DumpConfig(cfg.Items(true), "yaml")
+	if err != nil || !strings.Contains(out, `listen: [":9232"] # array`) || !strings.Contains(out, "refresh_time: 3000 #") {
+		t.Errorf("%v,%v", err, out)
+		return
+	}
+	if _, err = convertYAML(out); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = DumpConfig(nil, "xml"); err == nil {
+		t.Error("nil")
+		return
+	}
+}
+
+func TestCheckConfigHTTP3(t *testing.T) {
+	if http3Supported {
+		t.Skip("http3 is supported")
+		return
+	}
+	dir, _ := ioutil.TempDir("", "pdservice")
+	defer os.RemoveAll(dir)
+	confPath := filepath.Join(dir, "pdservice.properties")
+	ioutil.WriteFile(confPath, []byte("[loc]\nhttp3_listen=:9443\nhttp3_cert="+confPath+"\nhttp3_key="+confPath+"\n"), 0644)
+	cfg, err := LoadConfig(confPath)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	found := false
+	for _, err := range checkConfig(cfg) {
+		found = found || strings.Contains(err.Error(), "http3 is not supported")
+	}
+	if !found {
+		t.Error("http3_listen is not rejected")
+		return
+	}
+}
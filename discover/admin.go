@@ -0,0 +1,501 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Pause will pause the refresh loop and freeze current proxy table
+func (d *Discover) Pause() {
+	d.stateLock.Lock()
+	d.paused = true
+	d.stateLock.Unlock()
+	InfoLog("Discover refresh is paused")
+}
+
+// Resume will resume the paused refresh loop
+func (d *Discover) Resume() {
+	d.stateLock.Lock()
+	d.paused = false
+	d.stateLock.Unlock()
+	InfoLog("Discover refresh is resumed")
+}
+
+// IsPaused will return if the refresh loop is paused
+func (d *Discover) IsPaused() bool {
+	d.stateLock.RLock()
+	defer d.stateLock.RUnlock()
+	return d.paused
+}
+
+// SetReadOnly will switch read-only mode, the control actions of start/stop/restart/clear/prune are rejected on read-only mode
+func (d *Discover) SetReadOnly(readOnly bool) {
+	d.stateLock.Lock()
+	d.readOnly = readOnly
+	d.stateLock.Unlock()
+	InfoLog("Discover read-only mode is set to %v", readOnly)
+}
+
+// IsReadOnly will return if read-only mode is enabled
+func (d *Discover) IsReadOnly() bool {
+	d.stateLock.RLock()
+	defer d.stateLock.RUnlock()
+	return d.readOnly
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (d *Discover) adminToken(r *http.Request) (token string) {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	} else if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	}
+	return
+}
+
+func (d *Discover) adminStatus() xmap.M {
+	d.proxyLock.RLock()
+	services := len(d.proxyAll)
+	d.proxyLock.RUnlock()
+	return xmap.M{
+		"paused":    d.IsPaused(),
+		"read_only": d.IsReadOnly(),
+		"services":  services,
+		"refresh":   d.RefreshStats(),
+	}
+}
+
+// RefreshNow will run the refresh/clear/prune cycle immediately with triggers configured by StartRefresh
+func (d *Discover) RefreshNow() (added, updated, removed map[string]*Container, err error) {
+	added, updated, removed, err = d.callCycle(d.triggerAdded, d.triggerRemoved, d.triggerUpdated)
+	return
+}
+
+func prefixList(services map[string]*Container) (prefixes []string) {
+	prefixes = []string{}
+	for prefix := range services {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return
+}
+
+func (d *Discover) procAdminRefresh(w http.ResponseWriter, r *http.Request) {
+	if d.IsPaused() {
+		writeJSON(w, http.StatusConflict, xmap.M{"code": http.StatusConflict, "message": "refresh is paused"})
+		return
+	}
+	added, updated, removed, err := d.RefreshNow()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, xmap.M{"code": http.StatusInternalServerError, "message": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, xmap.M{
+		"added":   prefixList(added),
+		"updated": prefixList(updated),
+		"removed": prefixList(removed),
+	})
+}
+
+// findServices will return the container by service name, the container is filtered by tenant/id/version when it is not empty
+func (d *Discover) findServices(tenant *Tenant, name, id, version string) (services []*Container) {
+	d.proxyLock.RLock()
+	defer d.proxyLock.RUnlock()
+	added := map[string]bool{}
+	for _, service := range d.proxyAll {
+		if service.Name != name || added[service.ID] || !inTenant(tenant, service) {
+			continue
+		}
+		if len(id) > 0 && !strings.HasPrefix(service.ID, id) || len(version) > 0 && service.Version != version {
+			continue
+		}
+		added[service.ID] = true
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return CompareVersion(services[i].Version, services[j].Version) > 0
+	})
+	return
+}
+
+func (d *Discover) procAdminServices(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	d.proxyLock.RLock()
+	serviceAll := map[string]xmap.M{}
+	for _, service := range d.proxyAll {
+		if !inTenant(tenant, service) {
+			continue
+		}
+		info := serviceAll[service.ID]
+		if info == nil {
+			info = xmap.M{
+				"id":          service.ID,
+				"name":        service.Name,
+				"version":     service.Version,
+				"status":      service.Status,
+				"started_at":  service.StartedAt,
+				"finished_at": service.FinishedAt,
+				"tenant":      service.Tenant,
+				"quota":       service.Quota,
+				"health":      service.Health,
+				"forwards":    []string{},
+			}
+			if len(service.Problems) > 0 {
+				info["problems"] = service.Problems
+			}
+			if len(service.PreviousIDs) > 0 {
+				info["previous_ids"] = service.PreviousIDs
+			}
+			serviceAll[service.ID] = info
+		}
+	}
+	for prefix, service := range d.proxyAll {
+		if forward := service.Forwards[prefix]; forward != nil && !d.isHidden(service, forward) && inTenant(tenant, service) {
+			serviceAll[service.ID]["forwards"] = append(serviceAll[service.ID]["forwards"].([]string), prefix)
+		}
+	}
+	d.proxyLock.RUnlock()
+	services := []xmap.M{}
+	for _, info := range serviceAll {
+		if forwards := info["forwards"].([]string); len(forwards) > 0 {
+			sort.Strings(forwards)
+			services = append(services, info)
+		}
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i]["name"] != services[j]["name"] {
+			return services[i]["name"].(string) < services[j]["name"].(string)
+		}
+		return CompareVersion(services[i]["version"].(string), services[j]["version"].(string)) > 0
+	})
+	writeJSON(w, http.StatusOK, services)
+}
+
+func (d *Discover) procAdminCatalog(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	filter := ParseCatalogFilter(r.URL.Query())
+	hostsAll, proxyAll, forwardAll := d.listCatalog(func(service *Container, forward *Forward) bool {
+		return inTenant(tenant, service) && filter.Match(service, forward)
+	})
+	catalog := []xmap.M{}
+	for _, host := range hostsAll {
+		service, forward := proxyAll[host], forwardAll[host]
+		aliases := forward.Aliases
+		if aliases == nil {
+			aliases = []string{}
+		}
+		item := xmap.M{
+			"host":       host,
+			"name":       service.Name,
+			"version":    service.Version,
+			"status":     service.Status,
+			"started_at": service.StartedAt,
+			"tenant":     service.Tenant,
+			"stats":      d.ResourceStats(service.ID),
+			"forward": xmap.M{
+				"name":     forward.Name,
+				"type":     forward.Type,
+				"prefix":   forward.Prefix,
+				"wildcard": forward.Wildcard,
+				"default":  forward.Default,
+				"aliases":  aliases,
+			},
+		}
+		if len(service.Problems) > 0 {
+			item["problems"] = service.Problems
+		}
+		catalog = append(catalog, item)
+	}
+	writeJSON(w, http.StatusOK, catalog)
+}
+
+type flushWriter struct {
+	http.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (n int, err error) {
+	n, err = f.ResponseWriter.Write(p)
+	if flusher, ok := f.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return
+}
+
+func (d *Discover) procAdminLogs(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	services := d.findServices(tenant, r.FormValue("service"), r.FormValue("id"), r.FormValue("version"))
+	if len(services) < 1 {
+		writeJSON(w, http.StatusNotFound, xmap.M{"code": http.StatusNotFound, "message": "service not found"})
+		return
+	}
+	service := services[0]
+	if !service.isDocker() {
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": fmt.Sprintf("service %v is on %v backend, logs is only supported on docker", service.Name, service.Backend)})
+		return
+	}
+	cli, _, err := d.newDockerClient()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, xmap.M{"code": http.StatusInternalServerError, "message": err.Error()})
+		return
+	}
+	reader, err := cli.ContainerLogs(r.Context(), service.ID, types.ContainerLogsOptions{
+		ShowStdout: r.FormValue("stdout") != "0",
+		ShowStderr: r.FormValue("stderr") != "0",
+		Since:      r.FormValue("since"),
+		Timestamps: r.FormValue("timestamps") == "1",
+		Follow:     r.FormValue("follow") == "1",
+		Tail:       r.FormValue("tail"),
+	})
+	if err != nil {
+		WarnLog("Discover proc %v container log fail with %v", service.Name, err)
+		writeJSON(w, http.StatusInternalServerError, xmap.M{"code": http.StatusInternalServerError, "message": err.Error()})
+		return
+	}
+	defer reader.Close()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	out := &flushWriter{ResponseWriter: w}
+	_, err = stdcopy.StdCopy(out, out, reader)
+	if err != nil && err != io.EOF && r.Context().Err() == nil {
+		WarnLog("Discover proc %v container log fail with %v", service.Name, err)
+	}
+}
+
+func (d *Discover) procAdminRestart(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	if d.IsReadOnly() {
+		writeJSON(w, http.StatusForbidden, xmap.M{"code": http.StatusForbidden, "message": "read only"})
+		return
+	}
+	services := d.findServices(tenant, r.FormValue("service"), r.FormValue("id"), r.FormValue("version"))
+	if len(services) < 1 {
+		writeJSON(w, http.StatusNotFound, xmap.M{"code": http.StatusNotFound, "message": "service not found"})
+		return
+	}
+	for _, service := range services {
+		if !service.isDocker() {
+			writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": fmt.Sprintf("service %v/%v is on %v backend, restart is only supported on docker", service.Name, service.ID, service.Backend)})
+			return
+		}
+	}
+	cli, _, err := d.newDockerClient()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, xmap.M{"code": http.StatusInternalServerError, "message": err.Error()})
+		return
+	}
+	timeout := 10 * time.Second
+	restarted := []string{}
+	for _, service := range services {
+		err = cli.ContainerRestart(context.Background(), service.ID, &timeout)
+		if err != nil {
+			WarnLog("Discover restart %v/%v container fail with %v", service.Name, service.ID, err)
+			writeJSON(w, http.StatusInternalServerError, xmap.M{"code": http.StatusInternalServerError, "message": err.Error(), "restarted": restarted})
+			return
+		}
+		InfoLog("Discover restart %v/%v container success", service.Name, service.ID)
+		restarted = append(restarted, service.ID)
+	}
+	writeJSON(w, http.StatusOK, xmap.M{"restarted": restarted})
+}
+
+// ConfigItem is the effective config key of running pdservice, the secret value is redacted
+type ConfigItem struct {
+	Key     string `json:"key"`
+	Type    string `json:"type"`
+	Default string `json:"default"`
+	Value   string `json:"value"`
+	Source  string `json:"source"`
+}
+
+// procAdminConfig will show the effective config items which key is contains q
+func (d *Discover) procAdminConfig(w http.ResponseWriter, r *http.Request) {
+	q := r.FormValue("q")
+	items := []*ConfigItem{}
+	for _, item := range d.ConfigItems {
+		if len(q) < 1 || strings.Contains(item.Key, q) {
+			items = append(items, item)
+		}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// procAdmin will process the admin api under AdminPrefix, it is disabled when AdminToken and tenant admin token are empty,
+// the tenant admin token can only access services/catalog/logs/restart of tenant
+func (d *Discover) procAdmin(w http.ResponseWriter, r *http.Request) {
+	if len(d.AgentToken) > 0 && strings.Trim(strings.TrimPrefix(r.URL.Path, d.AdminPrefix), "/") == "agent/report" {
+		d.procAgentReport(w, r)
+		return
+	}
+	if !d.adminEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	if strings.Trim(strings.TrimPrefix(r.URL.Path, d.AdminPrefix), "/") == "openapi.json" {
+		writeJSON(w, http.StatusOK, d.OpenAPI())
+		return
+	}
+	if strings.Trim(strings.TrimPrefix(r.URL.Path, d.AdminPrefix), "/") == "session/refresh" {
+		r.ParseForm()
+		d.procSessionRefresh(w, r)
+		return
+	}
+	tenant, role := d.adminRole(r)
+	if len(role) < 1 {
+		writeJSON(w, http.StatusUnauthorized, xmap.M{"code": http.StatusUnauthorized, "message": "unauthorized"})
+		return
+	}
+	r.ParseForm()
+	path := strings.TrimPrefix(r.URL.Path, d.AdminPrefix)
+	path = strings.Trim(path, "/")
+	if !roleAllow(role, path) {
+		writeJSON(w, http.StatusForbidden, xmap.M{"code": http.StatusForbidden, "message": "forbidden"})
+		return
+	}
+	switch path {
+	case "services", "catalog", "logs", "restart", "login", "logout", "sd/prometheus", "latency":
+	default:
+		if tenant != nil {
+			writeJSON(w, http.StatusForbidden, xmap.M{"code": http.StatusForbidden, "message": "forbidden"})
+			return
+		}
+	}
+	switch path {
+	case "status":
+		writeJSON(w, http.StatusOK, d.adminStatus())
+		return
+	case "services":
+		d.procAdminServices(w, r, tenant)
+		return
+	case "catalog":
+		d.procAdminCatalog(w, r, tenant)
+		return
+	case "triggers":
+		writeJSON(w, http.StatusOK, d.TriggerStats())
+		return
+	case "flapping":
+		writeJSON(w, http.StatusOK, d.FlapStats())
+		return
+	case "probes":
+		writeJSON(w, http.StatusOK, d.ProbeStats())
+		return
+	case "conflicts":
+		writeJSON(w, http.StatusOK, d.ListenConflicts())
+		return
+	case "resources":
+		writeJSON(w, http.StatusOK, d.ResourceUsage())
+		return
+	case "lint":
+		d.procAdminLint(w, r)
+		return
+	case "collisions":
+		writeJSON(w, http.StatusOK, d.PrefixCollisions())
+		return
+	case "compose":
+		writeJSON(w, http.StatusOK, d.ComposeDrifts())
+		return
+	case "agents":
+		writeJSON(w, http.StatusOK, d.AgentStats())
+		return
+	case "xds":
+		if !d.XDS {
+			http.NotFound(w, r)
+			return
+		}
+		d.procXDS(w, r)
+		return
+	case "config":
+		d.procAdminConfig(w, r)
+		return
+	case "latency":
+		d.procAdminLatency(w, r, tenant)
+		return
+	case "captures":
+		d.procAdminCapture(w, r)
+		return
+	case "tap":
+		d.procAdminTap(w, r)
+		return
+	case "metrics":
+		d.procMetrics(w, r)
+		return
+	case "sessions":
+		writeJSON(w, http.StatusOK, d.ListSession())
+		return
+	case "loglevel":
+		d.procAdminLogLevel(w, r)
+		return
+	case "sd/prometheus":
+		d.procPrometheusSD(w, r, tenant)
+		return
+	case "export/hosts", "export/dnsmasq", "export/unbound":
+		out, err := d.RenderExport(strings.TrimPrefix(path, "export/"))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, xmap.M{"code": http.StatusInternalServerError, "message": err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(out)
+		return
+	case "logs":
+		d.procAdminLogs(w, r, tenant)
+		return
+	case "pause", "resume", "readonly", "refresh", "restart", "login", "logout", "session/revoke", "capture/replay", "upgrade":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, xmap.M{"code": http.StatusMethodNotAllowed, "message": "method not allowed"})
+		return
+	}
+	switch path {
+	case "refresh":
+		d.procAdminRefresh(w, r)
+		return
+	case "login":
+		d.procSessionLogin(w, r, tenant, role)
+		return
+	case "logout":
+		d.procSessionLogout(w, r)
+		return
+	case "session/revoke":
+		d.procSessionRevoke(w, r)
+		return
+	case "capture/replay":
+		d.procAdminReplay(w, r)
+		return
+	case "upgrade":
+		d.procAdminUpgrade(w, r)
+		return
+	case "restart":
+		d.procAdminRestart(w, r, tenant)
+		return
+	case "pause":
+		d.Pause()
+	case "resume":
+		d.Resume()
+	case "readonly":
+		readOnly := true
+		if enable := r.FormValue("enable"); len(enable) > 0 {
+			var err error
+			readOnly, err = strconv.ParseBool(enable)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": fmt.Sprintf("invalid enable %v", enable)})
+				return
+			}
+		}
+		d.SetReadOnly(readOnly)
+	}
+	writeJSON(w, http.StatusOK, d.adminStatus())
+}
@@ -0,0 +1,136 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdmin(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	call := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://pdsrv"+path, nil)
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return res
+	}
+	if res := call("GET", "/_api/status", ""); res.Code != http.StatusNotFound {
+		t.Error(res.Code)
+		return
+	}
+	discover.AdminToken = "123"
+	if res := call("GET", "/_api/status", "xx"); res.Code != http.StatusUnauthorized {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("GET", "/_api/pause", "123"); res.Code != http.StatusMethodNotAllowed {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("POST", "/_api/pause", "123"); res.Code != http.StatusOK || !discover.IsPaused() {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("POST", "/_api/resume", "123"); res.Code != http.StatusOK || discover.IsPaused() {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("POST", "/_api/readonly", "123"); res.Code != http.StatusOK || !discover.IsReadOnly() {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("GET", "/_api/status", "123"); !strings.Contains(res.Body.String(), `"read_only":true`) {
+		t.Error(res.Body.String())
+		return
+	}
+	if res := call("POST", "/_api/readonly?enable=xx", "123"); res.Code != http.StatusBadRequest {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("POST", "/_api/readonly?enable=0", "123"); res.Code != http.StatusOK || discover.IsReadOnly() {
+		t.Error(res.Code)
+		return
+	}
+	discover.ConfigItems = []*ConfigItem{
+		{Key: "listen", Type: "array", Default: ":9231", Value: ":9231", Source: "default"},
+		{Key: "admin_token", Type: "string", Value: "******", Source: "env"},
+	}
+	if res := call("GET", "/_api/config?q=admin", "123"); res.Code != http.StatusOK || strings.Contains(res.Body.String(), "listen") || !strings.Contains(res.Body.String(), `"source":"env"`) {
+		t.Error(res.Body.String())
+		return
+	}
+	if res := call("GET", "/_api/none", "123"); res.Code != http.StatusNotFound {
+		t.Error(res.Code)
+		return
+	}
+	discover.Pause()
+	if res := call("POST", "/_api/refresh", "123"); res.Code != http.StatusConflict {
+		t.Error(res.Code)
+		return
+	}
+	discover.Resume()
+	if prefixes := prefixList(map[string]*Container{"b": nil, "a": nil}); len(prefixes) != 2 || prefixes[0] != "a" {
+		t.Error(prefixes)
+		return
+	}
+	//services
+	discover.SetReadOnly(false)
+	service := &Container{ID: "c1", Name: "ds", Version: "v1.0.0", Token: "abc", Forwards: map[string]*Forward{
+		"v100.ds":       {Prefix: "v100.ds"},
+		"admin.v100.ds": {Prefix: "admin.v100.ds", Hidden: true},
+	}}
+	discover.proxyAll["v100.ds"] = service
+	discover.proxyAll["admin.v100.ds"] = service
+	if res := call("GET", "/_api/services", "123"); !strings.Contains(res.Body.String(), `"forwards":["v100.ds"]`) || strings.Contains(res.Body.String(), "abc") {
+		t.Error(res.Body.String())
+		return
+	}
+	if res := call("GET", "/_api/catalog", "123"); !strings.Contains(res.Body.String(), `"prefix":"v100.ds"`) || strings.Contains(res.Body.String(), "admin.v100.ds") || strings.Contains(res.Body.String(), "abc") {
+		t.Error(res.Body.String())
+		return
+	}
+	if services := discover.findServices(nil, "ds", "", "v1.0.0"); len(services) != 1 {
+		t.Error(services)
+		return
+	}
+	if services := discover.findServices(nil, "ds", "c2", ""); len(services) != 0 {
+		t.Error(services)
+		return
+	}
+	if res := call("POST", "/_api/restart?service=none", "123"); res.Code != http.StatusNotFound {
+		t.Error(res.Code)
+		return
+	}
+	discover.proxyAll["v100.agent"] = &Container{ID: "a1", Name: "agent", Backend: "agent/host1", Forwards: map[string]*Forward{"v100.agent": {Prefix: "v100.agent"}}}
+	if res := call("POST", "/_api/restart?service=agent", "123"); res.Code != http.StatusBadRequest {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("GET", "/_api/logs?service=agent", "123"); res.Code != http.StatusBadRequest {
+		t.Error(res.Code)
+		return
+	}
+	delete(discover.proxyAll, "v100.agent")
+	discover.SetReadOnly(true)
+	if res := call("POST", "/_api/restart?service=ds", "123"); res.Code != http.StatusForbidden {
+		t.Error(res.Code)
+		return
+	}
+	//read only control
+	discover.SetReadOnly(true)
+	container := &Container{Name: "ds", Token: "abc", Forwards: map[string]*Forward{"v100.ds": {Prefix: "v100.ds"}}}
+	discover.proxyReverse["v100.ds"] = &ReverseProxy{Forward: container.Forwards["v100.ds"], Service: container}
+	req := httptest.NewRequest("POST", "http://v100.ds/_s/docker/restart", nil)
+	req.SetBasicAuth("ds", "abc")
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Error(res.Code)
+		return
+	}
+}
@@ -0,0 +1,258 @@
+package discover
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+	"github.com/docker/docker/api/types"
+)
+
+// AgentItem is the container inspect which is reported by agent, the remote host is the address to access the published port
+// which is only informational, the server forwards to AgentHosts or the address of agent
+type AgentItem struct {
+	Inspect    types.ContainerJSON `json:"inspect"`
+	RemoteHost string              `json:"remote_host"`
+}
+
+// AgentReport is the local discovery result of agent which is running on docker host
+type AgentReport struct {
+	Name  string       `json:"name"`
+	Items []*AgentItem `json:"items"`
+}
+
+// AgentStats is the last report of agent which is received by server
+type AgentStats struct {
+	Name       string    `json:"name"`
+	Containers int       `json:"containers"`
+	Remote     string    `json:"remote"`
+	ReportedAt time.Time `json:"reported_at"`
+	Expired    bool      `json:"expired"`
+}
+
+type agentState struct {
+	Report     *AgentReport
+	Hash       string
+	Host       string
+	Remote     string
+	ReportedAt time.Time
+}
+
+// CollectAgent will inspect the local containers to report, the remote host is replaced by AgentHost when it is not empty
+func (d *Discover) CollectAgent() (report *AgentReport, err error) {
+	inspects, remoteHost, err := d.listDocker()
+	if err != nil {
+		return
+	}
+	if len(d.AgentHost) > 0 {
+		remoteHost = d.AgentHost
+	}
+	report = &AgentReport{Name: d.AgentName, Items: []*AgentItem{}}
+	for _, inspect := range inspects {
+		report.Items = append(report.Items, &AgentItem{Inspect: inspect, RemoteHost: remoteHost})
+	}
+	return
+}
+
+// ReportAgent will collect the local containers and post it to AgentServer with AgentToken and signature
+func (d *Discover) ReportAgent() (err error) {
+	report, err := d.CollectAgent()
+	if err != nil {
+		return
+	}
+	data, _ := json.Marshal(report)
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(d.AgentServer, "/")+d.AdminPrefix+"/agent/report", bytes.NewBuffer(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+d.AgentToken)
+	SignRequest(req, d.SignSecret, data)
+	client := &http.Client{Timeout: d.AgentTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		err = fmt.Errorf("agent report fail with status %v: %v", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return
+}
+
+// RunAgent will report the local containers to AgentServer by interval until StopAgent
+func (d *Discover) RunAgent(interval time.Duration) {
+	d.agentLock.Lock()
+	if d.agentStop != nil {
+		d.agentLock.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	d.agentStop = stop
+	d.agentLock.Unlock()
+	InfoLog("Discover start agent %v to report to %v by %v", d.AgentName, d.AgentServer, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := d.ReportAgent(); err != nil {
+			WarnLog("Discover agent report to %v fail with %v", d.AgentServer, err)
+		}
+		select {
+		case <-stop:
+			InfoLog("Discover agent %v is stopped", d.AgentName)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// StopAgent will stop the agent report loop without waiting the next interval
+func (d *Discover) StopAgent() {
+	d.agentLock.Lock()
+	defer d.agentLock.Unlock()
+	if d.agentStop != nil {
+		close(d.agentStop)
+		d.agentStop = nil
+	}
+}
+
+// procAgentReport will receive the agent report which is authorized by AgentToken, the refresh is triggered when it is changed
+func (d *Discover) procAgentReport(w http.ResponseWriter, r *http.Request) {
+	if !VerifyToken(d.AgentToken, d.adminToken(r)) {
+		writeJSON(w, http.StatusUnauthorized, xmap.M{"code": http.StatusUnauthorized, "message": "unauthorized"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, xmap.M{"code": http.StatusMethodNotAllowed, "message": "method not allowed"})
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+	if len(d.SignSecret) > 0 {
+		if err = VerifyRequest(d.SignSecret, r, data, 5*time.Minute); err != nil {
+			writeJSON(w, http.StatusUnauthorized, xmap.M{"code": http.StatusUnauthorized, "message": err.Error()})
+			return
+		}
+	}
+	report := &AgentReport{}
+	if err = json.Unmarshal(data, report); err != nil || len(report.Name) < 1 {
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": fmt.Sprintf("invalid report %v", err)})
+		return
+	}
+	host, err := d.agentHost(report.Name, r)
+	if err != nil {
+		WarnLog("Discover agent %v report from %v fail with %v", report.Name, r.RemoteAddr, err)
+		writeJSON(w, http.StatusForbidden, xmap.M{"code": http.StatusForbidden, "message": err.Error()})
+		return
+	}
+	hash := agentHash(report)
+	d.agentLock.Lock()
+	if d.agents == nil {
+		d.agents = map[string]*agentState{}
+	}
+	last := d.agents[report.Name]
+	changed := last == nil || last.Hash != hash || last.Host != host || d.AgentExpire > 0 && time.Since(last.ReportedAt) > d.AgentExpire
+	d.agents[report.Name] = &agentState{Report: report, Hash: hash, Host: host, Remote: r.RemoteAddr, ReportedAt: time.Now()}
+	d.agentLock.Unlock()
+	if changed && !d.IsPaused() && !d.skipCycle() {
+		InfoLog("Discover agent %v report is changed from %v, refresh now", report.Name, r.RemoteAddr)
+		go d.RefreshNow()
+	}
+	writeJSON(w, http.StatusOK, xmap.M{"code": 0, "containers": len(report.Items)})
+}
+
+// agentHost will return the host to access the published port of agent, it is AgentHosts by agent name or the client ip
+// of report, the loopback and unspecified client ip is rejected because it is not the docker host address
+func (d *Discover) agentHost(name string, r *http.Request) (host string, err error) {
+	if host = d.AgentHosts[name]; len(host) > 0 {
+		return
+	}
+	ip := d.clientIP(r)
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		err = fmt.Errorf("agent address %v is not allowed, add %v=<host> to agent_hosts", ip, name)
+		return
+	}
+	host = ip.String()
+	return
+}
+
+// agentHash will return the hash of report items by container id, name, config, ports and remote host
+func agentHash(report *AgentReport) string {
+	keys := []string{}
+	for _, item := range report.Items {
+		if item == nil || item.Inspect.ContainerJSONBase == nil {
+			continue
+		}
+		data, _ := json.Marshal([]interface{}{item.Inspect.ID, item.Inspect.Name, item.Inspect.Config, item.Inspect.NetworkSettings, item.RemoteHost})
+		keys = append(keys, string(data))
+	}
+	sort.Strings(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// discoveAgent will parse the containers of agent reports, the report which is not received in AgentExpire is skipped
+func (d *Discover) discoveAgent() (parsed, proxied []*Container, err error) {
+	d.agentLock.Lock()
+	names := []string{}
+	for name := range d.agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	states := []*agentState{}
+	for _, name := range names {
+		state := d.agents[name]
+		if d.AgentExpire > 0 && time.Since(state.ReportedAt) > d.AgentExpire {
+			continue
+		}
+		states = append(states, state)
+	}
+	d.agentLock.Unlock()
+	for _, state := range states {
+		for _, item := range state.Report.Items {
+			if item == nil || item.Inspect.ContainerJSONBase == nil {
+				continue
+			}
+			container, ok := d.parseContainer(item.Inspect, state.Host, false)
+			if container == nil {
+				continue
+			}
+			container.Backend = "agent/" + state.Report.Name
+			if ok {
+				proxied = append(proxied, container)
+			}
+			parsed = append(parsed, container)
+		}
+	}
+	return
+}
+
+// AgentStats will return the last report of agents by name
+func (d *Discover) AgentStats() (stats []*AgentStats) {
+	d.agentLock.Lock()
+	defer d.agentLock.Unlock()
+	stats = []*AgentStats{}
+	for name, state := range d.agents {
+		stats = append(stats, &AgentStats{
+			Name:       name,
+			Containers: len(state.Report.Items),
+			Remote:     state.Remote,
+			ReportedAt: state.ReportedAt,
+			Expired:    d.AgentExpire > 0 && time.Since(state.ReportedAt) > d.AgentExpire,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return
+}
@@ -0,0 +1,154 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestAgent(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.Backends = []string{"agent"}
+	discover.Pause()
+	report := &AgentReport{
+		Name: "host1",
+		Items: []*AgentItem{
+			{
+				Inspect: types.ContainerJSON{
+					ContainerJSONBase: &types.ContainerJSONBase{ID: "c1", Name: "/ds-srv-v1.0.0", State: &types.ContainerState{Status: "running"}},
+					Config:            &container.Config{Labels: map[string]string{"PD_HOST_WEB": "8080"}},
+					NetworkSettings: &types.NetworkSettings{NetworkSettingsBase: types.NetworkSettingsBase{Ports: nat.PortMap{
+						"8080/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: "28080"}},
+					}}},
+				},
+				RemoteHost: "10.0.0.5",
+			},
+			nil,
+		},
+	}
+	data, _ := json.Marshal(report)
+	call := func(method, token string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://pdsrv/_api/agent/report", bytes.NewBuffer(body))
+		req.RemoteAddr = "10.0.0.6:1000"
+		req.Header.Set("Authorization", "Bearer "+token)
+		SignRequest(req, discover.SignSecret, body)
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return res
+	}
+	//not enabled
+	if res := call("POST", "", data); res.Code != http.StatusNotFound {
+		t.Error(res.Code)
+		return
+	}
+	discover.AgentToken = "abc"
+	if res := call("POST", "xx", data); res.Code != http.StatusUnauthorized {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("GET", "abc", data); res.Code != http.StatusMethodNotAllowed {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("POST", "abc", []byte("{}")); res.Code != http.StatusBadRequest {
+		t.Error(res.Code)
+		return
+	}
+	discover.SignSecret = "123"
+	if res := call("POST", "abc", data); res.Code != http.StatusOK {
+		t.Error(res.Code, res.Body.String())
+		return
+	}
+	req := httptest.NewRequest("POST", "http://pdsrv/_api/agent/report", bytes.NewBuffer(data))
+	req.Header.Set("Authorization", "Bearer abc")
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusUnauthorized {
+		t.Error(res.Code)
+		return
+	}
+	//discove
+	all, err := discover.Discove()
+	if err != nil || len(all) != 1 {
+		t.Errorf("%v,%v", err, all)
+		return
+	}
+	service := all["v100.ds"]
+	if service == nil || service.Backend != "agent/host1" || service.Forwards["v100.ds"].URI != "10.0.0.6:28080" {
+		t.Errorf("%v,%v", all, service)
+		return
+	}
+	//loopback is rejected without agent hosts
+	req = httptest.NewRequest("POST", "http://pdsrv/_api/agent/report", bytes.NewBuffer(data))
+	req.RemoteAddr = "127.0.0.1:1000"
+	req.Header.Set("Authorization", "Bearer abc")
+	SignRequest(req, discover.SignSecret, data)
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Error(res.Code)
+		return
+	}
+	discover.AgentHosts = map[string]string{"host1": "10.0.0.5"}
+	req = httptest.NewRequest("POST", "http://pdsrv/_api/agent/report", bytes.NewBuffer(data))
+	req.RemoteAddr = "127.0.0.1:1000"
+	req.Header.Set("Authorization", "Bearer abc")
+	SignRequest(req, discover.SignSecret, data)
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Error(res.Code)
+		return
+	}
+	all, err = discover.Discove()
+	if service = all["v100.ds"]; err != nil || service == nil || service.Forwards["v100.ds"].URI != "10.0.0.5:28080" {
+		t.Errorf("%v,%v", err, all)
+		return
+	}
+	stats := discover.AgentStats()
+	if len(stats) != 1 || stats[0].Name != "host1" || stats[0].Containers != 2 || stats[0].Expired {
+		t.Error(stats)
+		return
+	}
+	//hash
+	if agentHash(report) != agentHash(&AgentReport{Name: "x", Items: report.Items}) {
+		t.Error("hash")
+		return
+	}
+	//expire
+	discover.agents["host1"].ReportedAt = time.Now().Add(-2 * discover.AgentExpire)
+	all, err = discover.Discove()
+	if err != nil || len(all) != 0 || !discover.AgentStats()[0].Expired {
+		t.Errorf("%v,%v", err, all)
+		return
+	}
+}
+
+func TestRunAgent(t *testing.T) {
+	discover := NewDiscover()
+	discover.DockerCert = "/none"
+	discover.AgentName = "host1"
+	discover.AgentServer = "http://127.0.0.1:1"
+	done := make(chan int)
+	go func() {
+		discover.RunAgent(time.Hour)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	discover.StopAgent()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Error("not stopped")
+		return
+	}
+	discover.StopAgent()
+}
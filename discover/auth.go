@@ -0,0 +1,100 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// authIdentity will return the identity of request authenticated by forward Auth or verified client certificate,
+// the LDAP groups is cn of group and the client certificate groups is organizational unit
+func (d *Discover) authIdentity(r *http.Request, forward *Forward) (user string, groups []string, ok bool) {
+	switch forward.Auth {
+	case "":
+	case "ldap":
+		username, password, basic := r.BasicAuth()
+		if d.LDAP == nil || !basic {
+			return
+		}
+		var err error
+		var dns []string
+		if _, dns, err = d.LDAP.Identify(username, password); err != nil {
+			WarnLog("Discover audit ldap authentication of %v on %v from %v fail with %v", username, forward.Prefix, r.RemoteAddr, err)
+			return
+		}
+		for _, dn := range dns {
+			if strings.HasPrefix(strings.ToLower(dn), "cn=") {
+				dn = strings.SplitN(dn[3:], ",", 2)[0]
+			}
+			groups = append(groups, dn)
+		}
+		user, ok = username, true
+		r.Header.Del("Authorization")
+		return
+	default:
+		WarnLog("Discover auth %v of %v is not supported", forward.Auth, forward.Prefix)
+		return
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		user, groups = cert.Subject.CommonName, cert.Subject.OrganizationalUnit
+	}
+	ok = true
+	return
+}
+
+// authHeaders will return the user and groups header of forward, the AuthUserHeader/AuthGroupsHeader is used when forward is not configured
+func (d *Discover) authHeaders(forward *Forward) (userHeader, groupsHeader string) {
+	userHeader, groupsHeader = d.AuthUserHeader, d.AuthGroupsHeader
+	if len(forward.AuthUserHeader) > 0 {
+		userHeader = forward.AuthUserHeader
+	}
+	if len(forward.AuthGroupsHeader) > 0 {
+		groupsHeader = forward.AuthGroupsHeader
+	}
+	return
+}
+
+// signIdentity will sign the identity header of upstream request by SignSecret with method and request uri of upstream,
+// it is called after the request is directed to upstream, so the upstream can verify the identity is asserted by pdservice
+func (d *Discover) signIdentity(req *http.Request, forward *Forward) {
+	req.Header.Del(IdentitySignatureHeader)
+	userHeader, groupsHeader := d.authHeaders(forward)
+	user, groups := "", ""
+	if len(userHeader) > 0 {
+		user = req.Header.Get(userHeader)
+	}
+	if len(groupsHeader) > 0 {
+		groups = req.Header.Get(groupsHeader)
+	}
+	if len(d.SignSecret) < 1 || len(user) < 1 && len(groups) < 1 {
+		return
+	}
+	req.Header.Set(IdentitySignatureHeader, Signature(d.SignSecret, time.Now(), req.Method, req.URL.RequestURI(), IdentityPayload(user, groups)))
+}
+
+// middlewareAuth will strip the identity header from incoming request, authenticate request by forward Auth
+// and pass the identity to upstream by identity header, so the upstream can trust the identity header
+func (d *Discover) middlewareAuth(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	userHeader, groupsHeader := d.authHeaders(reverse.Forward)
+	for _, header := range []string{d.AuthUserHeader, d.AuthGroupsHeader, userHeader, groupsHeader, IdentitySignatureHeader} {
+		if len(header) > 0 {
+			r.Header.Del(header)
+		}
+	}
+	user, groups, ok := d.authIdentity(r, reverse.Forward)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="pdservice"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, "unauthorized")
+		return
+	}
+	if len(user) > 0 && len(userHeader) > 0 {
+		r.Header.Set(userHeader, user)
+	}
+	if len(groups) > 0 && len(groupsHeader) > 0 {
+		r.Header.Set(groupsHeader, strings.Join(groups, ","))
+	}
+	next(w, r, reverse)
+}
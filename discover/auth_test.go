@@ -0,0 +1,86 @@
+package discover
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthHeader(t *testing.T) {
+	ln, _ := runTestLDAP(t, map[string]string{
+		"uid=u1,dc=test": "p1",
+	}, map[string][]string{
+		"u1": {"cn=ops,ou=groups,dc=test", "cn=dev,ou=groups,dc=test"},
+	})
+	defer ln.Close()
+	discover := NewDiscover()
+	discover.LDAP = &LDAP{Addr: "ldap://" + ln.Addr().String(), UserDN: "uid=%v,dc=test", BaseDN: "dc=test", Role: RoleViewer, Timeout: time.Second}
+	container := &Container{Name: "ds", Forwards: map[string]*Forward{"web": {Name: "web", Prefix: "v100.ds"}}}
+	applyForwardOptions(container, map[string]string{"PD_AUTH_web": "ldap", "PD_AUTH_USER_HEADER": "X-User"})
+	forward := container.Forwards["web"]
+	if forward.Auth != "ldap" || forward.AuthUserHeader != "X-User" {
+		t.Error(forward)
+		return
+	}
+	applyForwardOptions(container, map[string]string{"PD_AUTH": "xx"})
+	if forward.Auth != "ldap" {
+		t.Error(forward.Auth)
+		return
+	}
+	reverse := &ReverseProxy{Forward: forward, Service: container}
+	call := func(req *http.Request) (code int, header http.Header) {
+		res := httptest.NewRecorder()
+		discover.middlewareAuth(res, req, reverse, func(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy) {
+			header = r.Header
+			w.WriteHeader(http.StatusOK)
+		})
+		code = res.Code
+		return
+	}
+	//ldap
+	req := httptest.NewRequest("GET", "http://v100.ds", nil)
+	req.Header.Set("X-User", "spoof")
+	if code, _ := call(req); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	req.SetBasicAuth("u1", "xx")
+	if code, _ := call(req); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	req.SetBasicAuth("u1", "p1")
+	code, header := call(req)
+	if code != http.StatusOK || header.Get("X-User") != "u1" || header.Get("X-Auth-Groups") != "ops,dev" || len(header.Get("Authorization")) > 0 {
+		t.Error(code, header)
+		return
+	}
+	//strip
+	forward.Auth, forward.AuthUserHeader = "", ""
+	req = httptest.NewRequest("GET", "http://v100.ds", nil)
+	req.Header.Set("X-Auth-User", "spoof")
+	req.Header.Set("X-Auth-Groups", "spoof")
+	code, header = call(req)
+	if code != http.StatusOK || len(header.Get("X-Auth-User")) > 0 || len(header.Get("X-Auth-Groups")) > 0 {
+		t.Error(code, header)
+		return
+	}
+	//client cert
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "c1", OrganizationalUnit: []string{"g1", "g2"}}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	code, header = call(req)
+	if code != http.StatusOK || header.Get("X-Auth-User") != "c1" || header.Get("X-Auth-Groups") != "g1,g2" {
+		t.Error(code, header)
+		return
+	}
+	//unsupported
+	forward.Auth = "xx"
+	if code, _ := call(req); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+}
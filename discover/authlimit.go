@@ -0,0 +1,96 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type authState struct {
+	WindowAt    time.Time
+	Count       int
+	Failures    int
+	FailedAt    time.Time
+	LockedUntil time.Time
+}
+
+// checkAuth will check if the /_s authentication from ip to service is allowed by SrvAuthRate per minute and lockout,
+// the retry is the duration to wait when it is not allowed
+func (d *Discover) checkAuth(ip, service string) (allow bool, retry time.Duration) {
+	d.authLock.Lock()
+	defer d.authLock.Unlock()
+	now := time.Now()
+	if d.authAll == nil {
+		d.authAll = map[string]*authState{}
+	}
+	if now.Sub(d.authPruned) > time.Minute {
+		//the failures are forgotten after SrvLockTime, so the state of each sprayed ip is not kept forever
+		for key, state := range d.authAll {
+			if now.Sub(state.WindowAt) > time.Minute && now.After(state.LockedUntil) && (state.Failures < 1 || now.Sub(state.FailedAt) > d.SrvLockTime) {
+				delete(d.authAll, key)
+			}
+		}
+		d.authPruned = now
+	}
+	allow = true
+	for _, key := range []string{"ip:" + ip, "service:" + service} {
+		state := d.authAll[key]
+		if state == nil {
+			state = &authState{WindowAt: now}
+			d.authAll[key] = state
+		}
+		if now.Before(state.LockedUntil) {
+			allow = false
+			if wait := state.LockedUntil.Sub(now); wait > retry {
+				retry = wait
+			}
+			continue
+		}
+		if now.Sub(state.WindowAt) > time.Minute {
+			state.WindowAt, state.Count = now, 0
+		}
+		state.Count++
+		if d.SrvAuthRate > 0 && state.Count > d.SrvAuthRate {
+			allow = false
+			if wait := state.WindowAt.Add(time.Minute).Sub(now); wait > retry {
+				retry = wait
+			}
+		}
+	}
+	return
+}
+
+// doneAuth will record the /_s authentication result, the ip and service is locked for SrvLockTime after SrvLockFailures consecutive failures
+func (d *Discover) doneAuth(ip, service string, success bool) {
+	d.authLock.Lock()
+	defer d.authLock.Unlock()
+	now := time.Now()
+	for _, key := range []string{"ip:" + ip, "service:" + service} {
+		state := d.authAll[key]
+		if state == nil {
+			continue
+		}
+		if success {
+			state.Failures = 0
+			continue
+		}
+		state.Failures++
+		state.FailedAt = now
+		if d.SrvLockFailures > 0 && state.Failures >= d.SrvLockFailures {
+			state.Failures = 0
+			state.LockedUntil = now.Add(d.SrvLockTime)
+			WarnLog("Discover audit %v is locked until %v after %v failed authentication of %v from %v", key, state.LockedUntil, d.SrvLockFailures, service, ip)
+		}
+	}
+	if success {
+		InfoLog("Discover audit authentication of %v from %v success", service, ip)
+	} else {
+		WarnLog("Discover audit authentication of %v from %v fail", service, ip)
+	}
+}
+
+func (d *Discover) procAuthLimited(w http.ResponseWriter, retry time.Duration) {
+	w.Header().Set("Retry-After", fmt.Sprintf("%v", int((retry+time.Second-1)/time.Second)))
+	w.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprintf(w, "too many authentication attempts")
+}
@@ -0,0 +1,84 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthLimit(t *testing.T) {
+	discover := NewDiscover()
+	discover.SrvAuthRate = 3
+	discover.SrvLockFailures = 2
+	discover.SrvLockTime = time.Hour
+	service := &Container{Name: "ds", Token: "abc"}
+	discover.proxyReverse["v100.ds"] = &ReverseProxy{Forward: &Forward{Prefix: "v100.ds"}, Service: service}
+	call := func(ip, username, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://v100.ds/_s/xx", nil)
+		req.RemoteAddr = ip + ":1000"
+		req.SetBasicAuth(username, password)
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return res
+	}
+	//rate
+	for i := 0; i < 3; i++ {
+		if res := call("10.0.0.1", "ds", "abc"); res.Code != http.StatusNotFound {
+			t.Error(res.Code)
+			return
+		}
+	}
+	if res := call("10.0.0.1", "ds", "abc"); res.Code != http.StatusTooManyRequests || len(res.Header().Get("Retry-After")) < 1 {
+		t.Error(res.Code)
+		return
+	}
+	//lockout
+	discover.SrvAuthRate = 0
+	discover.authAll = nil
+	if res := call("10.0.0.2", "ds", "xx"); res.Code != http.StatusUnauthorized {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("10.0.0.2", "ds", "abc"); res.Code != http.StatusNotFound {
+		t.Error(res.Code)
+		return
+	}
+	call("10.0.0.2", "ds", "xx")
+	call("10.0.0.2", "ds", "xx")
+	if res := call("10.0.0.2", "ds", "abc"); res.Code != http.StatusTooManyRequests {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("10.0.0.3", "ds", "abc"); res.Code != http.StatusTooManyRequests {
+		t.Error(res.Code)
+		return
+	}
+	//forged header is not used without trusted proxies
+	discover.authAll = nil
+	discover.GeoIPHeader = "X-Forwarded-For"
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "http://v100.ds/_s/xx", nil)
+		req.RemoteAddr = "10.0.0.6:1000"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("1.1.1.%v", i))
+		req.SetBasicAuth("ds1", "xx")
+		discover.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if state := discover.authAll["ip:10.0.0.6"]; state == nil || state.LockedUntil.IsZero() {
+		t.Error(state)
+		return
+	}
+	//prune
+	discover.authAll = nil
+	discover.checkAuth("10.0.0.2", "ds")
+	discover.authAll["ip:10.0.0.4"] = &authState{WindowAt: time.Now().Add(-time.Hour)}
+	discover.authAll["ip:10.0.0.7"] = &authState{WindowAt: time.Now().Add(-3 * time.Hour), Failures: 1, FailedAt: time.Now().Add(-2 * time.Hour)}
+	discover.authAll["ip:10.0.0.8"] = &authState{WindowAt: time.Now().Add(-time.Hour), Failures: 1, FailedAt: time.Now().Add(-time.Minute)}
+	discover.authPruned = time.Time{}
+	discover.checkAuth("10.0.0.5", "ds1")
+	if discover.authAll["ip:10.0.0.4"] != nil || discover.authAll["ip:10.0.0.7"] != nil || discover.authAll["ip:10.0.0.8"] == nil || discover.authAll["service:ds"] == nil {
+		t.Error("error")
+		return
+	}
+}
@@ -0,0 +1,209 @@
+package discover
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bench is the synthetic load generator which drives http/tcp/udp requests through the configured forward,
+// it is used to validate performance changes of the proxy path
+type Bench struct {
+	Type        string        `json:"type"`
+	Target      string        `json:"target"`
+	Host        string        `json:"host,omitempty"`
+	Concurrency int           `json:"concurrency"`
+	Requests    int           `json:"requests"`
+	Duration    time.Duration `json:"duration"`
+	Size        int           `json:"size"`
+	Timeout     time.Duration `json:"timeout"`
+}
+
+// BenchReport is the throughput, latency and allocation statistics of Bench
+type BenchReport struct {
+	Requests    int64         `json:"requests"`
+	Errors      int64         `json:"errors"`
+	Bytes       int64         `json:"bytes"`
+	Used        time.Duration `json:"used"`
+	Throughput  float64       `json:"throughput"`
+	P50         time.Duration `json:"p50"`
+	P95         time.Duration `json:"p95"`
+	P99         time.Duration `json:"p99"`
+	Max         time.Duration `json:"max"`
+	AllocsPerOp uint64        `json:"allocs_per_op"`
+	BytesPerOp  uint64        `json:"bytes_per_op"`
+	LastError   string        `json:"last_error,omitempty"`
+}
+
+// String will return the human readable report
+func (b *BenchReport) String() string {
+	return fmt.Sprintf("requests:%v errors:%v bytes:%v used:%v throughput:%.1f/s p50:%v p95:%v p99:%v max:%v allocs/op:%v bytes/op:%v",
+		b.Requests, b.Errors, b.Bytes, b.Used, b.Throughput, b.P50, b.P95, b.P99, b.Max, b.AllocsPerOp, b.BytesPerOp)
+}
+
+// Run will run the load by Concurrency workers until Requests is done or Duration is passed
+func (b *Bench) Run() (report *BenchReport, err error) {
+	if b.Concurrency < 1 {
+		b.Concurrency = 1
+	}
+	if b.Requests < 1 && b.Duration <= 0 {
+		b.Requests = 1000
+	}
+	if b.Timeout <= 0 {
+		b.Timeout = 5 * time.Second
+	}
+	var call func(payload []byte) (n int64, err error)
+	switch b.Type {
+	case "http", "":
+		call, err = b.newHTTP()
+	case "tcp":
+		call = b.newStream("tcp")
+	case "udp":
+		call = b.newPacket()
+	default:
+		err = fmt.Errorf("bench type %v is not supported", b.Type)
+	}
+	if err != nil {
+		return
+	}
+	payload := bytes.Repeat([]byte("x"), b.Size)
+	report = &BenchReport{}
+	var sent int64
+	var lastError atomic.Value
+	used := make([][]time.Duration, b.Concurrency)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	begin := time.Now()
+	waiter := sync.WaitGroup{}
+	for i := 0; i < b.Concurrency; i++ {
+		waiter.Add(1)
+		go func(worker int) {
+			defer waiter.Done()
+			for {
+				if b.Requests > 0 && atomic.AddInt64(&sent, 1) > int64(b.Requests) {
+					break
+				}
+				if b.Duration > 0 && time.Since(begin) > b.Duration {
+					break
+				}
+				start := time.Now()
+				n, xerr := call(payload)
+				used[worker] = append(used[worker], time.Since(start))
+				atomic.AddInt64(&report.Requests, 1)
+				atomic.AddInt64(&report.Bytes, n)
+				if xerr != nil {
+					atomic.AddInt64(&report.Errors, 1)
+					lastError.Store(xerr.Error())
+				}
+			}
+		}(i)
+	}
+	waiter.Wait()
+	report.Used = time.Since(begin)
+	runtime.ReadMemStats(&after)
+	if report.Requests > 0 {
+		report.Throughput = float64(report.Requests) / report.Used.Seconds()
+		report.AllocsPerOp = (after.Mallocs - before.Mallocs) / uint64(report.Requests)
+		report.BytesPerOp = (after.TotalAlloc - before.TotalAlloc) / uint64(report.Requests)
+	}
+	all := []time.Duration{}
+	for _, list := range used {
+		all = append(all, list...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	percentile := func(p float64) time.Duration {
+		if len(all) < 1 {
+			return 0
+		}
+		return all[int(p*float64(len(all)-1))]
+	}
+	report.P50, report.P95, report.P99, report.Max = percentile(0.50), percentile(0.95), percentile(0.99), percentile(1)
+	if last, ok := lastError.Load().(string); ok {
+		report.LastError = last
+	}
+	return
+}
+
+func (b *Bench) newHTTP() (call func(payload []byte) (n int64, err error), err error) {
+	client := &http.Client{
+		Timeout:   b.Timeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: b.Concurrency},
+	}
+	if _, err = http.NewRequest("GET", b.Target, nil); err != nil {
+		return
+	}
+	call = func(payload []byte) (n int64, err error) {
+		method := "GET"
+		var body io.Reader
+		if len(payload) > 0 {
+			method, body = "POST", bytes.NewReader(payload)
+		}
+		req, _ := http.NewRequest(method, b.Target, body)
+		if len(b.Host) > 0 {
+			req.Host = b.Host
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return
+		}
+		n, err = io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		if err == nil && res.StatusCode >= http.StatusInternalServerError {
+			err = fmt.Errorf("status %v", res.StatusCode)
+		}
+		return
+	}
+	return
+}
+
+// newStream will return the call which dials the tcp forward, writes the payload and reads the same size of echo response
+func (b *Bench) newStream(network string) (call func(payload []byte) (n int64, err error)) {
+	call = func(payload []byte) (n int64, err error) {
+		conn, err := net.DialTimeout(network, b.Target, b.Timeout)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(b.Timeout))
+		if len(payload) < 1 {
+			return
+		}
+		if _, err = conn.Write(payload); err != nil {
+			return
+		}
+		n, err = io.CopyN(ioutil.Discard, conn, int64(len(payload)))
+		return
+	}
+	return
+}
+
+// newPacket will return the call which sends the payload to udp forward and reads one echo datagram
+func (b *Bench) newPacket() (call func(payload []byte) (n int64, err error)) {
+	call = func(payload []byte) (n int64, err error) {
+		conn, err := net.DialTimeout("udp", b.Target, b.Timeout)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(b.Timeout))
+		if len(payload) < 1 {
+			payload = []byte("x")
+		}
+		if _, err = conn.Write(payload); err != nil {
+			return
+		}
+		buffer := make([]byte, 64*1024)
+		size, err := conn.Read(buffer)
+		n = int64(size)
+		return
+	}
+	return
+}
@@ -0,0 +1,162 @@
+package discover
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBenchDiscover(backend string, hosts int) (discover *Discover) {
+	discover = NewDiscover()
+	discover.HostSuff = ".test.loc"
+	all := map[string]*Container{}
+	for i := 0; i < hosts; i++ {
+		prefix := fmt.Sprintf("v%v.ds", 100+i)
+		all[prefix] = &Container{ID: fmt.Sprintf("c%v", i), Name: "ds", Version: "1.0.0", Forwards: map[string]*Forward{
+			prefix: {Name: "web", Prefix: prefix, Type: "http", URI: backend},
+		}}
+	}
+	discover.applyProxy(all)
+	return
+}
+
+func TestBenchHTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer backend.Close()
+	discover := newBenchDiscover(strings.TrimPrefix(backend.URL, "http://"), 1)
+	ts := httptest.NewServer(discover)
+	defer ts.Close()
+	bench := &Bench{Type: "http", Target: ts.URL + "/", Host: "v100.ds.test.loc", Concurrency: 2, Requests: 20, Size: 16}
+	report, err := bench.Run()
+	if err != nil || report.Requests != 20 || report.Errors != 0 || report.Bytes != 20*16 || report.P50 <= 0 || report.Max < report.P99 {
+		t.Errorf("%v,%v,%v", err, report, report.LastError)
+		return
+	}
+	if !strings.Contains(report.String(), "requests:20") {
+		t.Error(report.String())
+		return
+	}
+	//not found host is not error
+	bench = &Bench{Target: ts.URL + "/", Host: "none.test.loc", Duration: 50 * time.Millisecond}
+	if report, err = bench.Run(); err != nil || report.Requests < 1 {
+		t.Errorf("%v,%v", err, report)
+		return
+	}
+	//error
+	bench = &Bench{Target: "http://127.0.0.1:1/", Requests: 2}
+	if report, err = bench.Run(); err != nil || report.Errors != 2 || len(report.LastError) < 1 {
+		t.Errorf("%v,%v", err, report)
+		return
+	}
+	if _, err = (&Bench{Type: "xx"}).Run(); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err = (&Bench{Target: "://xx"}).Run(); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestBenchStream(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				break
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	report, err := (&Bench{Type: "tcp", Target: ln.Addr().String(), Concurrency: 2, Requests: 10, Size: 32}).Run()
+	if err != nil || report.Requests != 10 || report.Errors != 0 || report.Bytes != 10*32 {
+		t.Errorf("%v,%v,%v", err, report, report.LastError)
+		return
+	}
+	udp, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	defer udp.Close()
+	go func() {
+		buffer := make([]byte, 1024)
+		for {
+			n, from, err := udp.ReadFrom(buffer)
+			if err != nil {
+				break
+			}
+			udp.WriteTo(buffer[:n], from)
+		}
+	}()
+	report, err = (&Bench{Type: "udp", Target: udp.LocalAddr().String(), Requests: 10}).Run()
+	if err != nil || report.Requests != 10 || report.Errors != 0 || report.Bytes != 10 {
+		t.Errorf("%v,%v,%v", err, report, report.LastError)
+		return
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	discover := newBenchDiscover(strings.TrimPrefix(backend.URL, "http://"), 1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		discover.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil))
+	}
+}
+
+func BenchmarkFindReverse(b *testing.B) {
+	discover := newBenchDiscover("127.0.0.1:80", 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if discover.findReverse(fmt.Sprintf("v%v.ds.test.loc", 100+i%1000)) == nil {
+			b.Error("not found")
+			return
+		}
+	}
+}
+
+func BenchmarkProcTCP(b *testing.B) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				break
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	discover := NewDiscover()
+	forward := &Forward{Name: "echo", Prefix: "tcp://127.0.0.1:0", Type: "tcp", Key: "127.0.0.1:0", URI: ln.Addr().String()}
+	if err := discover.listenTCP(forward, &Container{Name: "echo"}); err != nil {
+		b.Error(err)
+		return
+	}
+	listener := discover.proxyListen[forward.Prefix]
+	defer listener.Close()
+	bench := &Bench{Type: "tcp", Target: listener.TCP.Addr().String(), Requests: b.N, Size: 1024}
+	b.ReportAllocs()
+	b.ResetTimer()
+	report, err := bench.Run()
+	if err != nil || report.Errors > 0 {
+		b.Errorf("%v,%v", err, report)
+	}
+}
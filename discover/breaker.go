@@ -0,0 +1,111 @@
+package discover
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type breakerState struct {
+	Failures int
+	OpenAt   time.Time
+	Probing  bool
+}
+
+// allowBreaker will check if request can be sent to forward, the request is rejected when breaker is open,
+// and only one probe request is allowed when breaker is half-open after BreakerOpenTime
+func (d *Discover) allowBreaker(prefix string) (allow, probe bool) {
+	d.breakerLock.Lock()
+	defer d.breakerLock.Unlock()
+	state := d.breakers[prefix]
+	if state == nil || state.Failures < d.BreakerFailures {
+		allow = true
+		return
+	}
+	if state.Probing || time.Since(state.OpenAt) < d.BreakerOpenTime {
+		return
+	}
+	state.Probing = true
+	allow, probe = true, true
+	return
+}
+
+func (d *Discover) doneBreaker(prefix string, probe, failed bool) {
+	d.breakerLock.Lock()
+	defer d.breakerLock.Unlock()
+	if d.breakers == nil {
+		d.breakers = map[string]*breakerState{}
+	}
+	state := d.breakers[prefix]
+	if !failed {
+		if state != nil && state.Failures >= d.BreakerFailures {
+			InfoLog("Discover breaker of %v is closed", prefix)
+		}
+		delete(d.breakers, prefix)
+		return
+	}
+	if state == nil {
+		state = &breakerState{}
+		d.breakers[prefix] = state
+	}
+	if probe {
+		state.Probing = false
+	}
+	state.Failures++
+	if state.Failures >= d.BreakerFailures {
+		if probe || state.Failures == d.BreakerFailures {
+			WarnLog("Discover breaker of %v is opened after %v failures", prefix, state.Failures)
+		}
+		state.OpenAt = time.Now()
+	}
+}
+
+// resetBreaker will reset the breaker of forward, it is called when forward is added or updated
+func (d *Discover) resetBreaker(prefix string) {
+	d.breakerLock.Lock()
+	delete(d.breakers, prefix)
+	d.breakerLock.Unlock()
+}
+
+func (d *Discover) procBreakerOpen(w http.ResponseWriter, r *http.Request) {
+	if len(d.BreakerPage) > 0 {
+		page, err := ioutil.ReadFile(d.BreakerPage)
+		if err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Retry-After", fmt.Sprintf("%v", int(d.BreakerOpenTime/time.Second)))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write(page)
+			return
+		}
+		WarnLog("Discover load breaker page from %v fail with %v", d.BreakerPage, err)
+	}
+	w.Header().Set("Retry-After", fmt.Sprintf("%v", int(d.BreakerOpenTime/time.Second)))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, "service unavailable")
+}
+
+// middlewareBreaker will open the breaker of forward after BreakerFailures consecutive 502/503/504 responses,
+// the breaker is disabled when BreakerFailures is zero
+func (d *Discover) middlewareBreaker(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	if d.BreakerFailures < 1 {
+		next(w, r, reverse)
+		return
+	}
+	prefix := reverse.Forward.Prefix
+	allow, probe := d.allowBreaker(prefix)
+	if !allow {
+		d.procBreakerOpen(w, r)
+		return
+	}
+	writer := &statusWriter{ResponseWriter: w}
+	defer func() {
+		switch writer.Status {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			d.doneBreaker(prefix, probe, true)
+		default:
+			d.doneBreaker(prefix, probe, false)
+		}
+	}()
+	next(writer, r, reverse)
+}
@@ -0,0 +1,92 @@
+package discover
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.BreakerFailures = 2
+	discover.BreakerOpenTime = 50 * time.Millisecond
+	status := http.StatusBadGateway
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer backend.Close()
+	forward := &Forward{Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://")}
+	proxy, _ := discover.newReverseProxy(forward)
+	discover.proxyReverse["v100.ds.test.loc"] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: &Container{Name: "ds"}}
+	calls := 0
+	discover.RegisterMiddleware("count", func(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+		calls++
+		next(w, r, reverse)
+	})
+	discover.Middlewares = append(discover.Middlewares, "count")
+	call := func() int {
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil))
+		return res.Code
+	}
+	if call() != http.StatusBadGateway || call() != http.StatusBadGateway {
+		t.Error("status")
+		return
+	}
+	if code := call(); code != http.StatusServiceUnavailable || calls != 2 {
+		t.Error(code, calls)
+		return
+	}
+	//half open and fail
+	time.Sleep(60 * time.Millisecond)
+	if code := call(); code != http.StatusBadGateway || calls != 3 {
+		t.Error(code, calls)
+		return
+	}
+	if code := call(); code != http.StatusServiceUnavailable || calls != 3 {
+		t.Error(code, calls)
+		return
+	}
+	//half open and success
+	status = http.StatusOK
+	time.Sleep(60 * time.Millisecond)
+	if code := call(); code != http.StatusOK || calls != 4 {
+		t.Error(code, calls)
+		return
+	}
+	if code := call(); code != http.StatusOK || len(discover.breakers) != 0 {
+		t.Error(code, discover.breakers)
+		return
+	}
+	//page
+	dir, _ := ioutil.TempDir("", "breaker")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "page.html"), []byte("maintaining"), os.ModePerm)
+	discover.BreakerPage = filepath.Join(dir, "page.html")
+	status = http.StatusServiceUnavailable
+	call()
+	call()
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil))
+	if res.Code != http.StatusServiceUnavailable || res.Body.String() != "maintaining" {
+		t.Error(res.Code, res.Body.String())
+		return
+	}
+	discover.resetBreaker("v100.ds")
+	if allow, _ := discover.allowBreaker("v100.ds"); !allow {
+		t.Error("reset")
+		return
+	}
+	//disabled
+	discover.BreakerFailures = 0
+	if code := call(); code != http.StatusServiceUnavailable || len(discover.breakers) != 0 {
+		t.Error(code)
+		return
+	}
+}
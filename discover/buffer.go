@@ -0,0 +1,39 @@
+package discover
+
+import (
+	"sync"
+)
+
+// BufferPool is the pool of fixed size buffer, it implements httputil.BufferPool
+type BufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// NewBufferPool will return new pool of buffer by size
+func NewBufferPool(size int) (pool *BufferPool) {
+	pool = &BufferPool{size: size}
+	pool.pool.New = func() interface{} {
+		buffer := make([]byte, size)
+		return &buffer
+	}
+	return
+}
+
+// Get will return one buffer from pool
+func (b *BufferPool) Get() []byte {
+	return *(b.pool.Get().(*[]byte))
+}
+
+// Put will return buffer to pool, the buffer is dropped if size is not matched
+func (b *BufferPool) Put(buffer []byte) {
+	if cap(buffer) != b.size {
+		return
+	}
+	buffer = buffer[:b.size]
+	b.pool.Put(&buffer)
+}
+
+var copyPool = NewBufferPool(32 * 1024)
+
+var packetPool = NewBufferPool(64 * 1024)
@@ -0,0 +1,74 @@
+package discover
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type onlyReader struct {
+	io.Reader
+}
+
+type onlyWriter struct {
+	io.Writer
+}
+
+func TestBufferPool(t *testing.T) {
+	pool := NewBufferPool(1024)
+	buffer := pool.Get()
+	if len(buffer) != 1024 {
+		t.Error("error")
+		return
+	}
+	pool.Put(buffer[:10])
+	if buffer = pool.Get(); len(buffer) != 1024 {
+		t.Error("error")
+		return
+	}
+	pool.Put(make([]byte, 10))
+}
+
+func BenchmarkCopyAlloc(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 64*1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		io.Copy(onlyWriter{Writer: ioutil.Discard}, onlyReader{Reader: bytes.NewReader(data)})
+	}
+}
+
+func BenchmarkCopyPool(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 64*1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buffer := copyPool.Get()
+		io.CopyBuffer(onlyWriter{Writer: ioutil.Discard}, onlyReader{Reader: bytes.NewReader(data)}, buffer)
+		copyPool.Put(buffer)
+	}
+}
+
+func BenchmarkReverseProxy(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 64*1024)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer ts.Close()
+	remote, _ := url.Parse(ts.URL)
+	d := NewDiscover()
+	proxy, err := d.newReverseProxy(&Forward{Type: "http", URI: remote.Host})
+	if err != nil {
+		b.Error(err)
+		return
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil)
+		res := httptest.NewRecorder()
+		proxy.ServeHTTP(res, req)
+	}
+}
@@ -0,0 +1,333 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// captureRedacted is the header which is redacted on capture
+var captureRedacted = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Capture is the captured request/response pair of forward, the body is bounded by CaptureMaxBody
+type Capture struct {
+	ID                int64         `json:"id"`
+	At                time.Time     `json:"at"`
+	Host              string        `json:"host"`
+	Name              string        `json:"name"`
+	Version           string        `json:"version"`
+	Forward           string        `json:"forward"`
+	RemoteAddr        string        `json:"remote_addr"`
+	Method            string        `json:"method"`
+	URI               string        `json:"uri"`
+	Header            http.Header   `json:"header"`
+	Body              []byte        `json:"body,omitempty"`
+	BodyTruncated     bool          `json:"body_truncated,omitempty"`
+	Status            int           `json:"status"`
+	ResponseHeader    http.Header   `json:"response_header"`
+	ResponseBody      []byte        `json:"response_body,omitempty"`
+	ResponseTruncated bool          `json:"response_truncated,omitempty"`
+	Duration          time.Duration `json:"duration"`
+}
+
+// captureBuffer will keep the first max bytes which is written
+type captureBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (c *captureBuffer) keep(p []byte) {
+	if remain := c.max - c.Len(); remain < len(p) {
+		c.truncated = true
+		if remain > 0 {
+			c.Buffer.Write(p[:remain])
+		}
+		return
+	}
+	c.Buffer.Write(p)
+}
+
+// captureReader will capture the request body when it is read by proxy
+type captureReader struct {
+	io.ReadCloser
+	buffer *captureBuffer
+}
+
+func (c *captureReader) Read(p []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(p)
+	c.buffer.keep(p[:n])
+	return
+}
+
+// captureWriter will capture the response status, header and body
+type captureWriter struct {
+	*statusWriter
+	header http.Header
+	buffer *captureBuffer
+}
+
+func (c *captureWriter) WriteHeader(code int) {
+	if c.header == nil {
+		c.header = c.Header().Clone()
+	}
+	c.statusWriter.WriteHeader(code)
+}
+
+func (c *captureWriter) Write(p []byte) (n int, err error) {
+	if c.header == nil {
+		c.header = c.Header().Clone()
+	}
+	n, err = c.statusWriter.Write(p)
+	c.buffer.keep(p[:n])
+	return
+}
+
+func redactHeader(header http.Header) http.Header {
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	for _, key := range captureRedacted {
+		if len(header.Values(key)) > 0 {
+			header.Set(key, "[redacted]")
+		}
+	}
+	return header
+}
+
+// capturePercent will return the capture sampling percent of forward host, the runtime percent by SetCapture is preferred
+func (d *Discover) capturePercent(host string, forward *Forward) int {
+	d.captureLock.Lock()
+	defer d.captureLock.Unlock()
+	if percent, ok := d.captureHosts[host]; ok {
+		return percent
+	}
+	return forward.CapturePercent
+}
+
+// SetCapture will set the capture sampling percent of forward host at runtime, the percent by label PD_CAPTURE is used when percent < 0
+func (d *Discover) SetCapture(host string, percent int) {
+	d.captureLock.Lock()
+	defer d.captureLock.Unlock()
+	if d.captureHosts == nil {
+		d.captureHosts = map[string]int{}
+	}
+	if percent < 0 {
+		delete(d.captureHosts, host)
+	} else {
+		d.captureHosts[host] = percent
+	}
+}
+
+func (d *Discover) middlewareCapture(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	host := d.hostOf(reverse.Forward.Tenant, reverse.Forward.Prefix)
+	percent := d.capturePercent(host, reverse.Forward)
+	if percent < 1 || rand.Intn(100) >= percent {
+		next(w, r, reverse)
+		return
+	}
+	capture := &Capture{
+		At:         time.Now(),
+		Host:       host,
+		Name:       reverse.Service.Name,
+		Version:    reverse.Service.Version,
+		Forward:    reverse.Forward.Name,
+		RemoteAddr: r.RemoteAddr,
+		Method:     r.Method,
+		URI:        r.URL.RequestURI(),
+		Header:     redactHeader(r.Header),
+	}
+	body := &captureBuffer{max: int(d.CaptureMaxBody)}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &captureReader{ReadCloser: r.Body, buffer: body}
+	}
+	writer := &captureWriter{statusWriter: &statusWriter{ResponseWriter: w}, buffer: &captureBuffer{max: int(d.CaptureMaxBody)}}
+	next(writer, r, reverse)
+	if writer.header == nil {
+		writer.header = writer.Header().Clone()
+	}
+	capture.Duration = time.Since(capture.At)
+	capture.Body, capture.BodyTruncated = body.Bytes(), body.truncated
+	capture.Status = writer.Status
+	capture.ResponseHeader = redactHeader(writer.header)
+	capture.ResponseBody, capture.ResponseTruncated = writer.buffer.Bytes(), writer.buffer.truncated
+	d.addCapture(capture)
+}
+
+func (d *Discover) addCapture(capture *Capture) {
+	d.captureLock.Lock()
+	defer d.captureLock.Unlock()
+	d.captureID++
+	capture.ID = d.captureID
+	d.captureAll = append(d.captureAll, capture)
+	if len(d.captureAll) > d.CaptureSize {
+		d.captureAll = d.captureAll[len(d.captureAll)-d.CaptureSize:]
+	}
+}
+
+// Captures will return the captured request/response pairs of host in ring buffer, all is returned when host is empty
+func (d *Discover) Captures(host string) (captures []*Capture) {
+	captures = []*Capture{}
+	d.captureLock.Lock()
+	defer d.captureLock.Unlock()
+	for _, capture := range d.captureAll {
+		if len(host) < 1 || capture.Host == host {
+			captures = append(captures, capture)
+		}
+	}
+	return
+}
+
+// FindCapture will return the capture by id
+func (d *Discover) FindCapture(id int64) (capture *Capture) {
+	d.captureLock.Lock()
+	defer d.captureLock.Unlock()
+	for _, c := range d.captureAll {
+		if c.ID == id {
+			capture = c
+			break
+		}
+	}
+	return
+}
+
+// bufferResponse is the response writer which keep the response in memory
+type bufferResponse struct {
+	header http.Header
+	status int
+	body   *captureBuffer
+}
+
+func (b *bufferResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferResponse) Write(p []byte) (int, error) {
+	if b.status < 1 {
+		b.status = http.StatusOK
+	}
+	b.body.keep(p)
+	return len(p), nil
+}
+
+func (b *bufferResponse) WriteHeader(status int) {
+	if b.status < 1 {
+		b.status = status
+	}
+}
+
+// Replay will re-send the captured request to current version of forward or other version when version is not empty,
+// the request is sent to forward directly without middlewares and the redacted header is not sent,
+// the capture which body is truncated by CaptureMaxBody can't be replayed
+func (d *Discover) Replay(capture *Capture, version string) (result *Capture, err error) {
+	if capture.BodyTruncated {
+		err = fmt.Errorf("capture %v body is truncated by capture_max_body, can't be replayed", capture.ID)
+		return
+	}
+	reverse := d.findReverse(capture.Host)
+	if reverse == nil {
+		err = fmt.Errorf("forward %v is not found", capture.Host)
+		return
+	}
+	if len(version) > 0 {
+		host := d.hostOf(reverse.Forward.Tenant, reverse.Forward.VersionPrefix(version))
+		if reverse = d.findReverse(host); reverse == nil {
+			err = fmt.Errorf("forward %v is not found", host)
+			return
+		}
+	}
+	host := d.hostOf(reverse.Forward.Tenant, reverse.Forward.Prefix)
+	ctx, cancel := context.WithTimeout(context.Background(), d.HookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, capture.Method, "http://"+host+capture.URI, bytes.NewReader(capture.Body))
+	if err != nil {
+		return
+	}
+	for key, vals := range capture.Header {
+		if vals[0] == "[redacted]" {
+			continue
+		}
+		req.Header[key] = vals
+	}
+	req.ContentLength = int64(len(capture.Body))
+	req.RemoteAddr = "127.0.0.1:0"
+	res := &bufferResponse{header: http.Header{}, body: &captureBuffer{max: int(d.CaptureMaxBody)}}
+	result = &Capture{
+		At:      time.Now(),
+		Host:    host,
+		Name:    reverse.Service.Name,
+		Version: reverse.Service.Version,
+		Forward: reverse.Forward.Name,
+		Method:  capture.Method,
+		URI:     capture.URI,
+		Header:  redactHeader(req.Header),
+		Body:    capture.Body,
+	}
+	reverse.Reverse.ServeHTTP(res, req)
+	result.Duration = time.Since(result.At)
+	result.Status = res.status
+	result.ResponseHeader = res.header
+	result.ResponseBody, result.ResponseTruncated = res.body.Bytes(), res.body.truncated
+	InfoLog("Discover replay capture %v of %v to %v with status %v", capture.ID, capture.Host, host, result.Status)
+	return
+}
+
+// procAdminCapture will serve the captures on GET and set the capture percent of host on POST
+func (d *Discover) procAdminCapture(w http.ResponseWriter, r *http.Request) {
+	host := r.FormValue("host")
+	if r.Method == http.MethodGet {
+		if id := r.FormValue("id"); len(id) > 0 {
+			captureID, _ := strconv.ParseInt(id, 10, 64)
+			capture := d.FindCapture(captureID)
+			if capture == nil {
+				writeJSON(w, http.StatusNotFound, xmap.M{"code": http.StatusNotFound, "message": fmt.Sprintf("capture %v is not found", id)})
+				return
+			}
+			writeJSON(w, http.StatusOK, capture)
+			return
+		}
+		writeJSON(w, http.StatusOK, d.Captures(host))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, xmap.M{"code": http.StatusMethodNotAllowed, "message": "method not allowed"})
+		return
+	}
+	percent, err := strconv.Atoi(r.FormValue("percent"))
+	if len(host) < 1 || err != nil || percent > 100 {
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": "host and percent is required"})
+		return
+	}
+	d.SetCapture(host, percent)
+	InfoLog("Discover audit capture of %v is set to %v%% from %v", host, percent, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, xmap.M{"host": host, "percent": percent})
+}
+
+// procAdminReplay will replay the capture by id to current version or other version of forward
+func (d *Discover) procAdminReplay(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	capture := d.FindCapture(id)
+	if capture == nil {
+		writeJSON(w, http.StatusNotFound, xmap.M{"code": http.StatusNotFound, "message": fmt.Sprintf("capture %v is not found", r.FormValue("id"))})
+		return
+	}
+	if capture.BodyTruncated {
+		writeJSON(w, http.StatusConflict, xmap.M{"code": http.StatusConflict, "message": fmt.Sprintf("capture %v body is truncated by capture_max_body, can't be replayed", capture.ID)})
+		return
+	}
+	result, err := d.Replay(capture, r.FormValue("version"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+	InfoLog("Discover audit capture %v is replayed to %v from %v", id, result.Host, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, result)
+}
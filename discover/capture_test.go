@@ -0,0 +1,160 @@
+package discover
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/codingeasygo/util/converter"
+)
+
+func TestCapture(t *testing.T) {
+	newBackend := func(version string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("X-Version", version)
+			w.Header().Set("Set-Cookie", "a=1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(version + ":" + r.Header.Get("Authorization") + ":" + string(data)))
+		}))
+	}
+	v1, v2 := newBackend("v1"), newBackend("v2")
+	defer v1.Close()
+	defer v2.Close()
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.HostSuff = ".test.loc"
+	discover.AdminToken = "123"
+	discover.CaptureSize = 2
+	discover.CaptureMaxBody = 8
+	for _, backend := range []struct {
+		Version string
+		Prefix  string
+		URI     string
+	}{{"1.0.0", "v100.ds", v1.URL}, {"2.0.0", "v200.ds", v2.URL}} {
+		forward := &Forward{Name: "web", Prefix: backend.Prefix, Type: "http", URI: strings.TrimPrefix(backend.URI, "http://"), CapturePercent: 100}
+		service := &Container{ID: backend.Prefix, Name: "ds", Version: backend.Version, Forwards: map[string]*Forward{backend.Prefix: forward}}
+		proxy, _ := discover.newReverseProxy(forward)
+		discover.proxyReverse[backend.Prefix+".test.loc"] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: service}
+		discover.proxyAll[backend.Prefix] = service
+	}
+	send := func(body string) string {
+		req := httptest.NewRequest("POST", "http://v100.ds.test.loc/echo?a=1", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer xx")
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return res.Body.String()
+	}
+	if res := send("abc"); res != "v1:Bearer xx:abc" {
+		t.Error(res)
+		return
+	}
+	send("0123456789")
+	send("xyz")
+	captures := discover.Captures("")
+	if len(captures) != 2 || captures[0].ID != 2 || captures[1].ID != 3 {
+		t.Error(converter.JSON(captures))
+		return
+	}
+	capture := captures[0]
+	if capture.Method != "POST" || capture.URI != "/echo?a=1" || string(capture.Body) != "01234567" || !capture.BodyTruncated || capture.Status != http.StatusCreated ||
+		capture.Header.Get("Authorization") != "[redacted]" || capture.ResponseHeader.Get("Set-Cookie") != "[redacted]" || capture.ResponseHeader.Get("X-Version") != "v1" ||
+		string(capture.ResponseBody) != "v1:Beare" || !capture.ResponseTruncated {
+		t.Error(converter.JSON(capture))
+		return
+	}
+	if len(discover.Captures("v200.ds.test.loc")) != 0 {
+		t.Error("error")
+		return
+	}
+	//replay
+	result, err := discover.Replay(captures[1], "")
+	if err != nil || result.Status != http.StatusCreated || string(result.ResponseBody) != "v1::xyz" {
+		t.Error(err, converter.JSON(result))
+		return
+	}
+	result, err = discover.Replay(captures[1], "2.0.0")
+	if err != nil || result.Host != "v200.ds.test.loc" || string(result.ResponseBody) != "v2::xyz" {
+		t.Error(err, converter.JSON(result))
+		return
+	}
+	if _, err = discover.Replay(captures[1], "3.0.0"); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err = discover.Replay(captures[0], ""); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Error(err)
+		return
+	}
+	//admin
+	call := func(method, path string, form url.Values) (res *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "http://pdsrv"+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Authorization", "Bearer 123")
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res = httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return
+	}
+	res := call("GET", "/_api/captures?host=v100.ds.test.loc", nil)
+	list := []*Capture{}
+	if json.Unmarshal(res.Body.Bytes(), &list); res.Code != http.StatusOK || len(list) != 2 {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res = call("GET", "/_api/captures?id=3", nil); res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"id":3`) {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res = call("GET", "/_api/captures?id=1", nil); res.Code != http.StatusNotFound {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res = call("POST", "/_api/capture/replay", url.Values{"id": {"3"}, "version": {"2.0.0"}}); res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "v200.ds.test.loc") {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res = call("POST", "/_api/capture/replay", url.Values{"id": {"2"}}); res.Code != http.StatusConflict {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res = call("POST", "/_api/capture/replay", url.Values{"id": {"1"}}); res.Code != http.StatusNotFound {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	//disable by runtime
+	if res = call("POST", "/_api/captures", url.Values{"host": {"v100.ds.test.loc"}, "percent": {"0"}}); res.Code != http.StatusOK {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	send("abc")
+	if captures = discover.Captures(""); captures[1].ID != 3 {
+		t.Error(converter.JSON(captures))
+		return
+	}
+	if res = call("POST", "/_api/captures", url.Values{"host": {"v100.ds.test.loc"}, "percent": {"xx"}}); res.Code != http.StatusBadRequest {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	discover.SetCapture("v100.ds.test.loc", -1)
+	send("abc")
+	if captures = discover.Captures(""); captures[1].ID != 4 {
+		t.Error(converter.JSON(captures))
+		return
+	}
+	//label
+	labeled := &Container{Forwards: map[string]*Forward{"v100.ds": {Name: "web"}}}
+	applyForwardOptions(labeled, map[string]string{"PD_CAPTURE": "10"})
+	if labeled.Forwards["v100.ds"].CapturePercent != 10 {
+		t.Error("error")
+		return
+	}
+	applyForwardOptions(labeled, map[string]string{"PD_CAPTURE": "101"})
+	if labeled.Forwards["v100.ds"].CapturePercent != 10 {
+		t.Error("error")
+		return
+	}
+}
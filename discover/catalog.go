@@ -0,0 +1,57 @@
+package discover
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// CatalogFilter is the filter of catalog by query parameter, the Name and Query is matched by case-insensitive substring,
+// the Version is matched by glob pattern and the Type/Status is matched exactly
+type CatalogFilter struct {
+	Query   string
+	Name    string
+	Version string
+	Type    string
+	Status  string
+}
+
+// ParseCatalogFilter will parse the catalog filter by q/name/version/type/status query parameter
+func ParseCatalogFilter(query url.Values) (filter *CatalogFilter) {
+	filter = &CatalogFilter{
+		Query:   strings.ToLower(strings.TrimSpace(query.Get("q"))),
+		Name:    strings.ToLower(strings.TrimSpace(query.Get("name"))),
+		Version: strings.TrimSpace(query.Get("version")),
+		Type:    strings.ToLower(strings.TrimSpace(query.Get("type"))),
+		Status:  strings.ToLower(strings.TrimSpace(query.Get("status"))),
+	}
+	return
+}
+
+// Match will check if the forward of service is matched by filter
+func (c *CatalogFilter) Match(service *Container, forward *Forward) bool {
+	if c == nil {
+		return true
+	}
+	if len(c.Name) > 0 && !strings.Contains(strings.ToLower(service.Name), c.Name) {
+		return false
+	}
+	if len(c.Version) > 0 {
+		if matched, err := path.Match(c.Version, service.Version); err != nil || !matched {
+			return false
+		}
+	}
+	if len(c.Type) > 0 && strings.ToLower(forward.Type) != c.Type {
+		return false
+	}
+	if len(c.Status) > 0 && strings.ToLower(service.Status) != c.Status {
+		return false
+	}
+	if len(c.Query) > 0 {
+		text := strings.ToLower(strings.Join([]string{service.Name, service.Version, forward.Name, forward.Prefix, strings.Join(forward.Aliases, " ")}, " "))
+		if !strings.Contains(text, c.Query) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package discover
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCatalogFilter(t *testing.T) {
+	service := &Container{Name: "Api", Version: "v1.2.0", Status: "running"}
+	forward := &Forward{Name: "web", Type: "http", Prefix: "v1.api", Aliases: []string{"docs"}}
+	for query, expect := range map[string]bool{
+		"":                        true,
+		"name=api":                true,
+		"name=pi":                 true,
+		"name=web":                false,
+		"version=v1.*":            true,
+		"version=v2.*":            false,
+		"version=[":               false,
+		"type=HTTP":               true,
+		"type=tcp":                false,
+		"status=running":          true,
+		"status=exited":           false,
+		"q=docs":                  true,
+		"q=WEB":                   true,
+		"q=xx":                    false,
+		"name=api&type=tcp":       false,
+		"name=api&status=running": true,
+	} {
+		values, _ := url.ParseQuery(query)
+		if ParseCatalogFilter(values).Match(service, forward) != expect {
+			t.Error(query)
+			return
+		}
+	}
+	var filter *CatalogFilter
+	if !filter.Match(service, forward) {
+		t.Error("nil")
+		return
+	}
+	//catalog
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.AdminToken = "123"
+	for _, service := range []*Container{{Name: "a", Version: "v1", Status: "running"}, {Name: "a", Version: "v2", Status: "exited"}, {Name: "b", Version: "v1", Status: "running"}} {
+		host := service.Version + "." + service.Name
+		service.Forwards = map[string]*Forward{host: {Name: "web", Type: "http", Prefix: host}}
+		discover.proxyAll[host] = service
+	}
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://pdsrv/?name=a&status=running", nil))
+	if !strings.Contains(res.Body.String(), "Having 1 services, 1 hosts") {
+		t.Error(res.Body.String())
+		return
+	}
+	req := httptest.NewRequest("GET", "http://pdsrv/_api/catalog?version=v1", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	catalog := []map[string]interface{}{}
+	if err := json.Unmarshal(res.Body.Bytes(), &catalog); err != nil || len(catalog) != 2 {
+		t.Error(err, res.Body.String())
+		return
+	}
+}
@@ -0,0 +1,44 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const robotsDisallow = "User-agent: *\nDisallow: /\n"
+
+func (d *Discover) procRobots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%v", robotsDisallow)
+}
+
+// unknownCatalog will check if the request to unknown host is processed by catalog
+func (d *Discover) unknownCatalog() bool {
+	mode := d.UnknownHost
+	return mode != "404" && !strings.HasPrefix(mode, "redirect:") && !(mode == "template" && d.UnknownTemplate != nil)
+}
+
+// procUnknown will process the request to unknown host by UnknownHost mode, which is
+// catalog to show catalog, 404 to show plain not found, redirect:<url> to redirect, template to render UnknownTemplate
+func (d *Discover) procUnknown(w http.ResponseWriter, r *http.Request) {
+	mode := d.UnknownHost
+	switch {
+	case mode == "404":
+		http.NotFound(w, r)
+	case strings.HasPrefix(mode, "redirect:"):
+		http.Redirect(w, r, strings.TrimPrefix(mode, "redirect:"), http.StatusFound)
+	case mode == "template" && d.UnknownTemplate != nil:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		err := d.UnknownTemplate.Execute(w, map[string]interface{}{
+			"Host": r.Host,
+			"Path": r.URL.Path,
+		})
+		if err != nil {
+			WarnLog("Discover render unknown template fail with %v", err)
+		}
+	default:
+		d.procCatalog(w, r, "")
+	}
+}
@@ -0,0 +1,142 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+const (
+	// CollisionNewest is the prefix collision policy which the container started newest serves the prefix
+	CollisionNewest = "newest"
+	// CollisionOldest is the prefix collision policy which the container started oldest serves the prefix
+	CollisionOldest = "oldest"
+)
+
+// CollisionContainer is the container which has the collided forward prefix
+type CollisionContainer struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	StartedAt string `json:"started_at"`
+}
+
+// PrefixCollision is the forward prefix which is produced by multiple containers, the prefix is served by Winner
+// which is selected by PrefixCollision policy
+type PrefixCollision struct {
+	Prefix string                `json:"prefix"`
+	Policy string                `json:"policy"`
+	Winner *CollisionContainer   `json:"winner"`
+	Losers []*CollisionContainer `json:"losers"`
+	Since  time.Time             `json:"since"`
+}
+
+func newCollisionContainer(container *Container) *CollisionContainer {
+	return &CollisionContainer{ID: container.ID, Name: container.Name, Version: container.Version, StartedAt: container.StartedAt}
+}
+
+// preferContainer will return if container a is preferred to b by PrefixCollision policy, the smaller id is preferred
+// when started at the same time, so the result is same on each refresh. the tenant container which owns the prefix by
+// .<tenant> suffix is always preferred, so the container of other tenant can't take the host of tenant
+func (d *Discover) preferContainer(prefix string, a, b *Container) bool {
+	ownA, ownB := ownPrefix(prefix, a), ownPrefix(prefix, b)
+	if ownA != ownB {
+		return ownA
+	}
+	startedA, _ := time.Parse(time.RFC3339Nano, a.StartedAt)
+	startedB, _ := time.Parse(time.RFC3339Nano, b.StartedAt)
+	if !startedA.Equal(startedB) {
+		if d.PrefixCollision == CollisionOldest {
+			return startedA.Before(startedB)
+		}
+		return startedA.After(startedB)
+	}
+	return a.ID < b.ID
+}
+
+// ownPrefix will check if the prefix is produced by tenant of container
+func ownPrefix(prefix string, container *Container) bool {
+	return len(container.Tenant) > 0 && strings.HasSuffix(prefix, "."+container.Tenant)
+}
+
+// resolveCollisions will select the container to serve the prefix from candidates, the collisions are recorded
+// as label problems and reported by PrefixCollisions
+func (d *Discover) resolveCollisions(candidates map[string][]*Container, containers map[string]*Container) {
+	d.collisionLock.Lock()
+	defer d.collisionLock.Unlock()
+	collisions := map[string]*PrefixCollision{}
+	for prefix, services := range candidates {
+		if len(services) < 2 {
+			containers[prefix] = services[0]
+			continue
+		}
+		sort.Slice(services, func(i, j int) bool {
+			return d.preferContainer(prefix, services[i], services[j])
+		})
+		winner := services[0]
+		containers[prefix] = winner
+		collision := &PrefixCollision{
+			Prefix: prefix,
+			Policy: d.PrefixCollision,
+			Winner: newCollisionContainer(winner),
+			Since:  time.Now(),
+		}
+		for _, loser := range services[1:] {
+			collision.Losers = append(collision.Losers, newCollisionContainer(loser))
+			winner.addProblem("", prefix, "prefix is also used by %v-%v(%v)", loser.Name, loser.Version, shortID(loser.ID))
+			loser.addProblem("", prefix, "prefix is served by %v-%v(%v) by %v policy", winner.Name, winner.Version, shortID(winner.ID), d.PrefixCollision)
+		}
+		if old := d.prefixCollisions[prefix]; old != nil && old.Winner.ID == winner.ID && len(old.Losers) == len(collision.Losers) {
+			collision.Since = old.Since
+		} else {
+			d.notifyCollision(winner, collision)
+		}
+		collisions[prefix] = collision
+	}
+	d.prefixCollisions = collisions
+}
+
+// notifyCollision will call the collision webhook of winner container and CollisionHook
+func (d *Discover) notifyCollision(winner *Container, collision *PrefixCollision) {
+	ErrorLog("Discover prefix %v is collided by %v containers, it is served by %v-%v(%v) by %v policy", collision.Prefix, len(collision.Losers)+1, winner.Name, winner.Version, shortID(winner.ID), collision.Policy)
+	info := xmap.M{
+		"event":  "collision",
+		"prefix": collision.Prefix,
+		"policy": collision.Policy,
+		"winner": collision.Winner,
+		"losers": collision.Losers,
+	}
+	data, _ := json.Marshal(info)
+	for _, uri := range []string{winner.Hooks["collision"], d.CollisionHook} {
+		if len(uri) > 0 {
+			go d.callHook(winner, "collision", uri, data)
+		}
+	}
+}
+
+// PrefixCollisions will return the current prefix collisions sorted by prefix
+func (d *Discover) PrefixCollisions() (collisions []*PrefixCollision) {
+	collisions = []*PrefixCollision{}
+	d.collisionLock.Lock()
+	for _, collision := range d.prefixCollisions {
+		collisions = append(collisions, collision)
+	}
+	d.collisionLock.Unlock()
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].Prefix < collisions[j].Prefix
+	})
+	return
+}
+
+func (d *Discover) writeCollisionMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP pdservice_prefix_collision The number of containers which produce the same forward prefix.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_prefix_collision gauge\n")
+	for _, collision := range d.PrefixCollisions() {
+		fmt.Fprintf(w, "pdservice_prefix_collision{prefix=%q,winner=%q} %v\n", collision.Prefix, collision.Winner.ID, len(collision.Losers)+1)
+	}
+}
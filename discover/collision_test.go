@@ -0,0 +1,57 @@
+package discover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestResolveCollisions(t *testing.T) {
+	discover := NewDiscover()
+	newContainer := func(id, startedAt string) *Container {
+		return &Container{ID: id, Name: "ds", Version: "v1.0.0", StartedAt: startedAt, Forwards: map[string]*Forward{"v100.ds": {Prefix: "v100.ds"}}}
+	}
+	c1 := newContainer("c1", "2026-01-01T00:00:00.1Z")
+	c2 := newContainer("c2", "2026-01-01T00:00:00.2Z")
+	c3 := newContainer("c3", "2026-01-01T00:00:00.2Z")
+	other := newContainer("c4", "2026-01-01T00:00:00Z")
+	containers := map[string]*Container{}
+	discover.resolveCollisions(map[string][]*Container{"v100.ds": {c1, c3, c2}, "v101.ds": {other}}, containers)
+	if containers["v100.ds"] != c2 || containers["v101.ds"] != other {
+		t.Error(containers)
+		return
+	}
+	if len(c1.Problems) != 1 || len(c2.Problems) != 2 || len(c3.Problems) != 1 || len(other.Problems) != 0 {
+		t.Errorf("%v,%v,%v", c1.Problems, c2.Problems, c3.Problems)
+		return
+	}
+	collisions := discover.PrefixCollisions()
+	if len(collisions) != 1 || collisions[0].Winner.ID != "c2" || len(collisions[0].Losers) != 2 || collisions[0].Policy != CollisionNewest {
+		t.Error(collisions)
+		return
+	}
+	since := collisions[0].Since
+	discover.resolveCollisions(map[string][]*Container{"v100.ds": {c2, c1, c3}}, map[string]*Container{})
+	if collisions = discover.PrefixCollisions(); !collisions[0].Since.Equal(since) {
+		t.Error(collisions)
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	discover.writeCollisionMetrics(buf)
+	if !strings.Contains(buf.String(), `pdservice_prefix_collision{prefix="v100.ds",winner="c2"} 3`) {
+		t.Error(buf.String())
+		return
+	}
+	discover.PrefixCollision = CollisionOldest
+	containers = map[string]*Container{}
+	discover.resolveCollisions(map[string][]*Container{"v100.ds": {c2, c3, c1}}, containers)
+	if containers["v100.ds"] != c1 {
+		t.Error(containers)
+		return
+	}
+	discover.resolveCollisions(map[string][]*Container{}, containers)
+	if collisions = discover.PrefixCollisions(); len(collisions) != 0 {
+		t.Error(collisions)
+		return
+	}
+}
@@ -0,0 +1,259 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// ComposeService is the expected service and forwards which is derived from docker compose file
+type ComposeService struct {
+	File     string   `json:"file"`
+	Service  string   `json:"service"`
+	Name     string   `json:"name"`
+	Version  string   `json:"version"`
+	Forwards []string `json:"forwards"`
+}
+
+// ComposeDrift is the expected service or forward of compose file which is not running
+type ComposeDrift struct {
+	File    string    `json:"file"`
+	Service string    `json:"service"`
+	Name    string    `json:"name"`
+	Version string    `json:"version"`
+	Forward string    `json:"forward,omitempty"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+// Key will return the unique key of drift
+func (c *ComposeDrift) Key() string {
+	return fmt.Sprintf("%v/%v/%v", c.File, c.Service, c.Forward)
+}
+
+type composeLoaded struct {
+	ModTime  time.Time
+	Services []*ComposeService
+}
+
+// composeFile is the json of docker compose config, the labels is map or list of KEY=VALUE
+type composeFile struct {
+	Services map[string]struct {
+		ContainerName string      `json:"container_name"`
+		Labels        interface{} `json:"labels"`
+	} `json:"services"`
+}
+
+func composeLabels(val interface{}) (labels map[string]string) {
+	labels = map[string]string{}
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			labels[key] = fmt.Sprintf("%v", value)
+		}
+	case []interface{}:
+		for _, item := range v {
+			parts := strings.SplitN(fmt.Sprintf("%v", item), "=", 2)
+			if len(parts) == 2 {
+				labels[parts[0]] = parts[1]
+			} else {
+				labels[parts[0]] = ""
+			}
+		}
+	}
+	return
+}
+
+// ParseCompose will parse the expected services from the json of docker compose config, the service is expected when
+// container_name is matched by MatchKey, the forwards is the name of PD_HOST/PD_TCP/PD_UDP/PD_UNIX labels
+func (d *Discover) ParseCompose(file string, data []byte) (services []*ComposeService, err error) {
+	compose := &composeFile{}
+	if err = json.Unmarshal(data, compose); err != nil {
+		return
+	}
+	for key, service := range compose.Services {
+		nameParts := strings.SplitN(service.ContainerName, d.MatchKey, 2)
+		if len(nameParts) < 2 {
+			continue
+		}
+		labels, xerr := expandLabels(composeLabels(service.Labels))
+		if xerr != nil {
+			err = fmt.Errorf("service %v %v", key, xerr)
+			return
+		}
+		expected := &ComposeService{
+			File:     file,
+			Service:  key,
+			Name:     nameParts[0],
+			Version:  strings.SplitN(nameParts[1], "-", 2)[0],
+			Forwards: []string{},
+		}
+		for label := range labels {
+			for _, prefix := range []string{"PD_HOST_", "PD_TCP_", "PD_UDP_", "PD_UNIX_"} {
+				if strings.HasPrefix(label, prefix) {
+					expected.Forwards = append(expected.Forwards, strings.TrimPrefix(label, prefix))
+				}
+			}
+		}
+		sort.Strings(expected.Forwards)
+		services = append(services, expected)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Service < services[j].Service })
+	return
+}
+
+// loadCompose will load the compose file by ComposeCommand config --format json, the json file is read directly,
+// the loaded services is cached until the file is changed
+func (d *Discover) loadCompose(file string) (services []*ComposeService, err error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+	d.composeLock.Lock()
+	loaded := d.composeLoaded[file]
+	d.composeLock.Unlock()
+	if loaded != nil && loaded.ModTime.Equal(info.ModTime()) {
+		services = loaded.Services
+		return
+	}
+	var data []byte
+	if strings.HasSuffix(file, ".json") {
+		data, err = ioutil.ReadFile(file)
+	} else {
+		var args []string
+		if args, err = splitCommand(d.ComposeCommand); err != nil {
+			return
+		}
+		args = append(args, "-f", file, "config", "--format", "json")
+		ctx, cancel := context.WithTimeout(context.Background(), d.TriggerTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Dir = filepath.Dir(file)
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		if data, err = cmd.Output(); err != nil {
+			err = fmt.Errorf("%v, %v", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+	if err != nil {
+		return
+	}
+	if services, err = d.ParseCompose(file, data); err != nil {
+		return
+	}
+	d.composeLock.Lock()
+	if d.composeLoaded == nil {
+		d.composeLoaded = map[string]*composeLoaded{}
+	}
+	d.composeLoaded[file] = &composeLoaded{ModTime: info.ModTime(), Services: services}
+	d.composeLock.Unlock()
+	return
+}
+
+// checkCompose will reconcile the expected services of ComposeFiles against running containers on refresh,
+// the drift is alerted once by ComposeHook until it is resolved
+func (d *Discover) checkCompose() {
+	if len(d.ComposeFiles) < 1 {
+		return
+	}
+	running := map[string]map[string]bool{}
+	d.proxyLock.RLock()
+	for _, service := range d.proxyAll {
+		key := service.Name + "/" + service.Version
+		if running[key] == nil {
+			running[key] = map[string]bool{}
+		}
+		for _, forward := range service.Forwards {
+			running[key][forward.Name] = true
+		}
+	}
+	d.proxyLock.RUnlock()
+	drifts := []*ComposeDrift{}
+	for _, file := range d.ComposeFiles {
+		services, err := d.loadCompose(file)
+		if err != nil {
+			WarnLog("Discover load compose file %v fail with %v", file, err)
+			continue
+		}
+		for _, service := range services {
+			forwards, ok := running[service.Name+"/"+service.Version]
+			if !ok {
+				drifts = append(drifts, &ComposeDrift{File: file, Service: service.Service, Name: service.Name, Version: service.Version, Message: "service is not running"})
+				continue
+			}
+			for _, forward := range service.Forwards {
+				if !forwards[forward] {
+					drifts = append(drifts, &ComposeDrift{File: file, Service: service.Service, Name: service.Name, Version: service.Version, Forward: forward, Message: "forward is not found"})
+				}
+			}
+		}
+	}
+	now := time.Now()
+	notify := []*ComposeDrift{}
+	d.composeLock.Lock()
+	last := map[string]*ComposeDrift{}
+	for _, drift := range d.composeDrift {
+		last[drift.Key()] = drift
+	}
+	for _, drift := range drifts {
+		if old, ok := last[drift.Key()]; ok {
+			drift.Since = old.Since
+		} else {
+			drift.Since = now
+			notify = append(notify, drift)
+		}
+	}
+	d.composeDrift = drifts
+	d.composeLock.Unlock()
+	if len(notify) < 1 {
+		return
+	}
+	WarnLog("Discover compose is drifted by %v", driftKeys(notify))
+	if len(d.ComposeHook) < 1 {
+		return
+	}
+	data, _ := json.Marshal(xmap.M{
+		"event":  "drift",
+		"drifts": notify,
+	})
+	go d.callHook(&Container{Name: "pdservice"}, "drift", d.ComposeHook, data)
+}
+
+func driftKeys(drifts []*ComposeDrift) string {
+	keys := []string{}
+	for _, drift := range drifts {
+		keys = append(keys, drift.Key())
+	}
+	return strings.Join(keys, ",")
+}
+
+// ComposeDrifts will return the drift of compose files on last refresh
+func (d *Discover) ComposeDrifts() (drifts []*ComposeDrift) {
+	drifts = []*ComposeDrift{}
+	d.composeLock.Lock()
+	drifts = append(drifts, d.composeDrift...)
+	d.composeLock.Unlock()
+	return
+}
+
+func (d *Discover) writeComposeMetrics(w io.Writer) {
+	if len(d.ComposeFiles) < 1 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP pdservice_compose_drift The expected service or forward of compose file which is not running.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_compose_drift gauge\n")
+	for _, drift := range d.ComposeDrifts() {
+		fmt.Fprintf(w, "pdservice_compose_drift{service=%q,version=%q,forward=%q} 1\n", drift.Name, drift.Version, drift.Forward)
+	}
+}
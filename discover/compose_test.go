@@ -0,0 +1,129 @@
+package discover
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCompose = `{
+	"services": {
+		"api": {"container_name": "ds-srv-v1.0.0", "labels": {"PD_HOST_API": "api/8080", "PD_TCP_DB": ":5432/5432", "OTHER": "1"}},
+		"web": {"container_name": "web-srv-v2.0.0", "labels": ["PD_HOST_WEB=8080"]},
+		"redis": {"image": "redis"}
+	}
+}`
+
+func TestParseCompose(t *testing.T) {
+	discover := NewDiscover()
+	services, err := discover.ParseCompose("a.json", []byte(testCompose))
+	if err != nil || len(services) != 2 {
+		t.Errorf("%v,%v", err, services)
+		return
+	}
+	if services[0].Service != "api" || services[0].Name != "ds" || services[0].Version != "v1.0.0" || strings.Join(services[0].Forwards, ",") != "API,DB" {
+		t.Error(services[0])
+		return
+	}
+	if services[1].Name != "web" || strings.Join(services[1].Forwards, ",") != "WEB" {
+		t.Error(services[1])
+		return
+	}
+	if _, err = discover.ParseCompose("a.json", []byte("xx")); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestComposeDrift(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "compose")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "compose.json")
+	ioutil.WriteFile(file, []byte(testCompose), 0644)
+	received := make(chan string, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received <- r.Header.Get("X-PD-Event") + ":" + string(data)
+	}))
+	defer hook.Close()
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.HostSelf = "pdsrv"
+	discover.ComposeFiles = []string{file}
+	discover.ComposeHook = hook.URL
+	discover.applyProxy(map[string]*Container{"api.v100.ds": {ID: "c1", Name: "ds", Version: "v1.0.0", Forwards: map[string]*Forward{
+		"api.v100.ds": {Name: "API", Prefix: "api.v100.ds", Type: "http", URI: "127.0.0.1:8080"},
+	}}})
+	discover.checkCompose()
+	drifts := discover.ComposeDrifts()
+	if len(drifts) != 2 || drifts[0].Forward != "DB" || drifts[1].Name != "web" || drifts[1].Message != "service is not running" {
+		t.Error(drifts)
+		return
+	}
+	select {
+	case data := <-received:
+		if !strings.HasPrefix(data, "drift:") || !strings.Contains(data, `"web"`) {
+			t.Error(data)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timeout")
+		return
+	}
+	//alerted once
+	since := drifts[0].Since
+	discover.checkCompose()
+	if drifts = discover.ComposeDrifts(); len(drifts) != 2 || !drifts[0].Since.Equal(since) {
+		t.Error(drifts)
+		return
+	}
+	select {
+	case data := <-received:
+		t.Error(data)
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+	buf := bytes.NewBuffer(nil)
+	discover.WriteMetrics(buf)
+	if !strings.Contains(buf.String(), `pdservice_compose_drift{service="web",version="v2.0.0",forward=""} 1`) {
+		t.Error(buf.String())
+		return
+	}
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://pdsrv/", nil))
+	if !strings.Contains(res.Body.String(), "2 compose drifts") {
+		t.Error(res.Body.String())
+		return
+	}
+	//resolved
+	discover.ComposeFiles = []string{filepath.Join(dir, "none.json")}
+	discover.checkCompose()
+	if drifts = discover.ComposeDrifts(); len(drifts) != 0 {
+		t.Error(drifts)
+		return
+	}
+	//command
+	discover.ComposeFiles = []string{filepath.Join(dir, "compose.yml")}
+	discover.ComposeCommand = `sh -c "cat ` + file + `"`
+	ioutil.WriteFile(discover.ComposeFiles[0], []byte("services:"), 0644)
+	if services, err := discover.loadCompose(discover.ComposeFiles[0]); err != nil || len(services) != 2 {
+		t.Errorf("%v,%v", err, services)
+		return
+	}
+	discover.ComposeCommand = "false"
+	if services, err := discover.loadCompose(discover.ComposeFiles[0]); err != nil || len(services) != 2 {
+		t.Errorf("cached %v,%v", err, services)
+		return
+	}
+	discover.composeLoaded = nil
+	if _, err := discover.loadCompose(discover.ComposeFiles[0]); err == nil {
+		t.Error("error")
+		return
+	}
+}
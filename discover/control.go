@@ -0,0 +1,133 @@
+package discover
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// RoleControl will serve /_s, admin api, metrics and pprof on dedicated admin listener
+const RoleControl = "control"
+
+// ParseAllow will parse the ip or cidr list which is allowed to access admin listener
+func ParseAllow(allow []string) (networks []*net.IPNet, err error) {
+	for _, val := range allow {
+		if !strings.Contains(val, "/") {
+			if ip := net.ParseIP(val); ip != nil && ip.To4() != nil {
+				val += "/32"
+			} else {
+				val += "/128"
+			}
+		}
+		_, network, xerr := net.ParseCIDR(val)
+		if xerr != nil {
+			err = fmt.Errorf("invalid allow %v by %v", val, xerr)
+			return
+		}
+		networks = append(networks, network)
+	}
+	return
+}
+
+// AdminTLSConfig will return the tls config of admin listener, the client certificate is required when clientCA is not empty
+func (d *Discover) AdminTLSConfig(certFile, keyFile, clientCA string) (config *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return
+	}
+	config = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if len(clientCA) > 0 {
+		data, xerr := ioutil.ReadFile(clientCA)
+		if xerr != nil {
+			err = xerr
+			return
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(data) {
+			err = fmt.Errorf("not cert found in %v", clientCA)
+			return
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return
+}
+
+// controlSeparated will check if /_s and admin api is moved to admin listener
+func (d *Discover) controlSeparated(r *http.Request) bool {
+	return len(d.AdminListen) > 0 && listenRole(r) != RoleControl
+}
+
+func (d *Discover) allowControl(r *http.Request) bool {
+	if len(d.AdminAllow) < 1 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	for _, network := range d.AdminAllow {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// procControl will process the request on admin listener, the service of /_s is found by host form value or request host
+func (d *Discover) procControl(w http.ResponseWriter, r *http.Request) {
+	if !d.allowControl(r) {
+		WarnLog("Discover deny admin listener request %v from %v", r.URL.Path, r.RemoteAddr)
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "forbidden")
+		return
+	}
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/debug/pprof/"):
+		if !d.AdminPprof {
+			http.NotFound(w, r)
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, "/debug/pprof/") {
+		case "cmdline":
+			pprof.Cmdline(w, r)
+		case "profile":
+			pprof.Profile(w, r)
+		case "symbol":
+			pprof.Symbol(w, r)
+		case "trace":
+			pprof.Trace(w, r)
+		default:
+			pprof.Index(w, r)
+		}
+	case len(d.AdminPrefix) > 0 && strings.HasPrefix(r.URL.Path, d.AdminPrefix):
+		d.procAdmin(w, r)
+	case d.XDS && r.URL.Path == XDSEndpointPath:
+		d.procXDS(w, r)
+	case strings.HasPrefix(r.URL.Path, d.SrvPrefix):
+		host := r.URL.Query().Get("host")
+		if len(host) < 1 {
+			host = r.Host
+		}
+		reverse := d.findReverse(host)
+		if reverse == nil {
+			http.NotFound(w, r)
+			return
+		}
+		d.procServer(w, r, reverse.Service)
+	default:
+		tenant, _ := d.selfTenant(r.Host)
+		if d.procStatic(w, r) {
+			return
+		}
+		d.procCatalog(w, r, tenant)
+	}
+}
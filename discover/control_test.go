@@ -0,0 +1,102 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseAllow(t *testing.T) {
+	networks, err := ParseAllow([]string{"127.0.0.1", "10.0.0.0/8", "::1"})
+	if err != nil || len(networks) != 3 || networks[0].String() != "127.0.0.1/32" || networks[2].String() != "::1/128" {
+		t.Error(networks, err)
+		return
+	}
+	if _, err = ParseAllow([]string{"xx"}); err == nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestControl(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.AdminToken = "123"
+	forward := &Forward{Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://")}
+	proxy, _ := discover.newReverseProxy(forward)
+	discover.proxyReverse["v100.ds"] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: &Container{Name: "ds", Token: "abc"}}
+	call := func(role, host, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://"+host+path, nil)
+		req.Header.Set("Authorization", "Bearer 123")
+		req.RemoteAddr = "127.0.0.1:1000"
+		res := httptest.NewRecorder()
+		discover.RoleHandler(role).ServeHTTP(res, req)
+		return res
+	}
+	//not separated
+	if res := call(RoleAll, "pdsrv", "/_api/status"); res.Code != http.StatusOK {
+		t.Error(res.Code)
+		return
+	}
+	if res := call(RoleAll, "v100.ds", "/_s/docker/ps"); res.Code != http.StatusUnauthorized {
+		t.Error(res.Code)
+		return
+	}
+	//separated
+	discover.AdminListen = "127.0.0.1:9232"
+	if res := call(RoleAll, "pdsrv", "/_api/status"); res.Code != http.StatusNotFound {
+		t.Error(res.Code)
+		return
+	}
+	if res := call(RoleAll, "v100.ds", "/_s/docker/ps"); res.Code != http.StatusOK || res.Body.String() != "backend" {
+		t.Error(res.Code, res.Body.String())
+		return
+	}
+	if res := call(RoleControl, "127.0.0.1:9232", "/_api/status"); res.Code != http.StatusOK {
+		t.Error(res.Code)
+		return
+	}
+	if res := call(RoleControl, "127.0.0.1:9232", "/_s/docker/ps?host=v100.ds"); res.Code != http.StatusUnauthorized {
+		t.Error(res.Code)
+		return
+	}
+	if res := call(RoleControl, "127.0.0.1:9232", "/_s/docker/ps?host=v101.ds"); res.Code != http.StatusNotFound {
+		t.Error(res.Code)
+		return
+	}
+	if res := call(RoleControl, "127.0.0.1:9232", "/"); res.Code != http.StatusOK {
+		t.Error(res.Code)
+		return
+	}
+	//pprof
+	if res := call(RoleControl, "127.0.0.1:9232", "/debug/pprof/"); res.Code != http.StatusNotFound {
+		t.Error(res.Code)
+		return
+	}
+	discover.AdminPprof = true
+	if res := call(RoleControl, "127.0.0.1:9232", "/debug/pprof/"); res.Code != http.StatusOK {
+		t.Error(res.Code)
+		return
+	}
+	//allow
+	discover.AdminAllow, _ = ParseAllow([]string{"10.0.0.0/8"})
+	if res := call(RoleControl, "127.0.0.1:9232", "/_api/status"); res.Code != http.StatusForbidden {
+		t.Error(res.Code)
+		return
+	}
+	discover.AdminAllow, _ = ParseAllow([]string{"127.0.0.0/8"})
+	if res := call(RoleControl, "127.0.0.1:9232", "/_api/status"); res.Code != http.StatusOK {
+		t.Error(res.Code)
+		return
+	}
+	//tls
+	if _, err := discover.AdminTLSConfig("none.pem", "none.key", ""); err == nil {
+		t.Error(err)
+		return
+	}
+}
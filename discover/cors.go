@@ -0,0 +1,121 @@
+package discover
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORS is the cors policy of forward
+type CORS struct {
+	Origins     []string `json:"origins,omitempty"`
+	Methods     []string `json:"methods,omitempty"`
+	Headers     []string `json:"headers,omitempty"`
+	Credentials bool     `json:"credentials,omitempty"`
+	MaxAge      int      `json:"max_age,omitempty"`
+}
+
+// AllowOrigin will return the allowed origin value, empty is not allowed, the * is ignored when credentials is allowed,
+// because any origin can read the credentialed response
+func (c *CORS) AllowOrigin(origin string) string {
+	for _, allowed := range c.Origins {
+		if allowed == "*" {
+			if c.Credentials {
+				continue
+			}
+			return "*"
+		}
+		if allowed == origin || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(origin, allowed[1:])) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// Handle will write cors header to response, done is true when it is preflight request and response is written
+func (c *CORS) Handle(w http.ResponseWriter, r *http.Request) (done bool) {
+	origin := r.Header.Get("Origin")
+	if len(origin) < 1 {
+		return
+	}
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	allowed := c.AllowOrigin(origin)
+	preflight := r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0
+	if len(allowed) < 1 {
+		if preflight {
+			w.WriteHeader(http.StatusForbidden)
+			done = true
+		}
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", allowed)
+	if c.Credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		return
+	}
+	methods := c.Methods
+	if len(methods) < 1 {
+		methods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(c.Headers) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(c.Headers, ", "))
+	} else if requested := r.Header.Get("Access-Control-Request-Headers"); len(requested) > 0 {
+		header.Set("Access-Control-Allow-Headers", requested)
+	}
+	if c.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	done = true
+	return
+}
+
+// ModifyResponse will remove the cors header from backend, the header is replaced by policy
+func (c *CORS) ModifyResponse(res *http.Response) (err error) {
+	for key := range res.Header {
+		if strings.HasPrefix(key, "Access-Control-Allow-") || key == "Access-Control-Max-Age" {
+			res.Header.Del(key)
+		}
+	}
+	return
+}
+
+// checkCORS will remove the * origin of forwards which allows credentials, the removed origin is recorded as label problem,
+// so the credentialed forward must list the allowed origins
+func (d *Discover) checkCORS(container *Container) {
+	for _, forward := range container.Forwards {
+		if forward.CORS == nil || !forward.CORS.Credentials {
+			continue
+		}
+		origins := []string{}
+		for _, origin := range forward.CORS.Origins {
+			if origin == "*" {
+				container.addProblem("PD_CORS_ORIGINS_"+forward.Name, origin, "* origin can't be used with credentials, the origins must be listed")
+				continue
+			}
+			origins = append(origins, origin)
+		}
+		forward.CORS.Origins = origins
+	}
+}
+
+func splitList(val string) (list []string) {
+	for _, v := range strings.Split(val, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) > 0 {
+			list = append(list, v)
+		}
+	}
+	return
+}
+
+func (f *Forward) corsPolicy() *CORS {
+	if f.CORS == nil {
+		f.CORS = &CORS{}
+	}
+	return f.CORS
+}
@@ -0,0 +1,96 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	container := &Container{
+		Forwards: map[string]*Forward{
+			"v100.ds": {Name: "WWW"},
+		},
+	}
+	applyForwardOptions(container, map[string]string{
+		"PD_CORS_ORIGINS_WWW":   "https://a.loc, *.b.loc",
+		"PD_CORS_METHODS":       "GET,POST",
+		"PD_CORS_CREDENTIALS":   "true",
+		"PD_CORS_MAX_AGE_WWW":   "600",
+		"PD_CORS_HEADERS_OTHER": "X-Other",
+	})
+	cors := container.Forwards["v100.ds"].CORS
+	if cors == nil || len(cors.Origins) != 2 || len(cors.Methods) != 2 || !cors.Credentials || cors.MaxAge != 600 || len(cors.Headers) != 0 {
+		t.Errorf("%v", cors)
+		return
+	}
+	{ //preflight
+		req := httptest.NewRequest("OPTIONS", "http://v100.ds/", nil)
+		req.Header.Set("Origin", "https://x.b.loc")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "X-Token")
+		res := httptest.NewRecorder()
+		if !cors.Handle(res, req) || res.Code != http.StatusNoContent {
+			t.Error("error")
+			return
+		}
+		if res.Header().Get("Access-Control-Allow-Origin") != "https://x.b.loc" || res.Header().Get("Access-Control-Allow-Headers") != "X-Token" ||
+			res.Header().Get("Access-Control-Allow-Methods") != "GET, POST" || res.Header().Get("Access-Control-Max-Age") != "600" {
+			t.Errorf("%v", res.Header())
+			return
+		}
+	}
+	{ //simple
+		req := httptest.NewRequest("GET", "http://v100.ds/", nil)
+		req.Header.Set("Origin", "https://a.loc")
+		res := httptest.NewRecorder()
+		if cors.Handle(res, req) || res.Header().Get("Access-Control-Allow-Origin") != "https://a.loc" || res.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("%v", res.Header())
+			return
+		}
+	}
+	{ //not allowed
+		req := httptest.NewRequest("OPTIONS", "http://v100.ds/", nil)
+		req.Header.Set("Origin", "https://c.loc")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		res := httptest.NewRecorder()
+		if !cors.Handle(res, req) || res.Code != http.StatusForbidden || len(res.Header().Get("Access-Control-Allow-Origin")) > 0 {
+			t.Errorf("%v", res.Header())
+			return
+		}
+	}
+	{ //modify
+		res := &http.Response{Header: http.Header{}}
+		res.Header.Set("Access-Control-Allow-Origin", "*")
+		res.Header.Set("Content-Type", "text/plain")
+		cors.ModifyResponse(res)
+		if len(res.Header) != 1 {
+			t.Errorf("%v", res.Header)
+			return
+		}
+	}
+	{ //wildcard with credentials
+		container := &Container{Forwards: map[string]*Forward{"v100.ds": {Name: "WWW"}}}
+		applyForwardOptions(container, map[string]string{
+			"PD_CORS_ORIGINS":     "*, https://a.loc",
+			"PD_CORS_CREDENTIALS": "true",
+		})
+		cors := container.Forwards["v100.ds"].CORS
+		if cors.AllowOrigin("https://c.loc") != "" || cors.AllowOrigin("https://a.loc") != "https://a.loc" {
+			t.Errorf("%v", cors)
+			return
+		}
+		NewDiscover().checkCORS(container)
+		if len(cors.Origins) != 1 || cors.Origins[0] != "https://a.loc" || len(container.Problems) != 1 || container.Problems[0].Label != "PD_CORS_ORIGINS_WWW" {
+			t.Errorf("%v,%v", cors.Origins, container.Problems)
+			return
+		}
+		req := httptest.NewRequest("GET", "http://v100.ds/", nil)
+		req.Header.Set("Origin", "https://c.loc")
+		res := httptest.NewRecorder()
+		if cors.Handle(res, req) || len(res.Header().Get("Access-Control-Allow-Origin")) > 0 || len(res.Header().Get("Access-Control-Allow-Credentials")) > 0 {
+			t.Errorf("%v", res.Header())
+			return
+		}
+	}
+}
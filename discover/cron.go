@@ -0,0 +1,216 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/util/debug"
+)
+
+// Cron is the parsed cron schedule of minute hour day-of-month month day-of-week
+type Cron struct {
+	Text   string
+	minute map[int]bool
+	hour   map[int]bool
+	dom    map[int]bool
+	month  map[int]bool
+	dow    map[int]bool
+	anyDom bool
+	anyDow bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func parseCronField(field string, min, max int) (values map[int]bool, err error) {
+	values = map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				err = fmt.Errorf("invalid step %v", part)
+				return
+			}
+			part = part[:i]
+		}
+		from, to := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			from, err = strconv.Atoi(bounds[0])
+			if err == nil {
+				to, err = strconv.Atoi(bounds[1])
+			}
+		default:
+			from, err = strconv.Atoi(part)
+			to = from
+			if err == nil && step > 1 {
+				to = max
+			}
+		}
+		if err != nil || from < min || to > max || from > to {
+			err = fmt.Errorf("invalid range %v, must be in %v-%v", part, min, max)
+			return
+		}
+		for v := from; v <= to; v += step {
+			values[v] = true
+		}
+	}
+	return
+}
+
+// ParseCron will parse the cron schedule by five fields of minute hour day-of-month month day-of-week
+// or macro of @yearly/@monthly/@weekly/@daily/@hourly, the field supports */list/range/step
+func ParseCron(text string) (cron *Cron, err error) {
+	spec := strings.TrimSpace(text)
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		err = fmt.Errorf("invalid cron %v, must be 5 fields", text)
+		return
+	}
+	cron = &Cron{Text: text, anyDom: fields[2] == "*", anyDow: fields[4] == "*"}
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	values := []*map[int]bool{&cron.minute, &cron.hour, &cron.dom, &cron.month, &cron.dow}
+	for i, field := range fields {
+		*values[i], err = parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			err = fmt.Errorf("invalid cron %v by %v", text, err)
+			return
+		}
+	}
+	if cron.dow[7] {
+		cron.dow[0] = true
+	}
+	return
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dow
+	case c.anyDow:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// Next will return the next schedule time after t, the zero time is returned when it is not found in five years
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if !c.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// nextRestart will return next restart time of cron with random jitter
+func nextRestart(cron *Cron, jitter time.Duration, now time.Time) (next time.Time) {
+	next = cron.Next(now)
+	if !next.IsZero() && jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(jitter))))
+	}
+	return
+}
+
+// callRestartCron will restart the container which is scheduled by PD_RESTART_CRON label, it is skipped on read-only mode
+func (d *Discover) callRestartCron() {
+	defer func() {
+		if xerr := recover(); xerr != nil {
+			ErrorLog("Discover call restart cron panic with %v, call stack is:\n%v", xerr, debug.CallStatck())
+		}
+	}()
+	now := time.Now()
+	services := map[string]*Container{}
+	d.proxyLock.RLock()
+	for _, service := range d.proxyAll {
+		if len(service.RestartCron) > 0 && service.isDocker() {
+			services[service.ID] = service
+		}
+	}
+	d.proxyLock.RUnlock()
+	if d.restartNext == nil {
+		d.restartNext = map[string]time.Time{}
+	}
+	for id := range d.restartNext {
+		if services[id] == nil {
+			delete(d.restartNext, id)
+		}
+	}
+	for id, service := range services {
+		cron, err := ParseCron(service.RestartCron)
+		if err != nil {
+			continue
+		}
+		jitter := service.RestartJitter
+		if jitter <= 0 {
+			jitter = d.RestartJitter
+		}
+		next, ok := d.restartNext[id]
+		if !ok {
+			d.restartNext[id] = nextRestart(cron, jitter, now)
+			continue
+		}
+		if next.IsZero() || now.Before(next) {
+			continue
+		}
+		d.restartNext[id] = nextRestart(cron, jitter, now)
+		if d.IsReadOnly() {
+			InfoLog("Discover audit restart %v/%v by cron %v is skipped on read only", service.Name, id, service.RestartCron)
+			continue
+		}
+		err = d.restartContainer(id)
+		d.recordTrigger("restart_cron", time.Since(now), nil, err)
+		if err != nil {
+			WarnLog("Discover audit restart %v/%v by cron %v fail with %v", service.Name, id, service.RestartCron, err)
+		} else {
+			InfoLog("Discover audit restart %v/%v by cron %v success, next is %v", service.Name, id, service.RestartCron, d.restartNext[id])
+		}
+	}
+}
+
+func (d *Discover) restartContainer(id string) (err error) {
+	cli, _, err := d.newDockerClient()
+	if err != nil {
+		return
+	}
+	timeout := 10 * time.Second
+	err = cli.ContainerRestart(context.Background(), id, &timeout)
+	return
+}
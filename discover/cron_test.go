@@ -0,0 +1,68 @@
+package discover
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	at := func(s string) time.Time {
+		v, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return v
+	}
+	for spec, cases := range map[string][2]string{
+		"30 3 * * *":     {"2021-01-01 10:00", "2021-01-02 03:30"},
+		"@daily":         {"2021-01-01 10:00", "2021-01-02 00:00"},
+		"@hourly":        {"2021-01-01 10:00", "2021-01-01 11:00"},
+		"*/15 * * * *":   {"2021-01-01 10:16", "2021-01-01 10:30"},
+		"0 0 * * 7":      {"2021-01-01 10:00", "2021-01-03 00:00"},
+		"0 0 1 */3 *":    {"2021-02-10 00:00", "2021-04-01 00:00"},
+		"0 9-17/4 * * *": {"2021-01-01 13:00", "2021-01-01 17:00"},
+		"0 0 31 2 *":     {"2021-01-01 00:00", ""},
+		"0 0 13 * 5":     {"2021-01-02 00:00", "2021-01-08 00:00"},
+	} {
+		cron, err := ParseCron(spec)
+		if err != nil {
+			t.Error(spec, err)
+			return
+		}
+		next := cron.Next(at(cases[0]))
+		if cases[1] == "" && !next.IsZero() || cases[1] != "" && !next.Equal(at(cases[1])) {
+			t.Error(spec, next)
+			return
+		}
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * * 0 *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Error(spec)
+			return
+		}
+	}
+	cron, _ := ParseCron("0 * * * *")
+	now := at("2021-01-01 10:10")
+	for i := 0; i < 10; i++ {
+		next := nextRestart(cron, 10*time.Minute, now)
+		if next.Before(at("2021-01-01 11:00")) || !next.Before(at("2021-01-01 11:10")) {
+			t.Error(next)
+			return
+		}
+	}
+	//schedule
+	discover := NewDiscover()
+	discover.SetReadOnly(true)
+	service := &Container{ID: "c1", Name: "ds", RestartCron: "* * * * *", Forwards: map[string]*Forward{"v100.ds": {Prefix: "v100.ds"}}}
+	discover.proxyAll["v100.ds"] = service
+	discover.callRestartCron()
+	next := discover.restartNext["c1"]
+	if next.IsZero() || !next.After(time.Now()) {
+		t.Error(next)
+		return
+	}
+	discover.restartNext["c1"] = time.Now().Add(-time.Second)
+	discover.restartNext["c2"] = time.Now()
+	discover.callRestartCron()
+	if !discover.restartNext["c1"].After(time.Now()) || len(discover.restartNext) != 1 {
+		t.Error(discover.restartNext)
+		return
+	}
+}
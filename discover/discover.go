@@ -2,6 +2,7 @@ package discover
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -9,11 +10,13 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"os/exec"
+	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/codingeasygo/util/converter"
@@ -27,41 +30,183 @@ import (
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/docker/go-connections/tlsconfig"
+	"golang.org/x/crypto/ssh"
 	"golang.org/x/net/websocket"
 )
 
 func copyAndClose(src, dst net.Conn) {
-	io.Copy(dst, src)
+	buffer := copyPool.Get()
+	io.CopyBuffer(dst, src, buffer)
+	copyPool.Put(buffer)
 	dst.Close()
 }
 
 type Forward struct {
-	Name     string `json:"name"`
-	Key      string `json:"key"`
-	Type     string `json:"type"`
-	Prefix   string `json:"prefix"`
-	URI      string `json:"uri"`
-	Wildcard bool   `json:"wildcard"`
+	Name              string        `json:"name"`
+	Key               string        `json:"key"`
+	Type              string        `json:"type"`
+	Prefix            string        `json:"prefix"`
+	URI               string        `json:"uri"`
+	Wildcard          bool          `json:"wildcard"`
+	Scheme            string        `json:"scheme,omitempty"`
+	TLSCA             string        `json:"tls_ca,omitempty"`
+	TLSSkipVerify     bool          `json:"tls_skip_verify,omitempty"`
+	TLSCert           string        `json:"tls_cert,omitempty"`
+	TLSKey            string        `json:"tls_key,omitempty"`
+	UpstreamHost      string        `json:"upstream_host,omitempty"`
+	CORS              *CORS         `json:"cors,omitempty"`
+	MirrorVersion     string        `json:"mirror_version,omitempty"`
+	MirrorPercent     int           `json:"mirror_percent,omitempty"`
+	Default           bool          `json:"default,omitempty"`
+	Aliases           []string      `json:"aliases,omitempty"`
+	Matches           []string      `json:"matches,omitempty"`
+	Hidden            bool          `json:"hidden,omitempty"`
+	GeoAllow          []string      `json:"geo_allow,omitempty"`
+	GeoDeny           []string      `json:"geo_deny,omitempty"`
+	Methods           []string      `json:"methods,omitempty"`
+	ResponseHeaders   []*HeaderRule `json:"response_headers,omitempty"`
+	Shortcut          *Shortcut     `json:"shortcut,omitempty"`
+	Static            *StaticSite   `json:"static,omitempty"`
+	Stream            bool          `json:"stream,omitempty"`
+	WebSocketMax      int           `json:"websocket_max,omitempty"`
+	WebSocketIdle     time.Duration `json:"websocket_idle,omitempty"`
+	WebSocketLifetime time.Duration `json:"websocket_lifetime,omitempty"`
+	WAF               string        `json:"waf,omitempty"`
+	Tenant            string        `json:"tenant,omitempty"`
+	Middlewares       []string      `json:"middlewares,omitempty"`
+	Rewrite           string        `json:"rewrite,omitempty"`
+	Auth              string        `json:"auth,omitempty"`
+	AuthUserHeader    string        `json:"auth_user_header,omitempty"`
+	AuthGroupsHeader  string        `json:"auth_groups_header,omitempty"`
+	MetricsPath       string        `json:"metrics_path,omitempty"`
+	ProbePath         string        `json:"probe_path,omitempty"`
+	ProbeStatus       int           `json:"probe_status,omitempty"`
+	ProbeSLO          time.Duration `json:"probe_slo,omitempty"`
+	CapturePercent    int           `json:"capture_percent,omitempty"`
+}
+
+func (f *Forward) RemoteAddr() (network, address string) {
+	if strings.HasPrefix(f.URI, "unix://") {
+		network, address = "unix", strings.TrimPrefix(f.URI, "unix://")
+		if f.Type == "udp" {
+			network = "unixgram"
+		}
+		return
+	}
+	network, address = f.Type, f.URI
+	if f.Type != "udp" {
+		network = "tcp"
+	}
+	return
 }
 
 func (f *Forward) NewReverseProxy() (proxy *httputil.ReverseProxy, err error) {
-	remote, err := url.Parse(fmt.Sprintf("http://%v", f.URI))
+	network, address := f.RemoteAddr()
+	if network == "unix" {
+		remote, _ := url.Parse("http://unix")
+		dialer := &net.Dialer{}
+		proxy = httputil.NewSingleHostReverseProxy(remote)
+		f.rewriteHost(proxy)
+		proxy.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", address)
+			},
+		}
+		return
+	}
+	scheme := f.Scheme
+	if len(scheme) < 1 {
+		scheme = "http"
+	}
+	remote, err := url.Parse(fmt.Sprintf("%v://%v", scheme, f.URI))
 	if err == nil {
 		proxy = httputil.NewSingleHostReverseProxy(remote)
+		f.rewriteHost(proxy)
 	}
 	return
 }
 
+func (f *Forward) rewriteHost(proxy *httputil.ReverseProxy) {
+	if len(f.UpstreamHost) < 1 || f.UpstreamHost == "preserve" {
+		return
+	}
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		if f.UpstreamHost == "upstream" {
+			req.Host = req.URL.Host
+		} else {
+			req.Host = f.UpstreamHost
+		}
+	}
+}
+
+func isListenPrefix(prefix string) bool {
+	return strings.HasPrefix(prefix, "tcp://") || strings.HasPrefix(prefix, "udp://") || strings.HasPrefix(prefix, "unix://")
+}
+
+func splitUnixLabel(val string) (path, portVal string, ok bool) {
+	index := strings.Index(val, "/unix://")
+	if index < 0 {
+		index = strings.LastIndex(val, "/")
+	}
+	if index < 1 || index == len(val)-1 {
+		return
+	}
+	path, portVal, ok = val[:index], val[index+1:], true
+	return
+}
+
+// inUnixRoots will check if the absolute unix socket path is under one of UnixRoots, the symlinks are resolved and the
+// parent directory is resolved when the socket to listen is not created yet, so the label can't use other host socket
+func (d *Discover) inUnixRoots(name string) bool {
+	if !filepath.IsAbs(name) {
+		return false
+	}
+	real, err := filepath.EvalSymlinks(name)
+	if os.IsNotExist(err) {
+		//the .. is not cleaned before the symlink of parent is resolved
+		dir, base := filepath.Split(name)
+		if base == "" || base == "." || base == ".." {
+			return false
+		}
+		dir, err = filepath.EvalSymlinks(dir)
+		real = filepath.Join(dir, base)
+	}
+	if err != nil {
+		return false
+	}
+	return inRoots(d.UnixRoots, real)
+}
+
 type Container struct {
-	ID         string              `json:"id"`
-	Name       string              `json:"name"`
-	Version    string              `json:"version"`
-	Token      string              `json:"token"`
-	Forwards   map[string]*Forward `json:"forwards"`
-	Status     string              `json:"status"`
-	Error      string              `json:"error"`
-	StartedAt  string              `json:"started_at"`
-	FinishedAt string              `json:"finished_at"`
+	ID            string              `json:"id"`
+	Name          string              `json:"name"`
+	Version       string              `json:"version"`
+	Token         string              `json:"token"`
+	Role          string              `json:"role,omitempty"`
+	Forwards      map[string]*Forward `json:"forwards"`
+	Status        string              `json:"status"`
+	Error         string              `json:"error"`
+	StartedAt     string              `json:"started_at"`
+	FinishedAt    string              `json:"finished_at"`
+	Hooks         map[string]string   `json:"hooks,omitempty"`
+	Tenant        string              `json:"tenant,omitempty"`
+	Quota         string              `json:"quota,omitempty"`
+	RestartCron   string              `json:"restart_cron,omitempty"`
+	RestartJitter time.Duration       `json:"restart_jitter,omitempty"`
+	Health        string              `json:"health,omitempty"`
+	Image         string              `json:"image,omitempty"`
+	ImageID       string              `json:"image_id,omitempty"`
+	Update        string              `json:"update,omitempty"`
+	Problems      []*LabelProblem     `json:"problems,omitempty"`
+	PreviousIDs   []string            `json:"previous_ids,omitempty"`
+	Backend       string              `json:"backend,omitempty"`
+}
+
+// isDocker will return true if the container is discovered from local docker, the agent/nomad/host backend container can't be controlled by docker api
+func (c *Container) isDocker() bool {
+	return len(c.Backend) < 1 || c.Backend == "docker"
 }
 
 type ReverseProxy struct {
@@ -71,52 +216,401 @@ type ReverseProxy struct {
 }
 
 type ListenerProxy struct {
+	Prefix  string
 	Forward *Forward
 	TCP     net.Listener
 	UDP     *net.UDPConn
 	Service *Container
+	lock    sync.RWMutex
+}
+
+func (l *ListenerProxy) Target() (forward *Forward, service *Container) {
+	l.lock.RLock()
+	forward, service = l.Forward, l.Service
+	l.lock.RUnlock()
+	return
+}
+
+func (l *ListenerProxy) Update(forward *Forward, service *Container) {
+	l.lock.Lock()
+	l.Forward, l.Service = forward, service
+	l.lock.Unlock()
+}
+
+func (l *ListenerProxy) Close() (err error) {
+	if l.TCP != nil {
+		err = l.TCP.Close()
+	}
+	if l.UDP != nil {
+		err = l.UDP.Close()
+	}
+	return
 }
 
 type Discover struct {
-	MatchKey         string
-	DockerFinder     string
-	DockerCert       string
-	DockerAddr       string
-	DockerHost       string
-	DockerClearDelay time.Duration
-	DockerClearExc   []string
-	DockerPruneDelay time.Duration
-	DockerPruneExc   []string
-	HostSuff         string
-	HostProto        string
-	HostSelf         string
-	TriggerBash      string
-	SrvPrefix        string
-	Preview          *template.Template
-	clientNew        *client.Client
-	clientHost       string
-	clientLatest     time.Time
-	clientLock       sync.RWMutex
-	proxyAll         map[string]*Container
-	proxyReverse     map[string]*ReverseProxy
-	proxyListen      map[string]*ListenerProxy
-	proxyLock        sync.RWMutex
-	dockerPruneLast  time.Time
-	dockerClearLast  time.Time
-	refreshing       bool
+	MatchKey            string
+	DockerFinder        string
+	DockerCert          string
+	DockerAddr          string
+	DockerHost          string
+	DockerClearDelay    time.Duration
+	DockerClearExc      []string
+	DockerPruneDelay    time.Duration
+	DockerPruneExc      []string
+	DockerRate          float64
+	DockerBurst         int
+	HostSuff            string
+	HostProto           string
+	HostSelf            string
+	TriggerBash         string
+	TriggerMode         string
+	TriggerPowerShell   string
+	TriggerImage        string
+	TriggerNetwork      string
+	TriggerTimeout      time.Duration
+	TriggerTypes        []string
+	TriggerBatch        bool
+	HookTimeout         time.Duration
+	HookHosts           []string
+	HookMaxConns        int
+	SignSecret          string
+	SrvPrefix           string
+	SrvAuthRate         int
+	SrvLockFailures     int
+	SrvLockTime         time.Duration
+	DialTimeout         time.Duration
+	StreamKeepAlive     time.Duration
+	StreamWriteTimeout  time.Duration
+	WebSocketMax        int
+	WebSocketIdle       time.Duration
+	WebSocketLifetime   time.Duration
+	DialRetry           int
+	DialBackoff         time.Duration
+	UDPTimeout          time.Duration
+	ReusePort           bool
+	AltSvc              string
+	Upstream            *Upstream
+	IPPrefer            string
+	DNSResolve          bool
+	DNSServers          []string
+	DNSSearch           []string
+	DNSNdots            int
+	DNSTTL              time.Duration
+	DNSMinTTL           time.Duration
+	SSHTunnel           string
+	SSHKey              string
+	SSHKnownHosts       string
+	WireGuard           string
+	WireGuardConfig     string
+	WireGuardCommand    string
+	WireGuardPeers      map[string]string
+	MaxBodySize         int64
+	MirrorMaxBody       int64
+	MirrorMaxConns      int
+	MirrorTimeout       time.Duration
+	VersionHeader       string
+	VersionCookie       string
+	DefaultVersion      bool
+	Robots              bool
+	UnknownHost         string
+	UnknownTemplate     *template.Template
+	ErrorTemplate       *template.Template
+	Hidden              []string
+	Preview             *template.Template
+	PreviewFile         string
+	PreviewStatic       string
+	StaticRoots         []string
+	UnixRoots           []string
+	TLSRoots            []string
+	MatchDomains        []string
+	AdminPrefix         string
+	AdminToken          string
+	AdminListen         string
+	AdminAllow          []*net.IPNet
+	AdminPprof          bool
+	XDS                 bool
+	RoleTokens          map[string]string
+	SessionSecret       string
+	SessionTTL          time.Duration
+	SessionRefreshTTL   time.Duration
+	LDAP                *LDAP
+	LDAPCatalog         bool
+	Tenants             map[string]*Tenant
+	ServiceQuota        *Quota
+	QuotaMode           string
+	Filters             []ContainerFilter
+	Middlewares         []string
+	BreakerFailures     int
+	BreakerOpenTime     time.Duration
+	BreakerPage         string
+	SlowStart           time.Duration
+	Stats               bool
+	RestartJitter       time.Duration
+	Supervisor          bool
+	SupervisorThreshold int
+	SupervisorBackoff   time.Duration
+	SupervisorMax       int
+	SupervisorHook      string
+	FlapWindow          time.Duration
+	FlapThreshold       int
+	FlapObjective       float64
+	FlapHook            string
+	ProbeInterval       time.Duration
+	ProbeTimeout        time.Duration
+	ProbeThreshold      int
+	ProbeHook           string
+	PrefixCollision     string
+	CollisionHook       string
+	RecreateGrace       time.Duration
+	SubscribeBuffer     int
+	Latency             bool
+	LatencyFile         string
+	CaptureSize         int
+	CaptureMaxBody      int64
+	TapBuffer           int
+	UpgradeURL          string
+	UpgradeVersion      string
+	UpgradeKey          string
+	UpgradeDrain        time.Duration
+	UpdateInterval      time.Duration
+	UpdateHook          string
+	ExportAddr          string
+	StatsD              *StatsD
+	Exports             map[string]string
+	ExportTrigger       string
+	Registries          map[string]*Registry
+	RegistryConfig      string
+	SecretTTL           time.Duration
+	VaultAddr           string
+	VaultToken          string
+	GeoIP               *GeoIP
+	GeoIPHeader         string
+	TrustedProxies      []*net.IPNet
+	WAF                 *WAF
+	ClientAuth          []*ClientAuth
+	SnapshotFile        string
+	ClientCertHeader    string
+	AuthUserHeader      string
+	AuthGroupsHeader    string
+	ConfigItems         []*ConfigItem
+	GoroutineLimit      int
+	FDLimit             int
+	ResourceHook        string
+	ComposeFiles        []string
+	Backends            []string
+	NomadAddr           string
+	NomadToken          string
+	NomadNamespace      string
+	NomadTimeout        time.Duration
+	HostServiceDir      string
+	HostServiceWatch    time.Duration
+	AgentServer         string
+	AgentToken          string
+	AgentName           string
+	AgentHost           string
+	AgentHosts          map[string]string
+	AgentTimeout        time.Duration
+	AgentExpire         time.Duration
+	ComposeCommand      string
+	ComposeHook         string
+	clientNew           *client.Client
+	labelLints          map[string]*LabelLint
+	prefixCollisions    map[string]*PrefixCollision
+	collisionLock       sync.Mutex
+	recreated           map[string]string
+	recreatePending     map[string]time.Time
+	subscribeAll        map[<-chan ChangeEvent]*changeSubscriber
+	subscribeLock       sync.Mutex
+	lintLock            sync.RWMutex
+	clientHost          string
+	clientLocal         bool
+	clientLatest        time.Time
+	clientLock          sync.RWMutex
+	dockerLimiter       *dockerLimiter
+	dockerLimitLock     sync.Mutex
+	dockerCreated       int32
+	proxyAll            map[string]*Container
+	proxyReverse        map[string]*ReverseProxy
+	proxyDefault        map[string]*ReverseProxy
+	previewTime         time.Time
+	previewDir          bool
+	previewLock         sync.Mutex
+	proxyAlias          map[string]*ReverseProxy
+	proxyWarm           map[string]*warmUp
+	proxyPattern        []*hostPattern
+	proxyWildcard       *hostTrie
+	proxyListen         map[string]*ListenerProxy
+	listenConflicts     map[string]*ListenConflict
+	proxyLock           sync.RWMutex
+	transportShared     *http.Transport
+	transportLock       sync.Mutex
+	dockerPruneLast     time.Time
+	dockerClearLast     time.Time
+	refreshing          bool
+	paused              bool
+	readOnly            bool
+	stateLock           sync.RWMutex
+	cycleLock           sync.Mutex
+	refreshStats        RefreshStats
+	refreshStatsLock    sync.Mutex
+	triggerAdded        string
+	triggerRemoved      string
+	triggerUpdated      string
+	triggerStats        map[string]*TriggerStats
+	triggerLock         sync.Mutex
+	quotaExceeded       map[string]string
+	quotaWindows        map[string]*wafWindow
+	quotaLock           sync.Mutex
+	filterLock          sync.RWMutex
+	middlewareAll       map[string]Middleware
+	middlewareLock      sync.RWMutex
+	rewriteCache        map[string][]*RewriteRule
+	rewriteLock         sync.Mutex
+	breakers            map[string]*breakerState
+	breakerLock         sync.Mutex
+	statsAll            map[string]*ResourceStats
+	statsRunning        bool
+	statsLock           sync.RWMutex
+	restartNext         map[string]time.Time
+	superviseAll        map[string]*superviseState
+	flapAll             map[string]*flapState
+	flapLock            sync.Mutex
+	probeAll            map[string]*ProbeStats
+	probeLock           sync.Mutex
+	latencyAll          map[string]*latencyForward
+	latencyDirty        bool
+	latencyLock         sync.Mutex
+	captureAll          []*Capture
+	captureID           int64
+	captureHosts        map[string]int
+	captureLock         sync.Mutex
+	tapAll              map[*tapSubscriber]bool
+	tapCount            int32
+	mirrorRunning       int32
+	hookRunning         int32
+	tapLock             sync.Mutex
+	upgradeServers      []*upgradeServer
+	upgradeLock         sync.Mutex
+	updateLast          time.Time
+	updateRunning       bool
+	updateNotified      map[string]string
+	updateLock          sync.Mutex
+	authAll             map[string]*authState
+	authPruned          time.Time
+	authLock            sync.Mutex
+	secretAll           map[string]SecretProvider
+	secretCache         map[string]*secretCached
+	secretLock          sync.Mutex
+	sessionAll          map[string]*Session
+	sessionSecret       []byte
+	sessionLock         sync.Mutex
+	snapshotLast        []byte
+	snapshotContacted   bool
+	snapshotLock        sync.Mutex
+	resourceHTTP        int32
+	resourceTCP         int32
+	resourceUDP         int32
+	resourceSample      []int
+	resourceRunaway     []string
+	resourceAlerted     time.Time
+	resourceLock        sync.Mutex
+	webSocketAll        map[string]*WebSocketStats
+	webSocketLock       sync.Mutex
+	dnsAll              map[string]*dnsEntry
+	dnsLock             sync.Mutex
+	composeLoaded       map[string]*composeLoaded
+	composeDrift        []*ComposeDrift
+	composeLock         sync.Mutex
+	agents              map[string]*agentState
+	agentStop           chan struct{}
+	agentLock           sync.Mutex
+	sshConn             *ssh.Client
+	sshLock             sync.Mutex
 }
 
 func NewDiscover() (discover *Discover) {
 	discover = &Discover{
-		MatchKey:     "-srv-",
-		TriggerBash:  "bash",
-		SrvPrefix:    "/_s/",
-		clientLock:   sync.RWMutex{},
-		proxyAll:     map[string]*Container{},
-		proxyReverse: map[string]*ReverseProxy{},
-		proxyListen:  map[string]*ListenerProxy{},
-		proxyLock:    sync.RWMutex{},
+		MatchKey:            "-srv-",
+		TriggerBash:         "bash",
+		TriggerMode:         "shell",
+		TriggerPowerShell:   "powershell",
+		TriggerTimeout:      5 * time.Minute,
+		TriggerTypes:        []string{"http"},
+		HookTimeout:         10 * time.Second,
+		HookMaxConns:        16,
+		SrvPrefix:           "/_s/",
+		SrvAuthRate:         30,
+		SrvLockFailures:     5,
+		SrvLockTime:         5 * time.Minute,
+		DockerBurst:         10,
+		DialTimeout:         5 * time.Second,
+		StreamKeepAlive:     15 * time.Second,
+		DNSTTL:              30 * time.Second,
+		DNSNdots:            1,
+		DNSMinTTL:           time.Second,
+		ComposeCommand:      "docker compose",
+		NomadAddr:           "http://127.0.0.1:4646",
+		NomadNamespace:      "*",
+		NomadTimeout:        10 * time.Second,
+		HostServiceDir:      "services.d",
+		HostServiceWatch:    time.Second,
+		AgentTimeout:        10 * time.Second,
+		AgentExpire:         time.Minute,
+		DialRetry:           3,
+		DialBackoff:         100 * time.Millisecond,
+		SecretTTL:           5 * time.Minute,
+		SessionTTL:          15 * time.Minute,
+		SessionRefreshTTL:   24 * time.Hour,
+		WireGuardCommand:    "wg-quick",
+		WireGuardPeers:      map[string]string{},
+		UDPTimeout:          time.Minute,
+		Upstream:            NewUpstream(),
+		MirrorMaxBody:       1024 * 1024,
+		MirrorMaxConns:      16,
+		MirrorTimeout:       10 * time.Second,
+		WAF:                 NewWAF(nil),
+		ClientCertHeader:    "X-PD-Client-Cert",
+		AuthUserHeader:      "X-Auth-User",
+		AuthGroupsHeader:    "X-Auth-Groups",
+		VersionHeader:       "X-PD-Version",
+		VersionCookie:       "pd_version",
+		PreviewStatic:       "/_static/",
+		AdminPrefix:         "/_api/",
+		Robots:              true,
+		UnknownHost:         "catalog",
+		Tenants:             map[string]*Tenant{},
+		Registries:          map[string]*Registry{},
+		ExportAddr:          "127.0.0.1",
+		Exports:             map[string]string{},
+		QuotaMode:           "reject",
+		Middlewares:         append([]string{}, DefaultMiddlewares...),
+		BreakerOpenTime:     10 * time.Second,
+		SupervisorThreshold: 3,
+		SupervisorBackoff:   10 * time.Second,
+		SupervisorMax:       5,
+		FlapWindow:          10 * time.Minute,
+		FlapThreshold:       5,
+		FlapObjective:       0.99,
+		ProbeTimeout:        5 * time.Second,
+		ProbeThreshold:      3,
+		PrefixCollision:     CollisionNewest,
+		SubscribeBuffer:     1024,
+		CaptureSize:         100,
+		CaptureMaxBody:      64 * 1024,
+		TapBuffer:           100,
+		UpgradeDrain:        30 * time.Second,
+		clientLock:          sync.RWMutex{},
+		proxyAll:            map[string]*Container{},
+		proxyReverse:        map[string]*ReverseProxy{},
+		proxyDefault:        map[string]*ReverseProxy{},
+		proxyAlias:          map[string]*ReverseProxy{},
+		proxyWildcard:       newHostTrie(),
+		proxyListen:         map[string]*ListenerProxy{},
+		proxyLock:           sync.RWMutex{},
+		rewriteCache:        map[string][]*RewriteRule{},
 	}
+	discover.registerBuiltinMiddlewares()
+	discover.registerBuiltinSecrets()
 	return
 }
 
@@ -134,10 +628,16 @@ func (d *Discover) newDockerClient() (cli *client.Client, remoteHost string, err
 	dockerCert, dockerAddr := d.DockerCert, d.DockerAddr
 	remoteHost = d.DockerHost
 	if len(d.DockerFinder) > 0 {
-		info, xerr := exec.Command(d.TriggerBash, d.DockerFinder).Output()
+		cmd, xerr := d.newTriggerCommand(d.DockerFinder)
+		if xerr != nil {
+			err = xerr
+			ErrorLog("Discover call finder fail with %v by mode:%v,finder:%v", err, d.TriggerMode, d.DockerFinder)
+			return
+		}
+		info, xerr := cmd.Output()
 		if xerr != nil {
 			err = xerr
-			ErrorLog("Discover call finder fail with %v by bash:%v,finder:%v", err, d.TriggerBash, d.DockerFinder)
+			ErrorLog("Discover call finder fail with %v by mode:%v,bash:%v,finder:%v", err, d.TriggerMode, d.TriggerBash, d.DockerFinder)
 			return
 		}
 		conf := xprop.NewConfig()
@@ -159,18 +659,28 @@ func (d *Discover) newDockerClient() (cli *client.Client, remoteHost string, err
 		return
 	}
 	httpClient := &http.Client{
-		Transport:     &http.Transport{TLSClientConfig: tlsc},
+		Transport:     d.limitDocker(&http.Transport{TLSClientConfig: tlsc}),
 		CheckRedirect: client.CheckRedirect,
 	}
 	cli, err = client.NewClientWithOpts(client.WithHTTPClient(httpClient), client.WithHost(dockerAddr))
 	if err == nil {
 		d.clientNew = cli
+		atomic.AddInt32(&d.dockerCreated, 1)
 		d.clientHost = remoteHost
+		d.clientLocal = len(dockerAddr) < 1 || strings.HasPrefix(dockerAddr, "unix://") || strings.HasPrefix(dockerAddr, "npipe://")
 		d.clientLatest = time.Now()
 	}
 	return
 }
 
+// isLocalDocker will check if the docker is connected by local unix socket or named pipe, so the container mounts is
+// the path on pdservice host
+func (d *Discover) isLocalDocker() bool {
+	d.clientLock.RLock()
+	defer d.clientLock.RUnlock()
+	return d.clientLocal
+}
+
 func (d *Discover) Prune() (err error) {
 	if d.DockerPruneDelay < 1 {
 		return
@@ -279,40 +789,62 @@ func (d *Discover) Refresh() (all, added, updated, removed map[string]*Container
 	if err != nil {
 		return
 	}
+	all = d.applyFilters(all)
+	d.snapshotLock.Lock()
+	d.snapshotContacted = true
+	d.snapshotLock.Unlock()
+	added, updated, removed = d.applyProxy(all)
+	return
+}
+
+// applyProxy will update the proxy table by all services, the changed forwards are returned
+func (d *Discover) applyProxy(all map[string]*Container) (added, updated, removed map[string]*Container) {
 	d.proxyLock.Lock()
 	defer d.proxyLock.Unlock()
 	added = map[string]*Container{}
 	updated = map[string]*Container{}
 	removed = map[string]*Container{}
 	oldAll := d.proxyAll
+	d.applyQuota(all, oldAll)
+	for prefix, service := range all {
+		if old, ok := oldAll[prefix]; ok {
+			d.linkRecreated(old, service)
+		}
+		delete(d.recreatePending, prefix)
+	}
 	newAll := map[string]*Container{}
+	conflicts := map[string]*ListenConflict{}
 	procReverse := func(newForward *Forward, service *Container) {
-		host := newForward.Prefix + d.HostSuff
+		host := d.hostOf(newForward.Tenant, newForward.Prefix)
 		if old, ok := oldAll[newForward.Prefix]; ok {
-			if oldForward, ok := old.Forwards[newForward.Prefix]; ok && oldForward.URI != newForward.URI { //updated
-				proxy, xerr := newForward.NewReverseProxy()
+			if oldForward, ok := old.Forwards[newForward.Prefix]; ok && !reflect.DeepEqual(oldForward, newForward) { //updated
+				proxy, xerr := d.newReverseProxy(newForward)
 				if xerr != nil {
 					WarnLog("Discover update %v for service updated fail with %v", host, xerr)
 					return
 				}
 				d.proxyReverse[host] = &ReverseProxy{Reverse: proxy, Service: service, Forward: newForward}
+				d.resetBreaker(newForward.Prefix)
 				updated[newForward.Prefix] = service
 				InfoLog("Discover update %v for service updated", host)
+			} else if reverse := d.proxyReverse[host]; ok && reverse != nil && reverse.Service != service { //not changed or recreated, keep proxy
+				d.proxyReverse[host] = &ReverseProxy{Reverse: reverse.Reverse, Service: service, Forward: reverse.Forward}
 			}
 		} else { //new
-			proxy, xerr := newForward.NewReverseProxy()
+			proxy, xerr := d.newReverseProxy(newForward)
 			if xerr != nil {
 				WarnLog("Discover update %v for service up fail with %v", host, xerr)
 				return
 			}
 			d.proxyReverse[host] = &ReverseProxy{Reverse: proxy, Service: service, Forward: newForward}
+			d.resetBreaker(newForward.Prefix)
 			added[newForward.Prefix] = service
 			InfoLog("Discover add %v for service up", host)
 		}
 		newAll[newForward.Prefix] = service
 	}
 	removeReverse := func(oldForward *Forward, service *Container) {
-		host := oldForward.Prefix + d.HostSuff
+		host := d.hostOf(oldForward.Tenant, oldForward.Prefix)
 		if _, ok := all[oldForward.Prefix]; !ok { //deleted
 			delete(d.proxyReverse, host)
 			removed[oldForward.Prefix] = service
@@ -321,38 +853,41 @@ func (d *Discover) Refresh() (all, added, updated, removed map[string]*Container
 	}
 	procListen := func(newForward *Forward, service *Container) {
 		if old, ok := oldAll[newForward.Prefix]; ok {
-			if oldForward, ok := old.Forwards[newForward.Prefix]; ok && oldForward.URI == newForward.URI { //updated
+			if oldForward, ok := old.Forwards[newForward.Prefix]; ok && reflect.DeepEqual(oldForward, newForward) { //not changed
+				if ln, ok := d.proxyListen[newForward.Prefix]; ok {
+					ln.Update(newForward, service)
+				}
 				newAll[newForward.Prefix] = service
 				return
 			}
 		}
-		switch newForward.Type {
-		case "tcp":
-			if d.removeTCP(newForward) {
-				updated[newForward.Prefix] = service
-			} else {
-				added[newForward.Prefix] = service
-			}
-			go d.procTCP(newForward, service)
+		if ln, ok := d.proxyListen[newForward.Prefix]; ok { //updated, swap target and keep listener
+			ln.Update(newForward, service)
+			updated[newForward.Prefix] = service
 			newAll[newForward.Prefix] = service
+			InfoLog("Discover forward %v://%v is updated to %v://%v", newForward.Type, newForward.Prefix, newForward.Type, newForward.URI)
+			return
+		}
+		var xerr error
+		switch newForward.Type {
+		case "tcp", "unix":
+			xerr = d.listenTCP(newForward, service)
 		case "udp":
-			if d.removeUDP(newForward) {
-				updated[newForward.Prefix] = service
-			} else {
-				added[newForward.Prefix] = service
+			xerr = d.listenUDP(newForward, service)
+		}
+		if xerr != nil {
+			WarnLog("Discover forward %v://%v=>%v://%v is fail with %v", newForward.Type, newForward.Prefix, newForward.Type, newForward.URI, xerr)
+			if IsAddrInUse(xerr) {
+				d.addConflict(conflicts, newForward, service, xerr)
 			}
-			go d.procUDP(newForward, service)
-			newAll[newForward.Prefix] = service
+			return
 		}
+		added[newForward.Prefix] = service
+		newAll[newForward.Prefix] = service
 	}
 	removeListen := func(oldForward *Forward, service *Container) {
-		switch oldForward.Type {
-		case "tcp":
-			removed[oldForward.Prefix] = service
-			d.removeTCP(oldForward)
-		case "udp":
+		if d.removeListen(oldForward) {
 			removed[oldForward.Prefix] = service
-			d.removeUDP(oldForward)
 		}
 	}
 	for prefix, service := range all {
@@ -360,29 +895,108 @@ func (d *Discover) Refresh() (all, added, updated, removed map[string]*Container
 			switch newForward.Type {
 			case "http":
 				procReverse(newForward, service)
-			case "tcp", "udp":
+			case "tcp", "udp", "unix":
 				procListen(newForward, service)
 			}
 		}
 	}
+	now := time.Now()
 	for prefix, service := range oldAll {
 		if _, ok := newAll[prefix]; ok {
 			continue
 		}
+		if _, ok := all[prefix]; !ok && d.keepRecreating(prefix, service, now) {
+			newAll[prefix] = service
+			continue
+		}
 		if oldForward, ok := service.Forwards[prefix]; ok {
 			switch oldForward.Type {
 			case "http":
 				removeReverse(oldForward, service)
-			case "tcp", "udp":
+			case "tcp", "udp", "unix":
 				removeListen(oldForward, service)
 			}
 		}
 	}
 	d.proxyAll = newAll
+	d.listenConflicts = conflicts
+	d.rebuildDefault()
+	d.rebuildAlias()
+	d.rebuildWildcard()
+	d.rebuildPattern()
+	d.publishChanges(added, updated, removed)
 	return
 }
 
+// Discove will discover the running services of all Backends, the service is parsed by PD_* labels
 func (d *Discover) Discove() (containers map[string]*Container, err error) {
+	containers = map[string]*Container{}
+	candidates := map[string][]*Container{}
+	parsed := []*Container{}
+	backends := d.Backends
+	if len(backends) < 1 {
+		backends = []string{"docker"}
+	}
+	for _, backend := range backends {
+		var found, proxied []*Container
+		switch backend {
+		case "docker":
+			found, proxied, err = d.discoveDocker()
+		case "nomad":
+			found, proxied, err = d.discoveNomad()
+		case "host":
+			found, proxied, err = d.discoveHost()
+		case "agent":
+			found, proxied, err = d.discoveAgent()
+		default:
+			err = fmt.Errorf("backend %v is not supported", backend)
+		}
+		if err != nil {
+			return
+		}
+		for _, container := range proxied {
+			for prefix := range container.Forwards {
+				candidates[prefix] = append(candidates[prefix], container)
+			}
+		}
+		parsed = append(parsed, found...)
+	}
+	d.resolveCollisions(candidates, containers)
+	lints := map[string]*LabelLint{}
+	for _, container := range parsed {
+		if len(container.Problems) > 0 {
+			lints[container.ID] = newLabelLint(container)
+		}
+	}
+	d.lintLock.Lock()
+	d.labelLints = lints
+	d.lintLock.Unlock()
+	return
+}
+
+// discoveDocker will discover the running containers of docker, the parsed is all matched containers and the proxied is
+// the containers which is ok to proxy
+func (d *Discover) discoveDocker() (parsed, proxied []*Container, err error) {
+	inspects, remoteHost, err := d.listDocker()
+	if err != nil {
+		return
+	}
+	local := d.isLocalDocker()
+	for _, inspect := range inspects {
+		container, ok := d.parseContainer(inspect, remoteHost, local)
+		if container == nil {
+			continue
+		}
+		if ok {
+			proxied = append(proxied, container)
+		}
+		parsed = append(parsed, container)
+	}
+	return
+}
+
+// listDocker will inspect the running containers which is matched by name on docker
+func (d *Discover) listDocker() (inspects []types.ContainerJSON, remoteHost string, err error) {
 	cli, remoteHost, err := d.newDockerClient()
 	if err != nil {
 		return
@@ -394,7 +1008,6 @@ func (d *Discover) Discove() (containers map[string]*Container, err error) {
 	if err != nil {
 		return
 	}
-	containers = map[string]*Container{}
 	for _, c := range containerList {
 		if c.State != "running" {
 			continue
@@ -404,91 +1017,230 @@ func (d *Discover) Discove() (containers map[string]*Container, err error) {
 			err = xerr
 			return
 		}
-		name := strings.TrimPrefix(inspect.Name, "/")
-		nameParts := strings.SplitN(name, d.MatchKey, 2)
-		verParts := strings.SplitN(nameParts[1], "-", 2)
-		container := &Container{
-			ID:         c.ID,
-			Name:       nameParts[0],
-			Version:    verParts[0],
-			Forwards:   map[string]*Forward{},
-			Status:     inspect.State.Status,
-			Error:      inspect.State.Error,
-			StartedAt:  inspect.State.StartedAt,
-			FinishedAt: inspect.State.FinishedAt,
-		}
-		for key, val := range inspect.Config.Labels {
-			if key == "PD_SERVICE_TOKEN" {
-				container.Token = val
+		inspects = append(inspects, inspect)
+	}
+	return
+}
+
+// parseContainer will parse the container and forwards by PD_* labels, the label problems are recorded to container,
+// the container is not ok to proxy when it is not matched by name or the tenant is invalid, the localMounts is true when
+// the mount source of container is the path on pdservice host
+func (d *Discover) parseContainer(inspect types.ContainerJSON, remoteHost string, localMounts bool) (container *Container, ok bool) {
+	name := strings.TrimPrefix(inspect.Name, "/")
+	nameParts := strings.SplitN(name, d.MatchKey, 2)
+	if len(nameParts) < 2 || inspect.Config == nil || inspect.State == nil {
+		return
+	}
+	verParts := strings.SplitN(nameParts[1], "-", 2)
+	labels, xerr := expandLabels(inspect.Config.Labels)
+	container = &Container{
+		ID:         inspect.ID,
+		Name:       nameParts[0],
+		Version:    verParts[0],
+		Forwards:   map[string]*Forward{},
+		Status:     inspect.State.Status,
+		Error:      inspect.State.Error,
+		StartedAt:  inspect.State.StartedAt,
+		FinishedAt: inspect.State.FinishedAt,
+		Tenant:     labels["PD_TENANT"],
+	}
+	if xerr != nil {
+		container.addProblem("PD_CONFIG", "", "%v", xerr)
+	}
+	container.Image = inspect.Config.Image
+	container.ImageID = inspect.Image
+	if inspect.State.Health != nil {
+		container.Health = inspect.State.Health.Status
+	}
+	if len(container.Tenant) > 0 && !ValidTenant(container.Tenant) {
+		container.addProblem("PD_TENANT", container.Tenant, "tenant is invalid")
+		return
+	}
+	if len(d.Tenants) > 0 && strings.Contains(container.Name, ".") {
+		container.addProblem("", container.Name, "name must not contain ., it is used as host label")
+		return
+	}
+	var ports nat.PortMap
+	if inspect.NetworkSettings != nil {
+		ports = inspect.NetworkSettings.Ports
+	}
+	lookupURI := func(key, val, portVal string) (uri string, ok bool) {
+		if strings.HasPrefix(portVal, "unix://") {
+			if !d.inUnixRoots(strings.TrimPrefix(portVal, "unix://")) {
+				container.addProblem(key, val, "unix socket is not under unix_roots")
+				return
+			}
+			uri, ok = portVal, true
+			return
+		}
+		portKey := fmt.Sprintf("%v/tcp", strings.TrimPrefix(portVal, ":"))
+		binding, found := d.selectBinding(ports[nat.Port(portKey)])
+		if !found {
+			container.addProblem(key, val, "port %v is not published, all is %v", portKey, converter.JSON(ports))
+			return
+		}
+		uri, ok = joinHost(d.wireguardHost(remoteHost), binding.HostPort), true
+		return
+	}
+	for key, val := range labels {
+		if key == "PD_SERVICE_TOKEN" {
+			if d.IsSecretRef(val) {
+				container.addProblem(key, "", "secret reference is not allowed in label, use plain or hashed token")
 				continue
 			}
-			var forward *Forward
-			if strings.HasPrefix(key, "PD_HOST_") {
-				hostKey := ""
-				portVal := ""
-				valParts := strings.SplitN(val, "/", 2)
-				if len(valParts) == 2 {
-					hostKey = valParts[0]
-					portVal = valParts[1]
-				} else {
-					portVal = valParts[0]
-				}
-				portKey := fmt.Sprintf("%v/tcp", strings.TrimPrefix(portVal, ":"))
-				portMap := inspect.NetworkSettings.Ports[nat.Port(portKey)]
-				if portMap == nil {
-					WarnLog("Discover parse container %v lable %v=%v fail with %v, all is %v", name, key, val, "port is not found", converter.JSON(inspect.NetworkSettings.Ports))
-					continue
-				}
-				hostPort := portMap[0].HostPort
-				forward = &Forward{
-					Name: strings.TrimPrefix(key, "PD_HOST_"),
-					Type: "http",
-					Key:  hostKey,
-					URI:  fmt.Sprintf("%v:%v", remoteHost, hostPort),
-				}
-				if strings.HasPrefix(hostKey, "*") {
-					hostKey = strings.TrimPrefix(hostKey, "*")
-					forward.Wildcard = true
-				}
-				if len(hostKey) > 0 {
-					forward.Prefix = fmt.Sprintf("%v.%v.%v", hostKey, strings.ReplaceAll(container.Version, ".", ""), container.Name)
-				} else {
-					forward.Prefix = fmt.Sprintf("%v.%v", strings.ReplaceAll(container.Version, ".", ""), container.Name)
-				}
-			} else if strings.HasPrefix(key, "PD_TCP_") || strings.HasPrefix(key, "PD_UDP_") {
-				valParts := strings.SplitN(val, "/", 2)
-				if len(valParts) != 2 {
-					WarnLog("Discover parse container %v lable %v=%v fail with %v, all is %v", name, key, val, "value is invalid", converter.JSON(inspect.NetworkSettings.Ports))
-					continue
-				}
-				hostKey := valParts[0]
-				portVal := valParts[1]
-				portKey := fmt.Sprintf("%v/tcp", strings.TrimPrefix(portVal, ":"))
-				portMap := inspect.NetworkSettings.Ports[nat.Port(portKey)]
-				if portMap == nil {
-					WarnLog("Discover parse container %v lable %v=%v fail with %v, all is %v", name, key, val, "port is not found", converter.JSON(inspect.NetworkSettings.Ports))
-					continue
-				}
-				hostPort := portMap[0].HostPort
-				forward = &Forward{
-					Key: hostKey,
-					URI: fmt.Sprintf("%v:%v", remoteHost, hostPort),
-				}
-				if strings.HasPrefix(key, "PD_TCP_") {
-					forward.Name = strings.TrimPrefix(key, "PD_TCP_")
-					forward.Type = "tcp"
-				} else {
-					forward.Name = strings.TrimPrefix(key, "PD_UDP_")
-					forward.Type = "udp"
-				}
-				forward.Prefix = fmt.Sprintf("%v://%v", forward.Type, forward.Key)
+			if xerr := ValidToken(val); xerr != nil {
+				container.addProblem(key, "", "%v", xerr)
+				continue
+			}
+			container.Token = val
+			continue
+		}
+		if key == "PD_TENANT" || key == "PD_CONFIG" {
+			continue
+		}
+		if key == "PD_SERVICE_ROLE" {
+			if val != RoleViewer && val != RoleOperator {
+				container.addProblem(key, val, "must be viewer or operator")
+			} else {
+				container.Role = val
+			}
+			continue
+		}
+		if key == "PD_RESTART_CRON" {
+			if _, xerr := ParseCron(val); xerr != nil {
+				container.addProblem(key, val, "%v", xerr)
+			} else {
+				container.RestartCron = val
 			}
-			if forward != nil {
-				container.Forwards[forward.Prefix] = forward
-				containers[forward.Prefix] = container
+			continue
+		}
+		if key == "PD_UPDATE" {
+			if val != "notify" && val != "redeploy" {
+				container.addProblem(key, val, "must be notify or redeploy")
+			} else {
+				container.Update = val
+			}
+			continue
+		}
+		if key == "PD_RESTART_JITTER" {
+			if jitter, xerr := time.ParseDuration(val); xerr != nil {
+				container.addProblem(key, val, "%v", xerr)
+			} else {
+				container.RestartJitter = jitter
 			}
+			continue
+		}
+		if strings.HasPrefix(key, "PD_HOOK_") {
+			container.addHook(strings.TrimPrefix(key, "PD_HOOK_"), val)
+			continue
+		}
+		var forward *Forward
+		if strings.HasPrefix(key, "PD_HOST_") {
+			hostKey := ""
+			portVal := ""
+			valParts := strings.SplitN(val, "/", 2)
+			if len(valParts) == 2 && !strings.HasPrefix(val, "unix://") {
+				hostKey = valParts[0]
+				portVal = valParts[1]
+			} else {
+				portVal = val
+			}
+			scheme, portVal, xerr := splitScheme(portVal)
+			if xerr != nil {
+				container.addProblem(key, val, "%v", xerr)
+				continue
+			}
+			uri, ok := "", true
+			if len(portVal) > 0 || !skipPort(labels, strings.TrimPrefix(key, "PD_HOST_")) {
+				uri, ok = lookupURI(key, val, portVal)
+			}
+			if !ok {
+				continue
+			}
+			forward = &Forward{
+				Name:   strings.TrimPrefix(key, "PD_HOST_"),
+				Type:   "http",
+				Key:    hostKey,
+				URI:    uri,
+				Scheme: scheme,
+			}
+			if strings.HasPrefix(hostKey, "*") {
+				hostKey = strings.TrimPrefix(hostKey, "*")
+				forward.Wildcard = true
+			}
+			if len(hostKey) > 0 {
+				forward.Prefix = fmt.Sprintf("%v.%v.%v", hostKey, strings.ReplaceAll(container.Version, ".", ""), container.Name)
+			} else {
+				forward.Prefix = fmt.Sprintf("%v.%v", strings.ReplaceAll(container.Version, ".", ""), container.Name)
+			}
+			if len(container.Tenant) > 0 {
+				forward.Prefix = fmt.Sprintf("%v.%v", forward.Prefix, container.Tenant)
+			}
+		} else if strings.HasPrefix(key, "PD_TCP_") || strings.HasPrefix(key, "PD_UDP_") {
+			valParts := strings.SplitN(val, "/", 2)
+			if len(valParts) != 2 {
+				container.addProblem(key, val, "value is invalid, must be <listen>/<port>")
+				continue
+			}
+			hostKey := valParts[0]
+			portVal := valParts[1]
+			uri, ok := lookupURI(key, val, portVal)
+			if !ok {
+				continue
+			}
+			forward = &Forward{
+				Key: hostKey,
+				URI: uri,
+			}
+			if strings.HasPrefix(key, "PD_TCP_") {
+				forward.Name = strings.TrimPrefix(key, "PD_TCP_")
+				forward.Type = "tcp"
+			} else {
+				forward.Name = strings.TrimPrefix(key, "PD_UDP_")
+				forward.Type = "udp"
+			}
+			forward.Prefix = fmt.Sprintf("%v://%v", forward.Type, forward.Key)
+		} else if strings.HasPrefix(key, "PD_UNIX_") {
+			path, portVal, ok := splitUnixLabel(val)
+			if !ok {
+				container.addProblem(key, val, "value is invalid, must be <path>/<port>")
+				continue
+			}
+			if !d.inUnixRoots(path) {
+				container.addProblem(key, val, "unix socket is not under unix_roots")
+				continue
+			}
+			uri, ok := lookupURI(key, val, portVal)
+			if !ok {
+				continue
+			}
+			forward = &Forward{
+				Name: strings.TrimPrefix(key, "PD_UNIX_"),
+				Type: "unix",
+				Key:  path,
+				URI:  uri,
+			}
+			forward.Prefix = fmt.Sprintf("%v://%v", forward.Type, forward.Key)
+		} else if strings.HasPrefix(key, "PD_") && !isOptionLabel(key) {
+			container.addProblem(key, val, "label is unknown")
+		}
+		if forward != nil && forward.Type == "http" && len(container.Tenant) < 1 && d.isTenantPrefix(forward.Prefix) {
+			container.addProblem(key, val, "prefix %v is in the namespace of tenant", forward.Prefix)
+			forward = nil
+		}
+		if forward != nil {
+			forward.Tenant = container.Tenant
+			container.Forwards[forward.Prefix] = forward
 		}
 	}
+	applyForwardOptions(container, labels)
+	d.checkAliases(container)
+	d.checkMatches(container)
+	d.checkForwardMiddlewares(container)
+	d.checkTLSFiles(container)
+	d.checkCORS(container)
+	d.resolveStatic(container, inspect.Mounts, localMounts)
+	ok = true
 	return
 }
 
@@ -546,6 +1298,13 @@ func (d *Discover) procDockerControl(w http.ResponseWriter, r *http.Request, ser
 		failResult(err)
 		return
 	}
+	tenantContainers := []types.Container{}
+	for _, container := range containers {
+		if labelTenant(container.Labels) == service.Tenant {
+			tenantContainers = append(tenantContainers, container)
+		}
+	}
+	containers = tenantContainers
 	accessResult := func() bool {
 		access := false
 		for _, container := range containers {
@@ -608,11 +1367,20 @@ func (d *Discover) procServer(w http.ResponseWriter, r *http.Request, service *C
 		fmt.Fprintf(w, "unauthorized")
 		return
 	}
-	if username != service.Name || password != service.Token {
+	//the ip is RemoteAddr or the client ip resolved by trusted_proxies, so the lockout can't be bypassed by forged header
+	ip := d.clientIP(r).String()
+	if allow, retry := d.checkAuth(ip, service.Name); !allow {
+		WarnLog("Discover audit authentication of %v from %v is limited", service.Name, ip)
+		d.procAuthLimited(w, retry)
+		return
+	}
+	if username != service.Name || !VerifyToken(service.Token, password) {
+		d.doneAuth(ip, service.Name, false)
 		w.WriteHeader(http.StatusUnauthorized)
 		fmt.Fprintf(w, "invalid password")
 		return
 	}
+	d.doneAuth(ip, service.Name, true)
 	r.ParseForm()
 	containerID := r.FormValue("id")
 	if len(containerID) < 1 {
@@ -620,122 +1388,335 @@ func (d *Discover) procServer(w http.ResponseWriter, r *http.Request, service *C
 	}
 	path := strings.TrimPrefix(r.URL.Path, d.SrvPrefix)
 	path = strings.Trim(path, "/")
+	role := service.Role
+	if len(role) < 1 {
+		role = RoleOperator
+	}
+	if _, known := rolePermissions[path]; known && !roleAllow(role, path) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "forbidden")
+		return
+	}
+	if strings.HasPrefix(path, "docker/") && !service.isDocker() {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "service %v is on %v backend, %v is only supported on docker", service.Name, service.Backend, path)
+		return
+	}
 	switch path {
 	case "docker/logs":
+		if err := d.checkTenantContainer(service, containerID); err != nil {
+			WarnLog("Discover proc %v container log fail with %v", service.Name, err)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "%v", err)
+			return
+		}
 		d.procDockerLogs(w, r, service, containerID)
-	case "docker/start", "docker/stop", "docker/restart", "docker/ps":
+	case "docker/start", "docker/stop", "docker/restart":
+		if d.IsReadOnly() {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "read only")
+			return
+		}
+		d.procDockerControl(w, r, service, path, containerID)
+	case "docker/ps":
 		d.procDockerControl(w, r, service, path, containerID)
 	default:
 		http.NotFound(w, r)
 	}
 }
 
-func (d *Discover) removeUDP(forward *Forward) (removed bool) {
+func (d *Discover) removeListen(forward *Forward) (removed bool) {
 	if ln, ok := d.proxyListen[forward.Prefix]; ok {
-		ln.UDP.Close()
+		ln.Close()
 		delete(d.proxyListen, forward.Prefix)
 		removed = true
 	}
 	return
 }
 
-func (d *Discover) procUDP(forward *Forward, service *Container) (err error) {
-	addr, err := net.ResolveUDPAddr(forward.Type, forward.Key)
-	if err != nil {
-		WarnLog("Discover forward %v://%v=>%v://%v is fail with %v", forward.Type, forward.Prefix, forward.Type, forward.URI, err)
-		return
+func (d *Discover) doneListen(ln *ListenerProxy) {
+	d.proxyLock.Lock()
+	if d.proxyListen[ln.Prefix] == ln {
+		delete(d.proxyListen, ln.Prefix)
 	}
-	local, err := net.ListenUDP(forward.Type, addr)
+	d.proxyLock.Unlock()
+}
+
+func (d *Discover) listenUDP(forward *Forward, service *Container) (err error) {
+	conn, err := ListenPacket(forward.Type, forward.Key, d.ReusePort)
 	if err != nil {
-		WarnLog("Discover forward %v://%v=>%v://%v is fail with %v", forward.Type, forward.Prefix, forward.Type, forward.URI, err)
 		return
 	}
-	remote, err := net.Dial(forward.Type, forward.URI)
-	if err != nil {
-		WarnLog("Discover forward %v://%v=>%v://%v is fail with %v", forward.Type, forward.Prefix, forward.Type, forward.URI, err)
+	local, ok := conn.(*net.UDPConn)
+	if !ok {
+		conn.Close()
+		err = fmt.Errorf("%v is not udp socket", forward.Key)
 		return
 	}
-	InfoLog("Discover forward %v://%v=>%v://%v is started on %v", forward.Type, forward.Prefix, forward.Type, forward.URI, addr)
-	d.proxyListen[forward.Prefix] = &ListenerProxy{UDP: local, Service: service, Forward: forward}
-	defer func() {
+	ln := &ListenerProxy{Prefix: forward.Prefix, UDP: local, Service: service, Forward: forward}
+	d.proxyListen[forward.Prefix] = ln
+	InfoLog("Discover forward %v://%v=>%v://%v is started on %v", forward.Type, forward.Prefix, forward.Type, forward.URI, local.LocalAddr())
+	go d.procUDP(ln)
+	return
+}
+
+func (d *Discover) procUDP(ln *ListenerProxy) {
+	defer d.doneListen(ln)
+	sessionAll := map[string]net.Conn{}
+	sessionLock := sync.Mutex{}
+	buffer := packetPool.Get()
+	defer packetPool.Put(buffer)
+	for {
+		n, from, err := ln.UDP.ReadFromUDP(buffer)
+		if err != nil {
+			break
+		}
+		key := from.String()
+		sessionLock.Lock()
+		remote := sessionAll[key]
+		sessionLock.Unlock()
+		if remote == nil {
+			forward, _ := ln.Target()
+			network, address := forward.RemoteAddr()
+			remote, err = d.dialResolved(network, address)
+			if err != nil {
+				WarnLog("Discover dial to %v://%v fail with %v", forward.Type, forward.URI, err)
+				d.StatsD.Count("connection.error", 1, "type:"+forward.Type, "forward:"+forward.Prefix)
+				continue
+			}
+			d.StatsD.Count("connection", 1, "type:"+forward.Type, "forward:"+forward.Prefix)
+			sessionLock.Lock()
+			sessionAll[key] = remote
+			sessionLock.Unlock()
+			go func(key string, remote net.Conn, from *net.UDPAddr) {
+				atomic.AddInt32(&d.resourceUDP, 1)
+				d.procUDPSession(ln.UDP, remote, from)
+				atomic.AddInt32(&d.resourceUDP, -1)
+				sessionLock.Lock()
+				delete(sessionAll, key)
+				sessionLock.Unlock()
+			}(key, remote, from)
+		}
+		remote.Write(buffer[:n])
+	}
+	sessionLock.Lock()
+	for _, remote := range sessionAll {
 		remote.Close()
-		local.Close()
-		delete(d.proxyListen, forward.Prefix)
-	}()
-	go copyAndClose(local, remote)
-	copyAndClose(remote, local)
+	}
+	sessionLock.Unlock()
+	forward, _ := ln.Target()
 	InfoLog("Discover forward %v://%v=>%v://%v is stopped", forward.Type, forward.Prefix, forward.Type, forward.URI)
-	return
 }
 
-func (d *Discover) removeTCP(forward *Forward) (removed bool) {
-	if ln, ok := d.proxyListen[forward.Prefix]; ok {
-		ln.TCP.Close()
-		delete(d.proxyListen, forward.Prefix)
-		removed = true
+func (d *Discover) procUDPSession(local *net.UDPConn, remote net.Conn, from *net.UDPAddr) {
+	defer remote.Close()
+	buffer := packetPool.Get()
+	defer packetPool.Put(buffer)
+	for {
+		remote.SetReadDeadline(time.Now().Add(d.UDPTimeout))
+		n, err := remote.Read(buffer)
+		if err != nil {
+			break
+		}
+		local.WriteToUDP(buffer[:n], from)
 	}
-	return
 }
 
-func (d *Discover) procTCP(forward *Forward, service *Container) (err error) {
-	ln, err := net.Listen(forward.Type, forward.Key)
+func (d *Discover) listenTCP(forward *Forward, service *Container) (err error) {
+	local, err := Listen(forward.Type, forward.Key, d.ReusePort)
 	if err != nil {
-		WarnLog("Discover forward %v://%v=>%v://%v is fail with %v", forward.Type, forward.Prefix, forward.Type, forward.URI, err)
 		return
 	}
-	d.proxyListen[forward.Prefix] = &ListenerProxy{TCP: ln, Service: service, Forward: forward}
-	defer func() {
-		ln.Close()
-		delete(d.proxyListen, forward.Prefix)
-	}()
-	InfoLog("Discover forward %v://%v=>%v://%v is started on %v", forward.Type, forward.Prefix, forward.Type, forward.URI, ln.Addr())
+	ln := &ListenerProxy{Prefix: forward.Prefix, TCP: local, Service: service, Forward: forward}
+	d.proxyListen[forward.Prefix] = ln
+	InfoLog("Discover forward %v://%v=>%v://%v is started on %v", forward.Type, forward.Prefix, forward.Type, forward.URI, local.Addr())
+	go d.procTCP(ln)
+	return
+}
+
+func (d *Discover) procTCP(ln *ListenerProxy) {
+	defer d.doneListen(ln)
 	for {
-		local, xerr := ln.Accept()
-		if xerr != nil {
-			err = xerr
+		local, err := ln.TCP.Accept()
+		if err != nil {
 			break
 		}
-		remote, xerr := net.Dial(forward.Type, forward.URI)
-		if xerr != nil {
-			WarnLog("Discover dial to %v://%v fail with %v", forward.Type, forward.URI, xerr)
-			return
-		}
-		go copyAndClose(local, remote)
-		go copyAndClose(remote, local)
+		go d.procTCPConn(ln, local)
 	}
+	forward, _ := ln.Target()
 	InfoLog("Discover forward %v://%v=>%v://%v is stopped", forward.Type, forward.Prefix, forward.Type, forward.URI)
+}
+
+func (d *Discover) procTCPConn(ln *ListenerProxy, local net.Conn) {
+	forward, _ := ln.Target()
+	remote, err := d.dialRemote(forward)
+	if err != nil {
+		WarnLog("Discover dial to %v://%v fail with %v", forward.Type, forward.URI, err)
+		d.StatsD.Count("connection.error", 1, "type:"+forward.Type, "forward:"+forward.Prefix)
+		local.Close()
+		return
+	}
+	d.StatsD.Count("connection", 1, "type:"+forward.Type, "forward:"+forward.Prefix)
+	atomic.AddInt32(&d.resourceTCP, 1)
+	defer atomic.AddInt32(&d.resourceTCP, -1)
+	go copyAndClose(local, remote)
+	copyAndClose(remote, local)
+}
+
+func (d *Discover) dialRemote(forward *Forward) (remote net.Conn, err error) {
+	backoff := d.DialBackoff
+	for i := 0; i <= d.DialRetry; i++ {
+		if i > 0 {
+			DebugLog("Discover dial to %v://%v fail with %v, will retry after %v", forward.Type, forward.URI, err, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		network, address := forward.RemoteAddr()
+		if len(d.SSHTunnel) > 0 && network == "tcp" {
+			remote, err = d.dialTunnel(context.Background(), network, address)
+		} else {
+			remote, err = d.dialResolved(network, address)
+		}
+		if err == nil {
+			break
+		}
+	}
 	return
 }
 
 func (d *Discover) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(d.AltSvc) > 0 && r.ProtoMajor < 3 {
+		w.Header().Set("Alt-Svc", d.AltSvc)
+	}
+	if d.Robots && r.URL.Path == "/robots.txt" {
+		d.procRobots(w, r)
+		return
+	}
+	role := listenRole(r)
+	if role == RoleControl {
+		d.procControl(w, r)
+		return
+	}
+	//the catalog/admin host is resolved before forwards, so it can't be taken by alias or pattern of container
+	tenant, ok := d.selfTenant(r.Host)
 	var reverse *ReverseProxy
-	d.proxyLock.RLock()
-	for host, proxy := range d.proxyReverse {
-		if host == r.Host || (proxy.Forward.Wildcard && strings.HasSuffix(r.Host, host)) {
-			reverse = proxy
-			break
-		}
+	if role != RoleAdmin && !ok {
+		reverse = d.findReverse(r.Host)
 	}
-	d.proxyLock.RUnlock()
 	if reverse != nil {
-		if strings.HasPrefix(r.URL.Path, d.SrvPrefix) {
+		if strings.HasPrefix(r.URL.Path, d.SrvPrefix) && !d.controlSeparated(r) {
 			d.procServer(w, r, reverse.Service)
-		} else {
-			reverse.Reverse.ServeHTTP(w, r)
+			return
 		}
+		atomic.AddInt32(&d.resourceHTTP, 1)
+		defer atomic.AddInt32(&d.resourceHTTP, -1)
+		d.procMiddleware(w, r, reverse)
+		return
+	}
+	if role == RoleProxy && (ok || d.unknownCatalog()) {
+		http.NotFound(w, r)
 		return
 	}
-	hostsAll := []string{}
-	proxyAll := map[string]*Container{}
-	forwardAll := map[string]*Forward{}
+	if !ok && role != RoleAdmin {
+		d.procUnknown(w, r)
+		return
+	}
+	if len(d.AdminPrefix) > 0 && strings.HasPrefix(r.URL.Path, d.AdminPrefix) {
+		if d.controlSeparated(r) {
+			http.NotFound(w, r)
+			return
+		}
+		d.procAdmin(w, r)
+		return
+	}
+	if d.procStatic(w, r) {
+		return
+	}
+	d.procCatalog(w, r, tenant)
+}
+
+func (d *Discover) procProxyError(w http.ResponseWriter, r *http.Request, forward *Forward, err error) {
+	var maxErr *http.MaxBytesError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &maxErr):
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		fmt.Fprintf(w, "request body too large")
+	case r.Context().Err() != nil:
+		DebugLog("Discover proxy %v%v is canceled with %v", r.Host, r.URL.Path, err)
+		w.WriteHeader(http.StatusBadGateway)
+	case isClientTimeout(r):
+		d.procProxyFailure(w, r, forward, http.StatusRequestTimeout, err)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		d.procProxyFailure(w, r, forward, http.StatusGatewayTimeout, err)
+	default:
+		d.procProxyFailure(w, r, forward, http.StatusBadGateway, err)
+	}
+}
+
+func (d *Discover) matchReverse(host string) (reverse *ReverseProxy) {
+	if reverse = d.proxyReverse[host]; reverse == nil {
+		reverse = d.warmReverse(host, d.proxyDefault[host])
+	}
+	if reverse == nil {
+		reverse = d.proxyAlias[host]
+	}
+	return
+}
+
+func (d *Discover) findReverse(host string) (reverse *ReverseProxy) {
+	d.proxyLock.RLock()
+	defer d.proxyLock.RUnlock()
+	if reverse = d.matchReverse(host); reverse != nil {
+		return
+	}
+	for _, suffix := range d.proxyWildcard.Suffixes(host) {
+		if proxy := d.matchReverse(suffix); proxy != nil && proxy.Forward.Wildcard {
+			reverse = proxy
+			return
+		}
+	}
+	if !d.inMatchDomains(host) || d.isManagedHost(host) {
+		return
+	}
+	for _, pattern := range d.proxyPattern {
+		if pattern.Match.MatchString(host) && !d.foreignTenantHost(pattern.Proxy.Forward.Tenant, host) {
+			reverse = pattern.Proxy
+			return
+		}
+	}
+	return
+}
+
+func (d *Discover) isHidden(container *Container, forward *Forward) bool {
+	if forward.Hidden {
+		return true
+	}
+	for _, pattern := range d.Hidden {
+		match, err := compileHostPattern(pattern)
+		if err != nil {
+			continue
+		}
+		if match.MatchString(container.Name) || match.MatchString(forward.Prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// listCatalog will list the sorted catalog hosts, the service is filtered by match when it is not nil
+func (d *Discover) listCatalog(match func(service *Container, forward *Forward) bool) (hostsAll []string, proxyAll map[string]*Container, forwardAll map[string]*Forward) {
+	hostsAll = []string{}
+	proxyAll = map[string]*Container{}
+	forwardAll = map[string]*Forward{}
 	d.proxyLock.RLock()
 	for host, proxy := range d.proxyAll {
 		forward := proxy.Forwards[host]
-		if forward == nil {
+		if forward == nil || d.isHidden(proxy, forward) || match != nil && !match(proxy, forward) {
 			continue
 		}
-		if !strings.HasPrefix(host, "tcp://") && !strings.HasPrefix(host, "udp://") {
-			host = fmt.Sprintf("%v//%v%v", d.HostProto, host, d.HostSuff)
+		if !isListenPrefix(host) {
+			host = fmt.Sprintf("%v//%v", d.HostProto, d.hostOf(forward.Tenant, host))
 		}
 		hostsAll = append(hostsAll, host)
 		proxyAll[host] = proxy
@@ -757,28 +1738,66 @@ func (d *Discover) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return hostX < hostY
 	})
-	if d.Preview != nil {
+	return
+}
+
+func (d *Discover) procCatalog(w http.ResponseWriter, r *http.Request, tenant string) {
+	if !d.procCatalogAuth(w, r) {
+		return
+	}
+	filter := ParseCatalogFilter(r.URL.Query())
+	hostsAll, proxyAll, forwardAll := d.listCatalog(func(service *Container, forward *Forward) bool {
+		return service.Tenant == tenant && filter.Match(service, forward)
+	})
+	hostList := []xmap.M{}
+	for _, host := range hostsAll {
+		container, forward := proxyAll[host], forwardAll[host]
+		latency := template.HTML("")
+		if d.Latency && forward.Type == "http" {
+			latency = d.latencyChart(d.hostOf(forward.Tenant, forward.Prefix))
+		}
+		hostList = append(hostList, xmap.M{
+			"Host":      host,
+			"Container": container,
+			"Forward":   forward,
+			"Stats":     d.ResourceStats(container.ID),
+			"Latency":   latency,
+		})
+	}
+	groups := groupHosts(hostList)
+	flaps := map[string]FlapStats{}
+	for _, stats := range d.FlapStats() {
+		flaps[stats.Name] = stats
+	}
+	preview, err := d.LoadPreview()
+	if err != nil {
+		WarnLog("Discover load preview template from %v fail with %v", d.PreviewFile, err)
+	}
+	if preview != nil {
+		preview = d.lookupPreview(preview, r.URL.Path)
+		if preview == nil {
+			http.NotFound(w, r)
+			return
+		}
+		self := d.isSelf(r)
 		data := xmap.M{}
-		if d.HostSelf != r.Host {
+		if !self {
 			w.WriteHeader(http.StatusNotFound)
 			data["Message"] = fmt.Sprintf("%v not found", r.Host)
 		}
-		hostList := []xmap.M{}
-		for _, host := range hostsAll {
-			container := proxyAll[host]
-			forward := forwardAll[host]
-			hostList = append(hostList, xmap.M{
-				"Host":      host,
-				"Container": container,
-				"Forward":   forward,
-			})
-		}
 		data["Hosts"] = hostList
-		d.Preview.Execute(w, data)
+		data["Groups"] = groups
+		data["Filter"] = filter
+		data["Flaps"] = flaps
+		if len(tenant) < 1 {
+			data["Drifts"] = d.ComposeDrifts()
+		}
+		preview.Execute(w, data)
 		return
 	}
+	self := d.isSelf(r)
 	w.Header().Add("Content-Type", "text/html; charset=utf-8")
-	if d.HostSelf != r.Host {
+	if !self {
 		w.WriteHeader(http.StatusNotFound)
 	}
 	fmt.Fprintf(w, `
@@ -786,32 +1805,88 @@ func (d *Discover) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			td{
 				padding: 2px 8px 2px 8px;
 			}
+			summary{
+				cursor: pointer;
+				padding: 2px 0px 2px 0px;
+			}
+			details table{
+				margin-left: 16px;
+			}
 		</style>
 	`)
-	if d.HostSelf != r.Host {
+	if !self {
 		fmt.Fprintf(w, "<pre>\n")
 		fmt.Fprintf(w, "%v not found\n\n", r.Host)
 		fmt.Fprintf(w, "</pre>\n")
 	}
-	fmt.Fprintf(w, "Having:\n")
-	fmt.Fprintf(w, "<table>\n")
-	for _, host := range hostsAll {
-		proxy := proxyAll[host]
-		forward := forwardAll[host]
-		if strings.HasPrefix(host, "tcp://") || strings.HasPrefix(host, "udp://") {
-			fmt.Fprintf(w, `<tr><td>%v-%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td></tr>%v`, proxy.Name, proxy.Version, forward.Name, forward.Key, host, proxy.Status, proxy.StartedAt, "\n")
-		} else {
-			fmt.Fprintf(w, `<tr><td>%v-%v</td><td>%v</td><td>%v</td><td><a target=”_blank” href="%v">%v</a></td><td>%v</td><td>%v</td</tr>%v`, proxy.Name, proxy.Version, forward.Name, forward.Key, host, host, proxy.Status, proxy.StartedAt, "\n")
+	fmt.Fprintf(w, `<form method="get"><input name="q" value="%v" placeholder="search"> <input type="submit" value="Search"></form>%v`, template.HTMLEscapeString(r.URL.Query().Get("q")), "\n")
+	fmt.Fprintf(w, "Having %v services, %v hosts:\n", len(groups), len(hostList))
+	if drifts := d.ComposeDrifts(); len(drifts) > 0 && len(tenant) < 1 {
+		fmt.Fprintf(w, "<details open><summary><b>%v compose drifts</b></summary>\n<table>\n", len(drifts))
+		for _, drift := range drifts {
+			fmt.Fprintf(w, "<tr><td>%v-%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td></tr>\n", template.HTMLEscapeString(drift.Name), template.HTMLEscapeString(drift.Version), template.HTMLEscapeString(drift.Forward), template.HTMLEscapeString(drift.Service), template.HTMLEscapeString(drift.Message), drift.Since)
+		}
+		fmt.Fprintf(w, "</table>\n</details>\n")
+	}
+	open := " open"
+	if len(hostList) > catalogCollapse {
+		open = ""
+	}
+	for _, group := range groups {
+		versions := group["Versions"].([]xmap.M)
+		flapping := ""
+		if stats, ok := flaps[group["Name"].(string)]; ok && stats.Flapping {
+			flapping = fmt.Sprintf(" <b>flapping by %v changes</b>", stats.Flaps())
+		}
+		fmt.Fprintf(w, "<details%v><summary>%v (%v versions, %v hosts)%v</summary>\n", open, group["Name"], len(versions), group["Count"], flapping)
+		fmt.Fprintf(w, "<table>\n")
+		for _, version := range versions {
+			for _, item := range version["Hosts"].([]xmap.M) {
+				host := item["Host"].(string)
+				proxy := item["Container"].(*Container)
+				forward := item["Forward"].(*Forward)
+				usage := ""
+				if stats, _ := item["Stats"].(*ResourceStats); stats != nil {
+					usage = stats.String()
+				}
+				usage += string(item["Latency"].(template.HTML))
+				status := template.HTMLEscapeString(proxy.Status)
+				if len(proxy.Problems) > 0 {
+					messages := []string{}
+					for _, problem := range proxy.Problems {
+						messages = append(messages, fmt.Sprintf("%v %v", problem.Label, problem.Message))
+					}
+					status += fmt.Sprintf(` <b title="%v">%v label problems</b>`, template.HTMLEscapeString(strings.Join(messages, "\n")), len(proxy.Problems))
+				}
+				if isListenPrefix(host) {
+					fmt.Fprintf(w, `<tr><td>%v-%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td><td>%v</td></tr>%v`, proxy.Name, proxy.Version, forward.Name, forward.Key, host, status, proxy.StartedAt, usage, "\n")
+				} else {
+					fmt.Fprintf(w, `<tr><td>%v-%v</td><td>%v</td><td>%v</td><td><a target=”_blank” href="%v">%v</a></td><td>%v</td><td>%v</td><td>%v</td></tr>%v`, proxy.Name, proxy.Version, forward.Name, forward.Key, host, host, status, proxy.StartedAt, usage, "\n")
+				}
+			}
 		}
+		fmt.Fprintf(w, "</table>\n")
+		fmt.Fprintf(w, "</details>\n")
 	}
-	fmt.Fprintf(w, "</table>\n")
 	fmt.Fprintf(w, "</pre>\n")
 }
 
 func (d *Discover) StartRefresh(refreshTime time.Duration, onAdded, onRemoved, onUpdated string) {
 	d.refreshing = true
+	d.triggerAdded, d.triggerRemoved, d.triggerUpdated = onAdded, onRemoved, onUpdated
 	InfoLog("Discover start refresh by time:%v,added:%v,removed:%v,updated:%v", refreshTime, onAdded, onRemoved, onUpdated)
+	if err := d.Reconcile(onAdded, onRemoved, onUpdated); err != nil {
+		WarnLog("Discover startup reconcile fail with %v", err)
+	}
 	go d.runRefresh(refreshTime, onAdded, onRemoved, onUpdated)
+	for _, backend := range d.Backends {
+		if backend == "host" && d.HostServiceWatch > 0 {
+			go d.runHostWatch()
+		}
+	}
+	if d.ProbeInterval > 0 {
+		go d.runProbe()
+	}
 }
 
 func (d *Discover) StopRefresh() {
@@ -822,24 +1897,69 @@ func (d *Discover) runRefresh(refreshTime time.Duration, onAdded, onRemoved, onU
 	refreshTicker := time.NewTicker(refreshTime)
 	for d.refreshing {
 		<-refreshTicker.C
-		d.callRefresh(onAdded, onRemoved, onUpdated)
-		d.callClear()
-		d.callPrune()
+		if d.IsPaused() || d.skipCycle() {
+			continue
+		}
+		d.callCycle(onAdded, onRemoved, onUpdated)
+		d.drainTicks(refreshTicker.C)
 	}
 }
 
-func (d *Discover) callRefresh(onAdded, onRemoved, onUpdated string) {
+func (d *Discover) callCycle(onAdded, onRemoved, onUpdated string) (added, updated, removed map[string]*Container, err error) {
+	d.cycleLock.Lock()
+	defer d.cycleLock.Unlock()
+	defer d.endCycle(d.beginCycle())
+	if xerr := d.ensureWireGuard(); xerr != nil {
+		WarnLog("Discover ensure wireguard fail with %v", xerr)
+	}
+	added, updated, removed, err = d.callRefresh(onAdded, onRemoved, onUpdated)
+	d.relinkRecreated()
+	if len(d.Exports) > 0 {
+		d.callExport()
+	}
+	if d.Stats {
+		go d.collectStats()
+	}
+	d.checkResource()
+	d.checkCompose()
+	d.callRestartCron()
+	d.callSupervisor()
+	if d.UpdateInterval > 0 {
+		go d.callUpdate()
+	}
+	d.callClear()
+	d.callPrune()
+	if d.Latency {
+		d.saveLatency()
+	}
+	if err == nil {
+		d.saveSnapshot()
+	}
+	return
+}
+
+func (d *Discover) callRefresh(onAdded, onRemoved, onUpdated string) (added, updated, removed map[string]*Container, err error) {
 	defer func() {
 		if xerr := recover(); xerr != nil {
 			ErrorLog("Discover call refresh panic with %v, call stack is:\n%v", xerr, debug.CallStatck())
+			err = fmt.Errorf("%v", xerr)
 		}
 	}()
+	begin := time.Now()
 	all, added, updated, removed, err := d.Refresh()
+	d.StatsD.Timing("refresh.duration", time.Since(begin))
 	if err != nil {
 		ErrorLog("Discover call refresh fail with %v", err)
+		d.StatsD.Count("refresh", 1, "result:failure")
 		return
 	}
+	d.StatsD.Count("refresh", 1, "result:success")
+	d.StatsD.Gauge("services", int64(len(all)))
+	d.StatsD.Count("refresh.added", int64(len(added)))
+	d.StatsD.Count("refresh.updated", int64(len(updated)))
+	d.StatsD.Count("refresh.removed", int64(len(removed)))
 	DebugLog("Discover call refresh success with all:%v,added:%v,updated:%v,removed:%v", len(all), len(added), len(updated), len(removed))
+	d.recordFlap(all, added, removed)
 	if len(added) > 0 && len(onAdded) > 0 {
 		d.callTrigger(added, "added", onAdded)
 	}
@@ -849,6 +1969,10 @@ func (d *Discover) callRefresh(onAdded, onRemoved, onUpdated string) {
 	if len(updated) > 0 && len(onUpdated) > 0 {
 		d.callTrigger(updated, "updated", onUpdated)
 	}
+	d.callHooks(added, "added")
+	d.callHooks(removed, "removed")
+	d.callHooks(updated, "updated")
+	return
 }
 
 func (d *Discover) callClear() {
@@ -857,7 +1981,7 @@ func (d *Discover) callClear() {
 			ErrorLog("Discover call clear panic with %v, call stack is:\n%v", xerr, debug.CallStatck())
 		}
 	}()
-	if d.DockerClearDelay < 1 || time.Since(d.dockerClearLast) < d.DockerClearDelay {
+	if d.DockerClearDelay < 1 || time.Since(d.dockerClearLast) < d.DockerClearDelay || d.IsReadOnly() {
 		return
 	}
 	_, err := d.Clear()
@@ -875,7 +1999,7 @@ func (d *Discover) callPrune() {
 			ErrorLog("Discover call prune panic with %v, call stack is:\n%v", xerr, debug.CallStatck())
 		}
 	}()
-	if d.DockerPruneDelay < 1 || time.Since(d.dockerPruneLast) < d.DockerPruneDelay {
+	if d.DockerPruneDelay < 1 || time.Since(d.dockerPruneLast) < d.DockerPruneDelay || d.IsReadOnly() {
 		return
 	}
 	err := d.Prune()
@@ -888,27 +2012,23 @@ func (d *Discover) callPrune() {
 }
 
 func (d *Discover) callTrigger(services map[string]*Container, name, trigger string) {
+	if d.TriggerBatch {
+		d.callTriggerBatch(services, name, trigger)
+		return
+	}
 	for prefix, service := range services {
 		if forward, ok := service.Forwards[prefix]; ok {
-			if forward.Type != "http" {
+			if !d.isTriggerType(forward.Type) {
 				continue
 			}
-			cmd := exec.Command(d.TriggerBash, trigger)
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%v=%v", "PD_SERVICE_VER", service.Version))
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%v=%v", "PD_SERVICE_NAME", service.Name))
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%v=%v", "PD_SERVICE_TYPE", forward.Type))
-			if forward.Wildcard {
-				cmd.Env = append(cmd.Env, fmt.Sprintf("%v=*.%v", "PD_SERVICE_HOST", forward.URI))
-				cmd.Env = append(cmd.Env, fmt.Sprintf("%v=*.%v", "PD_SERVICE_PREF", forward.Prefix))
-			} else {
-				cmd.Env = append(cmd.Env, fmt.Sprintf("%v=%v", "PD_SERVICE_HOST", forward.URI))
-				cmd.Env = append(cmd.Env, fmt.Sprintf("%v=%v", "PD_SERVICE_PREF", forward.Prefix))
-			}
-			info, xerr := cmd.Output()
+			env := triggerEnv(service, forward)
+			startTime := time.Now()
+			info, xerr := d.runTrigger(trigger, env, nil)
+			d.recordTrigger(name, time.Since(startTime), info, xerr)
 			if xerr != nil {
-				WarnLog("Discover call refresh trigger %v fail with %v by\n\tCMD:%v\n\tENV:%v\n\tOut:\n%v", name, xerr, cmd.Path, cmd.Env, string(info))
+				WarnLog("Discover call refresh trigger %v fail with %v by\n\tCMD:%v\n\tENV:%v\n\tOut:\n%v", name, xerr, trigger, env, string(info))
 			} else {
-				InfoLog("Discover call refresh trigger %v success by\n\tCMD:%v\n\tENV:%v\n\tOut:\n%v", name, cmd.Path, cmd.Env, string(info))
+				InfoLog("Discover call refresh trigger %v success by\n\tCMD:%v\n\tENV:%v\n\tOut:\n%v", name, trigger, env, string(info))
 			}
 		}
 	}
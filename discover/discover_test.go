@@ -13,11 +13,14 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/codingeasygo/util/xhttp"
 	"github.com/codingeasygo/util/xnet"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 )
 
 func callScript(script string) string {
@@ -390,3 +393,569 @@ func TestDiscover(t *testing.T) {
 		}
 	}
 }
+
+func TestForwardUnix(t *testing.T) {
+	path, port, ok := splitUnixLabel("/run/pd/www.sock/:80")
+	if !ok || path != "/run/pd/www.sock" || port != ":80" {
+		t.Errorf("%v,%v,%v", path, port, ok)
+		return
+	}
+	path, port, ok = splitUnixLabel("/run/pd/www.sock/unix:///shared/app.sock")
+	if !ok || path != "/run/pd/www.sock" || port != "unix:///shared/app.sock" {
+		t.Errorf("%v,%v,%v", path, port, ok)
+		return
+	}
+	if _, _, ok = splitUnixLabel("/run/pd/www.sock/"); ok {
+		t.Error("error")
+		return
+	}
+	forward := &Forward{Type: "http", URI: "unix:///shared/app.sock"}
+	if network, address := forward.RemoteAddr(); network != "unix" || address != "/shared/app.sock" {
+		t.Errorf("%v,%v", network, address)
+		return
+	}
+	forward = &Forward{Type: "udp", URI: "127.0.0.1:80"}
+	if network, address := forward.RemoteAddr(); network != "udp" || address != "127.0.0.1:80" {
+		t.Errorf("%v,%v", network, address)
+		return
+	}
+	if !isListenPrefix("unix:///run/pd/www.sock") || isListenPrefix("v100.ds") {
+		t.Error("error")
+		return
+	}
+	//unix roots
+	dir, _ := ioutil.TempDir("", "unix")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "run"), os.ModePerm)
+	os.Symlink("/var/run", filepath.Join(dir, "run", "host"))
+	discover := NewDiscover()
+	if discover.inUnixRoots(filepath.Join(dir, "run", "www.sock")) {
+		t.Error("error")
+		return
+	}
+	discover.UnixRoots = []string{filepath.Join(dir, "run")}
+	for name, allowed := range map[string]bool{
+		filepath.Join(dir, "run", "www.sock"):               true,
+		filepath.Join(dir, "run", "..", "www.sock"):         false,
+		filepath.Join(dir, "run", "host", "docker.sock"):    false,
+		filepath.Join(dir, "none", "www.sock"):              false,
+		"run/www.sock":                                      false,
+		"/var/run/docker.sock":                              false,
+		"@" + filepath.Join(dir, "run", "www.sock"):         false,
+		filepath.Join(dir, "run") + "2/www.sock":            false,
+		filepath.Join(dir, "run", "host") + "/../www2.sock": false,
+	} {
+		if discover.inUnixRoots(name) != allowed {
+			t.Error(name)
+			return
+		}
+	}
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "c1", Name: "/ds-srv-v1.0.0", State: &types.ContainerState{Status: "running"}},
+		Config: &container.Config{Labels: map[string]string{
+			"PD_HOST_WEB":  "unix:///var/run/docker.sock",
+			"PD_UNIX_SOCK": "/etc/ds.sock/unix://" + filepath.Join(dir, "run", "app.sock"),
+			"PD_UNIX_WWW":  filepath.Join(dir, "run", "www.sock") + "/unix://" + filepath.Join(dir, "run", "app.sock"),
+		}},
+	}
+	service, _ := discover.parseContainer(inspect, "127.0.0.1", false)
+	if len(service.Forwards) != 1 || service.Forwards["unix://"+filepath.Join(dir, "run", "www.sock")] == nil || len(service.Problems) != 2 {
+		t.Errorf("%v,%v", service.Forwards, service.Problems)
+		return
+	}
+}
+
+func TestFindReverse(t *testing.T) {
+	discover := NewDiscover()
+	discover.proxyReverse["v100.ds.test.loc"] = &ReverseProxy{Forward: &Forward{Wildcard: true}}
+	discover.proxyReverse["a0.v100.ds.test.loc"] = &ReverseProxy{Forward: &Forward{}}
+	discover.proxyReverse["v101.ds.test.loc"] = &ReverseProxy{Forward: &Forward{}}
+	discover.rebuildWildcard()
+	for host, expect := range map[string]string{
+		"v100.ds.test.loc":       "v100.ds.test.loc",
+		"xx.v100.ds.test.loc":    "v100.ds.test.loc",
+		"x.xx.v100.ds.test.loc":  "v100.ds.test.loc",
+		"a0.v100.ds.test.loc":    "a0.v100.ds.test.loc",
+		"xa0.v100.ds.test.loc":   "v100.ds.test.loc",
+		"v101.ds.test.loc":       "v101.ds.test.loc",
+		"xx.v101.ds.test.loc":    "",
+		"xv100.ds.test.loc":      "",
+		"v102.ds.test.loc":       "",
+		"v100.ds.test.loc.other": "",
+		"ds.test.loc":            "",
+		"x.v100.ds.test":         "",
+	} {
+		reverse := discover.findReverse(host)
+		if expect == "" && reverse != nil || expect != "" && reverse != discover.proxyReverse[expect] {
+			t.Errorf("%v->%v", host, expect)
+			return
+		}
+	}
+}
+
+func TestHostTrie(t *testing.T) {
+	trie := newHostTrie()
+	trie.Add("test.loc")
+	trie.Add("ds.test.loc")
+	trie.Add("v1.ds.test.loc")
+	if hosts := trie.Suffixes("x.v1.ds.test.loc"); len(hosts) != 3 || hosts[0] != "v1.ds.test.loc" || hosts[2] != "test.loc" {
+		t.Error(hosts)
+		return
+	}
+	if hosts := trie.Suffixes("v1.ds.test.loc"); len(hosts) != 2 || hosts[0] != "ds.test.loc" {
+		t.Error(hosts)
+		return
+	}
+	if hosts := trie.Suffixes("x.v2.ds.test.loc"); len(hosts) != 2 || hosts[0] != "ds.test.loc" {
+		t.Error(hosts)
+		return
+	}
+	if hosts := trie.Suffixes("test.other"); len(hosts) != 0 {
+		t.Error(hosts)
+		return
+	}
+	//shadowed by not wildcard
+	discover := NewDiscover()
+	discover.proxyReverse["ds.test.loc"] = &ReverseProxy{Forward: &Forward{Wildcard: true}}
+	discover.proxyReverse["v1.ds.test.loc"] = &ReverseProxy{Forward: &Forward{Wildcard: true}}
+	discover.proxyReverse["v2.ds.test.loc"] = &ReverseProxy{Forward: &Forward{}}
+	discover.proxyAlias["v2.ds.test.loc"] = &ReverseProxy{Forward: &Forward{Wildcard: true}}
+	discover.rebuildWildcard()
+	if reverse := discover.findReverse("x.v1.ds.test.loc"); reverse != discover.proxyReverse["v1.ds.test.loc"] {
+		t.Error(reverse)
+		return
+	}
+	if reverse := discover.findReverse("x.v2.ds.test.loc"); reverse != discover.proxyReverse["ds.test.loc"] {
+		t.Error(reverse)
+		return
+	}
+}
+
+func TestUpstreamHost(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%v", r.Host)
+	}))
+	defer ts.Close()
+	addr := strings.TrimPrefix(ts.URL, "http://")
+	for mode, expect := range map[string]string{
+		"":         "v100.ds.test.loc",
+		"preserve": "v100.ds.test.loc",
+		"upstream": addr,
+		"app.loc":  "app.loc",
+	} {
+		forward := &Forward{Type: "http", URI: addr, UpstreamHost: mode}
+		proxy, err := forward.NewReverseProxy()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		req := httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil)
+		res := httptest.NewRecorder()
+		proxy.ServeHTTP(res, req)
+		if res.Body.String() != expect {
+			t.Errorf("%v->%v", mode, res.Body.String())
+			return
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "%v", len(data))
+	}))
+	defer ts.Close()
+	discover := NewDiscover()
+	discover.MaxBodySize = 10
+	forward := &Forward{Type: "http", URI: strings.TrimPrefix(ts.URL, "http://")}
+	proxy, _ := discover.newReverseProxy(forward)
+	discover.proxyReverse["v100.ds.test.loc"] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: &Container{}}
+	req := httptest.NewRequest("POST", "http://v100.ds.test.loc/", strings.NewReader("1234567890"))
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Body.String() != "10" {
+		t.Error(res.Body.String())
+		return
+	}
+	req = httptest.NewRequest("POST", "http://v100.ds.test.loc/", strings.NewReader("12345678901"))
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusRequestEntityTooLarge {
+		t.Error(res.Code)
+		return
+	}
+	req = httptest.NewRequest("POST", "http://v100.ds.test.loc/", io.MultiReader(strings.NewReader("12345678901")))
+	req.ContentLength = -1
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusRequestEntityTooLarge {
+		t.Error(res.Code)
+		return
+	}
+}
+
+func TestMirror(t *testing.T) {
+	forward := &Forward{Key: "*a", Prefix: "a.v100.ds"}
+	if prefix := forward.VersionPrefix("v1.0.1"); prefix != "a.v101.ds" {
+		t.Error(prefix)
+		return
+	}
+	forward = &Forward{Prefix: "v100.ds"}
+	if prefix := forward.VersionPrefix("1.0.1"); prefix != "v101.ds" {
+		t.Error(prefix)
+		return
+	}
+	mirrored := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		if r.Host == "v101.ds.test.loc" {
+			mirrored <- string(data)
+		}
+		fmt.Fprintf(w, "%v", r.Host)
+	}))
+	defer ts.Close()
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	for _, ver := range []string{"v1.0.0", "v1.0.1"} {
+		forward := &Forward{Type: "http", Prefix: fmt.Sprintf("%v.ds", strings.ReplaceAll(ver, ".", "")), URI: strings.TrimPrefix(ts.URL, "http://")}
+		if ver == "v1.0.0" {
+			forward.MirrorVersion, forward.MirrorPercent = "v1.0.1", 100
+		}
+		proxy, _ := discover.newReverseProxy(forward)
+		discover.proxyReverse[forward.Prefix+discover.HostSuff] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: &Container{}}
+	}
+	req := httptest.NewRequest("POST", "http://v100.ds.test.loc/", strings.NewReader("abc"))
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Body.String() != "v100.ds.test.loc" {
+		t.Error(res.Body.String())
+		return
+	}
+	select {
+	case body := <-mirrored:
+		if body != "abc" {
+			t.Error(body)
+			return
+		}
+	case <-time.After(time.Second):
+		t.Error("timeout")
+		return
+	}
+	//body read error, mirror is skipped and the error is kept on original body
+	readErr := fmt.Errorf("read error")
+	req = httptest.NewRequest("POST", "http://v100.ds.test.loc/", io.MultiReader(strings.NewReader("ab"), &errorReader{err: readErr}))
+	req.ContentLength = 3
+	discover.procMirror(discover.proxyReverse["v100.ds.test.loc"], req)
+	data, err := ioutil.ReadAll(req.Body)
+	if err != readErr || string(data) != "ab" {
+		t.Errorf("%v,%v", err, string(data))
+		return
+	}
+	select {
+	case body := <-mirrored:
+		t.Error(body)
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+	//skipped by max running mirrors
+	discover.MirrorMaxConns = 0
+	req = httptest.NewRequest("POST", "http://v100.ds.test.loc/", strings.NewReader("abc"))
+	discover.procMirror(discover.proxyReverse["v100.ds.test.loc"], req)
+	select {
+	case body := <-mirrored:
+		t.Error(body)
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+	//slow mirror is canceled by timeout
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	discover.MirrorMaxConns, discover.MirrorTimeout = 1, 50*time.Millisecond
+	slowForward := &Forward{Type: "http", Prefix: "v101.ds", URI: strings.TrimPrefix(slow.URL, "http://")}
+	proxy, _ := discover.newReverseProxy(slowForward)
+	discover.proxyReverse["v101.ds.test.loc"] = &ReverseProxy{Forward: slowForward, Reverse: proxy, Service: &Container{}}
+	discover.procMirror(discover.proxyReverse["v100.ds.test.loc"], httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil))
+	if running := atomic.LoadInt32(&discover.mirrorRunning); running != 1 {
+		t.Error(running)
+		return
+	}
+	time.Sleep(300 * time.Millisecond)
+	if running := atomic.LoadInt32(&discover.mirrorRunning); running != 0 {
+		t.Error(running)
+		return
+	}
+}
+
+func TestRouteVersion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%v", r.URL.Query().Get("ver"))
+	}))
+	defer ts.Close()
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	for _, ver := range []string{"v100", "v101"} {
+		forward := &Forward{Type: "http", Prefix: ver + ".ds", URI: strings.TrimPrefix(ts.URL, "http://")}
+		proxy, _ := discover.newReverseProxy(forward)
+		director := proxy.Director
+		current := ver
+		proxy.Director = func(req *http.Request) {
+			director(req)
+			req.URL.RawQuery = "ver=" + current
+		}
+		discover.proxyReverse[forward.Prefix+discover.HostSuff] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: &Container{}}
+	}
+	for _, c := range []struct {
+		Header string
+		Cookie string
+		Expect string
+	}{
+		{"", "", "v100"},
+		{"1.0.1", "", "v101"},
+		{"", "v1.0.1", "v101"},
+		{"1.0.9", "", "v100"},
+	} {
+		req := httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil)
+		if len(c.Header) > 0 {
+			req.Header.Set("X-PD-Version", c.Header)
+		}
+		if len(c.Cookie) > 0 {
+			req.AddCookie(&http.Cookie{Name: "pd_version", Value: c.Cookie})
+		}
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		if res.Body.String() != c.Expect {
+			t.Errorf("%v->%v", c, res.Body.String())
+			return
+		}
+	}
+}
+
+func TestDefaultVersion(t *testing.T) {
+	if CompareVersion("v1.0.10", "v1.0.9") <= 0 || CompareVersion("v1.0", "v1.0.1") >= 0 || CompareVersion("v1.0.1", "1.0.1") != 0 {
+		t.Error("error")
+		return
+	}
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.DefaultVersion = true
+	for _, ver := range []string{"v1.0.9", "v1.0.10", "v1.0.2"} {
+		prefix := "a." + strings.ReplaceAll(ver, ".", "") + ".ds"
+		discover.proxyReverse[prefix+discover.HostSuff] = &ReverseProxy{
+			Forward: &Forward{Key: "*a", Prefix: prefix, Wildcard: true},
+			Service: &Container{Version: ver},
+		}
+	}
+	discover.rebuildDefault()
+	discover.rebuildWildcard()
+	if reverse := discover.findReverse("x.a.ds.test.loc"); reverse == nil || reverse.Forward.Prefix != "a.v1010.ds" {
+		t.Errorf("%v", reverse)
+		return
+	}
+	discover.proxyReverse["a.v102.ds.test.loc"].Forward.Default = true
+	discover.rebuildDefault()
+	discover.rebuildWildcard()
+	if reverse := discover.findReverse("a.ds.test.loc"); reverse == nil || reverse.Forward.Prefix != "a.v102.ds" {
+		t.Errorf("%v", reverse)
+		return
+	}
+	discover.DefaultVersion = false
+	discover.rebuildDefault()
+	discover.rebuildWildcard()
+	if reverse := discover.findReverse("a.ds.test.loc"); reverse != nil {
+		t.Errorf("%v", reverse)
+		return
+	}
+}
+
+func TestAlias(t *testing.T) {
+	container := &Container{
+		Forwards: map[string]*Forward{
+			"v100.ds":   {Name: "WWW", Prefix: "v100.ds"},
+			"a.v100.ds": {Name: "A", Prefix: "a.v100.ds"},
+		},
+	}
+	applyForwardOptions(container, map[string]string{
+		"PD_ALIAS_WWW": "www.example.com, example.com",
+		"PD_ALIAS_A":   "example.com",
+	})
+	discover := NewDiscover()
+	for prefix, forward := range container.Forwards {
+		discover.proxyReverse[prefix] = &ReverseProxy{Forward: forward, Service: container}
+	}
+	discover.rebuildAlias()
+	if reverse := discover.findReverse("www.example.com"); reverse == nil || reverse.Forward.Name != "WWW" {
+		t.Errorf("%v", reverse)
+		return
+	}
+	if reverse := discover.findReverse("example.com"); reverse == nil || reverse.Forward.Name != "A" {
+		t.Errorf("%v", reverse)
+		return
+	}
+	//the host of pdservice and forward can't be alias
+	discover.HostSelf = "pdsrv"
+	discover.HostSuff = ".test.loc"
+	discover.Tenants["team-a"] = &Tenant{Name: "team-a", HostSelf: "pdsrv.a.loc"}
+	applyForwardOptions(container, map[string]string{
+		"PD_ALIAS_WWW": "pdsrv,PDSRV.A.LOC,v101.ds.test.loc,test.loc,www.example.com",
+	})
+	discover.checkAliases(container)
+	if aliases := container.Forwards["v100.ds"].Aliases; len(aliases) != 1 || aliases[0] != "www.example.com" || len(container.Problems) != 4 {
+		t.Errorf("%v,%v", aliases, container.Problems)
+		return
+	}
+	//the self host is served before alias
+	container.Forwards["v100.ds"].Aliases = []string{"pdsrv"}
+	discover.rebuildAlias()
+	req := httptest.NewRequest("GET", "http://pdsrv/", nil)
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "0 services") {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+}
+
+func TestHostPattern(t *testing.T) {
+	discover := NewDiscover()
+	discover.proxyReverse["v100.ds"] = &ReverseProxy{Forward: &Forward{Prefix: "v100.ds", Matches: []string{"pr-*.review.example.com"}}}
+	discover.proxyReverse["v101.ds"] = &ReverseProxy{Forward: &Forward{Prefix: "v101.ds", Matches: []string{`re:^api-\d+\.example\.com$`, "re:("}}}
+	discover.rebuildPattern()
+	if reverse := discover.findReverse("api-12.example.com"); reverse != nil {
+		t.Errorf("%v", reverse)
+		return
+	}
+	discover.MatchDomains = []string{"example.com"}
+	discover.HostSelf = "pdsrv.example.com"
+	discover.HostSuff = ".test.example.com"
+	for host, expect := range map[string]string{
+		"pr-12.review.example.com":   "v100.ds",
+		"pr-.review.example.com":     "v100.ds",
+		"pr-1.2.review.example.com":  "",
+		"pr-12.reviewxexample.com":   "",
+		"api-12.example.com":         "v101.ds",
+		"api-a.example.com":          "",
+		"x.pr-12.review.example.com": "",
+	} {
+		reverse := discover.findReverse(host)
+		if expect == "" && reverse != nil || expect != "" && (reverse == nil || reverse.Forward.Prefix != expect) {
+			t.Errorf("%v->%v", host, expect)
+			return
+		}
+	}
+	//the host of pdservice, forward and not in match domains is not matched
+	discover.proxyReverse["v102.ds"] = &ReverseProxy{Forward: &Forward{Prefix: "v102.ds", Matches: []string{"re:.*"}}}
+	discover.rebuildPattern()
+	for host, expect := range map[string]string{
+		"pdsrv.example.com":        "",
+		"v100.ds.test.example.com": "",
+		"test.example.com":         "",
+		"other.org":                "",
+		"x.example.com":            "v102.ds",
+	} {
+		reverse := discover.findReverse(host)
+		if expect == "" && reverse != nil || expect != "" && (reverse == nil || reverse.Forward.Prefix != expect) {
+			t.Errorf("%v->%v", host, expect)
+			return
+		}
+	}
+	container := &Container{Forwards: map[string]*Forward{"v100.ds": {Name: "WWW", Prefix: "v100.ds", Matches: []string{"*"}}}}
+	discover.checkMatches(container)
+	discover.MatchDomains = nil
+	discover.checkMatches(container)
+	if len(container.Forwards["v100.ds"].Matches) != 0 || len(container.Problems) != 1 {
+		t.Errorf("%v", container.Problems)
+		return
+	}
+}
+
+func TestUnknownHost(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	for mode, expect := range map[string]int{
+		"catalog":                     http.StatusNotFound,
+		"404":                         http.StatusNotFound,
+		"redirect:https://pdsrv/":     http.StatusFound,
+		"template":                    http.StatusNotFound,
+		"template-without-template-x": http.StatusNotFound,
+	} {
+		discover.UnknownHost = mode
+		discover.UnknownTemplate, _ = template.New("test").Parse(`{{.Host}} is unknown`)
+		req := httptest.NewRequest("GET", "http://xx.loc/", nil)
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		if res.Code != expect {
+			t.Errorf("%v->%v", mode, res.Code)
+			return
+		}
+		if mode == "template" && res.Body.String() != "xx.loc is unknown" {
+			t.Errorf("%v->%v", mode, res.Body.String())
+			return
+		}
+		if mode == "404" && strings.Contains(res.Body.String(), "Having") {
+			t.Errorf("%v->%v", mode, res.Body.String())
+			return
+		}
+	}
+	req := httptest.NewRequest("GET", "http://pdsrv/", nil)
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "Having") {
+		t.Errorf("%v", res.Code)
+		return
+	}
+	req = httptest.NewRequest("GET", "http://v100.ds.test.loc/robots.txt", nil)
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Body.String() != robotsDisallow {
+		t.Errorf("%v", res.Body.String())
+		return
+	}
+}
+
+func TestHidden(t *testing.T) {
+	container := &Container{
+		Name: "ds",
+		Forwards: map[string]*Forward{
+			"v100.ds":       {Name: "WWW", Prefix: "v100.ds"},
+			"admin.v100.ds": {Name: "ADMIN", Prefix: "admin.v100.ds"},
+		},
+	}
+	internal := &Container{
+		Name: "internal-db",
+		Forwards: map[string]*Forward{
+			"v100.db": {Name: "WWW", Prefix: "v100.db"},
+		},
+	}
+	applyForwardOptions(container, map[string]string{
+		"PD_HIDDEN_ADMIN": "1",
+	})
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.Hidden = []string{"internal-*"}
+	for _, c := range []*Container{container, internal} {
+		for prefix, forward := range c.Forwards {
+			discover.proxyAll[prefix] = c
+			discover.proxyReverse[prefix] = &ReverseProxy{Forward: forward, Service: c}
+		}
+	}
+	req := httptest.NewRequest("GET", "http://pdsrv/", nil)
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	body := res.Body.String()
+	if !strings.Contains(body, "v100.ds") || strings.Contains(body, "admin.v100.ds") || strings.Contains(body, "v100.db") {
+		t.Errorf("%v", body)
+		return
+	}
+	if reverse := discover.findReverse("admin.v100.ds"); reverse == nil {
+		t.Error("hidden forward is not proxied")
+		return
+	}
+}
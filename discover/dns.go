@@ -0,0 +1,302 @@
+package discover
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsEntry is the resolved addresses of upstream dns name which is cached until ttl is expired
+type dnsEntry struct {
+	IPs    []string
+	Expire time.Time
+	next   int
+}
+
+// ResolvConf is the nameservers, search domains and ndots option of resolv.conf
+type ResolvConf struct {
+	Servers []string
+	Search  []string
+	Ndots   int
+}
+
+// ParseResolvConf will parse the nameserver, search/domain and options ndots of resolv.conf, the ndots is 1 by default
+func ParseResolvConf(data string) (conf *ResolvConf) {
+	conf = &ResolvConf{Ndots: 1}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			conf.Servers = append(conf.Servers, joinHost(fields[1], "53"))
+		case "search", "domain":
+			conf.Search = fields[1:]
+		case "options":
+			for _, option := range fields[1:] {
+				if strings.HasPrefix(option, "ndots:") {
+					if ndots, err := strconv.Atoi(strings.TrimPrefix(option, "ndots:")); err == nil && ndots >= 0 {
+						conf.Ndots = ndots
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// SystemResolvConf will return the resolv conf of /etc/resolv.conf
+func SystemResolvConf() (conf *ResolvConf) {
+	data, _ := ioutil.ReadFile("/etc/resolv.conf")
+	conf = ParseResolvConf(string(data))
+	return
+}
+
+// dnsNames will return the names to query by search domains, the name which has ndots dots is queried as absolute first,
+// the name which is ended with . is only queried as absolute
+func dnsNames(host string, search []string, ndots int) (names []string) {
+	if strings.HasSuffix(host, ".") {
+		return []string{host}
+	}
+	searched := []string{}
+	for _, domain := range search {
+		searched = append(searched, host+"."+strings.Trim(domain, "."))
+	}
+	if strings.Count(host, ".") >= ndots {
+		return append([]string{host}, searched...)
+	}
+	return append(searched, host)
+}
+
+// dnsExchange will send the packed query to server by udp or tcp network and return the packed reply
+func dnsExchange(ctx context.Context, network, server string, packed []byte, id uint16, timeout time.Duration) (reply []byte, err error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if network == "tcp" {
+		if _, err = conn.Write(append([]byte{byte(len(packed) >> 8), byte(len(packed))}, packed...)); err != nil {
+			return
+		}
+		head := make([]byte, 2)
+		if _, err = io.ReadFull(conn, head); err != nil {
+			return
+		}
+		reply = make([]byte, binary.BigEndian.Uint16(head))
+		_, err = io.ReadFull(conn, reply)
+		return
+	}
+	if _, err = conn.Write(packed); err != nil {
+		return
+	}
+	buffer := make([]byte, 4096)
+	for {
+		n, xerr := conn.Read(buffer)
+		if xerr != nil {
+			err = xerr
+			return
+		}
+		if n > 2 && binary.BigEndian.Uint16(buffer) == id {
+			reply = buffer[:n]
+			return
+		}
+	}
+}
+
+// queryDNS will query the A or AAAA record of host by udp to server and retry by tcp when the reply is truncated,
+// the ttl is the min ttl of records, no address and no error is returned when the name is not existed
+func queryDNS(ctx context.Context, server, host string, qtype dnsmessage.Type, timeout time.Duration) (ips []string, ttl time.Duration, err error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return
+	}
+	id := make([]byte, 2)
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: binary.BigEndian.Uint16(id), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return
+	}
+	reply := dnsmessage.Message{}
+	for _, network := range []string{"udp", "tcp"} {
+		data, xerr := dnsExchange(ctx, network, server, packed, query.ID, timeout)
+		if xerr != nil {
+			err = xerr
+			return
+		}
+		if err = reply.Unpack(data); err != nil {
+			return
+		}
+		if !reply.Truncated {
+			break
+		}
+	}
+	if reply.ID != query.ID || !reply.Response || len(reply.Questions) != 1 || reply.Questions[0].Name.String() != name.String() || reply.Questions[0].Type != qtype {
+		err = fmt.Errorf("query %v by %v fail with invalid reply", host, server)
+		return
+	}
+	if reply.RCode == dnsmessage.RCodeNameError {
+		return
+	}
+	if reply.RCode != dnsmessage.RCodeSuccess {
+		err = fmt.Errorf("query %v by %v fail with %v", host, server, reply.RCode)
+		return
+	}
+	var minTTL uint32
+	for _, answer := range reply.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]).String())
+		default:
+			continue
+		}
+		if minTTL == 0 || answer.Header.TTL < minTTL {
+			minTTL = answer.Header.TTL
+		}
+	}
+	ttl = time.Duration(minTTL) * time.Second
+	return
+}
+
+// queryServers will query by servers in order, the next server is used when the query is fail
+func queryServers(ctx context.Context, servers []string, host string, qtype dnsmessage.Type, timeout time.Duration) (ips []string, ttl time.Duration, err error) {
+	for _, server := range servers {
+		if ips, ttl, err = queryDNS(ctx, server, host, qtype, timeout); err == nil {
+			return
+		}
+		DebugLog("Discover query %v by %v fail with %v", host, server, err)
+	}
+	return
+}
+
+// lookupHost will resolve the host by DNSServers with DNSSearch and record ttl, or by system resolver with DNSTTL
+func (d *Discover) lookupHost(ctx context.Context, host string) (ips []string, ttl time.Duration, err error) {
+	if len(d.DNSServers) < 1 {
+		var addrs []net.IPAddr
+		if addrs, err = net.DefaultResolver.LookupIPAddr(ctx, host); err != nil {
+			return
+		}
+		for _, addr := range addrs {
+			if len(d.IPPrefer) < 1 || isIPv6(addr.IP.String()) == (d.IPPrefer == "ipv6") {
+				ips = append(ips, addr.IP.String())
+			}
+		}
+		ttl = d.DNSTTL
+	} else {
+		types := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+		switch d.IPPrefer {
+		case "ipv4":
+			types = types[:1]
+		case "ipv6":
+			types = types[1:]
+		}
+		for _, name := range dnsNames(host, d.DNSSearch, d.DNSNdots) {
+			for _, qtype := range types {
+				found, foundTTL, xerr := queryServers(ctx, d.DNSServers, name, qtype, d.DialTimeout)
+				if xerr != nil {
+					err = xerr
+					break
+				}
+				if len(found) > 0 && (ttl == 0 || foundTTL < ttl) {
+					ttl = foundTTL
+				}
+				ips = append(ips, found...)
+			}
+			if len(ips) > 0 {
+				err = nil
+				break
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+	if len(ips) < 1 {
+		err = fmt.Errorf("no address found for %v", host)
+		return
+	}
+	if ttl < d.DNSMinTTL {
+		ttl = d.DNSMinTTL
+	}
+	return
+}
+
+// resolveHost will resolve the dns name to addresses which are cached by ttl, the stale addresses are used when resolving is fail
+func (d *Discover) resolveHost(ctx context.Context, host string) (entry *dnsEntry, err error) {
+	d.dnsLock.Lock()
+	if d.dnsAll == nil {
+		d.dnsAll = map[string]*dnsEntry{}
+	}
+	entry = d.dnsAll[host]
+	d.dnsLock.Unlock()
+	if entry != nil && time.Now().Before(entry.Expire) {
+		return
+	}
+	ips, ttl, xerr := d.lookupHost(ctx, host)
+	d.dnsLock.Lock()
+	if xerr == nil {
+		entry = &dnsEntry{IPs: ips, Expire: time.Now().Add(ttl)}
+		d.dnsAll[host] = entry
+	} else if entry != nil {
+		WarnLog("Discover resolve %v fail with %v, the stale %v is used", host, xerr, entry.IPs)
+	}
+	d.dnsLock.Unlock()
+	if entry == nil {
+		err = xerr
+	}
+	return
+}
+
+// resolveAddress will resolve the dns name of address to one of addresses by round robin when DNSResolve is enabled,
+// the addresses are cached by ttl and the stale addresses are used when resolving is fail
+func (d *Discover) resolveAddress(ctx context.Context, address string) (resolved string, err error) {
+	resolved = address
+	if !d.DNSResolve {
+		return
+	}
+	host, port, xerr := net.SplitHostPort(address)
+	if xerr != nil || net.ParseIP(host) != nil {
+		return
+	}
+	entry, err := d.resolveHost(ctx, host)
+	if err != nil {
+		return
+	}
+	d.dnsLock.Lock()
+	ip := entry.IPs[entry.next%len(entry.IPs)]
+	entry.next++
+	d.dnsLock.Unlock()
+	resolved = joinHost(ip, port)
+	return
+}
+
+// dialResolved will dial the tcp/udp/unix forward address by IPPrefer network after resolving by DNSResolve
+func (d *Discover) dialResolved(network, address string) (conn net.Conn, err error) {
+	if network != "unix" && network != "unixgram" {
+		if address, err = d.resolveAddress(context.Background(), address); err != nil {
+			return
+		}
+	}
+	conn, err = net.DialTimeout(d.preferNetwork(network), address, d.DialTimeout)
+	return
+}
@@ -0,0 +1,217 @@
+package discover
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsReply will reply A record of question, the none.loc, *.nx and single label name is not existed, the big.loc is truncated on udp
+func dnsReply(query *dnsmessage.Message, ttl uint32, udp bool) (reply dnsmessage.Message) {
+	question := query.Questions[0]
+	reply = dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true},
+		Questions: query.Questions,
+	}
+	name := question.Name.String()
+	if name == "none.loc." || strings.HasSuffix(name, ".nx.") || strings.Count(name, ".") < 2 {
+		reply.RCode = dnsmessage.RCodeNameError
+	} else if name == "big.loc." && udp {
+		reply.Truncated = true
+	} else if question.Type == dnsmessage.TypeA {
+		ips := [][4]byte{{10, 0, 0, 1}, {10, 0, 0, 2}}
+		if name == "big.loc." {
+			ips = append(ips, [4]byte{10, 0, 0, 3})
+		}
+		for _, ip := range ips {
+			reply.Answers = append(reply.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+				Body:   &dnsmessage.AResource{A: ip},
+			})
+		}
+	}
+	return
+}
+
+func runTestDNS(t *testing.T, ttl uint32, queries *int32) (conn net.PacketConn) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buffer := make([]byte, 4096)
+		for {
+			n, from, err := conn.ReadFrom(buffer)
+			if err != nil {
+				ln.Close()
+				break
+			}
+			atomic.AddInt32(queries, 1)
+			query := dnsmessage.Message{}
+			if query.Unpack(buffer[:n]) != nil || len(query.Questions) < 1 {
+				continue
+			}
+			reply := dnsReply(&query, ttl, true)
+			packed, _ := reply.Pack()
+			conn.WriteTo(packed, from)
+		}
+	}()
+	go func() {
+		for {
+			tcp, err := ln.Accept()
+			if err != nil {
+				break
+			}
+			head := make([]byte, 2)
+			io.ReadFull(tcp, head)
+			data := make([]byte, binary.BigEndian.Uint16(head))
+			io.ReadFull(tcp, data)
+			query := dnsmessage.Message{}
+			if query.Unpack(data) == nil && len(query.Questions) > 0 {
+				reply := dnsReply(&query, ttl, false)
+				packed, _ := reply.Pack()
+				tcp.Write(append([]byte{byte(len(packed) >> 8), byte(len(packed))}, packed...))
+			}
+			tcp.Close()
+		}
+	}()
+	return
+}
+
+func TestResolveAddress(t *testing.T) {
+	var queries int32
+	server := runTestDNS(t, 60, &queries)
+	defer server.Close()
+	discover := NewDiscover()
+	//disabled
+	if resolved, err := discover.resolveAddress(context.Background(), "api.loc:80"); err != nil || resolved != "api.loc:80" {
+		t.Errorf("%v,%v", err, resolved)
+		return
+	}
+	discover.DNSResolve = true
+	discover.DNSServers = []string{server.LocalAddr().String()}
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		resolved, err := discover.resolveAddress(context.Background(), "api.loc:80")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		seen[resolved]++
+	}
+	if seen["10.0.0.1:80"] != 2 || seen["10.0.0.2:80"] != 2 || atomic.LoadInt32(&queries) != 2 {
+		t.Errorf("%v,%v", seen, queries)
+		return
+	}
+	if resolved, _ := discover.resolveAddress(context.Background(), "127.0.0.1:80"); resolved != "127.0.0.1:80" {
+		t.Error(resolved)
+		return
+	}
+	if _, err := discover.resolveAddress(context.Background(), "none.loc:80"); err == nil {
+		t.Error("error")
+		return
+	}
+	//stale
+	discover.dnsAll["api.loc"].Expire = time.Now().Add(-time.Second)
+	discover.DNSServers = []string{"127.0.0.1:1"}
+	discover.DialTimeout = 100 * time.Millisecond
+	if resolved, err := discover.resolveAddress(context.Background(), "api.loc:80"); err != nil || resolved != "10.0.0.1:80" {
+		t.Errorf("%v,%v", err, resolved)
+		return
+	}
+	//system resolver
+	discover.DNSServers = nil
+	if resolved, err := discover.resolveAddress(context.Background(), "localhost:80"); err != nil || resolved == "localhost:80" {
+		t.Errorf("%v,%v", err, resolved)
+		return
+	}
+}
+
+func TestResolveTTL(t *testing.T) {
+	var queries int32
+	server := runTestDNS(t, 0, &queries)
+	defer server.Close()
+	discover := NewDiscover()
+	discover.DNSResolve = true
+	discover.DNSServers = []string{server.LocalAddr().String()}
+	discover.DNSMinTTL = 50 * time.Millisecond
+	discover.resolveAddress(context.Background(), "api.loc:80")
+	discover.resolveAddress(context.Background(), "api.loc:80")
+	if atomic.LoadInt32(&queries) != 2 {
+		t.Error(queries)
+		return
+	}
+	time.Sleep(100 * time.Millisecond)
+	discover.resolveAddress(context.Background(), "api.loc:80")
+	if atomic.LoadInt32(&queries) != 4 {
+		t.Error(queries)
+		return
+	}
+	if _, ok := forwardOptions["UPSTREAM"]; ok {
+		t.Error("upstream label is supported")
+		return
+	}
+}
+
+func TestResolveSearch(t *testing.T) {
+	var queries int32
+	server := runTestDNS(t, 60, &queries)
+	defer server.Close()
+	discover := NewDiscover()
+	discover.DNSServers = []string{"127.0.0.1:1", server.LocalAddr().String()}
+	discover.DialTimeout = 500 * time.Millisecond
+	discover.IPPrefer = "ipv4"
+	//fallback
+	if ips, _, err := discover.lookupHost(context.Background(), "api.loc"); err != nil || len(ips) != 2 {
+		t.Errorf("%v,%v", err, ips)
+		return
+	}
+	//search
+	if _, _, err := discover.lookupHost(context.Background(), "svc"); err == nil {
+		t.Error(err)
+		return
+	}
+	discover.DNSSearch = []string{"nx", "corp.loc"}
+	if ips, _, err := discover.lookupHost(context.Background(), "svc"); err != nil || len(ips) != 2 {
+		t.Errorf("%v,%v", err, ips)
+		return
+	}
+	if names := dnsNames("a.b", []string{"corp.loc"}, 1); len(names) != 2 || names[0] != "a.b" || names[1] != "a.b.corp.loc" {
+		t.Error(names)
+		return
+	}
+	if names := dnsNames("a.b", []string{"corp.loc"}, 2); len(names) != 2 || names[0] != "a.b.corp.loc" {
+		t.Error(names)
+		return
+	}
+	if names := dnsNames("a.", []string{"corp.loc"}, 1); len(names) != 1 || names[0] != "a." {
+		t.Error(names)
+		return
+	}
+	//truncated
+	if ips, _, err := discover.lookupHost(context.Background(), "big.loc"); err != nil || len(ips) != 3 {
+		t.Errorf("%v,%v", err, ips)
+		return
+	}
+	//resolv.conf
+	conf := ParseResolvConf("# comment\nnameserver 10.0.0.1\nnameserver ::1\nsearch a.loc b.loc\noptions timeout:1 ndots:3\n")
+	if len(conf.Servers) != 2 || conf.Servers[1] != "[::1]:53" || len(conf.Search) != 2 || conf.Ndots != 3 {
+		t.Error(conf)
+		return
+	}
+	if conf = ParseResolvConf(""); conf.Ndots != 1 || len(conf.Servers) != 0 {
+		t.Error(conf)
+		return
+	}
+}
@@ -0,0 +1,111 @@
+package discover
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// dockerLimiter is the token bucket of docker api calls, it is shared by discovery, cleanup and /_s endpoints
+type dockerLimiter struct {
+	Rate     float64
+	Burst    int
+	tokens   float64
+	last     time.Time
+	calls    int64
+	waited   int64
+	waitTime time.Duration
+	lock     sync.Mutex
+}
+
+// reserve will take one token and return the duration to wait for it
+func (l *dockerLimiter) reserve(now time.Time) (wait time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	burst := float64(l.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * l.Rate
+		if l.tokens > burst {
+			l.tokens = burst
+		}
+	}
+	l.last = now
+	l.tokens--
+	l.calls++
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.Rate * float64(time.Second))
+		l.waited++
+		l.waitTime += wait
+	}
+	return
+}
+
+// cancel will give back the token which is reserved but not used
+func (l *dockerLimiter) cancel() {
+	l.lock.Lock()
+	l.tokens++
+	l.lock.Unlock()
+}
+
+// dockerTransport will wait the token of dockerLimiter before each docker api call
+type dockerTransport struct {
+	Next    http.RoundTripper
+	Limiter *dockerLimiter
+}
+
+func (t *dockerTransport) RoundTrip(req *http.Request) (res *http.Response, err error) {
+	if wait := t.Limiter.reserve(time.Now()); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			t.Limiter.cancel()
+			err = req.Context().Err()
+			return
+		}
+	}
+	res, err = t.Next.RoundTrip(req)
+	return
+}
+
+// limitDocker will wrap the transport of docker client by DockerRate limiter, the limiter is shared by all docker clients
+func (d *Discover) limitDocker(next http.RoundTripper) http.RoundTripper {
+	if d.DockerRate <= 0 {
+		return next
+	}
+	d.dockerLimitLock.Lock()
+	defer d.dockerLimitLock.Unlock()
+	if d.dockerLimiter == nil {
+		d.dockerLimiter = &dockerLimiter{Rate: d.DockerRate, Burst: d.DockerBurst}
+	}
+	return &dockerTransport{Next: next, Limiter: d.dockerLimiter}
+}
+
+func (d *Discover) writeDockerLimitMetrics(w io.Writer) {
+	d.dockerLimitLock.Lock()
+	limiter := d.dockerLimiter
+	d.dockerLimitLock.Unlock()
+	if limiter == nil {
+		return
+	}
+	limiter.lock.Lock()
+	calls, waited, waitTime := limiter.calls, limiter.waited, limiter.waitTime
+	limiter.lock.Unlock()
+	fmt.Fprintf(w, "# HELP pdservice_docker_calls_total The total number of docker api calls.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_docker_calls_total counter\n")
+	fmt.Fprintf(w, "pdservice_docker_calls_total %v\n", calls)
+	fmt.Fprintf(w, "# HELP pdservice_docker_throttled_total The total number of docker api calls delayed by docker_rate.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_docker_throttled_total counter\n")
+	fmt.Fprintf(w, "pdservice_docker_throttled_total %v\n", waited)
+	fmt.Fprintf(w, "# HELP pdservice_docker_throttled_seconds_total The total time of docker api calls delayed by docker_rate.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_docker_throttled_seconds_total counter\n")
+	fmt.Fprintf(w, "pdservice_docker_throttled_seconds_total %v\n", waitTime.Seconds())
+}
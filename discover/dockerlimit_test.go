@@ -0,0 +1,75 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDockerLimiter(t *testing.T) {
+	limiter := &dockerLimiter{Rate: 10, Burst: 2}
+	now := time.Now()
+	if limiter.reserve(now) != 0 || limiter.reserve(now) != 0 {
+		t.Error("wait")
+		return
+	}
+	if wait := limiter.reserve(now); wait != 100*time.Millisecond {
+		t.Error(wait)
+		return
+	}
+	if wait := limiter.reserve(now.Add(time.Second)); wait != 0 {
+		t.Error(wait)
+		return
+	}
+	if limiter.calls != 4 || limiter.waited != 1 {
+		t.Error(limiter.calls, limiter.waited)
+		return
+	}
+}
+
+func TestDockerTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	discover := NewDiscover()
+	if discover.limitDocker(http.DefaultTransport) != http.DefaultTransport {
+		t.Error("limited")
+		return
+	}
+	discover.DockerRate = 20
+	discover.DockerBurst = 1
+	client := &http.Client{Transport: discover.limitDocker(http.DefaultTransport)}
+	begin := time.Now()
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(ts.URL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		res.Body.Close()
+	}
+	if used := time.Since(begin); used < 90*time.Millisecond {
+		t.Error(used)
+		return
+	}
+	//canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+	discover.dockerLimiter.tokens = -10
+	if _, err := client.Do(req); err == nil {
+		t.Error("error")
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	discover.WriteMetrics(buf)
+	if !strings.Contains(buf.String(), "pdservice_docker_calls_total 4\n") {
+		t.Error(buf.String())
+		return
+	}
+}
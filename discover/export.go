@@ -0,0 +1,146 @@
+package discover
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/codingeasygo/util/debug"
+)
+
+// ExportFormats is the supported format of catalog export
+var ExportFormats = []string{"hosts", "dnsmasq", "unbound"}
+
+// ParseExports will parse the export file by <format>=<file>, the format is hosts/dnsmasq/unbound
+func ParseExports(exports []string) (parsed map[string]string, err error) {
+	parsed = map[string]string{}
+	for _, export := range exports {
+		parts := strings.SplitN(export, "=", 2)
+		if len(parts) != 2 || len(parts[1]) < 1 || !validExportFormat(parts[0]) {
+			err = fmt.Errorf("invalid export %v, must be hosts|dnsmasq|unbound=<file>", export)
+			return
+		}
+		parsed[parts[0]] = parts[1]
+	}
+	return
+}
+
+func validExportFormat(format string) bool {
+	for _, f := range ExportFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// exportHosts will return the sorted host of http forward and HostSelf, the wildcard host is mapped to true
+func (d *Discover) exportHosts() (hosts []string, wildcard map[string]bool) {
+	wildcard = map[string]bool{}
+	add := func(host string, isWildcard bool) {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if len(host) < 1 || net.ParseIP(host) != nil {
+			return
+		}
+		if _, ok := wildcard[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		wildcard[host] = wildcard[host] || isWildcard
+	}
+	d.proxyLock.RLock()
+	for _, all := range []map[string]*ReverseProxy{d.proxyReverse, d.proxyDefault, d.proxyAlias} {
+		for host, reverse := range all {
+			add(host, reverse.Forward != nil && reverse.Forward.Wildcard)
+		}
+	}
+	d.proxyLock.RUnlock()
+	add(d.HostSelf, false)
+	for _, tenant := range d.Tenants {
+		add(tenant.HostSelf, false)
+	}
+	sort.Strings(hosts)
+	return
+}
+
+// RenderExport will render the catalog host to ExportAddr by format, the hosts format is /etc/hosts fragment
+// which is not support wildcard, the dnsmasq format is address= line and the unbound format is local-zone/local-data
+func (d *Discover) RenderExport(format string) (out []byte, err error) {
+	if net.ParseIP(d.ExportAddr) == nil {
+		err = fmt.Errorf("export addr %v is not ip", d.ExportAddr)
+		return
+	}
+	record := "A"
+	if strings.Contains(d.ExportAddr, ":") {
+		record = "AAAA"
+	}
+	hosts, wildcard := d.exportHosts()
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "# generated by pdservice, do not edit\n")
+	switch format {
+	case "hosts":
+		for _, host := range hosts {
+			fmt.Fprintf(buf, "%v %v\n", d.ExportAddr, host)
+		}
+	case "dnsmasq":
+		for _, host := range hosts {
+			fmt.Fprintf(buf, "address=/%v/%v\n", host, d.ExportAddr)
+		}
+	case "unbound":
+		for _, host := range hosts {
+			if wildcard[host] {
+				fmt.Fprintf(buf, "local-zone: \"%v.\" redirect\n", host)
+			}
+			fmt.Fprintf(buf, "local-data: \"%v. %v %v\"\n", host, record, d.ExportAddr)
+		}
+	default:
+		err = fmt.Errorf("export format %v is not supported", format)
+		return
+	}
+	out = buf.Bytes()
+	return
+}
+
+// callExport will write the export file by Exports when it is changed and call ExportTrigger with PD_EXPORT_FILES env
+func (d *Discover) callExport() {
+	defer func() {
+		if xerr := recover(); xerr != nil {
+			ErrorLog("Discover call export panic with %v, call stack is:\n%v", xerr, debug.CallStatck())
+		}
+	}()
+	changed := []string{}
+	for _, format := range ExportFormats {
+		file, ok := d.Exports[format]
+		if !ok {
+			continue
+		}
+		out, err := d.RenderExport(format)
+		if err != nil {
+			WarnLog("Discover render export %v fail with %v", format, err)
+			continue
+		}
+		if old, xerr := ioutil.ReadFile(file); xerr == nil && bytes.Equal(old, out) {
+			continue
+		}
+		if err = ioutil.WriteFile(file, out, 0644); err != nil {
+			WarnLog("Discover write export %v to %v fail with %v", format, file, err)
+			continue
+		}
+		InfoLog("Discover write export %v to %v success", format, file)
+		changed = append(changed, file)
+	}
+	if len(changed) < 1 || len(d.ExportTrigger) < 1 {
+		return
+	}
+	env := []string{fmt.Sprintf("%v=%v", "PD_EXPORT_FILES", strings.Join(changed, ","))}
+	info, err := d.runTrigger(d.ExportTrigger, env, nil)
+	if err != nil {
+		WarnLog("Discover call export trigger fail with %v by\n\tCMD:%v\n\tENV:%v\n\tOut:\n%v", err, d.ExportTrigger, env, string(info))
+	} else {
+		InfoLog("Discover call export trigger success by\n\tCMD:%v\n\tENV:%v\n\tOut:\n%v", d.ExportTrigger, env, string(info))
+	}
+}
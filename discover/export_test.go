@@ -0,0 +1,86 @@
+package discover
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	exports, err := ParseExports([]string{"hosts=/tmp/hosts", "dnsmasq=/tmp/dnsmasq.conf"})
+	if err != nil || len(exports) != 2 {
+		t.Error(err, exports)
+		return
+	}
+	for _, export := range []string{"xx=/tmp/a", "hosts", "hosts="} {
+		if _, err = ParseExports([]string{export}); err == nil {
+			t.Error(export)
+			return
+		}
+	}
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv.example.com:443"
+	discover.ExportAddr = "10.0.0.1"
+	discover.proxyReverse["v1.ds.example.com"] = &ReverseProxy{Forward: &Forward{Prefix: "v1.ds"}}
+	discover.proxyReverse["app.example.com"] = &ReverseProxy{Forward: &Forward{Prefix: "app", Wildcard: true}}
+	discover.proxyAlias["docs.example.com"] = &ReverseProxy{Forward: &Forward{Prefix: "v1.ds"}}
+	for format, expect := range map[string]string{
+		"hosts":   "10.0.0.1 app.example.com\n10.0.0.1 docs.example.com\n10.0.0.1 pdsrv.example.com\n10.0.0.1 v1.ds.example.com\n",
+		"dnsmasq": "address=/app.example.com/10.0.0.1\naddress=/docs.example.com/10.0.0.1\naddress=/pdsrv.example.com/10.0.0.1\naddress=/v1.ds.example.com/10.0.0.1\n",
+		"unbound": "local-zone: \"app.example.com.\" redirect\nlocal-data: \"app.example.com. A 10.0.0.1\"\nlocal-data: \"docs.example.com. A 10.0.0.1\"\nlocal-data: \"pdsrv.example.com. A 10.0.0.1\"\nlocal-data: \"v1.ds.example.com. A 10.0.0.1\"\n",
+	} {
+		out, err := discover.RenderExport(format)
+		if err != nil || strings.TrimPrefix(string(out), "# generated by pdservice, do not edit\n") != expect {
+			t.Error(format, err, string(out))
+			return
+		}
+	}
+	if _, err = discover.RenderExport("xx"); err == nil {
+		t.Error(err)
+		return
+	}
+	discover.ExportAddr = "fd00::1"
+	if out, _ := discover.RenderExport("unbound"); !strings.Contains(string(out), "AAAA fd00::1") {
+		t.Error(string(out))
+		return
+	}
+	discover.ExportAddr = "xx"
+	if _, err = discover.RenderExport("hosts"); err == nil {
+		t.Error(err)
+		return
+	}
+	discover.ExportAddr = "10.0.0.1"
+	//file and trigger
+	dir, _ := ioutil.TempDir("", "export")
+	defer os.RemoveAll(dir)
+	discover.Exports = map[string]string{"hosts": filepath.Join(dir, "hosts"), "dnsmasq": filepath.Join(dir, "dnsmasq.conf")}
+	discover.TriggerMode = "shell"
+	discover.ExportTrigger = filepath.Join(dir, "trigger.sh")
+	ioutil.WriteFile(discover.ExportTrigger, []byte("echo $PD_EXPORT_FILES >> "+filepath.Join(dir, "trigger.log")), os.ModePerm)
+	discover.callExport()
+	discover.callExport()
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "trigger.log"))
+	if string(data) != filepath.Join(dir, "hosts")+","+filepath.Join(dir, "dnsmasq.conf")+"\n" {
+		t.Error(string(data))
+		return
+	}
+	if data, _ = ioutil.ReadFile(filepath.Join(dir, "dnsmasq.conf")); !strings.Contains(string(data), "address=/app.example.com/10.0.0.1") {
+		t.Error(string(data))
+		return
+	}
+	//api
+	discover.AdminToken = "123"
+	discover.HostSelf = "pdsrv"
+	req := httptest.NewRequest("GET", "http://pdsrv/_api/export/hosts", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "10.0.0.1 app.example.com") {
+		t.Error(res.Code, res.Body.String())
+		return
+	}
+}
@@ -0,0 +1,102 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// ContainerFilter will filter out the container by returning false or rewrite the container forwards/metadata
+// before it is applied by Refresh, the forwards are re-keyed by Forward.Prefix after filter
+type ContainerFilter func(container *Container) (*Container, bool)
+
+// AddFilter will register the container filter, the filters are called by registered order
+func (d *Discover) AddFilter(filter ContainerFilter) {
+	d.filterLock.Lock()
+	d.Filters = append(d.Filters, filter)
+	d.filterLock.Unlock()
+}
+
+// applyFilters will call filters on each discovered container and return the forward prefix to container map
+func (d *Discover) applyFilters(all map[string]*Container) (filtered map[string]*Container) {
+	d.filterLock.RLock()
+	filters := d.Filters
+	d.filterLock.RUnlock()
+	if len(filters) < 1 {
+		filtered = all
+		return
+	}
+	containers := []*Container{}
+	added := map[*Container]bool{}
+	for _, container := range all {
+		if !added[container] {
+			added[container] = true
+			containers = append(containers, container)
+		}
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].ID < containers[j].ID
+	})
+	filtered = map[string]*Container{}
+	for _, container := range containers {
+		name, id := container.Name, container.ID
+		keep := true
+		for _, filter := range filters {
+			container, keep = filter(container)
+			if !keep || container == nil {
+				keep = false
+				break
+			}
+		}
+		if !keep {
+			DebugLog("Discover filter out container %v/%v", name, id)
+			continue
+		}
+		forwards := map[string]*Forward{}
+		for _, forward := range container.Forwards {
+			forwards[forward.Prefix] = forward
+			filtered[forward.Prefix] = container
+		}
+		container.Forwards = forwards
+	}
+	return
+}
+
+// NewExecFilter will create the container filter by exec plugin, the container is passed as json on stdin,
+// the plugin should write the rewritten container json to stdout or nothing to filter out the container,
+// the container is kept without change when plugin is fail
+func (d *Discover) NewExecFilter(command string) (filter ContainerFilter, err error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return
+	}
+	filter = func(container *Container) (*Container, bool) {
+		data, _ := json.Marshal(container)
+		ctx, cancel := context.WithTimeout(context.Background(), d.TriggerTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdin = bytes.NewReader(data)
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		out, xerr := cmd.Output()
+		if xerr != nil {
+			WarnLog("Discover filter %v/%v by %v fail with %v, %v", container.Name, container.ID, command, xerr, strings.TrimSpace(stderr.String()))
+			return container, true
+		}
+		out = bytes.TrimSpace(out)
+		if len(out) < 1 || string(out) == "null" {
+			return nil, false
+		}
+		rewrite := &Container{}
+		if xerr = json.Unmarshal(out, rewrite); xerr != nil {
+			WarnLog("Discover filter %v/%v by %v fail with %v", container.Name, container.ID, command, fmt.Errorf("parse output %v", xerr))
+			return container, true
+		}
+		return rewrite, true
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package discover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	discover := NewDiscover()
+	ds := &Container{ID: "c1", Name: "ds", Forwards: map[string]*Forward{"v100.ds": {Prefix: "v100.ds"}}}
+	xs := &Container{ID: "c2", Name: "xs", Forwards: map[string]*Forward{"v100.xs": {Prefix: "v100.xs"}}}
+	all := map[string]*Container{"v100.ds": ds, "v100.xs": xs}
+	if filtered := discover.applyFilters(all); len(filtered) != 2 {
+		t.Error(filtered)
+		return
+	}
+	discover.AddFilter(func(container *Container) (*Container, bool) {
+		return container, container.Name != "xs"
+	})
+	discover.AddFilter(func(container *Container) (*Container, bool) {
+		for _, forward := range container.Forwards {
+			forward.Prefix = "x." + forward.Prefix
+		}
+		return container, true
+	})
+	filtered := discover.applyFilters(all)
+	if len(filtered) != 1 || filtered["x.v100.ds"] != ds || ds.Forwards["x.v100.ds"] == nil {
+		t.Error(filtered)
+		return
+	}
+	//exec
+	if _, err := discover.NewExecFilter("'xx"); err == nil {
+		t.Error("nil")
+		return
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	dir, _ := ioutil.TempDir("", "filter")
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "filter.sh")
+	ioutil.WriteFile(script, []byte("#!/bin/sh\nread data\ncase \"$data\" in\n*'\"xs\"'*) ;;\n*) echo \"$data\" | sed 's/v100/v200/g' ;;\nesac\n"), 0755)
+	filter, err := discover.NewExecFilter(script)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if container, keep := filter(xs); keep || container != nil {
+		t.Error(container, keep)
+		return
+	}
+	container, keep := filter(&Container{ID: "c3", Name: "ds", Forwards: map[string]*Forward{"v100.ds": {Prefix: "v100.ds"}}})
+	if !keep || container.Forwards["v200.ds"] == nil || container.Forwards["v200.ds"].Prefix != "v200.ds" {
+		t.Error(container, keep)
+		return
+	}
+	fail, _ := discover.NewExecFilter(filepath.Join(dir, "none"))
+	if container, keep := fail(xs); !keep || container != xs {
+		t.Error(container, keep)
+		return
+	}
+}
@@ -0,0 +1,244 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// FlapStats is the churn and health statistics of service in FlapWindow, the Budget is the remaining error budget ratio
+// of health checks by FlapObjective which is negative when the budget is exhausted
+type FlapStats struct {
+	Name        string    `json:"name"`
+	Added       int       `json:"added"`
+	Removed     int       `json:"removed"`
+	Restarts    int       `json:"restarts"`
+	Checks      int       `json:"checks"`
+	Failures    int       `json:"failures"`
+	FailureRate float64   `json:"failure_rate"`
+	Budget      float64   `json:"budget"`
+	Flapping    bool      `json:"flapping"`
+	AlertedAt   time.Time `json:"alerted_at,omitempty"`
+}
+
+// Flaps will return the add/remove/restart count in window
+func (f *FlapStats) Flaps() int {
+	return f.Added + f.Removed + f.Restarts
+}
+
+type flapEvent struct {
+	At   time.Time
+	Kind string
+}
+
+type flapState struct {
+	Events    []flapEvent
+	Started   map[string]string
+	Service   *Container
+	AlertedAt time.Time
+}
+
+// recordFlap will record the add/remove churn, restart by changed StartedAt and health check of services by name after refresh,
+// the flapping alert is sent when the churn in FlapWindow is reached FlapThreshold
+func (d *Discover) recordFlap(all, added, removed map[string]*Container) {
+	if d.FlapWindow < 1 {
+		return
+	}
+	now := time.Now()
+	running := map[string]map[string]*Container{}
+	for _, service := range all {
+		if running[service.Name] == nil {
+			running[service.Name] = map[string]*Container{}
+		}
+		running[service.Name][service.ID] = service
+	}
+	kinds := map[string]map[string]bool{}
+	for kind, services := range map[string]map[string]*Container{"added": added, "removed": removed} {
+		for _, service := range services {
+			if kinds[service.Name] == nil {
+				kinds[service.Name] = map[string]bool{}
+			}
+			kinds[service.Name][kind] = true
+		}
+	}
+	health := map[string]bool{}
+	for _, services := range running {
+		for id, service := range services {
+			health[id] = d.checkHealthy(service)
+		}
+	}
+	alerts := []*FlapStats{}
+	d.flapLock.Lock()
+	if d.flapAll == nil {
+		d.flapAll = map[string]*flapState{}
+	}
+	for name := range running {
+		if d.flapAll[name] == nil {
+			d.flapAll[name] = &flapState{Started: map[string]string{}}
+		}
+	}
+	for name := range kinds {
+		if d.flapAll[name] == nil {
+			d.flapAll[name] = &flapState{Started: map[string]string{}}
+		}
+	}
+	for name, state := range d.flapAll {
+		for kind := range kinds[name] {
+			state.Events = append(state.Events, flapEvent{At: now, Kind: kind})
+		}
+		started := map[string]string{}
+		for id, service := range running[name] {
+			if last, ok := state.Started[id]; ok && last != service.StartedAt {
+				state.Events = append(state.Events, flapEvent{At: now, Kind: "restart"})
+			}
+			started[id] = service.StartedAt
+			state.Events = append(state.Events, flapEvent{At: now, Kind: "check"})
+			if !health[id] {
+				state.Events = append(state.Events, flapEvent{At: now, Kind: "failure"})
+			}
+			state.Service = service
+		}
+		state.Started = started
+		if state.Service == nil {
+			for _, service := range removed {
+				if service.Name == name {
+					state.Service = service
+				}
+			}
+		}
+		i := 0
+		for i < len(state.Events) && now.Sub(state.Events[i].At) > d.FlapWindow {
+			i++
+		}
+		state.Events = state.Events[i:]
+		if len(state.Events) < 1 && len(running[name]) < 1 {
+			delete(d.flapAll, name)
+			continue
+		}
+		stats := d.flapStats(name, state)
+		if d.FlapThreshold < 1 {
+			continue
+		}
+		if stats.Flaps() >= d.FlapThreshold && state.AlertedAt.IsZero() {
+			state.AlertedAt = now
+			stats.AlertedAt = now
+			alerts = append(alerts, &stats)
+		} else if stats.Flaps() < d.FlapThreshold && !state.AlertedAt.IsZero() {
+			state.AlertedAt = time.Time{}
+			InfoLog("Discover service %v is recovered from flapping", name)
+		}
+	}
+	services := map[string]*Container{}
+	for _, stats := range alerts {
+		services[stats.Name] = d.flapAll[stats.Name].Service
+	}
+	d.flapLock.Unlock()
+	for _, stats := range alerts {
+		WarnLog("Discover service %v is flapping by %v added, %v removed, %v restarts in %v", stats.Name, stats.Added, stats.Removed, stats.Restarts, d.FlapWindow)
+		d.notifyFlap(services[stats.Name], stats)
+	}
+}
+
+// flapStats will count the events of state, it must be called with flapLock
+func (d *Discover) flapStats(name string, state *flapState) (stats FlapStats) {
+	stats.Name = name
+	stats.AlertedAt = state.AlertedAt
+	for _, event := range state.Events {
+		switch event.Kind {
+		case "added":
+			stats.Added++
+		case "removed":
+			stats.Removed++
+		case "restart":
+			stats.Restarts++
+		case "check":
+			stats.Checks++
+		case "failure":
+			stats.Failures++
+		}
+	}
+	if stats.Checks > 0 {
+		stats.FailureRate = float64(stats.Failures) / float64(stats.Checks)
+	}
+	stats.Budget = 1
+	if d.FlapObjective > 0 && d.FlapObjective < 1 {
+		stats.Budget = 1 - stats.FailureRate/(1-d.FlapObjective)
+	}
+	stats.Flapping = d.FlapThreshold > 0 && stats.Flaps() >= d.FlapThreshold
+	return
+}
+
+// notifyFlap will call the flapping webhook of container and FlapHook
+func (d *Discover) notifyFlap(service *Container, stats *FlapStats) {
+	info := xmap.M{
+		"event":        "flapping",
+		"name":         stats.Name,
+		"added":        stats.Added,
+		"removed":      stats.Removed,
+		"restarts":     stats.Restarts,
+		"failure_rate": stats.FailureRate,
+		"budget":       stats.Budget,
+		"window":       fmt.Sprintf("%v", d.FlapWindow),
+	}
+	uris := []string{d.FlapHook}
+	if service != nil {
+		info["id"] = service.ID
+		info["version"] = service.Version
+		uris = append(uris, service.Hooks["flapping"])
+	} else {
+		service = &Container{Name: stats.Name}
+	}
+	data, _ := json.Marshal(info)
+	for _, uri := range uris {
+		if len(uri) > 0 {
+			go d.callHook(service, "flapping", uri, data)
+		}
+	}
+}
+
+// FlapStats will return the flapping statistics of all services in FlapWindow, sorted by name
+func (d *Discover) FlapStats() (all []FlapStats) {
+	all = []FlapStats{}
+	d.flapLock.Lock()
+	for name, state := range d.flapAll {
+		all = append(all, d.flapStats(name, state))
+	}
+	d.flapLock.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return
+}
+
+// writeFlapMetrics will write the flapping statistics by prometheus text format
+func (d *Discover) writeFlapMetrics(w io.Writer) {
+	all := d.FlapStats()
+	fmt.Fprintf(w, "# HELP pdservice_service_flaps The add/remove/restart count of service in flap window.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_service_flaps gauge\n")
+	for _, stats := range all {
+		fmt.Fprintf(w, "pdservice_service_flaps{service=%q,kind=\"added\"} %v\n", stats.Name, stats.Added)
+		fmt.Fprintf(w, "pdservice_service_flaps{service=%q,kind=\"removed\"} %v\n", stats.Name, stats.Removed)
+		fmt.Fprintf(w, "pdservice_service_flaps{service=%q,kind=\"restart\"} %v\n", stats.Name, stats.Restarts)
+	}
+	fmt.Fprintf(w, "# HELP pdservice_service_health_failure_ratio The health check failure ratio of service in flap window.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_service_health_failure_ratio gauge\n")
+	for _, stats := range all {
+		fmt.Fprintf(w, "pdservice_service_health_failure_ratio{service=%q} %v\n", stats.Name, stats.FailureRate)
+	}
+	fmt.Fprintf(w, "# HELP pdservice_service_error_budget The remaining error budget ratio of service in flap window.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_service_error_budget gauge\n")
+	for _, stats := range all {
+		fmt.Fprintf(w, "pdservice_service_error_budget{service=%q} %v\n", stats.Name, stats.Budget)
+	}
+	fmt.Fprintf(w, "# HELP pdservice_service_flapping Whether the service is flapping.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_service_flapping gauge\n")
+	for _, stats := range all {
+		flapping := 0
+		if stats.Flapping {
+			flapping = 1
+		}
+		fmt.Fprintf(w, "pdservice_service_flapping{service=%q} %v\n", stats.Name, flapping)
+	}
+}
@@ -0,0 +1,88 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlap(t *testing.T) {
+	events := make(chan map[string]interface{}, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		info := map[string]interface{}{}
+		json.Unmarshal(data, &info)
+		events <- info
+	}))
+	defer ts.Close()
+	discover := NewDiscover()
+	discover.FlapThreshold = 3
+	discover.FlapHook = ts.URL
+	service := &Container{ID: "c1", Name: "svc", Version: "1.0.0", StartedAt: "t1", Forwards: map[string]*Forward{}}
+	all := map[string]*Container{"svc.1": service}
+	discover.recordFlap(all, all, map[string]*Container{})
+	if stats := discover.FlapStats(); len(stats) != 1 || stats[0].Added != 1 || stats[0].Checks != 1 || stats[0].Flapping {
+		t.Error(stats)
+		return
+	}
+	//restart by changed started at
+	restarted := &Container{ID: "c1", Name: "svc", Version: "1.0.0", StartedAt: "t2", Health: "unhealthy", Forwards: map[string]*Forward{}}
+	discover.recordFlap(map[string]*Container{"svc.1": restarted}, map[string]*Container{}, map[string]*Container{})
+	stats := discover.FlapStats()[0]
+	if stats.Restarts != 1 || stats.Checks != 2 || stats.Failures != 1 || stats.FailureRate != 0.5 || stats.Budget >= 0 {
+		t.Error(stats)
+		return
+	}
+	//removed and alert
+	discover.recordFlap(map[string]*Container{}, map[string]*Container{}, map[string]*Container{"svc.1": restarted})
+	stats = discover.FlapStats()[0]
+	if !stats.Flapping || stats.Removed != 1 || stats.AlertedAt.IsZero() {
+		t.Error(stats)
+		return
+	}
+	select {
+	case info := <-events:
+		if info["event"] != "flapping" || info["name"] != "svc" || info["id"] != "c1" {
+			t.Error(info)
+			return
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("not alerted")
+		return
+	}
+	//not alert again
+	discover.recordFlap(map[string]*Container{}, map[string]*Container{}, map[string]*Container{})
+	select {
+	case info := <-events:
+		t.Error(info)
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+	//metrics
+	buf := bytes.NewBuffer(nil)
+	discover.WriteMetrics(buf)
+	if !strings.Contains(buf.String(), `pdservice_service_flapping{service="svc"} 1`) || !strings.Contains(buf.String(), `pdservice_service_flaps{service="svc",kind="restart"} 1`) {
+		t.Error(buf.String())
+		return
+	}
+	//window expired
+	discover.FlapWindow = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	discover.recordFlap(map[string]*Container{}, map[string]*Container{}, map[string]*Container{})
+	if stats := discover.FlapStats(); len(stats) != 0 {
+		t.Error(stats)
+		return
+	}
+	//disabled
+	discover.FlapWindow = 0
+	discover.recordFlap(all, all, map[string]*Container{})
+	if stats := discover.FlapStats(); len(stats) != 0 {
+		t.Error(stats)
+		return
+	}
+}
@@ -0,0 +1,375 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// GeoIP is the reader of MaxMind DB(mmdb) file to lookup the country of ip
+type GeoIP struct {
+	buffer     []byte
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// OpenGeoIP will open the MaxMind DB file, the GeoLite2-Country/GeoIP2-Country/GeoLite2-City is supported
+func OpenGeoIP(filename string) (geo *GeoIP, err error) {
+	buffer, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	geo, err = NewGeoIP(buffer)
+	return
+}
+
+// NewGeoIP will create GeoIP by MaxMind DB data
+func NewGeoIP(buffer []byte) (geo *GeoIP, err error) {
+	index := bytes.LastIndex(buffer, mmdbMetadataMarker)
+	if index < 0 {
+		err = fmt.Errorf("invalid mmdb file, metadata is not found")
+		return
+	}
+	metaDecoder := &mmdbDecoder{buffer: buffer[index+len(mmdbMetadataMarker):]}
+	metaVal, _, err := metaDecoder.decode(0)
+	if err != nil {
+		return
+	}
+	meta, ok := metaVal.(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("invalid mmdb metadata")
+		return
+	}
+	geo = &GeoIP{buffer: buffer}
+	geo.nodeCount = uint(mmdbUint(meta["node_count"]))
+	geo.recordSize = uint(mmdbUint(meta["record_size"]))
+	geo.ipVersion = uint(mmdbUint(meta["ip_version"]))
+	if geo.recordSize != 24 && geo.recordSize != 28 && geo.recordSize != 32 {
+		err = fmt.Errorf("invalid mmdb record size %v", geo.recordSize)
+		return
+	}
+	treeSize := geo.nodeCount * geo.recordSize / 4
+	if treeSize+16 > uint(index) {
+		err = fmt.Errorf("invalid mmdb node count %v", geo.nodeCount)
+		return
+	}
+	geo.tree = buffer[:treeSize]
+	geo.data = buffer[treeSize+16 : index]
+	if geo.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < geo.nodeCount; i++ {
+			node = geo.readNode(node, 0)
+		}
+		geo.ipv4Start = node
+	}
+	return
+}
+
+func (g *GeoIP) readNode(node, bit uint) uint {
+	offset := node * g.recordSize / 4
+	b := g.tree[offset:]
+	switch g.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5])
+	case 28:
+		if bit == 0 {
+			return (uint(b[3])&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return (uint(b[3])&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4]))
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8]))
+	}
+}
+
+// Lookup will lookup the record of ip, nil is returned when not found
+func (g *GeoIP) Lookup(ip net.IP) (record map[string]interface{}, err error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		node = g.ipv4Start
+	} else if g.ipVersion == 4 {
+		return
+	}
+	bits := uint(len(ip) * 8)
+	for i := uint(0); i < bits && node < g.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-(i&7))) & 1
+		node = g.readNode(node, bit)
+	}
+	if node <= g.nodeCount {
+		return
+	}
+	offset := node - g.nodeCount - 16
+	if offset >= uint(len(g.data)) {
+		err = fmt.Errorf("invalid mmdb data pointer %v", offset)
+		return
+	}
+	decoder := &mmdbDecoder{buffer: g.data}
+	val, _, err := decoder.decode(offset)
+	if err != nil {
+		return
+	}
+	record, _ = val.(map[string]interface{})
+	return
+}
+
+// Country will return the country iso code of ip, empty string is returned when not found
+func (g *GeoIP) Country(ip net.IP) (country string) {
+	record, err := g.Lookup(ip)
+	if err != nil || record == nil {
+		return
+	}
+	for _, key := range []string{"country", "registered_country"} {
+		if info, ok := record[key].(map[string]interface{}); ok {
+			if code, ok := info["iso_code"].(string); ok && len(code) > 0 {
+				country = code
+				return
+			}
+		}
+	}
+	return
+}
+
+func mmdbUint(val interface{}) uint64 {
+	switch v := val.(type) {
+	case uint64:
+		return v
+	case int32:
+		return uint64(v)
+	}
+	return 0
+}
+
+// mmdbMaxDepth is the max nested depth of map/array in mmdb data, the deeper data is rejected as invalid
+const mmdbMaxDepth = 32
+
+type mmdbDecoder struct {
+	buffer []byte
+}
+
+func (m *mmdbDecoder) read(offset, size uint) (data []byte, err error) {
+	if offset+size > uint(len(m.buffer)) {
+		err = fmt.Errorf("invalid mmdb data, offset %v+%v out of range", offset, size)
+		return
+	}
+	data = m.buffer[offset : offset+size]
+	return
+}
+
+func (m *mmdbDecoder) decode(offset uint) (val interface{}, next uint, err error) {
+	val, next, err = m.decodeValue(offset, 0, false)
+	return
+}
+
+// decodeValue will decode the value on offset, the pointer to pointer is forbidden by spec and the depth is limited by mmdbMaxDepth,
+// so the crafted database can't make decoder loop forever
+func (m *mmdbDecoder) decodeValue(offset uint, depth int, pointed bool) (val interface{}, next uint, err error) {
+	if depth > mmdbMaxDepth {
+		err = fmt.Errorf("invalid mmdb data, depth is exceeded %v", mmdbMaxDepth)
+		return
+	}
+	ctrl, err := m.read(offset, 1)
+	if err != nil {
+		return
+	}
+	offset++
+	dataType := uint(ctrl[0] >> 5)
+	if dataType == 1 { //pointer
+		if pointed {
+			err = fmt.Errorf("invalid mmdb data, pointer to pointer on %v", offset-1)
+			return
+		}
+		ss, vvv := uint(ctrl[0]>>3)&0x3, uint(ctrl[0]&0x7)
+		var b []byte
+		if b, err = m.read(offset, ss+1); err != nil {
+			return
+		}
+		pointer := uint(0)
+		if ss < 3 {
+			pointer = vvv
+		}
+		for _, c := range b {
+			pointer = pointer<<8 | uint(c)
+		}
+		pointer += []uint{0, 2048, 526336, 0}[ss]
+		next = offset + ss + 1
+		val, _, err = m.decodeValue(pointer, depth, true)
+		return
+	}
+	if dataType == 0 { //extended
+		var b []byte
+		if b, err = m.read(offset, 1); err != nil {
+			return
+		}
+		dataType = 7 + uint(b[0])
+		offset++
+	}
+	size := uint(ctrl[0] & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		var b []byte
+		if b, err = m.read(offset, n); err != nil {
+			return
+		}
+		extra := uint(0)
+		for _, c := range b {
+			extra = extra<<8 | uint(c)
+		}
+		size = []uint{29, 285, 65821}[n-1] + extra
+		offset += n
+	}
+	switch dataType {
+	case 2, 4: //string, bytes
+		var b []byte
+		if b, err = m.read(offset, size); err != nil {
+			return
+		}
+		if dataType == 2 {
+			val = string(b)
+		} else {
+			val = append([]byte{}, b...)
+		}
+		next = offset + size
+	case 3, 15: //double, float
+		var b []byte
+		if b, err = m.read(offset, size); err != nil {
+			return
+		}
+		if dataType == 3 && size == 8 {
+			val = math.Float64frombits(binary.BigEndian.Uint64(b))
+		} else if dataType == 15 && size == 4 {
+			val = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+		} else {
+			err = fmt.Errorf("invalid mmdb float size %v", size)
+			return
+		}
+		next = offset + size
+	case 5, 6, 8, 9, 10: //uint16, uint32, int32, uint64, uint128
+		var b []byte
+		if b, err = m.read(offset, size); err != nil {
+			return
+		}
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		if dataType == 8 {
+			val = int32(n)
+		} else {
+			val = n
+		}
+		next = offset + size
+	case 7: //map
+		result := map[string]interface{}{}
+		next = offset
+		for i := uint(0); i < size; i++ {
+			var key, item interface{}
+			if key, next, err = m.decodeValue(next, depth+1, false); err != nil {
+				return
+			}
+			if item, next, err = m.decodeValue(next, depth+1, false); err != nil {
+				return
+			}
+			keyStr, _ := key.(string)
+			result[keyStr] = item
+		}
+		val = result
+	case 11: //array
+		result := []interface{}{}
+		next = offset
+		for i := uint(0); i < size; i++ {
+			var item interface{}
+			if item, next, err = m.decodeValue(next, depth+1, false); err != nil {
+				return
+			}
+			result = append(result, item)
+		}
+		val = result
+	case 14: //boolean
+		val = size != 0
+		next = offset
+	default:
+		err = fmt.Errorf("not supported mmdb data type %v", dataType)
+	}
+	return
+}
+
+// isTrustedProxy will return true when ip is in TrustedProxies
+func (d *Discover) isTrustedProxy(ip net.IP) bool {
+	for _, network := range d.TrustedProxies {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP will return the client ip, the GeoIPHeader is only read when the request is from TrustedProxies,
+// and the rightmost hop which is not trusted proxy is the client, so the client can't spoof by sending the header
+func (d *Discover) clientIP(r *http.Request) (ip net.IP) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip = net.ParseIP(host)
+	if len(d.GeoIPHeader) < 1 || !d.isTrustedProxy(ip) {
+		return
+	}
+	hops := strings.Split(strings.Join(r.Header.Values(d.GeoIPHeader), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !d.isTrustedProxy(hop) {
+			break
+		}
+	}
+	return
+}
+
+// allowGeo will check the client country by forward GeoAllow/GeoDeny, the request is denied when GeoIP is not configured
+func (d *Discover) allowGeo(forward *Forward, r *http.Request) bool {
+	if len(forward.GeoAllow) < 1 && len(forward.GeoDeny) < 1 {
+		return true
+	}
+	if d.GeoIP == nil {
+		WarnLog("Discover check geo on %v fail with %v", forward.Prefix, "geoip database is not configured")
+		return false
+	}
+	country := ""
+	if ip := d.clientIP(r); ip != nil {
+		country = d.GeoIP.Country(ip)
+	}
+	for _, c := range forward.GeoDeny {
+		if strings.EqualFold(c, country) {
+			return false
+		}
+	}
+	if len(forward.GeoAllow) < 1 {
+		return true
+	}
+	for _, c := range forward.GeoAllow {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
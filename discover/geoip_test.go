@@ -0,0 +1,223 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func mmdbString(s string) []byte {
+	return append([]byte{byte(2<<5 | len(s))}, s...)
+}
+
+func mmdbUint16(v uint16) []byte {
+	b := []byte{5<<5 | 2, 0, 0}
+	binary.BigEndian.PutUint16(b[1:], v)
+	return b
+}
+
+func mmdbUint32(v uint32) []byte {
+	b := []byte{6<<5 | 4, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], v)
+	return b
+}
+
+// buildMMDB will build the mmdb with 24 bit record size by cidr->country
+func buildMMDB(ipVersion int, countries map[string]string) []byte {
+	const empty, dataBase = -1, -1000000
+	nodes := [][2]int{{empty, empty}}
+	data := []byte{}
+	for cidr, country := range countries {
+		_, network, _ := net.ParseCIDR(cidr)
+		ip := network.IP
+		ones, _ := network.Mask.Size()
+		if ipVersion == 6 && len(ip) == 4 {
+			ip = append(make(net.IP, 12), ip...)
+			ones += 96
+		}
+		record := dataBase - len(data)
+		data = append(data, 7<<5|1)
+		data = append(data, mmdbString("country")...)
+		data = append(data, 7<<5|1)
+		data = append(data, mmdbString("iso_code")...)
+		data = append(data, mmdbString(country)...)
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[node][bit] = record
+				break
+			}
+			if nodes[node][bit] == empty {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	count := len(nodes)
+	for _, node := range nodes {
+		for _, record := range node {
+			val := record
+			if record == empty {
+				val = count
+			} else if record <= dataBase {
+				val = count + 16 + (dataBase - record)
+			}
+			buf.Write([]byte{byte(val >> 16), byte(val >> 8), byte(val)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data)
+	buf.Write(mmdbMetadataMarker)
+	buf.Write([]byte{7<<5 | 3})
+	buf.Write(mmdbString("node_count"))
+	buf.Write(mmdbUint32(uint32(count)))
+	buf.Write(mmdbString("record_size"))
+	buf.Write(mmdbUint16(24))
+	buf.Write(mmdbString("ip_version"))
+	buf.Write(mmdbUint16(uint16(ipVersion)))
+	return buf.Bytes()
+}
+
+func TestGeoIP(t *testing.T) {
+	for _, version := range []int{4, 6} {
+		countries := map[string]string{"1.0.0.0/8": "US", "2.2.0.0/16": "CN"}
+		if version == 6 {
+			countries["2001:db8::/32"] = "DE"
+		}
+		geo, err := NewGeoIP(buildMMDB(version, countries))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for ip, expect := range map[string]string{
+			"1.2.3.4":     "US",
+			"2.2.3.4":     "CN",
+			"2.3.3.4":     "",
+			"3.3.3.3":     "",
+			"2001:db8::1": map[int]string{4: "", 6: "DE"}[version],
+		} {
+			if country := geo.Country(net.ParseIP(ip)); country != expect {
+				t.Errorf("%v %v->%v", version, ip, country)
+				return
+			}
+		}
+	}
+	if _, err := NewGeoIP([]byte("xxx")); err == nil {
+		t.Error("error")
+		return
+	}
+	//pointer
+	decoder := &mmdbDecoder{buffer: append(mmdbString("US"), 1<<5, 0)}
+	if val, next, err := decoder.decode(3); err != nil || val != "US" || next != 5 {
+		t.Errorf("%v,%v,%v", val, next, err)
+		return
+	}
+	//pointer to self and pointer to pointer
+	for _, buffer := range [][]byte{{1 << 5, 0}, {1 << 5, 2, 1 << 5, 0}} {
+		decoder = &mmdbDecoder{buffer: buffer}
+		if _, _, err := decoder.decode(0); err == nil || !strings.Contains(err.Error(), "pointer to pointer") {
+			t.Error(err)
+			return
+		}
+	}
+	//array to self by pointer
+	decoder = &mmdbDecoder{buffer: []byte{1, 4, 1 << 5, 0}}
+	if _, _, err := decoder.decode(0); err == nil || !strings.Contains(err.Error(), "depth") {
+		t.Error(err)
+		return
+	}
+}
+
+func TestAllowGeo(t *testing.T) {
+	discover := NewDiscover()
+	discover.GeoIPHeader = "X-Forwarded-For"
+	discover.TrustedProxies, _ = ParseAllow([]string{"1.2.3.4", "10.0.0.0/8"})
+	forward := &Forward{Prefix: "v100.ds"}
+	req := httptest.NewRequest("GET", "http://v100.ds/", nil)
+	req.RemoteAddr = "1.2.3.4:1000"
+	if !discover.allowGeo(forward, req) {
+		t.Error("error")
+		return
+	}
+	forward.GeoAllow = []string{"us"}
+	if discover.allowGeo(forward, req) {
+		t.Error("error")
+		return
+	}
+	discover.GeoIP, _ = NewGeoIP(buildMMDB(4, map[string]string{"1.0.0.0/8": "US", "2.2.0.0/16": "CN"}))
+	if !discover.allowGeo(forward, req) {
+		t.Error("error")
+		return
+	}
+	req.Header.Set("X-Forwarded-For", "2.2.3.4, 1.2.3.4")
+	if discover.allowGeo(forward, req) {
+		t.Error("error")
+		return
+	}
+	forward.GeoAllow, forward.GeoDeny = nil, []string{"CN"}
+	if discover.allowGeo(forward, req) {
+		t.Error("error")
+		return
+	}
+	req.Header.Del("X-Forwarded-For")
+	if !discover.allowGeo(forward, req) {
+		t.Error("error")
+		return
+	}
+	//serve
+	discover.proxyReverse["v100.ds"] = &ReverseProxy{Forward: forward, Service: &Container{}}
+	req.Header.Set("X-Forwarded-For", "2.2.3.4")
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Error(res.Code)
+		return
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	discover := NewDiscover()
+	discover.GeoIPHeader = "X-Forwarded-For"
+	discover.TrustedProxies, _ = ParseAllow([]string{"10.0.0.0/8"})
+	for remote, cases := range map[string]map[string]string{
+		"10.0.0.1:1000": {
+			"":                           "10.0.0.1",
+			"1.1.1.1":                    "1.1.1.1",
+			"2.2.2.2, 1.1.1.1":           "1.1.1.1",
+			"2.2.2.2, 1.1.1.1, 10.0.0.2": "1.1.1.1",
+			"10.0.0.3, 10.0.0.2":         "10.0.0.3",
+			"1.1.1.1, xx, 10.0.0.2":      "10.0.0.2",
+		},
+		"1.1.1.1:1000": {
+			"2.2.2.2": "1.1.1.1",
+		},
+	} {
+		for header, expect := range cases {
+			req := httptest.NewRequest("GET", "http://v100.ds/", nil)
+			req.RemoteAddr = remote
+			if len(header) > 0 {
+				req.Header.Set("X-Forwarded-For", header)
+			}
+			if ip := discover.clientIP(req); ip.String() != expect {
+				t.Errorf("%v %v->%v", remote, header, ip)
+				return
+			}
+		}
+	}
+	//header is not read without trusted proxies
+	discover.TrustedProxies = nil
+	req := httptest.NewRequest("GET", "http://v100.ds/", nil)
+	req.RemoteAddr = "10.0.0.1:1000"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+	if ip := discover.clientIP(req); ip.String() != "10.0.0.1" {
+		t.Error(ip)
+		return
+	}
+}
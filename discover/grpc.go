@@ -0,0 +1,211 @@
+package discover
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pdservice.proto
+
+// grpcServer is the Control service in pdservice.proto which is served by Discover
+type grpcServer struct {
+	UnimplementedControlServer
+	d *Discover
+}
+
+// grpcRole will authorize the grpc call by authorization metadata same as admin api, the path is the admin api path of
+// rolePermissions which is required by call
+func (d *Discover) grpcRole(ctx context.Context, path string) (tenant *Tenant, err error) {
+	req := &http.Request{Header: http.Header{}}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, auth := range md.Get("authorization") {
+			req.Header.Add("Authorization", auth)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		req.RemoteAddr = p.Addr.String()
+	}
+	tenant, role := d.adminRole(req)
+	if len(role) < 1 {
+		err = status.Error(codes.Unauthenticated, "unauthorized")
+		return
+	}
+	if !roleAllow(role, path) || tenant != nil && path == "refresh" {
+		err = status.Error(codes.PermissionDenied, "forbidden")
+	}
+	return
+}
+
+func newGRPCService(service *Container) *GRPCService {
+	return &GRPCService{
+		Id:      service.ID,
+		Name:    service.Name,
+		Version: service.Version,
+		Status:  service.Status,
+		Tenant:  service.Tenant,
+		Backend: service.Backend,
+		Health:  service.Health,
+	}
+}
+
+// ListServices will list the services with visible forwards same as GET /_api/services
+func (g *grpcServer) ListServices(ctx context.Context, req *ListServicesRequest) (res *ListServicesResponse, err error) {
+	d := g.d
+	tenant, err := d.grpcRole(ctx, "services")
+	if err != nil {
+		return
+	}
+	serviceAll := map[string]*GRPCService{}
+	d.proxyLock.RLock()
+	for prefix, service := range d.proxyAll {
+		forward := service.Forwards[prefix]
+		if forward == nil || d.isHidden(service, forward) || !inTenant(tenant, service) {
+			continue
+		}
+		if len(req.Name) > 0 && service.Name != req.Name || len(req.Version) > 0 && service.Version != req.Version {
+			continue
+		}
+		if len(req.Id) > 0 && (len(service.ID) < len(req.Id) || service.ID[:len(req.Id)] != req.Id) {
+			continue
+		}
+		info := serviceAll[service.ID]
+		if info == nil {
+			info = newGRPCService(service)
+			serviceAll[service.ID] = info
+		}
+		info.Forwards = append(info.Forwards, &GRPCForward{Prefix: prefix, Type: forward.Type, Uri: forward.URI})
+	}
+	d.proxyLock.RUnlock()
+	res = &ListServicesResponse{}
+	for _, info := range serviceAll {
+		sort.Slice(info.Forwards, func(i, j int) bool { return info.Forwards[i].Prefix < info.Forwards[j].Prefix })
+		res.Services = append(res.Services, info)
+	}
+	sort.Slice(res.Services, func(i, j int) bool {
+		if res.Services[i].Name != res.Services[j].Name {
+			return res.Services[i].Name < res.Services[j].Name
+		}
+		return CompareVersion(res.Services[i].Version, res.Services[j].Version) > 0
+	})
+	return
+}
+
+// Watch will send the added/updated/removed forwards of services by Subscribe until the stream is closed
+func (g *grpcServer) Watch(req *WatchRequest, stream Control_WatchServer) (err error) {
+	d := g.d
+	tenant, err := d.grpcRole(stream.Context(), "services")
+	if err != nil {
+		return
+	}
+	events := d.Subscribe()
+	defer d.Unsubscribe(events)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return
+		case event := <-events:
+			if event.Container == nil || !inTenant(tenant, event.Container) || len(req.Name) > 0 && event.Container.Name != req.Name {
+				continue
+			}
+			if event.Forward != nil && d.isHidden(event.Container, event.Forward) {
+				continue
+			}
+			service := newGRPCService(event.Container)
+			if event.Forward != nil {
+				service.Forwards = []*GRPCForward{{Prefix: event.Prefix, Type: event.Forward.Type, Uri: event.Forward.URI}}
+			}
+			err = stream.Send(&WatchEvent{Type: event.Type, Prefix: event.Prefix, Service: service, At: event.At.UnixNano() / int64(time.Millisecond)})
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Refresh will run the refresh cycle immediately same as POST /_api/refresh
+func (g *grpcServer) Refresh(ctx context.Context, req *RefreshRequest) (res *RefreshResponse, err error) {
+	d := g.d
+	if _, err = d.grpcRole(ctx, "refresh"); err != nil {
+		return
+	}
+	if d.IsPaused() {
+		err = status.Error(codes.FailedPrecondition, "refresh is paused")
+		return
+	}
+	added, updated, removed, err := d.RefreshNow()
+	if err != nil {
+		err = status.Error(codes.Internal, err.Error())
+		return
+	}
+	res = &RefreshResponse{Added: prefixList(added), Updated: prefixList(updated), Removed: prefixList(removed)}
+	return
+}
+
+// ControlContainer will start/stop/restart the docker containers of service
+func (g *grpcServer) ControlContainer(ctx context.Context, req *ControlRequest) (res *ControlResponse, err error) {
+	d := g.d
+	tenant, err := d.grpcRole(ctx, "docker/"+req.Action)
+	if err != nil {
+		return
+	}
+	if req.Action != "start" && req.Action != "stop" && req.Action != "restart" {
+		err = status.Errorf(codes.InvalidArgument, "action %v is invalid, must be start, stop or restart", req.Action)
+		return
+	}
+	if d.IsReadOnly() {
+		err = status.Error(codes.PermissionDenied, "read only")
+		return
+	}
+	services := d.findServices(tenant, req.Name, req.Id, req.Version)
+	if len(services) < 1 {
+		err = status.Error(codes.NotFound, "service not found")
+		return
+	}
+	for _, service := range services {
+		if !service.isDocker() {
+			err = status.Errorf(codes.FailedPrecondition, "service %v/%v is on %v backend, %v is only supported on docker", service.Name, service.ID, service.Backend, req.Action)
+			return
+		}
+	}
+	cli, _, err := d.newDockerClient()
+	if err != nil {
+		err = status.Error(codes.Internal, err.Error())
+		return
+	}
+	timeout := 10 * time.Second
+	res = &ControlResponse{}
+	for _, service := range services {
+		switch req.Action {
+		case "start":
+			err = cli.ContainerStart(ctx, service.ID, types.ContainerStartOptions{})
+		case "stop":
+			err = cli.ContainerStop(ctx, service.ID, &timeout)
+		case "restart":
+			err = cli.ContainerRestart(ctx, service.ID, &timeout)
+		}
+		if err != nil {
+			WarnLog("Discover grpc %v %v/%v container fail with %v", req.Action, service.Name, service.ID, err)
+			err = status.Error(codes.Internal, err.Error())
+			return
+		}
+		InfoLog("Discover grpc %v %v/%v container success", req.Action, service.Name, service.ID)
+		res.Ids = append(res.Ids, service.ID)
+	}
+	return
+}
+
+// NewGRPCServer will create the grpc server of control-plane api in pdservice.proto
+func (d *Discover) NewGRPCServer(opts ...grpc.ServerOption) (server *grpc.Server) {
+	server = grpc.NewServer(opts...)
+	RegisterControlServer(server, &grpcServer{d: d})
+	return
+}
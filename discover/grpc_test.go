@@ -0,0 +1,105 @@
+package discover
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPC(t *testing.T) {
+	discover := NewDiscover()
+	discover.AdminToken = "123"
+	discover.RoleTokens = map[string]string{"view": RoleViewer}
+	discover.proxyAll["v100.ds"] = &Container{ID: "c1", Name: "ds", Version: "v1.0.0", Forwards: map[string]*Forward{
+		"v100.ds":       {Prefix: "v100.ds", Type: "http", URI: "127.0.0.1:8080"},
+		"admin.v100.ds": {Prefix: "admin.v100.ds", Hidden: true},
+	}}
+	discover.proxyAll["admin.v100.ds"] = discover.proxyAll["v100.ds"]
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := discover.NewGRPCServer()
+	go server.Serve(ln)
+	defer server.Stop()
+	conn, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+	client := NewControlClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	//list
+	_, err = client.ListServices(withToken("xx"), &ListServicesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Error(err)
+		return
+	}
+	services, err := client.ListServices(withToken("view"), &ListServicesRequest{Name: "ds"})
+	if err != nil || len(services.Services) != 1 || len(services.Services[0].Forwards) != 1 || services.Services[0].Forwards[0].Uri != "127.0.0.1:8080" {
+		t.Errorf("%v,%v", err, services)
+		return
+	}
+	services, err = client.ListServices(withToken("view"), &ListServicesRequest{Id: "c2"})
+	if err != nil || len(services.Services) != 0 {
+		t.Errorf("%v,%v", err, services)
+		return
+	}
+	//refresh/control
+	_, err = client.Refresh(withToken("view"), &RefreshRequest{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Error(err)
+		return
+	}
+	discover.Pause()
+	_, err = client.Refresh(withToken("123"), &RefreshRequest{})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Error(err)
+		return
+	}
+	_, err = client.ControlContainer(withToken("123"), &ControlRequest{Name: "ds", Action: "kill"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Error(err)
+		return
+	}
+	_, err = client.ControlContainer(withToken("123"), &ControlRequest{Name: "none", Action: "restart"})
+	if status.Code(err) != codes.NotFound {
+		t.Error(err)
+		return
+	}
+	discover.proxyAll["v100.nomad"] = &Container{ID: "n1", Name: "nomad", Backend: "nomad", Forwards: map[string]*Forward{"v100.nomad": {Prefix: "v100.nomad"}}}
+	_, err = client.ControlContainer(withToken("123"), &ControlRequest{Name: "nomad", Action: "restart"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Error(err)
+		return
+	}
+	delete(discover.proxyAll, "v100.nomad")
+	//watch
+	stream, err := client.Watch(withToken("view"), &WatchRequest{Name: "ds"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	go func() {
+		for i := 0; i < 50; i++ {
+			time.Sleep(10 * time.Millisecond)
+			discover.publishChanges(map[string]*Container{
+				"v100.ds": discover.proxyAll["v100.ds"],
+				"v100.x":  {ID: "c2", Name: "x", Forwards: map[string]*Forward{"v100.x": {Prefix: "v100.x"}}},
+			}, nil, nil)
+		}
+	}()
+	event, err := stream.Recv()
+	if err != nil || event.Type != ChangeAdded || event.Prefix != "v100.ds" || event.Service.Id != "c1" || event.Service.Forwards[0].Uri != "127.0.0.1:8080" {
+		t.Errorf("%v,%v", err, event)
+		return
+	}
+}
@@ -0,0 +1,72 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HeaderRule is the response header policy of forward, the action is set, add or del
+type HeaderRule struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	Value  string `json:"value,omitempty"`
+}
+
+// ParseHeaderRules will parse the rules split by |, the rule is Name: value to set, +Name: value to add or -Name to remove
+func ParseHeaderRules(val string) (rules []*HeaderRule, err error) {
+	for _, part := range strings.Split(val, "|") {
+		part = strings.TrimSpace(part)
+		if len(part) < 1 {
+			continue
+		}
+		rule := &HeaderRule{Action: "set"}
+		switch part[0] {
+		case '-':
+			rule.Action, rule.Name = "del", strings.TrimSpace(part[1:])
+		case '+':
+			rule.Action = "add"
+			part = part[1:]
+			fallthrough
+		default:
+			parts := strings.SplitN(part, ":", 2)
+			if len(parts) < 2 {
+				err = fmt.Errorf("header rule %v is invalid", part)
+				return
+			}
+			rule.Name, rule.Value = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		}
+		if len(rule.Name) < 1 || strings.ContainsAny(rule.Name, " \t\r\n:") {
+			err = fmt.Errorf("header name %v is invalid", rule.Name)
+			return
+		}
+		rule.Name = http.CanonicalHeaderKey(rule.Name)
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// applyHeaders will apply the header rules to header by order
+func applyHeaders(header http.Header, rules []*HeaderRule) {
+	for _, rule := range rules {
+		switch rule.Action {
+		case "set":
+			header.Set(rule.Name, rule.Value)
+		case "add":
+			header.Add(rule.Name, rule.Value)
+		case "del":
+			header.Del(rule.Name)
+		}
+	}
+}
+
+// modifyResponse will replace the cors header by policy and apply the response header rules of forward
+func (f *Forward) modifyResponse(res *http.Response) (err error) {
+	if f.CORS != nil {
+		if err = f.CORS.ModifyResponse(res); err != nil {
+			return
+		}
+	}
+	applyHeaders(res.Header, f.ResponseHeaders)
+	return
+}
@@ -0,0 +1,73 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaderRules(t *testing.T) {
+	rules, err := ParseHeaderRules("x-environment: staging | +Set-Cookie: a=1; Path=/ |-server||Cache-Control: no-store")
+	if err != nil || len(rules) != 4 || rules[0].Name != "X-Environment" || rules[1].Action != "add" || rules[1].Value != "a=1; Path=/" || rules[2].Action != "del" || rules[2].Name != "Server" {
+		t.Errorf("%v,%v", err, rules)
+		return
+	}
+	for _, val := range []string{"X-Env", "-", "X Env: 1", "+: 1"} {
+		if _, err := ParseHeaderRules(val); err == nil {
+			t.Error(val)
+			return
+		}
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.0")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Set-Cookie", "b=2")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	container := &Container{ID: "c1", Name: "ds", Version: "1.0.0", Forwards: map[string]*Forward{
+		"v100.ds": {Name: "WEB", Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://")},
+	}}
+	applyForwardOptions(container, map[string]string{"PD_RESPONSE_HEADERS_WEB": "x-environment: staging | +Set-Cookie: a=1 |-server|Cache-Control: no-store"})
+	if len(container.Problems) > 0 {
+		t.Error(container.Problems)
+		return
+	}
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.applyProxy(map[string]*Container{"v100.ds": container})
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil))
+	header := res.Header()
+	if res.Code != http.StatusOK || header.Get("X-Environment") != "staging" || len(header.Get("Server")) > 0 || header.Get("Cache-Control") != "no-store" || len(header["Set-Cookie"]) != 2 {
+		t.Errorf("%v,%v", res.Code, header)
+		return
+	}
+	applyForwardOptions(container, map[string]string{"PD_RESPONSE_HEADERS": "xx"})
+	if len(container.Problems) != 1 {
+		t.Error(container.Problems)
+		return
+	}
+}
+
+func TestAltSvc(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.AltSvc = `h3=":9443"; ma=86400`
+	req := httptest.NewRequest("GET", "http://test.loc/", nil)
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Header().Get("Alt-Svc") != discover.AltSvc {
+		t.Error(res.Header())
+		return
+	}
+	req = httptest.NewRequest("GET", "http://test.loc/", nil)
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/3.0", 3, 0
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Header().Get("Alt-Svc") != "" {
+		t.Error(res.Header())
+		return
+	}
+}
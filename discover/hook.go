@@ -0,0 +1,183 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+var hookEvents = map[string][]string{
+	"ADDED":     {"added"},
+	"UPDATED":   {"updated"},
+	"REMOVED":   {"removed"},
+	"UNHEALTHY": {"unhealthy"},
+	"IMAGE":     {"image"},
+	"FLAPPING":  {"flapping"},
+	"PROBE":     {"probe"},
+	"COLLISION": {"collision"},
+	"ALL":       {"added", "updated", "removed"},
+}
+
+// addHook will add the webhook by label PD_HOOK_<EVENT>, event is ADDED/UPDATED/REMOVED/UNHEALTHY/IMAGE/FLAPPING/PROBE/COLLISION/ALL
+func (c *Container) addHook(event, uri string) {
+	events, ok := hookEvents[strings.ToUpper(event)]
+	if !ok || len(uri) < 1 {
+		WarnLog("Discover parse container %v hook %v=%v fail with %v", c.Name, event, uri, "event is invalid")
+		return
+	}
+	if c.Hooks == nil {
+		c.Hooks = map[string]string{}
+	}
+	for _, e := range events {
+		c.Hooks[e] = uri
+	}
+}
+
+// callHooks will call the container webhook for event with service metadata, the webhook is called once for each container
+func (d *Discover) callHooks(services map[string]*Container, event string) {
+	containers := map[string]*Container{}
+	forwards := map[string][]xmap.M{}
+	for prefix, service := range services {
+		if len(service.Hooks[event]) < 1 {
+			continue
+		}
+		forward, ok := service.Forwards[prefix]
+		if !ok {
+			continue
+		}
+		containers[service.ID] = service
+		forwards[service.ID] = append(forwards[service.ID], xmap.M{
+			"name":   forward.Name,
+			"type":   forward.Type,
+			"prefix": forward.Prefix,
+			"host":   forward.URI,
+		})
+	}
+	for id, service := range containers {
+		sort.Slice(forwards[id], func(i, j int) bool {
+			return forwards[id][i]["prefix"].(string) < forwards[id][j]["prefix"].(string)
+		})
+		data, _ := json.Marshal(xmap.M{
+			"event":    event,
+			"id":       service.ID,
+			"name":     service.Name,
+			"version":  service.Version,
+			"status":   service.Status,
+			"forwards": forwards[id],
+		})
+		go d.callHook(service, event, service.Hooks[event], data)
+	}
+}
+
+// isOperatorHook will return true when uri is the webhook configured by operator
+func (d *Discover) isOperatorHook(uri string) bool {
+	for _, hook := range []string{d.SupervisorHook, d.FlapHook, d.ProbeHook, d.CollisionHook, d.ResourceHook, d.ComposeHook, d.UpdateHook} {
+		if len(hook) > 0 && hook == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// isHookHost will return true when host is in HookHosts
+func (d *Discover) isHookHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range d.HookHosts {
+		if strings.ToLower(allowed) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// deniedHookIP will return true when ip is loopback/link-local/private/unspecified/multicast address
+func deniedHookIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// hookClient will return the client for webhook, the webhook declared by label is only allowed to public address or host in HookHosts
+func (d *Discover) hookClient(uri string) (client *http.Client, err error) {
+	target, err := url.Parse(uri)
+	if err != nil {
+		return
+	}
+	client = &http.Client{Timeout: d.HookTimeout}
+	if d.isOperatorHook(uri) || d.isHookHost(target.Hostname()) {
+		return
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		err = fmt.Errorf("hook scheme %v is not allowed", target.Scheme)
+		return
+	}
+	dialer := &net.Dialer{
+		Timeout: d.HookTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, _ := net.SplitHostPort(address)
+			if ip := net.ParseIP(host); ip == nil || deniedHookIP(ip) {
+				return fmt.Errorf("hook address %v is not allowed, add host to hook_hosts", address)
+			}
+			return nil
+		},
+	}
+	client.Transport = &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: d.HookTimeout}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return
+}
+
+func (d *Discover) callHook(service *Container, event, uri string, data []byte) (err error) {
+	startTime := time.Now()
+	var out []byte
+	//the hook is skipped when HookMaxConns hooks are running, so slow webhook can't pile up goroutines
+	if atomic.AddInt32(&d.hookRunning, 1) > int32(d.HookMaxConns) {
+		atomic.AddInt32(&d.hookRunning, -1)
+		err = fmt.Errorf("max %v hooks is running", d.HookMaxConns)
+		d.recordTrigger("hook_"+event, 0, nil, err)
+		WarnLog("Discover call %v hook %v to %v is skipped by %v", service.Name, event, uri, err)
+		return
+	}
+	defer func() {
+		atomic.AddInt32(&d.hookRunning, -1)
+		d.recordTrigger("hook_"+event, time.Since(startTime), out, err)
+		if err != nil {
+			WarnLog("Discover call %v hook %v to %v fail with %v", service.Name, event, uri, err)
+		} else {
+			InfoLog("Discover call %v hook %v to %v success", service.Name, event, uri)
+		}
+	}()
+	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-PD-Event", event)
+	SignRequest(req, d.SignSecret, data)
+	client, err := d.hookClient(uri)
+	if err != nil {
+		return
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	out, _ = ioutil.ReadAll(io.LimitReader(res.Body, triggerOutputMax))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		err = fmt.Errorf("status code %v", res.StatusCode)
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package discover
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+func TestHook(t *testing.T) {
+	received := make(chan xmap.M, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		info := xmap.M{}
+		json.Unmarshal(data, &info)
+		info["header"] = r.Header.Get("X-PD-Event")
+		received <- info
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+	service := &Container{ID: "c1", Name: "ds", Version: "v1.0.0", Forwards: map[string]*Forward{
+		"v100.ds":   {Name: "WWW", Type: "http", Prefix: "v100.ds"},
+		"a.v100.ds": {Name: "A", Type: "http", Prefix: "a.v100.ds"},
+	}}
+	service.addHook("ALL", ts.URL+"/ok")
+	service.addHook("REMOVED", ts.URL+"/fail")
+	service.addHook("XX", ts.URL+"/ok")
+	if len(service.Hooks) != 3 {
+		t.Error(service.Hooks)
+		return
+	}
+	discover := NewDiscover()
+	//label hook to private address is rejected
+	if err := discover.callHook(service, "added", ts.URL+"/ok", nil); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Error(err)
+		return
+	}
+	if err := discover.callHook(service, "added", "file:///etc/passwd", nil); err == nil {
+		t.Error("error")
+		return
+	}
+	//operator hook is not restricted
+	discover.UpdateHook = ts.URL + "/ok"
+	if err := discover.callHook(service, "image", discover.UpdateHook, nil); err != nil {
+		t.Error(err)
+		return
+	}
+	<-received
+	discover.UpdateHook = ""
+	//max running hooks
+	discover.HookMaxConns = 0
+	if err := discover.callHook(service, "added", ts.URL+"/ok", nil); err == nil || !strings.Contains(err.Error(), "max") {
+		t.Error(err)
+		return
+	}
+	discover.HookMaxConns = 16
+	discover.HookHosts = []string{"127.0.0.1"}
+	services := map[string]*Container{"v100.ds": service, "a.v100.ds": service}
+	discover.callHooks(services, "added")
+	select {
+	case info := <-received:
+		if info["event"] != "added" || info["header"] != "added" || len(info["forwards"].([]interface{})) != 2 {
+			t.Error(info)
+			return
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("timeout")
+		return
+	}
+	if err := discover.callHook(service, "removed", ts.URL+"/fail", nil); err == nil {
+		t.Error("error")
+		return
+	}
+	<-received
+	if stats := discover.TriggerStats()["hook_removed"]; stats.Failure != 1 {
+		t.Error(stats)
+		return
+	}
+	discover.callHooks(map[string]*Container{"v100.ds": {ID: "c2", Forwards: service.Forwards}}, "added")
+	select {
+	case info := <-received:
+		t.Error(info)
+		return
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,144 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// HostService is the drop-in file of service which is running on host without container, the type/host/listen/path/port
+// is the shorthand of WEB forward, the forwards and options is same as PD_CONFIG label
+type HostService struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	Address string      `json:"address,omitempty"`
+	Type    string      `json:"type,omitempty"`
+	Host    string      `json:"host,omitempty"`
+	Listen  string      `json:"listen,omitempty"`
+	Path    string      `json:"path,omitempty"`
+	Port    interface{} `json:"port,omitempty"`
+	LabelConfig
+}
+
+// ParseHostService will parse the drop-in file of host service to container inspect, the port is published as same port
+func (d *Discover) ParseHostService(id string, data []byte) (inspect types.ContainerJSON, remoteHost string, err error) {
+	service := &HostService{}
+	if err = json.Unmarshal(data, service); err != nil {
+		return
+	}
+	if len(service.Name) < 1 || len(service.Version) < 1 {
+		err = fmt.Errorf("name and version is required")
+		return
+	}
+	if service.Port != nil {
+		if service.Forwards == nil {
+			service.Forwards = map[string]*LabelForward{}
+		}
+		service.Forwards["WEB"] = &LabelForward{Type: service.Type, Host: service.Host, Listen: service.Listen, Path: service.Path, Port: service.Port}
+	}
+	config, _ := json.Marshal(service.LabelConfig)
+	labels, err := ParseLabelConfig(string(config))
+	if err != nil {
+		return
+	}
+	ports := nat.PortMap{}
+	for key, val := range labels {
+		if !strings.HasPrefix(key, "PD_HOST_") && !strings.HasPrefix(key, "PD_TCP_") && !strings.HasPrefix(key, "PD_UDP_") && !strings.HasPrefix(key, "PD_UNIX_") {
+			continue
+		}
+		port := val[strings.LastIndex(val, "/")+1:]
+		if index := strings.LastIndex(port, ":"); index >= 0 {
+			port = port[index+1:]
+		}
+		ports[nat.Port(port+"/tcp")] = []nat.PortBinding{{HostPort: port}}
+	}
+	remoteHost = service.Address
+	if len(remoteHost) < 1 {
+		remoteHost = "127.0.0.1"
+	}
+	inspect = types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    id,
+			Name:  "/" + service.Name + d.MatchKey + service.Version,
+			State: &types.ContainerState{Status: "running"},
+		},
+		Config:          &container.Config{Labels: labels},
+		NetworkSettings: &types.NetworkSettings{NetworkSettingsBase: types.NetworkSettingsBase{Ports: ports}},
+	}
+	return
+}
+
+// discoveHost will discover the host services by *.json drop-in files in HostServiceDir, the invalid file is skipped with warning
+func (d *Discover) discoveHost() (parsed, proxied []*Container, err error) {
+	files, err := filepath.Glob(filepath.Join(d.HostServiceDir, "*.json"))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		data, xerr := ioutil.ReadFile(file)
+		if xerr != nil {
+			WarnLog("Discover read host service %v fail with %v", file, xerr)
+			continue
+		}
+		id := "host-" + strings.TrimSuffix(filepath.Base(file), ".json")
+		inspect, remoteHost, xerr := d.ParseHostService(id, data)
+		if xerr != nil {
+			WarnLog("Discover parse host service %v fail with %v", file, xerr)
+			continue
+		}
+		container, ok := d.parseContainer(inspect, remoteHost, false)
+		if container == nil {
+			continue
+		}
+		container.Backend = "host"
+		if ok {
+			proxied = append(proxied, container)
+		}
+		parsed = append(parsed, container)
+	}
+	return
+}
+
+// hostServiceState will return the state of drop-in files by name, modify time and size
+func (d *Discover) hostServiceState() string {
+	files, _ := filepath.Glob(filepath.Join(d.HostServiceDir, "*.json"))
+	sort.Strings(files)
+	state := &strings.Builder{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err == nil {
+			fmt.Fprintf(state, "%v:%v:%v\n", file, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return state.String()
+}
+
+// runHostWatch will watch the drop-in files of host service and refresh immediately when it is changed
+func (d *Discover) runHostWatch() {
+	last := d.hostServiceState()
+	ticker := time.NewTicker(d.HostServiceWatch)
+	defer ticker.Stop()
+	for d.refreshing {
+		<-ticker.C
+		state := d.hostServiceState()
+		if state == last {
+			continue
+		}
+		last = state
+		if d.IsPaused() || d.skipCycle() {
+			continue
+		}
+		InfoLog("Discover host services in %v is changed, refresh now", d.HostServiceDir)
+		d.RefreshNow()
+	}
+}
@@ -0,0 +1,55 @@
+package discover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHostService(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "hostservice")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "legacy.json"), []byte(`{"name": "legacy", "version": "v1.2.0", "port": 8080}`), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "db.json"), []byte(`{"name": "db", "version": "v1.0.0", "address": "10.0.0.5", "forwards": {"DB": {"type": "tcp", "listen": ":15432", "port": 5432}}}`), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"name": "bad"}`), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte(`xx`), os.ModePerm)
+	discover := NewDiscover()
+	discover.Backends = []string{"host"}
+	discover.HostServiceDir = dir
+	all, err := discover.Discove()
+	if err != nil || len(all) != 2 {
+		t.Errorf("%v,%v", err, all)
+		return
+	}
+	service := all["v120.legacy"]
+	if service == nil || service.Backend != "host" || service.ID != "host-legacy" || service.Forwards["v120.legacy"].URI != "127.0.0.1:8080" || len(service.Problems) > 0 {
+		t.Errorf("%v,%v", all, service)
+		return
+	}
+	if forward := all["tcp://:15432"].Forwards["tcp://:15432"]; forward.URI != "10.0.0.5:5432" {
+		t.Error(forward)
+		return
+	}
+	//parse error
+	if _, _, err = discover.ParseHostService("x", []byte(`{"name": "x"}`)); err == nil {
+		t.Error(err)
+		return
+	}
+	if _, _, err = discover.ParseHostService("x", []byte(`xxx`)); err == nil {
+		t.Error(err)
+		return
+	}
+	//state
+	state := discover.hostServiceState()
+	if discover.hostServiceState() != state {
+		t.Error("state")
+		return
+	}
+	os.Chtimes(filepath.Join(dir, "legacy.json"), time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if discover.hostServiceState() == state {
+		t.Error("state")
+		return
+	}
+}
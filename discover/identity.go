@@ -0,0 +1,73 @@
+package discover
+
+import (
+	"time"
+)
+
+// maxPreviousIDs is the max container ids kept in history of recreated container
+const maxPreviousIDs = 5
+
+// sameIdentity will return if the container is recreated from old container by same name/version/tenant
+func sameIdentity(old, service *Container) bool {
+	return old.Name == service.Name && old.Version == service.Version && old.Tenant == service.Tenant
+}
+
+// linkRecreated will link the history of container to the old container which is recreated with same identity,
+// it must be called with proxyLock
+func (d *Discover) linkRecreated(old, service *Container) {
+	if old.ID == service.ID {
+		service.PreviousIDs = old.PreviousIDs
+		return
+	}
+	if len(service.PreviousIDs) > 0 && service.PreviousIDs[0] == old.ID || !sameIdentity(old, service) {
+		return
+	}
+	service.PreviousIDs = append([]string{old.ID}, old.PreviousIDs...)
+	if len(service.PreviousIDs) > maxPreviousIDs {
+		service.PreviousIDs = service.PreviousIDs[:maxPreviousIDs]
+	}
+	if d.recreated == nil {
+		d.recreated = map[string]string{}
+	}
+	d.recreated[service.ID] = old.ID
+	InfoLog("Discover service %v-%v is recreated from %v to %v, the routing is kept", service.Name, service.Version, shortID(old.ID), shortID(service.ID))
+}
+
+// keepRecreating will keep the forward which is missing in RecreateGrace for container recreating, it must be called with proxyLock
+func (d *Discover) keepRecreating(prefix string, service *Container, now time.Time) bool {
+	if d.RecreateGrace <= 0 {
+		return false
+	}
+	if d.recreatePending == nil {
+		d.recreatePending = map[string]time.Time{}
+	}
+	since, ok := d.recreatePending[prefix]
+	if !ok {
+		d.recreatePending[prefix] = now
+		InfoLog("Discover forward %v of %v-%v is missing, keep it in %v for recreating", prefix, service.Name, service.Version, d.RecreateGrace)
+		return true
+	}
+	if now.Sub(since) < d.RecreateGrace {
+		return true
+	}
+	delete(d.recreatePending, prefix)
+	return false
+}
+
+// relinkRecreated will move the restart cron and supervisor state of recreated container to new id
+func (d *Discover) relinkRecreated() {
+	d.proxyLock.Lock()
+	recreated := d.recreated
+	d.recreated = nil
+	d.proxyLock.Unlock()
+	for id, oldID := range recreated {
+		if next, ok := d.restartNext[oldID]; ok {
+			d.restartNext[id] = next
+			delete(d.restartNext, oldID)
+		}
+		if state, ok := d.superviseAll[oldID]; ok {
+			d.superviseAll[id] = state
+			delete(d.superviseAll, oldID)
+		}
+	}
+}
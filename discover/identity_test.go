@@ -0,0 +1,71 @@
+package discover
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinkRecreated(t *testing.T) {
+	discover := NewDiscover()
+	old := &Container{ID: "c1", Name: "ds", Version: "v1.0.0", PreviousIDs: []string{"c0"}}
+	service := &Container{ID: "c2", Name: "ds", Version: "v1.0.0"}
+	discover.linkRecreated(old, service)
+	discover.linkRecreated(old, service)
+	if len(service.PreviousIDs) != 2 || service.PreviousIDs[0] != "c1" || discover.recreated["c2"] != "c1" {
+		t.Error(service.PreviousIDs)
+		return
+	}
+	same := &Container{ID: "c2", Name: "ds", Version: "v1.0.0"}
+	discover.linkRecreated(service, same)
+	if len(same.PreviousIDs) != 2 {
+		t.Error(same.PreviousIDs)
+		return
+	}
+	other := &Container{ID: "c3", Name: "ds", Version: "v1.0.1"}
+	discover.linkRecreated(service, other)
+	if len(other.PreviousIDs) != 0 {
+		t.Error(other.PreviousIDs)
+		return
+	}
+	long := &Container{ID: "c9", Name: "ds", Version: "v1.0.0", PreviousIDs: []string{"c8", "c7", "c6", "c5", "c4"}}
+	next := &Container{ID: "c10", Name: "ds", Version: "v1.0.0"}
+	discover.linkRecreated(long, next)
+	if len(next.PreviousIDs) != maxPreviousIDs || next.PreviousIDs[0] != "c9" {
+		t.Error(next.PreviousIDs)
+		return
+	}
+	//relink
+	discover.restartNext = map[string]time.Time{"c1": time.Now()}
+	discover.superviseAll = map[string]*superviseState{"c1": {Attempts: 2}}
+	discover.relinkRecreated()
+	if _, ok := discover.restartNext["c2"]; !ok || discover.superviseAll["c2"] == nil || discover.superviseAll["c2"].Attempts != 2 || discover.recreated != nil {
+		t.Error(discover.restartNext, discover.superviseAll)
+		return
+	}
+	if _, ok := discover.restartNext["c1"]; ok {
+		t.Error(discover.restartNext)
+		return
+	}
+}
+
+func TestKeepRecreating(t *testing.T) {
+	discover := NewDiscover()
+	now := time.Now()
+	if discover.keepRecreating("v100.ds", &Container{}, now) {
+		t.Error("keep")
+		return
+	}
+	discover.RecreateGrace = time.Second
+	if !discover.keepRecreating("v100.ds", &Container{}, now) || !discover.keepRecreating("v100.ds", &Container{}, now.Add(500*time.Millisecond)) {
+		t.Error("not keep")
+		return
+	}
+	if discover.keepRecreating("v100.ds", &Container{}, now.Add(time.Second)) {
+		t.Error("keep")
+		return
+	}
+	if _, ok := discover.recreatePending["v100.ds"]; ok {
+		t.Error(discover.recreatePending)
+		return
+	}
+}
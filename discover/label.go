@@ -0,0 +1,448 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/util/converter"
+)
+
+// ForwardOption will apply the label value to forward
+type ForwardOption func(forward *Forward, val string) (err error)
+
+// forwardOptions is the supported option label, the label PD_<OPTION>_<NAME> is applied to forward by name
+// and PD_<OPTION> is applied to all forwards of the container
+var forwardOptions = map[string]ForwardOption{
+	"TLS_CA": func(forward *Forward, val string) (err error) {
+		forward.TLSCA = val
+		return
+	},
+	"TLS_SKIP_VERIFY": func(forward *Forward, val string) (err error) {
+		forward.TLSSkipVerify, err = strconv.ParseBool(val)
+		return
+	},
+	"TLS_CERT": func(forward *Forward, val string) (err error) {
+		forward.TLSCert = val
+		if len(forward.TLSKey) < 1 {
+			forward.TLSKey = val
+		}
+		return
+	},
+	"TLS_KEY": func(forward *Forward, val string) (err error) {
+		forward.TLSKey = val
+		return
+	},
+	"UPSTREAM_HOST": func(forward *Forward, val string) (err error) {
+		forward.UpstreamHost = val
+		return
+	},
+	"ALIAS": func(forward *Forward, val string) (err error) {
+		forward.Aliases = splitList(val)
+		return
+	},
+	"MATCH": func(forward *Forward, val string) (err error) {
+		matches := splitList(val)
+		for _, pattern := range matches {
+			if _, err = compileHostPattern(pattern); err != nil {
+				return
+			}
+		}
+		forward.Matches = matches
+		return
+	},
+	"HIDDEN": func(forward *Forward, val string) (err error) {
+		forward.Hidden, err = strconv.ParseBool(val)
+		return
+	},
+	"GEO_ALLOW": func(forward *Forward, val string) (err error) {
+		forward.GeoAllow = splitList(val)
+		return
+	},
+	"GEO_DENY": func(forward *Forward, val string) (err error) {
+		forward.GeoDeny = splitList(val)
+		return
+	},
+	"METHODS": func(forward *Forward, val string) (err error) {
+		forward.Methods, err = parseMethods(val)
+		return
+	},
+	"RESPONSE_HEADERS": func(forward *Forward, val string) (err error) {
+		forward.ResponseHeaders, err = ParseHeaderRules(val)
+		return
+	},
+	"REDIRECT": func(forward *Forward, val string) (err error) {
+		forward.Shortcut, err = ParseRedirect(val)
+		return
+	},
+	"RESPOND": func(forward *Forward, val string) (err error) {
+		forward.Shortcut, err = ParseRespond(val)
+		return
+	},
+	"STATIC": parseStatic,
+	"STATIC_INDEX": staticOption(func(static *StaticSite, val string) (err error) {
+		if strings.Contains(val, "/") {
+			err = fmt.Errorf("static index %v must be file name", val)
+			return
+		}
+		static.Index = val
+		return
+	}),
+	"STATIC_FALLBACK": staticOption(func(static *StaticSite, val string) (err error) {
+		static.Fallback = val
+		return
+	}),
+	"STATIC_MAX_AGE": staticOption(func(static *StaticSite, val string) (err error) {
+		static.MaxAge, err = time.ParseDuration(val)
+		return
+	}),
+	"STREAM": func(forward *Forward, val string) (err error) {
+		forward.Stream, err = strconv.ParseBool(val)
+		return
+	},
+	"WS_MAX": func(forward *Forward, val string) (err error) {
+		forward.WebSocketMax, err = strconv.Atoi(val)
+		return
+	},
+	"WS_IDLE": func(forward *Forward, val string) (err error) {
+		forward.WebSocketIdle, err = time.ParseDuration(val)
+		return
+	},
+	"WS_LIFETIME": func(forward *Forward, val string) (err error) {
+		forward.WebSocketLifetime, err = time.ParseDuration(val)
+		return
+	},
+	"WAF": func(forward *Forward, val string) (err error) {
+		if _, err = ParseWAFRules(val); err == nil {
+			forward.WAF = val
+		}
+		return
+	},
+	"AUTH": func(forward *Forward, val string) (err error) {
+		if val != "ldap" {
+			err = fmt.Errorf("auth %v is not supported", val)
+			return
+		}
+		forward.Auth = val
+		return
+	},
+	"AUTH_USER_HEADER": func(forward *Forward, val string) (err error) {
+		forward.AuthUserHeader = val
+		return
+	},
+	"AUTH_GROUPS_HEADER": func(forward *Forward, val string) (err error) {
+		forward.AuthGroupsHeader = val
+		return
+	},
+	"METRICS_PATH": func(forward *Forward, val string) (err error) {
+		forward.MetricsPath = val
+		return
+	},
+	"PROBE_PATH": func(forward *Forward, val string) (err error) {
+		if !strings.HasPrefix(val, "/") {
+			err = fmt.Errorf("probe path %v must start with /", val)
+			return
+		}
+		forward.ProbePath = val
+		return
+	},
+	"PROBE_STATUS": func(forward *Forward, val string) (err error) {
+		forward.ProbeStatus, err = strconv.Atoi(val)
+		return
+	},
+	"PROBE_SLO": func(forward *Forward, val string) (err error) {
+		forward.ProbeSLO, err = time.ParseDuration(val)
+		return
+	},
+	"CAPTURE": func(forward *Forward, val string) (err error) {
+		percent, err := strconv.Atoi(val)
+		if err == nil && (percent < 0 || percent > 100) {
+			err = fmt.Errorf("capture percent %v must be 0-100", val)
+		}
+		if err == nil {
+			forward.CapturePercent = percent
+		}
+		return
+	},
+	"MIDDLEWARE": func(forward *Forward, val string) (err error) {
+		forward.Middlewares = splitList(val)
+		return
+	},
+	"REWRITE": func(forward *Forward, val string) (err error) {
+		if _, err = ParseRewriteRules(val); err == nil {
+			forward.Rewrite = val
+		}
+		return
+	},
+	"DEFAULT": func(forward *Forward, val string) (err error) {
+		forward.Default, err = strconv.ParseBool(val)
+		return
+	},
+	"MIRROR": func(forward *Forward, val string) (err error) {
+		forward.MirrorVersion = val
+		if forward.MirrorPercent < 1 {
+			forward.MirrorPercent = 100
+		}
+		return
+	},
+	"MIRROR_PERCENT": func(forward *Forward, val string) (err error) {
+		forward.MirrorPercent, err = strconv.Atoi(val)
+		return
+	},
+	"CORS_ORIGINS": func(forward *Forward, val string) (err error) {
+		forward.corsPolicy().Origins = splitList(val)
+		return
+	},
+	"CORS_METHODS": func(forward *Forward, val string) (err error) {
+		forward.corsPolicy().Methods = splitList(val)
+		return
+	},
+	"CORS_HEADERS": func(forward *Forward, val string) (err error) {
+		forward.corsPolicy().Headers = splitList(val)
+		return
+	},
+	"CORS_CREDENTIALS": func(forward *Forward, val string) (err error) {
+		forward.corsPolicy().Credentials, err = strconv.ParseBool(val)
+		return
+	},
+	"CORS_MAX_AGE": func(forward *Forward, val string) (err error) {
+		forward.corsPolicy().MaxAge, err = strconv.Atoi(val)
+		return
+	},
+}
+
+func applyForwardOptions(container *Container, labels map[string]string) {
+	options := []string{}
+	for option := range forwardOptions {
+		options = append(options, option)
+	}
+	sort.Slice(options, func(i, j int) bool {
+		return len(options[i]) > len(options[j])
+	})
+	for key, val := range labels {
+		if !strings.HasPrefix(key, "PD_") {
+			continue
+		}
+		for _, option := range options {
+			name := ""
+			if key == "PD_"+option {
+				name = "*"
+			} else if strings.HasPrefix(key, "PD_"+option+"_") {
+				name = strings.TrimPrefix(key, "PD_"+option+"_")
+			} else {
+				continue
+			}
+			found := false
+			for _, forward := range container.Forwards {
+				if name != "*" && name != forward.Name {
+					continue
+				}
+				found = true
+				if err := forwardOptions[option](forward, val); err != nil {
+					container.addProblem(key, val, "%v", err)
+				}
+			}
+			if !found && name != "*" && !container.forwardFailed(name) {
+				container.addProblem(key, val, "forward %v is not found", name)
+			}
+			break
+		}
+	}
+}
+
+// isOptionLabel will return if the label is PD_<OPTION> or PD_<OPTION>_<NAME>
+func isOptionLabel(key string) bool {
+	for option := range forwardOptions {
+		if key == "PD_"+option || strings.HasPrefix(key, "PD_"+option+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+func splitScheme(portVal string) (scheme, port string, err error) {
+	port = portVal
+	index := strings.Index(portVal, ":")
+	if index < 1 {
+		return
+	}
+	for _, c := range portVal[:index] {
+		if c < '0' || c > '9' {
+			scheme, port = portVal[:index], portVal[index+1:]
+			break
+		}
+	}
+	if len(scheme) > 0 && scheme != "http" && scheme != "https" {
+		err = fmt.Errorf("scheme %v is not supported", scheme)
+	}
+	return
+}
+
+// LabelConfig is the json document of PD_CONFIG label which describes the container and all forwards,
+// it is expanded to PD_* labels, so the option of forward is same as PD_<OPTION> label
+type LabelConfig struct {
+	Token         string                   `json:"token,omitempty"`
+	Tenant        string                   `json:"tenant,omitempty"`
+	Role          string                   `json:"role,omitempty"`
+	RestartCron   string                   `json:"restart_cron,omitempty"`
+	RestartJitter string                   `json:"restart_jitter,omitempty"`
+	Update        string                   `json:"update,omitempty"`
+	Hooks         map[string]string        `json:"hooks,omitempty"`
+	Options       map[string]interface{}   `json:"options,omitempty"`
+	Forwards      map[string]*LabelForward `json:"forwards,omitempty"`
+}
+
+// LabelForward is the forward in PD_CONFIG label, the type is http/tcp/udp/unix and http by default,
+// the host is http host key, the listen is tcp/udp listen address, the path is unix socket path
+type LabelForward struct {
+	Type    string                 `json:"type,omitempty"`
+	Host    string                 `json:"host,omitempty"`
+	Scheme  string                 `json:"scheme,omitempty"`
+	Listen  string                 `json:"listen,omitempty"`
+	Path    string                 `json:"path,omitempty"`
+	Port    interface{}            `json:"port"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+func labelValue(val interface{}) (str string, err error) {
+	switch v := val.(type) {
+	case string:
+		str = v
+	case bool:
+		str = strconv.FormatBool(v)
+	case float64:
+		str = strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			var s string
+			if s, err = labelValue(item); err != nil {
+				return
+			}
+			items = append(items, s)
+		}
+		str = strings.Join(items, ",")
+	default:
+		err = fmt.Errorf("value %v is not supported", converter.JSON(val))
+	}
+	return
+}
+
+func addLabelOptions(labels map[string]string, name string, options map[string]interface{}) (err error) {
+	for key, val := range options {
+		option := strings.ToUpper(key)
+		if _, ok := forwardOptions[option]; !ok {
+			err = fmt.Errorf("option %v is not supported", key)
+			return
+		}
+		label := "PD_" + option
+		if len(name) > 0 {
+			label += "_" + name
+		}
+		if labels[label], err = labelValue(val); err != nil {
+			err = fmt.Errorf("option %v %v", key, err)
+			return
+		}
+	}
+	return
+}
+
+// ParseLabelConfig will parse the json PD_CONFIG label to PD_* labels
+func ParseLabelConfig(data string) (labels map[string]string, err error) {
+	config := &LabelConfig{}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(config); err != nil {
+		return
+	}
+	labels = map[string]string{}
+	for key, val := range map[string]string{
+		"PD_SERVICE_TOKEN":  config.Token,
+		"PD_TENANT":         config.Tenant,
+		"PD_SERVICE_ROLE":   config.Role,
+		"PD_RESTART_CRON":   config.RestartCron,
+		"PD_RESTART_JITTER": config.RestartJitter,
+		"PD_UPDATE":         config.Update,
+	} {
+		if len(val) > 0 {
+			labels[key] = val
+		}
+	}
+	for event, uri := range config.Hooks {
+		labels["PD_HOOK_"+strings.ToUpper(event)] = uri
+	}
+	if err = addLabelOptions(labels, "", config.Options); err != nil {
+		return
+	}
+	for name, forward := range config.Forwards {
+		name = strings.ToUpper(name)
+		if forward == nil || forward.Port == nil {
+			err = fmt.Errorf("forward %v port is required", name)
+			return
+		}
+		var port string
+		if port, err = labelValue(forward.Port); err != nil {
+			err = fmt.Errorf("forward %v port %v", name, err)
+			return
+		}
+		switch forward.Type {
+		case "", "http":
+			if len(forward.Scheme) > 0 {
+				port = forward.Scheme + ":" + port
+			}
+			if len(forward.Host) > 0 {
+				port = forward.Host + "/" + port
+			}
+			labels["PD_HOST_"+name] = port
+		case "tcp", "udp":
+			if len(forward.Listen) < 1 {
+				err = fmt.Errorf("forward %v listen is required", name)
+				return
+			}
+			labels["PD_"+strings.ToUpper(forward.Type)+"_"+name] = forward.Listen + "/" + port
+		case "unix":
+			if len(forward.Path) < 1 {
+				err = fmt.Errorf("forward %v path is required", name)
+				return
+			}
+			labels["PD_UNIX_"+name] = forward.Path + "/" + port
+		default:
+			err = fmt.Errorf("forward %v type %v is not supported", name, forward.Type)
+			return
+		}
+		if err = addLabelOptions(labels, name, forward.Options); err != nil {
+			err = fmt.Errorf("forward %v %v", name, err)
+			return
+		}
+	}
+	return
+}
+
+// expandLabels will expand the PD_CONFIG label to PD_* labels, the PD_* label which is set explicitly is not overridden
+func expandLabels(labels map[string]string) (expanded map[string]string, err error) {
+	data, ok := labels["PD_CONFIG"]
+	if !ok {
+		expanded = labels
+		return
+	}
+	expanded, err = ParseLabelConfig(data)
+	if err != nil {
+		expanded = labels
+		return
+	}
+	for key, val := range labels {
+		if key != "PD_CONFIG" {
+			expanded[key] = val
+		}
+	}
+	return
+}
+
+// labelTenant will return the tenant of container by PD_TENANT or PD_CONFIG label
+func labelTenant(labels map[string]string) string {
+	labels, _ = expandLabels(labels)
+	return labels["PD_TENANT"]
+}
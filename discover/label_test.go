@@ -0,0 +1,118 @@
+package discover
+
+import (
+	"testing"
+)
+
+func TestSplitScheme(t *testing.T) {
+	for val, expect := range map[string][2]string{
+		":80":         {"", ":80"},
+		"80":          {"", "80"},
+		"https::8443": {"https", ":8443"},
+		"https:8443":  {"https", "8443"},
+		"http::80":    {"http", ":80"},
+	} {
+		scheme, port, err := splitScheme(val)
+		if err != nil || scheme != expect[0] || port != expect[1] {
+			t.Errorf("%v->%v,%v,%v", val, scheme, port, err)
+			return
+		}
+	}
+	if _, _, err := splitScheme("ftp::21"); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestApplyForwardOptions(t *testing.T) {
+	container := &Container{
+		Forwards: map[string]*Forward{
+			"a.v100.ds": {Name: "A"},
+			"b.v100.ds": {Name: "B"},
+		},
+	}
+	applyForwardOptions(container, map[string]string{
+		"PD_TLS_SKIP_VERIFY": "1",
+		"PD_TLS_CA_A":        "ca.pem",
+		"PD_TLS_CA_X":        "x.pem",
+	})
+	if !container.Forwards["a.v100.ds"].TLSSkipVerify || !container.Forwards["b.v100.ds"].TLSSkipVerify {
+		t.Error("error")
+		return
+	}
+	if container.Forwards["a.v100.ds"].TLSCA != "ca.pem" || container.Forwards["b.v100.ds"].TLSCA != "" {
+		t.Error("error")
+		return
+	}
+}
+
+func TestParseLabelConfig(t *testing.T) {
+	labels, err := ParseLabelConfig(`{
+		"token": "abc",
+		"tenant": "team-a",
+		"hooks": {"added": "http://127.0.0.1/hook"},
+		"options": {"tls_skip_verify": true},
+		"forwards": {
+			"web": {"host": "admin", "scheme": "https", "port": 8443, "options": {"probe_path": "/health", "alias": ["a", "b"]}},
+			"ssh": {"type": "tcp", "listen": ":2022", "port": "22"},
+			"sock": {"type": "unix", "path": "/tmp/ds.sock", "port": "unix:///run/ds.sock"}
+		}
+	}`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expect := map[string]string{
+		"PD_SERVICE_TOKEN":   "abc",
+		"PD_TENANT":          "team-a",
+		"PD_HOOK_ADDED":      "http://127.0.0.1/hook",
+		"PD_TLS_SKIP_VERIFY": "true",
+		"PD_HOST_WEB":        "admin/https:8443",
+		"PD_PROBE_PATH_WEB":  "/health",
+		"PD_ALIAS_WEB":       "a,b",
+		"PD_TCP_SSH":         ":2022/22",
+		"PD_UNIX_SOCK":       "/tmp/ds.sock/unix:///run/ds.sock",
+	}
+	if len(labels) != len(expect) {
+		t.Error(labels)
+		return
+	}
+	for key, val := range expect {
+		if labels[key] != val {
+			t.Errorf("%v=%v", key, labels[key])
+			return
+		}
+	}
+	for _, data := range []string{
+		`xx`,
+		`{"unknown": 1}`,
+		`{"forwards": {"web": {}}}`,
+		`{"forwards": {"web": {"type": "ftp", "port": 21}}}`,
+		`{"forwards": {"ssh": {"type": "tcp", "port": 22}}}`,
+		`{"forwards": {"sock": {"type": "unix", "port": 22}}}`,
+		`{"forwards": {"web": {"port": {"a": 1}}}}`,
+		`{"forwards": {"web": {"port": 80, "options": {"none": 1}}}}`,
+		`{"options": {"alias": [{"a": 1}]}}`,
+	} {
+		if _, err = ParseLabelConfig(data); err == nil {
+			t.Error(data)
+			return
+		}
+	}
+	expanded, err := expandLabels(map[string]string{
+		"PD_CONFIG":   `{"tenant": "team-a", "forwards": {"web": {"port": 80}}}`,
+		"PD_HOST_WEB": "8080",
+	})
+	if err != nil || expanded["PD_HOST_WEB"] != "8080" || expanded["PD_TENANT"] != "team-a" || len(expanded["PD_CONFIG"]) > 0 {
+		t.Errorf("%v,%v", err, expanded)
+		return
+	}
+	if expanded, err = expandLabels(map[string]string{"PD_CONFIG": "xx", "PD_HOST_WEB": "80"}); err == nil || expanded["PD_HOST_WEB"] != "80" {
+		t.Errorf("%v,%v", err, expanded)
+		return
+	}
+	if labelTenant(map[string]string{"PD_CONFIG": `{"tenant": "team-b"}`}) != "team-b" || labelTenant(map[string]string{"PD_TENANT": "team-c"}) != "team-c" {
+		t.Error("tenant")
+		return
+	}
+}
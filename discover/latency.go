@@ -0,0 +1,278 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// latencyBounds is the upper bound in milliseconds of latency histogram bucket, the last bucket is unbounded
+var latencyBounds = []int64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 30000}
+
+const (
+	latencyHours = 48
+	latencyDays  = 30
+)
+
+// LatencyRollup is the latency histogram and error count of forward in one hour or day
+type LatencyRollup struct {
+	Start   time.Time `json:"start"`
+	Count   int64     `json:"count"`
+	Errors  int64     `json:"errors"`
+	Max     int64     `json:"max"`
+	Buckets []int64   `json:"buckets"`
+}
+
+func (l *LatencyRollup) add(used time.Duration, failed bool) {
+	ms := int64(used / time.Millisecond)
+	if len(l.Buckets) != len(latencyBounds)+1 {
+		l.Buckets = make([]int64, len(latencyBounds)+1)
+	}
+	i := sort.Search(len(latencyBounds), func(i int) bool { return latencyBounds[i] >= ms })
+	l.Buckets[i]++
+	l.Count++
+	if failed {
+		l.Errors++
+	}
+	if ms > l.Max {
+		l.Max = ms
+	}
+}
+
+// Percentile will return the latency in milliseconds of percentile p (0-1) by bucket upper bound, the Max is returned
+// when the percentile is in unbounded bucket
+func (l *LatencyRollup) Percentile(p float64) int64 {
+	if l.Count < 1 {
+		return 0
+	}
+	want := int64(p*float64(l.Count) + 0.5)
+	if want < 1 {
+		want = 1
+	}
+	having := int64(0)
+	for i, count := range l.Buckets {
+		having += count
+		if having >= want {
+			if i < len(latencyBounds) && latencyBounds[i] < l.Max {
+				return latencyBounds[i]
+			}
+			return l.Max
+		}
+	}
+	return l.Max
+}
+
+// LatencyReport is the percentile report of LatencyRollup
+type LatencyReport struct {
+	Start     time.Time `json:"start"`
+	Count     int64     `json:"count"`
+	Errors    int64     `json:"errors"`
+	ErrorRate float64   `json:"error_rate"`
+	P50       int64     `json:"p50"`
+	P95       int64     `json:"p95"`
+	P99       int64     `json:"p99"`
+	Max       int64     `json:"max"`
+}
+
+// Report will return the percentile report of rollup
+func (l *LatencyRollup) Report() (report LatencyReport) {
+	report = LatencyReport{
+		Start:  l.Start,
+		Count:  l.Count,
+		Errors: l.Errors,
+		P50:    l.Percentile(0.50),
+		P95:    l.Percentile(0.95),
+		P99:    l.Percentile(0.99),
+		Max:    l.Max,
+	}
+	if l.Count > 0 {
+		report.ErrorRate = float64(l.Errors) / float64(l.Count)
+	}
+	return
+}
+
+// latencyForward is the hourly and daily rollups of forward, sorted by start
+type latencyForward struct {
+	Name    string           `json:"name"`
+	Forward string           `json:"forward"`
+	Hourly  []*LatencyRollup `json:"hourly"`
+	Daily   []*LatencyRollup `json:"daily"`
+}
+
+func addRollup(rollups []*LatencyRollup, start time.Time, keep int, used time.Duration, failed bool) []*LatencyRollup {
+	if len(rollups) < 1 || rollups[len(rollups)-1].Start.Before(start) {
+		rollups = append(rollups, &LatencyRollup{Start: start})
+	}
+	rollups[len(rollups)-1].add(used, failed)
+	if len(rollups) > keep {
+		rollups = rollups[len(rollups)-keep:]
+	}
+	return rollups
+}
+
+// recordLatency will add the request latency to hourly and daily rollups of forward host, the 5xx status is counted as error
+func (d *Discover) recordLatency(reverse *ReverseProxy, used time.Duration, status int) {
+	host := d.hostOf(reverse.Forward.Tenant, reverse.Forward.Prefix)
+	now := time.Now()
+	hour := now.Truncate(time.Hour)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	failed := status >= http.StatusInternalServerError
+	d.latencyLock.Lock()
+	defer d.latencyLock.Unlock()
+	if d.latencyAll == nil {
+		d.latencyAll = map[string]*latencyForward{}
+	}
+	forward := d.latencyAll[host]
+	if forward == nil {
+		forward = &latencyForward{}
+		d.latencyAll[host] = forward
+	}
+	forward.Name, forward.Forward = reverse.Service.Name, reverse.Forward.Name
+	forward.Hourly = addRollup(forward.Hourly, hour, latencyHours, used, failed)
+	forward.Daily = addRollup(forward.Daily, day, latencyDays, used, failed)
+	d.latencyDirty = true
+}
+
+// LatencyReports will return the hourly or daily percentile reports by forward host, the period is hour or day
+func (d *Discover) LatencyReports(period string, match func(host string) bool) (reports map[string][]LatencyReport) {
+	reports = map[string][]LatencyReport{}
+	d.latencyLock.Lock()
+	defer d.latencyLock.Unlock()
+	for host, forward := range d.latencyAll {
+		if match != nil && !match(host) {
+			continue
+		}
+		rollups := forward.Hourly
+		if period == "day" {
+			rollups = forward.Daily
+		}
+		list := []LatencyReport{}
+		for _, rollup := range rollups {
+			list = append(list, rollup.Report())
+		}
+		reports[host] = list
+	}
+	return
+}
+
+// LoadLatency will load the latency rollups from LatencyFile, the not existed file is ignored
+func (d *Discover) LoadLatency() (err error) {
+	if len(d.LatencyFile) < 1 {
+		return
+	}
+	data, err := ioutil.ReadFile(d.LatencyFile)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	all := map[string]*latencyForward{}
+	if err = json.Unmarshal(data, &all); err != nil {
+		err = fmt.Errorf("parse %v fail with %v", d.LatencyFile, err)
+		return
+	}
+	d.latencyLock.Lock()
+	d.latencyAll = all
+	d.latencyLock.Unlock()
+	return
+}
+
+// saveLatency will save the latency rollups to LatencyFile when it is changed
+func (d *Discover) saveLatency() {
+	if len(d.LatencyFile) < 1 {
+		return
+	}
+	d.latencyLock.Lock()
+	if !d.latencyDirty {
+		d.latencyLock.Unlock()
+		return
+	}
+	data, err := json.Marshal(d.latencyAll)
+	d.latencyDirty = false
+	d.latencyLock.Unlock()
+	if err == nil {
+		tmp := d.LatencyFile + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, d.LatencyFile)
+		}
+	}
+	if err != nil {
+		WarnLog("Discover save latency to %v fail with %v", d.LatencyFile, err)
+	}
+}
+
+// procAdminLatency will serve the latency reports by period and optional host, the tenant only see the host of itself
+func (d *Discover) procAdminLatency(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	period := r.FormValue("period")
+	if len(period) < 1 {
+		period = "hour"
+	}
+	if period != "hour" && period != "day" {
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": fmt.Sprintf("invalid period %v", period)})
+		return
+	}
+	host := r.FormValue("host")
+	allowed := d.tenantHosts(tenant)
+	reports := d.LatencyReports(period, func(h string) bool {
+		return (len(host) < 1 || h == host) && (allowed == nil || allowed[h])
+	})
+	writeJSON(w, http.StatusOK, reports)
+}
+
+// tenantHosts will return the forward hosts of tenant, nil is returned for no tenant
+func (d *Discover) tenantHosts(tenant *Tenant) (hosts map[string]bool) {
+	if tenant == nil {
+		return
+	}
+	hosts = map[string]bool{}
+	d.proxyLock.RLock()
+	for prefix, service := range d.proxyAll {
+		if forward := service.Forwards[prefix]; forward != nil && inTenant(tenant, service) {
+			hosts[d.hostOf(forward.Tenant, prefix)] = true
+		}
+	}
+	d.proxyLock.RUnlock()
+	return
+}
+
+// latencyChart will render the svg bar chart of hourly p95 latency of host for catalog page
+func (d *Discover) latencyChart(host string) template.HTML {
+	reports := d.LatencyReports("hour", func(h string) bool { return h == host })[host]
+	if len(reports) < 1 {
+		return ""
+	}
+	if len(reports) > 24 {
+		reports = reports[len(reports)-24:]
+	}
+	max := int64(1)
+	for _, report := range reports {
+		if report.P95 > max {
+			max = report.P95
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, `<svg width="%v" height="20"><title>p95 by hour, max %vms</title>`, len(reports)*4, max)
+	for i, report := range reports {
+		height := report.P95 * 20 / max
+		if height < 1 {
+			height = 1
+		}
+		color := "#28a745"
+		if report.ErrorRate > 0.01 {
+			color = "#dc3545"
+		}
+		fmt.Fprintf(buf, `<rect x="%v" y="%v" width="3" height="%v" fill="%v"></rect>`, i*4, 20-height, height, color)
+	}
+	buf.WriteString("</svg>")
+	return template.HTML(buf.String())
+}
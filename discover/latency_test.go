@@ -0,0 +1,132 @@
+package discover
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingeasygo/util/converter"
+)
+
+func TestLatencyRollup(t *testing.T) {
+	rollup := &LatencyRollup{}
+	if rollup.Percentile(0.5) != 0 {
+		t.Error("error")
+		return
+	}
+	for i := 0; i < 90; i++ {
+		rollup.add(3*time.Millisecond, false)
+	}
+	for i := 0; i < 9; i++ {
+		rollup.add(150*time.Millisecond, false)
+	}
+	rollup.add(40*time.Second, true)
+	report := rollup.Report()
+	if report.Count != 100 || report.Errors != 1 || report.ErrorRate != 0.01 || report.P50 != 5 || report.P95 != 200 || report.P99 != 200 || report.Max != 40000 {
+		t.Error(converter.JSON(report))
+		return
+	}
+	if rollup.Percentile(1) != 40000 {
+		t.Error(rollup.Percentile(1))
+		return
+	}
+	rollups := []*LatencyRollup{}
+	start := time.Now().Truncate(time.Hour)
+	for i := 0; i < 5; i++ {
+		rollups = addRollup(rollups, start.Add(time.Duration(i)*time.Hour), 3, time.Millisecond, false)
+		rollups = addRollup(rollups, start.Add(time.Duration(i)*time.Hour), 3, time.Millisecond, false)
+	}
+	if len(rollups) != 3 || rollups[2].Count != 2 || !rollups[0].Start.Equal(start.Add(2*time.Hour)) {
+		t.Error(converter.JSON(rollups))
+		return
+	}
+}
+
+func TestLatency(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer backend.Close()
+	dir, _ := ioutil.TempDir("", "latency")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "latency.json")
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.HostSuff = ".test.loc"
+	discover.AdminToken = "123"
+	discover.Latency = true
+	discover.LatencyFile = file
+	forward := &Forward{Name: "web", Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://")}
+	service := &Container{ID: "c1", Name: "ds", Version: "1.0.0", Forwards: map[string]*Forward{"v100.ds": forward}}
+	proxy, _ := discover.newReverseProxy(forward)
+	discover.proxyReverse["v100.ds.test.loc"] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: service}
+	discover.proxyAll["v100.ds"] = service
+	for _, path := range []string{"/", "/", "/", "/error"} {
+		discover.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://v100.ds.test.loc"+path, nil))
+	}
+	call := func(path string) (res *httptest.ResponseRecorder, reports map[string][]LatencyReport) {
+		req := httptest.NewRequest("GET", "http://pdsrv"+path, nil)
+		req.Header.Set("Authorization", "Bearer 123")
+		res = httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		json.Unmarshal(res.Body.Bytes(), &reports)
+		return
+	}
+	for _, period := range []string{"hour", "day"} {
+		res, reports := call("/_api/latency?period=" + period)
+		if res.Code != http.StatusOK || len(reports["v100.ds.test.loc"]) != 1 || reports["v100.ds.test.loc"][0].Count != 4 || reports["v100.ds.test.loc"][0].Errors != 1 {
+			t.Errorf("%v,%v", res.Code, res.Body.String())
+			return
+		}
+	}
+	if res, reports := call("/_api/latency?host=xx"); res.Code != http.StatusOK || len(reports) != 0 {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res, _ := call("/_api/latency?period=xx"); res.Code != http.StatusBadRequest {
+		t.Error(res.Code)
+		return
+	}
+	//chart
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://pdsrv/", nil))
+	if !strings.Contains(res.Body.String(), "<svg") {
+		t.Error(res.Body.String())
+		return
+	}
+	//save and load
+	discover.saveLatency()
+	if _, err := os.Stat(file); err != nil {
+		t.Error(err)
+		return
+	}
+	loaded := NewDiscover()
+	loaded.LatencyFile = file
+	if err := loaded.LoadLatency(); err != nil {
+		t.Error(err)
+		return
+	}
+	if reports := loaded.LatencyReports("day", nil); len(reports["v100.ds.test.loc"]) != 1 || reports["v100.ds.test.loc"][0].Count != 4 {
+		t.Error(converter.JSON(reports))
+		return
+	}
+	loaded.LatencyFile = filepath.Join(dir, "none.json")
+	if err := loaded.LoadLatency(); err != nil {
+		t.Error(err)
+		return
+	}
+	ioutil.WriteFile(file, []byte("xx"), 0644)
+	loaded.LatencyFile = file
+	if err := loaded.LoadLatency(); err == nil {
+		t.Error("error")
+		return
+	}
+}
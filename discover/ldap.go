@@ -0,0 +1,416 @@
+package discover
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LDAP is the bind-based authentication by LDAP/Active Directory, the user is bound by UserDN which is formatted by username,
+// the groups of user is searched by UserAttr=username under BaseDN and mapped to role by Groups, the Role is used when no group is mapped
+type LDAP struct {
+	Addr       string
+	UserDN     string
+	BaseDN     string
+	UserAttr   string
+	Groups     map[string]string
+	Role       string
+	Timeout    time.Duration
+	SkipVerify bool
+	CacheTime  time.Duration
+	cacheAll   map[string]*ldapCached
+	cacheLock  sync.Mutex
+}
+
+type ldapCached struct {
+	Role     string
+	Groups   []string
+	CachedAt time.Time
+}
+
+const (
+	// ldapDefaultTimeout is the deadline of ldap connection when Timeout is not set
+	ldapDefaultTimeout = 10 * time.Second
+	// ldapMaxMessage is the max size of ldap response message, the larger message is rejected
+	ldapMaxMessage = 1 << 20
+)
+
+const (
+	berSequence    = 0x30
+	berInteger     = 0x02
+	berEnumerated  = 0x0a
+	berOctetString = 0x04
+	berBoolean     = 0x01
+)
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	buf := []byte{}
+	for ; n > 0; n >>= 8 {
+		buf = append([]byte{byte(n)}, buf...)
+	}
+	return append([]byte{0x80 | byte(len(buf))}, buf...)
+}
+
+func berEncode(tag byte, content ...[]byte) []byte {
+	body := []byte{}
+	for _, c := range content {
+		body = append(body, c...)
+	}
+	out := append([]byte{tag}, berLength(len(body))...)
+	return append(out, body...)
+}
+
+func berInt(tag byte, v int) []byte {
+	buf := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		buf = append([]byte{byte(v)}, buf...)
+	}
+	if buf[0]&0x80 != 0 {
+		buf = append([]byte{0}, buf...)
+	}
+	return berEncode(tag, buf)
+}
+
+func berString(tag byte, s string) []byte {
+	return berEncode(tag, []byte(s))
+}
+
+type berValue struct {
+	Tag      byte
+	Content  []byte
+	Children []*berValue
+}
+
+func berParse(data []byte) (value *berValue, rest []byte, err error) {
+	if len(data) < 2 {
+		err = fmt.Errorf("ber data is too short")
+		return
+	}
+	value = &berValue{Tag: data[0]}
+	length, offset := int(data[1]), 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n < 1 || n > 4 || len(data) < 2+n {
+			err = fmt.Errorf("ber length is invalid")
+			return
+		}
+		length = 0
+		for _, b := range data[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		offset += n
+	}
+	if len(data) < offset+length {
+		err = fmt.Errorf("ber data is too short")
+		return
+	}
+	value.Content, rest = data[offset:offset+length], data[offset+length:]
+	if value.Tag&0x20 != 0 {
+		for left := value.Content; len(left) > 0; {
+			var child *berValue
+			child, left, err = berParse(left)
+			if err != nil {
+				return
+			}
+			value.Children = append(value.Children, child)
+		}
+	}
+	return
+}
+
+func (b *berValue) Int() (v int) {
+	for _, c := range b.Content {
+		v = v<<8 | int(c)
+	}
+	return
+}
+
+func berRead(reader *bufio.Reader) (value *berValue, err error) {
+	head := make([]byte, 2)
+	if _, err = io.ReadFull(reader, head); err != nil {
+		return
+	}
+	data := append([]byte{}, head...)
+	length := int(head[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n < 1 || n > 4 {
+			err = fmt.Errorf("ber length is invalid")
+			return
+		}
+		buf := make([]byte, n)
+		if _, err = io.ReadFull(reader, buf); err != nil {
+			return
+		}
+		data = append(data, buf...)
+		length = 0
+		for _, b := range buf {
+			length = length<<8 | int(b)
+		}
+	}
+	if length < 0 || length > ldapMaxMessage {
+		err = fmt.Errorf("ber message size %v is too large", length)
+		return
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(reader, body); err != nil {
+		return
+	}
+	value, _, err = berParse(append(data, body...))
+	return
+}
+
+// ldapRead will read the ldap message and return the protocol operation, the message id must be same with request
+func ldapRead(reader *bufio.Reader, id int) (op *berValue, err error) {
+	res, err := berRead(reader)
+	if err != nil {
+		return
+	}
+	if len(res.Children) < 2 || res.Children[0].Tag != berInteger {
+		err = fmt.Errorf("invalid ldap message")
+		return
+	}
+	if msgID := res.Children[0].Int(); msgID != id {
+		err = fmt.Errorf("ldap message id %v is not matched to %v", msgID, id)
+		return
+	}
+	op = res.Children[1]
+	return
+}
+
+func (l *LDAP) timeout() time.Duration {
+	if l.Timeout > 0 {
+		return l.Timeout
+	}
+	return ldapDefaultTimeout
+}
+
+// escapeDN will escape the special characters of attribute value in distinguished name
+func escapeDN(v string) string {
+	buf := strings.Builder{}
+	for i, c := range v {
+		if strings.ContainsRune(`,+"\<>;=`, c) || (i == 0 && (c == '#' || c == ' ')) || (i == len(v)-1 && c == ' ') {
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(c)
+	}
+	return buf.String()
+}
+
+// dial will connect to ldap server by ldap:// or ldaps://
+func (l *LDAP) dial() (conn net.Conn, err error) {
+	uri, err := url.Parse(l.Addr)
+	if err != nil {
+		return
+	}
+	dialer := &net.Dialer{Timeout: l.timeout()}
+	switch uri.Scheme {
+	case "ldaps":
+		host := uri.Host
+		if len(uri.Port()) < 1 {
+			host = net.JoinHostPort(uri.Hostname(), "636")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: uri.Hostname(), InsecureSkipVerify: l.SkipVerify})
+	case "ldap":
+		host := uri.Host
+		if len(uri.Port()) < 1 {
+			host = net.JoinHostPort(uri.Hostname(), "389")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	default:
+		err = fmt.Errorf("ldap scheme %v is not supported", uri.Scheme)
+	}
+	if err == nil {
+		conn.SetDeadline(time.Now().Add(l.timeout()))
+	}
+	return
+}
+
+// Authenticate will bind by username/password and return the role of user groups, the Role is returned when user is not in any mapped group
+func (l *LDAP) Authenticate(username, password string) (role string, err error) {
+	role, _, err = l.Identify(username, password)
+	return
+}
+
+// Identify will bind by username/password and return the role and groups of user
+func (l *LDAP) Identify(username, password string) (role string, groups []string, err error) {
+	if len(username) < 1 || len(password) < 1 {
+		err = fmt.Errorf("username and password is required")
+		return
+	}
+	sum := sha256.Sum256([]byte(username + "\x00" + password))
+	cacheKey := hex.EncodeToString(sum[:])
+	l.cacheLock.Lock()
+	cached := l.cacheAll[cacheKey]
+	l.cacheLock.Unlock()
+	if cached != nil && time.Since(cached.CachedAt) < l.CacheTime {
+		role, groups = cached.Role, cached.Groups
+		return
+	}
+	conn, err := l.dial()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	bind := berEncode(0x60, berInt(berInteger, 3), berString(berOctetString, fmt.Sprintf(l.UserDN, escapeDN(username))), berString(0x80, password))
+	if _, err = conn.Write(berEncode(berSequence, berInt(berInteger, 1), bind)); err != nil {
+		return
+	}
+	res, err := ldapRead(reader, 1)
+	if err != nil {
+		return
+	}
+	if res.Tag != 0x61 || len(res.Children) < 1 {
+		err = fmt.Errorf("invalid bind response")
+		return
+	}
+	if code := res.Children[0].Int(); code != 0 {
+		err = fmt.Errorf("bind fail with code %v", code)
+		return
+	}
+	groups, err = l.searchGroups(conn, reader, username)
+	if err != nil {
+		return
+	}
+	role = l.mapRole(groups)
+	if len(role) < 1 {
+		role = l.Role
+	}
+	conn.Write(berEncode(berSequence, berInt(berInteger, 3), []byte{0x42, 0x00}))
+	l.cacheLock.Lock()
+	if l.cacheAll == nil {
+		l.cacheAll = map[string]*ldapCached{}
+	}
+	for key, c := range l.cacheAll {
+		if time.Since(c.CachedAt) >= l.CacheTime {
+			delete(l.cacheAll, key)
+		}
+	}
+	if l.CacheTime > 0 {
+		l.cacheAll[cacheKey] = &ldapCached{Role: role, Groups: groups, CachedAt: time.Now()}
+	}
+	l.cacheLock.Unlock()
+	return
+}
+
+func (l *LDAP) searchGroups(conn net.Conn, reader *bufio.Reader, username string) (groups []string, err error) {
+	if len(l.BaseDN) < 1 {
+		return
+	}
+	attr := l.UserAttr
+	if len(attr) < 1 {
+		attr = "uid"
+	}
+	search := berEncode(0x63,
+		berString(berOctetString, l.BaseDN),
+		berInt(berEnumerated, 2),
+		berInt(berEnumerated, 0),
+		berInt(berInteger, 1),
+		berInt(berInteger, int(l.timeout()/time.Second)),
+		berEncode(berBoolean, []byte{0}),
+		berEncode(0xa3, berString(berOctetString, attr), berString(berOctetString, username)),
+		berEncode(berSequence, berString(berOctetString, "memberOf")),
+	)
+	if _, err = conn.Write(berEncode(berSequence, berInt(berInteger, 2), search)); err != nil {
+		return
+	}
+	for {
+		var op *berValue
+		op, err = ldapRead(reader, 2)
+		if err != nil {
+			return
+		}
+		switch op.Tag {
+		case 0x64:
+			if len(op.Children) < 2 {
+				continue
+			}
+			for _, attribute := range op.Children[1].Children {
+				if len(attribute.Children) < 2 || !strings.EqualFold(string(attribute.Children[0].Content), "memberOf") {
+					continue
+				}
+				for _, val := range attribute.Children[1].Children {
+					groups = append(groups, string(val.Content))
+				}
+			}
+		case 0x65:
+			if len(op.Children) > 0 {
+				if code := op.Children[0].Int(); code != 0 && code != 4 {
+					err = fmt.Errorf("search fail with code %v", code)
+				}
+			}
+			return
+		}
+	}
+}
+
+// mapRole will return the highest role of groups, the group is matched by full dn or cn
+func (l *LDAP) mapRole(groups []string) (role string) {
+	for _, group := range groups {
+		cn := group
+		if strings.HasPrefix(strings.ToLower(group), "cn=") {
+			cn = strings.SplitN(group[3:], ",", 2)[0]
+		}
+		for _, key := range []string{group, cn} {
+			if r, ok := l.Groups[key]; ok && roleLevel(r) > roleLevel(role) {
+				role = r
+			}
+		}
+	}
+	return
+}
+
+// ParseLDAPGroups will parse the group to role mapping by group=role, the role is viewer/operator/admin
+func ParseLDAPGroups(groups []string) (parsed map[string]string, err error) {
+	parsed = map[string]string{}
+	for _, group := range groups {
+		i := strings.LastIndex(group, "=")
+		if i < 1 || roleLevel(group[i+1:]) < 1 {
+			err = fmt.Errorf("invalid ldap group %v, must be group=viewer|operator|admin", group)
+			return
+		}
+		parsed[group[:i]] = group[i+1:]
+	}
+	return
+}
+
+// ldapRole will authenticate the basic auth of request by LDAP and return the role, empty is returned when LDAP is not configured or fail
+func (d *Discover) ldapRole(r *http.Request) (role string) {
+	if d.LDAP == nil {
+		return
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return
+	}
+	role, err := d.LDAP.Authenticate(username, password)
+	if err != nil {
+		WarnLog("Discover audit ldap authentication of %v from %v fail with %v", username, r.RemoteAddr, err)
+		role = ""
+	}
+	return
+}
+
+// procCatalogAuth will check the LDAP login of catalog when LDAPCatalog is enabled, any mapped role can view catalog
+func (d *Discover) procCatalogAuth(w http.ResponseWriter, r *http.Request) bool {
+	if d.LDAP == nil || !d.LDAPCatalog || len(d.ldapRole(r)) > 0 {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="pdservice"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprintf(w, "unauthorized")
+	return false
+}
@@ -0,0 +1,184 @@
+package discover
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runTestLDAP(t *testing.T, users map[string]string, groups map[string][]string) (ln net.Listener, binds *int) {
+	ln, _ = net.Listen("tcp", "127.0.0.1:0")
+	binds = new(int)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					req, err := berRead(reader)
+					if err != nil || len(req.Children) < 2 {
+						return
+					}
+					id, op := req.Children[0].Int(), req.Children[1]
+					switch op.Tag {
+					case 0x60:
+						*binds++
+						dn, password := string(op.Children[1].Content), string(op.Children[2].Content)
+						code := 49
+						if users[dn] == password {
+							code = 0
+						}
+						conn.Write(berEncode(berSequence, berInt(berInteger, id), berEncode(0x61, berInt(berEnumerated, code), berString(berOctetString, ""), berString(berOctetString, ""))))
+					case 0x63:
+						username := string(op.Children[6].Children[1].Content)
+						vals := [][]byte{}
+						for _, group := range groups[username] {
+							vals = append(vals, berString(berOctetString, group))
+						}
+						attrs := berEncode(berSequence, berEncode(berSequence, berString(berOctetString, "memberOf"), berEncode(0x31, vals...)))
+						conn.Write(berEncode(berSequence, berInt(berInteger, id), berEncode(0x64, berString(berOctetString, "uid="+username), attrs)))
+						conn.Write(berEncode(berSequence, berInt(berInteger, id), berEncode(0x65, berInt(berEnumerated, 0), berString(berOctetString, ""), berString(berOctetString, ""))))
+					default:
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return
+}
+
+func TestLDAP(t *testing.T) {
+	ln, binds := runTestLDAP(t, map[string]string{
+		"uid=u1,dc=test": "p1",
+		"uid=u2,dc=test": "p2",
+		"uid=u3,dc=test": "p3",
+	}, map[string][]string{
+		"u1": {"cn=ops,ou=groups,dc=test", "cn=dev,ou=groups,dc=test"},
+		"u2": {"cn=dev,ou=groups,dc=test"},
+	})
+	defer ln.Close()
+	groups, err := ParseLDAPGroups([]string{"ops=admin", "dev=viewer"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = ParseLDAPGroups([]string{"ops=xx"}); err == nil {
+		t.Error(err)
+		return
+	}
+	ldap := &LDAP{
+		Addr:      "ldap://" + ln.Addr().String(),
+		UserDN:    "uid=%v,dc=test",
+		BaseDN:    "dc=test",
+		Groups:    groups,
+		Timeout:   time.Second,
+		CacheTime: time.Minute,
+	}
+	for username, expect := range map[string]string{"u1": "admin", "u2": "viewer", "u3": ""} {
+		role, err := ldap.Authenticate(username, "p"+username[1:])
+		if err != nil || role != expect {
+			t.Error(username, role, err)
+			return
+		}
+	}
+	if _, err = ldap.Authenticate("u1", "xx"); err == nil {
+		t.Error(err)
+		return
+	}
+	if _, err = ldap.Authenticate("u1", ""); err == nil {
+		t.Error(err)
+		return
+	}
+	//cache
+	*binds = 0
+	if role, _ := ldap.Authenticate("u1", "p1"); role != "admin" || *binds != 0 {
+		t.Error(role, *binds)
+		return
+	}
+	//default role
+	ldap.Role = "viewer"
+	ldap.CacheTime = 0
+	if role, _ := ldap.Authenticate("u3", "p3"); role != "viewer" {
+		t.Error(role)
+		return
+	}
+	if escaped := escapeDN("a,b=c "); escaped != `a\,b\=c\ ` {
+		t.Error(escaped)
+		return
+	}
+	ldap.Addr = "http://127.0.0.1"
+	if _, err = ldap.Authenticate("u1", "p1"); err == nil {
+		t.Error(err)
+		return
+	}
+	ldap.Addr = "ldap://" + ln.Addr().String()
+	//admin api and catalog
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.LDAP = ldap
+	discover.LDAPCatalog = true
+	call := func(path, username, password string) int {
+		req := httptest.NewRequest("GET", "http://pdsrv"+path, nil)
+		if len(username) > 0 {
+			req.SetBasicAuth(username, password)
+		}
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return res.Code
+	}
+	if code := call("/_api/status", "u1", "p1"); code != http.StatusOK {
+		t.Error(code)
+		return
+	}
+	if code := call("/_api/status", "u3", "xx"); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	if code := call("/", "", ""); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	if code := call("/", "u2", "p2"); code != http.StatusOK {
+		t.Error(code)
+		return
+	}
+	//message id
+	bad, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer bad.Close()
+	go func() {
+		for {
+			conn, err := bad.Accept()
+			if err != nil {
+				return
+			}
+			berRead(bufio.NewReader(conn))
+			conn.Write(berEncode(berSequence, berInt(berInteger, 9), berEncode(0x61, berInt(berEnumerated, 0), berString(berOctetString, ""), berString(berOctetString, ""))))
+			conn.Close()
+		}
+	}()
+	ldap.Addr = "ldap://" + bad.Addr().String()
+	if _, err = ldap.Authenticate("u1", "p1"); err == nil || !strings.Contains(err.Error(), "message id") {
+		t.Error(err)
+		return
+	}
+	//message size
+	if _, err = berRead(bufio.NewReader(bytes.NewReader([]byte{berSequence, 0x84, 0x7f, 0xff, 0xff, 0xff}))); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Error(err)
+		return
+	}
+	//default timeout
+	if timeout := (&LDAP{}).timeout(); timeout != ldapDefaultTimeout {
+		t.Error(timeout)
+		return
+	}
+}
@@ -0,0 +1,118 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// LabelProblem is the problem of PD_* label which is found on parsing container, the Label is empty on prefix collision
+type LabelProblem struct {
+	Label   string `json:"label,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// LabelLint is the label problems of container
+type LabelLint struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Version  string          `json:"version"`
+	Problems []*LabelProblem `json:"problems"`
+}
+
+func newLabelLint(container *Container) *LabelLint {
+	return &LabelLint{ID: container.ID, Name: container.Name, Version: container.Version, Problems: container.Problems}
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// addProblem will record the label problem to container and warn log it
+func (c *Container) addProblem(label, value, format string, args ...interface{}) {
+	problem := &LabelProblem{Label: label, Value: value, Message: fmt.Sprintf(format, args...)}
+	WarnLog("Discover parse container %v-%v lable %v=%v fail with %v", c.Name, c.Version, label, value, problem.Message)
+	c.Problems = append(c.Problems, problem)
+}
+
+// forwardFailed will return if the forward label of name is failed to parse
+func (c *Container) forwardFailed(name string) bool {
+	for _, problem := range c.Problems {
+		for _, prefix := range []string{"PD_HOST_", "PD_TCP_", "PD_UDP_", "PD_UNIX_"} {
+			if problem.Label == prefix+name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LabelLints will return the label problems of all running containers found on last refresh
+func (d *Discover) LabelLints() (lints []*LabelLint) {
+	lints = []*LabelLint{}
+	d.lintLock.RLock()
+	for _, lint := range d.labelLints {
+		lints = append(lints, lint)
+	}
+	d.lintLock.RUnlock()
+	sort.Slice(lints, func(i, j int) bool {
+		if lints[i].Name != lints[j].Name {
+			return lints[i].Name < lints[j].Name
+		}
+		return lints[i].Version < lints[j].Version
+	})
+	return
+}
+
+// LintContainer will inspect the container by id or name and check the PD_* labels,
+// the prefix collision is checked by current proxy table
+func (d *Discover) LintContainer(ref string) (lint *LabelLint, err error) {
+	cli, remoteHost, err := d.newDockerClient()
+	if err != nil {
+		return
+	}
+	inspect, err := cli.ContainerInspect(context.Background(), ref)
+	if err != nil {
+		return
+	}
+	container, _ := d.parseContainer(inspect, remoteHost, d.isLocalDocker())
+	if container == nil {
+		err = fmt.Errorf("container %v is not matched by name <name>%vv<version>", strings.TrimPrefix(inspect.Name, "/"), d.MatchKey)
+		return
+	}
+	d.proxyLock.RLock()
+	for prefix := range container.Forwards {
+		if other := d.proxyAll[prefix]; other != nil && other.ID != container.ID {
+			container.addProblem("", prefix, "prefix is also used by %v-%v(%v)", other.Name, other.Version, shortID(other.ID))
+		}
+	}
+	d.proxyLock.RUnlock()
+	lint = newLabelLint(container)
+	if lint.Problems == nil {
+		lint.Problems = []*LabelProblem{}
+	}
+	return
+}
+
+// procAdminLint will show the label problems of container by id/name or all containers
+func (d *Discover) procAdminLint(w http.ResponseWriter, r *http.Request) {
+	ref := r.FormValue("container")
+	if len(ref) < 1 {
+		writeJSON(w, http.StatusOK, d.LabelLints())
+		return
+	}
+	lint, err := d.LintContainer(ref)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, lint)
+}
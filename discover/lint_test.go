@@ -0,0 +1,83 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestParseContainerLint(t *testing.T) {
+	discover := NewDiscover()
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    "0123456789abcdef",
+			Name:  "/ds-srv-v1.0.0",
+			State: &types.ContainerState{Status: "running"},
+		},
+		Config: &container.Config{Labels: map[string]string{
+			"PD_HOST_WEB":         "8080",
+			"PD_HOST_API":         "9090",
+			"PD_TLS_CA_API":       "ca.pem",
+			"PD_TLS_CA_X":         "x.pem",
+			"PD_HOTS_X":           "80",
+			"PD_SERVICE_ROLE":     "none",
+			"PD_PROBE_STATUS_WEB": "abc",
+			"OTHER":               "1",
+		}},
+		NetworkSettings: &types.NetworkSettings{NetworkSettingsBase: types.NetworkSettingsBase{Ports: nat.PortMap{
+			"8080/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: "18080"}},
+		}}},
+	}
+	service, ok := discover.parseContainer(inspect, "127.0.0.1", false)
+	if !ok || service.Name != "ds" || service.Version != "v1.0.0" || len(service.Forwards) != 1 || service.Forwards["v100.ds"] == nil {
+		t.Error(service)
+		return
+	}
+	problems := map[string]string{}
+	for _, problem := range service.Problems {
+		problems[problem.Label] = problem.Message
+	}
+	if len(problems) != 5 || !strings.Contains(problems["PD_HOST_API"], "not published") || !strings.Contains(problems["PD_TLS_CA_X"], "not found") ||
+		problems["PD_HOTS_X"] != "label is unknown" || len(problems["PD_SERVICE_ROLE"]) < 1 || len(problems["PD_PROBE_STATUS_WEB"]) < 1 {
+		t.Error(problems)
+		return
+	}
+	inspect.Config.Labels = map[string]string{"PD_TENANT": "-"}
+	if _, ok = discover.parseContainer(inspect, "127.0.0.1", false); ok {
+		t.Error("tenant")
+		return
+	}
+	inspect.Name = "/other"
+	if service, _ = discover.parseContainer(inspect, "127.0.0.1", false); service != nil {
+		t.Error(service)
+		return
+	}
+	//lint api
+	discover.HostSelf = "pdsrv"
+	discover.AdminToken = "123"
+	discover.labelLints = map[string]*LabelLint{
+		"2": {ID: "2", Name: "ds", Version: "v2", Problems: []*LabelProblem{{Label: "PD_HOTS_X", Message: "label is unknown"}}},
+		"1": {ID: "1", Name: "ds", Version: "v1", Problems: []*LabelProblem{{Message: "prefix is also used"}}},
+	}
+	if lints := discover.LabelLints(); len(lints) != 2 || lints[0].ID != "1" {
+		t.Error(lints)
+		return
+	}
+	req := httptest.NewRequest("GET", "http://pdsrv/_api/lint", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "PD_HOTS_X") {
+		t.Error(res.Body.String())
+		return
+	}
+	if shortID("0123456789abcdef") != "0123456789ab" || shortID("1") != "1" {
+		t.Error("short")
+		return
+	}
+}
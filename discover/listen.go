@@ -0,0 +1,155 @@
+package discover
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type inheritedSocket struct {
+	Name     string
+	Listener net.Listener
+	Packet   net.PacketConn
+}
+
+var inheritedAll []*inheritedSocket
+var inheritedLoaded bool
+var inheritedLock = sync.Mutex{}
+
+func loadInheritedFile(fd int, name string) {
+	file := os.NewFile(uintptr(fd), name)
+	socket := &inheritedSocket{Name: name}
+	if ln, err := net.FileListener(file); err == nil {
+		socket.Listener = ln
+	} else if conn, err := net.FilePacketConn(file); err == nil {
+		socket.Packet = conn
+	} else {
+		WarnLog("Discover load inherited socket %v/%v fail with %v", fd, name, err)
+	}
+	file.Close()
+	if socket.Listener != nil || socket.Packet != nil {
+		InfoLog("Discover load inherited socket %v/%v success", fd, name)
+		inheritedAll = append(inheritedAll, socket)
+	}
+}
+
+// loadInherited will load sockets passed by systemd socket activation, see sd_listen_fds,
+// and sockets handed over by upgrade which is passed by PDSERVICE_UPGRADE_FDS
+func loadInherited() {
+	if inheritedLoaded {
+		return
+	}
+	inheritedLoaded = true
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid == os.Getpid() {
+		fds, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		for i := 0; i < fds; i++ {
+			name := ""
+			if i < len(names) {
+				name = names[i]
+			}
+			loadInheritedFile(3+i, name)
+		}
+	}
+	if pid, _ := strconv.Atoi(os.Getenv("PDSERVICE_UPGRADE_PID")); pid == os.Getpid() {
+		for _, item := range strings.Split(os.Getenv("PDSERVICE_UPGRADE_FDS"), ",") {
+			parts := strings.SplitN(item, ":", 2)
+			fd, err := strconv.Atoi(parts[0])
+			if len(parts) < 2 || err != nil {
+				continue
+			}
+			loadInheritedFile(fd, parts[1])
+		}
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	os.Unsetenv("PDSERVICE_UPGRADE_PID")
+	os.Unsetenv("PDSERVICE_UPGRADE_FDS")
+}
+
+func matchAddr(addr net.Addr, name, address string) bool {
+	if name == address || addr.String() == address {
+		return true
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	addrHost, addrPort, err := net.SplitHostPort(addr.String())
+	if err != nil || addrPort != port {
+		return false
+	}
+	if len(host) < 1 || host == addrHost {
+		return true
+	}
+	ip, addrIP := net.ParseIP(host), net.ParseIP(addrHost)
+	return ip != nil && addrIP != nil && ip.Equal(addrIP)
+}
+
+func takeInherited(address string, packet bool) (socket *inheritedSocket) {
+	inheritedLock.Lock()
+	defer inheritedLock.Unlock()
+	loadInherited()
+	for i, s := range inheritedAll {
+		if packet && s.Packet != nil && matchAddr(s.Packet.LocalAddr(), s.Name, address) ||
+			!packet && s.Listener != nil && matchAddr(s.Listener.Addr(), s.Name, address) {
+			socket = s
+			inheritedAll = append(inheritedAll[:i], inheritedAll[i+1:]...)
+			break
+		}
+	}
+	return
+}
+
+// removeStaleSocket will remove the unix socket file which is left by previous crashed process,
+// the socket which is still accepted by other process is kept
+func removeStaleSocket(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return
+	}
+	InfoLog("Discover remove stale unix socket %v", path)
+	os.Remove(path)
+}
+
+// Listen will listen stream socket on address, the socket passed by systemd socket activation is used first if it is matched.
+// SO_REUSEPORT will be set to new socket when reuse is true.
+func Listen(network, address string, reuse bool) (ln net.Listener, err error) {
+	if socket := takeInherited(address, false); socket != nil {
+		ln = socket.Listener
+		return
+	}
+	if network == "unix" {
+		removeStaleSocket(address)
+	}
+	config := &net.ListenConfig{}
+	if reuse && network != "unix" {
+		config.Control = reusePortControl
+	}
+	ln, err = config.Listen(context.Background(), network, address)
+	return
+}
+
+// ListenPacket will listen packet socket on address, the socket passed by systemd socket activation is used first if it is matched.
+// SO_REUSEPORT will be set to new socket when reuse is true.
+func ListenPacket(network, address string, reuse bool) (conn net.PacketConn, err error) {
+	if socket := takeInherited(address, true); socket != nil {
+		conn = socket.Packet
+		return
+	}
+	config := &net.ListenConfig{}
+	if reuse {
+		config.Control = reusePortControl
+	}
+	conn, err = config.ListenPacket(context.Background(), network, address)
+	return
+}
@@ -0,0 +1,37 @@
+package discover
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMatchAddr(t *testing.T) {
+	tcp := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080}
+	any6 := &net.TCPAddr{IP: net.IPv6zero, Port: 8080}
+	for i, c := range []struct {
+		Addr    net.Addr
+		Name    string
+		Address string
+		Match   bool
+	}{
+		{tcp, "", "127.0.0.1:8080", true},
+		{tcp, "web", "web", true},
+		{tcp, "web", "api", false},
+		{tcp, "", ":8080", true},
+		{tcp, "", ":8081", false},
+		{tcp, "", "127.0.0.2:8080", false},
+		{tcp, "", "localhost:8080", false},
+		{tcp, "", "::ffff:127.0.0.1", false},
+		{&net.TCPAddr{IP: net.ParseIP("::ffff:127.0.0.1"), Port: 8080}, "", "[::ffff:127.0.0.1]:8080", true},
+		{any6, "", "[::]:8080", true},
+		{any6, "", "[0:0::0]:8080", true},
+		{any6, "", "0.0.0.0:8080", false},
+		{&net.UnixAddr{Name: "/tmp/x.sock", Net: "unix"}, "", "/tmp/x.sock", true},
+		{&net.UnixAddr{Name: "/tmp/x.sock", Net: "unix"}, "", "/tmp/y.sock", false},
+	} {
+		if match := matchAddr(c.Addr, c.Name, c.Address); match != c.Match {
+			t.Errorf("%v: %v,%v,%v->%v", i, c.Addr, c.Name, c.Address, match)
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package discover
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func resetInherited() {
+	inheritedLock.Lock()
+	for _, socket := range inheritedAll {
+		if socket.Listener != nil {
+			socket.Listener.Close()
+		}
+		if socket.Packet != nil {
+			socket.Packet.Close()
+		}
+	}
+	inheritedAll, inheritedLoaded = nil, false
+	inheritedLock.Unlock()
+}
+
+func TestReusePort(t *testing.T) {
+	ln1, err := Listen("tcp", "127.0.0.1:0", true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ln1.Close()
+	ln2, err := Listen("tcp", ln1.Addr().String(), true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ln2.Close()
+	if ln3, err := Listen("tcp", ln1.Addr().String(), false); err == nil {
+		ln3.Close()
+		t.Error("not error")
+		return
+	}
+	conn1, err := ListenPacket("udp", "127.0.0.1:0", true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn1.Close()
+	conn2, err := ListenPacket("udp", conn1.LocalAddr().String(), true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conn2.Close()
+}
+
+func TestInheritedUpgrade(t *testing.T) {
+	resetInherited()
+	defer resetInherited()
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	conn, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	defer conn.Close()
+	//the dup fd is owned by loadInherited
+	dupFD := func(c syscall.Conn) (fd int) {
+		raw, _ := c.SyscallConn()
+		raw.Control(func(s uintptr) { fd, _ = syscall.Dup(int(s)) })
+		return
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	os.Setenv("PDSERVICE_UPGRADE_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("PDSERVICE_UPGRADE_FDS", fmt.Sprintf("%v:%v,%v:%v,x:y", dupFD(ln.(*net.TCPListener)), ln.Addr(), dupFD(conn.(*net.UDPConn)), conn.LocalAddr()))
+	//packet is not matched by stream socket
+	if socket := takeInherited(ln.Addr().String(), true); socket != nil {
+		t.Error(socket)
+		return
+	}
+	if os.Getenv("PDSERVICE_UPGRADE_FDS") != "" {
+		t.Error("env is not cleared")
+		return
+	}
+	inherited, err := Listen("tcp", ":"+port, false)
+	if err != nil || inherited.Addr().String() != ln.Addr().String() {
+		t.Errorf("%v,%v", err, inherited)
+		return
+	}
+	inherited.Close()
+	packet, err := ListenPacket("udp", conn.LocalAddr().String(), false)
+	if err != nil || packet.LocalAddr().String() != conn.LocalAddr().String() {
+		t.Errorf("%v,%v", err, packet)
+		return
+	}
+	packet.Close()
+	//taken socket is not returned again
+	if socket := takeInherited(ln.Addr().String(), false); socket != nil {
+		t.Error(socket)
+		return
+	}
+}
+
+func TestInheritedSystemd(t *testing.T) {
+	if os.Getenv("PDSERVICE_TEST_INHERITED") == "1" {
+		//running in child process with fd 3 and 4 passed by parent
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		resetInherited()
+		ln, err := Listen("tcp", "web", false)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn, err := ListenPacket("udp", os.Getenv("PDSERVICE_TEST_UDP"), false)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		fmt.Printf("inherited %v %v\n", ln.Addr(), conn.LocalAddr())
+		return
+	}
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer ln.Close()
+	lnFile, _ := ln.(*net.TCPListener).File()
+	defer lnFile.Close()
+	conn, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	defer conn.Close()
+	connFile, _ := conn.(*net.UDPConn).File()
+	defer connFile.Close()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInheritedSystemd$", "-test.v")
+	cmd.Env = append(os.Environ(), "PDSERVICE_TEST_INHERITED=1", "PDSERVICE_TEST_UDP="+conn.LocalAddr().String(), "LISTEN_FDS=2", "LISTEN_FDNAMES=web:dns")
+	cmd.ExtraFiles = []*os.File{lnFile, connFile}
+	out, err := cmd.CombinedOutput()
+	if err != nil || !strings.Contains(string(out), fmt.Sprintf("inherited %v %v\n", ln.Addr(), conn.LocalAddr())) {
+		t.Errorf("%v,%v", err, string(out))
+		return
+	}
+}
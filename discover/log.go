@@ -3,6 +3,7 @@ package discover
 import (
 	"fmt"
 	"log"
+	"sync/atomic"
 )
 
 const (
@@ -16,43 +17,56 @@ const (
 	LogLevelError = 10
 )
 
-var logLevel = LogLevelInfo
+var logLevel int32 = LogLevelInfo
 
-//SetLogLevel is set log level to l
+//SetLogLevel is set log level to l, it is the default level of module which is not set by SetModuleLogLevel
 func SetLogLevel(l int) {
 	if l > 0 {
-		logLevel = l
+		atomic.StoreInt32(&logLevel, int32(l))
 	}
 }
 
+//GetLogLevel will return the global log level
+func GetLogLevel() int {
+	return int(atomic.LoadInt32(&logLevel))
+}
+
 //DebugLog is the debug level log
 func DebugLog(format string, args ...interface{}) {
-	if logLevel < LogLevelDebug {
+	if !logEnabled(LogLevelDebug) {
 		return
 	}
-	log.Output(2, fmt.Sprintf("D "+format, args...))
+	message := fmt.Sprintf(format, args...)
+	log.Output(2, "D "+message)
+	shipLog("debug", message, nil)
 }
 
 //InfoLog is the info level log
 func InfoLog(format string, args ...interface{}) {
-	if logLevel < LogLevelInfo {
+	if !logEnabled(LogLevelInfo) {
 		return
 	}
-	log.Output(2, fmt.Sprintf("I "+format, args...))
+	message := fmt.Sprintf(format, args...)
+	log.Output(2, "I "+message)
+	shipLog("info", message, nil)
 }
 
 //WarnLog is the warn level log
 func WarnLog(format string, args ...interface{}) {
-	if logLevel < LogLevelWarn {
+	if !logEnabled(LogLevelWarn) {
 		return
 	}
-	log.Output(2, fmt.Sprintf("W "+format, args...))
+	message := fmt.Sprintf(format, args...)
+	log.Output(2, "W "+message)
+	shipLog("warn", message, nil)
 }
 
 //ErrorLog is the error level log
 func ErrorLog(format string, args ...interface{}) {
-	if logLevel < LogLevelError {
+	if !logEnabled(LogLevelError) {
 		return
 	}
-	log.Output(2, fmt.Sprintf("E "+format, args...))
+	message := fmt.Sprintf(format, args...)
+	log.Output(2, "E "+message)
+	shipLog("error", message, nil)
 }
@@ -0,0 +1,253 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// LogModules is the subsystem which can be set log level by SetModuleLogLevel
+var LogModules = []string{"discovery", "proxy", "cleanup", "triggers", "admin"}
+
+// logModuleFiles is the module of source file, the discover.go is mapped by logModuleFuncs
+var logModuleFiles = map[string]string{
+	"update.go":     "discovery",
+	"registry.go":   "discovery",
+	"supervisor.go": "discovery",
+	"cron.go":       "discovery",
+	"stats.go":      "discovery",
+	"wireguard.go":  "discovery",
+	"filter.go":     "discovery",
+	"quota.go":      "discovery",
+	"label.go":      "discovery",
+	"lint.go":       "discovery",
+	"collision.go":  "discovery",
+	"identity.go":   "discovery",
+	"subscribe.go":  "discovery",
+	"validate.go":   "discovery",
+	"secret.go":     "discovery",
+	"tenant.go":     "discovery",
+	"catalog.go":    "discovery",
+	"sd.go":         "discovery",
+	"middleware.go": "proxy",
+	"transport.go":  "proxy",
+	"breaker.go":    "proxy",
+	"mirror.go":     "proxy",
+	"route.go":      "proxy",
+	"tunnel.go":     "proxy",
+	"network.go":    "proxy",
+	"listen.go":     "proxy",
+	"waf.go":        "proxy",
+	"cors.go":       "proxy",
+	"geoip.go":      "proxy",
+	"mtls.go":       "proxy",
+	"auth.go":       "proxy",
+	"slowstart.go":  "proxy",
+	"statsd.go":     "proxy",
+	"catchall.go":   "proxy",
+	"buffer.go":     "proxy",
+	"metrics.go":    "proxy",
+	"logship.go":    "proxy",
+	"proxyerror.go": "proxy",
+	"capture.go":    "proxy",
+	"tap.go":        "proxy",
+	"reconcile.go":  "discovery",
+	"upgrade.go":    "admin",
+	"latency.go":    "proxy",
+	"probe.go":      "discovery",
+	"flap.go":       "discovery",
+	"trigger.go":    "triggers",
+	"hook.go":       "triggers",
+	"export.go":     "triggers",
+	"admin.go":      "admin",
+	"control.go":    "admin",
+	"ldap.go":       "admin",
+	"session.go":    "admin",
+	"authlimit.go":  "admin",
+	"preview.go":    "admin",
+	"rbac.go":       "admin",
+	"role.go":       "admin",
+	"token.go":      "admin",
+	"openapi.go":    "admin",
+}
+
+// logModuleFuncs is the module of function in discover.go by name prefix, the other function is proxy,
+// the closure in function is named like callRefresh.func1 so it is matched by prefix too
+var logModuleFuncs = []struct {
+	Prefix string
+	Module string
+}{
+	{"Clear", "cleanup"},
+	{"Prune", "cleanup"},
+	{"callClear", "cleanup"},
+	{"callPrune", "cleanup"},
+	{"callTrigger", "triggers"},
+	{"Discove", "discovery"},
+	{"Refresh", "discovery"},
+	{"callRefresh", "discovery"},
+	{"callCycle", "discovery"},
+	{"runRefresh", "discovery"},
+	{"StartRefresh", "discovery"},
+	{"StopRefresh", "discovery"},
+	{"newDockerClient", "discovery"},
+}
+
+var moduleLevels = map[string]int{}
+var moduleLevelsLock = sync.RWMutex{}
+var moduleCache = map[uintptr]string{}
+
+// ValidLogModule will check if module is in LogModules
+func ValidLogModule(module string) bool {
+	for _, m := range LogModules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLogLevel will parse the log level by number or debug/info/warn/error
+func ParseLogLevel(val string) (level int, err error) {
+	switch strings.ToLower(val) {
+	case "debug":
+		level = LogLevelDebug
+	case "info":
+		level = LogLevelInfo
+	case "warn":
+		level = LogLevelWarn
+	case "error":
+		level = LogLevelError
+	default:
+		level, err = strconv.Atoi(val)
+		if err == nil && level < 0 {
+			err = fmt.Errorf("log level must not be negative")
+		}
+	}
+	return
+}
+
+// ParseModuleLogLevels will parse the module log level by <module>=<level>
+func ParseModuleLogLevels(levels []string) (parsed map[string]int, err error) {
+	parsed = map[string]int{}
+	for _, val := range levels {
+		parts := strings.SplitN(val, "=", 2)
+		if len(parts) != 2 || !ValidLogModule(parts[0]) {
+			err = fmt.Errorf("invalid module log level %v, must be <%v>=<level>", val, strings.Join(LogModules, "|"))
+			return
+		}
+		if parsed[parts[0]], err = ParseLogLevel(parts[1]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// SetModuleLogLevel will set the log level of module, the module level is removed when level is 0
+func SetModuleLogLevel(module string, level int) {
+	moduleLevelsLock.Lock()
+	defer moduleLevelsLock.Unlock()
+	levels := map[string]int{}
+	for m, l := range moduleLevels {
+		levels[m] = l
+	}
+	if level > 0 {
+		levels[module] = level
+	} else {
+		delete(levels, module)
+	}
+	moduleLevels = levels
+}
+
+// LogLevels will return the global log level and the module log levels
+func LogLevels() (level int, modules map[string]int) {
+	level = GetLogLevel()
+	modules = map[string]int{}
+	moduleLevelsLock.RLock()
+	for m, l := range moduleLevels {
+		modules[m] = l
+	}
+	moduleLevelsLock.RUnlock()
+	return
+}
+
+// moduleOf will return the module of function by pc
+func moduleOf(pc uintptr) (module string) {
+	moduleLevelsLock.RLock()
+	module, ok := moduleCache[pc]
+	moduleLevelsLock.RUnlock()
+	if ok {
+		return
+	}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		file, _ := fn.FileLine(pc)
+		name := fn.Name()
+		if i := strings.Index(name, "/pdservice/discover."); i >= 0 {
+			if base := filepath.Base(file); base == "discover.go" {
+				module = "proxy"
+				short := strings.TrimPrefix(name[i+len("/pdservice/discover."):], "(*Discover).")
+				for _, f := range logModuleFuncs {
+					if strings.HasPrefix(short, f.Prefix) {
+						module = f.Module
+						break
+					}
+				}
+			} else {
+				module = logModuleFiles[base]
+			}
+		}
+	}
+	moduleLevelsLock.Lock()
+	moduleCache[pc] = module
+	moduleLevelsLock.Unlock()
+	return
+}
+
+// logEnabled will check if the log is enabled by level of module which the log caller is belong to, the global level is used when
+// module level is not set
+func logEnabled(level int) bool {
+	moduleLevelsLock.RLock()
+	levels := moduleLevels
+	moduleLevelsLock.RUnlock()
+	if len(levels) > 0 {
+		if pc, _, _, ok := runtime.Caller(2); ok {
+			if l, ok := levels[moduleOf(pc)]; ok {
+				return l >= level
+			}
+		}
+	}
+	return GetLogLevel() >= level
+}
+
+// procAdminLogLevel will show the log levels on GET and change the global or module log level on POST by module/level form,
+// the module level is reset to global level when level is 0
+func (d *Discover) procAdminLogLevel(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		module := r.FormValue("module")
+		if len(module) > 0 && !ValidLogModule(module) {
+			writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": fmt.Sprintf("invalid module %v", module)})
+			return
+		}
+		level, err := ParseLogLevel(r.FormValue("level"))
+		if err != nil || len(module) < 1 && level < 1 {
+			writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": fmt.Sprintf("invalid level %v", r.FormValue("level"))})
+			return
+		}
+		if len(module) > 0 {
+			SetModuleLogLevel(module, level)
+		} else {
+			SetLogLevel(level)
+		}
+		InfoLog("Discover audit log level of %v is set to %v from %v", module, level, r.RemoteAddr)
+	} else if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, xmap.M{"code": http.StatusMethodNotAllowed, "message": "method not allowed"})
+		return
+	}
+	level, modules := LogLevels()
+	writeJSON(w, http.StatusOK, xmap.M{"level": level, "modules": modules})
+}
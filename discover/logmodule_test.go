@@ -0,0 +1,140 @@
+package discover
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLogModule(t *testing.T) {
+	defer func() {
+		for _, module := range LogModules {
+			SetModuleLogLevel(module, 0)
+		}
+		SetLogLevel(LogLevelInfo)
+	}()
+	if level, err := ParseLogLevel("debug"); err != nil || level != LogLevelDebug {
+		t.Error(err)
+		return
+	}
+	if level, err := ParseLogLevel("35"); err != nil || level != 35 {
+		t.Error(err)
+		return
+	}
+	if _, err := ParseLogLevel("xx"); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err := ParseLogLevel("-1"); err == nil {
+		t.Error("error")
+		return
+	}
+	levels, err := ParseModuleLogLevels([]string{"proxy=debug", "triggers=10"})
+	if err != nil || levels["proxy"] != LogLevelDebug || levels["triggers"] != LogLevelError {
+		t.Errorf("%v,%v", err, levels)
+		return
+	}
+	for _, invalid := range []string{"xx=debug", "proxy", "proxy=xx"} {
+		if _, err := ParseModuleLogLevels([]string{invalid}); err == nil {
+			t.Error(invalid)
+			return
+		}
+	}
+	//
+	modules := []struct {
+		Func   interface{}
+		Module string
+	}{
+		{(*Discover).callClear, "cleanup"},
+		{(*Discover).Prune, "cleanup"},
+		{(*Discover).callTrigger, "triggers"},
+		{(*Discover).callTriggerBatch, "triggers"},
+		{(*Discover).callRefresh, "discovery"},
+		{(*Discover).procMiddleware, "proxy"},
+		{(*Discover).ServeHTTP, "proxy"},
+		{(*Discover).procAdmin, "admin"},
+		{TestLogModule, ""},
+	}
+	for _, m := range modules {
+		if having := moduleOf(reflect.ValueOf(m.Func).Pointer()); having != m.Module {
+			t.Errorf("%v->%v", m.Module, having)
+			return
+		}
+	}
+	//
+	SetLogLevel(LogLevelError)
+	if logEnabled(LogLevelInfo) || !logEnabled(LogLevelError) {
+		t.Error("error")
+		return
+	}
+	SetModuleLogLevel("proxy", LogLevelDebug)
+	if logEnabled(LogLevelInfo) {
+		t.Error("error")
+		return
+	}
+	level, all := LogLevels()
+	if level != LogLevelError || len(all) != 1 || all["proxy"] != LogLevelDebug {
+		t.Errorf("%v,%v", level, all)
+		return
+	}
+	SetModuleLogLevel("proxy", 0)
+	if _, all = LogLevels(); len(all) != 0 {
+		t.Error(all)
+		return
+	}
+	InfoLog("info")
+	DebugLog("debug")
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	defer func() {
+		for _, module := range LogModules {
+			SetModuleLogLevel(module, 0)
+		}
+		SetLogLevel(LogLevelInfo)
+	}()
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.AdminToken = "123"
+	call := func(method, path string, form url.Values) (res *httptest.ResponseRecorder, result map[string]interface{}) {
+		req := httptest.NewRequest(method, "http://pdsrv"+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Authorization", "Bearer 123")
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		res = httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		result = map[string]interface{}{}
+		json.Unmarshal(res.Body.Bytes(), &result)
+		return
+	}
+	res, result := call("POST", "/_api/loglevel", url.Values{"module": {"triggers"}, "level": {"debug"}})
+	if res.Code != http.StatusOK || result["modules"].(map[string]interface{})["triggers"] != float64(LogLevelDebug) {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	res, result = call("POST", "/_api/loglevel", url.Values{"level": {"warn"}})
+	if res.Code != http.StatusOK || result["level"] != float64(LogLevelWarn) {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	res, result = call("GET", "/_api/loglevel", nil)
+	if res.Code != http.StatusOK || result["level"] != float64(LogLevelWarn) || len(result["modules"].(map[string]interface{})) != 1 {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res, _ = call("POST", "/_api/loglevel", url.Values{"module": {"xx"}, "level": {"debug"}}); res.Code != http.StatusBadRequest {
+		t.Error(res.Code)
+		return
+	}
+	if res, _ = call("POST", "/_api/loglevel", url.Values{"level": {"0"}}); res.Code != http.StatusBadRequest {
+		t.Error(res.Code)
+		return
+	}
+	if res, _ = call("DELETE", "/_api/loglevel", nil); res.Code != http.StatusMethodNotAllowed {
+		t.Error(res.Code)
+		return
+	}
+}
@@ -0,0 +1,232 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogEntry is the structured log which is shipped by LogShipper
+type LogEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// LogShipper will ship the log to Loki or Elasticsearch by batch, the entry is dropped when the queue is full
+// so the logging is never blocked by slow log server
+type LogShipper struct {
+	Kind          string
+	URL           string
+	Token         string
+	Secret        string
+	Labels        map[string]string
+	Index         string
+	Access        bool
+	BatchSize     int
+	FlushInterval time.Duration
+	Retry         int
+	Timeout       time.Duration
+	Dropped       int64
+	queue         chan *LogEntry
+	done          chan int
+	stopped       sync.WaitGroup
+	client        *http.Client
+}
+
+var logShipper *LogShipper
+var logShipperLock = sync.RWMutex{}
+
+// NewLogShipper will create the log shipper by kind which is loki or elasticsearch
+func NewLogShipper(kind, url string, queueSize int) (shipper *LogShipper, err error) {
+	if kind != "loki" && kind != "elasticsearch" {
+		err = fmt.Errorf("log ship %v is not supported, must be loki or elasticsearch", kind)
+		return
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		err = fmt.Errorf("log ship url %v is invalid", url)
+		return
+	}
+	if queueSize < 1 {
+		queueSize = 10000
+	}
+	shipper = &LogShipper{
+		Kind:          kind,
+		URL:           strings.TrimSuffix(url, "/"),
+		Labels:        map[string]string{"job": "pdservice"},
+		Index:         "pdservice",
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		Retry:         3,
+		Timeout:       10 * time.Second,
+		queue:         make(chan *LogEntry, queueSize),
+		done:          make(chan int),
+	}
+	return
+}
+
+// SetLogShipper will set the global log shipper, all log is shipped after set, nil is to disable shipping
+func SetLogShipper(shipper *LogShipper) {
+	logShipperLock.Lock()
+	logShipper = shipper
+	logShipperLock.Unlock()
+}
+
+func shipLog(level, message string, fields map[string]interface{}) {
+	logShipperLock.RLock()
+	shipper := logShipper
+	logShipperLock.RUnlock()
+	if shipper != nil {
+		shipper.Ship(&LogEntry{Time: time.Now(), Level: level, Message: message, Fields: fields})
+	}
+}
+
+// shipAccess will ship the access log when Access is enabled
+func shipAccess(message string, fields map[string]interface{}) {
+	logShipperLock.RLock()
+	shipper := logShipper
+	logShipperLock.RUnlock()
+	if shipper != nil && shipper.Access {
+		shipper.Ship(&LogEntry{Time: time.Now(), Level: "access", Message: message, Fields: fields})
+	}
+}
+
+// Ship will add the entry to queue without blocking, the entry is dropped and counted by Dropped when queue is full
+func (l *LogShipper) Ship(entry *LogEntry) {
+	select {
+	case l.queue <- entry:
+	default:
+		atomic.AddInt64(&l.Dropped, 1)
+	}
+}
+
+// Start will start the shipping loop
+func (l *LogShipper) Start() {
+	l.client = &http.Client{Timeout: l.Timeout}
+	l.stopped.Add(1)
+	go l.runShip()
+}
+
+// Stop will flush the queued entry and stop the shipping loop
+func (l *LogShipper) Stop() {
+	close(l.done)
+	l.stopped.Wait()
+}
+
+func (l *LogShipper) runShip() {
+	defer l.stopped.Done()
+	ticker := time.NewTicker(l.FlushInterval)
+	defer ticker.Stop()
+	batch := []*LogEntry{}
+	for {
+		select {
+		case entry := <-l.queue:
+			batch = append(batch, entry)
+			if len(batch) < l.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-l.done:
+			for len(l.queue) > 0 {
+				batch = append(batch, <-l.queue)
+			}
+			l.flush(batch)
+			return
+		}
+		l.flush(batch)
+		batch = []*LogEntry{}
+	}
+}
+
+func (l *LogShipper) flush(batch []*LogEntry) {
+	if len(batch) < 1 {
+		return
+	}
+	if dropped := atomic.SwapInt64(&l.Dropped, 0); dropped > 0 {
+		batch = append(batch, &LogEntry{Time: time.Now(), Level: "W", Message: fmt.Sprintf("Discover log shipper dropped %v entries", dropped)})
+	}
+	var err error
+	backoff := 100 * time.Millisecond
+	for i := 0; i <= l.Retry; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = l.send(batch); err == nil {
+			return
+		}
+	}
+	//not using WarnLog to avoid ship the failure recursively
+	log.Printf("W Discover ship %v logs to %v fail with %v", len(batch), l.Kind, err)
+}
+
+// encode will encode the batch to loki push api json or elasticsearch bulk api ndjson
+func (l *LogShipper) encode(batch []*LogEntry) (uri, contentType string, body []byte) {
+	switch l.Kind {
+	case "loki":
+		values := [][]string{}
+		for _, entry := range batch {
+			line, _ := json.Marshal(entry)
+			values = append(values, []string{fmt.Sprintf("%v", entry.Time.UnixNano()), string(line)})
+		}
+		body, _ = json.Marshal(map[string]interface{}{
+			"streams": []map[string]interface{}{{"stream": l.Labels, "values": values}},
+		})
+		uri, contentType = l.URL+"/loki/api/v1/push", "application/json"
+	default:
+		buf := bytes.NewBuffer(nil)
+		action, _ := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": l.Index}})
+		for _, entry := range batch {
+			doc, _ := json.Marshal(map[string]interface{}{
+				"@timestamp": entry.Time.Format(time.RFC3339Nano),
+				"level":      entry.Level,
+				"message":    entry.Message,
+				"fields":     entry.Fields,
+			})
+			buf.Write(action)
+			buf.WriteString("\n")
+			buf.Write(doc)
+			buf.WriteString("\n")
+		}
+		uri, contentType, body = l.URL+"/_bulk", "application/x-ndjson", buf.Bytes()
+	}
+	return
+}
+
+func (l *LogShipper) send(batch []*LogEntry) (err error) {
+	uri, contentType, body := l.encode(batch)
+	req, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", contentType)
+	if len(l.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+l.Token)
+	}
+	SignRequest(req, l.Secret, body)
+	res, err := l.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		err = fmt.Errorf("status code %v", res.StatusCode)
+		return
+	}
+	if l.Kind == "elasticsearch" {
+		result := struct {
+			Errors bool `json:"errors"`
+		}{}
+		if json.NewDecoder(res.Body).Decode(&result) == nil && result.Errors {
+			err = fmt.Errorf("bulk response has errors")
+		}
+	}
+	return
+}
@@ -0,0 +1,109 @@
+package discover
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogShipper(t *testing.T) {
+	if _, err := NewLogShipper("xx", "http://127.0.0.1", 0); err == nil {
+		t.Error(err)
+		return
+	}
+	if _, err := NewLogShipper("loki", "127.0.0.1", 0); err == nil {
+		t.Error(err)
+		return
+	}
+	lock := sync.Mutex{}
+	bodies := map[string][]string{}
+	fail := 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if fail > 0 {
+			fail--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		bodies[r.URL.Path] = append(bodies[r.URL.Path], string(data))
+		if r.URL.Path == "/_bulk" {
+			w.Write([]byte(`{"errors":false}`))
+		}
+	}))
+	defer ts.Close()
+	//loki
+	loki, _ := NewLogShipper("loki", ts.URL+"/", 0)
+	loki.Labels["env"] = "test"
+	loki.Token = "abc"
+	loki.Start()
+	SetLogShipper(loki)
+	SetLogLevel(LogLevelInfo)
+	InfoLog("test %v", "info")
+	DebugLog("test debug")
+	shipAccess("GET /", map[string]interface{}{"status": 200})
+	SetLogShipper(nil)
+	loki.Stop()
+	lock.Lock()
+	pushed := bodies["/loki/api/v1/push"]
+	lock.Unlock()
+	if len(pushed) != 1 {
+		t.Error(bodies)
+		return
+	}
+	push := struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][]string        `json:"values"`
+		} `json:"streams"`
+	}{}
+	if err := json.Unmarshal([]byte(pushed[0]), &push); err != nil || len(push.Streams) != 1 || push.Streams[0].Stream["env"] != "test" {
+		t.Error(err, pushed[0])
+		return
+	}
+	found := false
+	for _, value := range push.Streams[0].Values {
+		entry := &LogEntry{}
+		json.Unmarshal([]byte(value[1]), entry)
+		if entry.Level == "access" {
+			t.Error("access is not enabled")
+			return
+		}
+		if entry.Level == "info" && entry.Message == "test info" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error(pushed[0])
+		return
+	}
+	//elasticsearch
+	es, _ := NewLogShipper("elasticsearch", ts.URL, 1)
+	es.Access = true
+	es.Index = "logs"
+	es.Ship(&LogEntry{Time: time.Now(), Level: "info", Message: "m1"})
+	es.Ship(&LogEntry{Time: time.Now(), Level: "info", Message: "m2"})
+	if es.Dropped != 1 {
+		t.Error(es.Dropped)
+		return
+	}
+	es.Start()
+	time.Sleep(100 * time.Millisecond)
+	SetLogShipper(es)
+	shipAccess("GET /", map[string]interface{}{"status": 200})
+	SetLogShipper(nil)
+	es.Stop()
+	lock.Lock()
+	bulk := strings.Join(bodies["/_bulk"], "")
+	lock.Unlock()
+	if !strings.Contains(bulk, `{"index":{"_index":"logs"}}`) || !strings.Contains(bulk, `"message":"m1"`) || !strings.Contains(bulk, "dropped 1 entries") || !strings.Contains(bulk, `"level":"access"`) {
+		t.Error(bulk)
+		return
+	}
+}
@@ -0,0 +1,49 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// parseMethods will parse the PD_METHODS label to upper case http methods
+func parseMethods(val string) (methods []string, err error) {
+	for _, method := range splitList(val) {
+		method = strings.ToUpper(method)
+		for _, c := range method {
+			if c < 'A' || c > 'Z' {
+				err = fmt.Errorf("method %v is invalid", method)
+				return
+			}
+		}
+		methods = append(methods, method)
+	}
+	return
+}
+
+// allowMethod will return if the request method is allowed by forward, the HEAD is allowed when GET is allowed,
+// and the cors preflight is allowed when cors is configured
+func (f *Forward) allowMethod(r *http.Request) bool {
+	if len(f.Methods) < 1 {
+		return true
+	}
+	if f.CORS != nil && r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+		return true
+	}
+	for _, method := range f.Methods {
+		if method == r.Method || (method == http.MethodGet && r.Method == http.MethodHead) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Discover) middlewareMethod(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	if !reverse.Forward.allowMethod(r) {
+		w.Header().Set("Allow", strings.Join(reverse.Forward.Methods, ", "))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, "%v", http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+	next(w, r, reverse)
+}
@@ -0,0 +1,63 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMethod(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	container := &Container{ID: "c1", Name: "ds", Version: "1.0.0", Forwards: map[string]*Forward{
+		"v100.ds": {Name: "API", Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://")},
+	}}
+	applyForwardOptions(container, map[string]string{"PD_METHODS_API": "get, post"})
+	forward := container.Forwards["v100.ds"]
+	if len(container.Problems) > 0 || len(forward.Methods) != 2 || forward.Methods[0] != "GET" {
+		t.Errorf("%v,%v", container.Problems, forward.Methods)
+		return
+	}
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.applyProxy(map[string]*Container{"v100.ds": container})
+	call := func(method string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://v100.ds.test.loc/", nil)
+		for key, val := range header {
+			req.Header.Set(key, val)
+		}
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return res
+	}
+	for _, method := range []string{"GET", "HEAD", "POST"} {
+		if res := call(method, nil); res.Code != http.StatusOK {
+			t.Errorf("%v,%v", method, res.Code)
+			return
+		}
+	}
+	if res := call("DELETE", nil); res.Code != http.StatusMethodNotAllowed || res.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("%v,%v", res.Code, res.Header())
+		return
+	}
+	preflight := map[string]string{"Origin": "https://a.loc", "Access-Control-Request-Method": "POST"}
+	if res := call("OPTIONS", preflight); res.Code != http.StatusMethodNotAllowed {
+		t.Error(res.Code)
+		return
+	}
+	forward.CORS = &CORS{Origins: []string{"*"}}
+	if res := call("OPTIONS", preflight); res.Code != http.StatusNoContent {
+		t.Error(res.Code)
+		return
+	}
+	//invalid
+	container.Problems = nil
+	applyForwardOptions(container, map[string]string{"PD_METHODS": "GET,P-OST"})
+	if len(container.Problems) != 1 {
+		t.Error(container.Problems)
+		return
+	}
+}
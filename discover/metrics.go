@@ -0,0 +1,113 @@
+package discover
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// TriggerStats is the statistics of trigger executions
+type TriggerStats struct {
+	Success      int64         `json:"success"`
+	Failure      int64         `json:"failure"`
+	Duration     time.Duration `json:"duration"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastAt       time.Time     `json:"last_at"`
+	LastError    string        `json:"last_error"`
+	LastOutput   string        `json:"last_output"`
+}
+
+const triggerOutputMax = 4096
+
+func (d *Discover) recordTrigger(name string, used time.Duration, out []byte, err error) {
+	d.triggerLock.Lock()
+	defer d.triggerLock.Unlock()
+	if d.triggerStats == nil {
+		d.triggerStats = map[string]*TriggerStats{}
+	}
+	stats := d.triggerStats[name]
+	if stats == nil {
+		stats = &TriggerStats{}
+		d.triggerStats[name] = stats
+	}
+	if err == nil {
+		stats.Success++
+		stats.LastError = ""
+		d.StatsD.Count("trigger", 1, "trigger:"+name, "result:success")
+	} else {
+		stats.Failure++
+		stats.LastError = err.Error()
+		d.StatsD.Count("trigger", 1, "trigger:"+name, "result:failure")
+	}
+	d.StatsD.Timing("trigger.duration", used, "trigger:"+name)
+	stats.Duration += used
+	stats.LastDuration = used
+	stats.LastAt = time.Now()
+	if len(out) > triggerOutputMax {
+		out = out[len(out)-triggerOutputMax:]
+	}
+	stats.LastOutput = string(out)
+}
+
+// TriggerStats will return the copy of trigger statistics by trigger name
+func (d *Discover) TriggerStats() (all map[string]TriggerStats) {
+	d.triggerLock.Lock()
+	defer d.triggerLock.Unlock()
+	all = map[string]TriggerStats{}
+	for name, stats := range d.triggerStats {
+		all[name] = *stats
+	}
+	return
+}
+
+// WriteMetrics will write the metrics by prometheus text format
+func (d *Discover) WriteMetrics(w io.Writer) {
+	all := d.TriggerStats()
+	names := []string{}
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "# HELP pdservice_trigger_runs_total The total number of trigger executions.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_trigger_runs_total counter\n")
+	for _, name := range names {
+		fmt.Fprintf(w, "pdservice_trigger_runs_total{trigger=%q,result=\"success\"} %v\n", name, all[name].Success)
+		fmt.Fprintf(w, "pdservice_trigger_runs_total{trigger=%q,result=\"failure\"} %v\n", name, all[name].Failure)
+	}
+	fmt.Fprintf(w, "# HELP pdservice_trigger_duration_seconds The duration of trigger executions.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_trigger_duration_seconds summary\n")
+	for _, name := range names {
+		fmt.Fprintf(w, "pdservice_trigger_duration_seconds_sum{trigger=%q} %v\n", name, all[name].Duration.Seconds())
+		fmt.Fprintf(w, "pdservice_trigger_duration_seconds_count{trigger=%q} %v\n", name, all[name].Success+all[name].Failure)
+	}
+	fmt.Fprintf(w, "# HELP pdservice_trigger_last_failure Whether the last trigger execution is failed.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_trigger_last_failure gauge\n")
+	for _, name := range names {
+		failed := 0
+		if len(all[name].LastError) > 0 {
+			failed = 1
+		}
+		fmt.Fprintf(w, "pdservice_trigger_last_failure{trigger=%q} %v\n", name, failed)
+	}
+	fmt.Fprintf(w, "# HELP pdservice_trigger_last_timestamp_seconds The time of last trigger execution.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_trigger_last_timestamp_seconds gauge\n")
+	for _, name := range names {
+		fmt.Fprintf(w, "pdservice_trigger_last_timestamp_seconds{trigger=%q} %v\n", name, all[name].LastAt.Unix())
+	}
+	d.writeRefreshMetrics(w)
+	d.writeDockerLimitMetrics(w)
+	d.writeResourceMetrics(w)
+	d.writeFlapMetrics(w)
+	d.writeProbeMetrics(w)
+	d.writeConflictMetrics(w)
+	d.writeCollisionMetrics(w)
+	d.writeWebSocketMetrics(w)
+	d.writeComposeMetrics(w)
+}
+
+func (d *Discover) procMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	d.WriteMetrics(w)
+}
@@ -0,0 +1,35 @@
+package discover
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTriggerMetrics(t *testing.T) {
+	discover := NewDiscover()
+	discover.recordTrigger("added", time.Second, []byte("ok"), nil)
+	discover.recordTrigger("added", time.Second, bytes.Repeat([]byte("x"), triggerOutputMax+10), fmt.Errorf("exit status 1"))
+	discover.recordTrigger("removed", time.Second, nil, nil)
+	stats := discover.TriggerStats()
+	if stats["added"].Success != 1 || stats["added"].Failure != 1 || stats["added"].LastError != "exit status 1" || len(stats["added"].LastOutput) != triggerOutputMax {
+		t.Error(stats)
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	discover.WriteMetrics(buf)
+	metrics := buf.String()
+	for _, line := range []string{
+		`pdservice_trigger_runs_total{trigger="added",result="failure"} 1`,
+		`pdservice_trigger_duration_seconds_sum{trigger="added"} 2`,
+		`pdservice_trigger_last_failure{trigger="added"} 1`,
+		`pdservice_trigger_last_failure{trigger="removed"} 0`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("%v not in %v", line, metrics)
+			return
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package discover
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Handler is the handler of request which is matched to forward
+type Handler func(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy)
+
+// Middleware will process the request which is matched to forward, it should call next once to continue the chain
+// or write the response to stop the chain
+type Middleware func(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler)
+
+// DefaultMiddlewares is the default ordered middleware chain of matched request
+var DefaultMiddlewares = []string{"version", "method", "client_cert", "auth", "geo", "waf", "quota", "cors", "body_limit", "rewrite", "mirror", "capture", "breaker"}
+
+// MandatoryMiddlewares is the access control middlewares which must be in Middlewares, so the forward restriction
+// by label can't be disabled by config
+var MandatoryMiddlewares = []string{"method", "client_cert", "auth", "geo", "waf", "quota"}
+
+// RegisterMiddleware will register the middleware by name, the registered middleware can be used by Middlewares and PD_MIDDLEWARE label,
+// the builtin middleware is replaced when name is same
+func (d *Discover) RegisterMiddleware(name string, middleware Middleware) {
+	d.middlewareLock.Lock()
+	d.middlewareAll[name] = middleware
+	d.middlewareLock.Unlock()
+}
+
+// CheckMiddlewares will check the Middlewares is registered and contains all MandatoryMiddlewares
+func (d *Discover) CheckMiddlewares() (err error) {
+	d.middlewareLock.RLock()
+	defer d.middlewareLock.RUnlock()
+	for _, name := range d.Middlewares {
+		if d.middlewareAll[name] == nil {
+			err = fmt.Errorf("middlewares %v is not found", name)
+			return
+		}
+	}
+	for _, name := range MandatoryMiddlewares {
+		found := false
+		for _, having := range d.Middlewares {
+			found = found || having == name
+		}
+		if !found {
+			err = fmt.Errorf("middlewares must contain %v", name)
+			return
+		}
+	}
+	return
+}
+
+// checkForwardMiddlewares will remove the not registered middleware of PD_MIDDLEWARE, the removed middleware
+// is recorded as label problem
+func (d *Discover) checkForwardMiddlewares(container *Container) {
+	d.middlewareLock.RLock()
+	defer d.middlewareLock.RUnlock()
+	for _, forward := range container.Forwards {
+		middlewares := []string{}
+		for _, name := range forward.Middlewares {
+			if d.middlewareAll[name] == nil {
+				container.addProblem("PD_MIDDLEWARE_"+forward.Name, name, "middleware is not found")
+				continue
+			}
+			middlewares = append(middlewares, name)
+		}
+		forward.Middlewares = middlewares
+	}
+}
+
+func (d *Discover) findMiddleware(name string) (middleware Middleware) {
+	d.middlewareLock.RLock()
+	middleware = d.middlewareAll[name]
+	d.middlewareLock.RUnlock()
+	if middleware == nil {
+		WarnLog("Discover middleware %v is not found", name)
+	}
+	return
+}
+
+// procMiddleware will process the request by Middlewares and PD_MIDDLEWARE of forward, and proxy to forward at last
+func (d *Discover) procMiddleware(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy) {
+	names := d.middlewareNames(reverse)
+	if d.StatsD == nil && !d.Latency && !d.tapping() {
+		d.callMiddleware(names, 0, w, r, reverse)
+		return
+	}
+	begin := time.Now()
+	writer := &statusWriter{ResponseWriter: w}
+	d.callMiddleware(names, 0, writer, r, reverse)
+	used := time.Since(begin)
+	d.publishTap(r, reverse, begin, used, writer.Status)
+	if d.Latency {
+		d.recordLatency(reverse, used, writer.Status)
+	}
+	if d.StatsD != nil {
+		tags := []string{"service:" + reverse.Service.Name, "forward:" + reverse.Forward.Name, "status:" + statusClass(writer.Status)}
+		d.StatsD.Count("request", 1, tags...)
+		d.StatsD.Timing("request.duration", used, tags...)
+	}
+}
+
+// middlewareNames will return the ordered middleware names of Middlewares and PD_MIDDLEWARE of forward
+func (d *Discover) middlewareNames(reverse *ReverseProxy) (names []string) {
+	names = append([]string{}, d.Middlewares...)
+	names = append(names, reverse.Forward.Middlewares...)
+	return
+}
+
+func (d *Discover) callMiddleware(names []string, i int, w http.ResponseWriter, r *http.Request, reverse *ReverseProxy) {
+	for ; i < len(names); i++ {
+		middleware := d.findMiddleware(names[i])
+		if middleware == nil {
+			continue
+		}
+		next, current := i+1, reverse
+		middleware(w, r, reverse, func(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy) {
+			nextNames := names
+			if reverse.Forward != current.Forward {
+				//the reverse is routed to other forward like version, so the chain is continued by PD_MIDDLEWARE of target forward
+				nextNames = d.middlewareNames(reverse)
+			}
+			d.callMiddleware(nextNames, next, w, r, reverse)
+		})
+		return
+	}
+	if reverse.Forward.Shortcut != nil {
+		reverse.Forward.Shortcut.ServeHTTP(w, r)
+		return
+	}
+	if reverse.Forward.Static != nil {
+		reverse.Forward.Static.ServeHTTP(w, r)
+		return
+	}
+	d.serveProxy(w, r, reverse)
+}
+
+func (d *Discover) registerBuiltinMiddlewares() {
+	d.middlewareAll = map[string]Middleware{
+		"version":     d.middlewareVersion,
+		"method":      d.middlewareMethod,
+		"client_cert": d.middlewareClientCert,
+		"auth":        d.middlewareAuth,
+		"geo":         d.middlewareGeo,
+		"waf":         d.middlewareWAF,
+		"quota":       d.middlewareQuota,
+		"cors":        d.middlewareCORS,
+		"body_limit":  d.middlewareBodyLimit,
+		"rewrite":     d.middlewareRewrite,
+		"mirror":      d.middlewareMirror,
+		"capture":     d.middlewareCapture,
+		"log":         d.middlewareLog,
+		"breaker":     d.middlewareBreaker,
+	}
+}
+
+func (d *Discover) middlewareVersion(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	next(w, r, d.routeVersion(reverse, r))
+}
+
+func (d *Discover) middlewareClientCert(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	if !d.verifyClientCert(r) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "client certificate required")
+		return
+	}
+	next(w, r, reverse)
+}
+
+func (d *Discover) middlewareGeo(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	if !d.allowGeo(reverse.Forward, r) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "forbidden")
+		return
+	}
+	next(w, r, reverse)
+}
+
+func (d *Discover) middlewareWAF(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	if d.WAF != nil {
+		if code := d.WAF.Check(reverse.Forward, r, d.clientIP(r).String()); code > 0 {
+			w.WriteHeader(code)
+			fmt.Fprintf(w, "%v", http.StatusText(code))
+			return
+		}
+	}
+	next(w, r, reverse)
+}
+
+func (d *Discover) middlewareQuota(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	if !d.allowQuota(reverse.Service) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "%v", http.StatusText(http.StatusTooManyRequests))
+		return
+	}
+	next(w, r, reverse)
+}
+
+func (d *Discover) middlewareCORS(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	if reverse.Forward.CORS != nil && reverse.Forward.CORS.Handle(w, r) {
+		return
+	}
+	next(w, r, reverse)
+}
+
+func (d *Discover) middlewareBodyLimit(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	if d.MaxBodySize > 0 {
+		if r.ContentLength > d.MaxBodySize {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			fmt.Fprintf(w, "request body too large")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, d.MaxBodySize)
+	}
+	next(w, r, reverse)
+}
+
+func (d *Discover) middlewareMirror(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	d.procMirror(reverse, r)
+	next(w, r, reverse)
+}
+
+// statusWriter will record the status code and written bytes of response
+type statusWriter struct {
+	http.ResponseWriter
+	Status  int
+	Written int64
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	if s.Status == 0 {
+		s.Status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusWriter) Write(p []byte) (n int, err error) {
+	if s.Status == 0 {
+		s.Status = http.StatusOK
+	}
+	n, err = s.ResponseWriter.Write(p)
+	s.Written += int64(n)
+	return
+}
+
+func (s *statusWriter) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusWriter) SetWriteDeadline(deadline time.Time) error {
+	if setter, ok := s.ResponseWriter.(deadlineWriter); ok {
+		return setter.SetWriteDeadline(deadline)
+	}
+	return fmt.Errorf("set write deadline is not supported")
+}
+
+func (s *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack is not supported")
+	}
+	return hijacker.Hijack()
+}
+
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (d *Discover) middlewareLog(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	begin := time.Now()
+	writer := &statusWriter{ResponseWriter: w}
+	next(writer, r, reverse)
+	used := time.Since(begin)
+	InfoLog("Discover access %v %v%v to %v from %v is done with %v/%v bytes in %v", r.Method, r.Host, r.URL.Path, reverse.Forward.Prefix, r.RemoteAddr, writer.Status, writer.Written, used)
+	shipAccess(fmt.Sprintf("%v %v%v %v", r.Method, r.Host, r.URL.Path, writer.Status), map[string]interface{}{
+		"method":   r.Method,
+		"host":     r.Host,
+		"path":     r.URL.Path,
+		"forward":  reverse.Forward.Prefix,
+		"service":  reverse.Service.Name,
+		"remote":   r.RemoteAddr,
+		"status":   writer.Status,
+		"bytes":    writer.Written,
+		"duration": used.Seconds(),
+	})
+}
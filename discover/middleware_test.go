@@ -0,0 +1,135 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "1")
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Write([]byte(r.Header.Get("X-Chain")))
+	}))
+	defer backend.Close()
+	forward := &Forward{Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://")}
+	proxy, err := discover.newReverseProxy(forward)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	discover.proxyReverse["v100.ds.test.loc"] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: &Container{Name: "ds"}}
+	call := func() *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil))
+		return res
+	}
+	discover.RegisterMiddleware("a", func(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+		r.Header.Add("X-Chain", "a")
+		next(w, r, reverse)
+	})
+	discover.RegisterMiddleware("b", func(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+		r.Header.Add("X-Chain", "b")
+		next(w, r, reverse)
+	})
+	discover.RegisterMiddleware("deny", func(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	discover.Middlewares = append(discover.Middlewares, "a", "none", "log")
+	forward.Middlewares = []string{"b"}
+	if res := call(); res.Code != http.StatusOK || res.Body.String() != "a" || res.Header().Get("X-Backend") != "1" {
+		t.Error(res.Code, res.Body.String())
+		return
+	}
+	discover.Middlewares = []string{"b", "a"}
+	forward.Middlewares = nil
+	if res := call(); res.Body.String() != "b" {
+		t.Error(res.Body.String())
+		return
+	}
+	forward.Middlewares = []string{"deny"}
+	if res := call(); res.Code != http.StatusForbidden || res.Header().Get("X-Backend") == "1" {
+		t.Error(res.Code)
+		return
+	}
+	discover.Middlewares = []string{"none"}
+	found := false
+	for _, err := range discover.Validate() {
+		found = found || strings.Contains(err.Error(), "middlewares none")
+	}
+	if !found {
+		t.Error("not found")
+		return
+	}
+	discover.Middlewares = DefaultMiddlewares
+	if err := discover.CheckMiddlewares(); err != nil {
+		t.Error(err)
+		return
+	}
+	discover.Middlewares = []string{"version", "cors"}
+	if err := discover.CheckMiddlewares(); err == nil || !strings.Contains(err.Error(), "must contain") {
+		t.Error(err)
+		return
+	}
+	//rewrite
+	discover.Middlewares = []string{"rewrite"}
+	forward.Middlewares = nil
+	forward.Rewrite = "^/api/(.*) /$1"
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://v100.ds.test.loc/api/users", nil))
+	if res.Header().Get("X-Path") != "/users" {
+		t.Error(res.Header().Get("X-Path"))
+		return
+	}
+	for _, val := range []string{"^/api", "^/api users", "( /users"} {
+		if _, err := ParseRewriteRules(val); err == nil {
+			t.Error(val)
+			return
+		}
+	}
+	//label
+	container := &Container{Forwards: map[string]*Forward{"v100.ds": {Name: "WEB", Prefix: "v100.ds"}}}
+	applyForwardOptions(container, map[string]string{"PD_MIDDLEWARE_WEB": "log,a,none", "PD_REWRITE_WEB": "^/v1/ /"})
+	discover.checkForwardMiddlewares(container)
+	if middlewares := container.Forwards["v100.ds"].Middlewares; len(middlewares) != 2 || middlewares[1] != "a" || len(container.Problems) != 1 {
+		t.Error(middlewares, container.Problems)
+		return
+	}
+	if rewrite := container.Forwards["v100.ds"].Rewrite; rewrite != "^/v1/ /" {
+		t.Error(rewrite)
+		return
+	}
+	//version
+	forward2 := &Forward{Prefix: "v200.ds", Type: "http", URI: forward.URI, Middlewares: []string{"a"}}
+	proxy2, _ := discover.newReverseProxy(forward2)
+	discover.proxyReverse["v200.ds.test.loc"] = &ReverseProxy{Forward: forward2, Reverse: proxy2, Service: &Container{Name: "ds"}}
+	discover.VersionHeader = "X-Version"
+	discover.Middlewares = []string{"version"}
+	forward.Middlewares = []string{"deny"}
+	forward.Rewrite = ""
+	req := httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil)
+	req.Header.Set("X-Version", "v2.0.0")
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || res.Body.String() != "a" {
+		t.Error(res.Code, res.Body.String())
+		return
+	}
+	if res := call(); res.Code != http.StatusForbidden {
+		t.Error(res.Code)
+		return
+	}
+	//status writer
+	res = httptest.NewRecorder()
+	writer := &statusWriter{ResponseWriter: res}
+	writer.Write([]byte("abc"))
+	writer.Flush()
+	if writer.Status != http.StatusOK || writer.Written != 3 || writer.Unwrap() != res {
+		t.Error(writer.Status, writer.Written)
+		return
+	}
+}
@@ -0,0 +1,120 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+type discardResponse struct {
+	header http.Header
+}
+
+func (d *discardResponse) Header() http.Header {
+	return d.header
+}
+
+func (d *discardResponse) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (d *discardResponse) WriteHeader(statusCode int) {
+}
+
+// readCloser will read the buffered data before the rest of body, and close the body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// errorReader will return the read error of body again, the underlying reader may not return it twice
+type errorReader struct {
+	err error
+}
+
+func (e *errorReader) Read(p []byte) (int, error) {
+	return 0, e.err
+}
+
+// VersionPrefix will return the prefix of same forward on other version
+func (f *Forward) VersionPrefix(version string) string {
+	key := strings.TrimPrefix(f.Key, "*")
+	rest := f.Prefix
+	if len(key) > 0 {
+		rest = strings.TrimPrefix(rest, key+".")
+	}
+	parts := strings.SplitN(rest, ".", 2)
+	if len(parts) < 2 {
+		return f.Prefix
+	}
+	prefix := strings.ReplaceAll(strings.TrimPrefix(version, "v"), ".", "")
+	if len(prefix) > 0 {
+		prefix = "v" + prefix + "." + parts[1]
+	} else {
+		prefix = parts[1]
+	}
+	if len(key) > 0 {
+		prefix = key + "." + prefix
+	}
+	return prefix
+}
+
+func (d *Discover) procMirror(reverse *ReverseProxy, r *http.Request) {
+	forward := reverse.Forward
+	if len(forward.MirrorVersion) < 1 || rand.Intn(100) >= forward.MirrorPercent {
+		return
+	}
+	mirror := d.findReverse(d.hostOf(forward.Tenant, forward.VersionPrefix(forward.MirrorVersion)))
+	if mirror == nil || mirror == reverse {
+		return
+	}
+	//the mirror is skipped when MirrorMaxConns mirrors are running, so slow mirror target can't pile up requests
+	if atomic.AddInt32(&d.mirrorRunning, 1) > int32(d.MirrorMaxConns) {
+		atomic.AddInt32(&d.mirrorRunning, -1)
+		DebugLog("Discover mirror %v%v is skipped by max %v running", r.Host, r.URL.Path, d.MirrorMaxConns)
+		return
+	}
+	started := false
+	defer func() {
+		if !started {
+			atomic.AddInt32(&d.mirrorRunning, -1)
+		}
+	}()
+	var body []byte
+	if r.Body != nil && r.ContentLength != 0 {
+		if r.ContentLength < 0 || r.ContentLength > d.MirrorMaxBody {
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil { //skip mirror and keep the read error on original body
+			r.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(data), &errorReader{err: err}), Closer: r.Body}
+			return
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(data))
+		body = data
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.MirrorTimeout)
+	req := r.Clone(ctx)
+	req.Host = d.hostOf(mirror.Forward.Tenant, mirror.Forward.Prefix)
+	if body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	started = true
+	go func() {
+		defer func() {
+			cancel()
+			atomic.AddInt32(&d.mirrorRunning, -1)
+			if xerr := recover(); xerr != nil {
+				WarnLog("Discover mirror %v to %v panic with %v", r.Host, req.Host, xerr)
+			}
+		}()
+		mirror.Reverse.ServeHTTP(&discardResponse{header: http.Header{}}, req)
+		DebugLog("Discover mirror %v%v to %v is done", r.Host, r.URL.Path, req.Host)
+	}()
+}
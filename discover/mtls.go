@@ -0,0 +1,118 @@
+package discover
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ClientAuth is the rule to require client certificate on host matched by pattern
+type ClientAuth struct {
+	Pattern string
+	CAFile  string
+	match   *regexp.Regexp
+	pool    *x509.CertPool
+}
+
+// ParseClientAuth will parse the client auth rule by <host pattern>=<ca file>, the host pattern is same as PD_MATCH
+func ParseClientAuth(rule string) (auth *ClientAuth, err error) {
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 || len(parts[0]) < 1 || len(parts[1]) < 1 {
+		err = fmt.Errorf("invalid client auth %v", rule)
+		return
+	}
+	auth = &ClientAuth{Pattern: parts[0], CAFile: parts[1]}
+	auth.match, err = compileHostPattern(auth.Pattern)
+	if err != nil {
+		return
+	}
+	data, err := ioutil.ReadFile(auth.CAFile)
+	if err != nil {
+		return
+	}
+	auth.pool = x509.NewCertPool()
+	if !auth.pool.AppendCertsFromPEM(data) {
+		err = fmt.Errorf("no certificate found in %v", auth.CAFile)
+	}
+	return
+}
+
+func (d *Discover) findClientAuth(host string) *ClientAuth {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, auth := range d.ClientAuth {
+		if auth.match.MatchString(host) {
+			return auth
+		}
+	}
+	return nil
+}
+
+// ServerTLSConfig will create the tls config for listener, the client certificate is required on host matched by ClientAuth
+func (d *Discover) ServerTLSConfig(certFile, keyFile string) (config *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return
+	}
+	config = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	base := config.Clone()
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		auth := d.findClientAuth(hello.ServerName)
+		if auth == nil {
+			return nil, nil
+		}
+		hostConfig := base.Clone()
+		hostConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		hostConfig.ClientCAs = auth.pool
+		return hostConfig, nil
+	}
+	return
+}
+
+// verifyClientCert will verify the client certificate by host rule, it must be checked on request because the host may be different from tls server name.
+// the client identity is passed to upstream by ClientCertHeader
+func (d *Discover) verifyClientCert(r *http.Request) bool {
+	if len(d.ClientCertHeader) > 0 {
+		r.Header.Del(d.ClientCertHeader)
+		r.Header.Del(d.ClientCertHeader + "-Hash")
+	}
+	auth := d.findClientAuth(r.Host)
+	if auth == nil {
+		return true
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) < 1 {
+		return false
+	}
+	cert := r.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         auth.pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		WarnLog("Discover verify client cert %v on %v fail with %v", cert.Subject, r.Host, err)
+		return false
+	}
+	if len(d.ClientCertHeader) > 0 {
+		hash := sha256.Sum256(cert.Raw)
+		r.Header.Set(d.ClientCertHeader, cert.Subject.String())
+		r.Header.Set(d.ClientCertHeader+"-Hash", hex.EncodeToString(hash[:]))
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package discover
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCert(name string, isCA bool, usage x509.ExtKeyUsage, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (cert *x509.Certificate, key *ecdsa.PrivateKey, certPEM, keyPEM []byte) {
+	key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{usage},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		DNSNames:              []string{name},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	cert, _ = x509.ParseCertificate(der)
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return
+}
+
+func TestClientAuth(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "mtls")
+	defer os.RemoveAll(dir)
+	ca, caKey, caPEM, _ := newTestCert("ca", true, x509.ExtKeyUsageAny, nil, nil)
+	client, _, _, _ := newTestCert("client", false, x509.ExtKeyUsageClientAuth, ca, caKey)
+	other, _, _, _ := newTestCert("other", true, x509.ExtKeyUsageClientAuth, nil, nil)
+	_, _, serverPEM, serverKeyPEM := newTestCert("pdsrv", false, x509.ExtKeyUsageServerAuth, ca, caKey)
+	ioutil.WriteFile(filepath.Join(dir, "ca.pem"), caPEM, os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "server.pem"), serverPEM, os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "server.key"), serverKeyPEM, os.ModePerm)
+	auth, err := ParseClientAuth("api.*.loc=" + filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, rule := range []string{"xx", "re:(=" + filepath.Join(dir, "ca.pem"), "a=/none", "a=" + filepath.Join(dir, "server.key")} {
+		if _, err = ParseClientAuth(rule); err == nil {
+			t.Error(rule)
+			return
+		}
+	}
+	discover := NewDiscover()
+	discover.ClientAuth = []*ClientAuth{auth}
+	//tls config
+	config, err := discover.ServerTLSConfig(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if hostConfig, _ := config.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "api.ds.loc"}); hostConfig == nil || hostConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Error(hostConfig)
+		return
+	}
+	if hostConfig, _ := config.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "www.ds.loc"}); hostConfig != nil {
+		t.Error(hostConfig)
+		return
+	}
+	//verify
+	req := httptest.NewRequest("GET", "https://www.ds.loc/", nil)
+	req.Header.Set("X-PD-Client-Cert", "fake")
+	if !discover.verifyClientCert(req) || len(req.Header.Get("X-PD-Client-Cert")) > 0 {
+		t.Error("error")
+		return
+	}
+	req = httptest.NewRequest("GET", "https://api.ds.loc:443/", nil)
+	req.TLS = nil
+	if discover.verifyClientCert(req) {
+		t.Error("error")
+		return
+	}
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{other}}
+	if discover.verifyClientCert(req) {
+		t.Error("error")
+		return
+	}
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}}
+	if !discover.verifyClientCert(req) || req.Header.Get("X-PD-Client-Cert") != "CN=client" || len(req.Header.Get("X-PD-Client-Cert-Hash")) != 64 {
+		t.Error(req.Header)
+		return
+	}
+}
@@ -0,0 +1,78 @@
+package discover
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// joinHost will join the docker host and published port, the ipv6 host is wrapped by brackets
+func joinHost(host, port string) string {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return net.JoinHostPort(host, port)
+}
+
+func isIPv6(ip string) bool {
+	return strings.Contains(ip, ":")
+}
+
+// selectBinding will select the published port binding by IPPrefer, the first binding is selected when preferred family is not found
+func (d *Discover) selectBinding(bindings []nat.PortBinding) (binding nat.PortBinding, ok bool) {
+	if len(bindings) < 1 {
+		return
+	}
+	binding, ok = bindings[0], true
+	if len(d.IPPrefer) < 1 {
+		return
+	}
+	for _, b := range bindings {
+		if isIPv6(b.HostIP) == (d.IPPrefer == "ipv6") {
+			binding = b
+			break
+		}
+	}
+	return
+}
+
+// preferNetwork will return the tcp4/tcp6/udp4/udp6 network by IPPrefer
+func (d *Discover) preferNetwork(network string) string {
+	if network != "tcp" && network != "udp" {
+		return network
+	}
+	switch d.IPPrefer {
+	case "ipv4":
+		return network + "4"
+	case "ipv6":
+		return network + "6"
+	default:
+		return network
+	}
+}
+
+// tuneDial will make transport dial by IPPrefer network or ssh tunnel, and resolve the dns name of upstream by DNSResolve
+func (d *Discover) tuneDial(transport *http.Transport) {
+	if len(d.IPPrefer) > 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, d.preferNetwork(network), addr)
+		}
+	}
+	d.tuneTunnel(transport)
+	if d.DNSResolve && len(d.SSHTunnel) < 1 {
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+		}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			resolved, err := d.resolveAddress(ctx, addr)
+			if err != nil {
+				return nil, err
+			}
+			return dial(ctx, network, resolved)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package discover
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+)
+
+func TestNetwork(t *testing.T) {
+	for host, uri := range map[string]string{
+		"127.0.0.1": "127.0.0.1:80",
+		"::1":       "[::1]:80",
+		"[fd00::2]": "[fd00::2]:80",
+		"docker1":   "docker1:80",
+	} {
+		if v := joinHost(host, "80"); v != uri {
+			t.Errorf("%v->%v", host, v)
+			return
+		}
+	}
+	discover := NewDiscover()
+	bindings := []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: "8080"}, {HostIP: "::", HostPort: "8081"}}
+	if _, ok := discover.selectBinding(nil); ok {
+		t.Error("error")
+		return
+	}
+	if binding, _ := discover.selectBinding(bindings); binding.HostPort != "8080" {
+		t.Error(binding)
+		return
+	}
+	if network := discover.preferNetwork("tcp"); network != "tcp" {
+		t.Error(network)
+		return
+	}
+	discover.IPPrefer = "ipv6"
+	if binding, _ := discover.selectBinding(bindings); binding.HostPort != "8081" {
+		t.Error(binding)
+		return
+	}
+	if binding, _ := discover.selectBinding(bindings[:1]); binding.HostPort != "8080" {
+		t.Error(binding)
+		return
+	}
+	if network := discover.preferNetwork("udp"); network != "udp6" {
+		t.Error(network)
+		return
+	}
+	discover.IPPrefer = "ipv4"
+	if binding, _ := discover.selectBinding(bindings[1:]); binding.HostPort != "8081" {
+		t.Error(binding)
+		return
+	}
+	if network := discover.preferNetwork("tcp"); network != "tcp4" || discover.preferNetwork("unix") != "unix" {
+		t.Error(network)
+		return
+	}
+	transport := &http.Transport{}
+	discover.tuneDial(transport)
+	if transport.DialContext == nil {
+		t.Error("error")
+		return
+	}
+	//ipv6 forward
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("ipv6 is not supported")
+		return
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	discover.IPPrefer = "ipv6"
+	conn, err := discover.dialRemote(&Forward{Type: "tcp", URI: joinHost("::1", port)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conn.Close()
+}
+
+func TestDialRetry(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+	discover := NewDiscover()
+	forward := &Forward{Name: "x", Prefix: "v100.x", Type: "tcp", Key: "127.0.0.1:0", URI: addr}
+	//no retry
+	discover.DialRetry, discover.DialBackoff = 0, 100*time.Millisecond
+	begin := time.Now()
+	if _, err := discover.dialRemote(forward); err == nil || time.Since(begin) >= 100*time.Millisecond {
+		t.Errorf("%v,%v", err, time.Since(begin))
+		return
+	}
+	//retry 2 times by 50ms+100ms backoff
+	discover.DialRetry, discover.DialBackoff = 2, 50*time.Millisecond
+	begin = time.Now()
+	if _, err := discover.dialRemote(forward); err == nil || time.Since(begin) < 150*time.Millisecond || time.Since(begin) >= 350*time.Millisecond {
+		t.Errorf("%v,%v", err, time.Since(begin))
+		return
+	}
+	//listener is still accepting after backend is down
+	discover.DialRetry, discover.DialBackoff = 3, 50*time.Millisecond
+	discover.proxyLock.Lock()
+	err := discover.listenTCP(forward, &Container{Name: "x"})
+	local := discover.proxyListen[forward.Prefix]
+	discover.proxyLock.Unlock()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer local.Close()
+	conn, err := net.Dial("tcp", local.TCP.Addr().String())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Error(err)
+		return
+	}
+	conn.Close()
+	//backend is up when retrying
+	backend := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(80 * time.Millisecond)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			backend <- nil
+			return
+		}
+		backend <- ln
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				break
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+	conn, err = net.Dial("tcp", local.TCP.Addr().String())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	conn.Write([]byte("abc"))
+	buf := make([]byte, 3)
+	if _, err = io.ReadFull(conn, buf); err != nil || string(buf) != "abc" {
+		t.Errorf("%v,%v", err, string(buf))
+		return
+	}
+	if ln := <-backend; ln != nil {
+		ln.Close()
+	}
+}
+
+func TestListenerUpdate(t *testing.T) {
+	tcpBackend := func(tag string) net.Listener {
+		ln, _ := net.Listen("tcp", "127.0.0.1:0")
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					break
+				}
+				conn.Write([]byte(tag))
+				conn.Close()
+			}
+		}()
+		return ln
+	}
+	udpBackend := func(tag string) net.PacketConn {
+		conn, _ := net.ListenPacket("udp", "127.0.0.1:0")
+		go func() {
+			buffer := make([]byte, 1024)
+			for {
+				n, from, err := conn.ReadFrom(buffer)
+				if err != nil {
+					break
+				}
+				conn.WriteTo(append([]byte(tag), buffer[:n]...), from)
+			}
+		}()
+		return conn
+	}
+	tcpA, tcpB := tcpBackend("a"), tcpBackend("b")
+	defer tcpA.Close()
+	defer tcpB.Close()
+	udpA, udpB := udpBackend("a"), udpBackend("b")
+	defer udpA.Close()
+	defer udpB.Close()
+	discover := NewDiscover()
+	discover.UDPTimeout = 100 * time.Millisecond
+	service := &Container{ID: "c1", Name: "x", Version: "1.0.0"}
+	discover.proxyLock.Lock()
+	err := discover.listenTCP(&Forward{Name: "x", Prefix: "v100.x", Type: "tcp", Key: "127.0.0.1:0", URI: tcpA.Addr().String()}, service)
+	if err == nil {
+		err = discover.listenUDP(&Forward{Name: "u", Prefix: "u100.x", Type: "udp", Key: "127.0.0.1:0", URI: udpA.LocalAddr().String()}, service)
+	}
+	tcpLn, udpLn := discover.proxyListen["v100.x"], discover.proxyListen["u100.x"]
+	discover.proxyLock.Unlock()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer tcpLn.Close()
+	defer udpLn.Close()
+	readTCP := func() string {
+		conn, err := net.Dial("tcp", tcpLn.TCP.Addr().String())
+		if err != nil {
+			return err.Error()
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		data, _ := ioutil.ReadAll(conn)
+		return string(data)
+	}
+	udpConn, _ := net.Dial("udp", udpLn.UDP.LocalAddr().String())
+	defer udpConn.Close()
+	readUDP := func(conn net.Conn) string {
+		conn.Write([]byte("1"))
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, 1024)
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return err.Error()
+		}
+		return string(buffer[:n])
+	}
+	if v := readTCP(); v != "a" {
+		t.Error(v)
+		return
+	}
+	if v := readUDP(udpConn); v != "a1" {
+		t.Error(v)
+		return
+	}
+	//update the forward uri, the listener is kept and new connection is dialed to new target
+	tcpLn.Update(&Forward{Name: "x", Prefix: "v100.x", Type: "tcp", Key: "127.0.0.1:0", URI: tcpB.Addr().String()}, service)
+	udpLn.Update(&Forward{Name: "u", Prefix: "u100.x", Type: "udp", Key: "127.0.0.1:0", URI: udpB.LocalAddr().String()}, service)
+	if v := readTCP(); v != "b" {
+		t.Error(v)
+		return
+	}
+	//the session of peer is kept to old target until UDPTimeout
+	if v := readUDP(udpConn); v != "a1" {
+		t.Error(v)
+		return
+	}
+	udpOther, _ := net.Dial("udp", udpLn.UDP.LocalAddr().String())
+	defer udpOther.Close()
+	if v := readUDP(udpOther); v != "b1" {
+		t.Error(v)
+		return
+	}
+	time.Sleep(300 * time.Millisecond)
+	if v := readUDP(udpConn); v != "b1" {
+		t.Error(v)
+		return
+	}
+}
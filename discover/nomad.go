@@ -0,0 +1,194 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// nomadPort is the allocated port of nomad allocation
+type nomadPort struct {
+	Label  string `json:"Label"`
+	Value  int    `json:"Value"`
+	To     int    `json:"To"`
+	HostIP string `json:"HostIP"`
+}
+
+// nomadAllocation is the allocation of nomad api which is used to build the service
+type nomadAllocation struct {
+	ID           string `json:"ID"`
+	Name         string `json:"Name"`
+	Namespace    string `json:"Namespace"`
+	TaskGroup    string `json:"TaskGroup"`
+	ClientStatus string `json:"ClientStatus"`
+	CreateTime   int64  `json:"CreateTime"`
+	Job          *struct {
+		ID         string            `json:"ID"`
+		Version    int               `json:"Version"`
+		Meta       map[string]string `json:"Meta"`
+		TaskGroups []*struct {
+			Name  string            `json:"Name"`
+			Meta  map[string]string `json:"Meta"`
+			Tasks []*struct {
+				Name string            `json:"Name"`
+				Meta map[string]string `json:"Meta"`
+			} `json:"Tasks"`
+		} `json:"TaskGroups"`
+	} `json:"Job"`
+	AllocatedResources *struct {
+		Shared struct {
+			Ports    []*nomadPort `json:"Ports"`
+			Networks []*struct {
+				IP            string       `json:"IP"`
+				ReservedPorts []*nomadPort `json:"ReservedPorts"`
+				DynamicPorts  []*nomadPort `json:"DynamicPorts"`
+			} `json:"Networks"`
+		} `json:"Shared"`
+	} `json:"AllocatedResources"`
+}
+
+func (d *Discover) callNomad(path string, query url.Values, result interface{}) (err error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(d.NomadAddr, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return
+	}
+	if len(d.NomadToken) > 0 {
+		req.Header.Set("X-Nomad-Token", d.NomadToken)
+	}
+	client := &http.Client{Timeout: d.NomadTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("nomad %v response status %v", path, res.StatusCode)
+		return
+	}
+	err = json.NewDecoder(res.Body).Decode(result)
+	return
+}
+
+// discoveNomad will discover the running allocations of nomad, the allocation is converted to container by parseNomad
+func (d *Discover) discoveNomad() (parsed, proxied []*Container, err error) {
+	query := url.Values{}
+	query.Set("namespace", d.NomadNamespace)
+	allocs := []*nomadAllocation{}
+	if err = d.callNomad("/v1/allocations", query, &allocs); err != nil {
+		return
+	}
+	for _, summary := range allocs {
+		if summary.ClientStatus != "running" {
+			continue
+		}
+		alloc := &nomadAllocation{}
+		query := url.Values{}
+		query.Set("namespace", summary.Namespace)
+		if err = d.callNomad("/v1/allocation/"+summary.ID, query, alloc); err != nil {
+			return
+		}
+		inspect, remoteHost, ok := d.parseNomad(alloc)
+		if !ok {
+			continue
+		}
+		container, ok := d.parseContainer(inspect, remoteHost, false)
+		if container == nil {
+			continue
+		}
+		container.Backend = "nomad"
+		if ok {
+			proxied = append(proxied, container)
+		}
+		parsed = append(parsed, container)
+	}
+	return
+}
+
+// parseNomad will convert the nomad allocation to container by meta, the PD_* meta of job, task group and task is
+// merged as labels, the service name and version is PD_NAME/PD_VERSION meta or job id and job version,
+// the allocated port is published by port label and mapped to port
+func (d *Discover) parseNomad(alloc *nomadAllocation) (inspect types.ContainerJSON, remoteHost string, ok bool) {
+	if alloc.Job == nil {
+		return
+	}
+	labels := map[string]string{}
+	merge := func(meta map[string]string) {
+		for key, val := range meta {
+			if strings.HasPrefix(key, "PD_") {
+				labels[key] = val
+			}
+		}
+	}
+	merge(alloc.Job.Meta)
+	for _, group := range alloc.Job.TaskGroups {
+		if group.Name != alloc.TaskGroup {
+			continue
+		}
+		merge(group.Meta)
+		for _, task := range group.Tasks {
+			merge(task.Meta)
+		}
+	}
+	name, version := labels["PD_NAME"], labels["PD_VERSION"]
+	delete(labels, "PD_NAME")
+	delete(labels, "PD_VERSION")
+	if len(labels) < 1 {
+		return
+	}
+	if len(name) < 1 {
+		name = alloc.Job.ID
+	}
+	if len(version) < 1 {
+		version = fmt.Sprintf("v%v", alloc.Job.Version)
+	}
+	ports := nat.PortMap{}
+	if alloc.AllocatedResources != nil {
+		all := append([]*nomadPort{}, alloc.AllocatedResources.Shared.Ports...)
+		for _, network := range alloc.AllocatedResources.Shared.Networks {
+			for _, port := range append(network.ReservedPorts, network.DynamicPorts...) {
+				if len(port.HostIP) < 1 {
+					port.HostIP = network.IP
+				}
+				all = append(all, port)
+			}
+		}
+		for _, port := range all {
+			binding := nat.PortBinding{HostIP: port.HostIP, HostPort: strconv.Itoa(port.Value)}
+			keys := []string{port.Label}
+			if port.To > 0 {
+				keys = append(keys, strconv.Itoa(port.To))
+			}
+			for _, key := range keys {
+				portKey := nat.Port(key + "/tcp")
+				if len(ports[portKey]) < 1 {
+					ports[portKey] = []nat.PortBinding{binding}
+				}
+			}
+			if len(remoteHost) < 1 {
+				remoteHost = port.HostIP
+			}
+		}
+	}
+	inspect = types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:   alloc.ID,
+			Name: "/" + name + d.MatchKey + version,
+			State: &types.ContainerState{
+				Status:    "running",
+				StartedAt: time.Unix(0, alloc.CreateTime).Format(time.RFC3339Nano),
+			},
+		},
+		Config:          &container.Config{Labels: labels, Image: alloc.Name},
+		NetworkSettings: &types.NetworkSettings{NetworkSettingsBase: types.NetworkSettingsBase{Ports: ports}},
+	}
+	ok = true
+	return
+}
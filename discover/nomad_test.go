@@ -0,0 +1,77 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testNomadAlloc = `{
+	"ID": "a1b2c3", "Name": "api.web[0]", "Namespace": "default", "TaskGroup": "web", "ClientStatus": "running", "CreateTime": 1600000000000000000,
+	"Job": {
+		"ID": "api", "Version": 3, "Meta": {"PD_NAME": "ds", "OTHER": "1"},
+		"TaskGroups": [
+			{"Name": "web", "Meta": {"PD_HOST_WEB": "http", "PD_VERSION": "v1.0.0"}, "Tasks": [{"Name": "server", "Meta": {"PD_TCP_DB": ":15432/5432"}}]},
+			{"Name": "other", "Meta": {"PD_HOST_X": "x"}}
+		]
+	},
+	"AllocatedResources": {"Shared": {
+		"Ports": [{"Label": "http", "Value": 23456, "To": 8080, "HostIP": "10.0.0.5"}],
+		"Networks": [{"IP": "10.0.0.5", "ReservedPorts": [{"Label": "db", "Value": 25432, "To": 5432}]}]
+	}}
+}`
+
+func TestNomad(t *testing.T) {
+	token := ""
+	nomad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Nomad-Token")
+		switch r.URL.Path {
+		case "/v1/allocations":
+			w.Write([]byte(`[{"ID": "a1b2c3", "Namespace": "default", "ClientStatus": "running"}, {"ID": "d4", "ClientStatus": "complete"}]`))
+		case "/v1/allocation/a1b2c3":
+			w.Write([]byte(testNomadAlloc))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer nomad.Close()
+	discover := NewDiscover()
+	discover.Backends = []string{"nomad"}
+	discover.NomadAddr = nomad.URL
+	discover.NomadToken = "abc"
+	all, err := discover.Discove()
+	if err != nil || len(all) != 2 || token != "abc" {
+		t.Errorf("%v,%v,%v", err, all, token)
+		return
+	}
+	service := all["v100.ds"]
+	if service == nil || service.Backend != "nomad" || service.ID != "a1b2c3" || service.Forwards["v100.ds"].URI != "10.0.0.5:23456" || len(service.Problems) > 0 {
+		t.Errorf("%v,%v", all, service)
+		return
+	}
+	if forward := all["tcp://:15432"].Forwards["tcp://:15432"]; forward.URI != "10.0.0.5:25432" {
+		t.Error(forward)
+		return
+	}
+	//default name and version
+	alloc := &nomadAllocation{}
+	discover.callNomad("/v1/allocation/a1b2c3", nil, alloc)
+	delete(alloc.Job.Meta, "PD_NAME")
+	delete(alloc.Job.TaskGroups[0].Meta, "PD_VERSION")
+	inspect, remoteHost, ok := discover.parseNomad(alloc)
+	if !ok || inspect.Name != "/api-srv-v3" || remoteHost != "10.0.0.5" {
+		t.Errorf("%v,%v,%v", ok, inspect.Name, remoteHost)
+		return
+	}
+	//error
+	discover.NomadAddr = nomad.URL + "/none"
+	if _, err = discover.Discove(); err == nil {
+		t.Error("error")
+		return
+	}
+	discover.Backends = []string{"xx"}
+	if _, err = discover.Discove(); err == nil {
+		t.Error("error")
+		return
+	}
+}
@@ -0,0 +1,505 @@
+package discover
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// OpenAPIVersion is the version of admin api contract, it must be changed when the api is changed
+const OpenAPIVersion = "1.20.0"
+
+type openAPIParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+type openAPIPath struct {
+	Path        string
+	Method      string
+	Summary     string
+	Params      []openAPIParam
+	Response    string
+	ContentType string
+}
+
+var openAPIServiceParams = []openAPIParam{
+	{Name: "service", Type: "string", Description: "service name"},
+	{Name: "id", Type: "string", Description: "container id prefix"},
+	{Name: "version", Type: "string", Description: "service version"},
+}
+
+var openAPIPaths = []openAPIPath{
+	{Path: "status", Method: http.MethodGet, Summary: "show pause/read-only status", Response: "Status"},
+	{Path: "services", Method: http.MethodGet, Summary: "list services", Response: "Services"},
+	{
+		Path: "catalog", Method: http.MethodGet, Summary: "list catalog hosts", Response: "Catalog",
+		Params: []openAPIParam{
+			{Name: "q", Type: "string", Description: "search name/version/forward/host"},
+			{Name: "name", Type: "string", Description: "service name contains"},
+			{Name: "version", Type: "string", Description: "service version glob pattern"},
+			{Name: "type", Type: "string", Description: "forward type http/tcp/udp/unix"},
+			{Name: "status", Type: "string", Description: "container status"},
+		},
+	},
+	{Path: "triggers", Method: http.MethodGet, Summary: "show trigger execution statistics", Response: "Triggers"},
+	{Path: "flapping", Method: http.MethodGet, Summary: "show churn and health statistics of services in flap window", Response: "Flapping"},
+	{Path: "probes", Method: http.MethodGet, Summary: "show synthetic probe statistics of forwards", Response: "Probes"},
+	{Path: "conflicts", Method: http.MethodGet, Summary: "list tcp/udp/unix forwards which can't listen by address already in use", Response: "Conflicts"},
+	{Path: "resources", Method: http.MethodGet, Summary: "show goroutine, open fd, active proxy connection, listener and docker client accounting", Response: "Resources"},
+	{Path: "collisions", Method: http.MethodGet, Summary: "list forward prefixes which are produced by multiple containers with the container serving it", Response: "Collisions"},
+	{Path: "compose", Method: http.MethodGet, Summary: "list expected services and forwards of compose files which are not running", Response: "ComposeDrifts"},
+	{Path: "agents", Method: http.MethodGet, Summary: "list last report of agents which is running on docker hosts", Response: "Agents"},
+	{Path: "xds", Method: http.MethodPost, Summary: "show endpoints of forwards by envoy discovery response, the body is envoy discovery request", Response: "XDS"},
+	{
+		Path: "lint", Method: http.MethodGet, Summary: "check PD_* labels of container by id/name, or list label problems of all containers on last refresh", Response: "Lint",
+		Params: []openAPIParam{
+			{Name: "container", Type: "string", Description: "container id or name, empty to list all"},
+		},
+	},
+	{
+		Path: "config", Method: http.MethodGet, Summary: "show effective config keys with default and source, the secret is redacted", Response: "Config",
+		Params: []openAPIParam{
+			{Name: "q", Type: "string", Description: "config key contains"},
+		},
+	},
+	{
+		Path: "latency", Method: http.MethodGet, Summary: "show latency percentiles and error rate of forwards by hourly/daily rollups", Response: "Latency",
+		Params: []openAPIParam{
+			{Name: "period", Type: "string", Description: "hour or day, default hour"},
+			{Name: "host", Type: "string", Description: "forward host"},
+		},
+	},
+	{
+		Path: "captures", Method: http.MethodGet, Summary: "list captured request/response pairs", Response: "Captures",
+		Params: []openAPIParam{
+			{Name: "host", Type: "string", Description: "forward host"},
+			{Name: "id", Type: "integer", Description: "show one capture by id"},
+		},
+	},
+	{
+		Path: "captures", Method: http.MethodPost, Summary: "set capture sampling percent of forward", Response: "CaptureSet",
+		Params: []openAPIParam{
+			{Name: "host", Type: "string", Description: "forward host"},
+			{Name: "percent", Type: "integer", Description: "sampling percent 0-100, -1 to reset to PD_CAPTURE label"},
+		},
+	},
+	{
+		Path: "capture/replay", Method: http.MethodPost, Summary: "replay captured request to current or other version", Response: "Capture",
+		Params: []openAPIParam{
+			{Name: "id", Type: "integer", Description: "capture id"},
+			{Name: "version", Type: "string", Description: "service version, empty to current version"},
+		},
+	},
+	{
+		Path: "tap", Method: http.MethodGet, Summary: "stream sampled request summary of forward by websocket json message", Response: "TapEvent",
+		Params: []openAPIParam{
+			{Name: "host", Type: "string", Description: "forward host"},
+			{Name: "percent", Type: "integer", Description: "sampling percent 1-100, default 100"},
+		},
+	},
+	{Path: "metrics", Method: http.MethodGet, Summary: "show metrics by prometheus text format", ContentType: "text/plain"},
+	{Path: "sd/prometheus", Method: http.MethodGet, Summary: "list http backends by prometheus http_sd format", Response: "PrometheusSD"},
+	{Path: "export/hosts", Method: http.MethodGet, Summary: "export catalog hosts as /etc/hosts fragment", ContentType: "text/plain"},
+	{Path: "export/dnsmasq", Method: http.MethodGet, Summary: "export catalog hosts as dnsmasq address config", ContentType: "text/plain"},
+	{Path: "export/unbound", Method: http.MethodGet, Summary: "export catalog hosts as unbound local-zone config", ContentType: "text/plain"},
+	{
+		Path: "logs", Method: http.MethodGet, Summary: "show service log", ContentType: "text/plain",
+		Params: append([]openAPIParam{
+			{Name: "follow", Type: "integer", Description: "follow log when 1"},
+			{Name: "tail", Type: "string", Description: "number of lines from the end"},
+			{Name: "since", Type: "string", Description: "show log since timestamp"},
+			{Name: "timestamps", Type: "integer", Description: "show timestamps when 1"},
+			{Name: "stdout", Type: "integer", Description: "hide stdout when 0"},
+			{Name: "stderr", Type: "integer", Description: "hide stderr when 0"},
+		}, openAPIServiceParams...),
+	},
+	{Path: "pause", Method: http.MethodPost, Summary: "pause the refresh loop", Response: "Status"},
+	{Path: "resume", Method: http.MethodPost, Summary: "resume the refresh loop", Response: "Status"},
+	{
+		Path: "readonly", Method: http.MethodPost, Summary: "switch read-only mode", Response: "Status",
+		Params: []openAPIParam{{Name: "enable", Type: "boolean", Description: "enable read-only mode, default true"}},
+	},
+	{
+		Path: "upgrade", Method: http.MethodPost, Summary: "download and verify signed release binary, then restart in place by handing over listen sockets", Response: "Upgrade",
+		Params: []openAPIParam{{Name: "url", Type: "string", Description: "release binary url, the signature is url.sig, default upgrade_url"}},
+	},
+	{Path: "refresh", Method: http.MethodPost, Summary: "run refresh/clear/prune immediately", Response: "Refresh"},
+	{Path: "restart", Method: http.MethodPost, Summary: "restart service", Response: "Restart", Params: openAPIServiceParams},
+	{Path: "login", Method: http.MethodPost, Summary: "create session by credential", Response: "Login"},
+	{
+		Path: "session/refresh", Method: http.MethodPost, Summary: "issue access token by refresh token", Response: "Login",
+		Params: []openAPIParam{{Name: "refresh_token", Type: "string", Description: "refresh token of login"}},
+	},
+	{Path: "logout", Method: http.MethodPost, Summary: "revoke session of access token", Response: "Revoke"},
+	{Path: "sessions", Method: http.MethodGet, Summary: "list active sessions", Response: "Sessions"},
+	{
+		Path: "session/revoke", Method: http.MethodPost, Summary: "revoke session", Response: "Revoke",
+		Params: []openAPIParam{{Name: "id", Type: "string", Description: "session id"}},
+	},
+	{Path: "loglevel", Method: http.MethodGet, Summary: "show global and module log levels", Response: "LogLevel"},
+	{
+		Path: "loglevel", Method: http.MethodPost, Summary: "change global or module log level", Response: "LogLevel",
+		Params: []openAPIParam{
+			{Name: "module", Type: "string", Description: "discovery/proxy/cleanup/triggers/admin, empty to change global level"},
+			{Name: "level", Type: "string", Description: "debug/info/warn/error or number, 0 to reset module level"},
+		},
+	},
+}
+
+func openAPIRef(name string) xmap.M {
+	return xmap.M{"$ref": "#/components/schemas/" + name}
+}
+
+func openAPIObject(required []string, properties xmap.M) xmap.M {
+	return xmap.M{"type": "object", "required": required, "properties": properties}
+}
+
+func openAPIArray(items xmap.M) xmap.M {
+	return xmap.M{"type": "array", "items": items}
+}
+
+func openAPIType(name string) xmap.M {
+	return xmap.M{"type": name}
+}
+
+var openAPISchemas = xmap.M{
+	"Error": openAPIObject([]string{"code", "message"}, xmap.M{
+		"code":    openAPIType("integer"),
+		"message": openAPIType("string"),
+	}),
+	"Status": openAPIObject([]string{"paused", "read_only", "services"}, xmap.M{
+		"paused":    openAPIType("boolean"),
+		"read_only": openAPIType("boolean"),
+		"services":  openAPIType("integer"),
+		"refresh":   openAPIRef("RefreshStats"),
+	}),
+	"RefreshStats": openAPIObject([]string{"runs", "skipped", "running"}, xmap.M{
+		"runs":          openAPIType("integer"),
+		"skipped":       xmap.M{"type": "integer", "description": "ticks skipped by previous cycle still running"},
+		"running":       openAPIType("boolean"),
+		"duration":      xmap.M{"type": "integer", "description": "total duration in nanoseconds"},
+		"last_duration": xmap.M{"type": "integer", "description": "last duration in nanoseconds"},
+		"last_at":       xmap.M{"type": "string", "format": "date-time"},
+	}),
+	"Service": openAPIObject([]string{"id", "name", "version", "status", "forwards"}, xmap.M{
+		"id":           openAPIType("string"),
+		"name":         openAPIType("string"),
+		"version":      openAPIType("string"),
+		"status":       openAPIType("string"),
+		"started_at":   openAPIType("string"),
+		"finished_at":  openAPIType("string"),
+		"tenant":       openAPIType("string"),
+		"quota":        xmap.M{"type": "string", "description": "the exceeded quota on flag mode"},
+		"health":       xmap.M{"type": "string", "description": "the docker healthcheck status"},
+		"forwards":     openAPIArray(openAPIType("string")),
+		"problems":     openAPIArray(openAPIRef("LabelProblem")),
+		"previous_ids": xmap.M{"type": "array", "items": openAPIType("string"), "description": "the container ids which is recreated to this container, newest first"},
+	}),
+	"Services": openAPIArray(openAPIRef("Service")),
+	"CatalogForward": openAPIObject([]string{"name", "type", "prefix"}, xmap.M{
+		"name":     openAPIType("string"),
+		"type":     openAPIType("string"),
+		"prefix":   openAPIType("string"),
+		"wildcard": openAPIType("boolean"),
+		"default":  openAPIType("boolean"),
+		"aliases":  openAPIArray(openAPIType("string")),
+	}),
+	"CatalogItem": openAPIObject([]string{"host", "name", "version", "forward"}, xmap.M{
+		"host":       openAPIType("string"),
+		"name":       openAPIType("string"),
+		"version":    openAPIType("string"),
+		"status":     openAPIType("string"),
+		"started_at": openAPIType("string"),
+		"tenant":     openAPIType("string"),
+		"stats":      xmap.M{"allOf": []xmap.M{openAPIRef("ResourceStats")}, "nullable": true},
+		"forward":    openAPIRef("CatalogForward"),
+		"problems":   openAPIArray(openAPIRef("LabelProblem")),
+	}),
+	"Catalog": openAPIArray(openAPIRef("CatalogItem")),
+	"ResourceStats": openAPIObject([]string{"cpu_percent", "memory_usage", "memory_limit"}, xmap.M{
+		"cpu_percent":  xmap.M{"type": "number"},
+		"memory_usage": xmap.M{"type": "integer", "description": "memory usage in bytes"},
+		"memory_limit": xmap.M{"type": "integer", "description": "memory limit in bytes"},
+		"update_time":  xmap.M{"type": "string", "format": "date-time"},
+	}),
+	"TriggerStats": openAPIObject([]string{"success", "failure"}, xmap.M{
+		"success":       openAPIType("integer"),
+		"failure":       openAPIType("integer"),
+		"duration":      xmap.M{"type": "integer", "description": "total duration in nanoseconds"},
+		"last_duration": xmap.M{"type": "integer", "description": "last duration in nanoseconds"},
+		"last_at":       xmap.M{"type": "string", "format": "date-time"},
+		"last_error":    openAPIType("string"),
+		"last_output":   openAPIType("string"),
+	}),
+	"Triggers": xmap.M{"type": "object", "additionalProperties": openAPIRef("TriggerStats")},
+	"Refresh": openAPIObject([]string{"added", "updated", "removed"}, xmap.M{
+		"added":   openAPIArray(openAPIType("string")),
+		"updated": openAPIArray(openAPIType("string")),
+		"removed": openAPIArray(openAPIType("string")),
+	}),
+	"Restart": openAPIObject([]string{"restarted"}, xmap.M{
+		"restarted": openAPIArray(openAPIType("string")),
+	}),
+	"Session": openAPIObject([]string{"id", "subject", "role", "created_at", "expires_at"}, xmap.M{
+		"id":         openAPIType("string"),
+		"subject":    openAPIType("string"),
+		"role":       openAPIType("string"),
+		"tenant":     openAPIType("string"),
+		"created_at": xmap.M{"type": "string", "format": "date-time"},
+		"expires_at": xmap.M{"type": "string", "format": "date-time"},
+	}),
+	"Sessions": openAPIArray(openAPIRef("Session")),
+	"Login": openAPIObject([]string{"token", "expires_in", "session"}, xmap.M{
+		"token":         openAPIType("string"),
+		"refresh_token": xmap.M{"type": "string", "description": "only returned on login"},
+		"expires_in":    xmap.M{"type": "integer", "description": "access token expires in seconds"},
+		"session":       openAPIRef("Session"),
+	}),
+	"PrometheusSD": openAPIArray(openAPIObject([]string{"targets", "labels"}, xmap.M{
+		"targets": openAPIArray(openAPIType("string")),
+		"labels":  xmap.M{"type": "object", "additionalProperties": openAPIType("string")},
+	})),
+	"Revoke": openAPIObject([]string{"revoked"}, xmap.M{
+		"revoked": openAPIArray(openAPIType("string")),
+	}),
+	"FlapStats": openAPIObject([]string{"name", "added", "removed", "restarts", "checks", "failures", "failure_rate", "budget", "flapping"}, xmap.M{
+		"name":         openAPIType("string"),
+		"added":        openAPIType("integer"),
+		"removed":      openAPIType("integer"),
+		"restarts":     openAPIType("integer"),
+		"checks":       openAPIType("integer"),
+		"failures":     openAPIType("integer"),
+		"failure_rate": openAPIType("number"),
+		"budget":       xmap.M{"type": "number", "description": "remaining error budget ratio, negative when exhausted"},
+		"flapping":     openAPIType("boolean"),
+		"alerted_at":   xmap.M{"type": "string", "format": "date-time"},
+	}),
+	"Flapping": openAPIArray(openAPIRef("FlapStats")),
+	"ProbeResult": openAPIObject([]string{"status", "latency", "success", "at"}, xmap.M{
+		"status":  openAPIType("integer"),
+		"latency": xmap.M{"type": "integer", "description": "latency in nanoseconds"},
+		"success": openAPIType("boolean"),
+		"error":   openAPIType("string"),
+		"at":      xmap.M{"type": "string", "format": "date-time"},
+	}),
+	"ProbeStats": openAPIObject([]string{"host", "name", "version", "path", "expected", "total", "failure", "failures", "uptime", "failing"}, xmap.M{
+		"host":     openAPIType("string"),
+		"name":     openAPIType("string"),
+		"version":  openAPIType("string"),
+		"path":     openAPIType("string"),
+		"expected": openAPIType("integer"),
+		"slo":      xmap.M{"type": "integer", "description": "latency slo in nanoseconds"},
+		"total":    openAPIType("integer"),
+		"failure":  openAPIType("integer"),
+		"failures": xmap.M{"type": "integer", "description": "consecutive failures"},
+		"uptime":   openAPIType("number"),
+		"failing":  openAPIType("boolean"),
+		"last":     openAPIRef("ProbeResult"),
+	}),
+	"Probes": openAPIArray(openAPIRef("ProbeStats")),
+	"LatencyReport": openAPIObject([]string{"start", "count", "errors", "error_rate", "p50", "p95", "p99", "max"}, xmap.M{
+		"start":      xmap.M{"type": "string", "format": "date-time"},
+		"count":      openAPIType("integer"),
+		"errors":     xmap.M{"type": "integer", "description": "count of 5xx status"},
+		"error_rate": openAPIType("number"),
+		"p50":        xmap.M{"type": "integer", "description": "latency in milliseconds"},
+		"p95":        xmap.M{"type": "integer", "description": "latency in milliseconds"},
+		"p99":        xmap.M{"type": "integer", "description": "latency in milliseconds"},
+		"max":        xmap.M{"type": "integer", "description": "latency in milliseconds"},
+	}),
+	"Capture": openAPIObject([]string{"id", "at", "host", "name", "version", "method", "uri", "status", "duration"}, xmap.M{
+		"id":                 openAPIType("integer"),
+		"at":                 xmap.M{"type": "string", "format": "date-time"},
+		"host":               openAPIType("string"),
+		"name":               openAPIType("string"),
+		"version":            openAPIType("string"),
+		"forward":            openAPIType("string"),
+		"remote_addr":        openAPIType("string"),
+		"method":             openAPIType("string"),
+		"uri":                openAPIType("string"),
+		"header":             xmap.M{"type": "object", "additionalProperties": openAPIArray(openAPIType("string"))},
+		"body":               xmap.M{"type": "string", "format": "byte"},
+		"body_truncated":     openAPIType("boolean"),
+		"status":             openAPIType("integer"),
+		"response_header":    xmap.M{"type": "object", "additionalProperties": openAPIArray(openAPIType("string"))},
+		"response_body":      xmap.M{"type": "string", "format": "byte"},
+		"response_truncated": openAPIType("boolean"),
+		"duration":           xmap.M{"type": "integer", "description": "duration in nanoseconds"},
+	}),
+	"Captures": openAPIArray(openAPIRef("Capture")),
+	"CaptureSet": openAPIObject([]string{"host", "percent"}, xmap.M{
+		"host":    openAPIType("string"),
+		"percent": openAPIType("integer"),
+	}),
+	"Upgrade": openAPIObject([]string{"url", "executable", "restarting"}, xmap.M{
+		"url":        openAPIType("string"),
+		"executable": openAPIType("string"),
+		"restarting": openAPIType("boolean"),
+	}),
+	"ListenConflict": openAPIObject([]string{"prefix", "type", "address", "error", "since"}, xmap.M{
+		"prefix":  openAPIType("string"),
+		"type":    openAPIType("string"),
+		"address": openAPIType("string"),
+		"name":    openAPIType("string"),
+		"version": openAPIType("string"),
+		"error":   openAPIType("string"),
+		"since":   xmap.M{"type": "string", "format": "date-time"},
+	}),
+	"Conflicts": openAPIArray(openAPIRef("ListenConflict")),
+	"ListenerState": openAPIObject([]string{"prefix", "type", "address", "state"}, xmap.M{
+		"prefix":  openAPIType("string"),
+		"type":    openAPIType("string"),
+		"address": openAPIType("string"),
+		"name":    openAPIType("string"),
+		"state":   xmap.M{"type": "string", "description": "listening or conflict"},
+	}),
+	"Resources": openAPIObject([]string{"goroutines", "open_fds", "http_requests", "tcp_conns", "udp_sessions", "listeners", "docker_clients"}, xmap.M{
+		"goroutines":       openAPIType("integer"),
+		"open_fds":         xmap.M{"type": "integer", "description": "-1 when it is not supported"},
+		"http_requests":    xmap.M{"type": "integer", "description": "active proxy requests"},
+		"tcp_conns":        xmap.M{"type": "integer", "description": "active tcp/unix proxy connections"},
+		"udp_sessions":     xmap.M{"type": "integer", "description": "active udp proxy sessions"},
+		"listeners":        openAPIArray(openAPIRef("ListenerState")),
+		"docker_clients":   openAPIType("integer"),
+		"docker_created":   xmap.M{"type": "integer", "description": "total created docker clients"},
+		"runaway":          openAPIArray(openAPIType("string")),
+		"runaway_alerted":  xmap.M{"type": "string", "format": "date-time"},
+		"goroutine_sample": xmap.M{"type": "array", "items": openAPIType("integer"), "description": "goroutines sampled on last refreshes"},
+	}),
+	"CollisionContainer": openAPIObject([]string{"id", "name", "version"}, xmap.M{
+		"id":         openAPIType("string"),
+		"name":       openAPIType("string"),
+		"version":    openAPIType("string"),
+		"started_at": openAPIType("string"),
+	}),
+	"PrefixCollision": openAPIObject([]string{"prefix", "policy", "winner", "losers", "since"}, xmap.M{
+		"prefix": openAPIType("string"),
+		"policy": xmap.M{"type": "string", "description": "newest or oldest"},
+		"winner": openAPIRef("CollisionContainer"),
+		"losers": openAPIArray(openAPIRef("CollisionContainer")),
+		"since":  xmap.M{"type": "string", "format": "date-time"},
+	}),
+	"Collisions": openAPIArray(openAPIRef("PrefixCollision")),
+	"ComposeDrift": openAPIObject([]string{"file", "service", "name", "version", "message", "since"}, xmap.M{
+		"file":    openAPIType("string"),
+		"service": xmap.M{"type": "string", "description": "service key of compose file"},
+		"name":    openAPIType("string"),
+		"version": openAPIType("string"),
+		"forward": xmap.M{"type": "string", "description": "missing forward name, empty when service is not running"},
+		"message": openAPIType("string"),
+		"since":   xmap.M{"type": "string", "format": "date-time"},
+	}),
+	"ComposeDrifts": openAPIArray(openAPIRef("ComposeDrift")),
+	"AgentStats": openAPIObject([]string{"name", "containers", "remote", "reported_at", "expired"}, xmap.M{
+		"name":        openAPIType("string"),
+		"containers":  openAPIType("integer"),
+		"remote":      xmap.M{"type": "string", "description": "remote address of last report"},
+		"reported_at": xmap.M{"type": "string", "format": "date-time"},
+		"expired":     xmap.M{"type": "boolean", "description": "the report is not received in agent_expire"},
+	}),
+	"Agents": openAPIArray(openAPIRef("AgentStats")),
+	"XDS": openAPIObject([]string{"version_info", "resources", "type_url"}, xmap.M{
+		"version_info": openAPIType("string"),
+		"resources":    xmap.M{"type": "array", "items": xmap.M{"type": "object"}, "description": "envoy ClusterLoadAssignment named by forward prefix"},
+		"type_url":     openAPIType("string"),
+	}),
+	"LabelProblem": openAPIObject([]string{"message"}, xmap.M{
+		"label":   openAPIType("string"),
+		"value":   openAPIType("string"),
+		"message": openAPIType("string"),
+	}),
+	"LabelLint": openAPIObject([]string{"id", "name", "version", "problems"}, xmap.M{
+		"id":       openAPIType("string"),
+		"name":     openAPIType("string"),
+		"version":  openAPIType("string"),
+		"problems": openAPIArray(openAPIRef("LabelProblem")),
+	}),
+	"Lint": xmap.M{"oneOf": []xmap.M{openAPIRef("LabelLint"), openAPIArray(openAPIRef("LabelLint"))}},
+	"ConfigItem": openAPIObject([]string{"key", "type", "default", "value", "source"}, xmap.M{
+		"key":     openAPIType("string"),
+		"type":    xmap.M{"type": "string", "description": "string, int, int64 or array"},
+		"default": openAPIType("string"),
+		"value":   openAPIType("string"),
+		"source":  xmap.M{"type": "string", "description": "file, env or default"},
+	}),
+	"Config": openAPIArray(openAPIRef("ConfigItem")),
+	"TapEvent": openAPIObject([]string{"at", "host", "method", "path", "status", "duration"}, xmap.M{
+		"at":          xmap.M{"type": "string", "format": "date-time"},
+		"host":        openAPIType("string"),
+		"name":        openAPIType("string"),
+		"version":     openAPIType("string"),
+		"remote_addr": openAPIType("string"),
+		"method":      openAPIType("string"),
+		"path":        openAPIType("string"),
+		"status":      openAPIType("integer"),
+		"duration":    xmap.M{"type": "integer", "description": "duration in nanoseconds"},
+	}),
+	"Latency": xmap.M{"type": "object", "additionalProperties": openAPIArray(openAPIRef("LatencyReport"))},
+	"LogLevel": openAPIObject([]string{"level", "modules"}, xmap.M{
+		"level":   openAPIType("integer"),
+		"modules": xmap.M{"type": "object", "additionalProperties": openAPIType("integer")},
+	}),
+}
+
+// OpenAPI will return the OpenAPI 3 document of admin api
+func (d *Discover) OpenAPI() (doc xmap.M) {
+	prefix := "/" + strings.Trim(d.AdminPrefix, "/")
+	errorResponse := xmap.M{
+		"description": "error",
+		"content":     xmap.M{"application/json": xmap.M{"schema": openAPIRef("Error")}},
+	}
+	paths := xmap.M{}
+	for _, path := range openAPIPaths {
+		parameters := []xmap.M{}
+		for _, param := range path.Params {
+			parameters = append(parameters, xmap.M{
+				"name":        param.Name,
+				"in":          "query",
+				"description": param.Description,
+				"schema":      openAPIType(param.Type),
+			})
+		}
+		content := xmap.M{}
+		if len(path.ContentType) > 0 {
+			content[path.ContentType] = xmap.M{"schema": openAPIType("string")}
+		} else {
+			content["application/json"] = xmap.M{"schema": openAPIRef(path.Response)}
+		}
+		operations, ok := paths[prefix+"/"+path.Path].(xmap.M)
+		operationID := path.Path
+		if ok {
+			operationID = path.Path + "_" + strings.ToLower(path.Method)
+		} else {
+			operations = xmap.M{}
+			paths[prefix+"/"+path.Path] = operations
+		}
+		operations[strings.ToLower(path.Method)] = xmap.M{
+			"operationId": operationID,
+			"summary":     path.Summary,
+			"parameters":  parameters,
+			"responses": xmap.M{
+				"200":     xmap.M{"description": "success", "content": content},
+				"default": errorResponse,
+			},
+		}
+	}
+	doc = xmap.M{
+		"openapi": "3.0.3",
+		"info": xmap.M{
+			"title":   "pdservice admin api",
+			"version": OpenAPIVersion,
+		},
+		"security": []xmap.M{{"bearer": []string{}}},
+		"paths":    paths,
+		"components": xmap.M{
+			"securitySchemes": xmap.M{
+				"bearer": xmap.M{"type": "http", "scheme": "bearer"},
+			},
+			"schemas": openAPISchemas,
+		},
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package discover
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	req := httptest.NewRequest("GET", "http://pdsrv/_api/openapi.json", nil)
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusNotFound {
+		t.Error(res.Code)
+		return
+	}
+	discover.AdminToken = "123"
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Error(res.Code)
+		return
+	}
+	doc := struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}{}
+	if err := json.Unmarshal(res.Body.Bytes(), &doc); err != nil {
+		t.Error(err)
+		return
+	}
+	if doc.OpenAPI != "3.0.3" || doc.Info.Version != OpenAPIVersion {
+		t.Error(res.Body.String())
+		return
+	}
+	for _, path := range openAPIPaths {
+		if doc.Paths["/_api/"+path.Path][strings.ToLower(path.Method)] == nil {
+			t.Error(path.Path)
+			return
+		}
+		if len(path.Response) > 0 && doc.Components.Schemas[path.Response] == nil {
+			t.Error(path.Response)
+			return
+		}
+	}
+}
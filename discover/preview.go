@@ -0,0 +1,208 @@
+package discover
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// PreviewFuncs is the helper functions which can be used in preview template
+var PreviewFuncs = template.FuncMap{
+	"duration":    formatDuration,
+	"since":       formatSince,
+	"sortVersion": sortVersion,
+	"groupBy":     groupHosts,
+	"badge":       statusBadge,
+	"join":        strings.Join,
+	"lower":       strings.ToLower,
+	"upper":       strings.ToUpper,
+}
+
+func formatDuration(val interface{}) string {
+	var d time.Duration
+	switch v := val.(type) {
+	case time.Duration:
+		d = v
+	case int:
+		d = time.Duration(v) * time.Millisecond
+	case int64:
+		d = time.Duration(v) * time.Millisecond
+	case float64:
+		d = time.Duration(v) * time.Millisecond
+	case string:
+		d, _ = time.ParseDuration(v)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+	d = d.Round(time.Second)
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%vd%vh", int64(d/(24*time.Hour)), int64(d%(24*time.Hour)/time.Hour))
+	case d >= time.Hour:
+		return fmt.Sprintf("%vh%vm", int64(d/time.Hour), int64(d%time.Hour/time.Minute))
+	case d >= time.Minute:
+		return fmt.Sprintf("%vm%vs", int64(d/time.Minute), int64(d%time.Minute/time.Second))
+	default:
+		return fmt.Sprintf("%vs", int64(d/time.Second))
+	}
+}
+
+func formatSince(val string) string {
+	at, err := time.Parse(time.RFC3339Nano, val)
+	if err != nil || at.IsZero() || at.Year() < 2 {
+		return "-"
+	}
+	return formatDuration(time.Since(at))
+}
+
+func sortVersion(versions []string) (sorted []string) {
+	sorted = append([]string{}, versions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return CompareVersion(sorted[i], sorted[j]) > 0
+	})
+	return
+}
+
+// catalogCollapse is the host count of default catalog page, the service group is collapsed when hosts is more than it
+const catalogCollapse = 20
+
+// groupHosts will group the catalog hosts by container name and sort group version by semver desc,
+// the group has Name, Count, Hosts and Versions which is the hosts grouped by version
+func groupHosts(hosts []xmap.M) (groups []xmap.M) {
+	groupAll := map[string]xmap.M{}
+	for _, host := range hosts {
+		container, _ := host["Container"].(*Container)
+		name := ""
+		if container != nil {
+			name = container.Name
+		}
+		group := groupAll[name]
+		if group == nil {
+			group = xmap.M{"Name": name, "Hosts": []xmap.M{}}
+			groupAll[name] = group
+			groups = append(groups, group)
+		}
+		group["Hosts"] = append(group["Hosts"].([]xmap.M), host)
+	}
+	for _, group := range groups {
+		hosts := group["Hosts"].([]xmap.M)
+		sort.SliceStable(hosts, func(i, j int) bool {
+			x, _ := hosts[i]["Container"].(*Container)
+			y, _ := hosts[j]["Container"].(*Container)
+			return x != nil && y != nil && CompareVersion(x.Version, y.Version) > 0
+		})
+		versions := []xmap.M{}
+		for _, host := range hosts {
+			version := ""
+			if container, _ := host["Container"].(*Container); container != nil {
+				version = container.Version
+			}
+			if len(versions) < 1 || versions[len(versions)-1]["Version"] != version {
+				versions = append(versions, xmap.M{"Version": version, "Hosts": []xmap.M{}})
+			}
+			last := versions[len(versions)-1]
+			last["Hosts"] = append(last["Hosts"].([]xmap.M), host)
+		}
+		group["Count"] = len(hosts)
+		group["Versions"] = versions
+	}
+	return
+}
+
+func statusBadge(status string) string {
+	switch status {
+	case "running", "healthy":
+		return "success"
+	case "restarting", "starting", "created", "paused":
+		return "warning"
+	case "exited", "dead", "unhealthy", "removing":
+		return "danger"
+	default:
+		return "secondary"
+	}
+}
+
+func previewModTime(info os.FileInfo, files []string) (modTime time.Time) {
+	modTime = info.ModTime()
+	for _, file := range files {
+		if fileInfo, err := os.Stat(file); err == nil && fileInfo.ModTime().After(modTime) {
+			modTime = fileInfo.ModTime()
+		}
+	}
+	return
+}
+
+// LoadPreview will load the preview template from PreviewFile when the file is changed,
+// all *.html templates are loaded when PreviewFile is a directory
+func (d *Discover) LoadPreview() (preview *template.Template, err error) {
+	d.previewLock.Lock()
+	defer d.previewLock.Unlock()
+	preview = d.Preview
+	if len(d.PreviewFile) < 1 {
+		return
+	}
+	info, err := os.Stat(d.PreviewFile)
+	if err != nil {
+		return
+	}
+	files := []string{d.PreviewFile}
+	if info.IsDir() {
+		files, _ = filepath.Glob(filepath.Join(d.PreviewFile, "*.html"))
+		if len(files) < 1 {
+			err = fmt.Errorf("no template found in %v", d.PreviewFile)
+			return
+		}
+	}
+	modTime := previewModTime(info, files)
+	if preview != nil && modTime.Equal(d.previewTime) {
+		return
+	}
+	preview, err = template.New(info.Name()).Funcs(PreviewFuncs).ParseFiles(files...)
+	if err != nil {
+		preview = d.Preview
+		return
+	}
+	InfoLog("Discover load preview template from %v success", d.PreviewFile)
+	d.Preview = preview
+	d.previewTime = modTime
+	d.previewDir = info.IsDir()
+	return
+}
+
+// lookupPreview will return the template to render request path, the path /x is rendered by x.html and / by index.html on directory mode
+func (d *Discover) lookupPreview(preview *template.Template, path string) *template.Template {
+	d.previewLock.Lock()
+	previewDir := d.previewDir
+	d.previewLock.Unlock()
+	if !previewDir {
+		return preview
+	}
+	name := strings.Trim(path, "/")
+	if len(name) < 1 {
+		name = "index"
+	}
+	if len(filepath.Ext(name)) < 1 {
+		name += ".html"
+	}
+	return preview.Lookup(name)
+}
+
+// procStatic will serve the static assets in <PreviewFile>/static under PreviewStatic path on directory mode
+func (d *Discover) procStatic(w http.ResponseWriter, r *http.Request) bool {
+	if len(d.PreviewStatic) < 1 || !strings.HasPrefix(r.URL.Path, d.PreviewStatic) {
+		return false
+	}
+	if info, err := os.Stat(d.PreviewFile); err != nil || !info.IsDir() {
+		return false
+	}
+	dir := http.Dir(filepath.Join(d.PreviewFile, "static"))
+	http.StripPrefix(d.PreviewStatic, http.FileServer(dir)).ServeHTTP(w, r)
+	return true
+}
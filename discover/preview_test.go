@@ -0,0 +1,145 @@
+package discover
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+func TestPreviewFuncs(t *testing.T) {
+	for val, expect := range map[interface{}]string{
+		90 * time.Second: "1m30s",
+		int64(3600000):   "1h0m",
+		"49h":            "2d1h",
+		"xx":             "0s",
+	} {
+		if v := formatDuration(val); v != expect {
+			t.Errorf("%v->%v", val, v)
+			return
+		}
+	}
+	if v := formatSince("0001-01-01T00:00:00Z"); v != "-" {
+		t.Error(v)
+		return
+	}
+	if v := sortVersion([]string{"v1.2", "v1.10", "v1.9"}); v[0] != "v1.10" || v[2] != "v1.2" {
+		t.Error(v)
+		return
+	}
+	groups := groupHosts([]xmap.M{
+		{"Container": &Container{Name: "a", Version: "v1.2"}},
+		{"Container": &Container{Name: "b", Version: "v1.0"}},
+		{"Container": &Container{Name: "a", Version: "v1.10"}},
+		{"Container": &Container{Name: "a", Version: "v1.2"}},
+	})
+	if len(groups) != 2 || groups[0]["Name"] != "a" || groups[0]["Hosts"].([]xmap.M)[0]["Container"].(*Container).Version != "v1.10" {
+		t.Error(groups)
+		return
+	}
+	if versions := groups[0]["Versions"].([]xmap.M); groups[0]["Count"] != 3 || len(versions) != 2 || versions[0]["Version"] != "v1.10" || len(versions[1]["Hosts"].([]xmap.M)) != 2 {
+		t.Error(groups)
+		return
+	}
+	if statusBadge("running") != "success" || statusBadge("exited") != "danger" || statusBadge("xx") != "secondary" {
+		t.Error("badge")
+		return
+	}
+}
+
+func TestLoadPreview(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "preview")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "preview.html")
+	ioutil.WriteFile(file, []byte(`{{badge "running"}}`), os.ModePerm)
+	discover := NewDiscover()
+	discover.PreviewFile = file
+	preview, err := discover.LoadPreview()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	preview.Execute(buf, nil)
+	if buf.String() != "success" {
+		t.Error(buf.String())
+		return
+	}
+	ioutil.WriteFile(file, []byte(`{{upper "x"}}`), os.ModePerm)
+	os.Chtimes(file, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	preview, _ = discover.LoadPreview()
+	buf.Reset()
+	preview.Execute(buf, nil)
+	if buf.String() != "X" {
+		t.Error(buf.String())
+		return
+	}
+	ioutil.WriteFile(file, []byte(`{{xx}}`), os.ModePerm)
+	os.Chtimes(file, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute))
+	if preview, err = discover.LoadPreview(); err == nil || preview == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestPreviewDir(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "preview")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "static"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(`index{{template "footer.html"}}`), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "about.html"), []byte(`about`), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "footer.html"), []byte(`-footer`), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "static", "app.css"), []byte(`body{}`), os.ModePerm)
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.PreviewFile = dir
+	for path, expect := range map[string]string{
+		"/":                "index-footer",
+		"/about":           "about",
+		"/_static/app.css": "body{}",
+		"/none":            "404 page not found\n",
+	} {
+		req := httptest.NewRequest("GET", "http://pdsrv"+path, nil)
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		if res.Body.String() != expect {
+			t.Errorf("%v->%v", path, res.Body.String())
+			return
+		}
+	}
+}
+
+func TestCatalogGroup(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	for _, service := range []*Container{{Name: "a", Version: "v1"}, {Name: "a", Version: "v2"}, {Name: "b", Version: "v1"}} {
+		host := service.Version + "." + service.Name
+		service.Forwards = map[string]*Forward{host: {Name: "web", Prefix: host}}
+		discover.proxyAll[host] = service
+	}
+	req := httptest.NewRequest("GET", "http://pdsrv/", nil)
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	body := res.Body.String()
+	if !strings.Contains(body, "Having 2 services, 3 hosts") || !strings.Contains(body, "<details open><summary>a (2 versions, 2 hosts)</summary>") {
+		t.Error(body)
+		return
+	}
+	dir, _ := ioutil.TempDir("", "preview")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "preview.html")
+	ioutil.WriteFile(file, []byte(`{{range .Groups}}{{.Name}}:{{.Count}}:{{len .Versions}},{{end}}`), os.ModePerm)
+	discover.PreviewFile = file
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Body.String() != "a:2:2,b:1:1," {
+		t.Error(res.Body.String())
+		return
+	}
+}
@@ -0,0 +1,298 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/codingeasygo/util/debug"
+	"github.com/codingeasygo/util/xmap"
+)
+
+// ProbeResult is the result of one synthetic probe
+type ProbeResult struct {
+	Status  int           `json:"status"`
+	Latency time.Duration `json:"latency"`
+	Success bool          `json:"success"`
+	Error   string        `json:"error,omitempty"`
+	At      time.Time     `json:"at"`
+}
+
+// ProbeStats is the synthetic probe statistics of forward, the Uptime is the success ratio of last probeHistory results
+type ProbeStats struct {
+	Host     string        `json:"host"`
+	Name     string        `json:"name"`
+	Version  string        `json:"version"`
+	Path     string        `json:"path"`
+	Expected int           `json:"expected"`
+	SLO      time.Duration `json:"slo,omitempty"`
+	Total    int64         `json:"total"`
+	Failure  int64         `json:"failure"`
+	Failures int           `json:"failures"`
+	Uptime   float64       `json:"uptime"`
+	Failing  bool          `json:"failing"`
+	Last     *ProbeResult  `json:"last,omitempty"`
+	history  []bool
+}
+
+// probeHistory is the result count to calculate Uptime
+const probeHistory = 100
+
+// probeWriter is the in-memory response writer of probe request, the body is discarded
+type probeWriter struct {
+	header http.Header
+	status int
+}
+
+func (p *probeWriter) Header() http.Header {
+	return p.header
+}
+
+func (p *probeWriter) Write(data []byte) (int, error) {
+	if p.status < 1 {
+		p.status = http.StatusOK
+	}
+	return len(data), nil
+}
+
+func (p *probeWriter) WriteHeader(status int) {
+	if p.status < 1 {
+		p.status = status
+	}
+}
+
+// Probe will issue the synthetic request to host through the proxy path, the probe is failed when status is not expected or
+// latency is over slo
+func (d *Discover) Probe(host string, forward *Forward) (result *ProbeResult) {
+	expected := forward.ProbeStatus
+	if expected < 1 {
+		expected = http.StatusOK
+	}
+	result = &ProbeResult{At: time.Now()}
+	ctx, cancel := context.WithTimeout(context.Background(), d.ProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%v%v", host, forward.ProbePath), nil)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	req.Header.Set("User-Agent", "pdservice-probe")
+	w := &probeWriter{header: http.Header{}}
+	d.ServeHTTP(w, req)
+	result.Latency = time.Since(result.At)
+	result.Status = w.status
+	if result.Status < 1 {
+		result.Status = http.StatusOK
+	}
+	switch {
+	case ctx.Err() != nil:
+		result.Error = fmt.Sprintf("timeout after %v", d.ProbeTimeout)
+	case result.Status != expected:
+		result.Error = fmt.Sprintf("status %v is not expected %v", result.Status, expected)
+	case forward.ProbeSLO > 0 && result.Latency > forward.ProbeSLO:
+		result.Error = fmt.Sprintf("latency %v is over slo %v", result.Latency, forward.ProbeSLO)
+	default:
+		result.Success = true
+	}
+	return
+}
+
+// callProbe will probe all http forward which has probe path by label PD_PROBE_PATH, the forward is failing after
+// ProbeThreshold consecutive failures, which is notified by PD_HOOK_PROBE label webhook and ProbeHook
+func (d *Discover) callProbe() {
+	defer func() {
+		if xerr := recover(); xerr != nil {
+			ErrorLog("Discover call probe panic with %v, call stack is:\n%v", xerr, debug.CallStatck())
+		}
+	}()
+	type probeTarget struct {
+		Host    string
+		Forward *Forward
+		Service *Container
+	}
+	targets := map[string]*probeTarget{}
+	d.proxyLock.RLock()
+	for prefix, service := range d.proxyAll {
+		forward := service.Forwards[prefix]
+		if forward == nil || forward.Type != "http" || len(forward.ProbePath) < 1 {
+			continue
+		}
+		host := d.hostOf(forward.Tenant, prefix)
+		targets[host] = &probeTarget{Host: host, Forward: forward, Service: service}
+	}
+	d.proxyLock.RUnlock()
+	results := map[string]*ProbeResult{}
+	resultLock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for host, target := range targets {
+		wg.Add(1)
+		go func(host string, target *probeTarget) {
+			defer wg.Done()
+			result := d.Probe(host, target.Forward)
+			resultLock.Lock()
+			results[host] = result
+			resultLock.Unlock()
+		}(host, target)
+	}
+	wg.Wait()
+	changed := []ProbeStats{}
+	d.probeLock.Lock()
+	if d.probeAll == nil {
+		d.probeAll = map[string]*ProbeStats{}
+	}
+	for host := range d.probeAll {
+		if targets[host] == nil {
+			delete(d.probeAll, host)
+		}
+	}
+	for host, target := range targets {
+		result := results[host]
+		stats := d.probeAll[host]
+		if stats == nil || stats.Version != target.Service.Version {
+			stats = &ProbeStats{Host: host}
+			d.probeAll[host] = stats
+		}
+		stats.Name, stats.Version, stats.Path, stats.SLO = target.Service.Name, target.Service.Version, target.Forward.ProbePath, target.Forward.ProbeSLO
+		stats.Expected = target.Forward.ProbeStatus
+		if stats.Expected < 1 {
+			stats.Expected = http.StatusOK
+		}
+		stats.Total++
+		stats.Last = result
+		stats.history = append(stats.history, result.Success)
+		if len(stats.history) > probeHistory {
+			stats.history = stats.history[len(stats.history)-probeHistory:]
+		}
+		success := 0
+		for _, ok := range stats.history {
+			if ok {
+				success++
+			}
+		}
+		stats.Uptime = float64(success) / float64(len(stats.history))
+		if result.Success {
+			stats.Failures = 0
+			if stats.Failing {
+				stats.Failing = false
+				changed = append(changed, *stats)
+			}
+		} else {
+			stats.Failure++
+			stats.Failures++
+			if !stats.Failing && stats.Failures >= d.ProbeThreshold {
+				stats.Failing = true
+				changed = append(changed, *stats)
+			}
+		}
+		if result.Success {
+			d.StatsD.Count("probe", 1, "host:"+host, "result:success")
+		} else {
+			d.StatsD.Count("probe", 1, "host:"+host, "result:failure")
+			DebugLog("Discover probe %v%v fail with %v", host, stats.Path, result.Error)
+		}
+		d.StatsD.Timing("probe.duration", result.Latency, "host:"+host)
+	}
+	d.probeLock.Unlock()
+	for _, stats := range changed {
+		if stats.Failing {
+			WarnLog("Discover probe %v%v is failing by %v consecutive failures, last is %v", stats.Host, stats.Path, stats.Failures, stats.Last.Error)
+		} else {
+			InfoLog("Discover probe %v%v is recovered", stats.Host, stats.Path)
+		}
+		d.notifyProbe(targets[stats.Host].Service, stats)
+	}
+}
+
+// notifyProbe will call the probe webhook of container and ProbeHook
+func (d *Discover) notifyProbe(service *Container, stats ProbeStats) {
+	info := xmap.M{
+		"event":    "probe",
+		"id":       service.ID,
+		"name":     service.Name,
+		"version":  service.Version,
+		"host":     stats.Host,
+		"path":     stats.Path,
+		"failing":  stats.Failing,
+		"failures": stats.Failures,
+		"uptime":   stats.Uptime,
+	}
+	if stats.Last != nil {
+		info["status"] = stats.Last.Status
+		info["latency"] = stats.Last.Latency.String()
+		info["error"] = stats.Last.Error
+	}
+	data, _ := json.Marshal(info)
+	for _, uri := range []string{service.Hooks["probe"], d.ProbeHook} {
+		if len(uri) > 0 {
+			go d.callHook(service, "probe", uri, data)
+		}
+	}
+}
+
+// probeFailing will check if any forward probe of service is failing
+func (d *Discover) probeFailing(service *Container) bool {
+	d.probeLock.Lock()
+	defer d.probeLock.Unlock()
+	for _, stats := range d.probeAll {
+		if stats.Failing && stats.Last != nil && stats.Name == service.Name && stats.Version == service.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// ProbeStats will return the probe statistics of all probed forward, sorted by host
+func (d *Discover) ProbeStats() (all []ProbeStats) {
+	all = []ProbeStats{}
+	d.probeLock.Lock()
+	for _, stats := range d.probeAll {
+		all = append(all, *stats)
+	}
+	d.probeLock.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].Host < all[j].Host })
+	return
+}
+
+func (d *Discover) runProbe() {
+	probeTicker := time.NewTicker(d.ProbeInterval)
+	defer probeTicker.Stop()
+	for d.refreshing {
+		<-probeTicker.C
+		if d.IsPaused() {
+			continue
+		}
+		d.callProbe()
+	}
+}
+
+// writeProbeMetrics will write the probe statistics by prometheus text format
+func (d *Discover) writeProbeMetrics(w io.Writer) {
+	all := d.ProbeStats()
+	fmt.Fprintf(w, "# HELP pdservice_probe_success Whether the last synthetic probe is success.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_probe_success gauge\n")
+	for _, stats := range all {
+		success := 0
+		if stats.Last != nil && stats.Last.Success {
+			success = 1
+		}
+		fmt.Fprintf(w, "pdservice_probe_success{host=%q,service=%q} %v\n", stats.Host, stats.Name, success)
+	}
+	fmt.Fprintf(w, "# HELP pdservice_probe_latency_seconds The latency of last synthetic probe.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_probe_latency_seconds gauge\n")
+	for _, stats := range all {
+		if stats.Last != nil {
+			fmt.Fprintf(w, "pdservice_probe_latency_seconds{host=%q,service=%q} %v\n", stats.Host, stats.Name, stats.Last.Latency.Seconds())
+		}
+	}
+	fmt.Fprintf(w, "# HELP pdservice_probe_uptime_ratio The success ratio of recent synthetic probes.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_probe_uptime_ratio gauge\n")
+	for _, stats := range all {
+		fmt.Fprintf(w, "pdservice_probe_uptime_ratio{host=%q,service=%q} %v\n", stats.Host, stats.Name, stats.Uptime)
+	}
+}
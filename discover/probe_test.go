@@ -0,0 +1,121 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingeasygo/util/converter"
+)
+
+func TestProbe(t *testing.T) {
+	events := make(chan map[string]interface{}, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		info := map[string]interface{}{}
+		json.Unmarshal(data, &info)
+		events <- info
+	}))
+	defer hook.Close()
+	status := http.StatusOK
+	delay := time.Duration(0)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		time.Sleep(delay)
+		w.WriteHeader(status)
+	}))
+	defer backend.Close()
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.ProbeThreshold = 2
+	discover.ProbeHook = hook.URL
+	forward := &Forward{Name: "web", Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://"), ProbePath: "/health", ProbeSLO: 50 * time.Millisecond}
+	service := &Container{ID: "c1", Name: "ds", Version: "1.0.0", Forwards: map[string]*Forward{"v100.ds": forward}}
+	proxy, _ := discover.newReverseProxy(forward)
+	discover.proxyReverse["v100.ds.test.loc"] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: service}
+	discover.proxyAll["v100.ds"] = service
+	//success
+	discover.callProbe()
+	stats := discover.ProbeStats()
+	if len(stats) != 1 || stats[0].Host != "v100.ds.test.loc" || !stats[0].Last.Success || stats[0].Uptime != 1 || stats[0].Expected != http.StatusOK {
+		t.Error(converter.JSON(stats))
+		return
+	}
+	//unexpected status
+	status = http.StatusInternalServerError
+	discover.callProbe()
+	if stats = discover.ProbeStats(); stats[0].Last.Success || stats[0].Last.Status != http.StatusInternalServerError || stats[0].Failing || !discover.checkHealthy(service) {
+		t.Error(converter.JSON(stats))
+		return
+	}
+	//over slo and failing
+	status, delay = http.StatusOK, 100*time.Millisecond
+	discover.callProbe()
+	if stats = discover.ProbeStats(); stats[0].Last.Success || !stats[0].Failing || stats[0].Uptime != 1.0/3 || discover.checkHealthy(service) {
+		t.Error(converter.JSON(stats))
+		return
+	}
+	select {
+	case info := <-events:
+		if info["event"] != "probe" || info["failing"] != true || info["host"] != "v100.ds.test.loc" {
+			t.Error(info)
+			return
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("not notified")
+		return
+	}
+	//recovered
+	delay = 0
+	discover.callProbe()
+	if stats = discover.ProbeStats(); !stats[0].Last.Success || stats[0].Failing || !discover.checkHealthy(service) {
+		t.Error(converter.JSON(stats))
+		return
+	}
+	select {
+	case info := <-events:
+		if info["failing"] != false {
+			t.Error(info)
+			return
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("not notified")
+		return
+	}
+	//metrics
+	buf := bytes.NewBuffer(nil)
+	discover.WriteMetrics(buf)
+	if !strings.Contains(buf.String(), `pdservice_probe_success{host="v100.ds.test.loc",service="ds"} 1`) {
+		t.Error(buf.String())
+		return
+	}
+	//timeout
+	discover.ProbeTimeout = 10 * time.Millisecond
+	delay = 100 * time.Millisecond
+	if result := discover.Probe("v100.ds.test.loc", forward); result.Success || !strings.Contains(result.Error, "timeout") {
+		t.Error(converter.JSON(result))
+		return
+	}
+	//removed
+	delete(discover.proxyAll, "v100.ds")
+	discover.callProbe()
+	if stats = discover.ProbeStats(); len(stats) != 0 {
+		t.Error(converter.JSON(stats))
+		return
+	}
+	//label
+	labeled := &Container{Forwards: map[string]*Forward{"v100.ds": {Name: "web"}}}
+	applyForwardOptions(labeled, map[string]string{"PD_PROBE_PATH": "/health", "PD_PROBE_STATUS": "204", "PD_PROBE_SLO_web": "200ms"})
+	if f := labeled.Forwards["v100.ds"]; f.ProbePath != "/health" || f.ProbeStatus != 204 || f.ProbeSLO != 200*time.Millisecond {
+		t.Error(converter.JSON(f))
+		return
+	}
+}
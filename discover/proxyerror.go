@@ -0,0 +1,164 @@
+package discover
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	// ProxyErrorNotRunning is the proxy error when the container of forward is not running
+	ProxyErrorNotRunning = "not_running"
+	// ProxyErrorUnreachable is the proxy error when the port of forward is refused or not reachable
+	ProxyErrorUnreachable = "port_unreachable"
+	// ProxyErrorTimeout is the proxy error when dial or response of forward is timeout
+	ProxyErrorTimeout = "timeout"
+	// ProxyErrorTLS is the proxy error when the tls handshake or certificate verify to forward is fail
+	ProxyErrorTLS = "tls_error"
+	// ProxyErrorUnknown is the other proxy error
+	ProxyErrorUnknown = "unknown"
+)
+
+var proxyErrorMessages = map[string]string{
+	ProxyErrorNotRunning:  "the container of service is not running",
+	ProxyErrorUnreachable: "the port of service is not reachable",
+	ProxyErrorTimeout:     "the service is not responding in time",
+	ProxyErrorTLS:         "the tls connection to service is fail",
+	ProxyErrorUnknown:     "the service is not available",
+}
+
+// ProxyError is the diagnostic of fail proxy request, it is rendered by ErrorTemplate or json when client accept json
+type ProxyError struct {
+	Code           int    `json:"code"`
+	Kind           string `json:"kind"`
+	Message        string `json:"message"`
+	Host           string `json:"host"`
+	Path           string `json:"path"`
+	Name           string `json:"name,omitempty"`
+	Version        string `json:"version,omitempty"`
+	Status         string `json:"status,omitempty"`
+	StateChangedAt string `json:"state_changed_at,omitempty"`
+}
+
+// DefaultErrorTemplate is the default diagnostic page of fail proxy request
+var DefaultErrorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Code}} {{.Message}}</title></head>
+<body style="font-family:sans-serif;margin:40px">
+<h2>{{.Code}} {{.Message}}</h2>
+<table>
+<tr><td>Host</td><td>{{.Host}}{{.Path}}</td></tr>
+<tr><td>Reason</td><td>{{.Kind}}</td></tr>
+{{if .Name}}<tr><td>Service</td><td>{{.Name}}-{{.Version}}</td></tr>
+<tr><td>Status</td><td>{{.Status}}</td></tr>
+<tr><td>Last Changed</td><td>{{.StateChangedAt}}</td></tr>{{end}}
+</table>
+<p><small>pdservice</small></p>
+</body>
+</html>
+`))
+
+// ClassifyProxyError will return the kind of proxy error by error and container of forward
+func ClassifyProxyError(err error, service *Container) string {
+	var netErr net.Error
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr), errors.As(err, &invalidErr), errors.As(err, &recordErr),
+		strings.Contains(err.Error(), "tls:"), strings.Contains(err.Error(), "x509:"):
+		return ProxyErrorTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ProxyErrorTimeout
+	case service != nil && len(service.Status) > 0 && service.Status != "running":
+		return ProxyErrorNotRunning
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return ProxyErrorUnreachable
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return ProxyErrorUnreachable
+	}
+	return ProxyErrorUnknown
+}
+
+// clientBody will record the read error of request body, so the timeout of reading client is not reported as upstream timeout
+type clientBody struct {
+	io.ReadCloser
+	err  error
+	lock sync.Mutex
+}
+
+func (c *clientBody) Read(p []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		c.lock.Lock()
+		c.err = err
+		c.lock.Unlock()
+	}
+	return
+}
+
+// isClientTimeout will check if the proxy request is fail by timeout of reading request body from client
+func isClientTimeout(r *http.Request) bool {
+	body, ok := r.Body.(*clientBody)
+	if !ok {
+		return false
+	}
+	body.lock.Lock()
+	err := body.err
+	body.lock.Unlock()
+	var netErr net.Error
+	return err != nil && (errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// forwardService will return the container of forward which is proxied now
+func (d *Discover) forwardService(forward *Forward) (service *Container) {
+	d.proxyLock.RLock()
+	service = d.proxyAll[forward.Prefix]
+	d.proxyLock.RUnlock()
+	return
+}
+
+// procProxyFailure will render the diagnostic of fail proxy request by json or ErrorTemplate
+func (d *Discover) procProxyFailure(w http.ResponseWriter, r *http.Request, forward *Forward, code int, err error) {
+	service := d.forwardService(forward)
+	info := &ProxyError{
+		Code: code,
+		Kind: ClassifyProxyError(err, service),
+		Host: d.hostOf(forward.Tenant, forward.Prefix),
+		Path: r.URL.Path,
+	}
+	info.Message = proxyErrorMessages[info.Kind]
+	if service != nil {
+		info.Name, info.Version, info.Status = service.Name, service.Version, service.Status
+		info.StateChangedAt = service.StartedAt
+		if service.Status != "running" && len(service.FinishedAt) > 0 {
+			info.StateChangedAt = service.FinishedAt
+		}
+	}
+	WarnLog("Discover proxy %v%v fail by %v with %v", info.Host, info.Path, info.Kind, err)
+	w.Header().Set("X-PD-Error", info.Kind)
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, code, info)
+		return
+	}
+	tmpl := d.ErrorTemplate
+	if tmpl == nil {
+		tmpl = DefaultErrorTemplate
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := tmpl.Execute(w, info); err != nil {
+		WarnLog("Discover render error template fail with %v", err)
+	}
+}
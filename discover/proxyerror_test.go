@@ -0,0 +1,120 @@
+package discover
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyProxyError(t *testing.T) {
+	running := &Container{Status: "running"}
+	exited := &Container{Status: "exited"}
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route")}
+	for i, c := range []struct {
+		Err     error
+		Service *Container
+		Kind    string
+	}{
+		{x509.UnknownAuthorityError{}, running, ProxyErrorTLS},
+		{errors.New("remote error: tls: bad certificate"), running, ProxyErrorTLS},
+		{context.DeadlineExceeded, running, ProxyErrorTimeout},
+		{fmt.Errorf("dial: %w", syscall.ECONNREFUSED), exited, ProxyErrorNotRunning},
+		{fmt.Errorf("dial: %w", syscall.ECONNREFUSED), running, ProxyErrorUnreachable},
+		{dialErr, nil, ProxyErrorUnreachable},
+		{errors.New("xx"), running, ProxyErrorUnknown},
+	} {
+		if kind := ClassifyProxyError(c.Err, c.Service); kind != c.Kind {
+			t.Errorf("%v: %v", i, kind)
+			return
+		}
+	}
+}
+
+func TestProxyError(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	forward := &Forward{Name: "web", Prefix: "v100.ds", Type: "http", URI: addr}
+	service := &Container{ID: "c1", Name: "ds", Version: "1.0.0", Status: "running", StartedAt: "2022-01-01T00:00:00Z", Forwards: map[string]*Forward{"v100.ds": forward}}
+	proxy, _ := discover.newReverseProxy(forward)
+	discover.proxyReverse["v100.ds.test.loc"] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: service}
+	discover.proxyAll["v100.ds"] = service
+	call := func(accept string) (res *httptest.ResponseRecorder) {
+		req := httptest.NewRequest("GET", "http://v100.ds.test.loc/abc", nil)
+		req.Header.Set("Accept", accept)
+		res = httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return
+	}
+	res := call("text/html")
+	if res.Code != http.StatusBadGateway || res.Header().Get("X-PD-Error") != ProxyErrorUnreachable || !strings.Contains(res.Body.String(), "ds-1.0.0") {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	service.Status, service.FinishedAt = "exited", "2022-01-02T00:00:00Z"
+	res = call("application/json")
+	info := &ProxyError{}
+	if err := json.Unmarshal(res.Body.Bytes(), info); err != nil || info.Kind != ProxyErrorNotRunning || info.Host != "v100.ds.test.loc" || info.Path != "/abc" ||
+		info.Version != "1.0.0" || info.StateChangedAt != "2022-01-02T00:00:00Z" {
+		t.Errorf("%v,%v", err, res.Body.String())
+		return
+	}
+	discover.ErrorTemplate = template.Must(template.New("x").Parse("brand {{.Kind}}"))
+	if res = call("text/html"); res.Body.String() != "brand not_running" {
+		t.Error(res.Body.String())
+		return
+	}
+}
+
+type timeoutReader struct{}
+
+func (timeoutReader) Read(p []byte) (int, error) {
+	return 0, &net.OpError{Op: "read", Net: "tcp", Err: context.DeadlineExceeded}
+}
+
+func TestProxyErrorTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	forward := &Forward{Name: "web", Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(ts.URL, "http://")}
+	service := &Container{ID: "c1", Name: "ds", Version: "1.0.0", Status: "running", Forwards: map[string]*Forward{"v100.ds": forward}}
+	proxy, _ := discover.newReverseProxy(forward)
+	proxy.Transport = &http.Transport{ResponseHeaderTimeout: 50 * time.Millisecond}
+	discover.proxyReverse["v100.ds.test.loc"] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: service}
+	discover.proxyAll["v100.ds"] = service
+	//upstream timeout
+	req := httptest.NewRequest("POST", "http://v100.ds.test.loc/abc", strings.NewReader("abc"))
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusGatewayTimeout || res.Header().Get("X-PD-Error") != ProxyErrorTimeout {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	//client body timeout
+	req = httptest.NewRequest("POST", "http://v100.ds.test.loc/abc", io.MultiReader(strings.NewReader("abc"), timeoutReader{}))
+	req.ContentLength = -1
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusRequestTimeout {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+}
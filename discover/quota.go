@@ -0,0 +1,114 @@
+package discover
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Quota is the limit of published forwards, tcp/udp ports and requests per second, the zero value is unlimited
+type Quota struct {
+	Forwards int
+	Ports    int
+	Rate     int
+}
+
+func (d *Discover) quotaOf(service *Container) (keys []string, quotas []*Quota) {
+	keys = append(keys, "service "+service.Tenant+"/"+service.Name)
+	quotas = append(quotas, d.ServiceQuota)
+	if tenant := d.Tenants[service.Tenant]; len(service.Tenant) > 0 && tenant != nil {
+		keys = append(keys, "tenant "+service.Tenant)
+		quotas = append(quotas, tenant.Quota)
+	}
+	return
+}
+
+// applyQuota will check forwards/ports quota of service and tenant, the forward which exceeds quota is removed from all on reject mode
+// or flagged on flag mode, the running forward is checked first to keep it when new forward is added. it must be called with proxyLock locked
+func (d *Discover) applyQuota(all, oldAll map[string]*Container) {
+	if d.quotaExceeded == nil {
+		d.quotaExceeded = map[string]string{}
+	}
+	prefixes := []string{}
+	for prefix := range all {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		_, oldI := oldAll[prefixes[i]]
+		_, oldJ := oldAll[prefixes[j]]
+		if oldI != oldJ {
+			return oldI
+		}
+		return prefixes[i] < prefixes[j]
+	})
+	exceededAll := map[string]string{}
+	forwards := map[string]int{}
+	ports := map[string]int{}
+	for _, prefix := range prefixes {
+		service := all[prefix]
+		forward := service.Forwards[prefix]
+		if forward == nil {
+			continue
+		}
+		port := forward.Type == "tcp" || forward.Type == "udp"
+		keys, quotas := d.quotaOf(service)
+		exceeded := ""
+		for i, quota := range quotas {
+			if quota == nil {
+				continue
+			}
+			if quota.Forwards > 0 && forwards[keys[i]] >= quota.Forwards {
+				exceeded = fmt.Sprintf("%v forwards quota %v is exceeded", keys[i], quota.Forwards)
+				break
+			}
+			if port && quota.Ports > 0 && ports[keys[i]] >= quota.Ports {
+				exceeded = fmt.Sprintf("%v ports quota %v is exceeded", keys[i], quota.Ports)
+				break
+			}
+		}
+		if len(exceeded) > 0 {
+			exceededAll[prefix] = exceeded
+			if d.quotaExceeded[prefix] != exceeded {
+				WarnLog("Discover %v forward %v by %v", d.QuotaMode, prefix, exceeded)
+			}
+			if d.QuotaMode != "flag" {
+				delete(all, prefix)
+				continue
+			}
+			service.Quota = exceeded
+		}
+		for _, key := range keys {
+			forwards[key]++
+			if port {
+				ports[key]++
+			}
+		}
+	}
+	d.quotaExceeded = exceededAll
+}
+
+// allowQuota will check request rate quota of service and tenant
+func (d *Discover) allowQuota(service *Container) bool {
+	keys, quotas := d.quotaOf(service)
+	d.quotaLock.Lock()
+	defer d.quotaLock.Unlock()
+	if d.quotaWindows == nil {
+		d.quotaWindows = map[string]*wafWindow{}
+	}
+	now := time.Now()
+	for i, quota := range quotas {
+		if quota == nil || quota.Rate < 1 {
+			continue
+		}
+		window := d.quotaWindows[keys[i]]
+		if window == nil || now.Sub(window.Start) >= time.Second {
+			window = &wafWindow{Start: now}
+			d.quotaWindows[keys[i]] = window
+		}
+		window.Count++
+		if window.Count > quota.Rate {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	discover := NewDiscover()
+	discover.ServiceQuota = &Quota{Forwards: 2, Ports: 1}
+	discover.Tenants["team-a"] = &Tenant{Name: "team-a", Quota: &Quota{Forwards: 1}}
+	newAll := func() map[string]*Container {
+		ds := &Container{Name: "ds", Forwards: map[string]*Forward{
+			"a.v100.ds":  {Prefix: "a.v100.ds", Type: "http"},
+			"b.v100.ds":  {Prefix: "b.v100.ds", Type: "http"},
+			"c.v100.ds":  {Prefix: "c.v100.ds", Type: "http"},
+			"tcp://:100": {Prefix: "tcp://:100", Type: "tcp"},
+		}}
+		ts := &Container{Name: "ts", Tenant: "team-a", Forwards: map[string]*Forward{
+			"v100.ts.team-a":   {Prefix: "v100.ts.team-a", Type: "http"},
+			"a.v100.ts.team-a": {Prefix: "a.v100.ts.team-a", Type: "http"},
+		}}
+		all := map[string]*Container{}
+		for _, service := range []*Container{ds, ts} {
+			for prefix := range service.Forwards {
+				all[prefix] = service
+			}
+		}
+		return all
+	}
+	all := newAll()
+	discover.applyQuota(all, map[string]*Container{"c.v100.ds": all["c.v100.ds"]})
+	if len(all) != 3 || all["c.v100.ds"] == nil || all["a.v100.ds"] == nil || all["a.v100.ts.team-a"] == nil {
+		t.Error(all)
+		return
+	}
+	if len(discover.quotaExceeded) != 3 {
+		t.Error(discover.quotaExceeded)
+		return
+	}
+	discover.ServiceQuota = &Quota{Ports: 1}
+	all = newAll()
+	discover.applyQuota(all, nil)
+	if len(all) != 5 || all["tcp://:100"] == nil {
+		t.Error(all)
+		return
+	}
+	discover.QuotaMode = "flag"
+	all = newAll()
+	discover.applyQuota(all, nil)
+	if len(all) != 6 || all["v100.ts.team-a"].Quota != "tenant team-a forwards quota 1 is exceeded" {
+		t.Error(all)
+		return
+	}
+	//rate
+	discover.ServiceQuota = &Quota{Rate: 2}
+	service := &Container{Name: "ds"}
+	if !discover.allowQuota(service) || !discover.allowQuota(service) || discover.allowQuota(service) {
+		t.Error("rate")
+		return
+	}
+	if !discover.allowQuota(&Container{Name: "ds2"}) {
+		t.Error("rate")
+		return
+	}
+	forward := &Forward{Prefix: "v100.ds", Type: "http"}
+	discover.HostSuff = ".test.loc"
+	discover.proxyReverse["v100.ds.test.loc"] = &ReverseProxy{Forward: forward, Service: service}
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://v100.ds.test.loc/", nil))
+	if res.Code != http.StatusTooManyRequests {
+		t.Error(res.Code)
+		return
+	}
+}
@@ -0,0 +1,137 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// RoleViewer can view status/services/catalog/metrics and docker ps
+	RoleViewer = "viewer"
+	// RoleOperator can view and show logs, restart, refresh and control container by /_s
+	RoleOperator = "operator"
+	// RoleAdministrator can do all operation include pause/resume/readonly
+	RoleAdministrator = "admin"
+)
+
+// rolePermissions is the minimal role of admin api path and /_s path
+var rolePermissions = map[string]string{
+	"status":         RoleViewer,
+	"services":       RoleViewer,
+	"catalog":        RoleViewer,
+	"triggers":       RoleViewer,
+	"flapping":       RoleViewer,
+	"probes":         RoleViewer,
+	"conflicts":      RoleViewer,
+	"resources":      RoleViewer,
+	"lint":           RoleViewer,
+	"collisions":     RoleViewer,
+	"compose":        RoleViewer,
+	"agents":         RoleViewer,
+	"xds":            RoleViewer,
+	"config":         RoleAdministrator,
+	"latency":        RoleViewer,
+	"captures":       RoleOperator,
+	"capture/replay": RoleOperator,
+	"tap":            RoleOperator,
+	"metrics":        RoleViewer,
+	"export/hosts":   RoleViewer,
+	"export/dnsmasq": RoleViewer,
+	"export/unbound": RoleViewer,
+	"sd/prometheus":  RoleViewer,
+	"login":          RoleViewer,
+	"logout":         RoleViewer,
+	"sessions":       RoleAdministrator,
+	"session/revoke": RoleAdministrator,
+	"loglevel":       RoleAdministrator,
+	"logs":           RoleOperator,
+	"restart":        RoleOperator,
+	"refresh":        RoleOperator,
+	"pause":          RoleAdministrator,
+	"resume":         RoleAdministrator,
+	"readonly":       RoleAdministrator,
+	"upgrade":        RoleAdministrator,
+	"docker/ps":      RoleViewer,
+	"docker/logs":    RoleOperator,
+	"docker/start":   RoleOperator,
+	"docker/stop":    RoleOperator,
+	"docker/restart": RoleOperator,
+}
+
+func roleLevel(role string) int {
+	switch role {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdministrator:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// ValidRole will check if role is viewer/operator/admin
+func ValidRole(role string) bool {
+	return roleLevel(role) > 0
+}
+
+// roleAllow will check if role can access the admin api path or /_s path, the unknown path is only allowed by admin
+func roleAllow(role, path string) bool {
+	need, ok := rolePermissions[path]
+	if !ok {
+		need = RoleAdministrator
+	}
+	return roleLevel(role) >= roleLevel(need)
+}
+
+// ParseRoleTokens will parse the admin api tokens with role by token=role, the token can be hashed or secret reference
+func ParseRoleTokens(tokens []string) (parsed map[string]string, err error) {
+	parsed = map[string]string{}
+	for _, token := range tokens {
+		i := strings.LastIndex(token, "=")
+		if i < 1 || !ValidRole(token[i+1:]) {
+			err = fmt.Errorf("invalid role token, must be token=viewer|operator|admin")
+			return
+		}
+		parsed[token[:i]] = token[i+1:]
+	}
+	return
+}
+
+// tokenRole will return the role of admin api token by AdminToken and RoleTokens
+func (d *Discover) tokenRole(token string) (role string) {
+	if len(token) < 1 {
+		return
+	}
+	if VerifyToken(d.AdminToken, token) {
+		role = RoleAdministrator
+		return
+	}
+	for expected, r := range d.RoleTokens {
+		if roleLevel(r) > roleLevel(role) && VerifyToken(expected, token) {
+			role = r
+		}
+	}
+	return
+}
+
+// adminRole will return the tenant and role of admin api request by session token, token, tenant token or LDAP,
+// the tenant token is operator of tenant services and the nil tenant can access all services
+func (d *Discover) adminRole(r *http.Request) (tenant *Tenant, role string) {
+	token := d.adminToken(r)
+	if isSessionToken(token) {
+		tenant, role, _ = d.sessionRole(token)
+		return
+	}
+	if role = d.tokenRole(token); len(role) > 0 {
+		return
+	}
+	if t, ok := d.adminTenant(token); ok && t != nil {
+		tenant, role = t, RoleOperator
+		return
+	}
+	role = d.ldapRole(r)
+	return
+}
@@ -0,0 +1,86 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRBAC(t *testing.T) {
+	tokens, err := ParseRoleTokens([]string{"v1=viewer", HashToken("o1") + "=operator"})
+	if err != nil || len(tokens) != 2 {
+		t.Error(err, tokens)
+		return
+	}
+	for _, token := range []string{"v1", "v1=xx", "=viewer"} {
+		if _, err = ParseRoleTokens([]string{token}); err == nil {
+			t.Error(token)
+			return
+		}
+	}
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.AdminToken = "a1"
+	discover.RoleTokens = tokens
+	call := func(method, path, token string) int {
+		req := httptest.NewRequest(method, "http://pdsrv"+path, nil)
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return res.Code
+	}
+	cases := []struct {
+		Method string
+		Path   string
+		Token  string
+		Code   int
+	}{
+		{"GET", "/_api/status", "", http.StatusUnauthorized},
+		{"GET", "/_api/status", "xx", http.StatusUnauthorized},
+		{"GET", "/_api/status", "v1", http.StatusOK},
+		{"GET", "/_api/services", "v1", http.StatusOK},
+		{"POST", "/_api/refresh", "v1", http.StatusForbidden},
+		{"GET", "/_api/restart", "v1", http.StatusForbidden},
+		{"GET", "/_api/restart", "o1", http.StatusMethodNotAllowed},
+		{"POST", "/_api/pause", "o1", http.StatusForbidden},
+		{"GET", "/_api/xx", "o1", http.StatusForbidden},
+		{"GET", "/_api/xx", "a1", http.StatusNotFound},
+		{"POST", "/_api/pause", "a1", http.StatusOK},
+		{"POST", "/_api/resume", "a1", http.StatusOK},
+	}
+	for _, c := range cases {
+		if code := call(c.Method, c.Path, c.Token); code != c.Code {
+			t.Error(c.Method, c.Path, c.Token, code)
+			return
+		}
+	}
+	//service role
+	service := &Container{Name: "ds", Token: "abc", Role: RoleViewer}
+	discover.proxyReverse["v100.ds"] = &ReverseProxy{Forward: &Forward{Prefix: "v100.ds"}, Service: service}
+	callServer := func(path string) int {
+		req := httptest.NewRequest("GET", "http://v100.ds/_s/"+path, nil)
+		req.SetBasicAuth("ds", "abc")
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return res.Code
+	}
+	if code := callServer("docker/restart"); code != http.StatusForbidden {
+		t.Error(code)
+		return
+	}
+	if code := callServer("docker/logs"); code != http.StatusForbidden {
+		t.Error(code)
+		return
+	}
+	service.Role = ""
+	if code := callServer("xx"); code != http.StatusNotFound {
+		t.Error(code)
+		return
+	}
+	if !roleAllow(RoleOperator, "docker/restart") || roleAllow(RoleViewer, "logs") || roleAllow("", "status") {
+		t.Error("role allow error")
+		return
+	}
+}
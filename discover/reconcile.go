@@ -0,0 +1,86 @@
+package discover
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// ListenConflict is the tcp/udp/unix forward which can't be listened because the address is already bound,
+// it is usually bound by previous crashed pdservice or other process
+type ListenConflict struct {
+	Prefix  string    `json:"prefix"`
+	Type    string    `json:"type"`
+	Address string    `json:"address"`
+	Name    string    `json:"name"`
+	Version string    `json:"version"`
+	Error   string    `json:"error"`
+	Since   time.Time `json:"since"`
+}
+
+// IsAddrInUse will return if the listen error is caused by address already in use
+func IsAddrInUse(err error) bool {
+	return err != nil && errors.Is(err, syscall.EADDRINUSE)
+}
+
+// addConflict will record the listen conflict of forward, it must be called with proxyLock
+func (d *Discover) addConflict(conflicts map[string]*ListenConflict, forward *Forward, service *Container, err error) {
+	conflict := &ListenConflict{
+		Prefix:  forward.Prefix,
+		Type:    forward.Type,
+		Address: forward.Key,
+		Name:    service.Name,
+		Version: service.Version,
+		Error:   err.Error(),
+		Since:   time.Now(),
+	}
+	if old := d.listenConflicts[forward.Prefix]; old != nil && old.Address == conflict.Address {
+		conflict.Since = old.Since
+	} else {
+		ErrorLog("Discover forward %v://%v of %v-%v can't listen on %v, the address is already in use by previous crashed pdservice or other process", forward.Type, forward.Prefix, service.Name, service.Version, forward.Key)
+	}
+	conflicts[forward.Prefix] = conflict
+}
+
+// ListenConflicts will return the current listen conflicts sorted by prefix
+func (d *Discover) ListenConflicts() (conflicts []*ListenConflict) {
+	conflicts = []*ListenConflict{}
+	d.proxyLock.RLock()
+	for _, conflict := range d.listenConflicts {
+		conflicts = append(conflicts, conflict)
+	}
+	d.proxyLock.RUnlock()
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Prefix < conflicts[j].Prefix
+	})
+	return
+}
+
+// Reconcile will run the refresh cycle synchronously to populate the proxy table on startup, and report the listen conflicts
+func (d *Discover) Reconcile(onAdded, onRemoved, onUpdated string) (err error) {
+	begin := time.Now()
+	_, _, _, err = d.callCycle(onAdded, onRemoved, onUpdated)
+	if err != nil {
+		return
+	}
+	d.proxyLock.RLock()
+	services, listens := len(d.proxyAll), len(d.proxyListen)
+	d.proxyLock.RUnlock()
+	conflicts := d.ListenConflicts()
+	InfoLog("Discover startup reconcile is done by %v services, %v listeners, %v conflicts in %v", services, listens, len(conflicts), time.Since(begin))
+	if len(conflicts) > 0 {
+		err = fmt.Errorf("%v forwards can't listen by address already in use", len(conflicts))
+	}
+	return
+}
+
+func (d *Discover) writeConflictMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP pdservice_listen_conflict Whether the forward address is already in use by other process.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_listen_conflict gauge\n")
+	for _, conflict := range d.ListenConflicts() {
+		fmt.Fprintf(w, "pdservice_listen_conflict{prefix=%q,address=%q,service=%q} 1\n", conflict.Prefix, conflict.Address, conflict.Name)
+	}
+}
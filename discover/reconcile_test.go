@@ -0,0 +1,93 @@
+package discover
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingeasygo/util/converter"
+)
+
+func TestListenConflict(t *testing.T) {
+	used, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer used.Close()
+	_, err := Listen("tcp", used.Addr().String(), false)
+	if !IsAddrInUse(err) || IsAddrInUse(nil) || IsAddrInUse(errors.New("xx")) {
+		t.Error(err)
+		return
+	}
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.AdminToken = "123"
+	forward := &Forward{Name: "db", Prefix: "tcp://" + used.Addr().String(), Type: "tcp", Key: used.Addr().String()}
+	service := &Container{Name: "db", Version: "1.0.0"}
+	conflicts := map[string]*ListenConflict{}
+	discover.addConflict(conflicts, forward, service, err)
+	discover.listenConflicts = conflicts
+	since := conflicts[forward.Prefix].Since
+	time.Sleep(time.Millisecond)
+	conflicts = map[string]*ListenConflict{}
+	discover.addConflict(conflicts, forward, service, err)
+	discover.listenConflicts = conflicts
+	list := discover.ListenConflicts()
+	if len(list) != 1 || list[0].Address != used.Addr().String() || !list[0].Since.Equal(since) {
+		t.Error(converter.JSON(list))
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	discover.WriteMetrics(buf)
+	if !strings.Contains(buf.String(), `pdservice_listen_conflict{prefix="tcp://`) {
+		t.Error(buf.String())
+		return
+	}
+	req := httptest.NewRequest("GET", "http://pdsrv/_api/conflicts", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), used.Addr().String()) {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "socket")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "x.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//still accepted
+	removeStaleSocket(path)
+	if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := Listen("unix", path, false); !IsAddrInUse(err) {
+		t.Error(err)
+		return
+	}
+	//stale
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+		return
+	}
+	ln, err = Listen("unix", path, false)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ln.Close()
+}
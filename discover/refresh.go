@@ -0,0 +1,102 @@
+package discover
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// RefreshStats is the statistics of refresh cycles, the tick is skipped when previous cycle is still running
+type RefreshStats struct {
+	Runs         int64         `json:"runs"`
+	Skipped      int64         `json:"skipped"`
+	Running      bool          `json:"running"`
+	Duration     time.Duration `json:"duration"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastAt       time.Time     `json:"last_at"`
+}
+
+// beginCycle will mark the refresh cycle is running, it must be called with cycleLock
+func (d *Discover) beginCycle() (begin time.Time) {
+	begin = time.Now()
+	d.refreshStatsLock.Lock()
+	d.refreshStats.Running = true
+	d.refreshStatsLock.Unlock()
+	return
+}
+
+// endCycle will record the duration of refresh cycle
+func (d *Discover) endCycle(begin time.Time) {
+	used := time.Since(begin)
+	d.refreshStatsLock.Lock()
+	d.refreshStats.Running = false
+	d.refreshStats.Runs++
+	d.refreshStats.Duration += used
+	d.refreshStats.LastDuration = used
+	d.refreshStats.LastAt = time.Now()
+	d.refreshStatsLock.Unlock()
+	d.StatsD.Timing("cycle.duration", used)
+}
+
+// skipCycle will return true and count the skipped tick when the refresh cycle is still running
+func (d *Discover) skipCycle() (skipped bool) {
+	d.refreshStatsLock.Lock()
+	skipped = d.refreshStats.Running
+	if skipped {
+		d.refreshStats.Skipped++
+	}
+	d.refreshStatsLock.Unlock()
+	if skipped {
+		d.StatsD.Count("refresh.skipped", 1)
+		WarnLog("Discover refresh tick is skipped by previous cycle still running")
+	}
+	return
+}
+
+// drainTicks will skip the ticks which are fired while the refresh cycle is running, so the slow cycles are not run back to back
+func (d *Discover) drainTicks(ticks <-chan time.Time) {
+	for {
+		select {
+		case <-ticks:
+			d.refreshStatsLock.Lock()
+			d.refreshStats.Skipped++
+			d.refreshStatsLock.Unlock()
+			d.StatsD.Count("refresh.skipped", 1)
+			WarnLog("Discover refresh tick is skipped by slow cycle")
+		default:
+			return
+		}
+	}
+}
+
+// RefreshStats will return the copy of refresh cycle statistics
+func (d *Discover) RefreshStats() (stats RefreshStats) {
+	d.refreshStatsLock.Lock()
+	stats = d.refreshStats
+	d.refreshStatsLock.Unlock()
+	return
+}
+
+func (d *Discover) writeRefreshMetrics(w io.Writer) {
+	stats := d.RefreshStats()
+	running := 0
+	if stats.Running {
+		running = 1
+	}
+	fmt.Fprintf(w, "# HELP pdservice_refresh_runs_total The total number of refresh cycles.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_refresh_runs_total counter\n")
+	fmt.Fprintf(w, "pdservice_refresh_runs_total %v\n", stats.Runs)
+	fmt.Fprintf(w, "# HELP pdservice_refresh_skipped_total The total number of refresh ticks skipped by previous cycle still running.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_refresh_skipped_total counter\n")
+	fmt.Fprintf(w, "pdservice_refresh_skipped_total %v\n", stats.Skipped)
+	fmt.Fprintf(w, "# HELP pdservice_refresh_duration_seconds The duration of refresh cycles.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_refresh_duration_seconds summary\n")
+	fmt.Fprintf(w, "pdservice_refresh_duration_seconds_sum %v\n", stats.Duration.Seconds())
+	fmt.Fprintf(w, "pdservice_refresh_duration_seconds_count %v\n", stats.Runs)
+	fmt.Fprintf(w, "# HELP pdservice_refresh_last_duration_seconds The duration of last refresh cycle.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_refresh_last_duration_seconds gauge\n")
+	fmt.Fprintf(w, "pdservice_refresh_last_duration_seconds %v\n", stats.LastDuration.Seconds())
+	fmt.Fprintf(w, "# HELP pdservice_refresh_running Whether the refresh cycle is running.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_refresh_running gauge\n")
+	fmt.Fprintf(w, "pdservice_refresh_running %v\n", running)
+}
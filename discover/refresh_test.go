@@ -0,0 +1,43 @@
+package discover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRefreshSkip(t *testing.T) {
+	discover := NewDiscover()
+	if discover.skipCycle() {
+		t.Error("skipped")
+		return
+	}
+	begin := discover.beginCycle()
+	if !discover.skipCycle() || !discover.RefreshStats().Running {
+		t.Error("not skipped")
+		return
+	}
+	ticks := make(chan time.Time, 2)
+	ticks <- time.Now()
+	ticks <- time.Now()
+	discover.drainTicks(ticks)
+	discover.endCycle(begin)
+	stats := discover.RefreshStats()
+	if stats.Running || stats.Runs != 1 || stats.Skipped != 3 || len(ticks) != 0 || stats.LastAt.IsZero() {
+		t.Error(stats)
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	discover.WriteMetrics(buf)
+	for _, line := range []string{
+		`pdservice_refresh_runs_total 1`,
+		`pdservice_refresh_skipped_total 3`,
+		`pdservice_refresh_running 0`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("%v not in %v", line, buf.String())
+			return
+		}
+	}
+}
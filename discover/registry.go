@@ -0,0 +1,160 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Registry is the credential of docker registry, the credential is loaded from docker-credential-<Helper> when Helper is configured,
+// e.g. ecr-login for ECR and gcr for GCR
+type Registry struct {
+	Server   string
+	Username string
+	Password string
+	Helper   string
+}
+
+type dockerConfigAuth struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+type dockerConfig struct {
+	Auths       map[string]*dockerConfigAuth `json:"auths"`
+	CredHelpers map[string]string            `json:"credHelpers"`
+	CredsStore  string                       `json:"credsStore"`
+}
+
+var dockerHubServers = []string{"docker.io", "index.docker.io", "registry-1.docker.io", "https://index.docker.io/v1/"}
+
+// registryOf will return the registry server of image, docker.io is returned for image without registry
+func registryOf(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) < 2 || (!strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost") {
+		return "docker.io"
+	}
+	return parts[0]
+}
+
+func registryServers(server string) []string {
+	if server == "docker.io" {
+		return dockerHubServers
+	}
+	return []string{server, "https://" + server, "http://" + server}
+}
+
+// callCredentialHelper will get the credential of server by docker credential helper
+func (d *Discover) callCredentialHelper(helper, server string) (username, secret string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.HookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = bytes.NewBufferString(server)
+	out, err := cmd.Output()
+	if err != nil {
+		err = fmt.Errorf("call docker-credential-%v fail with %v", helper, err)
+		return
+	}
+	cred := struct {
+		Username string
+		Secret   string
+	}{}
+	if err = json.Unmarshal(out, &cred); err != nil {
+		return
+	}
+	username, secret = cred.Username, cred.Secret
+	return
+}
+
+func (d *Discover) loadConfigAuth(server string) (auth *types.AuthConfig, err error) {
+	data, err := ioutil.ReadFile(d.RegistryConfig)
+	if err != nil {
+		return
+	}
+	config := &dockerConfig{}
+	if err = json.Unmarshal(data, config); err != nil {
+		return
+	}
+	for _, key := range registryServers(server) {
+		helper := config.CredHelpers[key]
+		if len(helper) < 1 {
+			if conf := config.Auths[key]; conf != nil {
+				auth = &types.AuthConfig{Username: conf.Username, Password: conf.Password, IdentityToken: conf.IdentityToken, ServerAddress: key}
+				if len(conf.Auth) > 0 {
+					var decoded []byte
+					if decoded, err = base64.StdEncoding.DecodeString(conf.Auth); err != nil {
+						return
+					}
+					userpass := strings.SplitN(string(decoded), ":", 2)
+					if len(userpass) == 2 {
+						auth.Username, auth.Password = userpass[0], userpass[1]
+					}
+				}
+				return
+			}
+			continue
+		}
+		auth = &types.AuthConfig{ServerAddress: key}
+		auth.Username, auth.Password, err = d.callCredentialHelper(helper, key)
+		return
+	}
+	if len(config.CredsStore) > 0 {
+		auth = &types.AuthConfig{ServerAddress: registryServers(server)[0]}
+		auth.Username, auth.Password, err = d.callCredentialHelper(config.CredsStore, auth.ServerAddress)
+		if err != nil {
+			auth, err = nil, nil
+		}
+	}
+	return
+}
+
+// findRegistryAuth will find the credential of image from Registries or docker config.json on RegistryConfig
+func (d *Discover) findRegistryAuth(image string) (auth *types.AuthConfig, err error) {
+	server := registryOf(image)
+	for _, key := range registryServers(server) {
+		registry := d.Registries[key]
+		if registry == nil {
+			continue
+		}
+		auth = &types.AuthConfig{ServerAddress: key}
+		if len(registry.Helper) > 0 {
+			auth.Username, auth.Password, err = d.callCredentialHelper(registry.Helper, key)
+			return
+		}
+		if auth.Username, err = d.ResolveSecret(registry.Username); err == nil {
+			auth.Password, err = d.ResolveSecret(registry.Password)
+		}
+		return
+	}
+	if len(d.RegistryConfig) > 0 {
+		auth, err = d.loadConfigAuth(server)
+	}
+	return
+}
+
+// registryAuth will return the encoded credential of image for docker pull/inspect api, empty is returned when credential is not found
+func (d *Discover) registryAuth(image string) (encoded string) {
+	auth, err := d.findRegistryAuth(image)
+	if err != nil {
+		WarnLog("Discover find registry auth of %v fail with %v", image, err)
+		return
+	}
+	if auth == nil {
+		return
+	}
+	if auth.Username == "<token>" {
+		auth.IdentityToken, auth.Username, auth.Password = auth.Password, "", ""
+	}
+	data, _ := json.Marshal(auth)
+	encoded = base64.URLEncoding.EncodeToString(data)
+	return
+}
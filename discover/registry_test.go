@@ -0,0 +1,81 @@
+package discover
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestRegistryOf(t *testing.T) {
+	for image, server := range map[string]string{
+		"nginx":                         "docker.io",
+		"library/nginx:latest":          "docker.io",
+		"ghcr.io/xx/yy:v1":              "ghcr.io",
+		"localhost/xx":                  "localhost",
+		"127.0.0.1:5000/xx@sha256:abcd": "127.0.0.1:5000",
+	} {
+		if v := registryOf(image); v != server {
+			t.Errorf("%v->%v", image, v)
+			return
+		}
+	}
+}
+
+func decodeRegistryAuth(encoded string) (auth *types.AuthConfig) {
+	data, _ := base64.URLEncoding.DecodeString(encoded)
+	auth = &types.AuthConfig{}
+	json.Unmarshal(data, auth)
+	return
+}
+
+func TestRegistryAuth(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "registry")
+	defer os.RemoveAll(dir)
+	helper := filepath.Join(dir, "docker-credential-test")
+	ioutil.WriteFile(helper, []byte("#!/bin/sh\nread server\necho \"{\\\"Username\\\":\\\"<token>\\\",\\\"Secret\\\":\\\"tk-$server\\\"}\"\n"), 0755)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	config := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(config, []byte(`{
+		"auths":{"https://index.docker.io/v1/":{"auth":"`+base64.StdEncoding.EncodeToString([]byte("u1:p1"))+`"}},
+		"credHelpers":{"ecr.local":"test"}
+	}`), 0644)
+	discover := NewDiscover()
+	if v := discover.registryAuth("nginx"); len(v) > 0 {
+		t.Error(v)
+		return
+	}
+	discover.RegistryConfig = config
+	discover.Registries["ghcr.io"] = &Registry{Server: "ghcr.io", Username: "u2", Password: "p2"}
+	discover.Registries["gcr.local"] = &Registry{Server: "gcr.local", Helper: "test"}
+	if auth := decodeRegistryAuth(discover.registryAuth("nginx")); auth.Username != "u1" || auth.Password != "p1" {
+		t.Error(auth)
+		return
+	}
+	if auth := decodeRegistryAuth(discover.registryAuth("ghcr.io/xx/yy")); auth.Username != "u2" || auth.Password != "p2" {
+		t.Error(auth)
+		return
+	}
+	if auth := decodeRegistryAuth(discover.registryAuth("gcr.local/xx")); auth.IdentityToken != "tk-gcr.local" {
+		t.Error(auth)
+		return
+	}
+	if auth := decodeRegistryAuth(discover.registryAuth("ecr.local/xx")); auth.IdentityToken != "tk-ecr.local" {
+		t.Error(auth)
+		return
+	}
+	if v := discover.registryAuth("quay.io/xx"); len(v) > 0 {
+		t.Error(v)
+		return
+	}
+	//helper fail
+	discover.Registries["fail.local"] = &Registry{Server: "fail.local", Helper: "none"}
+	if v := discover.registryAuth("fail.local/xx"); len(v) > 0 {
+		t.Error(v)
+		return
+	}
+}
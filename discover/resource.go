@@ -0,0 +1,180 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// resourceSamples is the number of goroutine samples on refresh to detect runaway growth
+const resourceSamples = 10
+
+// ListenerState is the state of tcp/udp/unix forward listener, it is listening or conflict
+type ListenerState struct {
+	Prefix  string `json:"prefix"`
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	State   string `json:"state"`
+}
+
+// ResourceUsage is the goroutine, file descriptor, proxy connection and docker client accounting of pdservice
+type ResourceUsage struct {
+	Goroutines      int              `json:"goroutines"`
+	OpenFDs         int              `json:"open_fds"`
+	HTTPRequests    int64            `json:"http_requests"`
+	TCPConns        int64            `json:"tcp_conns"`
+	UDPSessions     int64            `json:"udp_sessions"`
+	Listeners       []*ListenerState `json:"listeners"`
+	DockerClients   int              `json:"docker_clients"`
+	DockerCreated   int64            `json:"docker_created"`
+	Runaway         []string         `json:"runaway"`
+	RunawayAlerted  time.Time        `json:"runaway_alerted,omitempty"`
+	GoroutineSample []int            `json:"goroutine_sample"`
+}
+
+// openFDs will return the number of open file descriptors, -1 is returned when it is not supported
+func openFDs() int {
+	files, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(files)
+}
+
+// ResourceUsage will return the current resource accounting
+func (d *Discover) ResourceUsage() (usage *ResourceUsage) {
+	usage = &ResourceUsage{
+		Goroutines:    runtime.NumGoroutine(),
+		OpenFDs:       openFDs(),
+		HTTPRequests:  int64(atomic.LoadInt32(&d.resourceHTTP)),
+		TCPConns:      int64(atomic.LoadInt32(&d.resourceTCP)),
+		UDPSessions:   int64(atomic.LoadInt32(&d.resourceUDP)),
+		Listeners:     []*ListenerState{},
+		DockerCreated: int64(atomic.LoadInt32(&d.dockerCreated)),
+	}
+	d.proxyLock.RLock()
+	for prefix, ln := range d.proxyListen {
+		forward, service := ln.Target()
+		usage.Listeners = append(usage.Listeners, &ListenerState{Prefix: prefix, Type: forward.Type, Address: forward.Key, Name: service.Name, State: "listening"})
+	}
+	for prefix, conflict := range d.listenConflicts {
+		usage.Listeners = append(usage.Listeners, &ListenerState{Prefix: prefix, Type: conflict.Type, Address: conflict.Address, Name: conflict.Name, State: "conflict"})
+	}
+	d.proxyLock.RUnlock()
+	sort.Slice(usage.Listeners, func(i, j int) bool { return usage.Listeners[i].Prefix < usage.Listeners[j].Prefix })
+	d.clientLock.RLock()
+	if d.clientNew != nil {
+		usage.DockerClients = 1
+	}
+	d.clientLock.RUnlock()
+	d.resourceLock.Lock()
+	usage.Runaway = append([]string{}, d.resourceRunaway...)
+	usage.RunawayAlerted = d.resourceAlerted
+	usage.GoroutineSample = append([]int{}, d.resourceSample...)
+	d.resourceLock.Unlock()
+	return
+}
+
+// growing will return true when the samples are full and increased on every sample to double
+func growing(samples []int) bool {
+	if len(samples) < resourceSamples || samples[0] < 1 {
+		return false
+	}
+	for i := 1; i < len(samples); i++ {
+		if samples[i] <= samples[i-1] {
+			return false
+		}
+	}
+	return samples[len(samples)-1] >= 2*samples[0]
+}
+
+// checkResource will sample the resource usage on refresh and alert once by ResourceHook when the goroutine or open fd is
+// over limit, or the goroutine is growing on every sample, until it is recovered
+func (d *Discover) checkResource() {
+	usage := d.ResourceUsage()
+	d.resourceLock.Lock()
+	d.resourceSample = append(d.resourceSample, usage.Goroutines)
+	if len(d.resourceSample) > resourceSamples {
+		d.resourceSample = d.resourceSample[len(d.resourceSample)-resourceSamples:]
+	}
+	runaway := []string{}
+	if d.GoroutineLimit > 0 && usage.Goroutines > d.GoroutineLimit {
+		runaway = append(runaway, fmt.Sprintf("goroutines %v is over limit %v", usage.Goroutines, d.GoroutineLimit))
+	}
+	if d.FDLimit > 0 && usage.OpenFDs > d.FDLimit {
+		runaway = append(runaway, fmt.Sprintf("open fds %v is over limit %v", usage.OpenFDs, d.FDLimit))
+	}
+	if growing(d.resourceSample) {
+		runaway = append(runaway, fmt.Sprintf("goroutines is growing from %v to %v in %v refreshes", d.resourceSample[0], usage.Goroutines, resourceSamples))
+	}
+	d.resourceRunaway = runaway
+	notify := len(runaway) > 0 && d.resourceAlerted.IsZero()
+	if notify {
+		d.resourceAlerted = time.Now()
+	} else if len(runaway) < 1 {
+		d.resourceAlerted = time.Time{}
+	}
+	d.resourceLock.Unlock()
+	if !notify {
+		return
+	}
+	WarnLog("Discover resource is runaway by %v", runaway)
+	if len(d.ResourceHook) < 1 {
+		return
+	}
+	data, _ := json.Marshal(xmap.M{
+		"event":        "resource",
+		"runaway":      runaway,
+		"goroutines":   usage.Goroutines,
+		"open_fds":     usage.OpenFDs,
+		"tcp_conns":    usage.TCPConns,
+		"udp_sessions": usage.UDPSessions,
+	})
+	go d.callHook(&Container{Name: "pdservice"}, "resource", d.ResourceHook, data)
+}
+
+func (d *Discover) writeResourceMetrics(w io.Writer) {
+	usage := d.ResourceUsage()
+	fmt.Fprintf(w, "# HELP pdservice_goroutines The number of goroutines.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_goroutines gauge\n")
+	fmt.Fprintf(w, "pdservice_goroutines %v\n", usage.Goroutines)
+	if usage.OpenFDs >= 0 {
+		fmt.Fprintf(w, "# HELP pdservice_open_fds The number of open file descriptors.\n")
+		fmt.Fprintf(w, "# TYPE pdservice_open_fds gauge\n")
+		fmt.Fprintf(w, "pdservice_open_fds %v\n", usage.OpenFDs)
+	}
+	fmt.Fprintf(w, "# HELP pdservice_proxy_active The number of active proxy requests, connections and sessions.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_proxy_active gauge\n")
+	fmt.Fprintf(w, "pdservice_proxy_active{type=\"http\"} %v\n", usage.HTTPRequests)
+	fmt.Fprintf(w, "pdservice_proxy_active{type=\"tcp\"} %v\n", usage.TCPConns)
+	fmt.Fprintf(w, "pdservice_proxy_active{type=\"udp\"} %v\n", usage.UDPSessions)
+	fmt.Fprintf(w, "# HELP pdservice_listeners The number of forward listeners by state.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_listeners gauge\n")
+	states := map[string]int{"listening": 0, "conflict": 0}
+	for _, ln := range usage.Listeners {
+		states[ln.State]++
+	}
+	fmt.Fprintf(w, "pdservice_listeners{state=\"listening\"} %v\n", states["listening"])
+	fmt.Fprintf(w, "pdservice_listeners{state=\"conflict\"} %v\n", states["conflict"])
+	fmt.Fprintf(w, "# HELP pdservice_docker_clients The number of active docker clients.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_docker_clients gauge\n")
+	fmt.Fprintf(w, "pdservice_docker_clients %v\n", usage.DockerClients)
+	fmt.Fprintf(w, "# HELP pdservice_docker_clients_created_total The total number of created docker clients.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_docker_clients_created_total counter\n")
+	fmt.Fprintf(w, "pdservice_docker_clients_created_total %v\n", usage.DockerCreated)
+	fmt.Fprintf(w, "# HELP pdservice_resource_runaway Whether the resource usage is runaway.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_resource_runaway gauge\n")
+	runaway := 0
+	if len(usage.Runaway) > 0 {
+		runaway = 1
+	}
+	fmt.Fprintf(w, "pdservice_resource_runaway %v\n", runaway)
+}
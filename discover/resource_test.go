@@ -0,0 +1,90 @@
+package discover
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResourceUsage(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.AdminToken = "123"
+	discover.proxyListen["tcp://:2022"] = &ListenerProxy{Prefix: "tcp://:2022", Forward: &Forward{Type: "tcp", Key: ":2022"}, Service: &Container{Name: "ds"}}
+	discover.listenConflicts = map[string]*ListenConflict{"tcp://:2023": {Prefix: "tcp://:2023", Type: "tcp", Address: ":2023", Name: "ds"}}
+	usage := discover.ResourceUsage()
+	if usage.Goroutines < 1 || len(usage.Listeners) != 2 || usage.Listeners[0].State != "listening" || usage.Listeners[1].State != "conflict" {
+		t.Error(usage)
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	discover.WriteMetrics(buf)
+	for _, line := range []string{
+		`pdservice_listeners{state="listening"} 1`,
+		`pdservice_listeners{state="conflict"} 1`,
+		`pdservice_proxy_active{type="tcp"} 0`,
+		`pdservice_resource_runaway 0`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("%v not in %v", line, buf.String())
+			return
+		}
+	}
+	req := httptest.NewRequest("GET", "http://pdsrv/_api/resources", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"goroutines"`) {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+}
+
+func TestResourceRunaway(t *testing.T) {
+	if growing([]int{1, 2, 3}) || growing([]int{10, 11, 12, 13, 14, 15, 16, 17, 18, 19}) || !growing([]int{10, 11, 12, 13, 14, 15, 16, 17, 18, 20}) || growing([]int{10, 11, 12, 13, 14, 15, 16, 17, 17, 20}) {
+		t.Error("error")
+		return
+	}
+	received := make(chan string, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received <- r.Header.Get("X-PD-Event") + ":" + string(data)
+	}))
+	defer hook.Close()
+	discover := NewDiscover()
+	discover.GoroutineLimit = 1
+	discover.ResourceHook = hook.URL
+	discover.checkResource()
+	select {
+	case data := <-received:
+		if !strings.HasPrefix(data, "resource:") || !strings.Contains(data, "over limit") {
+			t.Error(data)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timeout")
+		return
+	}
+	//alerted once
+	discover.checkResource()
+	if usage := discover.ResourceUsage(); len(usage.Runaway) != 1 || usage.RunawayAlerted.IsZero() || len(usage.GoroutineSample) != 2 {
+		t.Error(usage)
+		return
+	}
+	//recovered
+	discover.GoroutineLimit = 0
+	discover.checkResource()
+	if usage := discover.ResourceUsage(); len(usage.Runaway) != 0 || !usage.RunawayAlerted.IsZero() {
+		t.Error(usage)
+		return
+	}
+	select {
+	case data := <-received:
+		t.Error(data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package discover
+
+import (
+	"syscall"
+)
+
+func reusePortControl(network, address string, c syscall.RawConn) (err error) {
+	WarnLog("Discover set SO_REUSEPORT to %v://%v is not supported", network, address)
+	return
+}
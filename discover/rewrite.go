@@ -0,0 +1,84 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RewriteRule is the path rewrite rule of forward, the path matched by Match is replaced by Replace
+type RewriteRule struct {
+	Match   *regexp.Regexp
+	Replace string
+}
+
+// ParseRewriteRules will parse the PD_REWRITE label like <regexp> <replacement> split by |, the replacement can use $1 of regexp group
+func ParseRewriteRules(val string) (rules []*RewriteRule, err error) {
+	for _, part := range strings.Split(val, "|") {
+		part = strings.TrimSpace(part)
+		if len(part) < 1 {
+			continue
+		}
+		fields := strings.Fields(part)
+		if len(fields) != 2 {
+			err = fmt.Errorf("rewrite rule %v is invalid, must be <regexp> <replacement>", part)
+			return
+		}
+		if !strings.HasPrefix(fields[1], "/") {
+			err = fmt.Errorf("rewrite replacement %v must start with /", fields[1])
+			return
+		}
+		rule := &RewriteRule{Replace: fields[1]}
+		if rule.Match, err = regexp.Compile(fields[0]); err != nil {
+			return
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// rewritePath will return the path rewritten by rules by order
+func rewritePath(rules []*RewriteRule, path string) string {
+	for _, rule := range rules {
+		path = rule.Match.ReplaceAllString(path, rule.Replace)
+	}
+	return path
+}
+
+func (d *Discover) rewriteRules(forward *Forward) (rules []*RewriteRule) {
+	if len(forward.Rewrite) < 1 {
+		return
+	}
+	d.rewriteLock.Lock()
+	defer d.rewriteLock.Unlock()
+	rules, ok := d.rewriteCache[forward.Rewrite]
+	if ok {
+		return
+	}
+	rules, err := ParseRewriteRules(forward.Rewrite)
+	if err != nil {
+		WarnLog("Discover parse rewrite rule on %v fail with %v", forward.Prefix, err)
+	}
+	if len(d.rewriteCache) > 1000 {
+		d.rewriteCache = map[string][]*RewriteRule{}
+	}
+	d.rewriteCache[forward.Rewrite] = rules
+	return
+}
+
+// middlewareRewrite will rewrite the request path by PD_REWRITE of forward before proxy to forward
+func (d *Discover) middlewareRewrite(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy, next Handler) {
+	rules := d.rewriteRules(reverse.Forward)
+	if len(rules) < 1 {
+		next(w, r, reverse)
+		return
+	}
+	path := rewritePath(rules, r.URL.Path)
+	if path != r.URL.Path {
+		r = r.Clone(r.Context())
+		r.URL.Path, r.URL.RawPath = path, ""
+		r.RequestURI = r.URL.RequestURI()
+	}
+	next(w, r, reverse)
+}
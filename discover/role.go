@@ -0,0 +1,58 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	// RoleAll will serve both proxy and catalog/admin on listener
+	RoleAll = "all"
+	// RoleProxy will only serve proxy on listener, the catalog/admin is not found
+	RoleProxy = "proxy"
+	// RoleAdmin will only serve catalog/admin on listener for any host
+	RoleAdmin = "admin"
+)
+
+type roleKey struct{}
+
+// ParseListen will parse the listen address with optional role by address/role, e.g. :80/proxy, 127.0.0.1:9231/admin, default role is all
+func ParseListen(val string) (address, role string, err error) {
+	address, role = val, RoleAll
+	if i := strings.LastIndex(val, "/"); i >= 0 {
+		address, role = val[:i], val[i+1:]
+	}
+	if role != RoleAll && role != RoleProxy && role != RoleAdmin {
+		err = fmt.Errorf("listen role %v is invalid, must be all/proxy/admin", role)
+		return
+	}
+	_, _, err = net.SplitHostPort(address)
+	return
+}
+
+// RoleHandler will return the handler which serves request on listener by role
+func (d *Discover) RoleHandler(role string) http.Handler {
+	if role == RoleAll || len(role) < 1 {
+		return d
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), roleKey{}, role)))
+	})
+}
+
+func listenRole(r *http.Request) string {
+	if role, ok := r.Context().Value(roleKey{}).(string); ok {
+		return role
+	}
+	return RoleAll
+}
+
+// isSelf will check if request is sent to HostSelf of discover or tenant, the request on admin role listener and admin listener is always self
+func (d *Discover) isSelf(r *http.Request) bool {
+	_, self := d.selfTenant(r.Host)
+	role := listenRole(r)
+	return self || role == RoleAdmin || role == RoleControl
+}
@@ -0,0 +1,64 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseListen(t *testing.T) {
+	for val, expect := range map[string][2]string{
+		":9231":                {":9231", RoleAll},
+		":80/proxy":            {":80", RoleProxy},
+		"127.0.0.1:9231/admin": {"127.0.0.1:9231", RoleAdmin},
+		"[::1]:9231/all":       {"[::1]:9231", RoleAll},
+	} {
+		address, role, err := ParseListen(val)
+		if err != nil || address != expect[0] || role != expect[1] {
+			t.Error(val, address, role, err)
+			return
+		}
+	}
+	for _, val := range []string{":80/xx", "xx/proxy", "9231"} {
+		if _, _, err := ParseListen(val); err == nil {
+			t.Error(val)
+			return
+		}
+	}
+}
+
+func TestRoleHandler(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSelf = "self.test.com"
+	if discover.RoleHandler(RoleAll) != discover {
+		t.Error("error")
+		return
+	}
+	serve := func(role, host string) int {
+		req := httptest.NewRequest("GET", "http://"+host+"/", nil)
+		res := httptest.NewRecorder()
+		discover.RoleHandler(role).ServeHTTP(res, req)
+		return res.Code
+	}
+	if code := serve(RoleAll, "self.test.com"); code != http.StatusOK {
+		t.Error(code)
+		return
+	}
+	if code := serve(RoleProxy, "self.test.com"); code != http.StatusNotFound {
+		t.Error(code)
+		return
+	}
+	if code := serve(RoleProxy, "unknown.test.com"); code != http.StatusNotFound {
+		t.Error(code)
+		return
+	}
+	if code := serve(RoleAdmin, "127.0.0.1:9231"); code != http.StatusOK {
+		t.Error(code)
+		return
+	}
+	discover.UnknownHost = "redirect:https://test.com"
+	if code := serve(RoleProxy, "unknown.test.com"); code != http.StatusFound {
+		t.Error(code)
+		return
+	}
+}
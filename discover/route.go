@@ -0,0 +1,277 @@
+package discover
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CompareVersion will compare version like v1.2.10 by number segment
+func CompareVersion(a, b string) int {
+	partsA := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var x, y string
+		if i < len(partsA) {
+			x = partsA[i]
+		}
+		if i < len(partsB) {
+			y = partsB[i]
+		}
+		if x == y {
+			continue
+		}
+		numX, errX := strconv.Atoi(x)
+		numY, errY := strconv.Atoi(y)
+		if errX == nil && errY == nil {
+			if numX < numY {
+				return -1
+			}
+			return 1
+		}
+		if x < y {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// rebuildDefault will rebuild the stable host without version to the default version, it must be called with proxyLock locked
+func (d *Discover) rebuildDefault() {
+	defaults := map[string]*ReverseProxy{}
+	if d.DefaultVersion {
+		for _, proxy := range d.proxyReverse {
+			host := d.hostOf(proxy.Forward.Tenant, proxy.Forward.VersionPrefix(""))
+			if _, ok := d.proxyReverse[host]; ok {
+				continue
+			}
+			having := defaults[host]
+			if having == nil || proxy.Forward.Default && !having.Forward.Default ||
+				proxy.Forward.Default == having.Forward.Default && CompareVersion(proxy.Service.Version, having.Service.Version) > 0 {
+				defaults[host] = proxy
+			}
+		}
+	}
+	for host, proxy := range defaults {
+		if having := d.proxyDefault[host]; having == nil || having.Forward.Prefix != proxy.Forward.Prefix {
+			InfoLog("Discover default %v to %v", host, proxy.Forward.Prefix)
+			if having != nil {
+				d.startWarmUp(host, having)
+			}
+		}
+	}
+	d.proxyDefault = defaults
+	d.sweepWarmUp()
+}
+
+// routeVersion will return the reverse proxy of version specified by request header or cookie
+func (d *Discover) routeVersion(reverse *ReverseProxy, r *http.Request) *ReverseProxy {
+	version := ""
+	if len(d.VersionHeader) > 0 {
+		version = r.Header.Get(d.VersionHeader)
+	}
+	if len(version) < 1 && len(d.VersionCookie) > 0 {
+		if cookie, err := r.Cookie(d.VersionCookie); err == nil {
+			version = cookie.Value
+		}
+	}
+	if len(version) < 1 {
+		return reverse
+	}
+	target := d.findReverse(d.hostOf(reverse.Forward.Tenant, reverse.Forward.VersionPrefix(version)))
+	if target == nil {
+		DebugLog("Discover route %v to version %v is not found", r.Host, version)
+		return reverse
+	}
+	return target
+}
+
+// isManagedHost will check if the host is the catalog/admin host of pdservice or tenant, or the host under HostSuff
+// or tenant HostSuff which is produced by forward prefix, the custom alias and pattern can't take it
+func (d *Discover) isManagedHost(host string) bool {
+	host = strings.ToLower(host)
+	if _, ok := d.selfTenant(host); ok {
+		return true
+	}
+	underSuffix := func(suffix string) bool {
+		suffix = strings.ToLower(suffix)
+		return len(suffix) > 0 && (strings.HasSuffix(host, suffix) || host == strings.TrimPrefix(suffix, "."))
+	}
+	if underSuffix(d.HostSuff) {
+		return true
+	}
+	for _, t := range d.Tenants {
+		if underSuffix(t.HostSuff) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAliases will remove the alias of forwards which is managed host, the removed alias is recorded as label problem
+func (d *Discover) checkAliases(container *Container) {
+	for _, forward := range container.Forwards {
+		aliases := []string{}
+		for _, alias := range forward.Aliases {
+			if d.isManagedHost(alias) {
+				container.addProblem("PD_ALIAS_"+forward.Name, alias, "alias is the host of pdservice or forward")
+				continue
+			}
+			if d.foreignTenantHost(container.Tenant, alias) {
+				container.addProblem("PD_ALIAS_"+forward.Name, alias, "alias is in the namespace of other tenant")
+				continue
+			}
+			aliases = append(aliases, alias)
+		}
+		forward.Aliases = aliases
+	}
+}
+
+// checkMatches will remove the host patterns of forwards when MatchDomains is not configured, the removed pattern
+// is recorded as label problem
+func (d *Discover) checkMatches(container *Container) {
+	if len(d.MatchDomains) > 0 {
+		return
+	}
+	for _, forward := range container.Forwards {
+		for _, pattern := range forward.Matches {
+			container.addProblem("PD_MATCH_"+forward.Name, pattern, "host pattern is disabled, match_domains is not configured")
+		}
+		forward.Matches = nil
+	}
+}
+
+// inMatchDomains will check if the host is one of MatchDomains or under it, the host pattern only matches these hosts
+func (d *Discover) inMatchDomains(host string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range d.MatchDomains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuildAlias will rebuild the custom host alias to forward, it must be called with proxyLock locked
+func (d *Discover) rebuildAlias() {
+	aliases := map[string]*ReverseProxy{}
+	for _, proxy := range d.proxyReverse {
+		for _, alias := range proxy.Forward.Aliases {
+			having := aliases[alias]
+			if having != nil && having.Forward.Prefix != proxy.Forward.Prefix {
+				WarnLog("Discover alias %v is conflicted on %v and %v", alias, having.Forward.Prefix, proxy.Forward.Prefix)
+				if having.Forward.Prefix < proxy.Forward.Prefix {
+					continue
+				}
+			}
+			aliases[alias] = proxy
+		}
+	}
+	d.proxyAlias = aliases
+}
+
+type hostPattern struct {
+	Match *regexp.Regexp
+	Proxy *ReverseProxy
+}
+
+// compileHostPattern will compile the host pattern, regexp is specified by re: prefix and others is glob
+// which * is matching any chars except dot and ? is matching one char
+func compileHostPattern(pattern string) (match *regexp.Regexp, err error) {
+	if strings.HasPrefix(pattern, "re:") {
+		match, err = regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+		return
+	}
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, `[^.]*`)
+	expr = strings.ReplaceAll(expr, `\?`, `[^.]`)
+	match, err = regexp.Compile("^" + expr + "$")
+	return
+}
+
+// rebuildPattern will rebuild the glob/regexp host pattern to forward, it must be called with proxyLock locked
+func (d *Discover) rebuildPattern() {
+	patterns := []*hostPattern{}
+	for _, proxy := range d.proxyReverse {
+		for _, pattern := range proxy.Forward.Matches {
+			match, err := compileHostPattern(pattern)
+			if err != nil {
+				WarnLog("Discover compile host pattern %v on %v fail with %v", pattern, proxy.Forward.Prefix, err)
+				continue
+			}
+			patterns = append(patterns, &hostPattern{Match: match, Proxy: proxy})
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].Proxy.Forward.Prefix != patterns[j].Proxy.Forward.Prefix {
+			return patterns[i].Proxy.Forward.Prefix < patterns[j].Proxy.Forward.Prefix
+		}
+		return patterns[i].Match.String() < patterns[j].Match.String()
+	})
+	d.proxyPattern = patterns
+}
+
+// hostTrie is the suffix trie of host split by dot from the last label, it is used to find the longest wildcard host
+// which is suffix of request host without walking all suffixes against the proxy map
+type hostTrie struct {
+	children map[string]*hostTrie
+	host     string
+}
+
+func newHostTrie() *hostTrie {
+	return &hostTrie{children: map[string]*hostTrie{}}
+}
+
+// Add will add host to trie
+func (h *hostTrie) Add(host string) {
+	node := h
+	for rest := host; ; {
+		i := strings.LastIndex(rest, ".")
+		label := rest[i+1:]
+		next := node.children[label]
+		if next == nil {
+			next = newHostTrie()
+			node.children[label] = next
+		}
+		node = next
+		if i < 0 {
+			break
+		}
+		rest = rest[:i]
+	}
+	node.host = host
+}
+
+// Suffixes will return the added hosts which is dot suffix of host and not equal to host, the longest is first
+func (h *hostTrie) Suffixes(host string) (hosts []string) {
+	node := h
+	for rest := host; node != nil; {
+		i := strings.LastIndex(rest, ".")
+		if i < 0 {
+			break
+		}
+		if node = node.children[rest[i+1:]]; node != nil && len(node.host) > 0 {
+			hosts = append([]string{node.host}, hosts...)
+		}
+		rest = rest[:i]
+	}
+	return
+}
+
+// rebuildWildcard will rebuild the suffix trie of wildcard host, it must be called with proxyLock locked and after
+// rebuildDefault/rebuildAlias
+func (d *Discover) rebuildWildcard() {
+	wildcard := newHostTrie()
+	for _, all := range []map[string]*ReverseProxy{d.proxyReverse, d.proxyDefault, d.proxyAlias} {
+		for host := range all {
+			if reverse := d.matchReverse(host); reverse != nil && reverse.Forward.Wildcard {
+				wildcard.Add(host)
+			}
+		}
+	}
+	d.proxyWildcard = wildcard
+}
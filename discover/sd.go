@@ -0,0 +1,58 @@
+package discover
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// PrometheusTargets will return the Prometheus http_sd target groups of discovered http forward, the target is the backend address
+// and the labels is __meta_pdservice_*, the __scheme__ and __metrics_path__ is set by forward scheme and PD_METRICS_PATH label
+func (d *Discover) PrometheusTargets(match func(service *Container, forward *Forward) bool) (groups []xmap.M) {
+	groups = []xmap.M{}
+	d.proxyLock.RLock()
+	for prefix, service := range d.proxyAll {
+		forward := service.Forwards[prefix]
+		if forward == nil || forward.Type != "http" || len(forward.URI) < 1 || strings.HasPrefix(forward.URI, "unix://") || match != nil && !match(service, forward) {
+			continue
+		}
+		scheme := forward.Scheme
+		if len(scheme) < 1 {
+			scheme = "http"
+		}
+		labels := map[string]string{
+			"__scheme__":                 scheme,
+			"__meta_pdservice_name":      service.Name,
+			"__meta_pdservice_version":   service.Version,
+			"__meta_pdservice_forward":   forward.Name,
+			"__meta_pdservice_host":      d.hostOf(forward.Tenant, prefix),
+			"__meta_pdservice_status":    service.Status,
+			"__meta_pdservice_container": service.ID,
+			"__meta_pdservice_tenant":    service.Tenant,
+		}
+		if len(forward.MetricsPath) > 0 {
+			labels["__metrics_path__"] = forward.MetricsPath
+		}
+		groups = append(groups, xmap.M{
+			"targets": []string{forward.URI},
+			"labels":  labels,
+		})
+	}
+	d.proxyLock.RUnlock()
+	sort.Slice(groups, func(i, j int) bool {
+		x, y := groups[i]["labels"].(map[string]string), groups[j]["labels"].(map[string]string)
+		return x["__meta_pdservice_host"] < y["__meta_pdservice_host"]
+	})
+	return
+}
+
+// procPrometheusSD will serve the Prometheus http_sd target groups, the targets can be filtered by catalog query parameter
+func (d *Discover) procPrometheusSD(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	filter := ParseCatalogFilter(r.URL.Query())
+	groups := d.PrometheusTargets(func(service *Container, forward *Forward) bool {
+		return inTenant(tenant, service) && filter.Match(service, forward)
+	})
+	writeJSON(w, http.StatusOK, groups)
+}
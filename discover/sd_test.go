@@ -0,0 +1,59 @@
+package discover
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrometheusSD(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.HostSuff = ".example.com"
+	discover.AdminToken = "123"
+	discover.Tenants["t1"] = &Tenant{Name: "t1", AdminToken: "t1"}
+	container := &Container{ID: "c1", Name: "api", Version: "v1", Status: "running"}
+	container.Forwards = map[string]*Forward{
+		"v1.api":     {Name: "web", Type: "http", Prefix: "v1.api", URI: "10.0.0.1:8080", MetricsPath: "/stats"},
+		"tcp://8080": {Name: "db", Type: "tcp", Prefix: "tcp://8080", URI: "10.0.0.1:3306"},
+	}
+	discover.proxyAll["v1.api"] = container
+	discover.proxyAll["tcp://8080"] = container
+	tenantContainer := &Container{ID: "c2", Name: "web", Version: "v2", Tenant: "t1", Forwards: map[string]*Forward{
+		"v2.web.t1": {Name: "web", Type: "http", Prefix: "v2.web.t1", URI: "10.0.0.2:80", Scheme: "https"},
+	}}
+	discover.proxyAll["v2.web.t1"] = tenantContainer
+	call := func(path, token string) (groups []struct {
+		Targets []string          `json:"targets"`
+		Labels  map[string]string `json:"labels"`
+	}) {
+		req := httptest.NewRequest("GET", "http://pdsrv"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		if res.Code != http.StatusOK {
+			t.Error(res.Code)
+			return
+		}
+		json.Unmarshal(res.Body.Bytes(), &groups)
+		return
+	}
+	groups := call("/_api/sd/prometheus", "123")
+	if len(groups) != 2 || groups[0].Targets[0] != "10.0.0.1:8080" || groups[0].Labels["__metrics_path__"] != "/stats" || groups[0].Labels["__meta_pdservice_host"] != "v1.api.example.com" || groups[0].Labels["__scheme__"] != "http" {
+		t.Error(groups)
+		return
+	}
+	if groups[1].Labels["__scheme__"] != "https" || groups[1].Labels["__meta_pdservice_tenant"] != "t1" {
+		t.Error(groups)
+		return
+	}
+	if groups = call("/_api/sd/prometheus?name=web", "123"); len(groups) != 1 || groups[0].Labels["__meta_pdservice_name"] != "web" {
+		t.Error(groups)
+		return
+	}
+	if groups = call("/_api/sd/prometheus", "t1"); len(groups) != 1 || groups[0].Labels["__meta_pdservice_container"] != "c2" {
+		t.Error(groups)
+		return
+	}
+}
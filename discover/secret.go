@@ -0,0 +1,154 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// SecretProvider will resolve the secret reference which is <scheme>://<path>#<key>, the key is optional
+type SecretProvider func(path, key string) (value string, err error)
+
+type secretCached struct {
+	Value    string
+	CachedAt time.Time
+}
+
+// RegisterSecret will register the secret provider by scheme, the builtin env/file/vault provider is replaced when scheme is same
+func (d *Discover) RegisterSecret(scheme string, provider SecretProvider) {
+	d.secretLock.Lock()
+	d.secretAll[scheme] = provider
+	d.secretLock.Unlock()
+}
+
+func (d *Discover) registerBuiltinSecrets() {
+	d.secretAll = map[string]SecretProvider{
+		"env":   secretEnv,
+		"file":  secretFile,
+		"vault": d.secretVault,
+	}
+	d.secretCache = map[string]*secretCached{}
+}
+
+// IsSecretRef will check if the value is secret reference by registered scheme
+func (d *Discover) IsSecretRef(val string) bool {
+	parts := strings.SplitN(val, "://", 2)
+	if len(parts) < 2 {
+		return false
+	}
+	d.secretLock.Lock()
+	provider := d.secretAll[parts[0]]
+	d.secretLock.Unlock()
+	return provider != nil
+}
+
+// ResolveSecret will resolve the value by secret provider when it is secret reference like env://NAME, file:///path or vault://path#key,
+// the value is returned without change when scheme is not registered, the resolved value is cached in SecretTTL.
+// it must be called only on operator config, the container label is not trusted to read the host secret
+func (d *Discover) ResolveSecret(val string) (resolved string, err error) {
+	resolved = val
+	parts := strings.SplitN(val, "://", 2)
+	if len(parts) < 2 {
+		return
+	}
+	d.secretLock.Lock()
+	provider := d.secretAll[parts[0]]
+	cached := d.secretCache[val]
+	d.secretLock.Unlock()
+	if provider == nil {
+		return
+	}
+	if cached != nil && time.Since(cached.CachedAt) < d.SecretTTL {
+		resolved = cached.Value
+		return
+	}
+	path, key := parts[1], ""
+	if i := strings.LastIndex(path, "#"); i >= 0 {
+		path, key = path[:i], path[i+1:]
+	}
+	resolved, err = provider(path, key)
+	if err != nil {
+		err = fmt.Errorf("resolve secret %v fail with %v", val, err)
+		return
+	}
+	d.secretLock.Lock()
+	d.secretCache[val] = &secretCached{Value: resolved, CachedAt: time.Now()}
+	d.secretLock.Unlock()
+	return
+}
+
+func secretEnv(path, key string) (value string, err error) {
+	value, ok := os.LookupEnv(path)
+	if !ok {
+		err = fmt.Errorf("env %v is not found", path)
+	}
+	return
+}
+
+// secretFile will read the secret from file, the key is line of key=value in file when it is not empty
+func secretFile(path, key string) (value string, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if len(key) < 1 {
+		value = strings.TrimSpace(string(data))
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == key {
+			value = strings.TrimSpace(parts[1])
+			return
+		}
+	}
+	err = fmt.Errorf("key %v is not found in %v", key, path)
+	return
+}
+
+// secretVault will read the secret from HashiCorp Vault by VaultAddr/VaultToken, both kv v1 and v2 is supported
+func (d *Discover) secretVault(path, key string) (value string, err error) {
+	if len(d.VaultAddr) < 1 {
+		err = fmt.Errorf("vault addr is not configured")
+		return
+	}
+	if len(key) < 1 {
+		key = "value"
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(d.VaultAddr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Vault-Token", d.VaultToken)
+	client := &http.Client{Timeout: d.HookTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("status code %v", res.StatusCode)
+		return
+	}
+	secret := struct {
+		Data map[string]interface{} `json:"data"`
+	}{}
+	if err = json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return
+	}
+	data := secret.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		data = inner
+	}
+	val, ok := data[key]
+	if !ok {
+		err = fmt.Errorf("key %v is not found", key)
+		return
+	}
+	value = fmt.Sprintf("%v", val)
+	return
+}
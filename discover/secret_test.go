@@ -0,0 +1,115 @@
+package discover
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestSecret(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/ds":
+			fmt.Fprintf(w, `{"data":{"data":{"token":"v2"}}}`)
+		case "/v1/kv/ds":
+			fmt.Fprintf(w, `{"data":{"value":"v1"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	dir, _ := ioutil.TempDir("", "secret")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "token"), []byte("abc\n"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "env"), []byte("a=1\nb = 2\n"), 0600)
+	os.Setenv("PD_SECRET_TEST", "env")
+	discover := NewDiscover()
+	discover.VaultAddr = ts.URL
+	discover.VaultToken = "root"
+	for val, expect := range map[string]string{
+		"plain":                                      "plain",
+		"http://test.com/hook":                       "http://test.com/hook",
+		"env://PD_SECRET_TEST":                       "env",
+		"file://" + filepath.Join(dir, "token"):      "abc",
+		"file://" + filepath.Join(dir, "env") + "#b": "2",
+		"vault://secret/data/ds#token":               "v2",
+		"vault://kv/ds":                              "v1",
+	} {
+		resolved, err := discover.ResolveSecret(val)
+		if err != nil || resolved != expect {
+			t.Error(val, resolved, err)
+			return
+		}
+	}
+	//cache
+	calls = 0
+	discover.ResolveSecret("vault://kv/ds")
+	if calls != 0 {
+		t.Error(calls)
+		return
+	}
+	discover.SecretTTL = 0
+	discover.ResolveSecret("vault://kv/ds")
+	if calls != 1 {
+		t.Error(calls)
+		return
+	}
+	for _, val := range []string{
+		"env://PD_SECRET_NONE",
+		"file://" + filepath.Join(dir, "none"),
+		"file://" + filepath.Join(dir, "env") + "#c",
+		"vault://kv/none",
+		"vault://secret/data/ds#none",
+	} {
+		if _, err := discover.ResolveSecret(val); err == nil {
+			t.Error(val)
+			return
+		}
+	}
+	discover.VaultAddr = ""
+	if _, err := discover.ResolveSecret("vault://kv/ds"); err == nil {
+		t.Error(err)
+		return
+	}
+	//custom
+	discover.RegisterSecret("test", func(path, key string) (string, error) { return path + "-" + key, nil })
+	if resolved, _ := discover.ResolveSecret("test://a#b"); resolved != "a-b" {
+		t.Error(resolved)
+		return
+	}
+	//registry
+	discover.Registries["ghcr.io"] = &Registry{Server: "ghcr.io", Username: "u", Password: "env://PD_SECRET_TEST"}
+	if auth, err := discover.findRegistryAuth("ghcr.io/xx"); err != nil || auth.Password != "env" {
+		t.Error(auth, err)
+		return
+	}
+	//label is not resolved
+	if !discover.IsSecretRef("env://PD_SECRET_TEST") || discover.IsSecretRef("http://a") || discover.IsSecretRef("plain") {
+		t.Error("error")
+		return
+	}
+	for _, token := range []string{"env://PD_SECRET_TEST", "file://" + filepath.Join(dir, "token"), "vault://kv/ds"} {
+		inspect := types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "c1", Name: "/ds-srv-v1.0.0", State: &types.ContainerState{Status: "running"}},
+			Config:            &container.Config{Labels: map[string]string{"PD_SERVICE_TOKEN": token}},
+		}
+		service, _ := discover.parseContainer(inspect, "127.0.0.1", false)
+		if service == nil || len(service.Token) > 0 || len(service.Problems) != 1 || service.Problems[0].Value != "" {
+			t.Errorf("%v,%v", token, service)
+			return
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package discover
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+// Session is the login session of admin api, the access token is expired in SessionTTL and can be refreshed by refresh token
+// until the session is expired in SessionRefreshTTL or revoked
+type Session struct {
+	ID        string    `json:"id"`
+	Subject   string    `json:"subject"`
+	Role      string    `json:"role"`
+	Tenant    string    `json:"tenant,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type sessionClaims struct {
+	ID       string `json:"sid"`
+	Subject  string `json:"sub"`
+	Type     string `json:"typ"`
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp"`
+}
+
+const (
+	sessionAccess  = "access"
+	sessionRefresh = "refresh"
+)
+
+var sessionHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// sessionKey will return the signing key of session token, the random key is used when SessionSecret is not configured,
+// so all session is invalid after restart
+func (d *Discover) sessionKey() []byte {
+	d.sessionLock.Lock()
+	defer d.sessionLock.Unlock()
+	if len(d.sessionSecret) < 1 {
+		if len(d.SessionSecret) > 0 {
+			d.sessionSecret = []byte(d.SessionSecret)
+		} else {
+			d.sessionSecret = make([]byte, 32)
+			rand.Read(d.sessionSecret)
+		}
+	}
+	return d.sessionSecret
+}
+
+// signSession will sign the session token by HS256 JWT format
+func (d *Discover) signSession(claims *sessionClaims) string {
+	data, _ := json.Marshal(claims)
+	payload := sessionHeader + "." + base64.RawURLEncoding.EncodeToString(data)
+	mac := hmac.New(sha256.New, d.sessionKey())
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySession will verify the session token by type and return the session, nil is returned when token is invalid, expired or revoked
+func (d *Discover) verifySession(token, typ string) (session *Session) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != sessionHeader {
+		return
+	}
+	mac := hmac.New(sha256.New, d.sessionKey())
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	sign, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sign, mac.Sum(nil)) {
+		return
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return
+	}
+	claims := &sessionClaims{}
+	if err = json.Unmarshal(data, claims); err != nil || claims.Type != typ || time.Now().Unix() >= claims.Expires {
+		return
+	}
+	d.sessionLock.Lock()
+	session = d.sessionAll[claims.ID]
+	d.sessionLock.Unlock()
+	if session != nil && !time.Now().Before(session.ExpiresAt) {
+		session = nil
+	}
+	return
+}
+
+// isSessionToken will check if token is session token format
+func isSessionToken(token string) bool {
+	return strings.HasPrefix(token, sessionHeader+".")
+}
+
+// accessToken will issue the access token of session which is expired in SessionTTL but not after session
+func (d *Discover) accessToken(session *Session) (token string, expires time.Time) {
+	expires = time.Now().Add(d.SessionTTL)
+	if expires.After(session.ExpiresAt) {
+		expires = session.ExpiresAt
+	}
+	token = d.signSession(&sessionClaims{ID: session.ID, Subject: session.Subject, Type: sessionAccess, IssuedAt: time.Now().Unix(), Expires: expires.Unix()})
+	return
+}
+
+// CreateSession will create the login session and return the access and refresh token
+func (d *Discover) CreateSession(subject, role, tenant string) (session *Session, token, refresh string) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	now := time.Now()
+	session = &Session{ID: hex.EncodeToString(id), Subject: subject, Role: role, Tenant: tenant, CreatedAt: now, ExpiresAt: now.Add(d.SessionRefreshTTL)}
+	d.sessionLock.Lock()
+	if d.sessionAll == nil {
+		d.sessionAll = map[string]*Session{}
+	}
+	for key, s := range d.sessionAll {
+		if !now.Before(s.ExpiresAt) {
+			delete(d.sessionAll, key)
+		}
+	}
+	d.sessionAll[session.ID] = session
+	d.sessionLock.Unlock()
+	token, _ = d.accessToken(session)
+	refresh = d.signSession(&sessionClaims{ID: session.ID, Subject: subject, Type: sessionRefresh, IssuedAt: now.Unix(), Expires: session.ExpiresAt.Unix()})
+	return
+}
+
+// RevokeSession will revoke the session by id, all access and refresh token of session is invalid after revoked
+func (d *Discover) RevokeSession(id string) (revoked bool) {
+	d.sessionLock.Lock()
+	_, revoked = d.sessionAll[id]
+	delete(d.sessionAll, id)
+	d.sessionLock.Unlock()
+	return
+}
+
+// ListSession will return the active sessions which is sorted by created time
+func (d *Discover) ListSession() (sessions []*Session) {
+	sessions = []*Session{}
+	now := time.Now()
+	d.sessionLock.Lock()
+	for _, s := range d.sessionAll {
+		if now.Before(s.ExpiresAt) {
+			sessions = append(sessions, s)
+		}
+	}
+	d.sessionLock.Unlock()
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return
+}
+
+func (d *Discover) sessionResponse(session *Session, token, refresh string, expires time.Time) xmap.M {
+	res := xmap.M{
+		"token":      token,
+		"expires_in": int64(time.Until(expires) / time.Second),
+		"session":    session,
+	}
+	if len(refresh) > 0 {
+		res["refresh_token"] = refresh
+	}
+	return res
+}
+
+// procSessionLogin will create session by the credential of request, the session token can not be used to login again
+func (d *Discover) procSessionLogin(w http.ResponseWriter, r *http.Request, tenant *Tenant, role string) {
+	if isSessionToken(d.adminToken(r)) {
+		writeJSON(w, http.StatusForbidden, xmap.M{"code": http.StatusForbidden, "message": "session token can not be used to login"})
+		return
+	}
+	subject, tenantName := "token", ""
+	if username, _, ok := r.BasicAuth(); ok && len(username) > 0 {
+		subject = username
+	}
+	if tenant != nil {
+		tenantName = tenant.Name
+	}
+	session, token, refresh := d.CreateSession(subject, role, tenantName)
+	expires := time.Now().Add(d.SessionTTL)
+	if expires.After(session.ExpiresAt) {
+		expires = session.ExpiresAt
+	}
+	InfoLog("Discover audit session %v of %v/%v is created from %v", session.ID, subject, role, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, d.sessionResponse(session, token, refresh, expires))
+}
+
+// procSessionRefresh will issue new access token by refresh_token
+func (d *Discover) procSessionRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, xmap.M{"code": http.StatusMethodNotAllowed, "message": "method not allowed"})
+		return
+	}
+	session := d.verifySession(r.FormValue("refresh_token"), sessionRefresh)
+	if session == nil {
+		writeJSON(w, http.StatusUnauthorized, xmap.M{"code": http.StatusUnauthorized, "message": "unauthorized"})
+		return
+	}
+	token, expires := d.accessToken(session)
+	writeJSON(w, http.StatusOK, d.sessionResponse(session, token, "", expires))
+}
+
+// sessionRole will return the tenant and role of request by session access token
+func (d *Discover) sessionRole(token string) (tenant *Tenant, role string, ok bool) {
+	session := d.verifySession(token, sessionAccess)
+	if session == nil {
+		return
+	}
+	if len(session.Tenant) > 0 {
+		if tenant = d.Tenants[session.Tenant]; tenant == nil {
+			return
+		}
+	}
+	role, ok = session.Role, true
+	return
+}
+
+// procSessionLogout will revoke the session of access token on request
+func (d *Discover) procSessionLogout(w http.ResponseWriter, r *http.Request) {
+	session := d.verifySession(d.adminToken(r), sessionAccess)
+	if session == nil {
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": "not session token"})
+		return
+	}
+	d.RevokeSession(session.ID)
+	InfoLog("Discover audit session %v of %v is logout from %v", session.ID, session.Subject, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, xmap.M{"revoked": []string{session.ID}})
+}
+
+// procSessionRevoke will revoke the session by id
+func (d *Discover) procSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	if !d.RevokeSession(id) {
+		writeJSON(w, http.StatusNotFound, xmap.M{"code": http.StatusNotFound, "message": fmt.Sprintf("session %v is not found", id)})
+		return
+	}
+	InfoLog("Discover audit session %v is revoked from %v", id, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, xmap.M{"revoked": []string{id}})
+}
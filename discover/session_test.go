@@ -0,0 +1,144 @@
+package discover
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.AdminToken = "a1"
+	discover.RoleTokens = map[string]string{"v1": RoleViewer}
+	discover.Tenants["t1"] = &Tenant{Name: "t1", AdminToken: "t1"}
+	call := func(method, path, token string, form url.Values) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, "http://pdsrv"+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		result := map[string]interface{}{}
+		json.Unmarshal(res.Body.Bytes(), &result)
+		return res.Code, result
+	}
+	//login
+	if code, _ := call("POST", "/_api/login", "xx", nil); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	code, login := call("POST", "/_api/login", "v1", nil)
+	if code != http.StatusOK || login["token"] == nil || login["refresh_token"] == nil {
+		t.Error(code, login)
+		return
+	}
+	token, refresh := login["token"].(string), login["refresh_token"].(string)
+	if code, _ := call("GET", "/_api/status", token, nil); code != http.StatusOK {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("POST", "/_api/pause", token, nil); code != http.StatusForbidden {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("POST", "/_api/login", token, nil); code != http.StatusForbidden {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("GET", "/_api/status", refresh, nil); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("GET", "/_api/status", token[:len(token)-2]+"xx", nil); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	//refresh
+	if code, _ := call("POST", "/_api/session/refresh", "", url.Values{"refresh_token": {token}}); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("GET", "/_api/session/refresh", "", url.Values{"refresh_token": {refresh}}); code != http.StatusMethodNotAllowed {
+		t.Error(code)
+		return
+	}
+	code, refreshed := call("POST", "/_api/session/refresh", "", url.Values{"refresh_token": {refresh}})
+	if code != http.StatusOK || refreshed["token"] == nil || refreshed["refresh_token"] != nil {
+		t.Error(code, refreshed)
+		return
+	}
+	//tenant
+	_, tenantLogin := call("POST", "/_api/login", "t1", nil)
+	tenantToken := tenantLogin["token"].(string)
+	if code, _ := call("GET", "/_api/services", tenantToken, nil); code != http.StatusOK {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("GET", "/_api/status", tenantToken, nil); code != http.StatusForbidden {
+		t.Error(code)
+		return
+	}
+	//list and revoke
+	if code, _ := call("GET", "/_api/sessions", token, nil); code != http.StatusForbidden {
+		t.Error(code)
+		return
+	}
+	if sessions := discover.ListSession(); len(sessions) != 2 || sessions[0].Role != RoleViewer || sessions[1].Tenant != "t1" {
+		t.Error(sessions)
+		return
+	}
+	if code, _ := call("POST", "/_api/session/revoke", "a1", url.Values{"id": {discover.ListSession()[1].ID}}); code != http.StatusOK {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("POST", "/_api/session/revoke", "a1", url.Values{"id": {"xx"}}); code != http.StatusNotFound {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("GET", "/_api/services", tenantToken, nil); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("POST", "/_api/logout", "a1", nil); code != http.StatusBadRequest {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("POST", "/_api/logout", refreshed["token"].(string), nil); code != http.StatusOK {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("GET", "/_api/status", token, nil); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	if code, _ := call("POST", "/_api/session/refresh", "", url.Values{"refresh_token": {refresh}}); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	//expired
+	discover.SessionRefreshTTL = time.Millisecond
+	_, token, _ = discover.CreateSession("x", RoleAdministrator, "")
+	time.Sleep(5 * time.Millisecond)
+	if code, _ := call("GET", "/_api/status", token, nil); code != http.StatusUnauthorized {
+		t.Error(code)
+		return
+	}
+	if len(discover.ListSession()) != 0 {
+		t.Error("expired")
+		return
+	}
+	//secret
+	other := NewDiscover()
+	other.SessionSecret = "s1"
+	_, token, _ = other.CreateSession("x", RoleAdministrator, "")
+	if discover.verifySession(token, sessionAccess) != nil || other.verifySession(token, sessionAccess) == nil {
+		t.Error("secret")
+		return
+	}
+}
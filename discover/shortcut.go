@@ -0,0 +1,96 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Shortcut is the redirect or static response of forward which is handled by pdservice without backend
+type Shortcut struct {
+	Status   int    `json:"status"`
+	Redirect string `json:"redirect,omitempty"`
+	Body     string `json:"body,omitempty"`
+}
+
+// splitStatus will split the optional leading status code from label value like <status> <value>
+func splitStatus(val string, def int) (status int, rest string, err error) {
+	status, rest = def, strings.TrimSpace(val)
+	parts := strings.SplitN(rest, " ", 2)
+	code, xerr := strconv.Atoi(parts[0])
+	if xerr != nil {
+		return
+	}
+	if code < 100 || code > 599 {
+		err = fmt.Errorf("status %v is invalid", code)
+		return
+	}
+	status, rest = code, ""
+	if len(parts) > 1 {
+		rest = strings.TrimSpace(parts[1])
+	}
+	return
+}
+
+// ParseRedirect will parse the PD_REDIRECT label like [<status> ]<url>, the status is 302 by default and must be 3xx
+func ParseRedirect(val string) (shortcut *Shortcut, err error) {
+	status, target, err := splitStatus(val, http.StatusFound)
+	if err != nil {
+		return
+	}
+	if status < 300 || status > 399 {
+		err = fmt.Errorf("redirect status %v must be 3xx", status)
+		return
+	}
+	uri, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	if len(uri.Scheme) < 1 || len(uri.Host) < 1 {
+		err = fmt.Errorf("redirect url %v must be absolute", target)
+		return
+	}
+	shortcut = &Shortcut{Status: status, Redirect: target}
+	return
+}
+
+// ParseRespond will parse the PD_RESPOND label like [<status> ]<body>, the status is 200 by default
+func ParseRespond(val string) (shortcut *Shortcut, err error) {
+	status, body, err := splitStatus(val, http.StatusOK)
+	if err == nil {
+		shortcut = &Shortcut{Status: status, Body: body}
+	}
+	return
+}
+
+// skipPort will return if the forward of name is redirect, static response or static site by
+// PD_REDIRECT/PD_RESPOND/PD_STATIC label, the forward is not required to publish port
+func skipPort(labels map[string]string, name string) bool {
+	for _, option := range []string{"REDIRECT", "RESPOND", "STATIC"} {
+		if len(labels["PD_"+option]) > 0 || len(labels["PD_"+option+"_"+name]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP will write the redirect or static response, the request path and query is appended
+// when the redirect url has no path
+func (s *Shortcut) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(s.Redirect) > 0 {
+		target := s.Redirect
+		if uri, _ := url.Parse(target); uri != nil && (uri.Path == "" || uri.Path == "/") && len(uri.RawQuery) < 1 {
+			target = strings.TrimSuffix(target, "/") + r.URL.RequestURI()
+		}
+		http.Redirect(w, r, target, s.Status)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType([]byte(s.Body)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(s.Body)))
+	w.WriteHeader(s.Status)
+	if r.Method != http.MethodHead {
+		w.Write([]byte(s.Body))
+	}
+}
@@ -0,0 +1,86 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestParseShortcut(t *testing.T) {
+	if shortcut, err := ParseRedirect("https://docs.example.com"); err != nil || shortcut.Status != http.StatusFound {
+		t.Errorf("%v,%v", err, shortcut)
+		return
+	}
+	if shortcut, err := ParseRedirect("301 https://docs.example.com/v1"); err != nil || shortcut.Status != http.StatusMovedPermanently || shortcut.Redirect != "https://docs.example.com/v1" {
+		t.Errorf("%v,%v", err, shortcut)
+		return
+	}
+	for _, val := range []string{"200 https://a.loc", "/docs", "999 https://a.loc"} {
+		if _, err := ParseRedirect(val); err == nil {
+			t.Error(val)
+			return
+		}
+	}
+	if shortcut, err := ParseRespond("404 not here"); err != nil || shortcut.Status != http.StatusNotFound || shortcut.Body != "not here" {
+		t.Errorf("%v,%v", err, shortcut)
+		return
+	}
+	if shortcut, err := ParseRespond("ok"); err != nil || shortcut.Status != http.StatusOK || shortcut.Body != "ok" {
+		t.Errorf("%v,%v", err, shortcut)
+		return
+	}
+}
+
+func TestShortcut(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    "0123456789abcdef",
+			Name:  "/vanity-srv-v1.0.0",
+			State: &types.ContainerState{Status: "running"},
+		},
+		Config: &container.Config{Labels: map[string]string{
+			"PD_HOST_DOCS":     "docs/",
+			"PD_REDIRECT_DOCS": "301 https://docs.example.com",
+			"PD_HOST_PING":     "ping/",
+			"PD_RESPOND_PING":  "pong",
+			"PD_HOST_WEB":      "8080",
+		}},
+	}
+	service, ok := discover.parseContainer(inspect, "127.0.0.1", false)
+	if !ok || len(service.Forwards) != 2 || service.Forwards["docs.v100.vanity"] == nil || service.Forwards["ping.v100.vanity"] == nil {
+		t.Errorf("%v,%v", service.Forwards, service.Problems)
+		return
+	}
+	discover.applyProxy(map[string]*Container{"docs.v100.vanity": service, "ping.v100.vanity": service})
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://docs.v100.vanity.test.loc/a/b?c=1", nil))
+	if res.Code != http.StatusMovedPermanently || res.Header().Get("Location") != "https://docs.example.com/a/b?c=1" {
+		t.Errorf("%v,%v", res.Code, res.Header())
+		return
+	}
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://ping.v100.vanity.test.loc/", nil))
+	if res.Code != http.StatusOK || res.Body.String() != "pong" {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("HEAD", "http://ping.v100.vanity.test.loc/", nil))
+	if res.Code != http.StatusOK || res.Body.Len() > 0 {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	//not absolute redirect path
+	shortcut := &Shortcut{Status: http.StatusFound, Redirect: "https://docs.example.com/v1"}
+	res = httptest.NewRecorder()
+	shortcut.ServeHTTP(res, httptest.NewRequest("GET", "http://a.loc/x", nil))
+	if res.Header().Get("Location") != "https://docs.example.com/v1" {
+		t.Error(res.Header())
+		return
+	}
+}
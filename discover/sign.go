@@ -0,0 +1,80 @@
+package discover
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader is the header of hmac signature on pdservice originated requests
+	SignatureHeader = "X-PD-Signature"
+	// IdentitySignatureHeader is the header of hmac signature on identity header which is passed to upstream by auth middleware
+	IdentitySignatureHeader = "X-PD-Identity-Signature"
+)
+
+// Signature will return the signature value t=<unix>,v1=<hex hmac-sha256 of "<unix>.<method>.<request uri>.<body>"> by secret,
+// so the signed body can't be replayed to other method or path of receiver
+func Signature(secret string, at time.Time, method, uri string, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + method + "." + uri + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%v,v1=%v", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// SignRequest will set the signature header of request method, uri and body by secret, it is skipped when secret is empty
+func SignRequest(req *http.Request, secret string, body []byte) {
+	if len(secret) < 1 {
+		return
+	}
+	req.Header.Set(SignatureHeader, Signature(secret, time.Now(), req.Method, req.URL.RequestURI(), body))
+}
+
+// VerifyRequest will verify the signature header of received request with body by secret
+func VerifyRequest(secret string, r *http.Request, body []byte, tolerance time.Duration) (err error) {
+	err = VerifySignature(secret, r.Header.Get(SignatureHeader), r.Method, r.URL.RequestURI(), body, tolerance)
+	return
+}
+
+// IdentityPayload will return the signed payload of identity header by user and groups header value
+func IdentityPayload(user, groups string) []byte {
+	return []byte(user + "\n" + groups)
+}
+
+// VerifySignature will verify the signature header value of method, uri and body by secret, the signature which is older than
+// tolerance is rejected to avoid replay, the tolerance is not checked when it is zero
+func VerifySignature(secret, signature, method, uri string, body []byte, tolerance time.Duration) (err error) {
+	var timestamp, sign string
+	for _, part := range strings.Split(signature, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) < 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			sign = kv[1]
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(sign) < 1 {
+		err = fmt.Errorf("signature %v is invalid", signature)
+		return
+	}
+	at := time.Unix(unix, 0)
+	if tolerance > 0 && (time.Since(at) > tolerance || time.Until(at) > tolerance) {
+		err = fmt.Errorf("signature is expired")
+		return
+	}
+	if !hmac.Equal([]byte(Signature(secret, at, method, uri, body)), []byte(fmt.Sprintf("t=%v,v1=%v", timestamp, sign))) {
+		err = fmt.Errorf("signature is not matched")
+	}
+	return
+}
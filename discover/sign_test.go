@@ -0,0 +1,113 @@
+package discover
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"event":"start"}`)
+	sign := Signature("abc", time.Now(), "POST", "/hook?a=1", body)
+	if err := VerifySignature("abc", sign, "POST", "/hook?a=1", body, time.Minute); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := VerifySignature("xyz", sign, "POST", "/hook?a=1", body, time.Minute); err == nil {
+		t.Error("error")
+		return
+	}
+	if err := VerifySignature("abc", sign, "POST", "/hook?a=1", []byte("x"), time.Minute); err == nil {
+		t.Error("error")
+		return
+	}
+	if err := VerifySignature("abc", sign, "PUT", "/hook?a=1", body, time.Minute); err == nil {
+		t.Error("method")
+		return
+	}
+	if err := VerifySignature("abc", sign, "POST", "/other", body, time.Minute); err == nil {
+		t.Error("uri")
+		return
+	}
+	old := Signature("abc", time.Now().Add(-time.Hour), "POST", "/", body)
+	if err := VerifySignature("abc", old, "POST", "/", body, time.Minute); err == nil {
+		t.Error("error")
+		return
+	}
+	if err := VerifySignature("abc", old, "POST", "/", body, 0); err != nil {
+		t.Error(err)
+		return
+	}
+	for _, sign := range []string{"", "t=xx,v1=00", "t=1"} {
+		if err := VerifySignature("abc", sign, "POST", "/", body, 0); err == nil {
+			t.Error(sign)
+			return
+		}
+	}
+}
+
+func TestSignHook(t *testing.T) {
+	received := make(chan error, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received <- VerifyRequest("abc", r, data, time.Minute)
+	}))
+	defer hook.Close()
+	discover := NewDiscover()
+	discover.HookHosts = []string{"127.0.0.1"}
+	discover.SignSecret = "abc"
+	discover.callHook(&Container{Name: "ds"}, "start", hook.URL, []byte(`{"event":"start"}`))
+	select {
+	case err := <-received:
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timeout")
+		return
+	}
+	req := httptest.NewRequest("POST", "http://pdsrv/", nil)
+	SignRequest(req, "", nil)
+	if len(req.Header.Get(SignatureHeader)) > 0 {
+		t.Error("signed")
+		return
+	}
+}
+
+func TestSignIdentity(t *testing.T) {
+	received := make(chan error, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := IdentityPayload(r.Header.Get("X-Auth-User"), r.Header.Get("X-Auth-Groups"))
+		received <- VerifySignature("abc", r.Header.Get(IdentitySignatureHeader), r.Method, r.URL.RequestURI(), payload, time.Minute)
+	}))
+	defer backend.Close()
+	discover := NewDiscover()
+	discover.SignSecret = "abc"
+	forward := &Forward{Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://") + "/api"}
+	proxy, err := discover.newReverseProxy(forward)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//forged signature is removed without identity
+	req := httptest.NewRequest("GET", "http://v100.ds/users?a=1", nil)
+	req.Header.Set(IdentitySignatureHeader, "t=1,v1=00")
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+	if err = <-received; err == nil {
+		t.Error(err)
+		return
+	}
+	//signed by upstream uri
+	req = httptest.NewRequest("GET", "http://v100.ds/users?a=1", nil)
+	req.Header.Set("X-Auth-User", "u1")
+	req.Header.Set("X-Auth-Groups", "ops,dev")
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+	if err = <-received; err != nil {
+		t.Error(err)
+		return
+	}
+}
@@ -0,0 +1,59 @@
+package discover
+
+import (
+	"math/rand"
+	"time"
+)
+
+type warmUp struct {
+	Previous string
+	Start    time.Time
+}
+
+// startWarmUp will start to ramp traffic of default host from previous default to new default in SlowStart,
+// it must be called with proxyLock locked
+func (d *Discover) startWarmUp(host string, previous *ReverseProxy) {
+	if d.SlowStart <= 0 {
+		return
+	}
+	if d.proxyWarm == nil {
+		d.proxyWarm = map[string]*warmUp{}
+	}
+	d.proxyWarm[host] = &warmUp{
+		Previous: d.hostOf(previous.Forward.Tenant, previous.Forward.Prefix),
+		Start:    time.Now(),
+	}
+	InfoLog("Discover slow start %v from %v in %v", host, previous.Forward.Prefix, d.SlowStart)
+}
+
+// sweepWarmUp will remove the done warm up, it must be called with proxyLock locked
+func (d *Discover) sweepWarmUp() {
+	for host, warm := range d.proxyWarm {
+		if _, ok := d.proxyDefault[host]; !ok || time.Since(warm.Start) >= d.SlowStart {
+			delete(d.proxyWarm, host)
+		}
+	}
+}
+
+// warmReverse will return the previous default by the proportional weight of remaining warm up time, it must be called with proxyLock locked
+func (d *Discover) warmReverse(host string, reverse *ReverseProxy) *ReverseProxy {
+	if reverse == nil || d.SlowStart <= 0 {
+		return reverse
+	}
+	warm := d.proxyWarm[host]
+	if warm == nil {
+		return reverse
+	}
+	used := time.Since(warm.Start)
+	if used >= d.SlowStart {
+		return reverse
+	}
+	previous := d.proxyReverse[warm.Previous]
+	if previous == nil {
+		return reverse
+	}
+	if rand.Int63n(int64(d.SlowStart)) >= int64(used) {
+		return previous
+	}
+	return reverse
+}
@@ -0,0 +1,62 @@
+package discover
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowStart(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.DefaultVersion = true
+	discover.SlowStart = 200 * time.Millisecond
+	v1 := &ReverseProxy{Forward: &Forward{Prefix: "v100.ds"}, Service: &Container{Name: "ds", Version: "v1.0.0"}}
+	v2 := &ReverseProxy{Forward: &Forward{Prefix: "v200.ds"}, Service: &Container{Name: "ds", Version: "v2.0.0"}}
+	discover.proxyReverse["v100.ds.test.loc"] = v1
+	discover.rebuildDefault()
+	if reverse := discover.findReverse("ds.test.loc"); reverse != v1 || len(discover.proxyWarm) != 0 {
+		t.Error(reverse)
+		return
+	}
+	discover.proxyReverse["v200.ds.test.loc"] = v2
+	discover.rebuildDefault()
+	if discover.proxyWarm["ds.test.loc"] == nil {
+		t.Error(discover.proxyWarm)
+		return
+	}
+	count := func() (previous int) {
+		for i := 0; i < 1000; i++ {
+			if discover.findReverse("ds.test.loc") == v1 {
+				previous++
+			}
+		}
+		return
+	}
+	if previous := count(); previous < 500 {
+		t.Error(previous)
+		return
+	}
+	time.Sleep(100 * time.Millisecond)
+	if previous := count(); previous > 900 {
+		t.Error(previous)
+		return
+	}
+	time.Sleep(110 * time.Millisecond)
+	if previous := count(); previous != 0 {
+		t.Error(previous)
+		return
+	}
+	discover.rebuildDefault()
+	if len(discover.proxyWarm) != 0 {
+		t.Error(discover.proxyWarm)
+		return
+	}
+	//previous is removed
+	discover.proxyDefault["ds.test.loc"] = v1
+	discover.rebuildDefault()
+	delete(discover.proxyReverse, "v100.ds.test.loc")
+	if previous := count(); previous != 0 {
+		t.Error(previous)
+		return
+	}
+}
@@ -0,0 +1,71 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// LoadSnapshot will restore the proxy table from SnapshotFile, so the last-known-good routes are served when docker is not
+// reachable on startup. it is skipped after the first successful docker contact, and the not existed file is ignored
+func (d *Discover) LoadSnapshot() (restored int, err error) {
+	if len(d.SnapshotFile) < 1 {
+		return
+	}
+	data, err := ioutil.ReadFile(d.SnapshotFile)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	all := map[string]*Container{}
+	if err = json.Unmarshal(data, &all); err != nil {
+		err = fmt.Errorf("parse %v fail with %v", d.SnapshotFile, err)
+		return
+	}
+	d.snapshotLock.Lock()
+	defer d.snapshotLock.Unlock()
+	if d.snapshotContacted {
+		return
+	}
+	for prefix, service := range all {
+		if service == nil || service.Forwards[prefix] == nil {
+			delete(all, prefix)
+		}
+	}
+	added, _, _ := d.applyProxy(all)
+	d.snapshotLast = data
+	restored = len(added)
+	InfoLog("Discover restore %v forwards from snapshot %v", restored, d.SnapshotFile)
+	return
+}
+
+// saveSnapshot will save the proxy table to SnapshotFile when it is changed
+func (d *Discover) saveSnapshot() {
+	if len(d.SnapshotFile) < 1 {
+		return
+	}
+	d.proxyLock.RLock()
+	data, err := json.Marshal(d.proxyAll)
+	d.proxyLock.RUnlock()
+	d.snapshotLock.Lock()
+	defer d.snapshotLock.Unlock()
+	if err == nil && bytes.Equal(data, d.snapshotLast) {
+		return
+	}
+	if err == nil {
+		tmp := d.SnapshotFile + ".tmp"
+		if err = ioutil.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, d.SnapshotFile)
+		}
+	}
+	if err != nil {
+		WarnLog("Discover save snapshot to %v fail with %v", d.SnapshotFile, err)
+		return
+	}
+	d.snapshotLast = data
+}
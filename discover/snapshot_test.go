@@ -0,0 +1,62 @@
+package discover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "snapshot")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "snapshot.json")
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.SnapshotFile = file
+	service := &Container{ID: "c1", Name: "ds", Version: "v1.0.0", Forwards: map[string]*Forward{
+		"v100.ds": {Name: "ds", Prefix: "v100.ds", Type: "http", URI: "127.0.0.1:80"},
+	}}
+	discover.applyProxy(map[string]*Container{"v100.ds": service})
+	discover.saveSnapshot()
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	//not changed
+	discover.saveSnapshot()
+	if info2, _ := os.Stat(file); !info2.ModTime().Equal(info.ModTime()) {
+		t.Error("saved")
+		return
+	}
+	//restore
+	loaded := NewDiscover()
+	loaded.HostSuff = ".test.loc"
+	loaded.SnapshotFile = file
+	restored, err := loaded.LoadSnapshot()
+	if err != nil || restored != 1 || loaded.findReverse("v100.ds.test.loc") == nil {
+		t.Errorf("%v,%v", restored, err)
+		return
+	}
+	//contacted
+	contacted := NewDiscover()
+	contacted.SnapshotFile = file
+	contacted.snapshotContacted = true
+	if restored, err := contacted.LoadSnapshot(); err != nil || restored != 0 || len(contacted.proxyAll) != 0 {
+		t.Errorf("%v,%v", restored, err)
+		return
+	}
+	//not existed
+	loaded.SnapshotFile = filepath.Join(dir, "none.json")
+	if _, err := loaded.LoadSnapshot(); err != nil {
+		t.Error(err)
+		return
+	}
+	ioutil.WriteFile(file, []byte("xx"), 0600)
+	loaded.SnapshotFile = file
+	if _, err := loaded.LoadSnapshot(); err == nil {
+		t.Error("error")
+		return
+	}
+}
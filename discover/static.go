@@ -0,0 +1,207 @@
+package discover
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// StaticSite is the static files of forward which is served by pdservice from host path or container volume without backend
+type StaticSite struct {
+	Path     string        `json:"path"`
+	Root     string        `json:"root"`
+	Mount    string        `json:"mount,omitempty"`
+	Index    string        `json:"index,omitempty"`
+	Fallback string        `json:"fallback,omitempty"`
+	MaxAge   time.Duration `json:"max_age,omitempty"`
+}
+
+// parseStatic will parse the PD_STATIC label, the path is the absolute path in container which is mapped to host by
+// container mounts, or the absolute host path under StaticRoots by host: prefix
+func parseStatic(forward *Forward, val string) (err error) {
+	name := strings.TrimPrefix(val, "host:")
+	if !path.IsAbs(name) {
+		err = fmt.Errorf("static path %v must be absolute", val)
+		return
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			err = fmt.Errorf("static path %v must not contain ..", val)
+			return
+		}
+	}
+	if forward.Static == nil {
+		forward.Static = &StaticSite{}
+	}
+	forward.Static.Path = strings.TrimSuffix(val, name) + path.Clean(name)
+	return
+}
+
+// staticOption will return the forward option of static site which requires PD_STATIC label
+func staticOption(apply func(static *StaticSite, val string) error) ForwardOption {
+	return func(forward *Forward, val string) (err error) {
+		if forward.Static == nil {
+			forward.Static = &StaticSite{}
+		}
+		err = apply(forward.Static, val)
+		return
+	}
+}
+
+// inStaticRoots will check if the host path is under one of StaticRoots, the symlinks of path and roots are resolved,
+// so the link in allowed root can't point to other host path
+func (d *Discover) inStaticRoots(name string) bool {
+	real, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return false
+	}
+	return inRoots(d.StaticRoots, real)
+}
+
+// inRoots will check if the resolved path is under one of roots, the symlinks of roots are resolved
+func inRoots(roots []string, real string) bool {
+	for _, root := range roots {
+		if rootReal, err := filepath.EvalSymlinks(root); err == nil && inDir(rootReal, real) {
+			return true
+		}
+	}
+	return false
+}
+
+// inDir will check if the clean path name is dir or under dir
+func inDir(dir, name string) bool {
+	return name == dir || strings.HasPrefix(name, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// resolveStatic will resolve the root of static site by container mounts, the static site is removed with problem
+// when the path is not mounted, the host path is not under StaticRoots or the mounts is not on local docker
+func (d *Discover) resolveStatic(container *Container, mounts []types.MountPoint, localMounts bool) {
+	for _, forward := range container.Forwards {
+		static := forward.Static
+		if static == nil {
+			continue
+		}
+		if len(static.Path) < 1 {
+			container.addProblem("PD_STATIC_"+forward.Name, "", "static path is required")
+			forward.Static = nil
+			continue
+		}
+		if strings.HasPrefix(static.Path, "host:") {
+			static.Root = filepath.Clean(strings.TrimPrefix(static.Path, "host:"))
+			if !d.inStaticRoots(static.Root) {
+				container.addProblem("PD_STATIC_"+forward.Name, static.Path, "host path is not under static_roots")
+				forward.Static = nil
+			}
+			continue
+		}
+		static.Root, static.Mount = "", ""
+		if !localMounts {
+			container.addProblem("PD_STATIC_"+forward.Name, static.Path, "container mounts is not on local docker")
+			forward.Static = nil
+			continue
+		}
+		matched := ""
+		for _, mount := range mounts {
+			dest := path.Clean(mount.Destination)
+			if len(dest) <= len(matched) || (static.Path != dest && !strings.HasPrefix(static.Path, strings.TrimSuffix(dest, "/")+"/")) {
+				continue
+			}
+			matched = dest
+			static.Mount = filepath.Clean(mount.Source)
+			static.Root = filepath.Join(static.Mount, filepath.FromSlash(strings.TrimPrefix(static.Path, dest)))
+		}
+		if len(static.Root) < 1 {
+			container.addProblem("PD_STATIC_"+forward.Name, static.Path, "path is not on container mounts")
+			forward.Static = nil
+			continue
+		}
+		if !inDir(static.Mount, static.Root) {
+			container.addProblem("PD_STATIC_"+forward.Name, static.Path, "path is outside of container mount")
+			forward.Static = nil
+		}
+	}
+}
+
+// ServeHTTP will serve the file of static site, the directory is redirected to trailing slash and served by index file,
+// the not found file is served by fallback file when it is configured, e.g. for single page application
+func (s *StaticSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	index := s.Index
+	if len(index) < 1 {
+		index = "index.html"
+	}
+	name := path.Clean("/" + r.URL.Path)
+	file, info, err := s.open(name)
+	if err == nil && info.IsDir() {
+		file.Close()
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := name + "/"
+			if len(r.URL.RawQuery) > 0 {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		name = path.Join(name, index)
+		file, info, err = s.open(name)
+	}
+	if err != nil && len(s.Fallback) > 0 {
+		name = path.Clean("/" + s.Fallback)
+		file, info, err = s.open(name)
+	}
+	if err != nil || info.IsDir() {
+		if file != nil {
+			file.Close()
+		}
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	if s.MaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%v", int64(s.MaxAge/time.Second)))
+	}
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// open will open the file of static site, the file which is linked to outside of Root is not found,
+// and the Root which is linked to outside of container Mount is not served
+func (s *StaticSite) open(name string) (file http.File, info os.FileInfo, err error) {
+	rootReal, err := filepath.EvalSymlinks(s.Root)
+	if err != nil {
+		return
+	}
+	if len(s.Mount) > 0 {
+		mountReal, xerr := filepath.EvalSymlinks(s.Mount)
+		if xerr != nil || !inDir(mountReal, rootReal) {
+			err = os.ErrNotExist
+			return
+		}
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(rootReal, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		return
+	}
+	if !inDir(rootReal, real) {
+		err = os.ErrNotExist
+		return
+	}
+	file, err = os.Open(real)
+	if err != nil {
+		return
+	}
+	if info, err = file.Stat(); err != nil {
+		file.Close()
+		file = nil
+	}
+	return
+}
@@ -0,0 +1,148 @@
+package discover
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestStatic(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "static")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "site", "docs"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("<html>home</html>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "site", "docs", "index.html"), []byte("<html>docs</html>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "site", "app.js"), []byte("app()"), 0644)
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    "0123456789abcdef",
+			Name:  "/site-srv-v1.0.0",
+			State: &types.ContainerState{Status: "running"},
+		},
+		Config: &container.Config{Labels: map[string]string{
+			"PD_HOST_WEB":            "www/",
+			"PD_STATIC_WEB":          "/data/site",
+			"PD_STATIC_MAX_AGE_WEB":  "1h",
+			"PD_STATIC_FALLBACK_WEB": "index.html",
+			"PD_HOST_APP":            "app/",
+			"PD_STATIC_APP":          "/none",
+		}},
+		Mounts: []types.MountPoint{{Type: "volume", Name: "site", Source: dir, Destination: "/data"}},
+	}
+	service, ok := discover.parseContainer(inspect, "127.0.0.1", true)
+	if !ok || len(service.Forwards) != 2 || len(service.Problems) != 1 || service.Forwards["www.v100.site"].Static.Root != filepath.Join(dir, "site") {
+		t.Errorf("%v,%v", service.Forwards, service.Problems)
+		return
+	}
+	discover.applyProxy(map[string]*Container{"www.v100.site": service})
+	call := func(method, uri string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, httptest.NewRequest(method, "http://www.v100.site.test.loc"+uri, nil))
+		return res
+	}
+	if res := call("GET", "/"); res.Code != http.StatusOK || res.Body.String() != "<html>home</html>" || res.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Errorf("%v,%v,%v", res.Code, res.Body.String(), res.Header())
+		return
+	}
+	if res := call("GET", "/app.js"); res.Code != http.StatusOK || res.Body.String() != "app()" {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res := call("GET", "/docs?a=1"); res.Code != http.StatusMovedPermanently || res.Header().Get("Location") != "/docs/?a=1" {
+		t.Errorf("%v,%v", res.Code, res.Header())
+		return
+	}
+	if res := call("GET", "/docs/"); res.Code != http.StatusOK || res.Body.String() != "<html>docs</html>" {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	//fallback
+	if res := call("GET", "/user/1"); res.Code != http.StatusOK || res.Body.String() != "<html>home</html>" {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res := call("POST", "/"); res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	//not found
+	static := &StaticSite{Root: filepath.Join(dir, "site")}
+	res := httptest.NewRecorder()
+	static.ServeHTTP(res, httptest.NewRequest("GET", "http://a.loc/../../etc/passwd", nil))
+	if res.Code != http.StatusNotFound {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	//link to outside of root
+	os.Symlink("/etc", filepath.Join(dir, "site", "etc"))
+	os.Symlink("/etc/hosts", filepath.Join(dir, "site", "hosts"))
+	for _, uri := range []string{"/etc/hosts", "/hosts"} {
+		if res := call("GET", uri); res.Code != http.StatusOK || res.Body.String() != "<html>home</html>" {
+			t.Errorf("%v,%v,%v", uri, res.Code, res.Body.String())
+			return
+		}
+	}
+	//mounts of remote docker
+	if service, _ = discover.parseContainer(inspect, "127.0.0.1", false); len(service.Problems) != 2 || service.Forwards["www.v100.site"].Static != nil {
+		t.Errorf("%v,%v", service.Forwards, service.Problems)
+		return
+	}
+	//host path
+	hostStatic := func(val string) (forward *Forward, container *Container) {
+		forward = &Forward{Name: "X"}
+		if err := parseStatic(forward, val); err != nil {
+			t.Error(err)
+			return
+		}
+		container = &Container{Forwards: map[string]*Forward{"x": forward}}
+		discover.resolveStatic(container, nil, true)
+		return
+	}
+	if forward, container := hostStatic("host:" + dir); forward.Static != nil || len(container.Problems) != 1 {
+		t.Errorf("%v,%v", forward.Static, container.Problems)
+		return
+	}
+	discover.StaticRoots = []string{filepath.Join(dir, "site")}
+	if forward, _ := hostStatic("host:" + filepath.Join(dir, "site", "docs")); forward.Static == nil || forward.Static.Root != filepath.Join(dir, "site", "docs") {
+		t.Error(forward.Static)
+		return
+	}
+	for _, val := range []string{"host:" + dir, "host:" + filepath.Join(dir, "site", "etc"), "host:/etc"} {
+		if forward, _ := hostStatic(val); forward.Static != nil {
+			t.Errorf("%v,%v", val, forward.Static)
+			return
+		}
+	}
+	for _, val := range []string{"data", "/data/../../../../etc", "host:" + dir + "/site/../../etc", "/data/site/.."} {
+		if err := parseStatic(&Forward{Name: "X"}, val); err == nil {
+			t.Error(val)
+			return
+		}
+	}
+	//traversal by label
+	inspect.Config.Labels = map[string]string{"PD_HOST_WEB": "www/", "PD_STATIC_WEB": "/data/../../../../etc"}
+	if service, _ = discover.parseContainer(inspect, "127.0.0.1", true); len(service.Problems) != 1 || service.Forwards["www.v100.site"].Static != nil {
+		t.Errorf("%v,%v", service.Forwards, service.Problems)
+		return
+	}
+	//root linked to outside of mount
+	os.Symlink("/etc", filepath.Join(dir, "escape"))
+	inspect.Config.Labels = map[string]string{"PD_HOST_WEB": "www/", "PD_STATIC_WEB": "/data/escape"}
+	if service, _ = discover.parseContainer(inspect, "127.0.0.1", true); service.Forwards["www.v100.site"].Static == nil {
+		t.Errorf("%v,%v", service.Forwards, service.Problems)
+		return
+	}
+	discover.applyProxy(map[string]*Container{"www.v100.site": service})
+	if res := call("GET", "/hosts"); res.Code != http.StatusNotFound {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+}
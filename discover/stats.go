@@ -0,0 +1,110 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// ResourceStats is the resource usage snapshot of container
+type ResourceStats struct {
+	CPUPercent  float64   `json:"cpu_percent"`
+	MemoryUsage uint64    `json:"memory_usage"`
+	MemoryLimit uint64    `json:"memory_limit"`
+	UpdateTime  time.Time `json:"update_time"`
+}
+
+func (r *ResourceStats) String() string {
+	return fmt.Sprintf("%.1f%% %.1fMiB", r.CPUPercent, float64(r.MemoryUsage)/1024/1024)
+}
+
+func newResourceStats(stats *types.StatsJSON) (resource *ResourceStats) {
+	resource = &ResourceStats{
+		MemoryUsage: stats.MemoryStats.Usage,
+		MemoryLimit: stats.MemoryStats.Limit,
+		UpdateTime:  stats.Read,
+	}
+	if cache, ok := stats.MemoryStats.Stats["cache"]; ok && cache < resource.MemoryUsage {
+		resource.MemoryUsage -= cache
+	}
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	online := float64(stats.CPUStats.OnlineCPUs)
+	if online < 1 {
+		online = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		resource.CPUPercent = cpuDelta / systemDelta * online * 100
+	}
+	return
+}
+
+// ResourceStats will return the last resource usage snapshot of container, it is nil when Stats is disabled or not collected
+func (d *Discover) ResourceStats(id string) (stats *ResourceStats) {
+	d.statsLock.RLock()
+	stats = d.statsAll[id]
+	d.statsLock.RUnlock()
+	return
+}
+
+// collectStats will collect resource usage snapshot of all discovered containers, it is skipped when last collecting is not done
+func (d *Discover) collectStats() {
+	d.statsLock.Lock()
+	if d.statsRunning {
+		d.statsLock.Unlock()
+		return
+	}
+	d.statsRunning = true
+	d.statsLock.Unlock()
+	defer func() {
+		d.statsLock.Lock()
+		d.statsRunning = false
+		d.statsLock.Unlock()
+	}()
+	ids := map[string]bool{}
+	d.proxyLock.RLock()
+	for _, service := range d.proxyAll {
+		if service.isDocker() {
+			ids[service.ID] = true
+		}
+	}
+	d.proxyLock.RUnlock()
+	cli, _, err := d.newDockerClient()
+	if err != nil {
+		WarnLog("Discover collect stats fail with %v", err)
+		return
+	}
+	statsAll := map[string]*ResourceStats{}
+	for id := range ids {
+		stats, err := d.loadStats(cli, id)
+		if err != nil {
+			DebugLog("Discover collect stats of %v fail with %v", id, err)
+			continue
+		}
+		statsAll[id] = stats
+	}
+	d.statsLock.Lock()
+	d.statsAll = statsAll
+	d.statsLock.Unlock()
+}
+
+func (d *Discover) loadStats(cli *client.Client, id string) (stats *ResourceStats, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := cli.ContainerStats(ctx, id, false)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	info := &types.StatsJSON{}
+	err = json.NewDecoder(res.Body).Decode(info)
+	if err != nil {
+		return
+	}
+	stats = newResourceStats(info)
+	return
+}
@@ -0,0 +1,57 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestStats(t *testing.T) {
+	info := &types.StatsJSON{}
+	info.CPUStats.CPUUsage.TotalUsage = 300
+	info.CPUStats.SystemUsage = 2000
+	info.CPUStats.OnlineCPUs = 2
+	info.PreCPUStats.CPUUsage.TotalUsage = 100
+	info.PreCPUStats.SystemUsage = 1000
+	info.MemoryStats.Usage = 3 * 1024 * 1024
+	info.MemoryStats.Limit = 10 * 1024 * 1024
+	info.MemoryStats.Stats = map[string]uint64{"cache": 1024 * 1024}
+	stats := newResourceStats(info)
+	if stats.CPUPercent != 40 || stats.MemoryUsage != 2*1024*1024 || stats.String() != "40.0% 2.0MiB" {
+		t.Error(stats.CPUPercent, stats.MemoryUsage, stats.String())
+		return
+	}
+	info.CPUStats.OnlineCPUs = 0
+	info.CPUStats.CPUUsage.PercpuUsage = []uint64{150, 150, 0, 0}
+	if stats := newResourceStats(info); stats.CPUPercent != 80 {
+		t.Error(stats.CPUPercent)
+		return
+	}
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.statsAll = map[string]*ResourceStats{"c1": stats}
+	if discover.ResourceStats("c1") != stats || discover.ResourceStats("c2") != nil {
+		t.Error("stats")
+		return
+	}
+	service := &Container{ID: "c1", Name: "ds", Version: "v1.0.0", Forwards: map[string]*Forward{"v100.ds": {Prefix: "v100.ds"}}}
+	discover.proxyAll["v100.ds"] = service
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://pdsrv/", nil))
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "<td>40.0% 2.0MiB</td>") {
+		t.Error(res.Code, res.Body.String())
+		return
+	}
+	discover.AdminToken = "123"
+	req := httptest.NewRequest("GET", "http://pdsrv/_api/catalog", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	res = httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if !strings.Contains(res.Body.String(), `"cpu_percent":40`) {
+		t.Error(res.Body.String())
+		return
+	}
+}
@@ -0,0 +1,100 @@
+package discover
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsD is the metrics emitter by StatsD/DogStatsD udp protocol, the tags is only sent on DogStatsD mode,
+// all method is safe to be called on nil StatsD
+type StatsD struct {
+	Addr      string
+	Prefix    string
+	Tags      []string
+	DogStatsD bool
+	conn      net.Conn
+	lock      sync.Mutex
+}
+
+// NewStatsD will create the StatsD emitter to addr
+func NewStatsD(addr, prefix string, tags []string, dogStatsD bool) (s *StatsD, err error) {
+	if _, _, err = net.SplitHostPort(addr); err != nil {
+		return
+	}
+	s = &StatsD{Addr: addr, Prefix: prefix, Tags: tags, DogStatsD: dogStatsD}
+	return
+}
+
+var statsdReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+func (s *StatsD) send(name, value, kind string, tags []string) {
+	line := fmt.Sprintf("%v%v:%v|%v", s.Prefix, name, value, kind)
+	if s.DogStatsD && len(s.Tags)+len(tags) > 0 {
+		all := []string{}
+		for _, tag := range append(append([]string{}, s.Tags...), tags...) {
+			all = append(all, statsdReplacer.Replace(tag))
+		}
+		line += "|#" + strings.Join(all, ",")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		conn, err := net.Dial("udp", s.Addr)
+		if err != nil {
+			DebugLog("Discover dial statsd %v fail with %v", s.Addr, err)
+			return
+		}
+		s.conn = conn
+	}
+	if _, err := s.conn.Write([]byte(line)); err != nil {
+		DebugLog("Discover send statsd to %v fail with %v", s.Addr, err)
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Count will send the counter metric
+func (s *StatsD) Count(name string, n int64, tags ...string) {
+	if s != nil {
+		s.send(name, fmt.Sprintf("%v", n), "c", tags)
+	}
+}
+
+// Gauge will send the gauge metric
+func (s *StatsD) Gauge(name string, v int64, tags ...string) {
+	if s != nil {
+		s.send(name, fmt.Sprintf("%v", v), "g", tags)
+	}
+}
+
+// Timing will send the timer metric in milliseconds
+func (s *StatsD) Timing(name string, used time.Duration, tags ...string) {
+	if s != nil {
+		s.send(name, fmt.Sprintf("%v", int64(used/time.Millisecond)), "ms", tags)
+	}
+}
+
+// Close will close the udp connection
+func (s *StatsD) Close() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.lock.Unlock()
+}
+
+// statusClass will return the status class like 2xx of status code
+func statusClass(status int) string {
+	if status < 100 {
+		status = http.StatusOK
+	}
+	return fmt.Sprintf("%vxx", status/100)
+}
@@ -0,0 +1,79 @@
+package discover
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsD(t *testing.T) {
+	conn, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	defer conn.Close()
+	read := func() string {
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return ""
+		}
+		return string(buf[:n])
+	}
+	if _, err := NewStatsD("xx", "", nil, false); err == nil {
+		t.Error(err)
+		return
+	}
+	statsd, _ := NewStatsD(conn.LocalAddr().String(), "pd.", []string{"env:test"}, false)
+	defer statsd.Close()
+	statsd.Count("a", 2, "x:1")
+	if v := read(); v != "pd.a:2|c" {
+		t.Error(v)
+		return
+	}
+	statsd.DogStatsD = true
+	statsd.Gauge("b", 3, "x:1,2")
+	if v := read(); v != "pd.b:3|g|#env:test,x:1_2" {
+		t.Error(v)
+		return
+	}
+	statsd.Timing("c", 1500*time.Millisecond)
+	if v := read(); v != "pd.c:1500|ms|#env:test" {
+		t.Error(v)
+		return
+	}
+	var none *StatsD
+	none.Count("a", 1)
+	none.Close()
+	//request
+	discover := NewDiscover()
+	discover.StatsD = statsd
+	statsd.Tags = nil
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+	forward := &Forward{Name: "web", Type: "http", Prefix: "v1.ds", URI: strings.TrimPrefix(ts.URL, "http://")}
+	proxy, err := discover.newReverseProxy(forward)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	discover.proxyReverse["v1.ds"] = &ReverseProxy{Reverse: proxy, Forward: forward, Service: &Container{Name: "ds"}}
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://v1.ds/", nil))
+	if v := read(); res.Code != http.StatusCreated || v != "pd.request:1|c|#service:ds,forward:web,status:2xx" {
+		t.Error(res.Code, v)
+		return
+	}
+	if v := read(); !strings.HasPrefix(v, "pd.request.duration:") {
+		t.Error(v)
+		return
+	}
+	discover.recordTrigger("added", time.Second, nil, nil)
+	if v := read(); v != "pd.trigger:1|c|#trigger:added,result:success" {
+		t.Error(v)
+		return
+	}
+}
@@ -0,0 +1,179 @@
+package discover
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// streamComment is the sse comment which is sent as keep-alive when the event stream is idle
+var streamComment = []byte(": keep-alive\n\n")
+
+// deadlineWriter is the response writer which supports to set the write deadline of connection
+type deadlineWriter interface {
+	SetWriteDeadline(deadline time.Time) error
+}
+
+// isEventStream will return if the content type of header is text/event-stream
+func isEventStream(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// streamWriter will extend the write deadline of streaming response on every write, the response is streaming
+// when it is text/event-stream or the forward is marked as stream by PD_STREAM label
+type streamWriter struct {
+	http.ResponseWriter
+	timeout   time.Duration
+	streaming bool
+}
+
+func (s *streamWriter) extend() {
+	setter, ok := s.ResponseWriter.(deadlineWriter)
+	if !ok {
+		return
+	}
+	deadline := time.Time{}
+	if s.timeout > 0 {
+		deadline = time.Now().Add(s.timeout)
+	}
+	setter.SetWriteDeadline(deadline)
+}
+
+func (s *streamWriter) WriteHeader(code int) {
+	if !s.streaming && isEventStream(s.Header()) {
+		s.streaming = true
+	}
+	if s.streaming {
+		s.Header().Set("X-Accel-Buffering", "no")
+		s.extend()
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *streamWriter) Write(p []byte) (n int, err error) {
+	if s.streaming {
+		s.extend()
+	}
+	n, err = s.ResponseWriter.Write(p)
+	return
+}
+
+func (s *streamWriter) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// serveProxy will proxy the request to forward by stream policy, the write deadline of long-poll forward is extended
+// before waiting the backend response, the websocket is proxied by websocket policy
+func (d *Discover) serveProxy(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy) {
+	if isWebSocket(r) {
+		d.serveWebSocket(w, r, reverse)
+		return
+	}
+	if len(r.Header.Get("Upgrade")) > 0 {
+		reverse.Reverse.ServeHTTP(w, r)
+		return
+	}
+	writer := &streamWriter{ResponseWriter: w, timeout: d.StreamWriteTimeout, streaming: reverse.Forward.Stream}
+	if writer.streaming {
+		writer.extend()
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &clientBody{ReadCloser: r.Body}
+	}
+	reverse.Reverse.ServeHTTP(writer, r)
+}
+
+// keepAliveStream will send the sse comment when the event stream response is idle in StreamKeepAlive
+func (d *Discover) keepAliveStream(res *http.Response) {
+	if d.StreamKeepAlive <= 0 || !isEventStream(res.Header) {
+		return
+	}
+	res.Body = newStreamBody(res.Body, d.StreamKeepAlive)
+}
+
+type streamChunk struct {
+	data []byte
+	err  error
+}
+
+// streamBody will read the backend body in background and return the keep-alive comment when it is idle,
+// the comment is only inserted between events
+type streamBody struct {
+	body    io.ReadCloser
+	idle    time.Duration
+	chunks  chan *streamChunk
+	done    chan int
+	pending []byte
+	err     error
+	last    [2]byte
+	closer  sync.Once
+}
+
+func newStreamBody(body io.ReadCloser, idle time.Duration) (stream *streamBody) {
+	stream = &streamBody{
+		body:   body,
+		idle:   idle,
+		chunks: make(chan *streamChunk),
+		done:   make(chan int),
+		last:   [2]byte{'\n', '\n'},
+	}
+	go stream.run()
+	return
+}
+
+func (s *streamBody) run() {
+	for {
+		buffer := make([]byte, 32*1024)
+		n, err := s.body.Read(buffer)
+		select {
+		case s.chunks <- &streamChunk{data: buffer[:n], err: err}:
+		case <-s.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *streamBody) Read(p []byte) (n int, err error) {
+	for len(s.pending) < 1 && s.err == nil {
+		timer := time.NewTimer(s.idle)
+		select {
+		case chunk := <-s.chunks:
+			s.pending, s.err = chunk.data, chunk.err
+		case <-timer.C:
+			if s.last[0] == '\n' && s.last[1] == '\n' {
+				n = copy(p, streamComment)
+				return
+			}
+		case <-s.done:
+			s.err = io.ErrClosedPipe
+		}
+		timer.Stop()
+	}
+	n = copy(p, s.pending)
+	s.pending = s.pending[n:]
+	if n > 1 {
+		s.last = [2]byte{p[n-2], p[n-1]}
+	} else if n == 1 {
+		s.last = [2]byte{s.last[1], p[0]}
+	}
+	if len(s.pending) < 1 && s.err != nil {
+		err = s.err
+	}
+	return
+}
+
+func (s *streamBody) Close() (err error) {
+	s.closer.Do(func() {
+		close(s.done)
+		err = s.body.Close()
+	})
+	return
+}
@@ -0,0 +1,116 @@
+package discover
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadlines []time.Time
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	d.deadlines = append(d.deadlines, deadline)
+	return nil
+}
+
+func TestStreamKeepAlive(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		w.Write([]byte("data: a\n\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("data: b\n\n"))
+	}))
+	defer backend.Close()
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.StreamKeepAlive = 50 * time.Millisecond
+	discover.applyProxy(map[string]*Container{"v100.ds": {ID: "c1", Name: "ds", Version: "1.0.0", Forwards: map[string]*Forward{
+		"v100.ds": {Name: "web", Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://")},
+	}}})
+	ts := httptest.NewServer(discover)
+	defer ts.Close()
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Host = "v100.ds.test.loc"
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer res.Body.Close()
+	if res.Header.Get("X-Accel-Buffering") != "no" {
+		t.Error(res.Header)
+		return
+	}
+	reader := bufio.NewReader(res.Body)
+	lines := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	all := strings.Join(lines, "|")
+	if !strings.HasPrefix(all, "data: a||: keep-alive|") || !strings.HasSuffix(all, "data: b|") {
+		t.Error(all)
+		return
+	}
+}
+
+func TestStreamBody(t *testing.T) {
+	//not inserted in event
+	reader, writer := io.Pipe()
+	body := newStreamBody(reader, 20*time.Millisecond)
+	go func() {
+		writer.Write([]byte("data: a\n"))
+		time.Sleep(100 * time.Millisecond)
+		writer.Write([]byte("\n"))
+		writer.Close()
+	}()
+	data, _ := ioutil.ReadAll(body)
+	if string(data) != "data: a\n\n" {
+		t.Error(string(data))
+		return
+	}
+	body.Close()
+	body.Close()
+}
+
+func TestStreamWriter(t *testing.T) {
+	recorder := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	writer := &streamWriter{ResponseWriter: recorder, timeout: time.Second}
+	writer.WriteHeader(http.StatusOK)
+	writer.Write([]byte("ok"))
+	if len(recorder.deadlines) != 0 {
+		t.Error(recorder.deadlines)
+		return
+	}
+	recorder = &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	writer = &streamWriter{ResponseWriter: &statusWriter{ResponseWriter: recorder}, timeout: time.Second}
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write([]byte("data: a\n\n"))
+	writer.Flush()
+	if len(recorder.deadlines) != 2 || time.Until(recorder.deadlines[1]) <= 0 || !recorder.Flushed {
+		t.Error(recorder.deadlines)
+		return
+	}
+	//long-poll forward
+	writer = &streamWriter{ResponseWriter: recorder, streaming: true}
+	writer.extend()
+	if !recorder.deadlines[2].IsZero() {
+		t.Error(recorder.deadlines)
+		return
+	}
+}
@@ -0,0 +1,91 @@
+package discover
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// ChangeAdded is the event type of forward added
+	ChangeAdded = "added"
+	// ChangeUpdated is the event type of forward updated
+	ChangeUpdated = "updated"
+	// ChangeRemoved is the event type of forward removed
+	ChangeRemoved = "removed"
+)
+
+// ChangeEvent is the change of forward which is emitted to subscribers after refresh
+type ChangeEvent struct {
+	Type      string     `json:"type"`
+	Prefix    string     `json:"prefix"`
+	Container *Container `json:"container"`
+	Forward   *Forward   `json:"forward"`
+	At        time.Time  `json:"at"`
+}
+
+// changeSubscriber is the subscriber of change events, the event is dropped when the subscriber is slow
+type changeSubscriber struct {
+	events  chan ChangeEvent
+	dropped int64
+}
+
+// Subscribe will return the channel receiving the added/updated/removed event of forwards after each refresh,
+// the channel is buffered by SubscribeBuffer and the event is dropped when it is full, so the receiver must not be blocked,
+// the channel is closed by Unsubscribe
+func (d *Discover) Subscribe() <-chan ChangeEvent {
+	sub := &changeSubscriber{events: make(chan ChangeEvent, d.SubscribeBuffer)}
+	d.subscribeLock.Lock()
+	if d.subscribeAll == nil {
+		d.subscribeAll = map[<-chan ChangeEvent]*changeSubscriber{}
+	}
+	d.subscribeAll[sub.events] = sub
+	d.subscribeLock.Unlock()
+	return sub.events
+}
+
+// Unsubscribe will stop the subscription and close the channel returned by Subscribe
+func (d *Discover) Unsubscribe(events <-chan ChangeEvent) {
+	d.subscribeLock.Lock()
+	sub := d.subscribeAll[events]
+	delete(d.subscribeAll, events)
+	d.subscribeLock.Unlock()
+	if sub != nil {
+		close(sub.events)
+	}
+}
+
+func appendChanges(events []ChangeEvent, kind string, services map[string]*Container, now time.Time) []ChangeEvent {
+	prefixes := []string{}
+	for prefix := range services {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		service := services[prefix]
+		events = append(events, ChangeEvent{Type: kind, Prefix: prefix, Container: service, Forward: service.Forwards[prefix], At: now})
+	}
+	return events
+}
+
+// publishChanges will emit the change events to all subscribers by removed, added, updated order
+func (d *Discover) publishChanges(added, updated, removed map[string]*Container) {
+	d.subscribeLock.Lock()
+	defer d.subscribeLock.Unlock()
+	if len(d.subscribeAll) < 1 || len(added)+len(updated)+len(removed) < 1 {
+		return
+	}
+	now := time.Now()
+	events := appendChanges(nil, ChangeRemoved, removed, now)
+	events = appendChanges(events, ChangeAdded, added, now)
+	events = appendChanges(events, ChangeUpdated, updated, now)
+	for _, sub := range d.subscribeAll {
+		for _, event := range events {
+			select {
+			case sub.events <- event:
+			default:
+				sub.dropped++
+				WarnLog("Discover subscriber is slow, the %v event of %v is dropped, %v dropped", event.Type, event.Prefix, sub.dropped)
+			}
+		}
+	}
+}
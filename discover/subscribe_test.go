@@ -0,0 +1,46 @@
+package discover
+
+import (
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	discover := NewDiscover()
+	discover.SubscribeBuffer = 3
+	service := &Container{ID: "c1", Name: "ds", Version: "v1.0.0", Forwards: map[string]*Forward{
+		"v100.ds":     {Prefix: "v100.ds", Type: "http"},
+		"tcp://:2022": {Prefix: "tcp://:2022", Type: "tcp"},
+	}}
+	discover.publishChanges(map[string]*Container{"v100.ds": service}, nil, nil)
+	events := discover.Subscribe()
+	discover.publishChanges(
+		map[string]*Container{"v100.ds": service, "tcp://:2022": service},
+		map[string]*Container{"v100.ds": service},
+		map[string]*Container{"v101.ds": {ID: "c0", Forwards: map[string]*Forward{"v101.ds": {Prefix: "v101.ds"}}}},
+	)
+	expect := []string{"removed:v101.ds", "added:tcp://:2022", "added:v100.ds"}
+	for _, e := range expect {
+		event := <-events
+		if event.Type+":"+event.Prefix != e || event.Forward == nil || event.Forward.Prefix != event.Prefix || event.At.IsZero() {
+			t.Errorf("%v,%v", e, event)
+			return
+		}
+	}
+	select {
+	case event := <-events:
+		t.Error(event)
+		return
+	default:
+	}
+	if sub := discover.subscribeAll[events]; sub == nil || sub.dropped != 1 {
+		t.Error(sub)
+		return
+	}
+	discover.Unsubscribe(events)
+	discover.Unsubscribe(events)
+	if _, ok := <-events; ok {
+		t.Error("not closed")
+		return
+	}
+	discover.publishChanges(map[string]*Container{"v100.ds": service}, nil, nil)
+}
@@ -0,0 +1,131 @@
+package discover
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/codingeasygo/util/debug"
+	"github.com/codingeasygo/util/xmap"
+)
+
+type superviseState struct {
+	Failures int
+	Healthy  int
+	Attempts int
+	NextAt   time.Time
+	GaveUp   bool
+}
+
+// checkHealthy will check the container by docker healthcheck, the synthetic probe and the breaker of forwards
+func (d *Discover) checkHealthy(service *Container) bool {
+	if service.Health == "unhealthy" || d.probeFailing(service) {
+		return false
+	}
+	if d.BreakerFailures < 1 {
+		return true
+	}
+	d.breakerLock.Lock()
+	defer d.breakerLock.Unlock()
+	for prefix := range service.Forwards {
+		if state := d.breakers[prefix]; state != nil && state.Failures >= d.BreakerFailures {
+			return false
+		}
+	}
+	return true
+}
+
+// notifySupervisor will call the unhealthy webhook of container and SupervisorHook
+func (d *Discover) notifySupervisor(service *Container, state *superviseState, action string, err error) {
+	info := xmap.M{
+		"event":    "unhealthy",
+		"action":   action,
+		"id":       service.ID,
+		"name":     service.Name,
+		"version":  service.Version,
+		"status":   service.Status,
+		"health":   service.Health,
+		"attempts": state.Attempts,
+	}
+	if err != nil {
+		info["error"] = err.Error()
+	}
+	data, _ := json.Marshal(info)
+	for _, uri := range []string{service.Hooks["unhealthy"], d.SupervisorHook} {
+		if len(uri) > 0 {
+			go d.callHook(service, "unhealthy", uri, data)
+		}
+	}
+}
+
+// callSupervisor will restart the container which is unhealthy for SupervisorThreshold consecutive refresh,
+// the restart is delayed by exponential backoff from SupervisorBackoff and given up after SupervisorMax attempts,
+// the attempts is reset after container is healthy for SupervisorThreshold consecutive refresh
+func (d *Discover) callSupervisor() {
+	defer func() {
+		if xerr := recover(); xerr != nil {
+			ErrorLog("Discover call supervisor panic with %v, call stack is:\n%v", xerr, debug.CallStatck())
+		}
+	}()
+	if !d.Supervisor {
+		return
+	}
+	now := time.Now()
+	services := map[string]*Container{}
+	d.proxyLock.RLock()
+	for _, service := range d.proxyAll {
+		if service.isDocker() {
+			services[service.ID] = service
+		}
+	}
+	d.proxyLock.RUnlock()
+	if d.superviseAll == nil {
+		d.superviseAll = map[string]*superviseState{}
+	}
+	for id := range d.superviseAll {
+		if services[id] == nil {
+			delete(d.superviseAll, id)
+		}
+	}
+	for id, service := range services {
+		state := d.superviseAll[id]
+		if state == nil {
+			state = &superviseState{}
+			d.superviseAll[id] = state
+		}
+		if d.checkHealthy(service) {
+			state.Failures = 0
+			state.Healthy++
+			if state.Healthy >= d.SupervisorThreshold && state.Attempts > 0 {
+				InfoLog("Discover supervisor %v/%v is recovered after %v attempts", service.Name, id, state.Attempts)
+				state.Attempts, state.GaveUp = 0, false
+			}
+			continue
+		}
+		state.Healthy = 0
+		state.Failures++
+		if state.Failures < d.SupervisorThreshold || now.Before(state.NextAt) || state.GaveUp {
+			continue
+		}
+		if state.Attempts >= d.SupervisorMax {
+			WarnLog("Discover supervisor %v/%v is given up after %v attempts", service.Name, id, state.Attempts)
+			state.GaveUp = true
+			d.notifySupervisor(service, state, "give_up", nil)
+			continue
+		}
+		if d.IsReadOnly() {
+			DebugLog("Discover supervisor %v/%v is unhealthy, restart is skipped on read only", service.Name, id)
+			continue
+		}
+		err := d.restartContainer(id)
+		state.Attempts++
+		state.Failures = 0
+		state.NextAt = now.Add(d.SupervisorBackoff * time.Duration(1<<uint(state.Attempts-1)))
+		d.recordTrigger("supervisor", time.Since(now), nil, err)
+		if err != nil {
+			WarnLog("Discover supervisor restart %v/%v fail with %v", service.Name, id, err)
+		} else {
+			InfoLog("Discover supervisor restart %v/%v by %v attempts, next is after %v", service.Name, id, state.Attempts, state.NextAt)
+		}
+		d.notifySupervisor(service, state, "restart", err)
+	}
+}
@@ -0,0 +1,80 @@
+package discover
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSupervisor(t *testing.T) {
+	notified := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		notified <- r.Header.Get("X-PD-Event") + " " + string(data)
+	}))
+	defer ts.Close()
+	discover := NewDiscover()
+	discover.Supervisor = true
+	discover.SupervisorThreshold = 2
+	discover.SupervisorBackoff = time.Hour
+	discover.SupervisorMax = 1
+	discover.SupervisorHook = ts.URL
+	service := &Container{ID: "c1", Name: "ds", Health: "unhealthy", Forwards: map[string]*Forward{"v100.ds": {Prefix: "v100.ds"}}}
+	discover.proxyAll["v100.ds"] = service
+	discover.callSupervisor()
+	if state := discover.superviseAll["c1"]; state.Failures != 1 || state.Attempts != 0 {
+		t.Error(state)
+		return
+	}
+	discover.callSupervisor()
+	if state := discover.superviseAll["c1"]; state.Failures != 0 || state.Attempts != 1 || !state.NextAt.After(time.Now()) {
+		t.Error(state)
+		return
+	}
+	if info := <-notified; !strings.HasPrefix(info, "unhealthy ") || !strings.Contains(info, `"action":"restart"`) {
+		t.Error(info)
+		return
+	}
+	//backoff
+	discover.callSupervisor()
+	discover.callSupervisor()
+	if state := discover.superviseAll["c1"]; state.Attempts != 1 || state.GaveUp {
+		t.Error(state)
+		return
+	}
+	//give up
+	discover.superviseAll["c1"].NextAt = time.Time{}
+	discover.callSupervisor()
+	if state := discover.superviseAll["c1"]; !state.GaveUp {
+		t.Error(state)
+		return
+	}
+	if info := <-notified; !strings.Contains(info, `"action":"give_up"`) {
+		t.Error(info)
+		return
+	}
+	//recover
+	service.Health = "healthy"
+	discover.callSupervisor()
+	discover.callSupervisor()
+	if state := discover.superviseAll["c1"]; state.Attempts != 0 || state.GaveUp {
+		t.Error(state)
+		return
+	}
+	//breaker
+	discover.BreakerFailures = 1
+	discover.doneBreaker("v100.ds", false, true)
+	if discover.checkHealthy(service) {
+		t.Error("healthy")
+		return
+	}
+	delete(discover.proxyAll, "v100.ds")
+	discover.callSupervisor()
+	if len(discover.superviseAll) != 0 {
+		t.Error(discover.superviseAll)
+		return
+	}
+}
@@ -0,0 +1,144 @@
+package discover
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+	"golang.org/x/net/websocket"
+)
+
+// TapEvent is the summary of one request flowing through the tapped forward
+type TapEvent struct {
+	At         time.Time     `json:"at"`
+	Host       string        `json:"host"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version"`
+	RemoteAddr string        `json:"remote_addr"`
+	Method     string        `json:"method"`
+	Path       string        `json:"path"`
+	Status     int           `json:"status"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// tapSubscriber is the subscriber of tap events on host, the event is dropped when the subscriber is slow
+type tapSubscriber struct {
+	host    string
+	percent int
+	events  chan *TapEvent
+	dropped int64
+}
+
+// subscribeTap will add the subscriber of request on host, the percent of requests is sampled
+func (d *Discover) subscribeTap(host string, percent int) (sub *tapSubscriber) {
+	sub = &tapSubscriber{host: host, percent: percent, events: make(chan *TapEvent, d.TapBuffer)}
+	d.tapLock.Lock()
+	if d.tapAll == nil {
+		d.tapAll = map[*tapSubscriber]bool{}
+	}
+	d.tapAll[sub] = true
+	atomic.StoreInt32(&d.tapCount, int32(len(d.tapAll)))
+	d.tapLock.Unlock()
+	InfoLog("Discover tap on %v is started by %v%%", host, percent)
+	return
+}
+
+func (d *Discover) unsubscribeTap(sub *tapSubscriber) {
+	d.tapLock.Lock()
+	delete(d.tapAll, sub)
+	atomic.StoreInt32(&d.tapCount, int32(len(d.tapAll)))
+	d.tapLock.Unlock()
+	InfoLog("Discover tap on %v is stopped with %v dropped", sub.host, atomic.LoadInt64(&sub.dropped))
+}
+
+// tapping will return if any tap subscriber is existed
+func (d *Discover) tapping() bool {
+	return atomic.LoadInt32(&d.tapCount) > 0
+}
+
+// publishTap will send the request summary to tap subscribers of forward host
+func (d *Discover) publishTap(r *http.Request, reverse *ReverseProxy, begin time.Time, used time.Duration, status int) {
+	if !d.tapping() {
+		return
+	}
+	host := d.hostOf(reverse.Forward.Tenant, reverse.Forward.Prefix)
+	var event *TapEvent
+	d.tapLock.Lock()
+	defer d.tapLock.Unlock()
+	for sub := range d.tapAll {
+		if sub.host != host || sub.percent < 100 && rand.Intn(100) >= sub.percent {
+			continue
+		}
+		if event == nil {
+			event = &TapEvent{
+				At:         begin,
+				Host:       host,
+				Name:       reverse.Service.Name,
+				Version:    reverse.Service.Version,
+				RemoteAddr: r.RemoteAddr,
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     status,
+				Duration:   used,
+			}
+		}
+		select {
+		case sub.events <- event:
+		default:
+			atomic.AddInt64(&sub.dropped, 1)
+		}
+	}
+}
+
+// procAdminTap will stream the sampled request summary of forward host by websocket as json message
+func (d *Discover) procAdminTap(w http.ResponseWriter, r *http.Request) {
+	host := r.FormValue("host")
+	if len(host) < 1 {
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": "host is required"})
+		return
+	}
+	percent := 100
+	if value := r.FormValue("percent"); len(value) > 0 {
+		var err error
+		percent, err = strconv.Atoi(value)
+		if err != nil || percent < 1 || percent > 100 {
+			writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": fmt.Sprintf("invalid percent %v", value)})
+			return
+		}
+	}
+	if d.findReverse(host) == nil {
+		writeJSON(w, http.StatusNotFound, xmap.M{"code": http.StatusNotFound, "message": fmt.Sprintf("forward %v is not found", host)})
+		return
+	}
+	InfoLog("Discover audit tap on %v is opened from %v", host, r.RemoteAddr)
+	proc := func(c *websocket.Conn) {
+		defer c.Close()
+		sub := d.subscribeTap(host, percent)
+		defer d.unsubscribeTap(sub)
+		closed := make(chan int)
+		go func() {
+			var message string
+			for websocket.Message.Receive(c, &message) == nil {
+			}
+			close(closed)
+		}()
+		for {
+			select {
+			case event := <-sub.events:
+				if err := websocket.JSON.Send(c, event); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}
+	wsService := websocket.Server{
+		Handler: proc,
+	}
+	wsService.ServeHTTP(w, r)
+}
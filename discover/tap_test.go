@@ -0,0 +1,89 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingeasygo/util/converter"
+)
+
+func TestTap(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer backend.Close()
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.HostSuff = ".test.loc"
+	discover.AdminToken = "123"
+	discover.TapBuffer = 2
+	forward := &Forward{Name: "web", Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://")}
+	service := &Container{ID: "c1", Name: "ds", Version: "1.0.0", Forwards: map[string]*Forward{"v100.ds": forward}}
+	proxy, _ := discover.newReverseProxy(forward)
+	discover.proxyReverse["v100.ds.test.loc"] = &ReverseProxy{Forward: forward, Reverse: proxy, Service: service}
+	discover.proxyAll["v100.ds"] = service
+	send := func(path string) {
+		discover.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://v100.ds.test.loc"+path, nil))
+	}
+	send("/")
+	if discover.tapping() {
+		t.Error("error")
+		return
+	}
+	sub := discover.subscribeTap("v100.ds.test.loc", 100)
+	other := discover.subscribeTap("v200.ds.test.loc", 100)
+	send("/missing")
+	select {
+	case event := <-sub.events:
+		if event.Method != "GET" || event.Path != "/missing" || event.Status != http.StatusNotFound || event.Version != "1.0.0" || event.Duration <= 0 {
+			t.Error(converter.JSON(event))
+			return
+		}
+	case <-time.After(time.Second):
+		t.Error("not published")
+		return
+	}
+	if len(other.events) != 0 {
+		t.Error("error")
+		return
+	}
+	//slow subscriber
+	for i := 0; i < 4; i++ {
+		send("/")
+	}
+	if len(sub.events) != 2 || sub.dropped != 2 {
+		t.Errorf("%v,%v", len(sub.events), sub.dropped)
+		return
+	}
+	discover.unsubscribeTap(sub)
+	discover.unsubscribeTap(other)
+	if discover.tapping() {
+		t.Error("error")
+		return
+	}
+	//admin
+	call := func(path string) (res *httptest.ResponseRecorder) {
+		req := httptest.NewRequest("GET", "http://pdsrv"+path, nil)
+		req.Header.Set("Authorization", "Bearer 123")
+		res = httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return
+	}
+	if res := call("/_api/tap"); res.Code != http.StatusBadRequest {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res := call("/_api/tap?host=v100.ds.test.loc&percent=0"); res.Code != http.StatusBadRequest {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	if res := call("/_api/tap?host=xx.test.loc"); res.Code != http.StatusNotFound {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+}
@@ -0,0 +1,123 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Tenant is the partition of services by PD_TENANT label, the services of tenant are only visible and controlled by tenant
+type Tenant struct {
+	Name       string
+	HostSuff   string
+	HostSelf   string
+	AdminToken string
+	Quota      *Quota
+}
+
+var tenantNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9\-]*$`)
+
+// ValidTenant will check if tenant name can be used as host label
+func ValidTenant(name string) bool {
+	return tenantNameRegexp.MatchString(name)
+}
+
+// hostOf will return the host of forward prefix, the prefix of tenant service is ended by .<tenant> and replaced by tenant host suffix if it is configured
+func (d *Discover) hostOf(tenant, prefix string) string {
+	if t := d.Tenants[tenant]; len(tenant) > 0 && t != nil && len(t.HostSuff) > 0 {
+		return strings.TrimSuffix(prefix, "."+tenant) + t.HostSuff
+	}
+	return prefix + d.HostSuff
+}
+
+// isTenantPrefix will check if the http prefix is ended by .<tenant> of configured tenant which is not served on
+// host suffix, so the service without tenant can't take the host of tenant service
+func (d *Discover) isTenantPrefix(prefix string) bool {
+	for name, t := range d.Tenants {
+		if len(t.HostSuff) < 1 && strings.HasSuffix(prefix, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// foreignTenantHost will check if the host is ended by .<tenant> of configured tenant which is not the tenant,
+// so the alias and pattern of container can't take the host of other tenant
+func (d *Discover) foreignTenantHost(tenant, host string) bool {
+	host = strings.ToLower(host)
+	for name := range d.Tenants {
+		if name != tenant && strings.HasSuffix(host, "."+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// selfTenant will return the tenant which is served on host, the empty tenant is returned for HostSelf
+func (d *Discover) selfTenant(host string) (tenant string, ok bool) {
+	if host == d.HostSelf {
+		ok = true
+		return
+	}
+	for name, t := range d.Tenants {
+		if len(t.HostSelf) > 0 && t.HostSelf == host {
+			tenant, ok = name, true
+			return
+		}
+	}
+	return
+}
+
+// adminTenant will return the tenant by admin token, the nil tenant is returned for AdminToken which can access all services
+func (d *Discover) adminTenant(token string) (tenant *Tenant, ok bool) {
+	if len(token) < 1 {
+		return
+	}
+	if VerifyToken(d.AdminToken, token) {
+		ok = true
+		return
+	}
+	for _, t := range d.Tenants {
+		if VerifyToken(t.AdminToken, token) {
+			tenant, ok = t, true
+			return
+		}
+	}
+	return
+}
+
+func (d *Discover) adminEnabled() bool {
+	if len(d.AdminToken) > 0 || len(d.RoleTokens) > 0 || d.LDAP != nil {
+		return true
+	}
+	for _, t := range d.Tenants {
+		if len(t.AdminToken) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func inTenant(tenant *Tenant, service *Container) bool {
+	return tenant == nil || tenant.Name == service.Tenant
+}
+
+// checkTenantContainer will check if the container is belong to the tenant of service
+func (d *Discover) checkTenantContainer(service *Container, containerID string) (err error) {
+	if len(service.Tenant) < 1 || containerID == service.ID {
+		return
+	}
+	cli, _, err := d.newDockerClient()
+	if err != nil {
+		return
+	}
+	inspect, err := cli.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return
+	}
+	if inspect.Config == nil || labelTenant(inspect.Config.Labels) != service.Tenant {
+		err = fmt.Errorf("not access")
+	}
+	return
+}
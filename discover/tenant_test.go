@@ -0,0 +1,168 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestTenant(t *testing.T) {
+	if !ValidTenant("team-a") || ValidTenant("Team") || ValidTenant("-a") || ValidTenant("") {
+		t.Error("valid")
+		return
+	}
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.HostSuff = ".test.loc"
+	discover.Tenants["team-a"] = &Tenant{Name: "team-a", HostSuff: ".a.loc", HostSelf: "pdsrv.a.loc", AdminToken: "a123"}
+	discover.Tenants["team-b"] = &Tenant{Name: "team-b", AdminToken: "b123"}
+	if host := discover.hostOf("team-a", "v100.ds.team-a"); host != "v100.ds.a.loc" {
+		t.Error(host)
+		return
+	}
+	if host := discover.hostOf("team-b", "v100.ds.team-b"); host != "v100.ds.team-b.test.loc" {
+		t.Error(host)
+		return
+	}
+	if host := discover.hostOf("", "v100.ds"); host != "v100.ds.test.loc" {
+		t.Error(host)
+		return
+	}
+	if discover.isTenantPrefix("v100.ds.team-a") || !discover.isTenantPrefix("v100.ds.team-b") || discover.isTenantPrefix("v100.ds") {
+		t.Error("tenant prefix")
+		return
+	}
+	owner := &Container{ID: "b2", Name: "ds", Tenant: "team-b", StartedAt: "2026-01-01T00:00:00Z"}
+	stranger := &Container{ID: "c2", Name: "ds", Tenant: "team-c", StartedAt: "2026-01-01T00:00:01Z"}
+	if !discover.preferContainer("v100.ds.team-b", owner, stranger) || discover.preferContainer("v100.ds.team-b", stranger, owner) {
+		t.Error("prefer owner")
+		return
+	}
+	//alias and pattern can't take the host of other tenant
+	if !discover.isManagedHost("x.a.loc") || !discover.foreignTenantHost("", "api.team-b") || discover.foreignTenantHost("team-b", "api.team-b") {
+		t.Error("tenant host")
+		return
+	}
+	aliasC := &Container{Tenant: "team-c", Forwards: map[string]*Forward{"v100.ds.team-c": {Name: "WWW", Aliases: []string{"api.team-b", "x.a.loc", "api.example.com"}}}}
+	discover.checkAliases(aliasC)
+	if aliases := aliasC.Forwards["v100.ds.team-c"].Aliases; len(aliases) != 1 || aliases[0] != "api.example.com" {
+		t.Error(aliases)
+		return
+	}
+	discover.MatchDomains = []string{"example.com", "team-b"}
+	discover.proxyReverse["v100.ds.team-c"] = &ReverseProxy{Forward: &Forward{Prefix: "v100.ds.team-c", Tenant: "team-c", Matches: []string{"*.example.com", "re:.*"}}}
+	discover.rebuildPattern()
+	if discover.findReverse("www.example.com") == nil || discover.findReverse("api.team-b") != nil {
+		t.Error("pattern")
+		return
+	}
+	delete(discover.proxyReverse, "v100.ds.team-c")
+	discover.rebuildPattern()
+	if tenant, ok := discover.selfTenant("pdsrv.a.loc"); !ok || tenant != "team-a" {
+		t.Error(tenant, ok)
+		return
+	}
+	if _, ok := discover.selfTenant("none"); ok {
+		t.Error(ok)
+		return
+	}
+	if !discover.adminEnabled() {
+		t.Error("enabled")
+		return
+	}
+	if _, ok := discover.adminTenant(""); ok {
+		t.Error(ok)
+		return
+	}
+	serviceA := &Container{ID: "a1", Name: "ds", Version: "v1.0.0", Tenant: "team-a", Forwards: map[string]*Forward{
+		"v100.ds.team-a": {Prefix: "v100.ds.team-a", Tenant: "team-a"},
+	}}
+	serviceB := &Container{ID: "b1", Name: "ds", Version: "v1.0.0", Tenant: "team-b", Forwards: map[string]*Forward{
+		"v100.ds.team-b": {Prefix: "v100.ds.team-b", Tenant: "team-b"},
+	}}
+	serviceX := &Container{ID: "x1", Name: "ds", Version: "v1.0.0", Forwards: map[string]*Forward{
+		"v100.ds": {Prefix: "v100.ds"},
+	}}
+	discover.proxyAll["v100.ds.team-a"] = serviceA
+	discover.proxyAll["v100.ds.team-b"] = serviceB
+	discover.proxyAll["v100.ds"] = serviceX
+	call := func(method, host, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://"+host+path, nil)
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res := httptest.NewRecorder()
+		discover.ServeHTTP(res, req)
+		return res
+	}
+	//catalog
+	if res := call("GET", "pdsrv", "/", ""); !strings.Contains(res.Body.String(), "v100.ds.test.loc") || strings.Contains(res.Body.String(), "team-") {
+		t.Error(res.Body.String())
+		return
+	}
+	if res := call("GET", "pdsrv.a.loc", "/", ""); res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "v100.ds.a.loc") || strings.Contains(res.Body.String(), "team-b") || strings.Contains(res.Body.String(), "test.loc") {
+		t.Error(res.Body.String())
+		return
+	}
+	//admin
+	if res := call("GET", "pdsrv", "/_api/services", "a123"); res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"a1"`) || strings.Contains(res.Body.String(), `"b1"`) || strings.Contains(res.Body.String(), `"x1"`) {
+		t.Error(res.Body.String())
+		return
+	}
+	if res := call("GET", "pdsrv", "/_api/catalog", "b123"); res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "v100.ds.team-b.test.loc") || strings.Contains(res.Body.String(), "team-a") {
+		t.Error(res.Body.String())
+		return
+	}
+	if res := call("POST", "pdsrv", "/_api/pause", "a123"); res.Code != http.StatusForbidden || discover.IsPaused() {
+		t.Error(res.Code)
+		return
+	}
+	if services := discover.findServices(discover.Tenants["team-b"], "ds", "", ""); len(services) != 1 || services[0].ID != "b1" {
+		t.Error(services)
+		return
+	}
+	if services := discover.findServices(nil, "ds", "", ""); len(services) != 3 {
+		t.Error(services)
+		return
+	}
+	if res := call("GET", "pdsrv", "/_api/status", "b123"); res.Code != http.StatusForbidden {
+		t.Error(res.Code)
+		return
+	}
+	if res := call("GET", "pdsrv", "/_api/status", "x123"); res.Code != http.StatusUnauthorized {
+		t.Error(res.Code)
+		return
+	}
+	//env
+	if env := strings.Join(triggerEnv(serviceA, serviceA.Forwards["v100.ds.team-a"]), ","); !strings.Contains(env, "PD_SERVICE_TENANT=team-a") {
+		t.Error(env)
+		return
+	}
+	if err := discover.checkTenantContainer(serviceX, "x2"); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestTenantDottedName(t *testing.T) {
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "c1", Name: "/my.app-srv-v1.0.0", State: &types.ContainerState{Status: "running"}},
+		Config:            &container.Config{Labels: map[string]string{"PD_HOST_PING": "ping/", "PD_RESPOND_PING": "pong"}},
+	}
+	discover := NewDiscover()
+	//dotted name is allowed without tenant
+	if service, ok := discover.parseContainer(inspect, "127.0.0.1", false); !ok || len(service.Forwards) != 1 {
+		t.Errorf("%v,%v", service, ok)
+		return
+	}
+	//dotted name can produce host of tenant
+	discover.Tenants["app"] = &Tenant{Name: "app"}
+	if service, _ := discover.parseContainer(inspect, "127.0.0.1", false); len(service.Forwards) != 0 || len(service.Problems) != 1 {
+		t.Errorf("%v,%v", service.Forwards, service.Problems)
+		return
+	}
+}
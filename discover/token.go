@@ -0,0 +1,72 @@
+package discover
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashToken will return the sha256 hashed token which can be used in PD_SERVICE_TOKEN label
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// HashTokenBcrypt will return the bcrypt hashed token by cost, the default cost is used when cost is zero
+func HashTokenBcrypt(token string, cost int) (hashed string, err error) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	data, err := bcrypt.GenerateFromPassword([]byte(token), cost)
+	if err == nil {
+		hashed = "bcrypt:" + string(data)
+	}
+	return
+}
+
+// isBcrypt will check if the token is bcrypt hashed by bcrypt:<hash> or raw $2a$/$2b$/$2y$ hash
+func isBcrypt(expected string) bool {
+	return strings.HasPrefix(expected, "bcrypt:") || strings.HasPrefix(expected, "$2a$") || strings.HasPrefix(expected, "$2b$") || strings.HasPrefix(expected, "$2y$")
+}
+
+// ValidToken will check the token label value, the hashed token must be sha256:<hex>, sha512:<hex> or bcrypt:<hash>
+func ValidToken(expected string) (err error) {
+	switch {
+	case strings.HasPrefix(expected, "sha256:"):
+		if data, xerr := hex.DecodeString(strings.TrimPrefix(expected, "sha256:")); xerr != nil || len(data) != sha256.Size {
+			err = fmt.Errorf("invalid sha256 token hash")
+		}
+	case strings.HasPrefix(expected, "sha512:"):
+		if data, xerr := hex.DecodeString(strings.TrimPrefix(expected, "sha512:")); xerr != nil || len(data) != sha512.Size {
+			err = fmt.Errorf("invalid sha512 token hash")
+		}
+	case isBcrypt(expected):
+		if _, xerr := bcrypt.Cost([]byte(strings.TrimPrefix(expected, "bcrypt:"))); xerr != nil {
+			err = fmt.Errorf("invalid bcrypt token hash")
+		}
+	}
+	return
+}
+
+// VerifyToken will verify token by expected plain or hashed token in constant time, the empty expected token is never matched
+func VerifyToken(expected, token string) bool {
+	if len(expected) < 1 || ValidToken(expected) != nil {
+		return false
+	}
+	switch {
+	case isBcrypt(expected):
+		return bcrypt.CompareHashAndPassword([]byte(strings.TrimPrefix(expected, "bcrypt:")), []byte(token)) == nil
+	case strings.HasPrefix(expected, "sha256:"):
+		sum := sha256.Sum256([]byte(token))
+		expected, token = strings.ToLower(strings.TrimPrefix(expected, "sha256:")), hex.EncodeToString(sum[:])
+	case strings.HasPrefix(expected, "sha512:"):
+		sum := sha512.Sum512([]byte(token))
+		expected, token = strings.ToLower(strings.TrimPrefix(expected, "sha512:")), hex.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
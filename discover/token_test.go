@@ -0,0 +1,58 @@
+package discover
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestToken(t *testing.T) {
+	hashed := HashToken("abc")
+	if hashed != "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Error(hashed)
+		return
+	}
+	sum := sha512.Sum512([]byte("abc"))
+	bcrypted, err := HashTokenBcrypt("abc", bcrypt.MinCost)
+	if err != nil || !strings.HasPrefix(bcrypted, "bcrypt:$2a$04$") || ValidToken(bcrypted) != nil {
+		t.Errorf("%v,%v", err, bcrypted)
+		return
+	}
+	for expected, token := range map[string]string{
+		bcrypted:                                "abc",
+		strings.TrimPrefix(bcrypted, "bcrypt:"): "abc",
+		"abc":                                   "abc",
+		hashed:                                  "abc",
+		"sha256:" + strings.ToUpper(hashed[7:]): "abc",
+		"sha512:" + hex.EncodeToString(sum[:]):  "abc",
+	} {
+		if !VerifyToken(expected, token) {
+			t.Error(expected, token)
+			return
+		}
+	}
+	for expected, token := range map[string]string{
+		"abc":       "abd",
+		hashed:      hashed,
+		"":          "",
+		"sha256:xx": "abc",
+		"$2a$10$xx": "abc",
+		bcrypted:    "abd",
+	} {
+		if VerifyToken(expected, token) {
+			t.Error(expected, token)
+			return
+		}
+	}
+	if err := ValidToken("sha512:xx"); err == nil {
+		t.Error(err)
+		return
+	}
+	if err := ValidToken("bcrypt:xx"); err == nil {
+		t.Error(err)
+		return
+	}
+}
@@ -0,0 +1,177 @@
+package discover
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"path/filepath"
+	"time"
+)
+
+// Upstream is the transport options used by reverse proxy to dial backend
+type Upstream struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	TLSHandshakeTimeout time.Duration
+	DisableKeepAlives   bool
+	Share               bool
+	Certificates        []tls.Certificate
+}
+
+// NewUpstream will return the default upstream options, it is same as http.DefaultTransport
+func NewUpstream() (upstream *Upstream) {
+	upstream = &Upstream{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: http.DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		Share:               true,
+	}
+	return
+}
+
+// Tune will apply the options to transport
+func (u *Upstream) Tune(transport *http.Transport) {
+	transport.MaxIdleConns = u.MaxIdleConns
+	transport.MaxIdleConnsPerHost = u.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = u.MaxConnsPerHost
+	transport.IdleConnTimeout = u.IdleConnTimeout
+	transport.TLSHandshakeTimeout = u.TLSHandshakeTimeout
+	transport.DisableKeepAlives = u.DisableKeepAlives
+	if len(u.Certificates) > 0 {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		if len(transport.TLSClientConfig.Certificates) < 1 {
+			transport.TLSClientConfig.Certificates = u.Certificates
+		}
+	}
+}
+
+// NewTransport will return new transport by options
+func (u *Upstream) NewTransport() (transport *http.Transport) {
+	transport = http.DefaultTransport.(*http.Transport).Clone()
+	u.Tune(transport)
+	return
+}
+
+func (d *Discover) upstreamTransport() (transport *http.Transport) {
+	if !d.Upstream.Share {
+		transport = d.Upstream.NewTransport()
+		d.tuneDial(transport)
+		return
+	}
+	d.transportLock.Lock()
+	if d.transportShared == nil {
+		d.transportShared = d.Upstream.NewTransport()
+		d.tuneDial(d.transportShared)
+	}
+	transport = d.transportShared
+	d.transportLock.Unlock()
+	return
+}
+
+func (d *Discover) newReverseProxy(forward *Forward) (proxy *httputil.ReverseProxy, err error) {
+	proxy, err = forward.NewReverseProxy()
+	if err != nil {
+		return
+	}
+	proxy.BufferPool = copyPool
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		d.procProxyError(w, r, forward, err)
+	}
+	if forward.Stream {
+		proxy.FlushInterval = -1
+	}
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		d.signIdentity(req, forward)
+	}
+	if forward.CORS != nil || len(forward.ResponseHeaders) > 0 || d.StreamKeepAlive > 0 {
+		proxy.ModifyResponse = func(res *http.Response) (err error) {
+			if err = forward.modifyResponse(res); err == nil {
+				d.keepAliveStream(res)
+			}
+			return
+		}
+	}
+	if transport, ok := proxy.Transport.(*http.Transport); ok {
+		d.Upstream.Tune(transport)
+		return
+	}
+	if forward.Scheme == "https" && (forward.TLSSkipVerify || len(forward.TLSCA) > 0 || len(forward.TLSCert) > 0) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig, err = forward.NewTLSConfig()
+		d.Upstream.Tune(transport)
+		d.tuneDial(transport)
+		proxy.Transport = transport
+		return
+	}
+	proxy.Transport = d.upstreamTransport()
+	return
+}
+
+// inTLSRoots will check if the absolute tls file path is under one of TLSRoots after the symlinks are resolved
+func (d *Discover) inTLSRoots(name string) bool {
+	if !filepath.IsAbs(name) {
+		return false
+	}
+	real, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return false
+	}
+	return inRoots(d.TLSRoots, real)
+}
+
+// checkTLSFiles will remove the tls ca/cert/key of forwards which is not under TLSRoots, so the label can't read
+// other host file, the removed file is recorded as label problem
+func (d *Discover) checkTLSFiles(container *Container) {
+	for _, forward := range container.Forwards {
+		if len(forward.TLSCA) > 0 && !d.inTLSRoots(forward.TLSCA) {
+			container.addProblem("PD_TLS_CA_"+forward.Name, forward.TLSCA, "tls file is not under tls_roots")
+			forward.TLSCA = ""
+		}
+		if len(forward.TLSCert) > 0 && !d.inTLSRoots(forward.TLSCert) {
+			container.addProblem("PD_TLS_CERT_"+forward.Name, forward.TLSCert, "tls file is not under tls_roots")
+			forward.TLSCert, forward.TLSKey = "", ""
+		}
+		if len(forward.TLSKey) > 0 && !d.inTLSRoots(forward.TLSKey) {
+			container.addProblem("PD_TLS_KEY_"+forward.Name, forward.TLSKey, "tls file is not under tls_roots")
+			forward.TLSCert, forward.TLSKey = "", ""
+		}
+	}
+}
+
+// NewTLSConfig will return the tls config to backend by forward options
+func (f *Forward) NewTLSConfig() (config *tls.Config, err error) {
+	config = &tls.Config{
+		InsecureSkipVerify: f.TLSSkipVerify,
+	}
+	if len(f.TLSCA) > 0 {
+		data, xerr := ioutil.ReadFile(f.TLSCA)
+		if xerr != nil {
+			err = xerr
+			return
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			err = fmt.Errorf("not cert found in %v", f.TLSCA)
+			return
+		}
+	}
+	if len(f.TLSCert) > 0 {
+		cert, xerr := tls.LoadX509KeyPair(f.TLSCert, f.TLSKey)
+		if xerr != nil {
+			err = xerr
+			return
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return
+}
@@ -0,0 +1,119 @@
+package discover
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codingeasygo/util/converter"
+)
+
+func TestUpstream(t *testing.T) {
+	d := NewDiscover()
+	d.Upstream.MaxConnsPerHost = 10
+	d.Upstream.IdleConnTimeout = time.Second
+	d.Upstream.DisableKeepAlives = true
+	shared := d.upstreamTransport()
+	if shared != d.upstreamTransport() {
+		t.Error("not shared")
+		return
+	}
+	if shared.MaxConnsPerHost != 10 || shared.IdleConnTimeout != time.Second || !shared.DisableKeepAlives {
+		t.Errorf("%v,%v,%v", shared.MaxConnsPerHost, shared.IdleConnTimeout, shared.DisableKeepAlives)
+		return
+	}
+	d.Upstream.Share = false
+	if shared == d.upstreamTransport() {
+		t.Error("shared")
+		return
+	}
+	proxy, err := d.newReverseProxy(&Forward{Type: "http", URI: "unix:///tmp/x.sock"})
+	if err != nil || proxy.Transport == shared {
+		t.Error(err)
+		return
+	}
+}
+
+func TestUpstreamCert(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "upstream")
+	defer os.RemoveAll(dir)
+	ca, caKey, caPEM, _ := newTestCert("ca", true, x509.ExtKeyUsageAny, nil, nil)
+	_, _, clientPEM, clientKeyPEM := newTestCert("client", false, x509.ExtKeyUsageClientAuth, ca, caKey)
+	ioutil.WriteFile(filepath.Join(dir, "ca.pem"), caPEM, os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "client.pem"), append(clientPEM, clientKeyPEM...), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "client.key"), clientKeyPEM, os.ModePerm)
+	forward := &Forward{Prefix: "v100.ds", URI: "127.0.0.1:443", Scheme: "https"}
+	applyForwardOptions(&Container{Forwards: map[string]*Forward{"v100.ds": forward}}, map[string]string{
+		"PD_TLS_CERT": filepath.Join(dir, "client.pem"),
+	})
+	config, err := forward.NewTLSConfig()
+	if err != nil || len(config.Certificates) != 1 {
+		t.Errorf("%v,%v", config, err)
+		return
+	}
+	forward.TLSKey = filepath.Join(dir, "none.key")
+	if _, err = forward.NewTLSConfig(); err == nil {
+		t.Error("error")
+		return
+	}
+	//global
+	cert, _ := tls.LoadX509KeyPair(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key"))
+	d := NewDiscover()
+	d.Upstream.Certificates = []tls.Certificate{cert}
+	if transport := d.upstreamTransport(); transport.TLSClientConfig == nil || len(transport.TLSClientConfig.Certificates) != 1 {
+		t.Error("error")
+		return
+	}
+	forward = &Forward{Prefix: "v100.ds", URI: "127.0.0.1:443", Scheme: "https", TLSCA: filepath.Join(dir, "ca.pem")}
+	proxy, err := d.newReverseProxy(forward)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if transport := proxy.Transport.(*http.Transport); transport.TLSClientConfig.RootCAs == nil || len(transport.TLSClientConfig.Certificates) != 1 {
+		t.Error("error")
+		return
+	}
+	//tls roots
+	os.Symlink("/etc", filepath.Join(dir, "etc"))
+	newContainer := func() *Container {
+		container := &Container{Forwards: map[string]*Forward{"v100.ds": {Name: "WEB", Prefix: "v100.ds"}}}
+		applyForwardOptions(container, map[string]string{
+			"PD_TLS_CA":   filepath.Join(dir, "ca.pem"),
+			"PD_TLS_CERT": filepath.Join(dir, "client.pem"),
+			"PD_TLS_KEY":  filepath.Join(dir, "etc", "passwd"),
+		})
+		return container
+	}
+	container := newContainer()
+	d.checkTLSFiles(container)
+	if forward = container.Forwards["v100.ds"]; forward.TLSCA != "" || forward.TLSCert != "" || forward.TLSKey != "" || len(container.Problems) != 2 {
+		t.Errorf("%v,%v", converter.JSON(forward), converter.JSON(container.Problems))
+		return
+	}
+	d.TLSRoots = []string{dir}
+	container = newContainer()
+	d.checkTLSFiles(container)
+	if forward = container.Forwards["v100.ds"]; forward.TLSCA == "" || forward.TLSCert != "" || forward.TLSKey != "" || len(container.Problems) != 1 || container.Problems[0].Label != "PD_TLS_KEY_WEB" {
+		t.Errorf("%v,%v", converter.JSON(forward), converter.JSON(container.Problems))
+		return
+	}
+	for name, allowed := range map[string]bool{
+		filepath.Join(dir, "client.pem"):             true,
+		filepath.Join(dir, "etc", "passwd"):          false,
+		filepath.Join(dir, "none.pem"):               false,
+		"client.pem":                                 false,
+		filepath.Join(dir, "etc") + "/../ca.pem":     false,
+		filepath.Join(dir, "etc", "ssl", "cert.pem"): false,
+	} {
+		if d.inTLSRoots(name) != allowed {
+			t.Error(name)
+			return
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// splitCommand will split the command line to args, the arg can be quoted by single/double quote
+func splitCommand(line string) (args []string, err error) {
+	arg := &strings.Builder{}
+	hasArg := false
+	quote := rune(0)
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+			hasArg = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if hasArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				hasArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			hasArg = true
+		}
+	}
+	if quote != 0 {
+		err = fmt.Errorf("unclosed quote in %v", line)
+		return
+	}
+	if hasArg {
+		args = append(args, arg.String())
+	}
+	if len(args) < 1 {
+		err = fmt.Errorf("empty command")
+	}
+	return
+}
+
+// newTriggerCommand will create the command to run trigger/finder by TriggerMode, the mode is
+// shell to run script by TriggerBash, exec to run command line directly without shell, powershell to run script by TriggerPowerShell,
+// the finder is run as exec mode when trigger is run on container mode
+func (d *Discover) newTriggerCommand(trigger string) (cmd *exec.Cmd, err error) {
+	switch d.TriggerMode {
+	case "", "shell":
+		cmd = exec.Command(d.TriggerBash, trigger)
+	case "exec", "container":
+		var args []string
+		args, err = splitCommand(trigger)
+		if err != nil {
+			return
+		}
+		cmd = exec.Command(args[0], args[1:]...)
+	case "powershell":
+		cmd = exec.Command(d.TriggerPowerShell, "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", trigger)
+		cmd.Env = os.Environ() //powershell is not working without SystemRoot env
+	default:
+		err = fmt.Errorf("not supported trigger mode %v", d.TriggerMode)
+	}
+	return
+}
+
+func (d *Discover) isTriggerType(forwardType string) bool {
+	for _, t := range d.TriggerTypes {
+		if t == forwardType {
+			return true
+		}
+	}
+	return false
+}
+
+func triggerPort(forward *Forward) (port string) {
+	if forward.Type == "tcp" || forward.Type == "udp" {
+		_, port, _ = net.SplitHostPort(forward.Key)
+	}
+	return
+}
+
+func triggerEnv(service *Container, forward *Forward) (env []string) {
+	env = append(env, fmt.Sprintf("%v=%v", "PD_SERVICE_VER", service.Version))
+	env = append(env, fmt.Sprintf("%v=%v", "PD_SERVICE_NAME", service.Name))
+	env = append(env, fmt.Sprintf("%v=%v", "PD_SERVICE_TYPE", forward.Type))
+	if forward.Wildcard {
+		env = append(env, fmt.Sprintf("%v=*.%v", "PD_SERVICE_HOST", forward.URI))
+		env = append(env, fmt.Sprintf("%v=*.%v", "PD_SERVICE_PREF", forward.Prefix))
+	} else {
+		env = append(env, fmt.Sprintf("%v=%v", "PD_SERVICE_HOST", forward.URI))
+		env = append(env, fmt.Sprintf("%v=%v", "PD_SERVICE_PREF", forward.Prefix))
+	}
+	if len(service.Tenant) > 0 {
+		env = append(env, fmt.Sprintf("%v=%v", "PD_SERVICE_TENANT", service.Tenant))
+	}
+	if port := triggerPort(forward); len(port) > 0 {
+		env = append(env, fmt.Sprintf("%v=%v", "PD_SERVICE_LISTEN", forward.Key))
+		env = append(env, fmt.Sprintf("%v=%v", "PD_SERVICE_PORT", port))
+	}
+	return
+}
+
+func triggerItem(event string, service *Container, forward *Forward) (item xmap.M) {
+	item = xmap.M{
+		"event":    event,
+		"name":     service.Name,
+		"version":  service.Version,
+		"type":     forward.Type,
+		"host":     forward.URI,
+		"prefix":   forward.Prefix,
+		"wildcard": forward.Wildcard,
+	}
+	if len(service.Tenant) > 0 {
+		item["tenant"] = service.Tenant
+	}
+	if port := triggerPort(forward); len(port) > 0 {
+		item["listen"] = forward.Key
+		item["port"] = port
+	}
+	return
+}
+
+// callTriggerBatch will call trigger once with all changed services, the services is passed as json array on stdin
+// and PD_SERVICE_BATCH env on container mode
+func (d *Discover) callTriggerBatch(services map[string]*Container, name, trigger string) {
+	items := []xmap.M{}
+	for prefix, service := range services {
+		if forward, ok := service.Forwards[prefix]; ok && d.isTriggerType(forward.Type) {
+			items = append(items, triggerItem(name, service, forward))
+		}
+	}
+	if len(items) < 1 {
+		return
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i]["prefix"].(string) < items[j]["prefix"].(string)
+	})
+	data, _ := json.Marshal(items)
+	env := []string{fmt.Sprintf("%v=%v", "PD_SERVICE_EVENT", name), fmt.Sprintf("%v=%v", "PD_SERVICE_COUNT", len(items))}
+	startTime := time.Now()
+	info, xerr := d.runTrigger(trigger, env, data)
+	d.recordTrigger(name, time.Since(startTime), info, xerr)
+	if xerr != nil {
+		WarnLog("Discover call refresh batch trigger %v fail with %v by\n\tCMD:%v\n\tIN:%v\n\tOut:\n%v", name, xerr, trigger, string(data), string(info))
+	} else {
+		InfoLog("Discover call refresh batch trigger %v success by\n\tCMD:%v\n\tIN:%v\n\tOut:\n%v", name, trigger, string(data), string(info))
+	}
+}
+
+// runTrigger will run the trigger with env/stdin and return the output
+func (d *Discover) runTrigger(trigger string, env []string, stdin []byte) (out []byte, err error) {
+	if d.TriggerMode == "container" {
+		if stdin != nil {
+			env = append(env, fmt.Sprintf("%v=%v", "PD_SERVICE_BATCH", string(stdin)))
+		}
+		out, err = d.runTriggerContainer(trigger, env)
+		return
+	}
+	cmd, err := d.newTriggerCommand(trigger)
+	if err != nil {
+		return
+	}
+	cmd.Env = append(cmd.Env, env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	out, err = cmd.Output()
+	return
+}
+
+// runTriggerContainer will run the trigger command as one-shot container by TriggerImage, the container is removed after done
+func (d *Discover) runTriggerContainer(trigger string, env []string) (out []byte, err error) {
+	if len(d.TriggerImage) < 1 {
+		err = fmt.Errorf("trigger image is not configured")
+		return
+	}
+	args, err := splitCommand(trigger)
+	if err != nil {
+		return
+	}
+	cli, _, err := d.newDockerClient()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.TriggerTimeout)
+	defer cancel()
+	created, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:  d.TriggerImage,
+		Cmd:    args,
+		Env:    env,
+		Labels: map[string]string{"pdservice.trigger": "1"},
+	}, &container.HostConfig{
+		NetworkMode: container.NetworkMode(d.TriggerNetwork),
+	}, nil, nil, "")
+	if err != nil {
+		return
+	}
+	defer cli.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+	waitC, errC := cli.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+	err = cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{})
+	if err != nil {
+		return
+	}
+	var code int64
+	select {
+	case res := <-waitC:
+		code = res.StatusCode
+	case err = <-errC:
+		return
+	}
+	reader, err := cli.ContainerLogs(ctx, created.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	buf := bytes.NewBuffer(nil)
+	stdcopy.StdCopy(buf, buf, reader)
+	out = buf.Bytes()
+	if code != 0 {
+		err = fmt.Errorf("container exit status %v", code)
+	}
+	return
+}
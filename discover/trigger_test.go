@@ -0,0 +1,169 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func TestSplitCommand(t *testing.T) {
+	args, err := splitCommand(`/usr/bin/update-dns  --zone "a b" 'c d' e""`)
+	if err != nil || strings.Join(args, "|") != "/usr/bin/update-dns|--zone|a b|c d|e" {
+		t.Errorf("%v,%v", args, err)
+		return
+	}
+	args, err = splitCommand(`x ""`)
+	if err != nil || len(args) != 2 || args[1] != "" {
+		t.Errorf("%v,%v", args, err)
+		return
+	}
+	for _, line := range []string{"", "  ", `x "a`} {
+		if _, err = splitCommand(line); err == nil {
+			t.Error(line)
+			return
+		}
+	}
+}
+
+func TestTriggerCommand(t *testing.T) {
+	discover := NewDiscover()
+	cmd, err := discover.newTriggerCommand("a.sh")
+	if err != nil || strings.Join(cmd.Args, " ") != "bash a.sh" {
+		t.Errorf("%v,%v", cmd, err)
+		return
+	}
+	discover.TriggerMode = "exec"
+	cmd, err = discover.newTriggerCommand("echo 'a b'")
+	if err != nil || strings.Join(cmd.Args, "|") != "echo|a b" {
+		t.Errorf("%v,%v", cmd, err)
+		return
+	}
+	out, err := cmd.Output()
+	if err != nil || string(out) != "a b\n" {
+		t.Errorf("%v,%v", string(out), err)
+		return
+	}
+	discover.TriggerMode = "powershell"
+	cmd, err = discover.newTriggerCommand("a.ps1")
+	if err != nil || cmd.Args[0] != "powershell" || cmd.Args[len(cmd.Args)-1] != "a.ps1" || len(cmd.Env) < 1 {
+		t.Errorf("%v,%v", cmd, err)
+		return
+	}
+	discover.TriggerMode = "xx"
+	if _, err = discover.newTriggerCommand("a"); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestRunTrigger(t *testing.T) {
+	discover := NewDiscover()
+	discover.TriggerMode = "exec"
+	out, err := discover.runTrigger("sh -c 'echo $PD_SERVICE_NAME'", []string{"PD_SERVICE_NAME=ds"}, nil)
+	if err != nil || string(out) != "ds\n" {
+		t.Errorf("%v,%v", string(out), err)
+		return
+	}
+	discover.TriggerMode = "container"
+	if _, err = discover.runTrigger("update", nil, nil); err == nil {
+		t.Error("error")
+		return
+	}
+	//container
+	var created struct {
+		container.Config
+		HostConfig container.HostConfig
+	}
+	calls := []string{}
+	exitCode := 0
+	docker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:]
+		calls = append(calls, r.Method+" "+path)
+		switch {
+		case strings.HasSuffix(path, "/containers/create"):
+			json.NewDecoder(r.Body).Decode(&created)
+			w.Write([]byte(`{"Id": "t1"}`))
+		case strings.HasSuffix(path, "/t1/wait"):
+			fmt.Fprintf(w, `{"StatusCode": %v}`, exitCode)
+		case strings.HasSuffix(path, "/t1/logs"):
+			stdcopy.NewStdWriter(w, stdcopy.Stdout).Write([]byte("updated\n"))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer docker.Close()
+	discover.clientNew, _ = client.NewClientWithOpts(client.WithHost("tcp://"+docker.Listener.Addr().String()), client.WithVersion("1.41"))
+	discover.clientLatest = time.Now()
+	discover.TriggerImage = "alpine"
+	discover.TriggerNetwork = "host"
+	out, err = discover.runTrigger("update --all", []string{"PD_SERVICE_NAME=ds"}, []byte("[]"))
+	if err != nil || string(out) != "updated\n" {
+		t.Errorf("%v,%v", string(out), err)
+		return
+	}
+	if created.Image != "alpine" || strings.Join(created.Cmd, ",") != "update,--all" || created.HostConfig.NetworkMode != "host" ||
+		strings.Join(created.Env, ",") != "PD_SERVICE_NAME=ds,PD_SERVICE_BATCH=[]" || created.Labels["pdservice.trigger"] != "1" {
+		t.Errorf("%v", created)
+		return
+	}
+	if strings.Join(calls, ",") != "POST /containers/create,POST /containers/t1/wait,POST /containers/t1/start,GET /containers/t1/logs,DELETE /containers/t1" {
+		t.Error(calls)
+		return
+	}
+	exitCode = 1
+	if _, err = discover.runTrigger("update", nil, nil); err == nil || err.Error() != "container exit status 1" {
+		t.Error(err)
+		return
+	}
+}
+
+func TestTriggerBatch(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "trigger")
+	defer os.RemoveAll(dir)
+	outFile := filepath.Join(dir, "out")
+	discover := NewDiscover()
+	discover.TriggerMode = "exec"
+	discover.TriggerTypes = []string{"http", "tcp"}
+	service := &Container{Name: "ds", Version: "v1.0.0", Forwards: map[string]*Forward{
+		"v100.ds":        {Type: "http", Prefix: "v100.ds", URI: "127.0.0.1:80"},
+		"tcp://:8080":    {Type: "tcp", Prefix: "tcp://:8080", Key: ":8080", URI: "127.0.0.1:8080"},
+		"udp://:53":      {Type: "udp", Prefix: "udp://:53", Key: ":53", URI: "127.0.0.1:53"},
+		"unix:///x.sock": {Type: "unix", Prefix: "unix:///x.sock", Key: "/x.sock", URI: "127.0.0.1:81"},
+	}}
+	services := map[string]*Container{}
+	for prefix := range service.Forwards {
+		services[prefix] = service
+	}
+	env := triggerEnv(service, service.Forwards["tcp://:8080"])
+	if strings.Join(env, ",") != "PD_SERVICE_VER=v1.0.0,PD_SERVICE_NAME=ds,PD_SERVICE_TYPE=tcp,PD_SERVICE_HOST=127.0.0.1:8080,PD_SERVICE_PREF=tcp://:8080,PD_SERVICE_LISTEN=:8080,PD_SERVICE_PORT=8080" {
+		t.Error(env)
+		return
+	}
+	//single
+	discover.callTrigger(services, "added", "sh -c 'echo $PD_SERVICE_TYPE >> "+outFile+"'")
+	data, _ := ioutil.ReadFile(outFile)
+	if lines := strings.Fields(string(data)); len(lines) != 2 {
+		t.Error(string(data))
+		return
+	}
+	os.Remove(outFile)
+	//batch
+	discover.TriggerBatch = true
+	discover.callTrigger(services, "added", "sh -c 'echo $PD_SERVICE_EVENT $PD_SERVICE_COUNT > "+outFile+"; cat >> "+outFile+"'")
+	data, _ = ioutil.ReadFile(outFile)
+	if !strings.HasPrefix(string(data), "added 2\n[") || !strings.Contains(string(data), `"port":"8080"`) {
+		t.Error(string(data))
+		return
+	}
+}
@@ -0,0 +1,234 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type tunnelAddr string
+
+func (t tunnelAddr) Network() string { return "ssh" }
+
+func (t tunnelAddr) String() string { return string(t) }
+
+// tunnelConn is the connection which is forwarded by direct-tcpip channel of shared ssh client, the ssh channel is not
+// supporting deadline, so the connection is closed when the read or write deadline is exceeded
+type tunnelConn struct {
+	net.Conn
+	remote     tunnelAddr
+	timerLock  sync.Mutex
+	readTimer  *time.Timer
+	writeTimer *time.Timer
+}
+
+func (t *tunnelConn) RemoteAddr() net.Addr { return t.remote }
+
+func (t *tunnelConn) LocalAddr() net.Addr { return tunnelAddr("local") }
+
+func (t *tunnelConn) setTimer(timer **time.Timer, deadline time.Time) {
+	t.timerLock.Lock()
+	defer t.timerLock.Unlock()
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if deadline.IsZero() {
+		return
+	}
+	*timer = time.AfterFunc(time.Until(deadline), func() {
+		DebugLog("Discover ssh tunnel to %v is closed by deadline", t.remote)
+		t.Conn.Close()
+	})
+}
+
+func (t *tunnelConn) SetDeadline(deadline time.Time) error {
+	t.setTimer(&t.readTimer, deadline)
+	t.setTimer(&t.writeTimer, deadline)
+	return nil
+}
+
+func (t *tunnelConn) SetReadDeadline(deadline time.Time) error {
+	t.setTimer(&t.readTimer, deadline)
+	return nil
+}
+
+func (t *tunnelConn) SetWriteDeadline(deadline time.Time) error {
+	t.setTimer(&t.writeTimer, deadline)
+	return nil
+}
+
+func (t *tunnelConn) Close() (err error) {
+	t.setTimer(&t.readTimer, time.Time{})
+	t.setTimer(&t.writeTimer, time.Time{})
+	err = t.Conn.Close()
+	return
+}
+
+// sshTarget will return the ssh server address and user of SSHTunnel which is user@host or ssh://user@host:port,
+// the port is 22 and the user is current user when it is not set
+func (d *Discover) sshTarget() (address, username string, err error) {
+	target, err := url.Parse(d.SSHTunnel)
+	if err != nil || target.Scheme != "ssh" {
+		target, err = url.Parse("ssh://" + d.SSHTunnel)
+	}
+	if err != nil || len(target.Hostname()) < 1 {
+		err = fmt.Errorf("invalid ssh tunnel %v", d.SSHTunnel)
+		return
+	}
+	port := target.Port()
+	if len(port) < 1 {
+		port = "22"
+	}
+	address = net.JoinHostPort(target.Hostname(), port)
+	if target.User != nil {
+		username = target.User.Username()
+	} else if current, xerr := user.Current(); xerr == nil {
+		username = current.Username
+	}
+	return
+}
+
+// sshConfig will return the ssh client config which is authorized by SSHKey or the default identity files and ssh agent,
+// the host key is verified by SSHKnownHosts
+func (d *Discover) sshConfig(username string) (config *ssh.ClientConfig, agentConn net.Conn, err error) {
+	home, _ := os.UserHomeDir()
+	knownHosts := d.SSHKnownHosts
+	if len(knownHosts) < 1 {
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKey, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return
+	}
+	keys := []string{d.SSHKey}
+	if len(d.SSHKey) < 1 {
+		keys = []string{filepath.Join(home, ".ssh", "id_ed25519"), filepath.Join(home, ".ssh", "id_ecdsa"), filepath.Join(home, ".ssh", "id_rsa")}
+	}
+	signers := []ssh.Signer{}
+	for _, key := range keys {
+		data, xerr := ioutil.ReadFile(key)
+		if xerr != nil {
+			if len(d.SSHKey) > 0 {
+				err = xerr
+				return
+			}
+			continue
+		}
+		signer, xerr := ssh.ParsePrivateKey(data)
+		if xerr != nil {
+			err = fmt.Errorf("parse ssh key %v fail with %v", key, xerr)
+			return
+		}
+		signers = append(signers, signer)
+	}
+	auths := []ssh.AuthMethod{}
+	if len(signers) > 0 {
+		auths = append(auths, ssh.PublicKeys(signers...))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); len(sock) > 0 {
+		if agentConn, err = net.Dial("unix", sock); err != nil {
+			err = nil
+		} else {
+			auths = append(auths, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+		}
+	}
+	if len(auths) < 1 {
+		err = fmt.Errorf("ssh key is not found for ssh tunnel %v", d.SSHTunnel)
+		return
+	}
+	config = &ssh.ClientConfig{
+		User:            username,
+		Auth:            auths,
+		HostKeyCallback: hostKey,
+		Timeout:         d.DialTimeout,
+	}
+	return
+}
+
+// sshClient will return the shared ssh client of SSHTunnel, the client is connected on first use and reconnected
+// on next use after it is closed
+func (d *Discover) sshClient(ctx context.Context) (client *ssh.Client, err error) {
+	d.sshLock.Lock()
+	defer d.sshLock.Unlock()
+	if d.sshConn != nil {
+		client = d.sshConn
+		return
+	}
+	address, username, err := d.sshTarget()
+	if err != nil {
+		return
+	}
+	config, agentConn, err := d.sshConfig(username)
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
+	if err != nil {
+		return
+	}
+	dialer := &net.Dialer{Timeout: d.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return
+	}
+	if d.DialTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.DialTimeout))
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	client = ssh.NewClient(sshConn, chans, reqs)
+	d.sshConn = client
+	InfoLog("Discover ssh tunnel %v is connected", d.SSHTunnel)
+	go func() {
+		err := client.Wait()
+		WarnLog("Discover ssh tunnel %v is closed with %v", d.SSHTunnel, err)
+		d.sshLock.Lock()
+		if d.sshConn == client {
+			d.sshConn = nil
+		}
+		d.sshLock.Unlock()
+	}()
+	return
+}
+
+// dialTunnel will dial to address on remote docker host by shared ssh client, only tcp network is supported
+func (d *Discover) dialTunnel(ctx context.Context, network, address string) (conn net.Conn, err error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		err = fmt.Errorf("network %v is not supported by ssh tunnel", network)
+		return
+	}
+	client, err := d.sshClient(ctx)
+	if err != nil {
+		return
+	}
+	raw, err := client.DialContext(ctx, network, address)
+	if err != nil {
+		return
+	}
+	conn = &tunnelConn{Conn: raw, remote: tunnelAddr(address)}
+	DebugLog("Discover dial to %v by ssh tunnel %v", address, d.SSHTunnel)
+	return
+}
+
+// tuneTunnel will make transport dial by ssh tunnel when SSHTunnel is configured
+func (d *Discover) tuneTunnel(transport *http.Transport) {
+	if len(d.SSHTunnel) > 0 {
+		transport.DialContext = d.dialTunnel
+	}
+}
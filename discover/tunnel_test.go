@@ -0,0 +1,194 @@
+package discover
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestSSHTarget(t *testing.T) {
+	discover := NewDiscover()
+	discover.SSHTunnel = "ssh://root@10.0.0.1:2222"
+	address, username, err := discover.sshTarget()
+	if err != nil || address != "10.0.0.1:2222" || username != "root" {
+		t.Error(address, username, err)
+		return
+	}
+	discover.SSHTunnel = "admin@10.0.0.1"
+	address, username, err = discover.sshTarget()
+	if err != nil || address != "10.0.0.1:22" || username != "admin" {
+		t.Error(address, username, err)
+		return
+	}
+	discover.SSHTunnel = "%x"
+	if _, _, err = discover.sshTarget(); err == nil {
+		t.Error(err)
+		return
+	}
+}
+
+// runTestSSHServer will run the ssh server which accepts the client key and forwards direct-tcpip channel
+func runTestSSHServer(hostKey ssh.Signer, clientKey ssh.PublicKey) (ln net.Listener, connected *int32) {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "root" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(hostKey)
+	ln, _ = net.Listen("tcp", "127.0.0.1:0")
+	connected = new(int32)
+	go func() {
+		for {
+			raw, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(raw, config)
+				if err != nil {
+					return
+				}
+				atomic.AddInt32(connected, 1)
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					if newChannel.ChannelType() != "direct-tcpip" {
+						newChannel.Reject(ssh.UnknownChannelType, "unknown")
+						continue
+					}
+					data := newChannel.ExtraData()
+					hostLen := binary.BigEndian.Uint32(data)
+					host := string(data[4 : 4+hostLen])
+					port := binary.BigEndian.Uint32(data[4+hostLen:])
+					target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+					if err != nil {
+						newChannel.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					channel, requests, _ := newChannel.Accept()
+					go ssh.DiscardRequests(requests)
+					go func() {
+						io.Copy(channel, target)
+						channel.Close()
+					}()
+					go func() {
+						io.Copy(target, channel)
+						target.Close()
+					}()
+				}
+			}()
+		}
+	}()
+	return
+}
+
+func TestDialTunnel(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tunnel")
+	defer os.RemoveAll(dir)
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewSignerFromKey(hostPriv)
+	_, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	clientKey, _ := ssh.NewSignerFromKey(clientPriv)
+	block, _ := ssh.MarshalPrivateKey(clientPriv, "")
+	ioutil.WriteFile(filepath.Join(dir, "id_ed25519"), pem.EncodeToMemory(block), 0600)
+	ln, connected := runTestSSHServer(hostKey, clientKey.PublicKey())
+	defer ln.Close()
+	echo, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+	discover := NewDiscover()
+	discover.SSHTunnel = "root@" + ln.Addr().String()
+	discover.SSHKey = filepath.Join(dir, "id_ed25519")
+	discover.SSHKnownHosts = filepath.Join(dir, "known_hosts")
+	//unknown host key
+	ioutil.WriteFile(discover.SSHKnownHosts, nil, 0600)
+	if _, err := discover.dialTunnel(context.Background(), "tcp", echo.Addr().String()); err == nil {
+		t.Error(err)
+		return
+	}
+	ioutil.WriteFile(discover.SSHKnownHosts, []byte(knownhosts.Line([]string{knownhosts.Normalize(ln.Addr().String())}, hostKey.PublicKey())+"\n"), 0600)
+	//shared client
+	for i := 0; i < 3; i++ {
+		conn, err := discover.dialTunnel(context.Background(), "tcp", echo.Addr().String())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Write([]byte("abc\n"))
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		if line != "abc\n" || conn.RemoteAddr().String() != echo.Addr().String() {
+			t.Error(line)
+			return
+		}
+		conn.Close()
+	}
+	if atomic.LoadInt32(connected) != 1 {
+		t.Error(atomic.LoadInt32(connected))
+		return
+	}
+	//deadline
+	conn, err := discover.dialTunnel(context.Background(), "tcp", echo.Addr().String())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	begin := time.Now()
+	if _, err = conn.Read(make([]byte, 1)); err == nil || time.Since(begin) > 3*time.Second {
+		t.Error(err)
+		return
+	}
+	conn.Close()
+	//canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = discover.dialTunnel(ctx, "tcp", echo.Addr().String()); err == nil {
+		t.Error(err)
+		return
+	}
+	//reconnect
+	discover.sshConn.Close()
+	time.Sleep(100 * time.Millisecond)
+	if conn, err = discover.dialTunnel(context.Background(), "tcp", echo.Addr().String()); err != nil || atomic.LoadInt32(connected) != 2 {
+		t.Error(err, atomic.LoadInt32(connected))
+		return
+	}
+	conn.Close()
+	if _, err = discover.dialTunnel(context.Background(), "udp", "127.0.0.1:80"); err == nil {
+		t.Error(err)
+		return
+	}
+	//transport
+	transport := &http.Transport{}
+	discover.tuneTunnel(transport)
+	if transport.DialContext == nil {
+		t.Error("error")
+		return
+	}
+}
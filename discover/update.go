@@ -0,0 +1,238 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codingeasygo/util/debug"
+	"github.com/codingeasygo/util/xmap"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// checkImageUpdate will check if the registry has newer digest of container image, the image without repo digest is skipped
+func (d *Discover) checkImageUpdate(cli *client.Client, service *Container) (digest string, updated bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	local, _, err := cli.ImageInspectWithRaw(ctx, service.ImageID)
+	if err != nil || len(local.RepoDigests) < 1 {
+		return
+	}
+	remote, err := cli.DistributionInspect(ctx, service.Image, d.registryAuth(service.Image))
+	if err != nil {
+		return
+	}
+	digest = string(remote.Descriptor.Digest)
+	if len(digest) < 1 {
+		return
+	}
+	updated = true
+	for _, repoDigest := range local.RepoDigests {
+		if strings.HasSuffix(repoDigest, "@"+digest) {
+			updated = false
+			break
+		}
+	}
+	return
+}
+
+// redeployNetworks will return the endpoint config of networks which the container is connected, the primary is network of
+// NetworkMode which is passed on create, and the others should be connected after create. the address, aliases and links
+// is kept, and the alias of container id is removed because it is added by docker
+func redeployNetworks(inspect types.ContainerJSON) (primary *network.NetworkingConfig, others map[string]*network.EndpointSettings) {
+	primary = &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{}}
+	others = map[string]*network.EndpointSettings{}
+	if inspect.NetworkSettings == nil {
+		return
+	}
+	mode := ""
+	if inspect.HostConfig != nil {
+		mode = string(inspect.HostConfig.NetworkMode)
+	}
+	if mode == "" || mode == "default" {
+		mode = "bridge"
+	}
+	names := []string{}
+	for name := range inspect.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if _, ok := inspect.NetworkSettings.Networks[mode]; !ok && len(names) > 0 {
+		mode = names[0]
+	}
+	for _, name := range names {
+		current := inspect.NetworkSettings.Networks[name]
+		if current == nil {
+			continue
+		}
+		endpoint := &network.EndpointSettings{
+			IPAMConfig: current.IPAMConfig,
+			Links:      current.Links,
+			DriverOpts: current.DriverOpts,
+		}
+		for _, alias := range current.Aliases {
+			if len(alias) >= 12 && strings.HasPrefix(inspect.ID, alias) {
+				continue
+			}
+			endpoint.Aliases = append(endpoint.Aliases, alias)
+		}
+		if name == mode {
+			primary.EndpointsConfig[name] = endpoint
+		} else {
+			others[name] = endpoint
+		}
+	}
+	return
+}
+
+// redeployContainer will pull the image and recreate the container by same config, the old container is restored when recreate is fail
+func (d *Discover) redeployContainer(cli *client.Client, service *Container) (newID string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	reader, err := cli.ImagePull(ctx, service.Image, types.ImagePullOptions{RegistryAuth: d.registryAuth(service.Image)})
+	if err != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, reader)
+	reader.Close()
+	inspect, err := cli.ContainerInspect(ctx, service.ID)
+	if err != nil {
+		return
+	}
+	name := strings.TrimPrefix(inspect.Name, "/")
+	oldName := fmt.Sprintf("%v-pdold%v", name, time.Now().Unix())
+	timeout := 10 * time.Second
+	if err = cli.ContainerStop(ctx, service.ID, &timeout); err != nil {
+		return
+	}
+	restore := func() {
+		cli.ContainerRename(ctx, service.ID, name)
+		cli.ContainerStart(ctx, service.ID, types.ContainerStartOptions{})
+	}
+	if err = cli.ContainerRename(ctx, service.ID, oldName); err != nil {
+		cli.ContainerStart(ctx, service.ID, types.ContainerStartOptions{})
+		return
+	}
+	primary, others := redeployNetworks(inspect)
+	created, err := cli.ContainerCreate(ctx, inspect.Config, inspect.HostConfig, primary, nil, name)
+	if err != nil {
+		restore()
+		return
+	}
+	for networkName, endpoint := range others {
+		if err = cli.NetworkConnect(ctx, networkName, created.ID, endpoint); err != nil {
+			cli.ContainerRemove(ctx, created.ID, types.ContainerRemoveOptions{Force: true})
+			restore()
+			return
+		}
+	}
+	if err = cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		cli.ContainerRemove(ctx, created.ID, types.ContainerRemoveOptions{Force: true})
+		restore()
+		return
+	}
+	newID = created.ID
+	if xerr := cli.ContainerRemove(ctx, service.ID, types.ContainerRemoveOptions{}); xerr != nil {
+		WarnLog("Discover remove old container %v/%v fail with %v", oldName, service.ID, xerr)
+	}
+	return
+}
+
+func (d *Discover) notifyImageUpdate(service *Container, digest, action string, err error) {
+	info := xmap.M{
+		"event":   "image",
+		"action":  action,
+		"id":      service.ID,
+		"name":    service.Name,
+		"version": service.Version,
+		"image":   service.Image,
+		"digest":  digest,
+	}
+	if err != nil {
+		info["error"] = err.Error()
+	}
+	data, _ := json.Marshal(info)
+	for _, uri := range []string{service.Hooks["image"], d.UpdateHook} {
+		if len(uri) > 0 {
+			go d.callHook(service, "image", uri, data)
+		}
+	}
+}
+
+// callUpdate will check image update of containers with PD_UPDATE label every UpdateInterval,
+// the update is notified on notify mode, or the container is redeployed on redeploy mode
+func (d *Discover) callUpdate() {
+	defer func() {
+		if xerr := recover(); xerr != nil {
+			ErrorLog("Discover call update panic with %v, call stack is:\n%v", xerr, debug.CallStatck())
+		}
+	}()
+	d.updateLock.Lock()
+	if d.UpdateInterval < 1 || d.updateRunning || time.Since(d.updateLast) < d.UpdateInterval {
+		d.updateLock.Unlock()
+		return
+	}
+	d.updateRunning, d.updateLast = true, time.Now()
+	if d.updateNotified == nil {
+		d.updateNotified = map[string]string{}
+	}
+	d.updateLock.Unlock()
+	defer func() {
+		d.updateLock.Lock()
+		d.updateRunning = false
+		d.updateLock.Unlock()
+	}()
+	services := map[string]*Container{}
+	d.proxyLock.RLock()
+	for _, service := range d.proxyAll {
+		if len(service.Update) > 0 && len(service.Image) > 0 && service.isDocker() {
+			services[service.ID] = service
+		}
+	}
+	d.proxyLock.RUnlock()
+	cli, _, err := d.newDockerClient()
+	if err != nil {
+		WarnLog("Discover call update fail with %v", err)
+		return
+	}
+	redeployed := 0
+	for id, service := range services {
+		digest, updated, err := d.checkImageUpdate(cli, service)
+		if err != nil {
+			WarnLog("Discover check image update of %v/%v by %v fail with %v", service.Name, id, service.Image, err)
+			continue
+		}
+		if !updated {
+			continue
+		}
+		if service.Update != "redeploy" || d.IsReadOnly() {
+			d.updateLock.Lock()
+			notified := d.updateNotified[id] == digest
+			d.updateNotified[id] = digest
+			d.updateLock.Unlock()
+			if !notified {
+				InfoLog("Discover image %v of %v/%v is updated to %v", service.Image, service.Name, id, digest)
+				d.notifyImageUpdate(service, digest, "notify", nil)
+			}
+			continue
+		}
+		newID, err := d.redeployContainer(cli, service)
+		if err != nil {
+			WarnLog("Discover redeploy %v/%v by %v fail with %v", service.Name, id, service.Image, err)
+		} else {
+			InfoLog("Discover redeploy %v/%v to %v by %v@%v success", service.Name, id, newID, service.Image, digest)
+			redeployed++
+		}
+		d.notifyImageUpdate(service, digest, "redeploy", err)
+	}
+	if redeployed > 0 && !d.IsPaused() {
+		d.RefreshNow()
+	}
+}
@@ -0,0 +1,85 @@
+package discover
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingeasygo/util/converter"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+func TestImageUpdate(t *testing.T) {
+	notified := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		notified <- r.Header.Get("X-PD-Event") + " " + string(data)
+	}))
+	defer ts.Close()
+	discover := NewDiscover()
+	discover.UpdateHook = ts.URL
+	service := &Container{ID: "c1", Name: "ds", Image: "ds:latest", Update: "notify"}
+	discover.notifyImageUpdate(service, "sha256:abc", "notify", nil)
+	if info := <-notified; !strings.HasPrefix(info, "image ") || !strings.Contains(info, `"digest":"sha256:abc"`) {
+		t.Error(info)
+		return
+	}
+	discover.notifyImageUpdate(service, "sha256:abc", "redeploy", fmt.Errorf("xx"))
+	if info := <-notified; !strings.Contains(info, `"action":"redeploy"`) || !strings.Contains(info, `"error":"xx"`) {
+		t.Error(info)
+		return
+	}
+	//disabled
+	discover.callUpdate()
+	if !discover.updateLast.IsZero() {
+		t.Error("error")
+		return
+	}
+	//interval
+	discover.UpdateInterval = time.Hour
+	last := time.Now()
+	discover.updateLast = last
+	discover.callUpdate()
+	if discover.updateLast != last || discover.updateRunning {
+		t.Error("error")
+		return
+	}
+}
+
+func TestRedeployNetworks(t *testing.T) {
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "0123456789abcdef", HostConfig: &container.HostConfig{NetworkMode: "app"}},
+		NetworkSettings: &types.NetworkSettings{Networks: map[string]*network.EndpointSettings{
+			"app": {
+				IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: "172.20.0.10"},
+				Aliases:    []string{"0123456789ab", "db"},
+				IPAddress:  "172.20.0.10",
+				NetworkID:  "n1",
+			},
+			"monitor": {Aliases: []string{"ds"}, EndpointID: "e1"},
+		}},
+	}
+	primary, others := redeployNetworks(inspect)
+	app := primary.EndpointsConfig["app"]
+	if len(primary.EndpointsConfig) != 1 || app == nil || app.IPAMConfig.IPv4Address != "172.20.0.10" || len(app.Aliases) != 1 || app.Aliases[0] != "db" || len(app.NetworkID) > 0 {
+		t.Error(converter.JSON(primary))
+		return
+	}
+	if len(others) != 1 || others["monitor"] == nil || others["monitor"].Aliases[0] != "ds" || len(others["monitor"].EndpointID) > 0 {
+		t.Error(converter.JSON(others))
+		return
+	}
+	//default network mode
+	inspect.HostConfig.NetworkMode = "default"
+	inspect.NetworkSettings.Networks = map[string]*network.EndpointSettings{"bridge": {}}
+	if primary, others = redeployNetworks(inspect); primary.EndpointsConfig["bridge"] == nil || len(others) != 0 {
+		t.Error(converter.JSON(primary))
+		return
+	}
+}
@@ -0,0 +1,278 @@
+package discover
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+const upgradeTimeout = 5 * time.Minute
+
+// upgradeServer is the served http server which is drained and handed over on upgrade
+type upgradeServer struct {
+	Name     string
+	Server   *http.Server
+	Listener net.Listener
+}
+
+// upgradeSocket is the socket file which is handed over to upgraded process
+type upgradeSocket struct {
+	Name string
+	File *os.File
+}
+
+// ParseUpgradeKey will parse the base64 ed25519 public key which is used to verify release binary
+func ParseUpgradeKey(key string) (public ed25519.PublicKey, err error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return
+	}
+	if len(data) != ed25519.PublicKeySize {
+		err = fmt.Errorf("invalid ed25519 public key size %v", len(data))
+		return
+	}
+	public = ed25519.PublicKey(data)
+	return
+}
+
+// SignRelease will sign the release binary of version by ed25519 private key, the signature is like <version> <base64 signature>
+// and the signed payload is <version>\n<binary>, so the version can't be replaced without the private key
+func SignRelease(binary []byte, version string, private ed25519.PrivateKey) (signature []byte) {
+	sig := ed25519.Sign(private, append([]byte(version+"\n"), binary...))
+	signature = []byte(version + " " + base64.StdEncoding.EncodeToString(sig))
+	return
+}
+
+// VerifyRelease will verify the signature like <version> <base64 signature> of release binary by public key,
+// and return the signed version
+func VerifyRelease(binary, signature []byte, key string) (version string, err error) {
+	public, err := ParseUpgradeKey(key)
+	if err != nil {
+		err = fmt.Errorf("parse upgrade key fail with %v", err)
+		return
+	}
+	fields := strings.Fields(string(signature))
+	if len(fields) != 2 {
+		err = fmt.Errorf("signature must be <version> <base64 signature>")
+		return
+	}
+	sig, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		err = fmt.Errorf("parse signature fail with %v", err)
+		return
+	}
+	if !ed25519.Verify(public, append([]byte(fields[0]+"\n"), binary...), sig) {
+		err = fmt.Errorf("signature is not matched")
+		return
+	}
+	version = fields[0]
+	return
+}
+
+// checkUpgradeURL will check the uri is on the origin of UpgradeURL, so the admin can't be used to fetch other address
+func (d *Discover) checkUpgradeURL(uri string) (err error) {
+	base, err := url.Parse(d.UpgradeURL)
+	if err != nil || len(base.Host) < 1 {
+		err = fmt.Errorf("upgrade url %v is invalid", d.UpgradeURL)
+		return
+	}
+	target, err := url.Parse(uri)
+	if err != nil {
+		return
+	}
+	if target.Scheme != base.Scheme || !strings.EqualFold(target.Host, base.Host) || len(target.User.String()) > 0 {
+		err = fmt.Errorf("upgrade url %v is not on %v://%v", uri, base.Scheme, base.Host)
+	}
+	return
+}
+
+func downloadRelease(client *http.Client, uri string) (data []byte, err error) {
+	res, err := client.Get(uri)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("download %v fail with status %v", uri, res.StatusCode)
+		return
+	}
+	data, err = ioutil.ReadAll(res.Body)
+	return
+}
+
+// FetchUpgrade will download the release binary from uri and signature from uri.sig, the binary is written to target
+// after it is verified by UpgradeKey and the signed version is newer than UpgradeVersion, the uri must be on the origin of
+// UpgradeURL, and the UpgradeURL is used when uri is empty
+func (d *Discover) FetchUpgrade(uri, target string) (err error) {
+	if len(d.UpgradeURL) < 1 {
+		err = fmt.Errorf("upgrade url is not configured")
+		return
+	}
+	if len(uri) < 1 {
+		uri = d.UpgradeURL
+	}
+	if err = d.checkUpgradeURL(uri); err != nil {
+		return
+	}
+	if len(d.UpgradeKey) < 1 {
+		err = fmt.Errorf("upgrade key is not configured, the release can't be verified")
+		return
+	}
+	client := &http.Client{Timeout: upgradeTimeout}
+	binary, err := downloadRelease(client, uri)
+	if err != nil {
+		return
+	}
+	signature, err := downloadRelease(client, uri+".sig")
+	if err != nil {
+		return
+	}
+	version, err := VerifyRelease(binary, signature, d.UpgradeKey)
+	if err != nil {
+		err = fmt.Errorf("verify %v fail with %v", uri, err)
+		return
+	}
+	if len(d.UpgradeVersion) > 0 && CompareVersion(version, d.UpgradeVersion) <= 0 {
+		err = fmt.Errorf("release version %v is not newer than %v", version, d.UpgradeVersion)
+		return
+	}
+	err = ioutil.WriteFile(target, binary, 0755)
+	if err == nil {
+		InfoLog("Discover fetch upgrade %v from %v success with %v bytes", version, uri, len(binary))
+	}
+	return
+}
+
+func upgradeExecutable() (exe string, err error) {
+	exe, err = os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	return
+}
+
+// AddUpgradeServer will add the served http server and listener, it is drained and the listener is handed over on upgrade
+func (d *Discover) AddUpgradeServer(name string, server *http.Server, ln net.Listener) {
+	d.upgradeLock.Lock()
+	d.upgradeServers = append(d.upgradeServers, &upgradeServer{Name: name, Server: server, Listener: ln})
+	d.upgradeLock.Unlock()
+}
+
+type fileSocket interface {
+	File() (*os.File, error)
+}
+
+// upgradeSockets will return the file of all listen sockets include forward listener
+func (d *Discover) upgradeSockets() (sockets []*upgradeSocket, err error) {
+	add := func(name string, socket interface{}) {
+		if err != nil {
+			return
+		}
+		fs, ok := socket.(fileSocket)
+		if !ok {
+			WarnLog("Discover socket %v can't be handed over", name)
+			return
+		}
+		var file *os.File
+		if file, err = fs.File(); err == nil {
+			sockets = append(sockets, &upgradeSocket{Name: name, File: file})
+		}
+	}
+	for _, server := range d.upgradeServers {
+		add(server.Name, server.Listener)
+	}
+	d.proxyLock.RLock()
+	for _, ln := range d.proxyListen {
+		if ln.TCP != nil {
+			add(ln.Forward.Key, ln.TCP)
+		} else if ln.UDP != nil {
+			add(ln.Forward.Key, ln.UDP)
+		}
+	}
+	d.proxyLock.RUnlock()
+	return
+}
+
+// Upgrade will replace current executable by binary and restart in place, the listen sockets are handed over to new process
+// and the http servers are drained in UpgradeDrain before restarting
+func (d *Discover) Upgrade(binary string) (err error) {
+	d.upgradeLock.Lock()
+	defer d.upgradeLock.Unlock()
+	exe, err := upgradeExecutable()
+	if err != nil {
+		return
+	}
+	sockets, err := d.upgradeSockets()
+	if err != nil {
+		return
+	}
+	if err = os.Rename(binary, exe); err != nil {
+		return
+	}
+	InfoLog("Discover upgrade is replaced %v, start drain %v servers", exe, len(d.upgradeServers))
+	d.StopRefresh()
+	ctx, cancel := context.WithTimeout(context.Background(), d.UpgradeDrain)
+	defer cancel()
+	waiter := sync.WaitGroup{}
+	for _, server := range d.upgradeServers {
+		waiter.Add(1)
+		go func(server *upgradeServer) {
+			defer waiter.Done()
+			if xerr := server.Server.Shutdown(ctx); xerr != nil {
+				WarnLog("Discover drain server %v fail with %v", server.Name, xerr)
+			}
+		}(server)
+	}
+	waiter.Wait()
+	if d.Latency {
+		d.saveLatency()
+	}
+	InfoLog("Discover upgrade is restarting %v with %v sockets", exe, len(sockets))
+	err = execUpgrade(exe, sockets)
+	ErrorLog("Discover upgrade restart %v fail with %v, exit for restarting by service manager", exe, err)
+	os.Exit(1)
+	return
+}
+
+// procAdminUpgrade will download and verify the release binary by url or UpgradeURL, and restart in place after response
+func (d *Discover) procAdminUpgrade(w http.ResponseWriter, r *http.Request) {
+	if !UpgradeSupported {
+		writeJSON(w, http.StatusNotImplemented, xmap.M{"code": http.StatusNotImplemented, "message": "upgrade is not supported"})
+		return
+	}
+	exe, err := upgradeExecutable()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, xmap.M{"code": http.StatusInternalServerError, "message": err.Error()})
+		return
+	}
+	uri := r.FormValue("url")
+	target := exe + ".upgrade"
+	if err = d.FetchUpgrade(uri, target); err != nil {
+		WarnLog("Discover fetch upgrade fail with %v", err)
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": err.Error()})
+		return
+	}
+	if len(uri) < 1 {
+		uri = d.UpgradeURL
+	}
+	InfoLog("Discover audit upgrade from %v is started from %v", uri, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, xmap.M{"url": uri, "executable": exe, "restarting": true})
+	go func() {
+		if err := d.Upgrade(target); err != nil {
+			WarnLog("Discover upgrade fail with %v", err)
+			os.Remove(target)
+		}
+	}()
+}
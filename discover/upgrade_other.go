@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package discover
+
+import (
+	"fmt"
+)
+
+// UpgradeSupported is true when in place upgrade is supported on current platform
+const UpgradeSupported = false
+
+func execUpgrade(exe string, sockets []*upgradeSocket) (err error) {
+	err = fmt.Errorf("in place upgrade is not supported")
+	return
+}
@@ -0,0 +1,124 @@
+package discover
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpgrade(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	binary := []byte("new binary")
+	signature := string(SignRelease(binary, "v1.1.0", private))
+	release := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pdservice":
+			w.Write(binary)
+		case "/pdservice.sig":
+			w.Write([]byte(signature + "\n"))
+		case "/bad":
+			w.Write([]byte("bad binary"))
+		case "/bad.sig":
+			w.Write([]byte(signature))
+		case "/replaced", "/old":
+			w.Write(binary)
+		case "/replaced.sig":
+			w.Write([]byte(strings.Replace(signature, "v1.1.0", "v9.0.0", 1)))
+		case "/old.sig":
+			w.Write(SignRelease(binary, "v1.0.0", private))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer release.Close()
+	key := base64.StdEncoding.EncodeToString(public)
+	if version, err := VerifyRelease(binary, []byte(signature), key); err != nil || version != "v1.1.0" {
+		t.Error(err)
+		return
+	}
+	if _, err := VerifyRelease(binary, []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, binary))), key); err == nil {
+		t.Error("error")
+		return
+	}
+	if _, err := VerifyRelease(binary, []byte(signature), "xx"); err == nil {
+		t.Error("error")
+		return
+	}
+	dir, _ := ioutil.TempDir("", "upgrade")
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "pdservice")
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	discover.AdminToken = "123"
+	if err := discover.FetchUpgrade(release.URL+"/pdservice", target); err == nil || !strings.Contains(err.Error(), "upgrade url") {
+		t.Error(err)
+		return
+	}
+	discover.UpgradeURL = release.URL + "/pdservice"
+	discover.UpgradeVersion = "v1.0.0"
+	if err := discover.FetchUpgrade("", target); err == nil || !strings.Contains(err.Error(), "upgrade key") {
+		t.Error(err)
+		return
+	}
+	discover.UpgradeKey = key
+	if err := discover.FetchUpgrade("", target); err != nil {
+		t.Error(err)
+		return
+	}
+	if data, _ := ioutil.ReadFile(target); string(data) != string(binary) {
+		t.Error(string(data))
+		return
+	}
+	os.Remove(target)
+	if err := discover.FetchUpgrade(release.URL+"/bad", target); err == nil || !strings.Contains(err.Error(), "not matched") {
+		t.Error(err)
+		return
+	}
+	if err := discover.FetchUpgrade(release.URL+"/none", target); err == nil {
+		t.Error("error")
+		return
+	}
+	if err := discover.FetchUpgrade(release.URL+"/replaced", target); err == nil || !strings.Contains(err.Error(), "not matched") {
+		t.Error(err)
+		return
+	}
+	if err := discover.FetchUpgrade(release.URL+"/old", target); err == nil || !strings.Contains(err.Error(), "not newer") {
+		t.Error(err)
+		return
+	}
+	for _, uri := range []string{"http://127.0.0.2:1/pdservice", strings.Replace(release.URL, "http://", "http://user@", 1) + "/pdservice", "file:///etc/passwd"} {
+		if err := discover.FetchUpgrade(uri, target); err == nil || !strings.Contains(err.Error(), "is not on") {
+			t.Error(uri, err)
+			return
+		}
+	}
+	if _, err := os.Stat(target); err == nil {
+		t.Error("error")
+		return
+	}
+	//admin
+	req := httptest.NewRequest("POST", "http://pdsrv/_api/upgrade", strings.NewReader("url="+release.URL+"/bad"))
+	req.Header.Set("Authorization", "Bearer 123")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, req)
+	if res.Code != http.StatusBadRequest && res.Code != http.StatusNotImplemented {
+		t.Errorf("%v,%v", res.Code, res.Body.String())
+		return
+	}
+	//sockets
+	discover.AddUpgradeServer(":0", &http.Server{}, release.Listener)
+	sockets, err := discover.upgradeSockets()
+	if err != nil || len(sockets) != 1 || sockets[0].Name != ":0" {
+		t.Error(err)
+		return
+	}
+	sockets[0].File.Close()
+}
@@ -0,0 +1,37 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package discover
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// UpgradeSupported is true when in place upgrade is supported on current platform
+const UpgradeSupported = true
+
+// execUpgrade will exec the executable in current process, the socket fd is kept by dup without close-on-exec
+// and passed by PDSERVICE_UPGRADE_FDS as fd:name list
+func execUpgrade(exe string, sockets []*upgradeSocket) (err error) {
+	fds := []string{}
+	for _, socket := range sockets {
+		fd, xerr := syscall.Dup(int(socket.File.Fd()))
+		if xerr != nil {
+			err = xerr
+			return
+		}
+		fds = append(fds, fmt.Sprintf("%v:%v", fd, socket.Name))
+	}
+	env := []string{}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "PDSERVICE_UPGRADE_") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, fmt.Sprintf("PDSERVICE_UPGRADE_PID=%v", os.Getpid()), "PDSERVICE_UPGRADE_FDS="+strings.Join(fds, ","))
+	err = syscall.Exec(exe, os.Args, env)
+	return
+}
@@ -0,0 +1,100 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Validate will validate the discover configure and return all problems
+func (d *Discover) Validate() (errs []error) {
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	for _, e := range d.DockerClearExc {
+		if _, err := regexp.Compile(e); err != nil {
+			fail("docker_clear_exc %v is invalid by %v", e, err)
+		}
+	}
+	for _, e := range d.DockerPruneExc {
+		if e != "network" && e != "image" && e != "container" {
+			fail("docker_prune_exc %v is invalid, must be one of network/image/container", e)
+		}
+	}
+	for _, pattern := range d.Hidden {
+		if _, err := compileHostPattern(pattern); err != nil {
+			fail("hidden %v is invalid by %v", pattern, err)
+		}
+	}
+	if err := d.CheckMiddlewares(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(d.DockerFinder) < 1 {
+		for _, name := range []string{"ca.pem", "cert.pem", "key.pem"} {
+			if _, err := os.Stat(filepath.Join(d.DockerCert, name)); err != nil {
+				fail("docker_cert %v is invalid by %v", d.DockerCert, err)
+			}
+		}
+	}
+	for name, val := range map[string]time.Duration{
+		"dial_timeout": d.DialTimeout,
+		"udp_timeout":  d.UDPTimeout,
+	} {
+		if val <= 0 {
+			fail("%v %v must be greater than zero", name, val)
+		}
+	}
+	if d.DialRetry < 0 || d.DialBackoff < 0 {
+		fail("dial_retry %v/dial_backoff %v must not be negative", d.DialRetry, d.DialBackoff)
+	}
+	if d.MaxBodySize < 0 || d.MirrorMaxBody < 0 {
+		fail("max_body_size %v/mirror_max_body %v must not be negative", d.MaxBodySize, d.MirrorMaxBody)
+	}
+	switch {
+	case d.UnknownHost == "catalog", d.UnknownHost == "404", strings.HasPrefix(d.UnknownHost, "redirect:"):
+	case d.UnknownHost == "template":
+		if d.UnknownTemplate == nil {
+			fail("unknown_template is required by unknown_host=template")
+		}
+	default:
+		fail("unknown_host %v is invalid, must be one of catalog/404/redirect:<url>/template", d.UnknownHost)
+	}
+	if d.PrefixCollision != CollisionNewest && d.PrefixCollision != CollisionOldest {
+		fail("prefix_collision %v is invalid, must be one of newest/oldest", d.PrefixCollision)
+	}
+	switch d.TriggerMode {
+	case "", "shell", "exec", "powershell":
+	case "container":
+		if len(d.TriggerImage) < 1 {
+			fail("trigger_image is required by trigger_mode=container")
+		}
+	default:
+		fail("trigger_mode %v is invalid, must be one of shell/exec/powershell/container", d.TriggerMode)
+	}
+	for name, prefix := range map[string]string{
+		"srv_prefix":     d.SrvPrefix,
+		"admin_prefix":   d.AdminPrefix,
+		"preview_static": d.PreviewStatic,
+	} {
+		if len(prefix) > 0 && !strings.HasPrefix(prefix, "/") {
+			fail("%v %v must start with /", name, prefix)
+		}
+	}
+	return
+}
+
+// CheckDocker will check the docker connectivity
+func (d *Discover) CheckDocker() (err error) {
+	cli, _, err := d.newDockerClient()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = cli.Ping(ctx)
+	return
+}
@@ -0,0 +1,38 @@
+package discover
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	discover := NewDiscover()
+	discover.DockerFinder = "finder"
+	discover.SrvPrefix = "/_s/"
+	if errs := discover.Validate(); len(errs) > 0 {
+		t.Error(errs)
+		return
+	}
+	discover.DockerClearExc = []string{"("}
+	discover.DockerPruneExc = []string{"volume"}
+	discover.Hidden = []string{"re:("}
+	discover.DialTimeout = 0
+	discover.UnknownHost = "xx"
+	discover.AdminPrefix = "api"
+	if errs := discover.Validate(); len(errs) != 6 {
+		t.Error(errs)
+		return
+	}
+	discover = NewDiscover()
+	discover.DockerFinder = "finder"
+	discover.UnknownHost = "template"
+	if errs := discover.Validate(); len(errs) != 1 {
+		t.Error(errs)
+		return
+	}
+	discover = NewDiscover()
+	discover.DockerCert = "/none"
+	if errs := discover.Validate(); len(errs) != 3 {
+		t.Error(errs)
+		return
+	}
+}
@@ -0,0 +1,240 @@
+package discover
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WAFRule is the rule to match request and do action, the rule text is
+//
+//	<action> [method=GET|POST] [path=<regexp>] [query=<regexp>] [header:<name>=<regexp>]
+//
+// action is block, log or ratelimit:<count>/<s|m|h> which is limited by client ip, all conditions must be matched.
+type WAFRule struct {
+	Text    string
+	Action  string
+	Limit   int
+	Window  time.Duration
+	Methods []string
+	Path    *regexp.Regexp
+	Query   *regexp.Regexp
+	Headers map[string]*regexp.Regexp
+}
+
+// ParseWAFRule will parse the rule text
+func ParseWAFRule(text string) (rule *WAFRule, err error) {
+	fields := strings.Fields(text)
+	if len(fields) < 1 {
+		err = fmt.Errorf("empty rule")
+		return
+	}
+	rule = &WAFRule{Text: text, Headers: map[string]*regexp.Regexp{}}
+	action := fields[0]
+	switch {
+	case action == "block", action == "log":
+		rule.Action = action
+	case strings.HasPrefix(action, "ratelimit:"):
+		rule.Action = "ratelimit"
+		parts := strings.SplitN(strings.TrimPrefix(action, "ratelimit:"), "/", 2)
+		if len(parts) != 2 {
+			err = fmt.Errorf("invalid ratelimit %v", action)
+			return
+		}
+		if rule.Limit, err = strconv.Atoi(parts[0]); err != nil || rule.Limit < 1 {
+			err = fmt.Errorf("invalid ratelimit %v", action)
+			return
+		}
+		switch parts[1] {
+		case "s":
+			rule.Window = time.Second
+		case "m":
+			rule.Window = time.Minute
+		case "h":
+			rule.Window = time.Hour
+		default:
+			err = fmt.Errorf("invalid ratelimit %v", action)
+			return
+		}
+	default:
+		err = fmt.Errorf("invalid action %v", action)
+		return
+	}
+	for _, field := range fields[1:] {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			err = fmt.Errorf("invalid condition %v", field)
+			return
+		}
+		key, val := parts[0], parts[1]
+		switch {
+		case key == "method":
+			rule.Methods = strings.Split(strings.ToUpper(val), "|")
+		case key == "path":
+			rule.Path, err = regexp.Compile(val)
+		case key == "query":
+			rule.Query, err = regexp.Compile(val)
+		case strings.HasPrefix(key, "header:"):
+			rule.Headers[http.CanonicalHeaderKey(strings.TrimPrefix(key, "header:"))], err = regexp.Compile(val)
+		default:
+			err = fmt.Errorf("invalid condition %v", field)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ParseWAFRules will parse the rule text which is split by new line or ;, the line started with # is ignored
+func ParseWAFRules(text string) (rules []*WAFRule, err error) {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		for _, line := range strings.Split(scanner.Text(), ";") {
+			line = strings.TrimSpace(line)
+			if len(line) < 1 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			var rule *WAFRule
+			if rule, err = ParseWAFRule(line); err != nil {
+				err = fmt.Errorf("parse rule %v fail with %v", line, err)
+				return
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return
+}
+
+// LoadWAFRules will load rule from file
+func LoadWAFRules(filename string) (rules []*WAFRule, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err == nil {
+		rules, err = ParseWAFRules(string(data))
+	}
+	return
+}
+
+// Match will check if the request is matched by rule
+func (w *WAFRule) Match(r *http.Request) bool {
+	if len(w.Methods) > 0 {
+		matched := false
+		for _, method := range w.Methods {
+			if method == r.Method {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if w.Path != nil && !w.Path.MatchString(r.URL.Path) {
+		return false
+	}
+	if w.Query != nil && !w.Query.MatchString(r.URL.RawQuery) {
+		return false
+	}
+	for name, match := range w.Headers {
+		if !match.MatchString(r.Header.Get(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+type wafWindow struct {
+	Start time.Time
+	Count int
+}
+
+// WAF is the rule engine to check request by global and forward rules
+type WAF struct {
+	Rules    []*WAFRule
+	cache    map[string][]*WAFRule
+	windows  map[string]*wafWindow
+	lock     sync.Mutex
+	sweeping time.Time
+}
+
+// NewWAF will create the WAF by global rules
+func NewWAF(rules []*WAFRule) (waf *WAF) {
+	waf = &WAF{
+		Rules:   rules,
+		cache:   map[string][]*WAFRule{},
+		windows: map[string]*wafWindow{},
+	}
+	return
+}
+
+func (w *WAF) forwardRules(forward *Forward) (rules []*WAFRule) {
+	if len(forward.WAF) < 1 {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	rules, ok := w.cache[forward.WAF]
+	if ok {
+		return
+	}
+	rules, err := ParseWAFRules(forward.WAF)
+	if err != nil {
+		WarnLog("Discover parse waf rule on %v fail with %v", forward.Prefix, err)
+	}
+	w.cache[forward.WAF] = rules
+	return
+}
+
+func (w *WAF) allowRate(rule *WAFRule, key string) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	now := time.Now()
+	if len(w.windows) > 10000 && now.Sub(w.sweeping) > time.Minute {
+		for k, window := range w.windows {
+			if now.Sub(window.Start) > time.Hour {
+				delete(w.windows, k)
+			}
+		}
+		w.sweeping = now
+	}
+	key = rule.Text + "|" + key
+	window := w.windows[key]
+	if window == nil || now.Sub(window.Start) >= rule.Window {
+		window = &wafWindow{Start: now}
+		w.windows[key] = window
+	}
+	window.Count++
+	return window.Count <= rule.Limit
+}
+
+// Check will check request by global and forward rules, the status code is returned when it is blocked
+func (w *WAF) Check(forward *Forward, r *http.Request, client string) (code int) {
+	for _, rules := range [][]*WAFRule{w.Rules, w.forwardRules(forward)} {
+		for _, rule := range rules {
+			if !rule.Match(r) {
+				continue
+			}
+			switch rule.Action {
+			case "log":
+				InfoLog("Discover waf rule %v is matched on %v%v from %v", rule.Text, r.Host, r.URL.Path, client)
+			case "block":
+				WarnLog("Discover waf rule %v is blocked on %v%v from %v", rule.Text, r.Host, r.URL.Path, client)
+				code = http.StatusForbidden
+				return
+			case "ratelimit":
+				if !w.allowRate(rule, client) {
+					DebugLog("Discover waf rule %v is limited on %v%v from %v", rule.Text, r.Host, r.URL.Path, client)
+					code = http.StatusTooManyRequests
+					return
+				}
+			}
+		}
+	}
+	return
+}
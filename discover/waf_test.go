@@ -0,0 +1,77 @@
+package discover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseWAFRule(t *testing.T) {
+	rules, err := ParseWAFRules(`
+# global
+block path=^/(wp-admin|\.env) ; log header:user-agent=(?i)sqlmap
+ratelimit:2/m method=post|put path=^/login query=a=1
+`)
+	if err != nil || len(rules) != 3 {
+		t.Errorf("%v,%v", rules, err)
+		return
+	}
+	if rules[1].Headers["User-Agent"] == nil || rules[2].Limit != 2 || len(rules[2].Methods) != 2 || rules[2].Methods[0] != "POST" || rules[2].Query.String() != "a=1" {
+		t.Error(rules)
+		return
+	}
+	for _, text := range []string{"xx", "ratelimit:x/s", "ratelimit:1/d", "ratelimit:1", "block path=(", "block xx", "block xx=1"} {
+		if _, err = ParseWAFRule(text); err == nil {
+			t.Error(text)
+			return
+		}
+	}
+	if _, err = ParseWAFRules("block;xx"); err == nil {
+		t.Error("error")
+		return
+	}
+}
+
+func TestWAF(t *testing.T) {
+	rules, _ := ParseWAFRules("block path=^/\\.env;log header:User-Agent=curl")
+	waf := NewWAF(rules)
+	forward := &Forward{Prefix: "v100.ds", WAF: "ratelimit:2/m method=POST path=^/login"}
+	check := func(method, path string) int {
+		req := httptest.NewRequest(method, "http://v100.ds"+path, nil)
+		req.Header.Set("User-Agent", "curl")
+		return waf.Check(forward, req, "127.0.0.1")
+	}
+	if code := check("GET", "/.env"); code != http.StatusForbidden {
+		t.Error(code)
+		return
+	}
+	if code := check("GET", "/"); code != 0 {
+		t.Error(code)
+		return
+	}
+	for i, expect := range []int{0, 0, http.StatusTooManyRequests} {
+		if code := check("POST", "/login"); code != expect {
+			t.Errorf("%v->%v", i, code)
+			return
+		}
+	}
+	if code := waf.Check(forward, httptest.NewRequest("POST", "http://v100.ds/login", nil), "127.0.0.2"); code != 0 {
+		t.Error(code)
+		return
+	}
+	forward.WAF = "xx"
+	if code := check("POST", "/login"); code != 0 {
+		t.Error(code)
+		return
+	}
+	//serve
+	discover := NewDiscover()
+	discover.WAF = waf
+	discover.proxyReverse["v100.ds"] = &ReverseProxy{Forward: forward, Service: &Container{}}
+	res := httptest.NewRecorder()
+	discover.ServeHTTP(res, httptest.NewRequest("GET", "http://v100.ds/.env", nil))
+	if res.Code != http.StatusForbidden {
+		t.Error(res.Code)
+		return
+	}
+}
@@ -0,0 +1,54 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// ParseWireGuardPeers will parse the peers of docker host to WireGuard tunnel address by docker_host=tunnel_ip
+func ParseWireGuardPeers(peers []string) (parsed map[string]string, err error) {
+	parsed = map[string]string{}
+	for _, peer := range peers {
+		parts := strings.SplitN(peer, "=", 2)
+		if len(parts) < 2 || len(parts[0]) < 1 || net.ParseIP(parts[1]) == nil {
+			err = fmt.Errorf("invalid wireguard peer %v, must be docker_host=tunnel_ip", peer)
+			return
+		}
+		parsed[parts[0]] = parts[1]
+	}
+	return
+}
+
+// wireguardHost will return the WireGuard tunnel address of docker host, the docker host is returned when peer is not configured
+func (d *Discover) wireguardHost(remoteHost string) string {
+	if peer, ok := d.WireGuardPeers[remoteHost]; ok && len(d.WireGuard) > 0 {
+		return peer
+	}
+	return remoteHost
+}
+
+// ensureWireGuard will bring up the WireGuard interface by wg-quick when it is not found and WireGuardConfig is configured
+func (d *Discover) ensureWireGuard() (err error) {
+	if len(d.WireGuard) < 1 {
+		return
+	}
+	if _, xerr := net.InterfaceByName(d.WireGuard); xerr == nil {
+		return
+	}
+	if len(d.WireGuardConfig) < 1 {
+		err = fmt.Errorf("wireguard interface %v is not found", d.WireGuard)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.TriggerTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, d.WireGuardCommand, "up", d.WireGuardConfig).CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("%v up %v fail with %v, out is %v", d.WireGuardCommand, d.WireGuardConfig, err, strings.TrimSpace(string(out)))
+		return
+	}
+	InfoLog("Discover wireguard interface %v is up by %v", d.WireGuard, d.WireGuardConfig)
+	return
+}
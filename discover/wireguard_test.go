@@ -0,0 +1,61 @@
+package discover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWireGuard(t *testing.T) {
+	peers, err := ParseWireGuardPeers([]string{"127.0.0.1=10.8.0.2", "docker1=fd00::2"})
+	if err != nil || peers["127.0.0.1"] != "10.8.0.2" || peers["docker1"] != "fd00::2" {
+		t.Error(peers, err)
+		return
+	}
+	for _, peer := range []string{"127.0.0.1", "=10.8.0.2", "127.0.0.1=xx"} {
+		if _, err = ParseWireGuardPeers([]string{peer}); err == nil {
+			t.Error(peer)
+			return
+		}
+	}
+	discover := NewDiscover()
+	discover.WireGuardPeers = peers
+	if err = discover.ensureWireGuard(); err != nil || discover.wireguardHost("127.0.0.1") != "127.0.0.1" {
+		t.Error(err)
+		return
+	}
+	discover.WireGuard = "pdwgtest0"
+	if discover.wireguardHost("127.0.0.1") != "10.8.0.2" || discover.wireguardHost("127.0.0.2") != "127.0.0.2" {
+		t.Error("error")
+		return
+	}
+	if err = discover.ensureWireGuard(); err == nil {
+		t.Error(err)
+		return
+	}
+	dir, _ := ioutil.TempDir("", "wireguard")
+	defer os.RemoveAll(dir)
+	command := filepath.Join(dir, "wg-quick")
+	ioutil.WriteFile(command, []byte("#!/bin/sh\necho \"$@\" > "+filepath.Join(dir, "out")+"\n"), 0755)
+	discover.WireGuardConfig = "/etc/wireguard/pdwgtest0.conf"
+	discover.WireGuardCommand = command
+	if err = discover.ensureWireGuard(); err != nil {
+		t.Error(err)
+		return
+	}
+	if out, _ := ioutil.ReadFile(filepath.Join(dir, "out")); string(out) != "up /etc/wireguard/pdwgtest0.conf\n" {
+		t.Error(string(out))
+		return
+	}
+	discover.WireGuardCommand = filepath.Join(dir, "none")
+	if err = discover.ensureWireGuard(); err == nil {
+		t.Error(err)
+		return
+	}
+	discover.WireGuard = "lo"
+	if err = discover.ensureWireGuard(); err != nil {
+		t.Error(err)
+		return
+	}
+}
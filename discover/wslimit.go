@@ -0,0 +1,238 @@
+package discover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WebSocketStats is the proxied websocket connection accounting of forward
+type WebSocketStats struct {
+	Prefix   string `json:"prefix"`
+	Name     string `json:"name"`
+	Active   int    `json:"active"`
+	Total    int64  `json:"total"`
+	Rejected int64  `json:"rejected"`
+	Idle     int64  `json:"idle"`
+	Lifetime int64  `json:"lifetime"`
+}
+
+// isWebSocket will return if the request is websocket upgrade
+func isWebSocket(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// webSocketPolicy will return the max connections, idle timeout and max lifetime of forward, the PD_WS_* label
+// overrides the global config
+func (d *Discover) webSocketPolicy(forward *Forward) (max int, idle, lifetime time.Duration) {
+	max, idle, lifetime = d.WebSocketMax, d.WebSocketIdle, d.WebSocketLifetime
+	if forward.WebSocketMax > 0 {
+		max = forward.WebSocketMax
+	}
+	if forward.WebSocketIdle > 0 {
+		idle = forward.WebSocketIdle
+	}
+	if forward.WebSocketLifetime > 0 {
+		lifetime = forward.WebSocketLifetime
+	}
+	return
+}
+
+// acquireWebSocket will count the websocket connection of forward, false is returned when it is over max connections
+func (d *Discover) acquireWebSocket(reverse *ReverseProxy, max int) (stats *WebSocketStats, ok bool) {
+	d.webSocketLock.Lock()
+	defer d.webSocketLock.Unlock()
+	if d.webSocketAll == nil {
+		d.webSocketAll = map[string]*WebSocketStats{}
+	}
+	stats = d.webSocketAll[reverse.Forward.Prefix]
+	if stats == nil {
+		stats = &WebSocketStats{Prefix: reverse.Forward.Prefix}
+		d.webSocketAll[reverse.Forward.Prefix] = stats
+	}
+	stats.Name = reverse.Service.Name
+	if max > 0 && stats.Active >= max {
+		stats.Rejected++
+		return
+	}
+	stats.Active++
+	stats.Total++
+	ok = true
+	return
+}
+
+func (d *Discover) releaseWebSocket(stats *WebSocketStats, reason string) {
+	d.webSocketLock.Lock()
+	stats.Active--
+	switch reason {
+	case "idle":
+		stats.Idle++
+	case "lifetime":
+		stats.Lifetime++
+	}
+	d.webSocketLock.Unlock()
+}
+
+// serveWebSocket will proxy the websocket by max connections, idle timeout and max lifetime policy of forward,
+// the connection is closed when there is no data in both direction in idle timeout or it is alive over lifetime
+func (d *Discover) serveWebSocket(w http.ResponseWriter, r *http.Request, reverse *ReverseProxy) {
+	max, idle, lifetime := d.webSocketPolicy(reverse.Forward)
+	stats, ok := d.acquireWebSocket(reverse, max)
+	if !ok {
+		WarnLog("Discover websocket of %v is rejected by max %v connections", reverse.Forward.Prefix, max)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many websocket connections", http.StatusServiceUnavailable)
+		return
+	}
+	writer := &webSocketWriter{ResponseWriter: w, idle: idle, lifetime: lifetime}
+	reverse.Reverse.ServeHTTP(writer, r)
+	reason := ""
+	if writer.conn != nil {
+		reason = writer.conn.reason()
+	}
+	d.releaseWebSocket(stats, reason)
+}
+
+// WebSocketStats will return the websocket stats of all forwards
+func (d *Discover) WebSocketStats() (all []*WebSocketStats) {
+	all = []*WebSocketStats{}
+	d.webSocketLock.Lock()
+	for _, stats := range d.webSocketAll {
+		copied := *stats
+		all = append(all, &copied)
+	}
+	d.webSocketLock.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].Prefix < all[j].Prefix })
+	return
+}
+
+type webSocketWriter struct {
+	http.ResponseWriter
+	idle     time.Duration
+	lifetime time.Duration
+	conn     *webSocketConn
+}
+
+func (w *webSocketWriter) Hijack() (conn net.Conn, rw *bufio.ReadWriter, err error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		err = fmt.Errorf("hijack is not supported")
+		return
+	}
+	raw, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	w.conn = newWebSocketConn(raw, w.idle, w.lifetime)
+	conn = w.conn
+	return
+}
+
+// webSocketConn will record the last active time of hijacked connection and close it by idle and lifetime policy
+type webSocketConn struct {
+	net.Conn
+	active   int64
+	closed   string
+	lock     sync.Mutex
+	done     chan int
+	doneOnce sync.Once
+}
+
+func newWebSocketConn(raw net.Conn, idle, lifetime time.Duration) (conn *webSocketConn) {
+	conn = &webSocketConn{Conn: raw, active: time.Now().UnixNano(), done: make(chan int)}
+	if idle > 0 || lifetime > 0 {
+		go conn.watch(idle, lifetime)
+	}
+	return
+}
+
+func (c *webSocketConn) watch(idle, lifetime time.Duration) {
+	begin := time.Now()
+	interval := idle
+	if interval <= 0 || (lifetime > 0 && lifetime < interval) {
+		interval = lifetime
+	}
+	ticker := time.NewTicker(interval / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			if lifetime > 0 && now.Sub(begin) >= lifetime {
+				c.closeBy("lifetime")
+				return
+			}
+			if idle > 0 && now.Sub(time.Unix(0, atomic.LoadInt64(&c.active))) >= idle {
+				c.closeBy("idle")
+				return
+			}
+		}
+	}
+}
+
+func (c *webSocketConn) closeBy(reason string) {
+	c.lock.Lock()
+	if len(c.closed) < 1 {
+		c.closed = reason
+	}
+	c.lock.Unlock()
+	DebugLog("Discover websocket from %v is closed by %v", c.RemoteAddr(), reason)
+	c.Close()
+}
+
+func (c *webSocketConn) reason() (reason string) {
+	c.lock.Lock()
+	reason = c.closed
+	c.lock.Unlock()
+	return
+}
+
+func (c *webSocketConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	if n > 0 {
+		atomic.StoreInt64(&c.active, time.Now().UnixNano())
+	}
+	return
+}
+
+func (c *webSocketConn) Write(p []byte) (n int, err error) {
+	n, err = c.Conn.Write(p)
+	if n > 0 {
+		atomic.StoreInt64(&c.active, time.Now().UnixNano())
+	}
+	return
+}
+
+func (c *webSocketConn) Close() (err error) {
+	c.doneOnce.Do(func() { close(c.done) })
+	err = c.Conn.Close()
+	return
+}
+
+func (d *Discover) writeWebSocketMetrics(w io.Writer) {
+	all := d.WebSocketStats()
+	fmt.Fprintf(w, "# HELP pdservice_websocket_active The number of active proxied websocket connections.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_websocket_active gauge\n")
+	for _, stats := range all {
+		fmt.Fprintf(w, "pdservice_websocket_active{prefix=%q,service=%q} %v\n", stats.Prefix, stats.Name, stats.Active)
+	}
+	fmt.Fprintf(w, "# HELP pdservice_websocket_rejected_total The total number of websocket connections rejected by max connections.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_websocket_rejected_total counter\n")
+	for _, stats := range all {
+		fmt.Fprintf(w, "pdservice_websocket_rejected_total{prefix=%q,service=%q} %v\n", stats.Prefix, stats.Name, stats.Rejected)
+	}
+	fmt.Fprintf(w, "# HELP pdservice_websocket_closed_total The total number of websocket connections closed by idle timeout or max lifetime.\n")
+	fmt.Fprintf(w, "# TYPE pdservice_websocket_closed_total counter\n")
+	for _, stats := range all {
+		fmt.Fprintf(w, "pdservice_websocket_closed_total{prefix=%q,service=%q,reason=\"idle\"} %v\n", stats.Prefix, stats.Name, stats.Idle)
+		fmt.Fprintf(w, "pdservice_websocket_closed_total{prefix=%q,service=%q,reason=\"lifetime\"} %v\n", stats.Prefix, stats.Name, stats.Lifetime)
+	}
+}
@@ -0,0 +1,100 @@
+package discover
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocketLimit(t *testing.T) {
+	backend := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		io.Copy(conn, conn)
+	}))
+	defer backend.Close()
+	discover := NewDiscover()
+	discover.HostSuff = ".test.loc"
+	discover.WebSocketIdle = 200 * time.Millisecond
+	discover.applyProxy(map[string]*Container{"v100.ds": {ID: "c1", Name: "ds", Version: "1.0.0", Forwards: map[string]*Forward{
+		"v100.ds": {Name: "web", Prefix: "v100.ds", Type: "http", URI: strings.TrimPrefix(backend.URL, "http://"), WebSocketMax: 1},
+	}}})
+	ts := httptest.NewServer(discover)
+	defer ts.Close()
+	dial := func() (ws *websocket.Conn, err error) {
+		config, _ := websocket.NewConfig("ws://v100.ds.test.loc/", "http://v100.ds.test.loc/")
+		conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+		if err == nil {
+			ws, err = websocket.NewClient(config, conn)
+		}
+		return
+	}
+	ws, err := dial()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer ws.Close()
+	buffer := make([]byte, 16)
+	ws.Write([]byte("abc"))
+	if n, err := ws.Read(buffer); err != nil || string(buffer[:n]) != "abc" {
+		t.Errorf("%v,%v", err, string(buffer[:n]))
+		return
+	}
+	//over max
+	if _, err = dial(); err == nil {
+		t.Error("error")
+		return
+	}
+	//closed by idle
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = ws.Read(buffer); err == nil {
+		t.Error("not closed")
+		return
+	}
+	time.Sleep(50 * time.Millisecond)
+	all := discover.WebSocketStats()
+	if len(all) != 1 || all[0].Active != 0 || all[0].Total != 1 || all[0].Rejected != 1 || all[0].Idle != 1 {
+		t.Error(all)
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	discover.WriteMetrics(buf)
+	for _, line := range []string{
+		`pdservice_websocket_active{prefix="v100.ds",service="ds"} 0`,
+		`pdservice_websocket_rejected_total{prefix="v100.ds",service="ds"} 1`,
+		`pdservice_websocket_closed_total{prefix="v100.ds",service="ds",reason="idle"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("%v not in %v", line, buf.String())
+			return
+		}
+	}
+}
+
+func TestWebSocketLifetime(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newWebSocketConn(server, time.Hour, 100*time.Millisecond)
+	go io.Copy(ioutil.Discard, client)
+	begin := time.Now()
+	for conn.reason() == "" && time.Since(begin) < 5*time.Second {
+		conn.Write([]byte("x"))
+		time.Sleep(10 * time.Millisecond)
+	}
+	if conn.reason() != "lifetime" {
+		t.Error(conn.reason())
+		return
+	}
+	discover := NewDiscover()
+	max, idle, lifetime := discover.webSocketPolicy(&Forward{WebSocketIdle: time.Second})
+	if max != 0 || idle != time.Second || lifetime != 0 {
+		t.Error(max, idle, lifetime)
+		return
+	}
+}
@@ -0,0 +1,177 @@
+package discover
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codingeasygo/util/xmap"
+)
+
+const (
+	// XDSEndpointPath is the path of envoy REST-JSON endpoint discovery service
+	XDSEndpointPath = "/v3/discovery:endpoints"
+	// XDSEndpointType is the type url of envoy cluster load assignment
+	XDSEndpointType = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+)
+
+// XDSRequest is the envoy discovery request, only version and resource names is used
+type XDSRequest struct {
+	VersionInfo   string   `json:"version_info,omitempty"`
+	ResourceNames []string `json:"resource_names,omitempty"`
+	TypeURL       string   `json:"type_url,omitempty"`
+}
+
+type xdsSocketAddress struct {
+	Protocol  string `json:"protocol,omitempty"`
+	Address   string `json:"address"`
+	PortValue int    `json:"port_value"`
+}
+
+type xdsAddress struct {
+	SocketAddress *xdsSocketAddress `json:"socket_address"`
+}
+
+type xdsEndpoint struct {
+	Address *xdsAddress `json:"address"`
+}
+
+// XDSLbEndpoint is the endpoint of cluster with health status
+type XDSLbEndpoint struct {
+	Endpoint     *xdsEndpoint `json:"endpoint"`
+	HealthStatus string       `json:"health_status,omitempty"`
+}
+
+// XDSLocalityEndpoints is the endpoints of cluster, pdservice has only one locality
+type XDSLocalityEndpoints struct {
+	LbEndpoints []*XDSLbEndpoint `json:"lb_endpoints"`
+}
+
+// XDSClusterLoadAssignment is the endpoints of cluster which is named by forward prefix
+type XDSClusterLoadAssignment struct {
+	Type        string                  `json:"@type"`
+	ClusterName string                  `json:"cluster_name"`
+	Endpoints   []*XDSLocalityEndpoints `json:"endpoints"`
+}
+
+// XDSResponse is the envoy discovery response of cluster load assignments
+type XDSResponse struct {
+	VersionInfo string                      `json:"version_info"`
+	Resources   []*XDSClusterLoadAssignment `json:"resources"`
+	TypeURL     string                      `json:"type_url"`
+}
+
+// xdsHealth will convert the container health to envoy health status
+func xdsHealth(health string) string {
+	switch health {
+	case "healthy":
+		return "HEALTHY"
+	case "unhealthy":
+		return "UNHEALTHY"
+	case "starting":
+		return "DEGRADED"
+	default:
+		return ""
+	}
+}
+
+// XDSEndpoints will return the cluster load assignments of http/tcp/udp forwards which is not hidden and not tenant,
+// the cluster is named by forward prefix and filtered by names when it is not empty, the dns name of forward is resolved
+// to one endpoint per address by resolver cache, because envoy requires the ip of socket address, the version is hash of resources
+func (d *Discover) XDSEndpoints(names []string) (res *XDSResponse) {
+	filter := map[string]bool{}
+	for _, name := range names {
+		filter[name] = true
+	}
+	res = &XDSResponse{Resources: []*XDSClusterLoadAssignment{}, TypeURL: XDSEndpointType}
+	type xdsTarget struct {
+		Prefix  string
+		Forward *Forward
+		Health  string
+	}
+	targets := []*xdsTarget{}
+	d.proxyLock.RLock()
+	for prefix, service := range d.proxyAll {
+		forward := service.Forwards[prefix]
+		if forward == nil || forward.Type == "unix" || len(service.Tenant) > 0 || d.isHidden(service, forward) {
+			continue
+		}
+		if len(filter) > 0 && !filter[prefix] {
+			continue
+		}
+		targets = append(targets, &xdsTarget{Prefix: prefix, Forward: forward, Health: service.Health})
+	}
+	d.proxyLock.RUnlock()
+	for _, target := range targets {
+		host, port, err := net.SplitHostPort(target.Forward.URI)
+		if err != nil {
+			continue
+		}
+		portValue, err := strconv.Atoi(port)
+		if err != nil {
+			continue
+		}
+		ips := []string{host}
+		if net.ParseIP(host) == nil {
+			entry, err := d.resolveHost(context.Background(), host)
+			if err != nil {
+				WarnLog("Discover xds resolve %v of %v fail with %v", host, target.Prefix, err)
+				continue
+			}
+			ips = append([]string{}, entry.IPs...)
+			sort.Strings(ips)
+		}
+		protocol := ""
+		if target.Forward.Type == "udp" {
+			protocol = "UDP"
+		}
+		endpoints := &XDSLocalityEndpoints{LbEndpoints: []*XDSLbEndpoint{}}
+		for _, ip := range ips {
+			endpoints.LbEndpoints = append(endpoints.LbEndpoints, &XDSLbEndpoint{
+				Endpoint:     &xdsEndpoint{Address: &xdsAddress{SocketAddress: &xdsSocketAddress{Protocol: protocol, Address: ip, PortValue: portValue}}},
+				HealthStatus: xdsHealth(target.Health),
+			})
+		}
+		res.Resources = append(res.Resources, &XDSClusterLoadAssignment{
+			Type:        XDSEndpointType,
+			ClusterName: target.Prefix,
+			Endpoints:   []*XDSLocalityEndpoints{endpoints},
+		})
+	}
+	sort.Slice(res.Resources, func(i, j int) bool { return res.Resources[i].ClusterName < res.Resources[j].ClusterName })
+	data, _ := json.Marshal(res.Resources)
+	sum := sha256.Sum256(data)
+	res.VersionInfo = hex.EncodeToString(sum[:8])
+	return
+}
+
+// procXDS will process the envoy REST-JSON endpoint discovery request on admin listener or xds admin api, the not modified
+// is responsed when the version is not changed, so envoy keeps the current endpoints
+func (d *Discover) procXDS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, xmap.M{"code": http.StatusMethodNotAllowed, "message": "method not allowed"})
+		return
+	}
+	req := &XDSRequest{}
+	data, err := ioutil.ReadAll(r.Body)
+	if err == nil && len(data) > 0 {
+		err = json.Unmarshal(data, req)
+	}
+	if err != nil || len(req.TypeURL) > 0 && req.TypeURL != XDSEndpointType {
+		writeJSON(w, http.StatusBadRequest, xmap.M{"code": http.StatusBadRequest, "message": "invalid discovery request"})
+		return
+	}
+	res := d.XDSEndpoints(req.ResourceNames)
+	if len(req.VersionInfo) > 0 && strings.EqualFold(req.VersionInfo, res.VersionInfo) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,106 @@
+package discover
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codingeasygo/util/converter"
+)
+
+func TestXDS(t *testing.T) {
+	discover := NewDiscover()
+	discover.HostSelf = "pdsrv"
+	service := &Container{ID: "c1", Name: "ds", Version: "v1.0.0", Health: "healthy", Forwards: map[string]*Forward{
+		"v100.ds":       {Prefix: "v100.ds", Type: "http", URI: "10.0.0.5:8080"},
+		"tcp://:15432":  {Prefix: "tcp://:15432", Type: "tcp", URI: "10.0.0.5:5432"},
+		"admin.v100.ds": {Prefix: "admin.v100.ds", Type: "http", URI: "10.0.0.5:9090", Hidden: true},
+		"unix:///a":     {Prefix: "unix:///a", Type: "unix", URI: "/tmp/a.sock"},
+	}}
+	for prefix := range service.Forwards {
+		discover.proxyAll[prefix] = service
+	}
+	discover.proxyAll["v100.x.team"] = &Container{ID: "c2", Name: "x", Tenant: "team", Forwards: map[string]*Forward{"v100.x.team": {Prefix: "v100.x.team", URI: "10.0.0.6:80"}}}
+	discover.AdminToken = "123"
+	discover.RoleTokens = map[string]string{"view": RoleViewer}
+	call := func(role, method, path, token string, req *XDSRequest) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(req)
+		r := httptest.NewRequest(method, "http://pdsrv"+path, bytes.NewBuffer(data))
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.RemoteAddr = "127.0.0.1:1000"
+		res := httptest.NewRecorder()
+		discover.RoleHandler(role).ServeHTTP(res, r)
+		return res
+	}
+	//disabled
+	if res := call(RoleControl, "POST", XDSEndpointPath, "", &XDSRequest{}); bytes.Contains(res.Body.Bytes(), []byte("version_info")) {
+		t.Error(res.Body.String())
+		return
+	}
+	if res := call(RoleAll, "POST", "/_api/xds", "view", &XDSRequest{}); res.Code != http.StatusNotFound {
+		t.Error(res.Code)
+		return
+	}
+	discover.XDS = true
+	//public listener is not served without token
+	if res := call(RoleAll, "POST", XDSEndpointPath, "", &XDSRequest{}); bytes.Contains(res.Body.Bytes(), []byte("version_info")) {
+		t.Error(res.Body.String())
+		return
+	}
+	if res := call(RoleAll, "POST", "/_api/xds", "xx", &XDSRequest{}); res.Code != http.StatusUnauthorized {
+		t.Error(res.Code)
+		return
+	}
+	if res := call(RoleAll, "POST", "/_api/xds", "view", &XDSRequest{}); res.Code != http.StatusOK || !bytes.Contains(res.Body.Bytes(), []byte("v100.ds")) {
+		t.Error(res.Code, res.Body.String())
+		return
+	}
+	//admin listener
+	if res := call(RoleControl, "GET", XDSEndpointPath, "", &XDSRequest{}); res.Code != http.StatusMethodNotAllowed {
+		t.Error(res.Code)
+		return
+	}
+	if res := call(RoleControl, "POST", XDSEndpointPath, "", &XDSRequest{TypeURL: "xx"}); res.Code != http.StatusBadRequest {
+		t.Error(res.Code)
+		return
+	}
+	res := call(RoleControl, "POST", XDSEndpointPath, "", &XDSRequest{TypeURL: XDSEndpointType})
+	xds := &XDSResponse{}
+	if err := json.Unmarshal(res.Body.Bytes(), xds); err != nil || len(xds.Resources) != 2 || len(xds.VersionInfo) < 1 {
+		t.Errorf("%v,%v", err, res.Body.String())
+		return
+	}
+	endpoint := xds.Resources[1].Endpoints[0].LbEndpoints[0]
+	if xds.Resources[1].ClusterName != "v100.ds" || endpoint.Endpoint.Address.SocketAddress.PortValue != 8080 || endpoint.HealthStatus != "HEALTHY" {
+		t.Error(res.Body.String())
+		return
+	}
+	//not modified
+	if res := call(RoleControl, "POST", XDSEndpointPath, "", &XDSRequest{VersionInfo: xds.VersionInfo}); res.Code != http.StatusNotModified {
+		t.Error(res.Code)
+		return
+	}
+	//filter
+	if filtered := discover.XDSEndpoints([]string{"tcp://:15432", "none"}); len(filtered.Resources) != 1 || filtered.VersionInfo == xds.VersionInfo {
+		t.Error(filtered)
+		return
+	}
+	//resolve/udp
+	discover.dnsAll = map[string]*dnsEntry{"ds.local": {IPs: []string{"10.0.0.8", "10.0.0.7"}, Expire: time.Now().Add(time.Minute)}}
+	discover.proxyAll["v200.ds"] = &Container{ID: "c3", Name: "ds", Forwards: map[string]*Forward{"v200.ds": {Prefix: "v200.ds", Type: "http", URI: "ds.local:8080"}}}
+	discover.proxyAll["udp://:1053"] = &Container{ID: "c3", Name: "ds", Forwards: map[string]*Forward{"udp://:1053": {Prefix: "udp://:1053", Type: "udp", URI: "10.0.0.7:53"}}}
+	resolved := discover.XDSEndpoints([]string{"v200.ds", "udp://:1053"})
+	if len(resolved.Resources) != 2 {
+		t.Error(converter.JSON(resolved))
+		return
+	}
+	udp, web := resolved.Resources[0].Endpoints[0].LbEndpoints, resolved.Resources[1].Endpoints[0].LbEndpoints
+	if len(udp) != 1 || udp[0].Endpoint.Address.SocketAddress.Protocol != "UDP" || len(web) != 2 || web[0].Endpoint.Address.SocketAddress.Address != "10.0.0.7" ||
+		web[1].Endpoint.Address.SocketAddress.Address != "10.0.0.8" || web[1].Endpoint.Address.SocketAddress.Protocol != "" {
+		t.Error(converter.JSON(resolved))
+		return
+	}
+}
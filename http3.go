@@ -0,0 +1,22 @@
+//go:build http3
+// +build http3
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Supported is true when the QUIC listener is built
+const http3Supported = true
+
+func listenHTTP3(addr, certFile, keyFile string, handler http.Handler) (err error) {
+	server := &http3.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	err = server.ListenAndServeTLS(certFile, keyFile)
+	return
+}
@@ -0,0 +1,17 @@
+//go:build !http3
+// +build !http3
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// http3Supported is false when the QUIC listener is not built, the http3_listen is rejected
+const http3Supported = false
+
+func listenHTTP3(addr, certFile, keyFile string, handler http.Handler) (err error) {
+	err = fmt.Errorf("http3 is not supported, rebuild with -tags http3")
+	return
+}
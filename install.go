@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// InstallOptions is the options to register pdservice as system service
+type InstallOptions struct {
+	Name       string
+	Executable string
+	WorkDir    string
+	Config     string
+	User       string
+	Env        []string
+	Restart    string
+	Start      bool
+}
+
+type envFlag []string
+
+func (e *envFlag) String() string {
+	return strings.Join(*e, ",")
+}
+
+func (e *envFlag) Set(val string) error {
+	if !strings.Contains(val, "=") {
+		return fmt.Errorf("env must be KEY=VALUE")
+	}
+	*e = append(*e, val)
+	return nil
+}
+
+var systemdUnit = template.Must(template.New("systemd").Parse(`[Unit]
+Description=Proxy Docker Server Discover
+After=network-online.target docker.service
+Wants=network-online.target
+
+[Service]
+Type=simple
+{{if .User}}User={{.User}}
+{{end}}WorkingDirectory={{.WorkDir}}
+ExecStart={{.Executable}} serve {{.Config}}
+Restart={{.Restart}}
+RestartSec=3
+LimitNOFILE=65535
+{{range .Env}}Environment="{{.}}"
+{{end}}
+[Install]
+WantedBy=multi-user.target
+`))
+
+// SystemdUnit will render the systemd unit of pdservice by options
+func SystemdUnit(options *InstallOptions) (unit string, err error) {
+	buf := bytes.NewBuffer(nil)
+	err = systemdUnit.Execute(buf, options)
+	unit = buf.String()
+	return
+}
+
+func parseInstallOptions(args []string) (options *InstallOptions, dry bool) {
+	wd, _ := os.Getwd()
+	exe, _ := os.Executable()
+	if len(exe) > 0 {
+		if path, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = path
+		}
+	}
+	options = &InstallOptions{}
+	env := envFlag{}
+	flagSet := flag.NewFlagSet("pdservice install", flag.ExitOnError)
+	flagSet.StringVar(&options.Name, "name", "pdservice", "the service name")
+	flagSet.StringVar(&options.Executable, "exe", exe, "the pdservice executable")
+	flagSet.StringVar(&options.WorkDir, "dir", wd, "the working directory of service")
+	flagSet.StringVar(&options.Config, "c", "conf/pdservice.properties", "the config file, it is relative to working directory")
+	flagSet.StringVar(&options.User, "user", "", "the user to run service, default root")
+	flagSet.StringVar(&options.Restart, "restart", "always", "the systemd restart policy")
+	flagSet.BoolVar(&options.Start, "start", false, "start service after installed")
+	flagSet.BoolVar(&dry, "dry", false, "print the service config only")
+	flagSet.Var(&env, "env", "the environment of service by KEY=VALUE, it can be repeated")
+	flagSet.Parse(args)
+	options.Env = env
+	if abs, err := filepath.Abs(options.WorkDir); err == nil {
+		options.WorkDir = abs
+	}
+	return
+}
+
+func runInstall(args []string) {
+	options, dry := parseInstallOptions(args)
+	if _, err := os.Stat(filepath.Join(options.WorkDir, options.Config)); err != nil && !filepath.IsAbs(options.Config) {
+		fmt.Printf("warning: config %v is not found in %v\n", options.Config, options.WorkDir)
+	}
+	if dry {
+		out, err := describeService(options)
+		if err != nil {
+			exitFail("install fail with %v", err)
+		}
+		fmt.Printf("%v", out)
+		return
+	}
+	if err := installService(options); err != nil {
+		exitFail("install fail with %v", err)
+	}
+	fmt.Printf("install service %v success\n", options.Name)
+}
+
+func runUninstall(args []string) {
+	flagSet := flag.NewFlagSet("pdservice uninstall", flag.ExitOnError)
+	name := flagSet.String("name", "pdservice", "the service name")
+	flagSet.Parse(args)
+	if err := uninstallService(*name); err != nil {
+		exitFail("uninstall fail with %v", err)
+	}
+	fmt.Printf("uninstall service %v success\n", *name)
+}
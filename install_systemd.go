@@ -0,0 +1,68 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+var systemdDir = "/etc/systemd/system"
+
+func systemctl(args ...string) (err error) {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("systemctl %v fail with %v: %s", args, err, out)
+	}
+	return
+}
+
+func describeService(options *InstallOptions) (string, error) {
+	return SystemdUnit(options)
+}
+
+// installService will write systemd unit and enable it
+func installService(options *InstallOptions) (err error) {
+	unit, err := SystemdUnit(options)
+	if err != nil {
+		return
+	}
+	unitFile := filepath.Join(systemdDir, options.Name+".service")
+	if err = ioutil.WriteFile(unitFile, []byte(unit), 0644); err != nil {
+		return
+	}
+	fmt.Printf("write systemd unit to %v\n", unitFile)
+	if err = systemctl("daemon-reload"); err != nil {
+		return
+	}
+	args := []string{"enable", options.Name}
+	if options.Start {
+		args = []string{"enable", "--now", options.Name}
+	}
+	err = systemctl(args...)
+	return
+}
+
+// uninstallService will stop/disable service and remove systemd unit
+func uninstallService(name string) (err error) {
+	unitFile := filepath.Join(systemdDir, name+".service")
+	if _, err = os.Stat(unitFile); err != nil {
+		return
+	}
+	if err = systemctl("disable", "--now", name); err != nil {
+		return
+	}
+	if err = os.Remove(unitFile); err != nil {
+		return
+	}
+	err = systemctl("daemon-reload")
+	return
+}
+
+func runWindowsService(args []string) {
+	exitFail("windows service is not supported on this platform")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	options, dry := parseInstallOptions([]string{"-dir", "/home/pds", "-user", "pds", "-env", "PDSERVICE_ADMIN_TOKEN=123", "-dry"})
+	if !dry || options.Name != "pdservice" || options.WorkDir != "/home/pds" || len(options.Env) != 1 {
+		t.Errorf("%v,%v", dry, options)
+		return
+	}
+	options.Executable = "/usr/local/bin/pdservice"
+	unit, err := SystemdUnit(options)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, line := range []string{
+		"User=pds\n",
+		"WorkingDirectory=/home/pds\n",
+		"ExecStart=/usr/local/bin/pdservice serve conf/pdservice.properties\n",
+		"Restart=always\n",
+		`Environment="PDSERVICE_ADMIN_TOKEN=123"` + "\n",
+	} {
+		if !strings.Contains(unit, line) {
+			t.Errorf("%v not in %v", line, unit)
+			return
+		}
+	}
+	options.User, options.Env = "", nil
+	if unit, _ = SystemdUnit(options); strings.Contains(unit, "User=") || strings.Contains(unit, "Environment=") {
+		t.Error(unit)
+		return
+	}
+	env := envFlag{}
+	if env.Set("xx") == nil || env.Set("A=1") != nil || env.String() != "A=1" {
+		t.Error("error")
+		return
+	}
+}
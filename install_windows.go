@@ -0,0 +1,121 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func describeService(options *InstallOptions) (string, error) {
+	out := fmt.Sprintf("service %v\n", options.Name)
+	out += fmt.Sprintf("  command: %v windows-service %v %v\n", options.Executable, options.WorkDir, options.Config)
+	out += fmt.Sprintf("  restart: %v\n", options.Restart)
+	out += fmt.Sprintf("  environment: %v\n", strings.Join(options.Env, " "))
+	return out, nil
+}
+
+// installService will create windows service which run pdservice by windows-service command
+func installService(options *InstallOptions) (err error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return
+	}
+	defer m.Disconnect()
+	if s, xerr := m.OpenService(options.Name); xerr == nil {
+		s.Close()
+		err = fmt.Errorf("service %v is already installed", options.Name)
+		return
+	}
+	if len(options.User) > 0 {
+		fmt.Printf("warning: user %v is ignored, the windows service is run by LocalSystem\n", options.User)
+	}
+	config := mgr.Config{
+		DisplayName: "Proxy Docker Server Discover",
+		StartType:   mgr.StartAutomatic,
+	}
+	s, err := m.CreateService(options.Name, options.Executable, config, "windows-service", options.WorkDir, options.Config)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	if options.Restart != "no" {
+		err = s.SetRecoveryActions([]mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 3 * time.Second}}, 86400)
+		if err != nil {
+			return
+		}
+	}
+	if len(options.Env) > 0 {
+		key, xerr := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+options.Name, registry.SET_VALUE)
+		if xerr != nil {
+			err = xerr
+			return
+		}
+		err = key.SetStringsValue("Environment", options.Env)
+		key.Close()
+		if err != nil {
+			return
+		}
+	}
+	if options.Start {
+		err = s.Start()
+	}
+	return
+}
+
+// uninstallService will stop and delete windows service
+func uninstallService(name string) (err error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	s.Control(svc.Stop)
+	err = s.Delete()
+	return
+}
+
+type windowsService struct {
+	Config string
+}
+
+func (w *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	go runServe([]string{w.Config})
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for req := range requests {
+		switch req.Cmd {
+		case svc.Interrogate:
+			status <- req.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// runWindowsService will run pdservice by windows service control manager on working directory
+func runWindowsService(args []string) {
+	if len(args) < 2 {
+		exitFail("Usage: pdservice windows-service dir config")
+	}
+	if err := os.Chdir(args[0]); err != nil {
+		exitFail("change working directory fail with %v", err)
+	}
+	if err := svc.Run("pdservice", &windowsService{Config: args[1]}); err != nil {
+		exitFail("run windows service fail with %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/codingeasygo/pdservice/discover"
+)
+
+// ConfigKey is the config key which is read by pdservice, the <tenant>/<registry> in key is replaced by the name in tenants/registries
+type ConfigKey struct {
+	Key     string
+	Type    string
+	Default string
+}
+
+// ConfigSchema is all config keys of pdservice with type and default value, it must be updated when new key is read
+var ConfigSchema = []*ConfigKey{
+	{Key: "listen", Type: "array", Default: ":9231"},
+	{Key: "refresh_time", Type: "int64", Default: "10000"},
+	{Key: "trigger_added", Type: "string", Default: ""},
+	{Key: "trigger_removed", Type: "string", Default: ""},
+	{Key: "trigger_updated", Type: "string", Default: ""},
+	{Key: "log", Type: "int", Default: "30"},
+	{Key: "log_modules", Type: "array", Default: ""},
+	{Key: "http3_listen", Type: "string", Default: ""},
+	{Key: "http3_max_age", Type: "int64", Default: "86400"},
+	{Key: "http3_cert", Type: "string", Default: ""},
+	{Key: "http3_key", Type: "string", Default: ""},
+	{Key: "tls_cert", Type: "string", Default: ""},
+	{Key: "tls_key", Type: "string", Default: ""},
+	{Key: "grpc_listen", Type: "string", Default: ""},
+	{Key: "read_header_timeout", Type: "int64", Default: "10000"},
+	{Key: "read_timeout", Type: "int64", Default: "0"},
+	{Key: "write_timeout", Type: "int64", Default: "0"},
+	{Key: "idle_timeout", Type: "int64", Default: "120000"},
+	{Key: "max_header_bytes", Type: "int", Default: "1048576"},
+	{Key: "admin_tls_cert", Type: "string", Default: ""},
+	{Key: "admin_tls_key", Type: "string", Default: ""},
+	{Key: "admin_client_ca", Type: "string", Default: ""},
+	{Key: "log_ship", Type: "string", Default: ""},
+	{Key: "log_ship_url", Type: "string", Default: ""},
+	{Key: "log_ship_queue", Type: "int", Default: "10000"},
+	{Key: "log_ship_token", Type: "string", Default: ""},
+	{Key: "log_ship_labels", Type: "array", Default: ""},
+	{Key: "log_ship_index", Type: "string", Default: "pdservice"},
+	{Key: "log_ship_access", Type: "int", Default: "0"},
+	{Key: "log_ship_batch", Type: "int", Default: "100"},
+	{Key: "log_ship_interval", Type: "int64", Default: "1000"},
+	{Key: "preview", Type: "string", Default: ""},
+	{Key: "trigger_bash", Type: "string", Default: "bash"},
+	{Key: "trigger_mode", Type: "string", Default: "shell"},
+	{Key: "trigger_powershell", Type: "string", Default: "powershell"},
+	{Key: "trigger_image", Type: "string", Default: ""},
+	{Key: "trigger_network", Type: "string", Default: ""},
+	{Key: "trigger_timeout", Type: "int64", Default: "300000"},
+	{Key: "trigger_types", Type: "array", Default: "http"},
+	{Key: "trigger_batch", Type: "int", Default: "0"},
+	{Key: "hook_timeout", Type: "int64", Default: "10000"},
+	{Key: "hook_hosts", Type: "array", Default: ""},
+	{Key: "hook_max_conns", Type: "int", Default: "16"},
+	{Key: "trigger_finder", Type: "string", Default: ""},
+	{Key: "docker_cert", Type: "string", Default: "certs"},
+	{Key: "docker_addr", Type: "string", Default: "tcp://127.0.0.1:2376"},
+	{Key: "docker_host", Type: "string", Default: "127.0.0.1"},
+	{Key: "docker_clear_delay", Type: "int64", Default: "0"},
+	{Key: "docker_clear_exc", Type: "array", Default: ""},
+	{Key: "docker_prune_delay", Type: "int64", Default: "0"},
+	{Key: "docker_prune_exc", Type: "array", Default: ""},
+	{Key: "docker_rate", Type: "string", Default: "0"},
+	{Key: "docker_burst", Type: "int", Default: "10"},
+	{Key: "host_suffix", Type: "string", Default: ""},
+	{Key: "host_proto", Type: "string", Default: "https"},
+	{Key: "host_self", Type: "string", Default: "https"},
+	{Key: "srv_prefix", Type: "string", Default: "/_s"},
+	{Key: "srv_auth_rate", Type: "int", Default: "30"},
+	{Key: "srv_lock_failures", Type: "int", Default: "5"},
+	{Key: "srv_lock_time", Type: "int64", Default: "300000"},
+	{Key: "dial_timeout", Type: "int64", Default: "5000"},
+	{Key: "stream_keepalive", Type: "int64", Default: "15000"},
+	{Key: "stream_write_timeout", Type: "int64", Default: "0"},
+	{Key: "websocket_max", Type: "int", Default: "0"},
+	{Key: "websocket_idle", Type: "int64", Default: "0"},
+	{Key: "websocket_lifetime", Type: "int64", Default: "0"},
+	{Key: "dial_retry", Type: "int", Default: "3"},
+	{Key: "dial_backoff", Type: "int64", Default: "100"},
+	{Key: "ip_prefer", Type: "string", Default: ""},
+	{Key: "dns_resolve", Type: "int", Default: "0"},
+	{Key: "dns_server", Type: "array", Default: ""},
+	{Key: "dns_search", Type: "array", Default: ""},
+	{Key: "dns_ndots", Type: "int", Default: "1"},
+	{Key: "dns_ttl", Type: "int64", Default: "30000"},
+	{Key: "dns_min_ttl", Type: "int64", Default: "1000"},
+	{Key: "ssh_tunnel", Type: "string", Default: ""},
+	{Key: "ssh_key", Type: "string", Default: ""},
+	{Key: "ssh_known_hosts", Type: "string", Default: ""},
+	{Key: "wireguard", Type: "string", Default: ""},
+	{Key: "wireguard_config", Type: "string", Default: ""},
+	{Key: "wireguard_command", Type: "string", Default: "wg-quick"},
+	{Key: "wireguard_peers", Type: "array", Default: ""},
+	{Key: "upstream_max_idle", Type: "int", Default: "100"},
+	{Key: "upstream_max_idle_per_host", Type: "int", Default: "2"},
+	{Key: "upstream_max_conns_per_host", Type: "int", Default: "0"},
+	{Key: "upstream_idle_timeout", Type: "int64", Default: "90000"},
+	{Key: "upstream_tls_timeout", Type: "int64", Default: "10000"},
+	{Key: "upstream_keepalive", Type: "int", Default: "1"},
+	{Key: "upstream_share", Type: "int", Default: "1"},
+	{Key: "upstream_tls_cert", Type: "string", Default: ""},
+	{Key: "upstream_tls_key", Type: "string", Default: ""},
+	{Key: "max_body_size", Type: "int64", Default: "0"},
+	{Key: "mirror_max_body", Type: "int64", Default: "1048576"},
+	{Key: "mirror_max_conns", Type: "int", Default: "16"},
+	{Key: "mirror_timeout", Type: "int64", Default: "10000"},
+	{Key: "version_header", Type: "string", Default: "X-PD-Version"},
+	{Key: "version_cookie", Type: "string", Default: "pd_version"},
+	{Key: "default_version", Type: "int", Default: "0"},
+	{Key: "reuse_port", Type: "int", Default: "0"},
+	{Key: "udp_timeout", Type: "int64", Default: "60000"},
+	{Key: "robots", Type: "int", Default: "1"},
+	{Key: "unknown_host", Type: "string", Default: "catalog"},
+	{Key: "hidden", Type: "array", Default: ""},
+	{Key: "admin_prefix", Type: "string", Default: "/_api/"},
+	{Key: "admin_token", Type: "string", Default: ""},
+	{Key: "admin_role_tokens", Type: "array", Default: ""},
+	{Key: "session_secret", Type: "string", Default: ""},
+	{Key: "sign_secret", Type: "string", Default: ""},
+	{Key: "session_ttl", Type: "int64", Default: "900000"},
+	{Key: "session_refresh_ttl", Type: "int64", Default: "86400000"},
+	{Key: "admin_listen", Type: "string", Default: ""},
+	{Key: "admin_pprof", Type: "int", Default: "0"},
+	{Key: "xds", Type: "int", Default: "0"},
+	{Key: "admin_allow", Type: "array", Default: ""},
+	{Key: "tenants", Type: "array", Default: ""},
+	{Key: "tenant_<tenant>_host_suffix", Type: "string", Default: ""},
+	{Key: "tenant_<tenant>_host_self", Type: "string", Default: ""},
+	{Key: "tenant_<tenant>_admin_token", Type: "string", Default: ""},
+	{Key: "tenant_<tenant>_quota_forwards", Type: "int", Default: "0"},
+	{Key: "tenant_<tenant>_quota_ports", Type: "int", Default: "0"},
+	{Key: "tenant_<tenant>_quota_rate", Type: "int", Default: "0"},
+	{Key: "ldap_addr", Type: "string", Default: ""},
+	{Key: "ldap_user_dn", Type: "string", Default: "uid=%v"},
+	{Key: "ldap_base_dn", Type: "string", Default: ""},
+	{Key: "ldap_user_attr", Type: "string", Default: "uid"},
+	{Key: "ldap_role", Type: "string", Default: ""},
+	{Key: "ldap_timeout", Type: "int64", Default: "5000"},
+	{Key: "ldap_skip_verify", Type: "int", Default: "0"},
+	{Key: "ldap_cache_time", Type: "int64", Default: "60000"},
+	{Key: "ldap_groups", Type: "array", Default: ""},
+	{Key: "ldap_catalog", Type: "int", Default: "0"},
+	{Key: "secret_ttl", Type: "int64", Default: "300000"},
+	{Key: "vault_addr", Type: "string", Default: ""},
+	{Key: "vault_token", Type: "string", Default: ""},
+	{Key: "filter_exec", Type: "array", Default: ""},
+	{Key: "middlewares", Type: "array", Default: strings.Join(discover.DefaultMiddlewares, ",")},
+	{Key: "stats", Type: "int", Default: "0"},
+	{Key: "restart_jitter", Type: "int64", Default: "0"},
+	{Key: "supervisor", Type: "int", Default: "0"},
+	{Key: "supervisor_threshold", Type: "int", Default: "3"},
+	{Key: "supervisor_backoff", Type: "int64", Default: "10000"},
+	{Key: "supervisor_max", Type: "int", Default: "5"},
+	{Key: "supervisor_hook", Type: "string", Default: ""},
+	{Key: "flap_window", Type: "int64", Default: "600000"},
+	{Key: "flap_threshold", Type: "int", Default: "5"},
+	{Key: "flap_objective", Type: "string", Default: "0.99"},
+	{Key: "flap_hook", Type: "string", Default: ""},
+	{Key: "probe_interval", Type: "int64", Default: "0"},
+	{Key: "probe_timeout", Type: "int64", Default: "5000"},
+	{Key: "probe_threshold", Type: "int", Default: "3"},
+	{Key: "probe_hook", Type: "string", Default: ""},
+	{Key: "prefix_collision", Type: "string", Default: "newest"},
+	{Key: "collision_hook", Type: "string", Default: ""},
+	{Key: "recreate_grace", Type: "int64", Default: "0"},
+	{Key: "goroutine_limit", Type: "int", Default: "0"},
+	{Key: "fd_limit", Type: "int", Default: "0"},
+	{Key: "resource_hook", Type: "string", Default: ""},
+	{Key: "compose_files", Type: "array", Default: ""},
+	{Key: "compose_command", Type: "string", Default: "docker compose"},
+	{Key: "compose_hook", Type: "string", Default: ""},
+	{Key: "backends", Type: "array", Default: "docker"},
+	{Key: "nomad_addr", Type: "string", Default: "http://127.0.0.1:4646"},
+	{Key: "nomad_token", Type: "string", Default: ""},
+	{Key: "nomad_namespace", Type: "string", Default: "*"},
+	{Key: "nomad_timeout", Type: "int64", Default: "10000"},
+	{Key: "host_service_dir", Type: "string", Default: "services.d"},
+	{Key: "host_service_watch", Type: "int64", Default: "1000"},
+	{Key: "agent_server", Type: "string", Default: ""},
+	{Key: "agent_token", Type: "string", Default: ""},
+	{Key: "agent_name", Type: "string", Default: ""},
+	{Key: "agent_host", Type: "string", Default: ""},
+	{Key: "agent_hosts", Type: "array", Default: ""},
+	{Key: "agent_interval", Type: "int64", Default: "5000"},
+	{Key: "agent_timeout", Type: "int64", Default: "10000"},
+	{Key: "agent_expire", Type: "int64", Default: "60000"},
+	{Key: "latency", Type: "int", Default: "0"},
+	{Key: "latency_file", Type: "string", Default: ""},
+	{Key: "snapshot_file", Type: "string", Default: ""},
+	{Key: "capture_size", Type: "int", Default: "100"},
+	{Key: "capture_max_body", Type: "int64", Default: "65536"},
+	{Key: "tap_buffer", Type: "int", Default: "100"},
+	{Key: "upgrade_url", Type: "string", Default: ""},
+	{Key: "upgrade_key", Type: "string", Default: ""},
+	{Key: "upgrade_drain", Type: "int64", Default: "30000"},
+	{Key: "update_interval", Type: "int64", Default: "0"},
+	{Key: "update_hook", Type: "string", Default: ""},
+	{Key: "export_addr", Type: "string", Default: "127.0.0.1"},
+	{Key: "statsd_addr", Type: "string", Default: ""},
+	{Key: "statsd_prefix", Type: "string", Default: "pdservice."},
+	{Key: "statsd_tags", Type: "array", Default: ""},
+	{Key: "statsd_dogstatsd", Type: "int", Default: "0"},
+	{Key: "export_trigger", Type: "string", Default: ""},
+	{Key: "exports", Type: "array", Default: ""},
+	{Key: "registry_config", Type: "string", Default: ""},
+	{Key: "registries", Type: "array", Default: ""},
+	{Key: "registry_<registry>_server", Type: "string", Default: "<registry>"},
+	{Key: "registry_<registry>_username", Type: "string", Default: ""},
+	{Key: "registry_<registry>_password", Type: "string", Default: ""},
+	{Key: "registry_<registry>_helper", Type: "string", Default: ""},
+	{Key: "slow_start", Type: "int64", Default: "0"},
+	{Key: "breaker_failures", Type: "int", Default: "0"},
+	{Key: "breaker_open_time", Type: "int64", Default: "10000"},
+	{Key: "breaker_page", Type: "string", Default: ""},
+	{Key: "quota_forwards", Type: "int", Default: "0"},
+	{Key: "quota_ports", Type: "int", Default: "0"},
+	{Key: "quota_rate", Type: "int", Default: "0"},
+	{Key: "quota_mode", Type: "string", Default: "reject"},
+	{Key: "geoip_header", Type: "string", Default: ""},
+	{Key: "trusted_proxies", Type: "array", Default: ""},
+	{Key: "client_cert_header", Type: "string", Default: "X-PD-Client-Cert"},
+	{Key: "auth_user_header", Type: "string", Default: "X-Auth-User"},
+	{Key: "auth_groups_header", Type: "string", Default: "X-Auth-Groups"},
+	{Key: "client_auth", Type: "array", Default: ""},
+	{Key: "waf_file", Type: "string", Default: ""},
+	{Key: "geoip_db", Type: "string", Default: ""},
+	{Key: "read_only", Type: "int", Default: "0"},
+	{Key: "unknown_template", Type: "string", Default: ""},
+	{Key: "error_template", Type: "string", Default: ""},
+	{Key: "preview_static", Type: "string", Default: "/_static/"},
+	{Key: "static_roots", Type: "array", Default: ""},
+	{Key: "unix_roots", Type: "array", Default: ""},
+	{Key: "tls_roots", Type: "array", Default: ""},
+	{Key: "match_domains", Type: "array", Default: ""},
+	{Key: "admin_server", Type: "string", Default: ""},
+}
@@ -1,41 +1,247 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/codingeasygo/pdservice/discover"
-	"github.com/codingeasygo/util/xprop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
-	if len(os.Args) > 1 && os.Args[1] == "-v" {
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "-v" {
 		fmt.Printf("pdservice %v version\n", Version)
 		return
 	}
+	command := "serve"
+	if len(args) > 0 {
+		if _, ok := commands[args[0]]; ok {
+			command = args[0]
+			args = args[1:]
+		}
+	}
+	commands[command](args)
+}
+
+func runServe(args []string) {
 	confPath := "conf/pdservice.properties"
-	if len(os.Args) > 1 {
-		confPath = os.Args[1]
+	if len(args) > 0 {
+		confPath = args[0]
 	}
 	wd, _ := os.Getwd()
 	fmt.Printf("starting pdservice with working on %v\n", wd)
-	cfg := xprop.NewConfig()
-	err := cfg.Load(confPath)
+	cfg, err := LoadConfig(confPath)
 	if err != nil {
 		panic(err)
 	}
 	cfg.Print()
-	listenAddr := cfg.StrDef(":9231", "listen")
+	server, err := newServer(cfg)
+	if err != nil {
+		panic(err)
+	}
+	server.ConfigItems = cfg.Items(true)
+	listenAddrs := cfg.ArrayStrDef([]string{":9231"}, "listen")
 	refreshTime := cfg.Int64Def(10000, "refresh_time")
 	triggerAdded := cfg.StrDef("", "trigger_added")
 	triggerRemoved := cfg.StrDef("", "trigger_removed")
 	triggerUpdated := cfg.StrDef("", "trigger_updated")
+	discover.SetLogLevel(cfg.IntDef(30, "log"))
+	moduleLevels, err := discover.ParseModuleLogLevels(cfg.ArrayStrDef(nil, "log_modules"))
+	if err != nil {
+		panic(err)
+	}
+	for module, level := range moduleLevels {
+		discover.SetModuleLogLevel(module, level)
+	}
+	shipper, err := newLogShipper(cfg, server)
+	if err != nil {
+		panic(err)
+	}
+	if shipper != nil {
+		shipper.Start()
+		discover.SetLogShipper(shipper)
+	}
+	if _, err := server.LoadSnapshot(); err != nil {
+		discover.WarnLog("load snapshot fail with %v", err)
+	}
+	server.StartRefresh(time.Duration(refreshTime)*time.Millisecond, triggerAdded, triggerRemoved, triggerUpdated)
+	http3Addr := cfg.StrDef("", "http3_listen")
+	if len(http3Addr) > 0 {
+		_, http3Port, err := net.SplitHostPort(http3Addr)
+		if err != nil {
+			panic(err)
+		}
+		if !http3Supported {
+			panic("http3_listen is set, but http3 is not supported, rebuild with -tags http3")
+		}
+		server.AltSvc = fmt.Sprintf(`h3=":%v"; ma=%v`, http3Port, cfg.Int64Def(86400, "http3_max_age"))
+		go func() {
+			err := listenHTTP3(http3Addr, cfg.StrDef("", "http3_cert"), cfg.StrDef("", "http3_key"), server)
+			if err != nil {
+				panic(err)
+			}
+		}()
+	}
+	tlsCert, tlsKey := cfg.StrDef("", "tls_cert"), cfg.StrDef("", "tls_key")
+	var tlsConfig *tls.Config
+	if len(tlsCert) > 0 && len(tlsKey) > 0 {
+		tlsConfig, err = server.ServerTLSConfig(tlsCert, tlsKey)
+		if err != nil {
+			panic(err)
+		}
+	}
+	serveErr := make(chan error, len(listenAddrs))
+	for _, listen := range listenAddrs {
+		listenAddr, role, err := discover.ParseListen(listen)
+		if err != nil {
+			panic(err)
+		}
+		ln, err := discover.Listen("tcp", listenAddr, server.ReusePort)
+		if err != nil {
+			panic(listenError(listenAddr, err))
+		}
+		httpServer := &http.Server{
+			Handler:           server.RoleHandler(role),
+			ReadHeaderTimeout: time.Duration(cfg.Int64Def(10000, "read_header_timeout")) * time.Millisecond,
+			ReadTimeout:       time.Duration(cfg.Int64Def(0, "read_timeout")) * time.Millisecond,
+			WriteTimeout:      time.Duration(cfg.Int64Def(0, "write_timeout")) * time.Millisecond,
+			IdleTimeout:       time.Duration(cfg.Int64Def(120000, "idle_timeout")) * time.Millisecond,
+			MaxHeaderBytes:    cfg.IntDef(1<<20, "max_header_bytes"),
+			TLSConfig:         tlsConfig,
+		}
+		fmt.Printf("pdservice listen %v on %v\n", role, ln.Addr())
+		server.AddUpgradeServer(listenAddr, httpServer, ln)
+		go func() {
+			if httpServer.TLSConfig != nil {
+				serveErr <- httpServer.ServeTLS(ln, "", "")
+			} else {
+				serveErr <- httpServer.Serve(ln)
+			}
+		}()
+	}
+	if len(server.AdminListen) > 0 {
+		ln, err := discover.Listen("tcp", server.AdminListen, server.ReusePort)
+		if err != nil {
+			panic(listenError(server.AdminListen, err))
+		}
+		adminServer := &http.Server{
+			Handler:           server.RoleHandler(discover.RoleControl),
+			ReadHeaderTimeout: time.Duration(cfg.Int64Def(10000, "read_header_timeout")) * time.Millisecond,
+			IdleTimeout:       time.Duration(cfg.Int64Def(120000, "idle_timeout")) * time.Millisecond,
+			MaxHeaderBytes:    cfg.IntDef(1<<20, "max_header_bytes"),
+		}
+		adminCert, adminKey := cfg.StrDef("", "admin_tls_cert"), cfg.StrDef("", "admin_tls_key")
+		if len(adminCert) > 0 && len(adminKey) > 0 {
+			adminServer.TLSConfig, err = server.AdminTLSConfig(adminCert, adminKey, cfg.StrDef("", "admin_client_ca"))
+			if err != nil {
+				panic(err)
+			}
+		}
+		fmt.Printf("pdservice listen %v on %v\n", discover.RoleControl, ln.Addr())
+		server.AddUpgradeServer(server.AdminListen, adminServer, ln)
+		go func() {
+			if adminServer.TLSConfig != nil {
+				serveErr <- adminServer.ServeTLS(ln, "", "")
+			} else {
+				serveErr <- adminServer.Serve(ln)
+			}
+		}()
+	}
+	if grpcAddr := cfg.StrDef("", "grpc_listen"); len(grpcAddr) > 0 {
+		ln, err := discover.Listen("tcp", grpcAddr, server.ReusePort)
+		if err != nil {
+			panic(listenError(grpcAddr, err))
+		}
+		opts := []grpc.ServerOption{}
+		if tlsConfig != nil {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcServer := server.NewGRPCServer(opts...)
+		fmt.Printf("pdservice listen grpc on %v\n", ln.Addr())
+		go func() {
+			if err := grpcServer.Serve(ln); err != nil {
+				serveErr <- err
+			}
+		}()
+	}
+	for {
+		if err := <-serveErr; err != http.ErrServerClosed {
+			panic(err)
+		}
+	}
+}
+
+// listenError will explain the listen error when the address is bound by previous crashed instance or other process
+func listenError(addr string, err error) error {
+	if discover.IsAddrInUse(err) {
+		return fmt.Errorf("listen on %v fail with %v, the address is bound by other process, please check if previous pdservice is still running", addr, err)
+	}
+	return err
+}
+
+func newLogShipper(cfg *Config, server *discover.Discover) (shipper *discover.LogShipper, err error) {
+	kind := cfg.StrDef("", "log_ship")
+	if len(kind) < 1 {
+		return
+	}
+	shipper, err = discover.NewLogShipper(kind, cfg.StrDef("", "log_ship_url"), cfg.IntDef(10000, "log_ship_queue"))
+	if err != nil {
+		return
+	}
+	shipper.Token, err = server.ResolveSecret(cfg.StrDef("", "log_ship_token"))
+	if err != nil {
+		return
+	}
+	shipper.Secret = server.SignSecret
+	for _, label := range cfg.ArrayStrDef(nil, "log_ship_labels") {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 {
+			err = fmt.Errorf("invalid log ship label %v, must be key=value", label)
+			return
+		}
+		shipper.Labels[parts[0]] = parts[1]
+	}
+	shipper.Index = cfg.StrDef("pdservice", "log_ship_index")
+	shipper.Access = cfg.IntDef(0, "log_ship_access") == 1
+	shipper.BatchSize = cfg.IntDef(100, "log_ship_batch")
+	shipper.FlushInterval = time.Duration(cfg.Int64Def(1000, "log_ship_interval")) * time.Millisecond
+	return
+}
+
+func newQuota(cfg *Config, prefix string) (quota *discover.Quota) {
+	forwards := cfg.IntDef(0, prefix+"_forwards")
+	ports := cfg.IntDef(0, prefix+"_ports")
+	rate := cfg.IntDef(0, prefix+"_rate")
+	if forwards > 0 || ports > 0 || rate > 0 {
+		quota = &discover.Quota{Forwards: forwards, Ports: ports, Rate: rate}
+	}
+	return
+}
+
+func newServer(cfg *Config) (server *discover.Discover, err error) {
 	priview := cfg.StrDef("", "preview")
-	server := discover.NewDiscover()
+	server = discover.NewDiscover()
 	server.TriggerBash = cfg.StrDef("bash", "trigger_bash")
+	server.TriggerMode = cfg.StrDef("shell", "trigger_mode")
+	server.TriggerPowerShell = cfg.StrDef("powershell", "trigger_powershell")
+	server.TriggerImage = cfg.StrDef("", "trigger_image")
+	server.TriggerNetwork = cfg.StrDef("", "trigger_network")
+	server.TriggerTimeout = time.Duration(cfg.Int64Def(300000, "trigger_timeout")) * time.Millisecond
+	server.TriggerTypes = cfg.ArrayStrDef([]string{"http"}, "trigger_types")
+	server.TriggerBatch = cfg.IntDef(0, "trigger_batch") == 1
+	server.HookTimeout = time.Duration(cfg.Int64Def(10000, "hook_timeout")) * time.Millisecond
+	server.HookHosts = cfg.ArrayStrDef(nil, "hook_hosts")
+	server.HookMaxConns = cfg.IntDef(16, "hook_max_conns")
 	server.DockerFinder = cfg.StrDef("", "trigger_finder")
 	server.DockerCert = cfg.StrDef("certs", "docker_cert")
 	server.DockerAddr = cfg.StrDef("tcp://127.0.0.1:2376", "docker_addr")
@@ -44,20 +250,327 @@ func main() {
 	server.DockerClearExc = cfg.ArrayStrDef(nil, "docker_clear_exc")
 	server.DockerPruneDelay = time.Duration(cfg.Int64Def(0, "docker_prune_delay")) * time.Minute
 	server.DockerPruneExc = cfg.ArrayStrDef(nil, "docker_prune_exc")
+	if rate := cfg.StrDef("0", "docker_rate"); len(rate) > 0 {
+		server.DockerRate, err = strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return
+		}
+	}
+	server.DockerBurst = cfg.IntDef(10, "docker_burst")
 	server.HostSuff = cfg.StrDef("", "host_suffix")
 	server.HostProto = cfg.StrDef("https", "host_proto")
 	server.HostSelf = cfg.StrDef("https", "host_self")
 	server.SrvPrefix = cfg.StrDef("/_s", "srv_prefix")
-	if len(priview) > 0 {
-		server.Preview, err = template.ParseFiles(priview)
+	server.SrvAuthRate = cfg.IntDef(30, "srv_auth_rate")
+	server.SrvLockFailures = cfg.IntDef(5, "srv_lock_failures")
+	server.SrvLockTime = time.Duration(cfg.Int64Def(300000, "srv_lock_time")) * time.Millisecond
+	server.DialTimeout = time.Duration(cfg.Int64Def(5000, "dial_timeout")) * time.Millisecond
+	server.StreamKeepAlive = time.Duration(cfg.Int64Def(15000, "stream_keepalive")) * time.Millisecond
+	server.StreamWriteTimeout = time.Duration(cfg.Int64Def(0, "stream_write_timeout")) * time.Millisecond
+	server.WebSocketMax = cfg.IntDef(0, "websocket_max")
+	server.WebSocketIdle = time.Duration(cfg.Int64Def(0, "websocket_idle")) * time.Millisecond
+	server.WebSocketLifetime = time.Duration(cfg.Int64Def(0, "websocket_lifetime")) * time.Millisecond
+	server.DialRetry = cfg.IntDef(3, "dial_retry")
+	server.DialBackoff = time.Duration(cfg.Int64Def(100, "dial_backoff")) * time.Millisecond
+	server.IPPrefer = cfg.StrDef("", "ip_prefer")
+	if server.IPPrefer != "" && server.IPPrefer != "ipv4" && server.IPPrefer != "ipv6" {
+		err = fmt.Errorf("ip_prefer %v is invalid, must be ipv4 or ipv6", server.IPPrefer)
+		return
+	}
+	server.DNSResolve = cfg.IntDef(0, "dns_resolve") == 1
+	server.DNSServers = cfg.ArrayStrDef(nil, "dns_server")
+	server.DNSSearch = cfg.ArrayStrDef(nil, "dns_search")
+	server.DNSNdots = cfg.IntDef(1, "dns_ndots")
+	if len(server.DNSServers) == 1 && server.DNSServers[0] == "system" {
+		resolv := discover.SystemResolvConf()
+		server.DNSServers = resolv.Servers
+		if len(server.DNSSearch) < 1 {
+			server.DNSSearch, server.DNSNdots = resolv.Search, resolv.Ndots
+		}
+	}
+	server.DNSTTL = time.Duration(cfg.Int64Def(30000, "dns_ttl")) * time.Millisecond
+	server.DNSMinTTL = time.Duration(cfg.Int64Def(1000, "dns_min_ttl")) * time.Millisecond
+	server.SSHTunnel = cfg.StrDef("", "ssh_tunnel")
+	server.SSHKey = cfg.StrDef("", "ssh_key")
+	server.SSHKnownHosts = cfg.StrDef("", "ssh_known_hosts")
+	server.WireGuard = cfg.StrDef("", "wireguard")
+	server.WireGuardConfig = cfg.StrDef("", "wireguard_config")
+	server.WireGuardCommand = cfg.StrDef("wg-quick", "wireguard_command")
+	server.WireGuardPeers, err = discover.ParseWireGuardPeers(cfg.ArrayStrDef(nil, "wireguard_peers"))
+	if err != nil {
+		return
+	}
+	server.Upstream.MaxIdleConns = cfg.IntDef(100, "upstream_max_idle")
+	server.Upstream.MaxIdleConnsPerHost = cfg.IntDef(2, "upstream_max_idle_per_host")
+	server.Upstream.MaxConnsPerHost = cfg.IntDef(0, "upstream_max_conns_per_host")
+	server.Upstream.IdleConnTimeout = time.Duration(cfg.Int64Def(90000, "upstream_idle_timeout")) * time.Millisecond
+	server.Upstream.TLSHandshakeTimeout = time.Duration(cfg.Int64Def(10000, "upstream_tls_timeout")) * time.Millisecond
+	server.Upstream.DisableKeepAlives = cfg.IntDef(1, "upstream_keepalive") == 0
+	server.Upstream.Share = cfg.IntDef(1, "upstream_share") == 1
+	if upstreamCert := cfg.StrDef("", "upstream_tls_cert"); len(upstreamCert) > 0 {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(upstreamCert, cfg.StrDef(upstreamCert, "upstream_tls_key"))
 		if err != nil {
-			panic(err)
+			return
 		}
+		server.Upstream.Certificates = []tls.Certificate{cert}
 	}
-	discover.SetLogLevel(cfg.IntDef(30, "log"))
-	server.StartRefresh(time.Duration(refreshTime)*time.Millisecond, triggerAdded, triggerRemoved, triggerUpdated)
-	err = http.ListenAndServe(listenAddr, server)
+	server.MaxBodySize = cfg.Int64Def(0, "max_body_size")
+	server.MirrorMaxBody = cfg.Int64Def(1024*1024, "mirror_max_body")
+	server.MirrorMaxConns = cfg.IntDef(16, "mirror_max_conns")
+	server.MirrorTimeout = time.Duration(cfg.Int64Def(10000, "mirror_timeout")) * time.Millisecond
+	server.VersionHeader = cfg.StrDef("X-PD-Version", "version_header")
+	server.VersionCookie = cfg.StrDef("pd_version", "version_cookie")
+	server.DefaultVersion = cfg.IntDef(0, "default_version") == 1
+	server.ReusePort = cfg.IntDef(0, "reuse_port") == 1
+	server.UDPTimeout = time.Duration(cfg.Int64Def(60000, "udp_timeout")) * time.Millisecond
+	server.Robots = cfg.IntDef(1, "robots") == 1
+	server.UnknownHost = cfg.StrDef("catalog", "unknown_host")
+	server.Hidden = cfg.ArrayStrDef(nil, "hidden")
+	server.AdminPrefix = cfg.StrDef("/_api/", "admin_prefix")
+	server.AdminToken = cfg.StrDef("", "admin_token")
+	server.RoleTokens, err = discover.ParseRoleTokens(cfg.ArrayStrDef(nil, "admin_role_tokens"))
 	if err != nil {
-		panic(err)
+		return
+	}
+	server.SessionSecret = cfg.StrDef("", "session_secret")
+	server.SessionTTL = time.Duration(cfg.Int64Def(900000, "session_ttl")) * time.Millisecond
+	server.SessionRefreshTTL = time.Duration(cfg.Int64Def(86400000, "session_refresh_ttl")) * time.Millisecond
+	server.AdminListen = cfg.StrDef("", "admin_listen")
+	server.AdminPprof = cfg.IntDef(0, "admin_pprof") == 1
+	server.XDS = cfg.IntDef(0, "xds") == 1
+	server.AdminAllow, err = discover.ParseAllow(cfg.ArrayStrDef(nil, "admin_allow"))
+	if err != nil {
+		return
+	}
+	for _, name := range cfg.ArrayStrDef(nil, "tenants") {
+		if !discover.ValidTenant(name) {
+			err = fmt.Errorf("tenant %v is invalid", name)
+			return
+		}
+		server.Tenants[name] = &discover.Tenant{
+			Name:       name,
+			HostSuff:   cfg.StrDef("", "tenant_"+name+"_host_suffix"),
+			HostSelf:   cfg.StrDef("", "tenant_"+name+"_host_self"),
+			AdminToken: cfg.StrDef("", "tenant_"+name+"_admin_token"),
+			Quota:      newQuota(cfg, "tenant_"+name+"_quota"),
+		}
+	}
+	if ldapAddr := cfg.StrDef("", "ldap_addr"); len(ldapAddr) > 0 {
+		server.LDAP = &discover.LDAP{
+			Addr:       ldapAddr,
+			UserDN:     cfg.StrDef("uid=%v", "ldap_user_dn"),
+			BaseDN:     cfg.StrDef("", "ldap_base_dn"),
+			UserAttr:   cfg.StrDef("uid", "ldap_user_attr"),
+			Role:       cfg.StrDef("", "ldap_role"),
+			Timeout:    time.Duration(cfg.Int64Def(5000, "ldap_timeout")) * time.Millisecond,
+			SkipVerify: cfg.IntDef(0, "ldap_skip_verify") == 1,
+			CacheTime:  time.Duration(cfg.Int64Def(60000, "ldap_cache_time")) * time.Millisecond,
+		}
+		server.LDAP.Groups, err = discover.ParseLDAPGroups(cfg.ArrayStrDef(nil, "ldap_groups"))
+		if err != nil {
+			return
+		}
+		server.LDAPCatalog = cfg.IntDef(0, "ldap_catalog") == 1
+	}
+	server.SecretTTL = time.Duration(cfg.Int64Def(300000, "secret_ttl")) * time.Millisecond
+	server.VaultAddr = cfg.StrDef("", "vault_addr")
+	server.VaultToken = cfg.StrDef("", "vault_token")
+	server.SignSecret = cfg.StrDef("", "sign_secret")
+	tokens := []*string{&server.VaultToken, &server.AdminToken, &server.SessionSecret, &server.SignSecret, &server.AgentToken}
+	for _, tenant := range server.Tenants {
+		tokens = append(tokens, &tenant.AdminToken)
+	}
+	for _, token := range tokens {
+		if *token, err = server.ResolveSecret(*token); err != nil {
+			return
+		}
+	}
+	roleTokens := map[string]string{}
+	for token, role := range server.RoleTokens {
+		var resolved string
+		if resolved, err = server.ResolveSecret(token); err != nil {
+			return
+		}
+		roleTokens[resolved] = role
+	}
+	server.RoleTokens = roleTokens
+	for _, command := range cfg.ArrayStrDef(nil, "filter_exec") {
+		var filter discover.ContainerFilter
+		filter, err = server.NewExecFilter(command)
+		if err != nil {
+			return
+		}
+		server.AddFilter(filter)
+	}
+	server.Middlewares = cfg.ArrayStrDef(discover.DefaultMiddlewares, "middlewares")
+	if err = server.CheckMiddlewares(); err != nil {
+		return
+	}
+	server.Stats = cfg.IntDef(0, "stats") == 1
+	server.RestartJitter = time.Duration(cfg.Int64Def(0, "restart_jitter")) * time.Millisecond
+	server.Supervisor = cfg.IntDef(0, "supervisor") == 1
+	server.SupervisorThreshold = cfg.IntDef(3, "supervisor_threshold")
+	server.SupervisorBackoff = time.Duration(cfg.Int64Def(10000, "supervisor_backoff")) * time.Millisecond
+	server.SupervisorMax = cfg.IntDef(5, "supervisor_max")
+	server.SupervisorHook = cfg.StrDef("", "supervisor_hook")
+	server.FlapWindow = time.Duration(cfg.Int64Def(600000, "flap_window")) * time.Millisecond
+	server.FlapThreshold = cfg.IntDef(5, "flap_threshold")
+	if objective := cfg.StrDef("0.99", "flap_objective"); len(objective) > 0 {
+		server.FlapObjective, err = strconv.ParseFloat(objective, 64)
+		if err != nil {
+			return
+		}
+	}
+	server.FlapHook = cfg.StrDef("", "flap_hook")
+	server.ProbeInterval = time.Duration(cfg.Int64Def(0, "probe_interval")) * time.Millisecond
+	server.ProbeTimeout = time.Duration(cfg.Int64Def(5000, "probe_timeout")) * time.Millisecond
+	server.ProbeThreshold = cfg.IntDef(3, "probe_threshold")
+	server.ProbeHook = cfg.StrDef("", "probe_hook")
+	server.PrefixCollision = cfg.StrDef("newest", "prefix_collision")
+	server.CollisionHook = cfg.StrDef("", "collision_hook")
+	server.GoroutineLimit = cfg.IntDef(0, "goroutine_limit")
+	server.FDLimit = cfg.IntDef(0, "fd_limit")
+	server.ResourceHook = cfg.StrDef("", "resource_hook")
+	server.ComposeFiles = cfg.ArrayStrDef(nil, "compose_files")
+	server.ComposeCommand = cfg.StrDef("docker compose", "compose_command")
+	server.ComposeHook = cfg.StrDef("", "compose_hook")
+	server.Backends = cfg.ArrayStrDef([]string{"docker"}, "backends")
+	for _, backend := range server.Backends {
+		if backend != "docker" && backend != "nomad" && backend != "host" && backend != "agent" {
+			err = fmt.Errorf("backend %v is invalid, must be docker, nomad, host or agent", backend)
+			return
+		}
+	}
+	server.NomadAddr = cfg.StrDef("http://127.0.0.1:4646", "nomad_addr")
+	server.NomadToken, err = server.ResolveSecret(cfg.StrDef("", "nomad_token"))
+	if err != nil {
+		return
+	}
+	server.NomadNamespace = cfg.StrDef("*", "nomad_namespace")
+	server.NomadTimeout = time.Duration(cfg.Int64Def(10000, "nomad_timeout")) * time.Millisecond
+	server.HostServiceDir = cfg.StrDef("services.d", "host_service_dir")
+	server.HostServiceWatch = time.Duration(cfg.Int64Def(1000, "host_service_watch")) * time.Millisecond
+	hostname, _ := os.Hostname()
+	server.AgentServer = cfg.StrDef("", "agent_server")
+	server.AgentToken = cfg.StrDef("", "agent_token")
+	server.AgentName = cfg.StrDef(hostname, "agent_name")
+	server.AgentHost = cfg.StrDef("", "agent_host")
+	server.AgentHosts = map[string]string{}
+	for _, val := range cfg.ArrayStrDef(nil, "agent_hosts") {
+		parts := strings.SplitN(val, "=", 2)
+		if len(parts) != 2 || len(parts[0]) < 1 || len(parts[1]) < 1 {
+			err = fmt.Errorf("invalid agent host %v, must be name=host", val)
+			return
+		}
+		server.AgentHosts[parts[0]] = parts[1]
+	}
+	server.AgentTimeout = time.Duration(cfg.Int64Def(10000, "agent_timeout")) * time.Millisecond
+	server.AgentExpire = time.Duration(cfg.Int64Def(60000, "agent_expire")) * time.Millisecond
+	server.RecreateGrace = time.Duration(cfg.Int64Def(0, "recreate_grace")) * time.Millisecond
+	server.Latency = cfg.IntDef(0, "latency") == 1
+	server.LatencyFile = cfg.StrDef("", "latency_file")
+	server.SnapshotFile = cfg.StrDef("", "snapshot_file")
+	server.CaptureSize = cfg.IntDef(100, "capture_size")
+	server.CaptureMaxBody = cfg.Int64Def(65536, "capture_max_body")
+	server.TapBuffer = cfg.IntDef(100, "tap_buffer")
+	server.UpgradeURL = cfg.StrDef("", "upgrade_url")
+	server.UpgradeVersion = Version
+	server.UpgradeKey = cfg.StrDef("", "upgrade_key")
+	server.UpgradeDrain = time.Duration(cfg.Int64Def(30000, "upgrade_drain")) * time.Millisecond
+	if err = server.LoadLatency(); err != nil {
+		return
+	}
+	server.UpdateInterval = time.Duration(cfg.Int64Def(0, "update_interval")) * time.Millisecond
+	server.UpdateHook = cfg.StrDef("", "update_hook")
+	server.ExportAddr = cfg.StrDef("127.0.0.1", "export_addr")
+	if addr := cfg.StrDef("", "statsd_addr"); len(addr) > 0 {
+		server.StatsD, err = discover.NewStatsD(addr, cfg.StrDef("pdservice.", "statsd_prefix"), cfg.ArrayStrDef(nil, "statsd_tags"), cfg.IntDef(0, "statsd_dogstatsd") == 1)
+		if err != nil {
+			return
+		}
+	}
+	server.ExportTrigger = cfg.StrDef("", "export_trigger")
+	server.Exports, err = discover.ParseExports(cfg.ArrayStrDef(nil, "exports"))
+	if err != nil {
+		return
+	}
+	server.RegistryConfig = cfg.StrDef("", "registry_config")
+	for _, name := range cfg.ArrayStrDef(nil, "registries") {
+		registry := &discover.Registry{
+			Server:   cfg.StrDef(name, "registry_"+name+"_server"),
+			Username: cfg.StrDef("", "registry_"+name+"_username"),
+			Password: cfg.StrDef("", "registry_"+name+"_password"),
+			Helper:   cfg.StrDef("", "registry_"+name+"_helper"),
+		}
+		server.Registries[registry.Server] = registry
+	}
+	server.SlowStart = time.Duration(cfg.Int64Def(0, "slow_start")) * time.Millisecond
+	server.BreakerFailures = cfg.IntDef(0, "breaker_failures")
+	server.BreakerOpenTime = time.Duration(cfg.Int64Def(10000, "breaker_open_time")) * time.Millisecond
+	server.BreakerPage = cfg.StrDef("", "breaker_page")
+	server.ServiceQuota = newQuota(cfg, "quota")
+	server.QuotaMode = cfg.StrDef("reject", "quota_mode")
+	if server.QuotaMode != "reject" && server.QuotaMode != "flag" {
+		err = fmt.Errorf("quota_mode %v is invalid", server.QuotaMode)
+		return
+	}
+	server.GeoIPHeader = cfg.StrDef("", "geoip_header")
+	server.TrustedProxies, err = discover.ParseAllow(cfg.ArrayStrDef(nil, "trusted_proxies"))
+	if err != nil {
+		return
+	}
+	server.ClientCertHeader = cfg.StrDef("X-PD-Client-Cert", "client_cert_header")
+	server.AuthUserHeader = cfg.StrDef("X-Auth-User", "auth_user_header")
+	server.AuthGroupsHeader = cfg.StrDef("X-Auth-Groups", "auth_groups_header")
+	for _, rule := range cfg.ArrayStrDef(nil, "client_auth") {
+		var auth *discover.ClientAuth
+		auth, err = discover.ParseClientAuth(rule)
+		if err != nil {
+			return
+		}
+		server.ClientAuth = append(server.ClientAuth, auth)
+	}
+	if wafFile := cfg.StrDef("", "waf_file"); len(wafFile) > 0 {
+		var rules []*discover.WAFRule
+		rules, err = discover.LoadWAFRules(wafFile)
+		if err != nil {
+			return
+		}
+		server.WAF = discover.NewWAF(rules)
+	}
+	if geoipDB := cfg.StrDef("", "geoip_db"); len(geoipDB) > 0 {
+		server.GeoIP, err = discover.OpenGeoIP(geoipDB)
+		if err != nil {
+			return
+		}
+	}
+	if cfg.IntDef(0, "read_only") == 1 {
+		server.SetReadOnly(true)
+	}
+	if unknownTemplate := cfg.StrDef("", "unknown_template"); len(unknownTemplate) > 0 {
+		server.UnknownTemplate, err = template.New(filepath.Base(unknownTemplate)).Funcs(discover.PreviewFuncs).ParseFiles(unknownTemplate)
+		if err != nil {
+			return
+		}
+	}
+	server.StaticRoots = cfg.ArrayStrDef(nil, "static_roots")
+	server.UnixRoots = cfg.ArrayStrDef(nil, "unix_roots")
+	server.TLSRoots = cfg.ArrayStrDef(nil, "tls_roots")
+	server.MatchDomains = cfg.ArrayStrDef(nil, "match_domains")
+	if errorTemplate := cfg.StrDef("", "error_template"); len(errorTemplate) > 0 {
+		server.ErrorTemplate, err = template.New(filepath.Base(errorTemplate)).Funcs(discover.PreviewFuncs).ParseFiles(errorTemplate)
+		if err != nil {
+			return
+		}
+	}
+	if len(priview) > 0 {
+		server.PreviewFile = priview
+		server.PreviewStatic = cfg.StrDef("/_static/", "preview_static")
+		_, err = server.LoadPreview()
+		if err != nil {
+			return
+		}
 	}
+	return
 }